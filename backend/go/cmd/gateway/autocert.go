@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/neuronai/backend/go/internal/config"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertManager returns the manager of the certificates obtained from
+// Let's Encrypt, or the ACME server at TLS_AUTOCERT_DIRECTORY_URL, for
+// TLS_AUTOCERT_HOSTS, or nil without them. Setting the hosts accepts the
+// server's terms of service.
+func autocertManager(cfg *config.Config) *autocert.Manager {
+	if len(cfg.TLSAutocertHosts) == 0 {
+		return nil
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertHosts...),
+		Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+		Email:      cfg.TLSAutocertEmail,
+	}
+	if cfg.TLSAutocertDirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: cfg.TLSAutocertDirectoryURL}
+	}
+	return m
+}
+
+// redirectServer returns the plain HTTP listener at HTTP_REDIRECT_ADDR,
+// which redirects to the HTTPS port and, with m, answers its HTTP-01
+// challenges.
+func redirectServer(cfg *config.Config, m *autocert.Manager, logger *slog.Logger) *http.Server {
+	handler := middleware.HTTPSRedirect(cfg.Port)
+	if m != nil {
+		handler = m.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:         cfg.HTTPRedirectAddr,
+		Handler:      middleware.RequestLogger(logger)(handler),
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/neuronai/backend/go/internal/config"
+)
+
+// settingFlags are the flags that override settings, by flag name, with
+// the environment variables they override.
+var settingFlags = map[string]string{
+	"port":        "PORT",
+	"python-addr": "PYTHON_SERVICE_ADDR",
+	"log-level":   "LOG_LEVEL",
+}
+
+// devJWTSecret signs tokens under -dev when JWT_SECRET is not set. It is
+// public, so -dev also forces the development environment, which would
+// refuse it.
+const devJWTSecret = "neuronai-dev-only-jwt-secret"
+
+// registerSettingFlags defines the flags of settingFlags.
+func registerSettingFlags() {
+	flag.String("port", "", "port to listen on; overrides PORT")
+	flag.String("python-addr", "", "address of the Python service; overrides PYTHON_SERVICE_ADDR")
+	flag.String("log-level", "", "debug, info, warn or error; overrides LOG_LEVEL")
+}
+
+// loadOptions returns the config load options of the flags set: settings
+// flags override the environment and config file, and dev runs the gateway
+// for local development, with debug logs and a throwaway JWT secret unless
+// others are configured.
+func loadOptions(dev bool) []config.LoadOption {
+	overrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if env, ok := settingFlags[f.Name]; ok {
+			overrides[env] = f.Value.String()
+		}
+	})
+	opts := []config.LoadOption{config.WithOverrides(overrides)}
+	if dev {
+		overrides["ENVIRONMENT"] = "development"
+		opts = append(opts, config.WithDefaults(map[string]string{
+			"LOG_LEVEL":  "debug",
+			"JWT_SECRET": devJWTSecret,
+		}))
+	}
+	return opts
+}
+
+// printConfig prints every setting of cfg as JSON, secrets redacted, and
+// returns the exit code.
+func printConfig(cfg *config.Config) int {
+	out, err := json.MarshalIndent(config.Values(cfg), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
@@ -1,75 +1,1049 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/neuronai/backend/go/internal/abuse"
+	"github.com/neuronai/backend/go/internal/admin"
+	"github.com/neuronai/backend/go/internal/admission"
 	"github.com/neuronai/backend/go/internal/api"
+	"github.com/neuronai/backend/go/internal/apikeys"
+	"github.com/neuronai/backend/go/internal/attachment"
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/backplane"
+	"github.com/neuronai/backend/go/internal/clientip"
 	"github.com/neuronai/backend/go/internal/config"
+	"github.com/neuronai/backend/go/internal/graphql"
 	"github.com/neuronai/backend/go/internal/grpc"
+	"github.com/neuronai/backend/go/internal/grpcweb"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/maintenance"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/moderation"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"github.com/neuronai/backend/go/internal/quota"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+	"github.com/neuronai/backend/go/internal/redact"
+	"github.com/neuronai/backend/go/internal/remoteconfig"
+	"github.com/neuronai/backend/go/internal/revocation"
+	"github.com/neuronai/backend/go/internal/router"
+	"github.com/neuronai/backend/go/internal/scheduler"
+	"github.com/neuronai/backend/go/internal/selftest"
+	"github.com/neuronai/backend/go/internal/session"
+	"github.com/neuronai/backend/go/internal/throttle"
+	"github.com/neuronai/backend/go/internal/tokens"
+	"github.com/neuronai/backend/go/internal/userinfo"
 	"github.com/neuronai/backend/go/internal/websocket"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
-	cfg, err := config.Load()
+	selfTest := flag.Bool("selftest", false, "boot the gateway, run a scripted chat round-trip over every transport and exit non-zero on failure")
+	selfTestMock := flag.Bool("selftest-mock", false, "with -selftest, run against an in-process mock of the Python service")
+	configFile := flag.String("config", config.Env("CONFIG_FILE"), "YAML or JSON config file; environment variables take precedence over it")
+	hashPassword := flag.Bool("hash-password", false, "read a password from stdin, print its hash for AUTH_USERS_FILE and exit")
+	dev := flag.Bool("dev", false, "run for local development: debug logs and, unless JWT_SECRET is set, a throwaway JWT secret")
+	printSettings := flag.Bool("print-config", false, "print the effective config as JSON, secrets redacted, and exit")
+	registerSettingFlags()
+	flag.Parse()
+
+	if *hashPassword {
+		os.Exit(printPasswordHash())
+	}
+
+	loadOpts := loadOptions(*dev)
+	cfg, err := config.LoadFile(*configFile, loadOpts...)
+	if err != nil {
+		fatal("Failed to load config", err)
+	}
+	// Dynamic settings in the remote config store take precedence over the
+	// environment and the file, so the config is loaded again with them.
+	var remoteStore remoteconfig.Store
+	var remoteValues map[string]string
+	if cfg.RemoteConfig != "" {
+		remoteStore, remoteValues, err = loadRemote(cfg)
+		if err != nil {
+			fatal("Failed to load the remote config", err)
+		}
+		loadOpts = append(loadOpts, config.WithRemote(remoteValues))
+		if cfg, err = config.LoadFile(*configFile, loadOpts...); err != nil {
+			fatal("Failed to load config", err)
+		}
+	}
+	if *printSettings {
+		os.Exit(printConfig(cfg))
+	}
+	var redactor *redact.Redactor
+	if cfg.Redaction {
+		redactor = redact.New(cfg.RedactKeys, cfg.RedactStrict)
+	}
+	// The level is variable so config reloads, the admin API and SIGUSR1
+	// can change it.
+	logLevel := logging.NewLevels(cfg.LogLevel)
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, logLevel, logging.WithRedactor(redactor))
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to configure logging", err)
+	}
+	slog.SetDefault(logger)
+
+	if *selfTest && *selfTestMock {
+		addr, stop, err := selftest.StartMockUpstream()
+		if err != nil {
+			fatal("Failed to start mock upstream", err)
+		}
+		defer stop()
+		cfg.AIBackends = []config.AIBackend{{Name: "python", Addr: addr, Weight: 1}}
+		cfg.GRPCInsecure = true
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	pythonClient, err := grpc.NewPythonClient(cfg.PythonServiceAddr)
+	clientOpts := []grpc.ClientOption{
+		grpc.WithLogger(logger),
+		grpc.WithPoolSize(cfg.GRPCPoolSize),
+		grpc.WithMaxStreams(cfg.GRPCMaxStreams),
+		grpc.WithUserLimit(cfg.UserMaxConcurrentRequests),
+	}
+	backendTLS, err := pythonTLS(cfg)
+	if err != nil {
+		fatal("Failed to configure TLS to the AI backends", err)
+	}
+	var sched *scheduler.Scheduler
+	if cfg.SchedulerCapacity > 0 {
+		weights := make(map[middleware.Priority]int, len(cfg.SchedulerWeights))
+		for plan, weight := range cfg.SchedulerWeights {
+			weights[middleware.Priority(plan)] = weight
+		}
+		sched = scheduler.New(scheduler.Options{
+			Capacity: cfg.SchedulerCapacity,
+			Weights:  weights,
+			MaxWait:  cfg.SchedulerMaxWait,
+		})
+		clientOpts = append(clientOpts, grpc.WithScheduler(sched))
+	}
+
+	pythonClient, err := grpc.NewRoutingClient(aiBackends(cfg, backendTLS), clientOpts...)
 	if err != nil {
-		log.Fatalf("Failed to connect to Python service: %v", err)
+		fatal("Failed to connect to the AI backends", err)
 	}
 	defer pythonClient.Close()
 
-	wsHub := websocket.NewHub(pythonClient)
+	var moderators moderation.Chain
+	if cfg.ModerationDenylistFile != "" {
+		denylist, err := moderation.LoadDenylist(cfg.ModerationDenylistFile)
+		if err != nil {
+			fatal("Failed to load moderation denylist", err)
+		}
+		moderators = append(moderators, denylist)
+	}
+	if cfg.ModerationWebhookURL != "" {
+		moderators = append(moderators, moderation.NewWebhook(cfg.ModerationWebhookURL, cfg.ModerationTimeout))
+	}
+
+	validation := middleware.TokenValidation{
+		Issuer:           cfg.JWTIssuer,
+		Audience:         cfg.JWTAudience,
+		Leeway:           cfg.JWTLeeway,
+		RequireNotBefore: cfg.JWTRequireNotBefore,
+	}
+	authOpts := []middleware.AuthOption{middleware.WithTokenValidation(validation)}
+	if cfg.APIKeysFile != "" {
+		keys, err := middleware.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			fatal("Failed to load API keys", err)
+		}
+		authOpts = append(authOpts, middleware.WithAPIKeys(keys))
+	}
+	if cfg.SigningKeysFile != "" {
+		keys, err := middleware.LoadSigningKeys(cfg.SigningKeysFile, cfg.SignatureMaxSkew)
+		if err != nil {
+			fatal("Failed to load signing keys", err)
+		}
+		authOpts = append(authOpts, middleware.WithSigningKeys(keys))
+	}
+	var clientCerts *middleware.ClientCerts
+	if cfg.ClientCertsFile != "" {
+		clientCerts, err = middleware.LoadClientCerts(cfg.ClientCertsFile)
+		if err != nil {
+			fatal("Failed to load client certificates", err)
+		}
+		authOpts = append(authOpts, middleware.WithClientCerts(clientCerts))
+	}
+
+	hubOpts := []websocket.Option{websocket.WithLogger(logger), websocket.WithRedactor(redactor), websocket.WithTokenValidation(validation)}
+	if clientCerts != nil {
+		hubOpts = append(hubOpts, websocket.WithClientCerts(clientCerts))
+	}
+	apiOpts := []api.Option{api.WithLogger(logger), api.WithRedactor(redactor)}
+	if cfg.AuthUsersFile != "" {
+		users, err := tokens.LoadUsers(cfg.AuthUsersFile)
+		if err != nil {
+			fatal("Failed to load users", err)
+		}
+		apiOpts = append(apiOpts, api.WithTokenIssuer(tokens.NewIssuer(cfg.JWTSecret, users, cfg.AuthAccessTokenTTL, cfg.AuthRefreshTokenTTL, tokens.WithValidation(validation))))
+		if cfg.LoginThrottle {
+			apiOpts = append(apiOpts, api.WithLoginThrottle(throttle.New(
+				throttle.Policy{
+					FreeAttempts:     cfg.LoginFreeAttempts,
+					Delay:            cfg.LoginDelay,
+					MaxDelay:         cfg.LoginMaxDelay,
+					LockoutThreshold: cfg.LoginLockoutThreshold,
+					Lockout:          cfg.LoginLockout,
+					Window:           cfg.LoginFailureWindow,
+				},
+				throttle.Policy{
+					LockoutThreshold: cfg.LoginIPLockoutThreshold,
+					Lockout:          cfg.LoginLockout,
+					Window:           cfg.LoginFailureWindow,
+				},
+			)))
+		}
+		if cfg.SessionCookies {
+			logins := tokens.NewLoginSessions(users, cfg.SessionIdleTimeout, cfg.SessionMaxAge)
+			apiOpts = append(apiOpts, api.WithLoginSessions(logins))
+			authOpts = append(authOpts, middleware.WithSessions(logins))
+			hubOpts = append(hubOpts, websocket.WithSessions(logins))
+			if !cfg.CSRFProtection {
+				logger.Warn("Session cookies are enabled without CSRF_PROTECTION")
+			}
+		}
+	}
+	if cfg.GuestAccess {
+		apiOpts = append(apiOpts, api.WithGuests(tokens.NewGuests(cfg.JWTSecret, cfg.GuestTokenTTL, cfg.GuestTenant, tokens.WithValidation(validation))))
+		if slices.Contains(cfg.GuestRoutes, "/ws") {
+			hubOpts = append(hubOpts, websocket.WithGuests(cfg.GuestRateLimit.PerMinute/60, cfg.GuestRateLimit.Burst))
+		}
+	}
+	var tickets *tokens.Tickets
+	if cfg.WSTicketTTL > 0 && cfg.JWTSecret != "" {
+		tickets = tokens.NewTickets(cfg.JWTSecret, cfg.WSTicketTTL)
+		apiOpts = append(apiOpts, api.WithWSTickets(tickets))
+		hubOpts = append(hubOpts, websocket.WithTickets(tickets))
+	}
+	if len(cfg.JWTPreviousSecrets) > 0 {
+		authOpts = append(authOpts, middleware.WithPreviousSecrets(cfg.JWTPreviousSecrets...))
+		hubOpts = append(hubOpts, websocket.WithPreviousSecrets(cfg.JWTPreviousSecrets...))
+		if until := cfg.JWTPreviousSecretsUntil; !until.IsZero() {
+			authOpts = append(authOpts, middleware.WithRotationEnd(until))
+			hubOpts = append(hubOpts, websocket.WithRotationEnd(until))
+			if time.Now().After(until) {
+				logger.Warn("JWT_PREVIOUS_SECRETS_UNTIL has passed; previous secrets no longer verify tokens and can be removed",
+					"until", until)
+			}
+		}
+	}
+	if len(cfg.JWTPublicKeys) > 0 || cfg.JWTJWKSURL != "" {
+		keys, err := middleware.LoadPublicKeys(cfg.JWTPublicKeys)
+		if err != nil {
+			fatal("Failed to load JWT public keys", err)
+		}
+		keySet := middleware.NewKeySet(keys, cfg.JWTJWKSURL, cfg.JWTJWKSRefresh)
+		authOpts = append(authOpts, middleware.WithKeySet(keySet))
+		hubOpts = append(hubOpts, websocket.WithKeySet(keySet))
+	}
+	if cfg.OIDCIssuer != "" {
+		oidc := middleware.NewOIDC(cfg.OIDCIssuer, cfg.OIDCAudience, cfg.OIDCJWKSURL, cfg.OIDCJWKSRefresh)
+		authOpts = append(authOpts, middleware.WithOIDC(oidc))
+		hubOpts = append(hubOpts, websocket.WithOIDC(oidc))
+	}
+	var revocations *revocation.List
+	if cfg.RevocationRedisURL != "" {
+		revocations, err = revocation.NewList(cfg.RevocationRedisURL, revocation.DefaultRedisPrefix, cfg.RevocationTTL, cfg.RevocationCacheTTL)
+		if err != nil {
+			fatal("Failed to configure revocation list", err)
+		}
+		defer revocations.Close()
+		authOpts = append(authOpts, middleware.WithRevocation(revocations))
+		hubOpts = append(hubOpts, websocket.WithRevocation(revocations))
+	}
+	var apiKeys *apikeys.Store
+	if cfg.APIKeysRedisURL != "" {
+		limits := apikeys.Limits{MaxTTL: cfg.APIKeysMaxTTL, RateLimit: cfg.APIKeysRateLimit, MaxPerUser: cfg.APIKeysMaxPerUser}
+		apiKeys, err = apikeys.NewStore(cfg.APIKeysRedisURL, apikeys.DefaultRedisPrefix, limits, cfg.APIKeysCacheTTL)
+		if err != nil {
+			fatal("Failed to configure API key store", err)
+		}
+		defer apiKeys.Close()
+		authOpts = append(authOpts, middleware.WithKeyStore(apiKeys))
+	}
+	if cfg.UserServiceURL != "" {
+		users := userinfo.New(cfg.UserServiceURL, cfg.UserServiceCacheTTL)
+		authOpts = append(authOpts, middleware.WithEnricher(users))
+		hubOpts = append(hubOpts, websocket.WithEnricher(users))
+	}
+	if len(moderators) > 0 {
+		hubOpts = append(hubOpts, websocket.WithModerator(moderators))
+		apiOpts = append(apiOpts, api.WithModerator(moderators))
+	}
+
+	if cfg.UploadStoreURL != "" {
+		store := attachment.NewHTTPStore(cfg.UploadStoreURL, cfg.UploadStoreTimeout)
+		hubOpts = append(hubOpts, websocket.WithAttachmentStore(store))
+		apiOpts = append(apiOpts, api.WithAttachmentStore(store))
+	}
+
+	if cfg.AbuseDetection != "off" {
+		detectors := abuse.Chain{abuse.NewHeuristic(abuse.Thresholds{
+			UserRate: cfg.AbuseUserRate,
+			IPRate:   cfg.AbuseIPRate,
+			Repeats:  cfg.AbuseRepeats,
+			URLs:     cfg.AbuseMaxURLs,
+		})}
+		if cfg.AbuseWebhookURL != "" {
+			detectors = append(detectors, abuse.NewWebhook(cfg.AbuseWebhookURL, cfg.AbuseTimeout))
+		}
+		guard := abuse.NewGuard(detectors,
+			abuse.WithShadow(cfg.AbuseDetection == "shadow"),
+			abuse.WithLogger(logger))
+		hubOpts = append(hubOpts, websocket.WithAbuseGuard(guard))
+		apiOpts = append(apiOpts, api.WithAbuseGuard(guard))
+	}
+
+	if cfg.SessionSerialize {
+		locker := session.NewLocker()
+		hubOpts = append(hubOpts, websocket.WithSessionLocker(locker))
+		apiOpts = append(apiOpts, api.WithSessionLocker(locker))
+	}
+
+	if cfg.ResponseCacheSize > 0 {
+		cache := session.NewResponseCache(cfg.ResponseCacheSize, cfg.ResponseCacheTTL)
+		go cache.Run(ctx)
+		hubOpts = append(hubOpts, websocket.WithResponseCache(cache))
+		apiOpts = append(apiOpts, api.WithResponseCache(cache))
+	}
+
+	if cfg.UpstreamLoadURL != "" {
+		controller := admission.NewController(admission.Options{
+			SoftLimit:  cfg.AdmissionSoftLimit,
+			HardLimit:  cfg.AdmissionHardLimit,
+			Mode:       admission.Mode(cfg.AdmissionMode),
+			MaxWait:    cfg.AdmissionMaxWait,
+			StaleAfter: 3 * cfg.AdmissionPollInterval,
+		})
+		go admission.NewPoller(cfg.UpstreamLoadURL, cfg.AdmissionPollInterval, controller).Run(ctx)
+		hubOpts = append(hubOpts, websocket.WithAdmission(controller))
+		apiOpts = append(apiOpts, api.WithAdmission(controller))
+	}
+
+	if cfg.WSReplayBufferSize > 0 {
+		hubOpts = append(hubOpts, websocket.WithReplayBuffer(cfg.WSReplayBufferSize, cfg.WSReplayTTL))
+	}
+	if cfg.WSPresence {
+		hubOpts = append(hubOpts, websocket.WithPresence())
+	}
+
+	grpcWebOpts := []grpcweb.Option{grpcweb.WithStreamTimeout(cfg.HTTPStreamTimeout)}
+	if cfg.PreauthWebhookURL != "" {
+		gate := preauth.NewGate(preauth.NewWebhook(cfg.PreauthWebhookURL, cfg.PreauthTimeout), cfg.PreauthMaxHold)
+		hubOpts = append(hubOpts, websocket.WithPreauth(gate))
+		apiOpts = append(apiOpts, api.WithPreauth(gate))
+		grpcWebOpts = append(grpcWebOpts, grpcweb.WithPreauth(gate))
+	}
+
+	var redisBackplane *backplane.Redis
+	if cfg.BackplaneRedisURL != "" {
+		redisBackplane, err = backplane.NewRedis(cfg.BackplaneRedisURL, cfg.BackplaneRedisChannel)
+		if err != nil {
+			fatal("Failed to configure backplane", err)
+		}
+		defer redisBackplane.Close()
+		hubOpts = append(hubOpts, websocket.WithBackplane(redisBackplane))
+	}
+
+	var recentAudit *audit.Recent
+	if cfg.AuditLog != "" {
+		auditLog, err := audit.Open(cfg.AuditLog)
+		if err != nil {
+			fatal("Failed to configure audit log", err)
+		}
+		defer auditLog.Close()
+		var sink audit.Sink = auditLog
+		if cfg.AuditRecentSize > 0 {
+			recentAudit = audit.NewRecent(cfg.AuditRecentSize)
+			sink = audit.Multi(auditLog, recentAudit)
+		}
+		hubOpts = append(hubOpts, websocket.WithAudit(sink))
+		authOpts = append(authOpts, middleware.WithAudit(sink))
+		apiOpts = append(apiOpts, api.WithAudit(sink))
+	}
+
+	// Maintenance can be entered at runtime at /admin/maintenance even if
+	// it is not configured.
+	maint := maintenance.New(cfg.MaintenanceRetryAfter)
+	configureMaintenance(maint, cfg)
+	if cfg.MaintenanceFile != "" {
+		go maint.WatchFile(ctx, cfg.MaintenanceFile, maintenanceFilePoll)
+	}
+	hubOpts = append(hubOpts, websocket.WithMaintenance(maint))
+	apiOpts = append(apiOpts, api.WithMaintenance(maint))
+
+	var quotas *quota.Manager
+	if cfg.TenantQuotas {
+		quotas, err = quota.Load(cfg.QuotaLimitsFile, cfg.QuotaWindow, quota.Limits{Requests: cfg.QuotaRequests, Tokens: cfg.QuotaTokens})
+		if err != nil {
+			fatal("Failed to load quota limits", err)
+		}
+		hubOpts = append(hubOpts, websocket.WithQuotas(quotas))
+	}
+
+	var limitStore ratelimit.Store
+	var redisLimitStore *ratelimit.RedisStore
+	if cfg.WSLimitStore != "" && cfg.WSMessageRate > 0 {
+		ttl := ratelimit.FillTime(cfg.WSMessageRate, cfg.WSMessageBurst)
+		if strings.HasPrefix(cfg.WSLimitStore, "redis://") || strings.HasPrefix(cfg.WSLimitStore, "rediss://") {
+			redisLimitStore, err = ratelimit.NewRedisStore(cfg.WSLimitStore, ratelimit.DefaultRedisPrefix, ttl)
+			if err != nil {
+				fatal("Failed to configure rate limit store", err)
+			}
+			defer redisLimitStore.Close()
+			limitStore = redisLimitStore
+		} else {
+			limitStore, err = ratelimit.NewFileStore(cfg.WSLimitStore, ttl)
+			if err != nil {
+				fatal("Failed to load rate limit snapshot", err)
+			}
+		}
+		hubOpts = append(hubOpts, websocket.WithLimitStore(limitStore, cfg.WSLimitPersistInterval))
+	}
+
+	hubOpts = append(hubOpts,
+		websocket.WithJWTSecret(cfg.JWTSecret),
+		websocket.WithClientLimits(cfg.WSMessageRate, cfg.WSMessageBurst, cfg.WSMaxStreams),
+		websocket.WithLagGrace(cfg.WSLagGrace),
+		websocket.WithConnectionLimits(cfg.WSMaxConnectionsPerUser, cfg.WSMaxConnections),
+		websocket.WithStats(cfg.WSStatsInterval),
+		websocket.WithShards(cfg.WSHubShards),
+		websocket.WithTimeouts(cfg.WSWriteWait, cfg.WSPongWait, cfg.WSPingPeriod),
+		websocket.WithBufferSizes(cfg.WSReadBufferSize, cfg.WSWriteBufferSize, cfg.WSSendBufferSize),
+		websocket.WithMaxMessageSize(cfg.WSMaxMessageSize),
+	)
+	if cfg.WSCompression {
+		hubOpts = append(hubOpts, websocket.WithCompression(cfg.WSCompressionLevel, cfg.WSCompressionMinSize))
+	}
+	wsHub := websocket.NewHub(pythonClient, hubOpts...)
 	go wsHub.Run(ctx)
 
-	apiHandler := api.NewHandler(pythonClient, wsHub, cfg)
+	apiHandler := api.NewHandler(pythonClient, wsHub, cfg, apiOpts...)
+
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	inventory := admin.NewInventory(cfg.Environment)
+	inventory.AddListener(admin.Listener{Name: "http", Address: addr, Protocol: "http"})
+	inventory.AddBackend(pythonClient)
+	inventory.AddStats("websocket", wsHub)
+	if sched != nil {
+		inventory.AddStats("scheduler", sched)
+	}
+	if cfg.UploadStoreURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "upload_store", Kind: "http", Address: cfg.UploadStoreURL})
+	}
+	if cfg.AbuseWebhookURL != "" && cfg.AbuseDetection != "off" {
+		inventory.AddStaticBackend(admin.Backend{Name: "abuse_webhook", Kind: "http", Address: cfg.AbuseWebhookURL})
+	}
+	if cfg.ModerationWebhookURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "moderation_webhook", Kind: "http", Address: cfg.ModerationWebhookURL})
+	}
+	if cfg.UpstreamLoadURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "upstream_load", Kind: "http", Address: cfg.UpstreamLoadURL})
+	}
+	if cfg.PreauthWebhookURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "preauth_webhook", Kind: "http", Address: cfg.PreauthWebhookURL})
+	}
+	if cfg.OIDCIssuer != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "oidc_issuer", Kind: "http", Address: cfg.OIDCIssuer})
+	}
+	if cfg.UserServiceURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "user_service", Kind: "http", Address: cfg.UserServiceURL})
+	}
+	if cfg.JWTJWKSURL != "" {
+		inventory.AddStaticBackend(admin.Backend{Name: "jwt_jwks", Kind: "http", Address: cfg.JWTJWKSURL})
+	}
+	if redisBackplane != nil {
+		inventory.AddBackend(redisBackplane)
+	}
+	if redisLimitStore != nil {
+		inventory.AddBackend(redisLimitStore)
+	}
+	if revocations != nil {
+		inventory.AddBackend(revocations)
+	}
+	if apiKeys != nil {
+		inventory.AddBackend(apiKeys)
+	}
+	inventory.SetFeature("moderation", len(moderators) > 0)
+	inventory.SetFeature("abuse_detection", cfg.AbuseDetection != "off")
+	inventory.SetFeature("attachments", cfg.UploadStoreURL != "")
+	inventory.SetFeature("session_serialize", cfg.SessionSerialize)
+	inventory.SetFeature("response_cache", cfg.ResponseCacheSize > 0)
+	inventory.SetFeature("ws_resume", cfg.WSReplayBufferSize > 0)
+	inventory.SetFeature("ws_presence", cfg.WSPresence)
+	inventory.SetFeature("ws_stats", cfg.WSStatsInterval > 0)
+	inventory.SetFeature("ws_compression", cfg.WSCompression)
+	inventory.SetFeature("admission_control", cfg.UpstreamLoadURL != "")
+	inventory.SetFeature("priority_scheduling", sched != nil)
+	inventory.SetFeature("preauth", cfg.PreauthWebhookURL != "")
+	inventory.SetFeature("login_throttle", cfg.AuthUsersFile != "" && cfg.LoginThrottle)
+	inventory.SetFeature("tls", cfg.TLSEnabled())
+	inventory.SetFeature("tls_autocert", len(cfg.TLSAutocertHosts) > 0)
+	inventory.SetFeature("client_cert_auth", cfg.ClientCertsFile != "")
+	inventory.SetFeature("redaction", cfg.Redaction)
+	inventory.SetFeature("redaction_strict", cfg.RedactStrict)
+	inventory.SetFeature("admin", cfg.AdminToken != "" || cfg.AdminRole != "")
+	inventory.SetFeature("notifications", cfg.NotifyToken != "")
+	inventory.SetFeature("grpc_web", cfg.GRPCWeb)
+	inventory.SetFeature("grpc_tls", slices.ContainsFunc(cfg.AIBackends, func(b config.AIBackend) bool { return b.TLS }))
+	inventory.SetFeature("ai_backend_routing", len(cfg.AIBackends) > 1)
+	inventory.SetFeature("backplane", cfg.BackplaneRedisURL != "")
+	inventory.SetFeature("ws_limit_store", limitStore != nil)
+	inventory.SetFeature("audit_log", cfg.AuditLog != "")
+	inventory.SetFeature("api_keys", cfg.APIKeysFile != "" || apiKeys != nil)
+	inventory.SetFeature("request_signing", cfg.SigningKeysFile != "")
+	inventory.SetFeature("oidc", cfg.OIDCIssuer != "")
+	inventory.SetFeature("jwt_public_keys", len(cfg.JWTPublicKeys) > 0 || cfg.JWTJWKSURL != "")
+	inventory.SetFeature("token_issuance", cfg.AuthUsersFile != "")
+	inventory.SetFeature("session_cookies", cfg.SessionCookies)
+	inventory.SetFeature("guest_access", cfg.GuestAccess)
+	inventory.SetFeature("token_revocation", cfg.RevocationRedisURL != "")
+	inventory.SetFeature("claims_enrichment", cfg.UserServiceURL != "")
+	inventory.SetFeature("ws_tickets", tickets != nil)
+	inventory.SetFeature("rate_limit", cfg.RateLimit.PerMinute > 0 || len(cfg.RateLimitRoutes) > 0)
+	inventory.SetFeature("tenant_quotas", cfg.TenantQuotas)
+	inventory.SetFeature("csrf", cfg.CSRFProtection)
+	inventory.SetFeature("maintenance_file", cfg.MaintenanceFile != "")
+	inventory.SetFeature("remote_config", cfg.RemoteConfig != "")
+	inventory.SetFeature("ip_filter", len(ipRules(cfg)) > 0)
+
+	// Revision 1 is the boot configuration; reloads append their diffs.
+	configLog := admin.NewConfigLog()
+	configLog.Record("startup", config.Diff(&config.Config{}, cfg))
+
+	mux := router.New(router.OnRoute(inventory.AddRoute), router.PerRoute(func(pattern string) router.Middleware {
+		return router.Named("Metrics", middleware.Instrumented(pattern))
+	}))
+	// Rate limiters are kept, even while off, so config reloads can change
+	// their limits.
+	routeLimiters := make(map[string]*middleware.RateLimiter)
+	guestLimiters := make(map[string]*middleware.RateLimiter)
+	// rateLimit is the rate limit of pattern.
+	rateLimit := func(pattern string) router.Middleware {
+		l := cfg.RouteRateLimit(pattern)
+		limiter := middleware.NewRateLimiter(pattern, l.PerMinute/60, l.Burst, middleware.LimitKey(l.Key))
+		routeLimiters[pattern] = limiter
+		return router.Named("RateLimit", limiter.Middleware)
+	}
+	// meter charges requests to the caller's tenant quota, unless quotas
+	// are off.
+	meter := router.Middleware{}
+	if quotas != nil {
+		meter = router.Named("Quota", quotas.Middleware(middleware.TenantResolver(cfg.TenantHeader)))
+	}
+	// guestGate turns guests away from pattern unless it is one of
+	// GUEST_ROUTES, where it holds them to the guest rate limit.
+	guestGate := func(pattern string) router.Middleware {
+		switch {
+		case !cfg.GuestAccess:
+			return router.Middleware{}
+		case !slices.Contains(cfg.GuestRoutes, pattern):
+			return router.Named("DenyGuests", middleware.DenyGuests(authOpts...))
+		}
+		limiter := middleware.NewRateLimiter(pattern, cfg.GuestRateLimit.PerMinute/60, cfg.GuestRateLimit.Burst, middleware.LimitByIP)
+		guestLimiters[pattern] = limiter
+		return router.Named("GuestRateLimit", limiter.GuestMiddleware)
+	}
+	// audited records requests as audit events of typ, unless the audit
+	// log is off.
+	audited := func(typ audit.Type) router.Middleware {
+		if cfg.AuditLog == "" {
+			return router.Middleware{}
+		}
+		return router.Named("Audited", middleware.Audited(typ, authOpts...))
+	}
+	cors := middleware.NewCORS(cfg.CORSAllowedOrigins)
+	jwtAuth := router.Named("JWTAuth", middleware.JWTAuth(cfg.JWTSecret, authOpts...))
+	// keyLimit holds self-served API keys to their own rate limit, on top
+	// of the route's.
+	keyLimit := router.Middleware{}
+	if apiKeys != nil {
+		keyLimit = router.Named("APIKeyRateLimit", apiKeys.Middleware)
+	}
+	requireScope := func(scope string) router.Middleware {
+		return router.Named("RequireScope", middleware.RequireScope(scope, authOpts...))
+	}
+	// Routes taking request bodies only take JSON.
+	jsonBody := router.Named("RequireJSON", middleware.RequireContentType(middleware.ContentTypeJSON))
+	// During maintenance, routes that start chats refuse them before the
+	// caller is authenticated or charged.
+	paused := router.Named("Maintenance", maint.Middleware)
+	// In read-only windows, routes that change data only serve reads.
+	readOnly := router.Named("ReadOnly", maint.ReadOnlyMiddleware)
+	// apiChain takes JSON bodies, authenticates callers with scope and
+	// applies the rate limits of pattern and of API keys, the guest
+	// restrictions and the tenant quota.
+	apiChain := func(pattern, scope string) []router.Middleware {
+		return []router.Middleware{jsonBody, jwtAuth, rateLimit(pattern), keyLimit, requireScope(scope), guestGate(pattern), meter}
+	}
 
-	mux := http.NewServeMux()
 	mux.HandleFunc("/health", apiHandler.HealthCheck)
-	mux.HandleFunc("/api/v1/chat", apiHandler.Chat)
-	mux.HandleFunc("/api/v1/chat/stream", apiHandler.StreamChat)
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/ws", wsHub.HandleWebSocket)
+	if tickets != nil {
+		// Guests may take a ticket; the hub refuses it unless guests may
+		// use /ws.
+		mux.HandleFunc("/api/v1/ws/ticket", apiHandler.IssueWSTicket, jsonBody, jwtAuth, rateLimit("/api/v1/ws/ticket"))
+	}
 
+	chats := mux.Group("", paused)
+	chats.HandleFunc("/api/v1/chat", apiHandler.Chat, apiChain("/api/v1/chat", middleware.ScopeChatWrite)...)
+	chats.HandleFunc("/api/v1/chat/stream", apiHandler.StreamChat, apiChain("/api/v1/chat/stream", middleware.ScopeChatWrite)...)
+	mux.HandleFunc("/api/v1/sessions/{id}/responses", apiHandler.SessionResponses,
+		append(apiChain("/api/v1/sessions/{id}/responses", middleware.ScopeSessionsRead), audited(audit.TypeExport))...)
+	mux.Handle("/graphql", graphql.NewHandler(wsHub, graphql.WithRedactor(redactor)), apiChain("/graphql", middleware.ScopeChatWrite)...)
+
+	// The auth endpoints are unauthenticated, so their rate limit, by
+	// client IP, is what slows password guessing and bounds how many
+	// guests one client mints.
+	auth := mux.Group("/api/v1/auth", jsonBody)
+	if cfg.AuthUsersFile != "" {
+		auth.HandleFunc("/token", apiHandler.IssueToken, rateLimit("/api/v1/auth/token"))
+		auth.HandleFunc("/refresh", apiHandler.RefreshToken, rateLimit("/api/v1/auth/refresh"))
+		if cfg.SessionCookies {
+			auth.HandleFunc("/session", apiHandler.Session, rateLimit("/api/v1/auth/session"))
+		}
+	}
+	if cfg.GuestAccess {
+		auth.HandleFunc("/guest", apiHandler.IssueGuestToken, rateLimit("/api/v1/auth/guest"))
+	}
+	if apiKeys != nil {
+		// Users manage their keys with their own token; the handlers refuse
+		// API keys and guests.
+		keyChain := []router.Middleware{readOnly, jsonBody, jwtAuth, rateLimit("/api/v1/keys")}
+		mux.HandleFunc("/api/v1/keys", apiKeys.Handler, keyChain...)
+		mux.HandleFunc("/api/v1/keys/{id}", apiKeys.Handler, keyChain...)
+		mux.HandleFunc("/api/v1/keys/{id}/rotate", apiKeys.RotateHandler, keyChain...)
+	}
+
+	if cfg.GRPCWeb {
+		grpcWeb := grpcweb.NewHandler(pythonClient.AIService(), cfg.MaxRequestSize, grpcWebOpts...)
+		browser := chats.Group("", router.Named("CORS", cors.Middleware), jwtAuth, keyLimit)
+		browser.Handle(grpcweb.PathPrefix, grpcWeb,
+			rateLimit(grpcweb.PathPrefix), requireScope(middleware.ScopeChatWrite), guestGate(grpcweb.PathPrefix), meter)
+		// The more specific route takes swarm tasks, with their own scope
+		// and rate limit, away from PathPrefix.
+		requireSwarmRole := router.Middleware{}
+		if cfg.SwarmRole != "" {
+			requireSwarmRole = router.Named("RequireRole", middleware.RequireRole(cfg.SwarmRole, authOpts...))
+		}
+		browser.Handle(grpcweb.SwarmTaskPath, grpcWeb,
+			rateLimit(grpcweb.SwarmTaskPath), requireScope(middleware.ScopeSwarmExecute), requireSwarmRole,
+			guestGate(grpcweb.SwarmTaskPath), meter)
+	}
+	if cfg.NotifyToken != "" {
+		mux.HandleFunc("/internal/v1/users/{id}/notifications", apiHandler.NotifyUser, jsonBody, router.Named("StaticToken", middleware.StaticToken(cfg.NotifyToken)))
+	}
+	if cfg.AdminToken != "" || cfg.AdminRole != "" {
+		// Operators present ADMIN_TOKEN, or a token of a user with
+		// ADMIN_ROLE and, if the token is scoped, admin:read to look and
+		// admin:write to act.
+		adminAuth := []router.Middleware{router.Named("StaticToken", middleware.StaticToken(cfg.AdminToken))}
+		if cfg.AdminRole != "" {
+			fallback := router.Chain{jwtAuth, router.Named("RequireRole", middleware.RequireRole(cfg.AdminRole, authOpts...)),
+				router.Named("RequireScope", middleware.RequireMethodScope(middleware.ScopeAdminRead, middleware.ScopeAdminWrite, authOpts...))}
+			adminAuth = append([]router.Middleware{router.Named("StaticTokenOr", middleware.StaticTokenOr(cfg.AdminToken, fallback.Then))},
+				router.Middleware{Name: "JWTAuth"}, router.Middleware{Name: "RequireRole"}, router.Middleware{Name: "RequireScope"})
+		}
+		// Only admitted requests are actions; rejected ones are already
+		// recorded as auth failures and access denials.
+		admins := mux.Group("/admin", append(append([]router.Middleware{jsonBody}, adminAuth...), audited(audit.TypeAdmin))...)
+		admins.HandleFunc("/runtime", inventory.RuntimeHandler)
+		admins.HandleFunc("/config/changes", configLog.Handler)
+		admins.HandleFunc("/connections", wsHub.ConnectionsHandler)
+		if recentAudit != nil {
+			admins.HandleFunc("/audit", recentAudit.Handler)
+		}
+		if quotas != nil {
+			admins.HandleFunc("/quotas", quotas.Handler)
+			admins.HandleFunc("/quotas/{tenant}", quotas.Handler)
+		}
+		admins.HandleFunc("/maintenance", maint.Handler)
+		logControl := admin.NewLogging(logLevel)
+		admins.HandleFunc("/logging", logControl.LevelHandler)
+		admins.HandleFunc("/logging/traces", logControl.TracesHandler)
+		if revocations != nil {
+			admins.HandleFunc("/revocations", revocations.Handler)
+		}
+		mux.Handle("/admin/ui/", admin.UIHandler("/admin/ui/"))
+	}
+
+	if *selfTest {
+		os.Exit(runSelfTest(ctx, mux, cfg.JWTSecret, validation))
+	}
+
+	writeBootReport(ctx, inventory, cfg)
+
+	handler := middleware.BodyLimit(cfg.MaxRequestSize)(mux)
+	if cfg.CSRFProtection {
+		handler = middleware.CSRF(http.SameSite(cfg.CSRFSameSite), cfg.CSRFCookieSecure)(handler)
+	}
+	if rules := ipRules(cfg); len(rules) > 0 {
+		handler = middleware.NewIPFilter(rules).Middleware(handler)
+	}
+	// Every component keying on the client address takes it from here.
+	resolver := clientip.NewResolver(cfg.ClientIPHeader, cfg.TrustedProxies)
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         addr,
+		Handler:      resolver.Middleware(middleware.RequestLogger(logger)(handler)),
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+	}
+	// The certificate is looked up per handshake so reloads can rotate it.
+	var certificate atomic.Pointer[tls.Certificate]
+	certManager := autocertManager(cfg)
+	if cfg.TLSEnabled() {
+		server.TLSConfig, err = serverTLS(cfg, &certificate, certManager)
+		if err != nil {
+			fatal("Failed to configure TLS", err)
+		}
+	}
+	var redirect *http.Server
+	if cfg.HTTPRedirectAddr != "" {
+		redirect = redirectServer(cfg, certManager, logger)
+	}
+
+	// Reloads swap in the new settings without dropping connections.
+	reloader := config.NewReloader(*configFile, cfg, cfg.ConfigWatchInterval, func(trigger string, next *config.Config, changes []config.Change) error {
+		// Check the certificate and redial first: they are the only changes
+		// that can fail, and a failed reload must leave everything as it was.
+		changed := func(field string) bool {
+			return slices.ContainsFunc(changes, func(c config.Change) bool { return c.Field == field })
+		}
+		var cert *tls.Certificate
+		if changed("TLSCert") || changed("TLSKey") {
+			if !cfg.TLSEnabled() || certManager != nil {
+				return fmt.Errorf("serving a certificate from TLS_CERT takes a restart")
+			}
+			c, err := loadCertificate(next)
+			if err != nil {
+				return err
+			}
+			cert = c
+		}
+		if changed("AIBackends") {
+			if err := pythonClient.SetBackends(aiBackends(next, backendTLS)); err != nil {
+				return fmt.Errorf("failed to connect to the AI backends: %w", err)
+			}
+		}
+		if cert != nil {
+			certificate.Store(cert)
+		}
+		for pattern, limiter := range routeLimiters {
+			l := next.RouteRateLimit(pattern)
+			limiter.SetLimit(l.PerMinute/60, l.Burst, middleware.LimitKey(l.Key))
+		}
+		for _, limiter := range guestLimiters {
+			limiter.SetLimit(next.GuestRateLimit.PerMinute/60, next.GuestRateLimit.Burst, middleware.LimitByIP)
+		}
+		cors.SetOrigins(next.CORSAllowedOrigins)
+		if changed("LogLevel") {
+			logLevel.Set(next.LogLevel)
+		}
+		if changed("MaintenanceMode") || changed("MaintenanceMessage") || changed("MaintenanceReadOnly") {
+			configureMaintenance(maint, next)
+		}
+		if quotas != nil && (changed("QuotaRequests") || changed("QuotaTokens")) {
+			quotas.SetDefaults(quota.Limits{Requests: next.QuotaRequests, Tokens: next.QuotaTokens})
+		}
+		configLog.Record(trigger, changes)
+		return nil
+	}, logger, loadOpts...)
+	go reloader.Run(ctx)
+	if remoteStore != nil {
+		go remoteconfig.Watch(ctx, remoteStore, remoteValues, func(values map[string]string) {
+			// Failures are logged, and the settings in effect kept.
+			reloader.ApplyRemote(values)
+		}, logger)
 	}
 
+	// SIGUSR1 toggles debug logging, for a closer look at a live gateway
+	// without the admin API.
+	debugToggle := make(chan os.Signal, 1)
+	signal.Notify(debugToggle, syscall.SIGUSR1)
+	go func() {
+		for range debugToggle {
+			logger.Info("Log level changed", "level", logLevel.ToggleDebug().String(), "source", "SIGUSR1")
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Starting server on port %d", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+		logger.Info("Starting server", "port", cfg.Port, "tls", cfg.TLSEnabled(), "client_auth", cfg.TLSClientAuth.String())
+		serve := server.ListenAndServe
+		if cfg.TLSEnabled() {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
+			fatal("Server error", err)
 		}
 	}()
+	if redirect != nil {
+		go func() {
+			logger.Info("Redirecting HTTP to HTTPS", "addr", cfg.HTTPRedirectAddr, "acme", certManager != nil)
+			if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Redirect server error", err)
+			}
+		}()
+	}
 
 	<-sigChan
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer shutdownCancel()
 
+	// Drain the hub first so WebSocket chats can finish while the listener
+	// still answers new upgrades with 503.
+	if err := wsHub.Drain(shutdownCtx); err != nil {
+		logger.Warn("WebSocket drain incomplete", logging.Err(err))
+	}
+	if err := wsHub.SaveLimits(shutdownCtx); err != nil {
+		logger.Error("Failed to persist rate limits", logging.Err(err))
+	}
+
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		logger.Error("Server shutdown failed", logging.Err(err))
+	}
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
 	}
 
 	cancel()
-	log.Println("Server stopped")
+	logger.Info("Server stopped")
+}
+
+// ipRules returns the global IP rule followed by the rules of each path
+// prefix, in a stable order.
+func ipRules(cfg *config.Config) []middleware.IPRule {
+	var rules []middleware.IPRule
+	if len(cfg.IPAllow) > 0 || len(cfg.IPDeny) > 0 {
+		rules = append(rules, middleware.IPRule{Allow: cfg.IPAllow, Deny: cfg.IPDeny})
+	}
+	var prefixes []string
+	for prefix := range cfg.IPRouteAllow {
+		prefixes = append(prefixes, prefix)
+	}
+	for prefix := range cfg.IPRouteDeny {
+		if _, ok := cfg.IPRouteAllow[prefix]; !ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		rules = append(rules, middleware.IPRule{PathPrefix: prefix, Allow: cfg.IPRouteAllow[prefix], Deny: cfg.IPRouteDeny[prefix]})
+	}
+	return rules
+}
+
+// serverTLS returns the TLS configuration of the HTTPS listener, serving
+// certificates from m if set, or else the one in certificate, which it
+// loads, and verifying client certificates against TLS_CLIENT_CA_FILE as
+// TLS_CLIENT_AUTH says.
+func serverTLS(cfg *config.Config, certificate *atomic.Pointer[tls.Certificate], m *autocert.Manager) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.ClientAuthType(cfg.TLSClientAuth),
+	}
+	if m != nil {
+		tlsConfig.GetCertificate = m.GetCertificate
+		// TLS-ALPN-01 challenges are answered on the HTTPS port itself.
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	} else {
+		cert, err := loadCertificate(cfg)
+		if err != nil {
+			return nil, err
+		}
+		certificate.Store(cert)
+		tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certificate.Load(), nil
+		}
+	}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CAs: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", cfg.TLSClientCAFile)
+	}
+	return tlsConfig, nil
+}
+
+// aiBackends returns the AI backends of cfg, those using TLS secured with
+// tlsCreds.
+func aiBackends(cfg *config.Config, tlsCreds credentials.TransportCredentials) []grpc.Backend {
+	backends := make([]grpc.Backend, len(cfg.AIBackends))
+	for i, b := range cfg.AIBackends {
+		backends[i] = grpc.Backend{Name: b.Name, Addr: b.Addr, Creds: insecure.NewCredentials(), Agents: b.Agents, Weight: b.Weight}
+		if b.TLS {
+			backends[i].Creds = tlsCreds
+		}
+	}
+	return backends
+}
+
+// pythonTLS returns the TLS credentials of connections to the AI
+// backends, verified against GRPC_CA_FILE or else the system roots.
+func pythonTLS(cfg *config.Config) (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.GRPCCAFile != "" {
+		pem, err := os.ReadFile(cfg.GRPCCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read AI backend CAs: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.GRPCCAFile)
+		}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// loadCertificate loads the server certificate from TLS_CERT and TLS_KEY,
+// or else from TLS_CERT_FILE and TLS_KEY_FILE.
+func loadCertificate(cfg *config.Config) (*tls.Certificate, error) {
+	var cert tls.Certificate
+	var err error
+	if cfg.TLSCert != "" {
+		cert, err = tls.X509KeyPair([]byte(cfg.TLSCert), []byte(cfg.TLSKey))
+	} else {
+		cert, err = tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// fatal logs msg with err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+// remoteLoadTimeout bounds the boot read of the remote config store.
+const remoteLoadTimeout = 10 * time.Second
+
+// loadRemote connects to the remote config store of cfg and reads the
+// settings in it.
+func loadRemote(cfg *config.Config) (remoteconfig.Store, map[string]string, error) {
+	store, err := remoteconfig.New(cfg.RemoteConfig, cfg.RemoteConfigEndpoints, cfg.RemoteConfigPrefix, cfg.RemoteConfigToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteLoadTimeout)
+	defer cancel()
+	values, err := store.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, values, nil
+}
+
+// configureMaintenance enters the maintenance window cfg asks for, read-only
+// or not, or leaves the one the config started. Windows an operator or
+// MAINTENANCE_FILE started are theirs to end.
+func configureMaintenance(maint *maintenance.Mode, cfg *config.Config) {
+	switch {
+	case cfg.MaintenanceReadOnly:
+		maint.EnableReadOnly(maintenance.SourceConfig, cfg.MaintenanceMessage, 0)
+	case cfg.MaintenanceMode:
+		maint.Enable(maintenance.SourceConfig, cfg.MaintenanceMessage, 0)
+	case maint.State().Source == maintenance.SourceConfig:
+		maint.Disable()
+	}
+}
+
+// maintenanceFilePoll is how often MAINTENANCE_FILE is checked.
+const maintenanceFilePoll = 5 * time.Second
+
+// bootCheckTimeout bounds the backend checks run for the boot report.
+const bootCheckTimeout = 5 * time.Second
+
+// writeBootReport logs the boot report as a single JSON line and writes it to
+// cfg.BootReportPath for orchestration tooling. Failed backend checks are
+// reported, not fatal: the gateway still starts and reconnects later.
+func writeBootReport(ctx context.Context, inventory *admin.Inventory, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(ctx, bootCheckTimeout)
+	defer cancel()
+
+	report := inventory.BootReport(ctx, config.Values(cfg))
+	if banner, err := json.Marshal(report); err == nil {
+		slog.Info("Boot report", "report", json.RawMessage(banner))
+	}
+	if !report.Healthy() {
+		slog.Warn("Boot report: some backend checks failed")
+	}
+	if err := report.WriteFile(cfg.BootReportPath); err != nil {
+		slog.Error("Failed to write boot report", logging.Err(err))
+	}
+}
+
+// printPasswordHash hashes the password on the first line of stdin for the
+// users file and returns the process exit code.
+func printPasswordHash() int {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		slog.Error("No password on stdin", logging.Err(err))
+		return 1
+	}
+	hash, err := tokens.HashPassword(password)
+	if err != nil {
+		slog.Error("Failed to hash password", logging.Err(err))
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
+
+// runSelfTest runs the self-test against mux and returns the process exit code.
+func runSelfTest(ctx context.Context, mux http.Handler, jwtSecret string, validation middleware.TokenValidation) int {
+	results, err := selftest.Run(ctx, mux, jwtSecret, validation)
+	for _, r := range results {
+		if r.Err != nil {
+			slog.Error("FAIL "+r.Name, "duration", r.Duration, logging.Err(r.Err))
+		} else {
+			slog.Info("PASS "+r.Name, "duration", r.Duration)
+		}
+	}
+	if err != nil {
+		slog.Error("Self-test failed", logging.Err(err))
+		return 1
+	}
+	slog.Info("Self-test passed")
+	return 0
 }
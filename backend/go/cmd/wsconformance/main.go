@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/websocket/conformance"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	flag.Parse()
+
+	transcripts, err := conformance.All()
+	if err != nil {
+		log.Fatalf("Failed to load transcripts: %v", err)
+	}
+
+	byName := make(map[string]*conformance.Transcript, len(transcripts))
+	for _, t := range transcripts {
+		byName[t.Name] = t
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transcripts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transcripts)
+	})
+	mux.HandleFunc("/ws/{name}", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := byName[r.PathValue("name")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		server := conformance.NewServer(t)
+		server.ServeHTTP(w, r)
+
+		if err := server.Wait(time.Second); err != nil {
+			log.Printf("FAIL %s: %v", t.Name, err)
+			return
+		}
+		log.Printf("PASS %s", t.Name)
+	})
+
+	log.Printf("Serving %d conformance transcripts on %s", len(transcripts), *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
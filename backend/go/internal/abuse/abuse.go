@@ -0,0 +1,197 @@
+// Package abuse scores chats by a fingerprint of their sender and content
+// before they are forwarded to the Python service, and blocks those a
+// Detector judges abusive. In shadow mode decisions are only logged, so
+// that a detector can be tuned against live traffic before it is enforced.
+package abuse
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	// ActionFlag lets the request through but logs it.
+	ActionFlag  Action = "flag"
+	ActionBlock Action = "block"
+)
+
+// Request is a chat to assess.
+type Request struct {
+	IP        string
+	UserID    string
+	TenantID  string
+	SessionID string
+	// Transport is the protocol the chat came in on, e.g. rest or websocket.
+	Transport string
+	Content   string
+}
+
+// Fingerprint describes a chat to a Detector: who sent it, what it looks
+// like, and how fast its sender has been sending.
+type Fingerprint struct {
+	IP        string   `json:"ip,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	TenantID  string   `json:"tenant_id,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
+	Transport string   `json:"transport,omitempty"`
+	Features  Features `json:"features"`
+	Velocity  Velocity `json:"velocity"`
+}
+
+// Velocity counts the sender's chats in the last minute, including this one.
+type Velocity struct {
+	User int `json:"user"`
+	IP   int `json:"ip"`
+	// Repeats counts the user's chats with the same content.
+	Repeats int `json:"repeats"`
+}
+
+// Decision is a Detector's verdict. Score is in [0, 1], higher meaning more
+// likely abusive.
+type Decision struct {
+	Action Action  `json:"action"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// Blocked reports whether the request must not be forwarded.
+func (d Decision) Blocked() bool {
+	return d.Action == ActionBlock
+}
+
+// Detector scores requests.
+type Detector interface {
+	Assess(ctx context.Context, fp *Fingerprint) (Decision, error)
+}
+
+// Chain runs detectors in order. The first block wins; otherwise the
+// decision with the highest score is returned.
+type Chain []Detector
+
+func (c Chain) Assess(ctx context.Context, fp *Fingerprint) (Decision, error) {
+	result := Decision{Action: ActionAllow}
+	for _, d := range c {
+		v, err := d.Assess(ctx, fp)
+		if err != nil {
+			return Decision{}, fmt.Errorf("abuse check failed: %w", err)
+		}
+		if v.Blocked() {
+			return v, nil
+		}
+		if v.Score > result.Score || (v.Action == ActionFlag && result.Action == ActionAllow) {
+			result = v
+		}
+	}
+	return result, nil
+}
+
+// Guard fingerprints requests, tracks their velocity and has a Detector
+// assess them.
+type Guard struct {
+	detector Detector
+	shadow   bool
+	users    *counter
+	ips      *counter
+	repeats  *counter
+	log      *slog.Logger
+}
+
+// Option configures a Guard.
+type Option func(*Guard)
+
+// WithShadow makes the Guard log its decisions without enforcing them.
+func WithShadow(shadow bool) Option {
+	return func(g *Guard) {
+		g.shadow = shadow
+	}
+}
+
+// WithLogger logs decisions to l instead of the default logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(g *Guard) {
+		g.log = l
+	}
+}
+
+func NewGuard(d Detector, opts ...Option) *Guard {
+	g := &Guard{
+		detector: d,
+		users:    newCounter(time.Minute),
+		ips:      newCounter(time.Minute),
+		repeats:  newCounter(time.Minute),
+		log:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Shadow reports whether the Guard only logs its decisions.
+func (g *Guard) Shadow() bool {
+	return g.shadow
+}
+
+// Check assesses req. A flag or block is logged, and the decision returned
+// unless in shadow mode, where requests are always allowed. If the detector
+// fails the request is allowed: abuse detection must not take the service
+// down with it.
+func (g *Guard) Check(ctx context.Context, req *Request) Decision {
+	fp := g.fingerprint(req)
+	d, err := g.detector.Assess(ctx, fp)
+	if err != nil {
+		g.log.WarnContext(ctx, "Abuse detection failed; allowing request", logging.Err(err))
+		return Decision{Action: ActionAllow}
+	}
+	if d.Action == "" {
+		d.Action = ActionAllow
+	}
+
+	metrics.ObserveAbuseDecision(string(d.Action), g.shadow)
+	if d.Action != ActionAllow {
+		g.log.WarnContext(ctx, "Abuse detected",
+			"action", d.Action,
+			"score", d.Score,
+			"reason", d.Reason,
+			"shadow", g.shadow,
+			"transport", fp.Transport,
+			"velocity_user", fp.Velocity.User,
+			"velocity_ip", fp.Velocity.IP,
+			"repeats", fp.Velocity.Repeats)
+	}
+	if g.shadow {
+		return Decision{Action: ActionAllow, Score: d.Score}
+	}
+	return d
+}
+
+// fingerprint builds the fingerprint of req, counting it towards its
+// sender's velocity. Blocked requests count too, so that a sender that
+// keeps trying stays blocked.
+func (g *Guard) fingerprint(req *Request) *Fingerprint {
+	fp := &Fingerprint{
+		IP:        req.IP,
+		UserID:    req.UserID,
+		TenantID:  req.TenantID,
+		SessionID: req.SessionID,
+		Transport: req.Transport,
+		Features:  Extract(req.Content),
+	}
+	now := time.Now()
+	if req.UserID != "" {
+		fp.Velocity.User = g.users.add(req.UserID, now)
+		fp.Velocity.Repeats = g.repeats.add(req.UserID+"\x00"+fp.Features.Digest, now)
+	}
+	if req.IP != "" {
+		fp.Velocity.IP = g.ips.add(req.IP, now)
+	}
+	return fp
+}
@@ -0,0 +1,192 @@
+package abuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticDetector struct {
+	decision Decision
+	err      error
+}
+
+func (s staticDetector) Assess(ctx context.Context, fp *Fingerprint) (Decision, error) {
+	return s.decision, s.err
+}
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestExtract(t *testing.T) {
+	f := Extract("HELLO there\nsee https://a.example and http://b.example!!!!")
+	if f.Lines != 2 || f.URLs != 2 || f.LongestRun != 4 {
+		t.Errorf("Extract() = %+v, want 2 lines, 2 URLs, longest run 4", f)
+	}
+	if f.UppercaseRatio <= 0 || f.UppercaseRatio >= 1 {
+		t.Errorf("UppercaseRatio = %v, want between 0 and 1", f.UppercaseRatio)
+	}
+	if Extract(" Hello ").Digest != Extract("hello").Digest {
+		t.Error("expected the digest to ignore case and surrounding space")
+	}
+}
+
+func TestHeuristic_Assess(t *testing.T) {
+	h := NewHeuristic(Thresholds{UserRate: 10, IPRate: 20, Repeats: 3, URLs: 5})
+
+	tests := []struct {
+		name       string
+		fp         Fingerprint
+		wantAction Action
+		wantReason string
+	}{
+		{"quiet user", Fingerprint{Velocity: Velocity{User: 1, IP: 1, Repeats: 1}}, ActionAllow, ""},
+		{"busy user", Fingerprint{Velocity: Velocity{User: 8}}, ActionFlag, "user_rate"},
+		{"user over rate", Fingerprint{Velocity: Velocity{User: 11}}, ActionBlock, "user_rate"},
+		{"IP over rate", Fingerprint{Velocity: Velocity{IP: 21}}, ActionBlock, "ip_rate"},
+		{"repeated content", Fingerprint{Velocity: Velocity{Repeats: 4}}, ActionBlock, "repeats"},
+		{"many links", Fingerprint{Features: Features{URLs: 6}}, ActionFlag, "urls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := h.Assess(context.Background(), &tt.fp)
+			if err != nil {
+				t.Fatalf("Assess() error = %v", err)
+			}
+			if d.Action != tt.wantAction || d.Reason != tt.wantReason {
+				t.Errorf("Assess() = %+v, want %s for %q", d, tt.wantAction, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestChain_Assess(t *testing.T) {
+	flag := staticDetector{decision: Decision{Action: ActionFlag, Score: 0.6}}
+	block := staticDetector{decision: Decision{Action: ActionBlock, Score: 0.9}}
+	allow := staticDetector{decision: Decision{Action: ActionAllow, Score: 0.1}}
+
+	d, err := Chain{allow, flag, block}.Assess(context.Background(), &Fingerprint{})
+	if err != nil || d.Action != ActionBlock {
+		t.Errorf("Assess() = %+v, %v, want block", d, err)
+	}
+	d, err = Chain{flag, allow}.Assess(context.Background(), &Fingerprint{})
+	if err != nil || d.Action != ActionFlag {
+		t.Errorf("Assess() = %+v, %v, want flag", d, err)
+	}
+	if _, err := (Chain{allow, staticDetector{err: errors.New("down")}}).Assess(context.Background(), &Fingerprint{}); err == nil {
+		t.Error("expected an error from a failing detector")
+	}
+}
+
+func TestGuard_Check(t *testing.T) {
+	g := NewGuard(NewHeuristic(Thresholds{UserRate: 2}), WithLogger(quietLogger()))
+	req := &Request{UserID: "u1", IP: "203.0.113.7", Content: "hi"}
+
+	for i := 0; i < 2; i++ {
+		if d := g.Check(context.Background(), req); d.Blocked() {
+			t.Fatalf("request %d blocked: %+v", i+1, d)
+		}
+	}
+	if d := g.Check(context.Background(), req); !d.Blocked() {
+		t.Errorf("expected the third request in a minute to be blocked, got %+v", d)
+	}
+	if d := g.Check(context.Background(), &Request{UserID: "u2", Content: "hi"}); d.Blocked() {
+		t.Errorf("expected another user not to be blocked, got %+v", d)
+	}
+}
+
+func TestGuard_Shadow(t *testing.T) {
+	g := NewGuard(staticDetector{decision: Decision{Action: ActionBlock, Score: 1}},
+		WithShadow(true), WithLogger(quietLogger()))
+
+	d := g.Check(context.Background(), &Request{UserID: "u1"})
+	if d.Blocked() {
+		t.Errorf("expected shadow mode to allow, got %+v", d)
+	}
+	if d.Score != 1 {
+		t.Errorf("expected the score to be kept, got %v", d.Score)
+	}
+}
+
+func TestGuard_FailOpen(t *testing.T) {
+	g := NewGuard(staticDetector{err: errors.New("down")}, WithLogger(quietLogger()))
+	if d := g.Check(context.Background(), &Request{UserID: "u1"}); d.Action != ActionAllow {
+		t.Errorf("expected a failing detector to allow, got %+v", d)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := newCounter(time.Minute)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		c.add("k", start)
+	}
+	if n := c.add("k", start.Add(30*time.Second)); n != 5 {
+		t.Errorf("count within the window = %d, want 5", n)
+	}
+	// Half way through the next window half of the previous one counts.
+	if n := c.add("k", start.Add(90*time.Second)); n != 3 {
+		t.Errorf("count half a window later = %d, want 3", n)
+	}
+	if n := c.add("k", start.Add(5*time.Minute)); n != 1 {
+		t.Errorf("count after idling = %d, want 1", n)
+	}
+}
+
+func TestWebhook_Assess(t *testing.T) {
+	var got Fingerprint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(Decision{Action: ActionBlock, Score: 0.95, Reason: "known bot"})
+	}))
+	defer srv.Close()
+
+	d, err := NewWebhook(srv.URL, time.Second).Assess(context.Background(), &Fingerprint{
+		UserID:   "u1",
+		Features: Extract("hello"),
+	})
+	if err != nil {
+		t.Fatalf("Assess() error = %v", err)
+	}
+	if !d.Blocked() || d.Reason != "known bot" {
+		t.Errorf("Assess() = %+v, want block for known bot", d)
+	}
+	if got.UserID != "u1" || got.Features.Length != 5 {
+		t.Errorf("webhook received %+v", got)
+	}
+}
+
+func TestWebhook_InvalidResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		payload string
+	}{
+		{"server error", http.StatusInternalServerError, `{}`},
+		{"malformed body", http.StatusOK, `not json`},
+		{"unknown action", http.StatusOK, `{"action": "quarantine"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.payload))
+			}))
+			defer srv.Close()
+
+			if _, err := NewWebhook(srv.URL, time.Second).Assess(context.Background(), &Fingerprint{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
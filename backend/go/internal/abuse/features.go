@@ -0,0 +1,95 @@
+package abuse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Features summarize a chat's content without carrying it, so that
+// fingerprints may be sent to an external service.
+type Features struct {
+	Length int `json:"length"`
+	Lines  int `json:"lines"`
+	URLs   int `json:"urls"`
+	// UppercaseRatio is the share of letters in upper case.
+	UppercaseRatio float64 `json:"uppercase_ratio"`
+	// LongestRun is the length of the longest run of one repeated character.
+	LongestRun int `json:"longest_run"`
+	// Digest identifies the content, ignoring case and surrounding space.
+	Digest string `json:"digest"`
+}
+
+// Extract computes the features of content.
+func Extract(content string) Features {
+	f := Features{
+		Length: len([]rune(content)),
+		URLs:   strings.Count(content, "http://") + strings.Count(content, "https://"),
+	}
+	if content != "" {
+		f.Lines = strings.Count(content, "\n") + 1
+	}
+
+	var letters, upper, run int
+	var last rune
+	for i, r := range content {
+		if i > 0 && r == last {
+			run++
+		} else {
+			run = 1
+		}
+		f.LongestRun = max(f.LongestRun, run)
+		last = r
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters > 0 {
+		f.UppercaseRatio = float64(upper) / float64(letters)
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(content))))
+	f.Digest = hex.EncodeToString(sum[:8])
+	return f
+}
+
+// counter counts events by key over a sliding window, estimated from the
+// counts of the current and previous fixed windows.
+type counter struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	prev  map[string]int
+	cur   map[string]int
+}
+
+func newCounter(window time.Duration) *counter {
+	return &counter{window: window, prev: make(map[string]int), cur: make(map[string]int)}
+}
+
+// add counts an event for key at now and returns the key's events in the
+// window up to now.
+func (c *counter) add(key string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch elapsed := now.Sub(c.start); {
+	case elapsed >= 2*c.window:
+		c.start = now.Truncate(c.window)
+		c.prev, c.cur = make(map[string]int), make(map[string]int)
+	case elapsed >= c.window:
+		c.start = c.start.Add(c.window)
+		c.prev, c.cur = c.cur, make(map[string]int)
+	}
+
+	c.cur[key]++
+	weight := 1 - float64(now.Sub(c.start))/float64(c.window)
+	return c.cur[key] + int(float64(c.prev[key])*weight)
+}
@@ -0,0 +1,75 @@
+package abuse
+
+import (
+	"context"
+	"strings"
+)
+
+// Thresholds are the limits of the Heuristic detector. A zero limit is not
+// checked.
+type Thresholds struct {
+	// UserRate and IPRate are the chats a user or an IP may send a minute.
+	UserRate int
+	IPRate   int
+	// Repeats is how many times a minute a user may send the same content.
+	Repeats int
+	// URLs is how many links a chat may carry.
+	URLs int
+}
+
+// DefaultThresholds suit interactive chat.
+var DefaultThresholds = Thresholds{
+	UserRate: 60,
+	IPRate:   120,
+	Repeats:  5,
+	URLs:     20,
+}
+
+// flagScore and blockScore are the scores from which the Heuristic flags
+// and blocks requests.
+const (
+	flagScore  = 0.5
+	blockScore = 1
+)
+
+// Heuristic scores requests by how close they come to its velocity
+// thresholds: a request exceeding one is blocked, and one past half of one
+// is flagged, as is one with more links than the URL threshold.
+type Heuristic struct {
+	limits Thresholds
+}
+
+func NewHeuristic(limits Thresholds) *Heuristic {
+	return &Heuristic{limits: limits}
+}
+
+func (h *Heuristic) Assess(ctx context.Context, fp *Fingerprint) (Decision, error) {
+	var score float64
+	var reasons []string
+	rate := func(name string, value, limit int) {
+		if limit <= 0 {
+			return
+		}
+		s := float64(value) / float64(limit)
+		if s > flagScore {
+			reasons = append(reasons, name)
+		}
+		score = max(score, s)
+	}
+	rate("user_rate", fp.Velocity.User, h.limits.UserRate)
+	rate("ip_rate", fp.Velocity.IP, h.limits.IPRate)
+	rate("repeats", fp.Velocity.Repeats, h.limits.Repeats)
+	if h.limits.URLs > 0 && fp.Features.URLs > h.limits.URLs {
+		reasons = append(reasons, "urls")
+		score = max(score, flagScore)
+	}
+
+	d := Decision{Action: ActionAllow, Score: min(score, 1), Reason: strings.Join(reasons, ",")}
+	switch {
+	case score > blockScore:
+		d.Action = ActionBlock
+	case score >= flagScore && len(reasons) > 0:
+		d.Action = ActionFlag
+	}
+	return d, nil
+}
@@ -0,0 +1,62 @@
+package abuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook delegates abuse detection to an external service. The Fingerprint
+// is POSTed as JSON and the response body must be a Decision.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *Webhook) Assess(ctx context.Context, fp *Fingerprint) (Decision, error) {
+	body, err := json.Marshal(fp)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("abuse webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("abuse webhook returned status %d", resp.StatusCode)
+	}
+
+	var d Decision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return Decision{}, fmt.Errorf("invalid abuse webhook response: %w", err)
+	}
+
+	switch d.Action {
+	case "":
+		d.Action = ActionAllow
+	case ActionAllow, ActionFlag, ActionBlock:
+	default:
+		return Decision{}, fmt.Errorf("invalid abuse action %q", d.Action)
+	}
+
+	return d, nil
+}
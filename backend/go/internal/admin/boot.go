@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checker is a backend that can verify it is reachable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// BootReport is the machine-readable summary of a started gateway: the
+// runtime description, the resolved configuration and the result of checking
+// each backend that supports it.
+type BootReport struct {
+	Runtime
+	Config map[string]string `json:"config"`
+	Checks []Check           `json:"checks"`
+}
+
+// Check is the outcome of one backend check.
+type Check struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// BootReport checks every backend implementing Checker until ctx is done and
+// returns the report for the current runtime and resolved config.
+func (i *Inventory) BootReport(ctx context.Context, config map[string]string) BootReport {
+	report := BootReport{
+		Runtime: i.Snapshot(),
+		Config:  config,
+		Checks:  []Check{},
+	}
+
+	for _, s := range i.sources {
+		checker, ok := s.(Checker)
+		if !ok {
+			continue
+		}
+
+		start := time.Now()
+		err := checker.Check(ctx)
+		c := Check{
+			Name:       s.Backend().Name,
+			OK:         err == nil,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		report.Checks = append(report.Checks, c)
+	}
+	return report
+}
+
+// Healthy reports whether every backend check passed.
+func (r BootReport) Healthy() bool {
+	for _, c := range r.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteFile writes the report as JSON to path, replacing any previous report
+// atomically so readers never see a partial file.
+func (r BootReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".boot-report-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type checkedBackend struct {
+	name string
+	err  error
+}
+
+func (c checkedBackend) Backend() Backend {
+	return Backend{Name: c.name, Kind: "grpc"}
+}
+
+func (c checkedBackend) Check(ctx context.Context) error {
+	return c.err
+}
+
+func TestInventory_BootReport(t *testing.T) {
+	tests := []struct {
+		name        string
+		checkErr    error
+		wantHealthy bool
+	}{
+		{"all checks pass", nil, true},
+		{"failed check", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory("test")
+			inv.AddListener(Listener{Name: "http", Address: ":8080", Protocol: "http"})
+			inv.SetFeature("moderation", true)
+			inv.AddBackend(checkedBackend{name: "python", err: tt.checkErr})
+			inv.AddStaticBackend(Backend{Name: "upload_store", Kind: "http", Address: "http://uploads"})
+
+			report := inv.BootReport(context.Background(), map[string]string{"Port": "8080"})
+
+			if report.Healthy() != tt.wantHealthy {
+				t.Errorf("expected healthy %v, got %v", tt.wantHealthy, report.Healthy())
+			}
+			if len(report.Checks) != 1 || report.Checks[0].Name != "python" {
+				t.Fatalf("expected only the python backend checked, got %+v", report.Checks)
+			}
+			if tt.checkErr != nil && report.Checks[0].Error != tt.checkErr.Error() {
+				t.Errorf("expected error %q, got %q", tt.checkErr, report.Checks[0].Error)
+			}
+
+			path := filepath.Join(t.TempDir(), "run", "boot-report.json")
+			if err := report.WriteFile(path); err != nil {
+				t.Fatalf("Failed to write report: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read report: %v", err)
+			}
+
+			var decoded map[string]any
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			for _, key := range []string{"environment", "listeners", "features", "backends", "config", "checks"} {
+				if _, ok := decoded[key]; !ok {
+					t.Errorf("expected key %q in report", key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/config"
+)
+
+// maxConfigRevisions bounds the change history kept in memory.
+const maxConfigRevisions = 50
+
+// ConfigRevision records one applied configuration change and what triggered
+// it, such as "startup" or "SIGHUP".
+type ConfigRevision struct {
+	Revision  int             `json:"revision"`
+	AppliedAt time.Time       `json:"applied_at"`
+	Trigger   string          `json:"trigger"`
+	Changes   []config.Change `json:"changes"`
+}
+
+// ConfigLog keeps recent configuration revisions so drift during an incident
+// can be traced.
+type ConfigLog struct {
+	mu        sync.Mutex
+	revisions []ConfigRevision
+	next      int
+}
+
+func NewConfigLog() *ConfigLog {
+	return &ConfigLog{next: 1}
+}
+
+// Record logs and stores the changes applied by trigger. A reload that
+// changed nothing is still recorded so every trigger is accounted for.
+func (l *ConfigLog) Record(trigger string, changes []config.Change) ConfigRevision {
+	if changes == nil {
+		changes = []config.Change{}
+	}
+
+	l.mu.Lock()
+	rev := ConfigRevision{
+		Revision:  l.next,
+		AppliedAt: time.Now().UTC(),
+		Trigger:   trigger,
+		Changes:   changes,
+	}
+	l.next++
+	l.revisions = append(l.revisions, rev)
+	if len(l.revisions) > maxConfigRevisions {
+		l.revisions = l.revisions[len(l.revisions)-maxConfigRevisions:]
+	}
+	l.mu.Unlock()
+
+	slog.Info("Config revision applied", "revision", rev.Revision, "trigger", trigger, "changes", len(changes))
+	for _, c := range changes {
+		slog.Info("Config setting changed", "revision", rev.Revision, "field", c.Field, "old", c.Old, "new", c.New)
+	}
+	return rev
+}
+
+// Revisions returns the retained revisions, oldest first.
+func (l *ConfigLog) Revisions() []ConfigRevision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ConfigRevision{}, l.revisions...)
+}
+
+// Handler serves GET /admin/config/changes.
+func (l *ConfigLog) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Revisions())
+}
@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/config"
+)
+
+func TestConfigLog_Handler(t *testing.T) {
+	l := NewConfigLog()
+	l.Record("startup", nil)
+	l.Record("SIGHUP", []config.Change{{Field: "Port", Old: "8080", New: "9090"}})
+
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{"GET request", http.MethodGet, http.StatusOK},
+		{"POST request", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/config/changes", nil)
+			rr := httptest.NewRecorder()
+
+			l.Handler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var revisions []ConfigRevision
+			if err := json.NewDecoder(rr.Body).Decode(&revisions); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(revisions) != 2 {
+				t.Fatalf("expected 2 revisions, got %d", len(revisions))
+			}
+			if revisions[0].Trigger != "startup" || len(revisions[0].Changes) != 0 {
+				t.Errorf("unexpected first revision %+v", revisions[0])
+			}
+			if revisions[1].Revision != 2 || revisions[1].Changes[0].Field != "Port" {
+				t.Errorf("unexpected second revision %+v", revisions[1])
+			}
+		})
+	}
+}
+
+func TestConfigLog_Bounded(t *testing.T) {
+	l := NewConfigLog()
+	for i := 0; i < maxConfigRevisions+5; i++ {
+		l.Record("test", nil)
+	}
+
+	revisions := l.Revisions()
+	if len(revisions) != maxConfigRevisions {
+		t.Fatalf("expected %d revisions, got %d", maxConfigRevisions, len(revisions))
+	}
+	if revisions[0].Revision != 6 {
+		t.Errorf("expected oldest revision 6, got %d", revisions[0].Revision)
+	}
+}
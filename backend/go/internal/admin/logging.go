@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// Bounds of a debug trace, in seconds.
+const (
+	defaultTraceSeconds = 15 * 60
+	maxTraceSeconds     = 24 * 60 * 60
+)
+
+// LogState is the runtime log level and the debug traces in effect.
+type LogState struct {
+	Level  string          `json:"level"`
+	Traces []logging.Trace `json:"traces"`
+}
+
+// Logging serves the runtime log level and debug traces of levels.
+type Logging struct {
+	levels *logging.Levels
+}
+
+func NewLogging(levels *logging.Levels) *Logging {
+	return &Logging{levels: levels}
+}
+
+// State returns the current level and traces.
+func (l *Logging) State() LogState {
+	traces := l.levels.Traces()
+	if traces == nil {
+		traces = []logging.Trace{}
+	}
+	return LogState{Level: strings.ToLower(l.levels.Level().String()), Traces: traces}
+}
+
+type levelRequest struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves /admin/logging: GET reports the level and traces, and
+// PUT sets the level, until a restart or a config reload changing
+// LOG_LEVEL.
+func (l *Logging) LevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req levelRequest
+		if err := decodeStrict(r, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, "level must be debug, info, warn or error", http.StatusBadRequest)
+			return
+		}
+		l.levels.Set(level)
+		slog.InfoContext(r.Context(), "Log level changed", "level", level.String(), "source", "admin")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.State())
+}
+
+type traceRequest struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	// ExpiresIn is in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// TracesHandler serves /admin/logging/traces: POST logs everything about
+// a user_id or a session_id at debug level for expires_in seconds, 15
+// minutes by default, and DELETE ends every trace.
+func (l *Logging) TracesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req traceRequest
+		if err := decodeStrict(r, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if (req.UserID == "") == (req.SessionID == "") {
+			http.Error(w, "Set one of user_id and session_id", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresIn == 0 {
+			req.ExpiresIn = defaultTraceSeconds
+		}
+		if req.ExpiresIn < 0 || req.ExpiresIn > maxTraceSeconds {
+			http.Error(w, "expires_in must be between 1 and 86400 seconds", http.StatusBadRequest)
+			return
+		}
+		t := logging.Trace{
+			UserID:    req.UserID,
+			SessionID: req.SessionID,
+			ExpiresAt: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second).UTC(),
+		}
+		l.levels.AddTrace(t)
+		slog.InfoContext(r.Context(), "Debug trace started", "trace_user_id", t.UserID, "trace_session_id", t.SessionID, "expires_at", t.ExpiresAt)
+	case http.MethodDelete:
+		l.levels.ClearTraces()
+		slog.InfoContext(r.Context(), "Debug traces cleared")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.State())
+}
+
+// decodeStrict decodes the JSON body of r into v, refusing fields v does
+// not have.
+func decodeStrict(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+func TestLogging_LevelHandler(t *testing.T) {
+	levels := logging.NewLevels(slog.LevelInfo)
+	l := NewLogging(levels)
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedLevel  string
+	}{
+		{"GET request", http.MethodGet, "", http.StatusOK, "info"},
+		{"PUT debug", http.MethodPut, `{"level":"debug"}`, http.StatusOK, "debug"},
+		{"PUT unknown level", http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest, "debug"},
+		{"PUT unknown field", http.MethodPut, `{"lvl":"warn"}`, http.StatusBadRequest, "debug"},
+		{"DELETE request", http.MethodDelete, "", http.StatusMethodNotAllowed, "debug"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/logging", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			l.LevelHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := l.State().Level; got != tt.expectedLevel {
+				t.Errorf("expected level %s, got %s", tt.expectedLevel, got)
+			}
+		})
+	}
+}
+
+func TestLogging_TracesHandler(t *testing.T) {
+	l := NewLogging(logging.NewLevels(slog.LevelInfo))
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedTraces int
+	}{
+		{"POST user", http.MethodPost, `{"user_id":"user-1"}`, http.StatusOK, 1},
+		{"POST session", http.MethodPost, `{"session_id":"s1","expires_in":60}`, http.StatusOK, 2},
+		{"POST same user again", http.MethodPost, `{"user_id":"user-1","expires_in":120}`, http.StatusOK, 2},
+		{"POST neither", http.MethodPost, `{"expires_in":60}`, http.StatusBadRequest, 2},
+		{"POST both", http.MethodPost, `{"user_id":"u","session_id":"s"}`, http.StatusBadRequest, 2},
+		{"POST too long", http.MethodPost, `{"user_id":"u","expires_in":90000}`, http.StatusBadRequest, 2},
+		{"GET request", http.MethodGet, "", http.StatusOK, 2},
+		{"DELETE request", http.MethodDelete, "", http.StatusOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/logging/traces", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			l.TracesHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusOK {
+				var state LogState
+				if err := json.NewDecoder(rr.Body).Decode(&state); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(state.Traces) != tt.expectedTraces {
+					t.Errorf("expected %d traces, got %+v", tt.expectedTraces, state.Traces)
+				}
+			}
+		})
+	}
+}
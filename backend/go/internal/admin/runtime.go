@@ -0,0 +1,153 @@
+// Package admin serves operator-facing endpoints that report on the running
+// gateway.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Runtime describes the running topology in a form deployment tooling can
+// assert against.
+type Runtime struct {
+	Environment string          `json:"environment"`
+	StartedAt   time.Time       `json:"started_at"`
+	Listeners   []Listener      `json:"listeners"`
+	Features    map[string]bool `json:"features"`
+	Routes      []Route         `json:"routes"`
+	Backends    []Backend       `json:"backends"`
+	// Stats holds live counters by subsystem, e.g. open connections.
+	Stats map[string]map[string]int64 `json:"stats,omitempty"`
+}
+
+type Listener struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+}
+
+// Route is a mounted pattern and the middleware wrapping it, outermost first.
+type Route struct {
+	Pattern    string   `json:"pattern"`
+	Middleware []string `json:"middleware"`
+}
+
+type Backend struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Address string `json:"address"`
+	// State is the live connection state, if the backend reports one.
+	State string `json:"state,omitempty"`
+}
+
+// BackendSource reports a backend's current connection state.
+type BackendSource interface {
+	Backend() Backend
+}
+
+// BackendSet is a BackendSource standing for several backends, such as the
+// AI backends a client routes calls to, which are reported one by one.
+type BackendSet interface {
+	BackendSource
+	Backends() []Backend
+}
+
+// StatsSource reports a subsystem's live counters.
+type StatsSource interface {
+	Stats() map[string]int64
+}
+
+// Inventory collects the runtime description while main wires the gateway.
+type Inventory struct {
+	runtime Runtime
+	sources []BackendSource
+	stats   map[string]StatsSource
+}
+
+func NewInventory(environment string) *Inventory {
+	return &Inventory{
+		runtime: Runtime{
+			Environment: environment,
+			StartedAt:   time.Now().UTC(),
+			Features:    make(map[string]bool),
+		},
+	}
+}
+
+func (i *Inventory) AddListener(l Listener) {
+	i.runtime.Listeners = append(i.runtime.Listeners, l)
+}
+
+func (i *Inventory) SetFeature(name string, enabled bool) {
+	i.runtime.Features[name] = enabled
+}
+
+func (i *Inventory) AddRoute(pattern string, middleware ...string) {
+	if middleware == nil {
+		middleware = []string{}
+	}
+	i.runtime.Routes = append(i.runtime.Routes, Route{Pattern: pattern, Middleware: middleware})
+}
+
+// AddBackend registers a backend whose state is read on every report.
+func (i *Inventory) AddBackend(s BackendSource) {
+	i.sources = append(i.sources, s)
+}
+
+// AddStats registers a subsystem whose counters are read on every report.
+func (i *Inventory) AddStats(name string, s StatsSource) {
+	if i.stats == nil {
+		i.stats = make(map[string]StatsSource)
+	}
+	i.stats[name] = s
+}
+
+// AddStaticBackend registers a backend without live state.
+func (i *Inventory) AddStaticBackend(b Backend) {
+	i.sources = append(i.sources, staticBackend(b))
+}
+
+type staticBackend Backend
+
+func (s staticBackend) Backend() Backend {
+	return Backend(s)
+}
+
+// Snapshot returns the current runtime description.
+func (i *Inventory) Snapshot() Runtime {
+	rt := i.runtime
+	rt.Routes = append([]Route(nil), i.runtime.Routes...)
+	sort.Slice(rt.Routes, func(a, b int) bool {
+		return rt.Routes[a].Pattern < rt.Routes[b].Pattern
+	})
+
+	rt.Backends = make([]Backend, 0, len(i.sources))
+	for _, s := range i.sources {
+		if set, ok := s.(BackendSet); ok {
+			rt.Backends = append(rt.Backends, set.Backends()...)
+			continue
+		}
+		rt.Backends = append(rt.Backends, s.Backend())
+	}
+
+	if len(i.stats) > 0 {
+		rt.Stats = make(map[string]map[string]int64, len(i.stats))
+		for name, s := range i.stats {
+			rt.Stats[name] = s.Stats()
+		}
+	}
+	return rt
+}
+
+// RuntimeHandler serves GET /admin/runtime.
+func (i *Inventory) RuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(i.Snapshot())
+}
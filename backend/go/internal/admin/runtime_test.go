@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type liveBackend struct {
+	state string
+}
+
+func (l *liveBackend) Backend() Backend {
+	return Backend{Name: "python", Kind: "grpc", Address: "localhost:50051", State: l.state}
+}
+
+type fixedStats map[string]int64
+
+func (f fixedStats) Stats() map[string]int64 {
+	return f
+}
+
+func TestInventory_RuntimeHandler(t *testing.T) {
+	inv := NewInventory("test")
+	inv.AddListener(Listener{Name: "http", Address: ":8080", Protocol: "http"})
+	inv.SetFeature("moderation", true)
+	inv.AddRoute("/ws")
+	inv.AddRoute("/graphql", "JWTAuth")
+	live := &liveBackend{state: "CONNECTING"}
+	inv.AddBackend(live)
+	inv.AddStaticBackend(Backend{Name: "upload_store", Kind: "http", Address: "http://uploads"})
+	inv.AddStats("websocket", fixedStats{"connections": 3})
+
+	live.state = "READY"
+
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{"GET request", http.MethodGet, http.StatusOK},
+		{"POST request", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/runtime", nil)
+			rec := httptest.NewRecorder()
+
+			inv.RuntimeHandler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var rt Runtime
+			if err := json.NewDecoder(rec.Body).Decode(&rt); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if rt.Environment != "test" {
+				t.Errorf("expected environment test, got %s", rt.Environment)
+			}
+			if len(rt.Listeners) != 1 || rt.Listeners[0].Address != ":8080" {
+				t.Errorf("unexpected listeners %+v", rt.Listeners)
+			}
+			if !rt.Features["moderation"] {
+				t.Error("expected moderation feature to be enabled")
+			}
+			if len(rt.Routes) != 2 || rt.Routes[0].Pattern != "/graphql" || rt.Routes[0].Middleware[0] != "JWTAuth" {
+				t.Errorf("unexpected routes %+v", rt.Routes)
+			}
+			if rt.Routes[1].Middleware == nil {
+				t.Error("expected empty middleware list rather than null")
+			}
+			if len(rt.Backends) != 2 || rt.Backends[0].State != "READY" {
+				t.Errorf("unexpected backends %+v", rt.Backends)
+			}
+			if rt.Stats["websocket"]["connections"] != 3 {
+				t.Errorf("unexpected stats %+v", rt.Stats)
+			}
+		})
+	}
+}
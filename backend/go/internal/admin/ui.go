@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// UIHandler serves the admin web UI under prefix. The page itself holds no
+// data: it asks the operator for the admin token and polls /admin/runtime
+// with it, so it can be served without authentication.
+func UIHandler(prefix string) http.Handler {
+	root, _ := fs.Sub(uiFiles, "ui")
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(root)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+// Polls /admin/runtime with the operator's admin token and renders it.
+(function () {
+  'use strict';
+
+  var pollInterval = 5000;
+  var tokenKey = 'neuronai-admin-token';
+  var timer = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function rows(table, entries) {
+    table.replaceChildren();
+    entries.forEach(function (cells) {
+      var tr = document.createElement('tr');
+      cells.forEach(function (cell) {
+        var td = document.createElement('td');
+        td.textContent = cell.text;
+        if (cell.className) td.className = cell.className;
+        tr.appendChild(td);
+      });
+      table.appendChild(tr);
+    });
+  }
+
+  function render(rt) {
+    var stats = [];
+    Object.keys(rt.stats || {}).sort().forEach(function (name) {
+      var counters = rt.stats[name];
+      Object.keys(counters).sort().forEach(function (key) {
+        stats.push([{ text: name + ' ' + key.replace(/_/g, ' ') }, { text: String(counters[key]) }]);
+      });
+    });
+    rows($('stats'), stats);
+
+    rows($('backends'), (rt.backends || []).map(function (b) {
+      var state = b.state || 'static';
+      var healthy = state === 'READY' || state === 'IDLE' || state === 'static';
+      return [{ text: b.name }, { text: b.kind }, { text: b.address }, { text: state, className: healthy ? 'on' : 'bad' }];
+    }));
+
+    rows($('features'), Object.keys(rt.features || {}).sort().map(function (name) {
+      var on = rt.features[name];
+      return [{ text: name }, { text: on ? 'enabled' : 'disabled', className: on ? 'on' : 'off' }];
+    }));
+
+    rows($('listeners'), (rt.listeners || []).map(function (l) {
+      return [{ text: l.name }, { text: l.protocol }, { text: l.address }];
+    }));
+
+    $('status').textContent = rt.environment + ' · up since ' + new Date(rt.started_at).toLocaleString() +
+      ' · updated ' + new Date().toLocaleTimeString();
+    $('report').hidden = false;
+  }
+
+  function showLogin(message) {
+    clearTimeout(timer);
+    sessionStorage.removeItem(tokenKey);
+    $('status').textContent = message;
+    $('report').hidden = true;
+    $('login').hidden = false;
+  }
+
+  function poll() {
+    var token = sessionStorage.getItem(tokenKey);
+    if (!token) {
+      showLogin('Enter the admin token');
+      return;
+    }
+
+    fetch('../runtime', { headers: { Authorization: 'Bearer ' + token } })
+      .then(function (resp) {
+        if (resp.status === 401) {
+          showLogin('Invalid admin token');
+          return null;
+        }
+        if (!resp.ok) throw new Error('HTTP ' + resp.status);
+        return resp.json();
+      })
+      .then(function (rt) {
+        if (!rt) return;
+        render(rt);
+        timer = setTimeout(poll, pollInterval);
+      })
+      .catch(function (err) {
+        $('status').textContent = 'Gateway unreachable: ' + err.message;
+        timer = setTimeout(poll, pollInterval);
+      });
+  }
+
+  $('login').addEventListener('submit', function (e) {
+    e.preventDefault();
+    sessionStorage.setItem(tokenKey, $('token').value);
+    $('token').value = '';
+    $('login').hidden = true;
+    poll();
+  });
+
+  poll();
+})();
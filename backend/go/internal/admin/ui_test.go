@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUIHandler(t *testing.T) {
+	h := UIHandler("/admin/ui/")
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		wantBody       string
+	}{
+		{"index", http.MethodGet, "/admin/ui/", http.StatusOK, "<title>NeuronAI Gateway</title>"},
+		{"script", http.MethodGet, "/admin/ui/app.js", http.StatusOK, "/admin/runtime"},
+		{"missing file", http.MethodGet, "/admin/ui/nope.js", http.StatusNotFound, ""},
+		{"POST request", http.MethodPost, "/admin/ui/", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("expected body containing %q", tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package admission gates new chats on the Python service's reported load so
+// the gateway backs off before upstream saturation shows up as timeouts.
+package admission
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MetadataDowngrade asks the Python service to serve the request with a
+// cheaper model.
+const MetadataDowngrade = "admission.downgrade"
+
+type Decision int
+
+const (
+	Admit Decision = iota
+	Downgrade
+	Shed
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Admit:
+		return "admit"
+	case Downgrade:
+		return "downgrade"
+	case Shed:
+		return "shed"
+	}
+	return "unknown"
+}
+
+// Mode selects how requests are handled while load is between the soft and
+// hard limits.
+type Mode string
+
+const (
+	ModeQueue     Mode = "queue"
+	ModeDowngrade Mode = "downgrade"
+)
+
+// Signal is a load report from the Python service.
+type Signal struct {
+	QueueDepth int `json:"queue_depth"`
+	Capacity   int `json:"capacity"`
+}
+
+func (s Signal) utilization() float64 {
+	if s.Capacity <= 0 {
+		return 0
+	}
+	return float64(s.QueueDepth) / float64(s.Capacity)
+}
+
+type Options struct {
+	// SoftLimit and HardLimit are utilizations (queue depth / capacity).
+	// Between them Mode applies; at or above HardLimit requests are shed.
+	SoftLimit float64
+	HardLimit float64
+	Mode      Mode
+	// MaxWait bounds how long a queued request waits for load to drop.
+	MaxWait time.Duration
+	// StaleAfter is how long a signal is trusted. Without a fresh signal the
+	// controller admits everything.
+	StaleAfter time.Duration
+}
+
+type Controller struct {
+	opts Options
+
+	mu       sync.Mutex
+	signal   Signal
+	updated  time.Time
+	relieved chan struct{}
+}
+
+func NewController(opts Options) *Controller {
+	return &Controller{
+		opts:     opts,
+		relieved: make(chan struct{}),
+	}
+}
+
+// Update records a new load signal and wakes queued requests.
+func (c *Controller) Update(s Signal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.signal = s
+	c.updated = time.Now()
+	close(c.relieved)
+	c.relieved = make(chan struct{})
+}
+
+// Admit decides whether a new chat may be forwarded, waiting up to MaxWait in
+// queue mode.
+func (c *Controller) Admit(ctx context.Context) Decision {
+	var deadline <-chan time.Time
+	for {
+		utilization, wake := c.current()
+
+		switch {
+		case utilization < c.opts.SoftLimit:
+			return Admit
+		case utilization >= c.opts.HardLimit:
+			return Shed
+		case c.opts.Mode == ModeDowngrade:
+			return Downgrade
+		}
+
+		if deadline == nil {
+			timer := time.NewTimer(c.opts.MaxWait)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		select {
+		case <-wake:
+		case <-deadline:
+			return Shed
+		case <-ctx.Done():
+			return Shed
+		}
+	}
+}
+
+// current returns the utilization to act on and a channel closed on the next
+// update.
+func (c *Controller) current() (float64, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.updated.IsZero() || time.Since(c.updated) > c.opts.StaleAfter {
+		return 0, c.relieved
+	}
+	return c.signal.utilization(), c.relieved
+}
+
+// RetryAfter is the hint given to shed clients.
+func (c *Controller) RetryAfter() time.Duration {
+	if c.opts.MaxWait > time.Second {
+		return c.opts.MaxWait
+	}
+	return time.Second
+}
@@ -0,0 +1,93 @@
+package admission
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestController(mode Mode) *Controller {
+	return NewController(Options{
+		SoftLimit:  0.8,
+		HardLimit:  1.0,
+		Mode:       mode,
+		MaxWait:    50 * time.Millisecond,
+		StaleAfter: time.Minute,
+	})
+}
+
+func TestController_Admit(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   Mode
+		signal *Signal
+		want   Decision
+	}{
+		{"no signal admits", ModeQueue, nil, Admit},
+		{"low load admits", ModeQueue, &Signal{QueueDepth: 2, Capacity: 10}, Admit},
+		{"soft band downgrades", ModeDowngrade, &Signal{QueueDepth: 9, Capacity: 10}, Downgrade},
+		{"soft band queue times out", ModeQueue, &Signal{QueueDepth: 9, Capacity: 10}, Shed},
+		{"hard limit sheds", ModeDowngrade, &Signal{QueueDepth: 12, Capacity: 10}, Shed},
+		{"zero capacity admits", ModeQueue, &Signal{QueueDepth: 5, Capacity: 0}, Admit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(tt.mode)
+			if tt.signal != nil {
+				c.Update(*tt.signal)
+			}
+
+			if got := c.Admit(context.Background()); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestController_QueuedRequestAdmittedWhenLoadDrops(t *testing.T) {
+	c := newTestController(ModeQueue)
+	c.opts.MaxWait = time.Second
+	c.Update(Signal{QueueDepth: 9, Capacity: 10})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.Update(Signal{QueueDepth: 1, Capacity: 10})
+	}()
+
+	if got := c.Admit(context.Background()); got != Admit {
+		t.Errorf("expected %s, got %s", Admit, got)
+	}
+}
+
+func TestController_StaleSignalAdmits(t *testing.T) {
+	c := newTestController(ModeQueue)
+	c.opts.StaleAfter = 10 * time.Millisecond
+	c.Update(Signal{QueueDepth: 20, Capacity: 10})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if got := c.Admit(context.Background()); got != Admit {
+		t.Errorf("expected %s, got %s", Admit, got)
+	}
+}
+
+func TestPoller_Poll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"queue_depth":15,"capacity":10}`))
+	}))
+	defer srv.Close()
+
+	c := newTestController(ModeQueue)
+	p := NewPoller(srv.URL, time.Second, c)
+
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+
+	if got := c.Admit(context.Background()); got != Shed {
+		t.Errorf("expected %s after overload signal, got %s", Shed, got)
+	}
+}
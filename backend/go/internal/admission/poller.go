@@ -0,0 +1,73 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// Poller feeds a Controller from the Python service's load endpoint, which
+// returns a JSON Signal.
+type Poller struct {
+	url        string
+	interval   time.Duration
+	client     *http.Client
+	controller *Controller
+}
+
+func NewPoller(url string, interval time.Duration, controller *Controller) *Poller {
+	return &Poller{
+		url:        url,
+		interval:   interval,
+		client:     &http.Client{Timeout: interval},
+		controller: controller,
+	}
+}
+
+// Run polls until ctx is done.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.poll(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to poll upstream load", logging.Err(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("load endpoint returned status %d", resp.StatusCode)
+	}
+
+	var s Signal
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return fmt.Errorf("invalid load signal: %w", err)
+	}
+
+	p.controller.Update(s)
+	return nil
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/clientip"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/throttle"
+	"github.com/neuronai/backend/go/internal/tokens"
+)
+
+// maxAuthRequestSize bounds token request bodies, which hold only
+// credentials.
+const maxAuthRequestSize = 4 * 1024
+
+// WithTokenIssuer serves /api/v1/auth/token and /api/v1/auth/refresh.
+func WithTokenIssuer(i *tokens.Issuer) Option {
+	return func(h *Handler) {
+		h.tokens = i
+	}
+}
+
+// WithLoginSessions serves /api/v1/auth/session, logging browsers in with a
+// session cookie.
+func WithLoginSessions(s *tokens.LoginSessions) Option {
+	return func(h *Handler) {
+		h.logins = s
+	}
+}
+
+// WithGuests serves /api/v1/auth/guest, issuing guest tokens, and lets the
+// login endpoints upgrade a guest to the user logging in.
+func WithGuests(g *tokens.Guests) Option {
+	return func(h *Handler) {
+		h.guests = g
+	}
+}
+
+// WithWSTickets serves /api/v1/ws/ticket, exchanging access tokens for
+// single-use WebSocket tickets.
+func WithWSTickets(t *tokens.Tickets) Option {
+	return func(h *Handler) {
+		h.tickets = t
+	}
+}
+
+// WithLoginThrottle delays and locks out logins after repeated failures.
+func WithLoginThrottle(t *throttle.Throttle) Option {
+	return func(h *Handler) {
+		h.throttle = t
+	}
+}
+
+// WithAudit records failed logins and lockouts to sink.
+func WithAudit(sink audit.Sink) Option {
+	return func(h *Handler) {
+		h.audit = sink
+	}
+}
+
+type tokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// GuestToken optionally names the guest the user was browsing as, whose
+	// sessions carry over to the user.
+	GuestToken string `json:"guest_token,omitempty"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// IssueToken serves POST /api/v1/auth/token, exchanging a username and
+// password for an access token and a refresh token.
+func (h *Handler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req tokenRequest
+	if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxAuthRequestSize), &req); err != nil || req.Username == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "username and password are required", nil)
+		return
+	}
+	if h.throttled(w, r, req.Username) {
+		return
+	}
+
+	pair, err := h.tokens.Login(req.Username, req.Password)
+	h.recordLogin(r, req.Username, err)
+	if err == nil {
+		pair.UpgradedFrom = h.upgradeGuest(r, req.GuestToken, pair.UserID)
+	}
+	h.writeTokens(w, r, pair, err)
+}
+
+// RefreshToken serves POST /api/v1/auth/refresh, exchanging a refresh token
+// for new tokens. Each refresh token may be used once.
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req refreshRequest
+	if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxAuthRequestSize), &req); err != nil || req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "refresh_token is required", nil)
+		return
+	}
+
+	pair, err := h.tokens.Refresh(req.RefreshToken)
+	if errors.Is(err, tokens.ErrRefreshTokenReused) {
+		h.log.WarnContext(r.Context(), "Refresh token reused; revoked its family", "remote_addr", r.RemoteAddr)
+	}
+	h.writeTokens(w, r, pair, err)
+}
+
+func (h *Handler) writeTokens(w http.ResponseWriter, r *http.Request, pair tokens.Pair, err error) {
+	switch {
+	case errors.Is(err, tokens.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid username or password", nil)
+		return
+	case errors.Is(err, tokens.ErrInvalidRefreshToken), errors.Is(err, tokens.ErrRefreshTokenReused):
+		writeError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Refresh token is invalid, expired or revoked", nil)
+		return
+	case err != nil:
+		h.log.ErrorContext(r.Context(), "Failed to issue tokens", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to issue tokens", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// throttled answers 429 Too Many Requests and reports true if logins to
+// username from the client of r must wait after repeated failures. The
+// password is not checked, so waiting attempts cannot guess it.
+func (h *Handler) throttled(w http.ResponseWriter, r *http.Request, username string) bool {
+	if h.throttle == nil {
+		return false
+	}
+	wait, reason := h.throttle.Check(username, clientip.String(r))
+	if wait == 0 {
+		return false
+	}
+
+	metrics.ObserveLoginThrottled(reason)
+	h.recordAudit(r, audit.TypeLoginFailure, username, "", "throttled: "+reason)
+	retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+	w.Header().Set("Retry-After", retryAfter)
+	writeError(w, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", "Too many failed logins; try again later",
+		map[string]string{"reason": reason, "retry_after": retryAfter})
+	return true
+}
+
+// recordLogin feeds the outcome err of a login to username to the throttle,
+// metrics and audit sink.
+func (h *Handler) recordLogin(r *http.Request, username string, err error) {
+	switch {
+	case err == nil:
+		if h.throttle != nil {
+			h.throttle.Succeed(username)
+		}
+		return
+	case !errors.Is(err, tokens.ErrInvalidCredentials):
+		return
+	}
+
+	metrics.ObserveLoginFailure()
+	h.recordAudit(r, audit.TypeLoginFailure, username, "", "invalid credentials")
+	if h.throttle == nil {
+		return
+	}
+	ip := clientip.String(r)
+	for _, scope := range h.throttle.Fail(username, ip) {
+		metrics.ObserveLockout(scope)
+		h.recordAudit(r, audit.TypeLockout, username, scope, "repeated failed logins")
+		h.log.WarnContext(r.Context(), "Locked out after repeated failed logins", "scope", scope, "username", username, "client_ip", ip)
+	}
+}
+
+func (h *Handler) recordAudit(r *http.Request, typ audit.Type, username, target, reason string) {
+	if h.audit == nil {
+		return
+	}
+	e := audit.RequestPeer(r)
+	e.Time = time.Now()
+	e.Type = typ
+	e.UserID = username
+	e.Target = target
+	e.Reason = reason
+	h.audit.Record(e)
+}
+
+// IssueGuestToken serves POST /api/v1/auth/guest, signing an anonymous
+// caller in as a new guest.
+func (h *Handler) IssueGuestToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := h.guests.Issue()
+	if err != nil {
+		h.log.ErrorContext(r.Context(), "Failed to issue guest token", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to issue guest token", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(token)
+}
+
+type wsTicketRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// wsTicketResponse is the response to a ticket request. URL is relative to
+// the gateway, for the client to complete with its ws:// or wss:// origin.
+type wsTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	URL       string `json:"url"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// IssueWSTicket serves POST /api/v1/ws/ticket, exchanging the caller's
+// access token for a ticket that opens one WebSocket connection to the
+// requested session, so browsers need not put the token in the URL.
+func (h *Handler) IssueWSTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req wsTicketRequest
+	if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxAuthRequestSize), &req); err != nil || req.SessionID == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "session_id is required", nil)
+		return
+	}
+
+	ticket, err := h.tickets.Issue(claims, req.SessionID)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), "Failed to issue WebSocket ticket", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to issue ticket", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(wsTicketResponse{
+		Ticket:    ticket,
+		URL:       "/ws?" + url.Values{"session_id": {req.SessionID}, "ticket": {ticket}}.Encode(),
+		ExpiresIn: int(h.tickets.TTL() / time.Second),
+	})
+}
+
+// upgradeGuest hands the cached sessions of the guest of guestToken to
+// userID and returns the guest's ID, or "" if guestToken is empty or not a
+// live guest token. The conversations themselves are keyed by session ID,
+// so the user carries on by reconnecting to the same sessions.
+func (h *Handler) upgradeGuest(r *http.Request, guestToken, userID string) string {
+	if guestToken == "" || h.guests == nil {
+		return ""
+	}
+	guestID, ok := h.guests.Verify(guestToken)
+	if !ok {
+		return ""
+	}
+	moved := 0
+	if h.responses != nil {
+		moved = h.responses.Transfer(guestID, userID)
+	}
+	h.wsHub.TransferSessions(guestID, userID)
+	h.log.InfoContext(r.Context(), "Upgraded guest", "guest_id", guestID, logging.KeyUserID, userID, "sessions", moved)
+	return guestID
+}
+
+type sessionResponse struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email,omitempty"`
+	// UpgradedFrom is the guest the login upgraded, if any.
+	UpgradedFrom string `json:"upgraded_from,omitempty"`
+}
+
+// Session serves /api/v1/auth/session: POST logs in with a username and
+// password and sets the session cookie, GET reports the cookie's user and
+// DELETE logs out.
+func (h *Handler) Session(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.login(w, r)
+	case http.MethodGet:
+		cookie, err := r.Cookie(middleware.SessionCookie)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "NO_SESSION", "Not logged in", nil)
+			return
+		}
+		claims, ok := h.logins.Resolve(cookie.Value)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "NO_SESSION", "Not logged in", nil)
+			return
+		}
+		writeSession(w, claims, "")
+	case http.MethodDelete:
+		if cookie, err := r.Cookie(middleware.SessionCookie); err == nil {
+			h.logins.Logout(cookie.Value)
+		}
+		h.setSessionCookie(w, "", -1)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxAuthRequestSize), &req); err != nil || req.Username == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "username and password are required", nil)
+		return
+	}
+	if h.throttled(w, r, req.Username) {
+		return
+	}
+
+	id, claims, err := h.logins.Login(req.Username, req.Password)
+	h.recordLogin(r, req.Username, err)
+	switch {
+	case errors.Is(err, tokens.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid username or password", nil)
+		return
+	case err != nil:
+		h.log.ErrorContext(r.Context(), "Failed to start session", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start session", nil)
+		return
+	}
+
+	upgraded := h.upgradeGuest(r, req.GuestToken, claims.UserID)
+	h.setSessionCookie(w, id, int(h.logins.MaxAge()/time.Second))
+	writeSession(w, claims, upgraded)
+}
+
+// setSessionCookie sets the session cookie to id for maxAge seconds, or
+// clears it when maxAge is negative. Scripts cannot read it.
+func (h *Handler) setSessionCookie(w http.ResponseWriter, id string, maxAge int) {
+	sameSite := http.SameSite(h.config.SessionCookieSameSite)
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.config.SessionCookieSecure || sameSite == http.SameSiteNoneMode,
+		SameSite: sameSite,
+	})
+}
+
+func writeSession(w http.ResponseWriter, claims *middleware.Claims, upgradedFrom string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(sessionResponse{UserID: claims.UserID, Email: claims.Email, UpgradedFrom: upgradedFrom})
+}
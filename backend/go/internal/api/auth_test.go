@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/config"
+	"github.com/neuronai/backend/go/internal/grpc"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/session"
+	"github.com/neuronai/backend/go/internal/throttle"
+	"github.com/neuronai/backend/go/internal/tokens"
+	"github.com/neuronai/backend/go/internal/websocket"
+)
+
+func TestHandler_IssueAndRefreshToken(t *testing.T) {
+	users, err := tokens.NewUsers([]tokens.User{{
+		Username:     "alice",
+		PasswordHash: tokens.HashPasswordWith("hunter2", []byte("salt"), 1000),
+	}})
+	if err != nil {
+		t.Fatalf("NewUsers() error = %v", err)
+	}
+	issuer := tokens.NewIssuer("test-secret", users, time.Minute, time.Hour)
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{JWTSecret: "test-secret"}, WithTokenIssuer(issuer))
+
+	post := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	if rec := post(handler.IssueToken, `{"username":"alice","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+	if rec := post(handler.IssueToken, `{"username":"alice"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a password, got %d", rec.Code)
+	}
+
+	rec := post(handler.IssueToken, `{"username":"alice","password":"hunter2"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected token responses not to be cached")
+	}
+	var pair tokens.Pair
+	if err := json.NewDecoder(rec.Body).Decode(&pair); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if claims, err := middleware.ParseToken("test-secret", pair.AccessToken); err != nil || claims.UserID != "alice" {
+		t.Fatalf("ParseToken() = %+v, %v", claims, err)
+	}
+
+	refreshBody := `{"refresh_token":"` + pair.RefreshToken + `"}`
+	if rec := post(handler.RefreshToken, refreshBody); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 on refresh, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(handler.RefreshToken, refreshBody); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 on reuse, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Session(t *testing.T) {
+	users, err := tokens.NewUsers([]tokens.User{{
+		Username:     "alice",
+		PasswordHash: tokens.HashPasswordWith("hunter2", []byte("salt"), 1000),
+	}})
+	if err != nil {
+		t.Fatalf("NewUsers() error = %v", err)
+	}
+	logins := tokens.NewLoginSessions(users, time.Minute, time.Hour)
+	cfg := &config.Config{JWTSecret: "test-secret", SessionCookieSameSite: config.SameSite(http.SameSiteLaxMode), SessionCookieSecure: true}
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), cfg, WithLoginSessions(logins))
+
+	serve := func(method, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/auth/session", strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.Session(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodPost, `{"username":"alice","password":"wrong"}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+
+	rec := serve(http.MethodPost, `{"username":"alice","password":"hunter2"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != middleware.SessionCookie {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+	session := cookies[0]
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode || session.MaxAge != 3600 {
+		t.Errorf("unexpected cookie attributes %+v", session)
+	}
+
+	if rec := serve(http.MethodGet, "", session); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"user_id":"alice"`) {
+		t.Errorf("expected the session's user, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.MethodDelete, "", session)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 on logout, got %d", rec.Code)
+	}
+	if cleared := rec.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("expected the cookie to be cleared, got %v", cleared)
+	}
+	if rec := serve(http.MethodGet, "", session); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after logout, got %d", rec.Code)
+	}
+}
+
+func TestHandler_GuestUpgrade(t *testing.T) {
+	users, err := tokens.NewUsers([]tokens.User{{
+		Username:     "alice",
+		PasswordHash: tokens.HashPasswordWith("hunter2", []byte("salt"), 1000),
+	}})
+	if err != nil {
+		t.Fatalf("NewUsers() error = %v", err)
+	}
+	cache := session.NewResponseCache(5, time.Hour)
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{JWTSecret: "test-secret"},
+		WithTokenIssuer(tokens.NewIssuer("test-secret", users, time.Minute, time.Hour)),
+		WithGuests(tokens.NewGuests("test-secret", time.Hour, "guest")),
+		WithResponseCache(cache))
+
+	rec := httptest.NewRecorder()
+	handler.IssueGuestToken(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/guest", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var guest tokens.GuestToken
+	if err := json.NewDecoder(rec.Body).Decode(&guest); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	cache.Add("s1", guest.GuestID, session.Response{MessageID: "m1"})
+
+	body := `{"username":"alice","password":"hunter2","guest_token":"` + guest.AccessToken + `"}`
+	rec = httptest.NewRecorder()
+	handler.IssueToken(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var pair tokens.Pair
+	if err := json.NewDecoder(rec.Body).Decode(&pair); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if pair.UpgradedFrom != guest.GuestID {
+		t.Errorf("expected upgraded_from %q, got %q", guest.GuestID, pair.UpgradedFrom)
+	}
+	if got := cache.List("s1", "alice"); len(got) != 1 {
+		t.Errorf("expected the guest's session to pass to alice, got %+v", got)
+	}
+
+	// A token that is not a guest's upgrades nothing.
+	body = `{"username":"alice","password":"hunter2","guest_token":"` + pair.AccessToken + `"}`
+	rec = httptest.NewRecorder()
+	handler.IssueToken(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "upgraded_from") {
+		t.Errorf("expected a plain login, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandler_LoginThrottle(t *testing.T) {
+	users, err := tokens.NewUsers([]tokens.User{{
+		Username:     "alice",
+		PasswordHash: tokens.HashPasswordWith("hunter2", []byte("salt"), 1000),
+	}})
+	if err != nil {
+		t.Fatalf("NewUsers() error = %v", err)
+	}
+	recent := audit.NewRecent(10)
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{JWTSecret: "test-secret"},
+		WithTokenIssuer(tokens.NewIssuer("test-secret", users, time.Minute, time.Hour)),
+		WithLoginThrottle(throttle.New(throttle.Policy{LockoutThreshold: 2, Lockout: time.Minute, Window: time.Minute}, throttle.Policy{})),
+		WithAudit(recent),
+	)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		body := `{"username":"alice","password":"` + password + `"}`
+		handler.IssueToken(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", strings.NewReader(body)))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := login("wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for a wrong password, got %d", rec.Code)
+		}
+	}
+	rec := login("hunter2")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected 429 with Retry-After 60 while locked out, got %d %v", rec.Code, rec.Header())
+	}
+	var body struct {
+		Error struct {
+			Code    string            `json:"code"`
+			Details map[string]string `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Error.Code != "TOO_MANY_ATTEMPTS" || body.Error.Details["reason"] != throttle.ReasonLockout {
+		t.Errorf("unexpected error %+v", body.Error)
+	}
+
+	lockouts := recent.Events(audit.Query{Type: audit.TypeLockout})
+	if len(lockouts) != 1 || lockouts[0].UserID != "alice" || lockouts[0].Target != throttle.ScopeAccount {
+		t.Errorf("expected one account lockout audited, got %+v", lockouts)
+	}
+	if failures := recent.Events(audit.Query{Type: audit.TypeLoginFailure}); len(failures) != 3 {
+		t.Errorf("expected 2 failures and 1 throttled attempt audited, got %+v", failures)
+	}
+}
+
+func TestHandler_IssueWSTicket(t *testing.T) {
+	tickets := tokens.NewTickets("test-secret", 30*time.Second)
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{JWTSecret: "test-secret"}, WithWSTickets(tickets))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/ws/ticket", strings.NewReader(body)).WithContext(setupTestContextWithClaims("alice"))
+		rec := httptest.NewRecorder()
+		handler.IssueWSTicket(rec, req)
+		return rec
+	}
+
+	if rec := post(`{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a session_id, got %d", rec.Code)
+	}
+	rec := post(`{"session_id":"s 1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp wsTicketResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ExpiresIn != 30 || !strings.HasPrefix(resp.URL, "/ws?session_id=s+1&ticket=") {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if claims, err := tickets.Redeem(resp.Ticket, "s 1"); err != nil || claims.UserID != "alice" {
+		t.Errorf("Redeem() = %+v, %v", claims, err)
+	}
+}
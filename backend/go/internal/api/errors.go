@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// writeError writes the structured error body documented in docs/api.md.
+func writeError(w http.ResponseWriter, status int, code, message string, details map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: errorDetail{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// writeDecodeError answers a request whose JSON body could not be decoded:
+// 413 when it exceeded the body limit, 400 with the reason otherwise.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		middleware.WriteBodyTooLarge(w, maxErr.Limit)
+		return
+	}
+	http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+}
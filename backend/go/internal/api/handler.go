@@ -2,12 +2,33 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/neuronai/backend/go/internal/abuse"
+	"github.com/neuronai/backend/go/internal/admission"
+	"github.com/neuronai/backend/go/internal/attachment"
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/clientip"
 	"github.com/neuronai/backend/go/internal/config"
 	"github.com/neuronai/backend/go/internal/grpc"
 	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/maintenance"
+	"github.com/neuronai/backend/go/internal/metrics"
 	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/moderation"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"github.com/neuronai/backend/go/internal/quota"
+	"github.com/neuronai/backend/go/internal/redact"
+	"github.com/neuronai/backend/go/internal/scheduler"
+	"github.com/neuronai/backend/go/internal/session"
+	"github.com/neuronai/backend/go/internal/throttle"
+	"github.com/neuronai/backend/go/internal/tokens"
 	"github.com/neuronai/backend/go/internal/websocket"
 )
 
@@ -15,14 +36,109 @@ type Handler struct {
 	pythonClient *grpc.PythonClient
 	wsHub        *websocket.Hub
 	config       *config.Config
+	moderator    moderation.Moderator
+	abuse        *abuse.Guard
+	attachments  attachment.Store
+	sessions     *session.Locker
+	admission    *admission.Controller
+	responses    *session.ResponseCache
+	preauth      *preauth.Gate
+	tokens       *tokens.Issuer
+	logins       *tokens.LoginSessions
+	guests       *tokens.Guests
+	tickets      *tokens.Tickets
+	maintenance  *maintenance.Mode
+	throttle     *throttle.Throttle
+	audit        audit.Sink
+	redact       *redact.Redactor
+	log          *slog.Logger
 }
 
-func NewHandler(pythonClient *grpc.PythonClient, wsHub *websocket.Hub, cfg *config.Config) *Handler {
-	return &Handler{
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithLogger logs to l instead of the default logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(h *Handler) {
+		h.log = l
+	}
+}
+
+// WithRedactor masks personal data and credentials in the error messages
+// returned to callers.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(h *Handler) {
+		h.redact = r
+	}
+}
+
+// WithModerator screens chat content before it is forwarded.
+func WithModerator(m moderation.Moderator) Option {
+	return func(h *Handler) {
+		h.moderator = m
+	}
+}
+
+// WithAbuseGuard blocks chats g judges abusive.
+func WithAbuseGuard(g *abuse.Guard) Option {
+	return func(h *Handler) {
+		h.abuse = g
+	}
+}
+
+// WithAttachmentStore enables attachment references, validated against store.
+func WithAttachmentStore(store attachment.Store) Option {
+	return func(h *Handler) {
+		h.attachments = store
+	}
+}
+
+// WithSessionLocker serializes chat requests within a session.
+func WithSessionLocker(l *session.Locker) Option {
+	return func(h *Handler) {
+		h.sessions = l
+	}
+}
+
+// WithAdmission gates chats on upstream load.
+func WithAdmission(c *admission.Controller) Option {
+	return func(h *Handler) {
+		h.admission = c
+	}
+}
+
+// WithMaintenance reports the maintenance state of m on /health.
+func WithMaintenance(m *maintenance.Mode) Option {
+	return func(h *Handler) {
+		h.maintenance = m
+	}
+}
+
+// WithResponseCache keeps recent responses per session for regenerate/undo.
+func WithResponseCache(c *session.ResponseCache) Option {
+	return func(h *Handler) {
+		h.responses = c
+	}
+}
+
+// WithPreauth requires expensive chats to be authorized by the billing service.
+func WithPreauth(g *preauth.Gate) Option {
+	return func(h *Handler) {
+		h.preauth = g
+	}
+}
+
+func NewHandler(pythonClient *grpc.PythonClient, wsHub *websocket.Hub, cfg *config.Config, opts ...Option) *Handler {
+	h := &Handler{
 		pythonClient: pythonClient,
 		wsHub:        wsHub,
 		config:       cfg,
+		log:          slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -31,10 +147,21 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := map[string]string{
+	response := map[string]any{
 		"status":  "healthy",
 		"service": "gateway",
 	}
+	// The gateway is alive and serving reads during maintenance, so it
+	// stays 200: a load balancer should not pull every instance at once.
+	if h.maintenance != nil {
+		if s := h.maintenance.State(); s.Enabled {
+			response["status"] = "maintenance"
+			if s.ReadOnly {
+				response["status"] = "degraded"
+			}
+			response["maintenance"] = s
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -53,26 +180,74 @@ func (h *Handler) Chat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := middleware.DecodeJSON(r.Body, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		http.Error(w, h.redact.Error(err), http.StatusBadRequest)
 		return
 	}
 
 	req.UserID = claims.UserID
 
+	if !h.screen(w, r, claims, &req, metrics.TransportREST) {
+		return
+	}
+
+	if !h.moderate(w, r, &req) {
+		return
+	}
+
+	attachments, ok := h.resolveAttachments(w, r, &req)
+	if !ok {
+		return
+	}
+
+	if !h.preauthorize(w, r, &req) {
+		return
+	}
+
+	if !h.admit(w, r, &req) {
+		return
+	}
+
 	grpcReq := &grpc.ChatRequest{
 		SessionID:   req.SessionID,
 		UserID:      req.UserID,
 		Content:     req.Content,
 		MessageType: req.MessageType,
 		Metadata:    req.Metadata,
+		Attachments: attachments,
+		Messages:    req.Messages,
+		Params:      req.GenerationParams,
+	}
+
+	if h.sessions != nil {
+		release, err := h.sessions.Acquire(r.Context(), req.SessionID, nil)
+		if err != nil {
+			return
+		}
+		defer release()
 	}
 
+	start := time.Now()
 	resp, err := h.pythonClient.ProcessChat(r.Context(), grpcReq)
+	metrics.ObserveChat(metrics.TransportREST, err, start, metrics.TraceID(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeChatError(w, err)
 		return
 	}
+	quota.AddTokens(r.Context(), quota.EstimateTokens(req.Content)+quota.EstimateTokens(resp.Content))
+
+	if h.responses != nil {
+		h.responses.Add(req.SessionID, req.UserID, session.Response{
+			MessageID: resp.MessageID,
+			Content:   resp.Content,
+			AgentType: resp.AgentType,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -91,68 +266,361 @@ func (h *Handler) StreamChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := middleware.DecodeJSON(r.Body, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		http.Error(w, h.redact.Error(err), http.StatusBadRequest)
 		return
 	}
 
 	req.UserID = claims.UserID
 
+	if !h.screen(w, r, claims, &req, metrics.TransportSSE) {
+		return
+	}
+
+	if !h.moderate(w, r, &req) {
+		return
+	}
+
+	attachments, ok := h.resolveAttachments(w, r, &req)
+	if !ok {
+		return
+	}
+
+	if !h.admit(w, r, &req) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	middleware.StreamDeadline(w, h.config.HTTPStreamTimeout)
 
 	pbReq := &pb.ChatRequest{
-		SessionId: req.SessionID,
-		UserId:    req.UserID,
-		Content:   req.Content,
-		Metadata:  req.Metadata,
-	}
-
-	if req.MessageType != "" {
-		switch req.MessageType {
-		case "text":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_TEXT
-		case "image":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_IMAGE
-		case "video":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_VIDEO
-		case "code":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_CODE
+		SessionId:   req.SessionID,
+		UserId:      req.UserID,
+		Content:     req.Content,
+		Attachments: attachments,
+		MessageType: grpc.ParseMessageType(req.MessageType),
+		Metadata:    req.Messages.ApplyTo(req.ApplyTo(req.Metadata)),
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if h.preauth != nil {
+		if pr := preauth.ForChat(req.UserID, req.SessionID, pbReq.MessageType); pr != nil {
+			d, err := h.preauth.Check(r.Context(), pr, func(d preauth.Decision) {
+				writeEvent(w, flusher, "preauth", d)
+			})
+			if err != nil {
+				writeEvent(w, flusher, "error", errorDetail{
+					Code:    "PREAUTH_UNAVAILABLE",
+					Message: "Pre-authorization unavailable",
+				})
+				return
+			}
+			if d.Action == preauth.ActionReject {
+				return
+			}
 		}
 	}
 
+	if h.sessions != nil {
+		release, err := h.sessions.Acquire(r.Context(), req.SessionID, func(ahead int) {
+			writeEvent(w, flusher, "queued", queuedEvent{SessionID: req.SessionID, Ahead: ahead})
+		})
+		if err != nil {
+			return
+		}
+		defer release()
+	}
+
+	start := time.Now()
 	stream, err := h.pythonClient.ProcessStream(r.Context(), pbReq)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		metrics.ObserveChat(metrics.TransportSSE, err, start, metrics.TraceID(r))
+		h.writeChatError(w, err)
 		return
 	}
 	defer stream.Close()
+	quota.AddTokens(r.Context(), quota.EstimateTokens(req.Content))
 
-	flusher, ok := w.(http.Flusher)
+	var built session.Builder
+	for {
+		resp, err := stream.RecvResponse()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			metrics.ObserveChat(metrics.TransportSSE, err, start, metrics.TraceID(r))
+			return
+		}
+
+		switch payload := resp.Payload.(type) {
+		case *pb.StreamResponse_Chat:
+			writeEvent(w, flusher, "", payload.Chat)
+			chat := payload.Chat
+			quota.AddTokens(r.Context(), quota.EstimateTokens(chat.Content))
+			if r, ok := built.Append(chat.MessageId, chat.Content, chat.AgentType.String(), chat.IsFinal); ok && h.responses != nil {
+				h.responses.Add(req.SessionID, req.UserID, r)
+			}
+		case *pb.StreamResponse_AudioData:
+			writeArtifact(w, flusher, "audio", "application/octet-stream", payload.AudioData)
+		}
+	}
+}
+
+// SessionResponses serves GET /api/v1/sessions/{id}/responses, the cached
+// recent responses of one of the caller's sessions.
+func (h *Handler) SessionResponses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := middleware.GetClaims(r.Context())
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	for {
-		msg, err := stream.Recv()
-		if err != nil {
-			return
+	if h.responses == nil {
+		writeError(w, http.StatusNotFound, "RESPONSE_CACHE_DISABLED", "Response cache is not enabled", nil)
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	responses := h.responses.List(sessionID, claims.UserID)
+	if responses == nil {
+		responses = []session.Response{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponses{SessionID: sessionID, Responses: responses})
+}
+
+type sessionResponses struct {
+	SessionID string             `json:"session_id"`
+	Responses []session.Response `json:"responses"`
+}
+
+// maxNotificationSize bounds notification payloads, which are fanned out to
+// every connection of the user.
+const maxNotificationSize = 64 * 1024
+
+// NotifyUser serves POST /internal/v1/users/{id}/notifications, letting other
+// services push a JSON object to every WebSocket connection of a user.
+func (h *Handler) NotifyUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload map[string]json.RawMessage
+	if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxNotificationSize), &payload); err != nil || payload == nil {
+		writeError(w, http.StatusBadRequest, "INVALID_NOTIFICATION", "Notification must be a JSON object", nil)
+		return
+	}
+	data, _ := json.Marshal(payload)
+
+	delivered := h.wsHub.NotifyUser(r.PathValue("id"), data)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(notifyResponse{Delivered: delivered})
+}
+
+// notifyResponse reports how many of the user's connections on this instance
+// received a notification. Connections on other instances are reached
+// through the backplane and not counted.
+type notifyResponse struct {
+	Delivered int `json:"delivered"`
+}
+
+// screen has the abuse guard assess req. It writes the error response and
+// returns false when the request is blocked.
+func (h *Handler) screen(w http.ResponseWriter, r *http.Request, claims *middleware.Claims, req *ChatRequest, transport string) bool {
+	if h.abuse == nil {
+		return true
+	}
+
+	d := h.abuse.Check(r.Context(), &abuse.Request{
+		IP:        clientip.String(r),
+		UserID:    claims.UserID,
+		TenantID:  claims.TenantID,
+		SessionID: req.SessionID,
+		Transport: transport,
+		Content:   req.screenText(),
+	})
+	if d.Blocked() {
+		writeError(w, http.StatusForbidden, "REQUEST_BLOCKED", "Request blocked by abuse detection", nil)
+		return false
+	}
+	return true
+}
+
+// moderate screens req and records the verdict in its metadata. It writes the
+// error response and returns false when the request must not be forwarded.
+func (h *Handler) moderate(w http.ResponseWriter, r *http.Request, req *ChatRequest) bool {
+	if h.moderator == nil {
+		return true
+	}
+
+	verdict, err := h.moderator.Check(r.Context(), &moderation.Request{
+		UserID:    req.UserID,
+		SessionID: req.SessionID,
+		Content:   req.screenText(),
+	})
+	if err != nil {
+		http.Error(w, "Content moderation unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+
+	if verdict.Rejected() {
+		writeError(w, http.StatusUnprocessableEntity, "CONTENT_REJECTED", "Request rejected by content moderation",
+			map[string]string{"category": verdict.Category})
+		return false
+	}
+
+	req.Metadata = verdict.Annotate(req.Metadata)
+	return true
+}
+
+// resolveAttachments validates the request's attachment references. It writes
+// the error response and returns false when any reference is unusable.
+func (h *Handler) resolveAttachments(w http.ResponseWriter, r *http.Request, req *ChatRequest) ([]*pb.Attachment, bool) {
+	attachments, err := attachment.Resolve(r.Context(), h.attachments, req.UserID, req.Attachments)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, attachment.ErrForbidden) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, h.redact.Error(err), status)
+		return nil, false
+	}
+	return attachments, true
+}
+
+// preauthorize asks the billing service to authorize an expensive request,
+// waiting out holds. It writes the error response and returns false when the
+// request is rejected.
+func (h *Handler) preauthorize(w http.ResponseWriter, r *http.Request, req *ChatRequest) bool {
+	if h.preauth == nil {
+		return true
+	}
+	pr := preauth.ForChat(req.UserID, req.SessionID, grpc.ParseMessageType(req.MessageType))
+	if pr == nil {
+		return true
+	}
+
+	d, err := h.preauth.Check(r.Context(), pr, nil)
+	if err != nil {
+		http.Error(w, "Pre-authorization unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+
+	if d.Action == preauth.ActionReject {
+		writeError(w, http.StatusPaymentRequired, "PREAUTH_REJECTED", "Request rejected by pre-authorization",
+			map[string]string{"reason": d.Reason})
+		return false
+	}
+	return true
+}
+
+// admit applies upstream admission control. It writes the error response and
+// returns false when the request is shed.
+func (h *Handler) admit(w http.ResponseWriter, r *http.Request, req *ChatRequest) bool {
+	if h.admission == nil {
+		return true
+	}
+
+	switch h.admission.Admit(r.Context()) {
+	case admission.Shed:
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.admission.RetryAfter().Seconds())))
+		writeError(w, http.StatusServiceUnavailable, "OVERLOADED", "AI service is at capacity, retry later", nil)
+		return false
+	case admission.Downgrade:
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]string)
 		}
+		req.Metadata[admission.MetadataDowngrade] = "true"
+	}
+	return true
+}
 
-		data, _ := json.Marshal(msg)
-		w.Write([]byte("data: "))
-		w.Write(data)
-		w.Write([]byte("\n\n"))
-		flusher.Flush()
+// writeChatError reports a chat the Python client failed: 503 if the
+// scheduler found no slot for it in time or too many streams are open, 429
+// if its user has too many chats in flight, 500 otherwise.
+func (h *Handler) writeChatError(w http.ResponseWriter, err error) {
+	if errors.Is(err, grpc.ErrUserLimit) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "Too many chats in flight; wait for one to finish", nil)
+		return
+	}
+	if errors.Is(err, scheduler.ErrSaturated) || errors.Is(err, grpc.ErrStreamLimit) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "OVERLOADED", "AI service is at capacity, retry later", nil)
+		return
 	}
+	http.Error(w, h.redact.Error(err), http.StatusInternalServerError)
+}
+
+// queuedEvent tells a sender its message is waiting behind another send in the
+// same session.
+type queuedEvent struct {
+	SessionID string `json:"session_id"`
+	Ahead     int    `json:"ahead"`
 }
 
 type ChatRequest struct {
-	SessionID   string            `json:"session_id"`
-	UserID      string            `json:"user_id"`
-	Content     string            `json:"content"`
-	MessageType string            `json:"message_type"`
-	Metadata    map[string]string `json:"metadata"`
+	SessionID   string                 `json:"session_id"`
+	UserID      string                 `json:"user_id"`
+	Content     string                 `json:"content"`
+	MessageType string                 `json:"message_type"`
+	Metadata    map[string]string      `json:"metadata"`
+	Attachments []attachment.Reference `json:"attachments,omitempty"`
+	Messages    grpc.Conversation      `json:"messages,omitempty"`
+	grpc.GenerationParams
+}
+
+// validate checks the request and, when the client sent a conversation,
+// derives Content from its final message. Requests without a message type
+// that carry audio are voice notes.
+func (r *ChatRequest) validate() error {
+	if err := grpc.ValidateMetadata(r.Metadata); err != nil {
+		return err
+	}
+	if err := r.GenerationParams.Validate(); err != nil {
+		return err
+	}
+	if err := r.Messages.Validate(); err != nil {
+		return err
+	}
+	if len(r.Messages) > 0 {
+		if r.Content != "" {
+			return fmt.Errorf("content and messages are mutually exclusive")
+		}
+		r.Content = r.Messages.Prompt()
+	}
+	if r.MessageType == "" && attachment.HasKind(r.Attachments, attachment.KindAudio) {
+		r.MessageType = "audio"
+	}
+	return nil
+}
+
+// screenText is the text moderation and abuse detection check: every turn of
+// a client-supplied conversation, not only the final one that became Content.
+func (r *ChatRequest) screenText() string {
+	if len(r.Messages) > 0 {
+		return r.Messages.Text()
+	}
+	return r.Content
 }
@@ -4,15 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/neuronai/backend/go/internal/abuse"
 	"github.com/neuronai/backend/go/internal/config"
 	"github.com/neuronai/backend/go/internal/grpc"
 	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/maintenance"
 	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/moderation"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"github.com/neuronai/backend/go/internal/session"
 	"github.com/neuronai/backend/go/internal/websocket"
 	googlegrpc "google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -161,6 +170,39 @@ func TestHandler_HealthCheck_ResponseFormat(t *testing.T) {
 	}
 }
 
+func TestHandler_HealthCheck_Maintenance(t *testing.T) {
+	m := maintenance.New(time.Minute)
+	handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{}, WithMaintenance(m))
+	m.Enable(maintenance.SourceAdmin, "Back soon", 0)
+
+	rec := httptest.NewRecorder()
+	handler.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 during maintenance, got %d", rec.Code)
+	}
+	var body struct {
+		Status      string            `json:"status"`
+		Maintenance maintenance.State `json:"maintenance"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "maintenance" || body.Maintenance.Message != "Back soon" {
+		t.Errorf("unexpected health %+v", body)
+	}
+
+	m.EnableReadOnly(maintenance.SourceAdmin, "", 0)
+	rec = httptest.NewRecorder()
+	handler.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || body.Status != "degraded" || !body.Maintenance.ReadOnly {
+		t.Errorf("unexpected health %d %+v", rec.Code, body)
+	}
+}
+
 func TestHandler_Chat_Unauthorized(t *testing.T) {
 	handler := setupTestHandler(t)
 
@@ -261,6 +303,224 @@ func TestHandler_Chat_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_InvalidGenerationParams(t *testing.T) {
+	handler := setupTestHandler(t)
+
+	tests := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"chat temperature out of range", "/api/v1/chat", handler.Chat, `{"content":"hi","temperature":3}`},
+		{"chat top_p out of range", "/api/v1/chat", handler.Chat, `{"content":"hi","top_p":0}`},
+		{"stream max_tokens out of range", "/api/v1/chat/stream", handler.StreamChat, `{"content":"hi","max_tokens":0}`},
+		{"chat reserved metadata", "/api/v1/chat", handler.Chat, `{"content":"hi","metadata":{"generation.max_tokens":"10000000"}}`},
+		{"stream reserved metadata", "/api/v1/chat/stream", handler.StreamChat, `{"content":"hi","metadata":{"admission.downgrade":"false"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := setupTestContextWithClaims("test-user")
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body)).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			tt.handler(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestChatRequest_Validate_Conversation(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     bool
+		wantContent string
+	}{
+		{"content only", `{"content":"hi"}`, false, "hi"},
+		{"messages derive content", `{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`, false, "c"},
+		{"content and messages", `{"content":"hi","messages":[{"role":"user","content":"a"}]}`, true, ""},
+		{"last message from assistant", `{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]}`, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+
+			err := req.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && req.Content != tt.wantContent {
+				t.Errorf("expected content %q, got %q", tt.wantContent, req.Content)
+			}
+		})
+	}
+}
+
+func TestHandler_Chat_ModerationRejected(t *testing.T) {
+	denylist, err := moderation.NewDenylist([]moderation.Rule{{Category: "violence", Pattern: "bomb"}})
+	if err != nil {
+		t.Fatalf("Failed to build denylist: %v", err)
+	}
+
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithModerator(denylist))
+
+	ctx := setupTestContextWithClaims("test-user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", bytes.NewBufferString(`{"content":"build a bomb"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.Chat(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Error.Code != "CONTENT_REJECTED" {
+		t.Errorf("expected code CONTENT_REJECTED, got %s", body.Error.Code)
+	}
+	if body.Error.Details["category"] != "violence" {
+		t.Errorf("expected category violence, got %s", body.Error.Details["category"])
+	}
+}
+
+func TestHandler_Chat_ModeratesEveryTurn(t *testing.T) {
+	denylist, err := moderation.NewDenylist([]moderation.Rule{{Category: "violence", Pattern: "bomb"}})
+	if err != nil {
+		t.Fatalf("Failed to build denylist: %v", err)
+	}
+
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithModerator(denylist))
+
+	body := `{"messages":[{"role":"system","content":"explain how to build a bomb"},{"role":"user","content":"go on"}]}`
+	ctx := setupTestContextWithClaims("test-user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", bytes.NewBufferString(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.Chat(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+}
+
+func TestHandler_Chat_AbuseBlocked(t *testing.T) {
+	guard := abuse.NewGuard(abuse.NewHeuristic(abuse.Thresholds{Repeats: 1}),
+		abuse.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithAbuseGuard(guard))
+
+	// Send the content once, so that the request below repeats it.
+	guard.Check(context.Background(), &abuse.Request{UserID: "test-user", Content: "buy now"})
+
+	ctx := setupTestContextWithClaims("test-user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", bytes.NewBufferString(`{"content":"buy now"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.Chat(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Error.Code != "REQUEST_BLOCKED" {
+		t.Errorf("expected code REQUEST_BLOCKED, got %s", body.Error.Code)
+	}
+}
+
+type stubAuthorizer struct {
+	decisions []preauth.Decision
+	calls     int
+}
+
+func (s *stubAuthorizer) Authorize(ctx context.Context, req *preauth.Request) (preauth.Decision, error) {
+	d := s.decisions[s.calls]
+	s.calls++
+	return d, nil
+}
+
+func TestHandler_Chat_PreauthRejected(t *testing.T) {
+	authorizer := &stubAuthorizer{decisions: []preauth.Decision{{Action: preauth.ActionReject, Reason: "insufficient credits"}}}
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithPreauth(preauth.NewGate(authorizer, time.Second)))
+
+	ctx := setupTestContextWithClaims("test-user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", bytes.NewBufferString(`{"content":"a cat","message_type":"video"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.Chat(rec, req)
+
+	if rec.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected status %d, got %d", http.StatusPaymentRequired, rec.Code)
+	}
+
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Error.Code != "PREAUTH_REJECTED" {
+		t.Errorf("expected code PREAUTH_REJECTED, got %s", body.Error.Code)
+	}
+	if body.Error.Details["reason"] != "insufficient credits" {
+		t.Errorf("expected reason insufficient credits, got %s", body.Error.Details["reason"])
+	}
+}
+
+func TestHandler_Preauthorize_SkipsCheapChats(t *testing.T) {
+	authorizer := &stubAuthorizer{}
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithPreauth(preauth.NewGate(authorizer, time.Second)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	rec := httptest.NewRecorder()
+
+	if !handler.preauthorize(rec, req, &ChatRequest{Content: "hello", MessageType: "text"}) {
+		t.Fatal("expected text chat to pass pre-authorization")
+	}
+	if authorizer.calls != 0 {
+		t.Errorf("expected no authorizer calls, got %d", authorizer.calls)
+	}
+}
+
+func TestHandler_StreamChat_PreauthEvents(t *testing.T) {
+	authorizer := &stubAuthorizer{decisions: []preauth.Decision{
+		{Action: preauth.ActionHold, Reason: "checking balance", RetryAfter: 1},
+		{Action: preauth.ActionReject, Reason: "insufficient credits"},
+	}}
+	wsHub := websocket.NewHub(nil)
+	handler := NewHandler(&grpc.PythonClient{}, wsHub, &config.Config{}, WithPreauth(preauth.NewGate(authorizer, 5*time.Second)))
+
+	ctx := setupTestContextWithClaims("test-user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat/stream", bytes.NewBufferString(`{"content":"a cat","message_type":"video"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	handler.StreamChat(rec, req)
+
+	body := rec.Body.String()
+	want := "event: preauth\ndata: {\"action\":\"hold\",\"reason\":\"checking balance\",\"retry_after\":1}\n\n" +
+		"event: preauth\ndata: {\"action\":\"reject\",\"reason\":\"insufficient credits\"}\n\n"
+	if body != want {
+		t.Errorf("unexpected stream:\n%s", body)
+	}
+}
+
 func TestHandler_StreamChat_Unauthorized(t *testing.T) {
 	handler := setupTestHandler(t)
 
@@ -369,35 +629,116 @@ func TestNewHandler(t *testing.T) {
 	}
 }
 
-func TestMessageTypeConversion(t *testing.T) {
+func TestHandler_SessionResponses(t *testing.T) {
+	cache := session.NewResponseCache(5, time.Minute)
+	cache.Add("session-123", "test-user", session.Response{MessageID: "m1", Content: "first"})
+	cache.Add("session-123", "test-user", session.Response{MessageID: "m2", Content: "second"})
+
 	tests := []struct {
-		name     string
-		msgType  string
-		expected pb.MessageType
+		name           string
+		method         string
+		user           string
+		cache          *session.ResponseCache
+		expectedStatus int
+		expectedCount  int
 	}{
-		{"text", "text", pb.MessageType_MESSAGE_TYPE_TEXT},
-		{"image", "image", pb.MessageType_MESSAGE_TYPE_IMAGE},
-		{"video", "video", pb.MessageType_MESSAGE_TYPE_VIDEO},
-		{"code", "code", pb.MessageType_MESSAGE_TYPE_CODE},
+		{"owner", http.MethodGet, "test-user", cache, http.StatusOK, 2},
+		{"other user", http.MethodGet, "other-user", cache, http.StatusOK, 0},
+		{"unauthorized", http.MethodGet, "", cache, http.StatusUnauthorized, 0},
+		{"invalid method", http.MethodPost, "test-user", cache, http.StatusMethodNotAllowed, 0},
+		{"cache disabled", http.MethodGet, "test-user", nil, http.StatusNotFound, 0},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var converted pb.MessageType
-			switch tt.msgType {
-			case "text":
-				converted = pb.MessageType_MESSAGE_TYPE_TEXT
-			case "image":
-				converted = pb.MessageType_MESSAGE_TYPE_IMAGE
-			case "video":
-				converted = pb.MessageType_MESSAGE_TYPE_VIDEO
-			case "code":
-				converted = pb.MessageType_MESSAGE_TYPE_CODE
+			var opts []Option
+			if tt.cache != nil {
+				opts = append(opts, WithResponseCache(tt.cache))
+			}
+			handler := NewHandler(&grpc.PythonClient{}, websocket.NewHub(nil), &config.Config{}, opts...)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v1/sessions/{id}/responses", handler.SessionResponses)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/sessions/session-123/responses", nil)
+			if tt.user != "" {
+				req = req.WithContext(setupTestContextWithClaims(tt.user))
 			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
 
-			if converted != tt.expected {
-				t.Errorf("expected %v, got %v", tt.expected, converted)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var body sessionResponses
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body.SessionID != "session-123" {
+				t.Errorf("expected session_id session-123, got %s", body.SessionID)
+			}
+			if len(body.Responses) != tt.expectedCount {
+				t.Errorf("expected %d responses, got %d", tt.expectedCount, len(body.Responses))
 			}
 		})
 	}
 }
+
+func TestHandler_NotifyUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{"object", http.MethodPost, `{"type":"task_finished","task_id":"t1"}`, http.StatusAccepted},
+		{"not an object", http.MethodPost, `["task_finished"]`, http.StatusBadRequest},
+		{"null", http.MethodPost, `null`, http.StatusBadRequest},
+		{"invalid method", http.MethodGet, "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := setupTestHandler(t)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/internal/v1/users/{id}/notifications", handler.NotifyUser)
+
+			req := httptest.NewRequest(tt.method, "/internal/v1/users/test-user/notifications", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code == http.StatusAccepted && !strings.Contains(rec.Body.String(), `"delivered":0`) {
+				t.Errorf("expected no deliveries without connections, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_Chat_BodyTooLarge(t *testing.T) {
+	handler := setupTestHandler(t)
+	limited := middleware.BodyLimit(32)(http.HandlerFunc(handler.Chat))
+
+	body := strings.NewReader(`{"session_id":"s1","content":"` + strings.Repeat("a", 64) + `"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", body).WithContext(setupTestContextWithClaims("user-1"))
+	// Unknown length, so the limit is hit while decoding.
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), middleware.CodeRequestTooLarge) {
+		t.Errorf("expected a %s error, got %s", middleware.CodeRequestTooLarge, rec.Body)
+	}
+}
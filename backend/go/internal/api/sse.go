@@ -0,0 +1,85 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// artifactChunkSize is the raw byte count per artifact event, keeping each
+	// base64 data line comfortably below proxy line-length limits.
+	artifactChunkSize = 16 * 1024
+	// maxArtifactSize bounds inline artifacts; SSE is meant for small outputs
+	// such as charts and audio snippets.
+	maxArtifactSize = 4 * 1024 * 1024
+)
+
+// writeEvent writes one SSE event. An empty name produces an unnamed
+// ("message") event.
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, name string, v interface{}) {
+	data, _ := json.Marshal(v)
+	if name != "" {
+		w.Write([]byte("event: " + name + "\n"))
+	}
+	w.Write([]byte("data: "))
+	w.Write(data)
+	w.Write([]byte("\n\n"))
+	flusher.Flush()
+}
+
+// artifactChunk is one piece of a binary artifact. Clients concatenate the
+// decoded Data of chunks 0..Total-1 sharing an ArtifactID and may verify the
+// result against SHA256.
+type artifactChunk struct {
+	ArtifactID string `json:"artifact_id"`
+	Kind       string `json:"kind"`
+	MimeType   string `json:"mime_type"`
+	Index      int    `json:"index"`
+	Total      int    `json:"total"`
+	Size       int    `json:"size"`
+	SHA256     string `json:"sha256"`
+	Data       string `json:"data"`
+}
+
+// writeArtifact streams data as a series of "artifact" events.
+func writeArtifact(w http.ResponseWriter, flusher http.Flusher, kind, mimeType string, data []byte) {
+	if len(data) > maxArtifactSize {
+		writeEvent(w, flusher, "error", errorDetail{
+			Code:    "ARTIFACT_TOO_LARGE",
+			Message: "Artifact exceeds the inline streaming limit",
+			Details: map[string]string{"kind": kind},
+		})
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	sum := sha256.Sum256(data)
+
+	total := (len(data) + artifactChunkSize - 1) / artifactChunkSize
+	if total == 0 {
+		total = 1
+	}
+
+	chunk := artifactChunk{
+		ArtifactID: hex.EncodeToString(id),
+		Kind:       kind,
+		MimeType:   mimeType,
+		Total:      total,
+		Size:       len(data),
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+	for i := 0; i < total; i++ {
+		end := (i + 1) * artifactChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk.Index = i
+		chunk.Data = base64.StdEncoding.EncodeToString(data[i*artifactChunkSize : end])
+		writeEvent(w, flusher, "artifact", chunk)
+	}
+}
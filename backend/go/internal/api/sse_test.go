@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func parseEvents(t *testing.T, body string) (names []string, payloads []string) {
+	t.Helper()
+
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		name := ""
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				payloads = append(payloads, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		names = append(names, name)
+	}
+	return names, payloads
+}
+
+func TestWriteArtifact(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantChunks int
+	}{
+		{"empty", 0, 1},
+		{"single chunk", 100, 1},
+		{"exact chunk boundary", artifactChunkSize, 1},
+		{"multiple chunks", artifactChunkSize*2 + 1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{0xAB, 0x01}, tt.size/2+1)[:tt.size]
+			rec := httptest.NewRecorder()
+
+			writeArtifact(rec, rec, "audio", "audio/wav", data)
+
+			names, payloads := parseEvents(t, rec.Body.String())
+			if len(payloads) != tt.wantChunks {
+				t.Fatalf("expected %d chunks, got %d", tt.wantChunks, len(payloads))
+			}
+
+			var assembled []byte
+			var id string
+			for i, p := range payloads {
+				if names[i] != "artifact" {
+					t.Errorf("expected artifact event, got %q", names[i])
+				}
+
+				var chunk artifactChunk
+				if err := json.Unmarshal([]byte(p), &chunk); err != nil {
+					t.Fatalf("Failed to decode chunk: %v", err)
+				}
+				if i == 0 {
+					id = chunk.ArtifactID
+				}
+				if chunk.ArtifactID != id || chunk.Index != i || chunk.Total != tt.wantChunks || chunk.Size != tt.size {
+					t.Errorf("unexpected chunk metadata %+v", chunk)
+				}
+
+				raw, err := base64.StdEncoding.DecodeString(chunk.Data)
+				if err != nil {
+					t.Fatalf("Failed to decode data: %v", err)
+				}
+				assembled = append(assembled, raw...)
+
+				sum := sha256.Sum256(data)
+				if chunk.SHA256 != hex.EncodeToString(sum[:]) {
+					t.Error("unexpected checksum")
+				}
+			}
+
+			if !bytes.Equal(assembled, data) {
+				t.Error("assembled artifact does not match input")
+			}
+		})
+	}
+}
+
+func TestWriteArtifact_TooLarge(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	writeArtifact(rec, rec, "audio", "audio/wav", make([]byte, maxArtifactSize+1))
+
+	names, payloads := parseEvents(t, rec.Body.String())
+	if len(names) != 1 || names[0] != "error" {
+		t.Fatalf("expected a single error event, got %v", names)
+	}
+	if !strings.Contains(payloads[0], "ARTIFACT_TOO_LARGE") {
+		t.Errorf("expected ARTIFACT_TOO_LARGE, got %s", payloads[0])
+	}
+}
@@ -0,0 +1,541 @@
+// Package apikeys lets users create, list, rotate and revoke API keys for
+// their integrations. Keys are kept in Redis, shared by every gateway
+// instance, and only their hashes are stored.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/admin"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix prefixes the keys of API keys in Redis.
+const DefaultRedisPrefix = "neuronai:apikeys:"
+
+// Prefix starts every key the Store issues, which look like
+// nk_<id>_<secret>. The ID is not secret: it names the key in listings and
+// logs.
+const Prefix = "nk_"
+
+// maxNameLength bounds the names users give their keys.
+const maxNameLength = 64
+
+// maxCacheEntries bounds the keys a Store caches; beyond it the cache is
+// reset.
+const maxCacheEntries = 10000
+
+// usedInterval is how often the last use of a key is written to Redis, per
+// instance, so busy keys do not cost a write per request.
+const usedInterval = time.Minute
+
+// GrantableScopes are the scopes users may give their keys. Admin scopes
+// are never granted to self-served keys.
+var GrantableScopes = []string{middleware.ScopeChatWrite, middleware.ScopeSessionsRead, middleware.ScopeSwarmExecute}
+
+var (
+	// ErrNotFound is returned for keys that do not exist, have expired or
+	// belong to another user.
+	ErrNotFound = errors.New("API key not found")
+	// ErrTooManyKeys is returned by Create once a user has Limits.MaxPerUser
+	// keys.
+	ErrTooManyKeys = errors.New("too many API keys")
+	// ErrInvalidRequest wraps the reasons Create refuses a CreateRequest.
+	ErrInvalidRequest = errors.New("invalid API key request")
+)
+
+// Limits bound the keys users create.
+type Limits struct {
+	// MaxTTL is the longest a key may live, and the lifetime of keys
+	// created without one.
+	MaxTTL time.Duration
+	// RateLimit is the most requests per minute a key may make, and the
+	// limit of keys created without one.
+	RateLimit int
+	// MaxPerUser is how many live keys a user may have.
+	MaxPerUser int
+}
+
+// Key describes an API key, without its secret.
+type Key struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	UserID   string   `json:"user_id"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	Scopes   []string `json:"scopes"`
+	// RateLimit is the requests per minute the key may make.
+	RateLimit  int        `json:"rate_limit"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// record is a key as stored in Redis.
+type record struct {
+	Key
+	Hash string `json:"hash"`
+}
+
+// CreateRequest is what a user asks of a new key.
+type CreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is the key's lifetime in seconds, Limits.MaxTTL if zero.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	// RateLimit is the requests per minute the key may make,
+	// Limits.RateLimit if zero.
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+// Store keeps the API keys of users in Redis. Lookups are cached for
+// cacheTTL, so a key revoked or rotated on another instance stops working
+// here within cacheTTL; one revoked through this Store stops at once.
+type Store struct {
+	client   *redis.Client
+	prefix   string
+	limits   Limits
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	cache    map[string]cachedKey
+	buckets  map[string]*limitedKey
+	lastUsed map[string]time.Time
+}
+
+// cachedKey is a stored key, nil if it was absent, and when it must be
+// looked up again.
+type cachedKey struct {
+	rec     *record
+	expires time.Time
+}
+
+type limitedKey struct {
+	bucket *ratelimit.Bucket
+	limit  int
+}
+
+// NewStore connects to the Redis server at url, e.g.
+// redis://:pass@host:6379/0.
+func NewStore(url, prefix string, limits Limits, cacheTTL time.Duration) (*Store, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	return &Store{
+		client:   redis.NewClient(opts),
+		prefix:   prefix,
+		limits:   limits,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cachedKey),
+		buckets:  make(map[string]*limitedKey),
+		lastUsed: make(map[string]time.Time),
+	}, nil
+}
+
+func (s *Store) keyKey(id string) string      { return s.prefix + "key:" + id }
+func (s *Store) usedKey(id string) string     { return s.prefix + "used:" + id }
+func (s *Store) userKey(userID string) string { return s.prefix + "user:" + userID }
+
+// Create issues a key acting as owner, with the owner's tenant, and returns
+// it with its secret, which is not kept and cannot be shown again. Each
+// scope requested must be grantable and held by owner.
+func (s *Store) Create(ctx context.Context, owner *middleware.Claims, req CreateRequest) (Key, string, error) {
+	if err := s.validate(owner, &req); err != nil {
+		return Key{}, "", err
+	}
+	keys, err := s.List(ctx, owner.UserID)
+	if err != nil {
+		return Key{}, "", err
+	}
+	if s.limits.MaxPerUser > 0 && len(keys) >= s.limits.MaxPerUser {
+		return Key{}, "", ErrTooManyKeys
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := newSecret(id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	now := s.now().UTC().Truncate(time.Second)
+	ttl := s.limits.MaxTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	rec := &record{
+		Key: Key{
+			ID:        id,
+			Name:      req.Name,
+			UserID:    owner.UserID,
+			TenantID:  owner.TenantID,
+			Scopes:    req.Scopes,
+			RateLimit: req.RateLimit,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		},
+		Hash: middleware.HashAPIKey(secret),
+	}
+	if err := s.save(ctx, rec); err != nil {
+		return Key{}, "", err
+	}
+	if err := s.client.SAdd(ctx, s.userKey(owner.UserID), id).Err(); err != nil {
+		return Key{}, "", err
+	}
+	return rec.Key, secret, nil
+}
+
+// validate checks req on behalf of owner and fills in its defaults.
+func (s *Store) validate(owner *middleware.Claims, req *CreateRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidRequest, maxNameLength)
+	}
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidRequest)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(GrantableScopes, scope) {
+			return fmt.Errorf("%w: scope %q cannot be granted to API keys", ErrInvalidRequest, scope)
+		}
+		if !owner.HasScope(scope) {
+			return fmt.Errorf("%w: scope %q is not granted to you", ErrInvalidRequest, scope)
+		}
+	}
+	req.Scopes = slices.Clone(req.Scopes)
+	sort.Strings(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+
+	if maxSeconds := int64(s.limits.MaxTTL / time.Second); req.ExpiresIn < 0 || req.ExpiresIn > maxSeconds {
+		return fmt.Errorf("%w: expires_in must be at most %d seconds", ErrInvalidRequest, maxSeconds)
+	}
+	if req.RateLimit < 0 || req.RateLimit > s.limits.RateLimit {
+		return fmt.Errorf("%w: rate_limit must be at most %d", ErrInvalidRequest, s.limits.RateLimit)
+	}
+	if req.RateLimit == 0 {
+		req.RateLimit = s.limits.RateLimit
+	}
+	return nil
+}
+
+// List returns the live keys of userID, oldest first.
+func (s *Store) List(ctx context.Context, userID string) ([]Key, error) {
+	ids, err := s.client.SMembers(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := []Key{}
+	if len(ids) == 0 {
+		return keys, nil
+	}
+
+	lookups := make([]string, 0, 2*len(ids))
+	for _, id := range ids {
+		lookups = append(lookups, s.keyKey(id), s.usedKey(id))
+	}
+	values, err := s.client.MGet(ctx, lookups...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var gone []any
+	now := s.now()
+	for i, id := range ids {
+		rec, err := decode(values[2*i])
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil || !now.Before(rec.ExpiresAt) {
+			gone = append(gone, id)
+			continue
+		}
+		if used, ok := values[2*i+1].(string); ok {
+			if t, err := time.Parse(time.RFC3339, used); err == nil {
+				rec.LastUsedAt = &t
+			}
+		}
+		keys = append(keys, rec.Key)
+	}
+	if len(gone) > 0 {
+		// Redis expired them; drop them from the index too.
+		s.client.SRem(ctx, s.userKey(userID), gone...)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// Rotate replaces the secret of userID's key id and returns the new one.
+// The old secret stops working at once on this instance, and within the
+// cache TTL on others. The key keeps its ID, scopes and expiry.
+func (s *Store) Rotate(ctx context.Context, userID, id string) (Key, string, error) {
+	rec, err := s.owned(ctx, userID, id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := newSecret(id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	now := s.now().UTC().Truncate(time.Second)
+	rec.RotatedAt = &now
+	rec.LastUsedAt = nil
+	rec.Hash = middleware.HashAPIKey(secret)
+	if err := s.save(ctx, rec); err != nil {
+		return Key{}, "", err
+	}
+	return rec.Key, secret, nil
+}
+
+// Revoke deletes userID's key id.
+func (s *Store) Revoke(ctx context.Context, userID, id string) error {
+	if _, err := s.owned(ctx, userID, id); err != nil {
+		return err
+	}
+	if err := s.client.Del(ctx, s.keyKey(id), s.usedKey(id)).Err(); err != nil {
+		return err
+	}
+	s.client.SRem(ctx, s.userKey(userID), id)
+
+	s.mu.Lock()
+	s.cacheLocked(id, nil)
+	delete(s.buckets, id)
+	delete(s.lastUsed, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// ResolveAPIKey returns the claims of the caller presenting key, a live key
+// of the Store, and records its use. It implements middleware.KeyStore.
+func (s *Store) ResolveAPIKey(ctx context.Context, key string) (*middleware.Claims, bool, error) {
+	id, ok := parseID(key)
+	if !ok {
+		return nil, false, nil
+	}
+	rec, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	now := s.now()
+	if rec == nil || !now.Before(rec.ExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(middleware.HashAPIKey(key)), []byte(rec.Hash)) != 1 {
+		return nil, false, nil
+	}
+
+	s.touch(ctx, rec, now)
+	return &middleware.Claims{
+		UserID:   rec.UserID,
+		TenantID: rec.TenantID,
+		Scopes:   slices.Clone(rec.Scopes),
+		APIKey:   rec.ID,
+	}, true, nil
+}
+
+// lookup returns the stored key id, from the cache or Redis, or nil if it
+// does not exist.
+func (s *Store) lookup(ctx context.Context, id string) (*record, error) {
+	now := s.now()
+	s.mu.Lock()
+	c, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.rec, nil
+	}
+
+	data, err := s.client.Get(ctx, s.keyKey(id)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	rec, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.cacheLocked(id, rec)
+	s.mu.Unlock()
+	return rec, nil
+}
+
+// owned returns userID's key id, bypassing the cache.
+func (s *Store) owned(ctx context.Context, userID, id string) (*record, error) {
+	data, err := s.client.Get(ctx, s.keyKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || rec.UserID != userID || !s.now().Before(rec.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+// save writes rec, to expire with the key, and caches it.
+func (s *Store) save(ctx context.Context, rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ttl := rec.ExpiresAt.Sub(s.now())
+	if err := s.client.Set(ctx, s.keyKey(rec.ID), data, ttl).Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cacheLocked(rec.ID, rec)
+	s.mu.Unlock()
+	return nil
+}
+
+// cacheLocked caches rec as key id. The caller must hold mu.
+func (s *Store) cacheLocked(id string, rec *record) {
+	if s.cacheTTL <= 0 {
+		delete(s.cache, id)
+		return
+	}
+	if len(s.cache) >= maxCacheEntries {
+		s.cache = make(map[string]cachedKey)
+	}
+	s.cache[id] = cachedKey{rec: rec, expires: s.now().Add(s.cacheTTL)}
+}
+
+// touch records that rec was used at now, at most every usedInterval, and
+// prepares its rate limit. A failed write is not worth failing the request
+// for.
+func (s *Store) touch(ctx context.Context, rec *record, now time.Time) {
+	s.mu.Lock()
+	if len(s.buckets) >= maxCacheEntries {
+		s.buckets = make(map[string]*limitedKey)
+		s.lastUsed = make(map[string]time.Time)
+	}
+	if l, ok := s.buckets[rec.ID]; !ok || l.limit != rec.RateLimit {
+		s.buckets[rec.ID] = &limitedKey{bucket: ratelimit.NewBucket(float64(rec.RateLimit)/60, rec.RateLimit), limit: rec.RateLimit}
+	}
+	write := now.Sub(s.lastUsed[rec.ID]) >= usedInterval
+	if write {
+		s.lastUsed[rec.ID] = now
+	}
+	s.mu.Unlock()
+	if write {
+		s.client.Set(ctx, s.usedKey(rec.ID), now.UTC().Format(time.RFC3339), rec.ExpiresAt.Sub(now))
+	}
+}
+
+// Middleware holds callers authenticated with a key of the Store to the
+// key's rate limit, answering 429 Too Many Requests with a Retry-After
+// header over it, and lets everyone else through. Place it inside JWTAuth.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetClaims(r.Context())
+		if !ok || claims.APIKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.mu.Lock()
+		l, ok := s.buckets[claims.APIKey]
+		s.mu.Unlock()
+		if !ok {
+			// A fixed key of API_KEYS_FILE.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		remaining, wait, ok := l.bucket.Take()
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			metrics.ObserveHTTPThrottled("apikey")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "API key rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check pings Redis, for the boot report.
+func (s *Store) Check(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Backend reports the Redis server for runtime introspection, without the
+// credentials carried in the URL.
+func (s *Store) Backend() admin.Backend {
+	return admin.Backend{Name: "api_keys", Kind: "redis", Address: s.client.Options().Addr}
+}
+
+func (s *Store) Close() error {
+	return s.client.Close()
+}
+
+// decode parses a stored key; absent ones, nil or empty, are nil.
+func decode(v any) (*record, error) {
+	data, _ := v.(string)
+	if data == "" {
+		return nil, nil
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return nil, fmt.Errorf("invalid stored API key: %w", err)
+	}
+	return &rec, nil
+}
+
+// parseID returns the ID of a key issued by a Store.
+func parseID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, Prefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || secret == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 16 {
+		return "", false
+	}
+	return id, true
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newSecret returns a new key with ID id.
+func newSecret(id string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return Prefix + id + "_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,187 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func newTestStore(t *testing.T, mr *miniredis.Miniredis, cacheTTL time.Duration) *Store {
+	t.Helper()
+	s, err := NewStore("redis://"+mr.Addr(), DefaultRedisPrefix, Limits{MaxTTL: 24 * time.Hour, RateLimit: 60, MaxPerUser: 2}, cacheTTL)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_Lifecycle(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestStore(t, mr, time.Minute)
+	ctx := context.Background()
+	owner := &middleware.Claims{UserID: "alice", TenantID: "acme"}
+
+	key, secret, err := s.Create(ctx, owner, CreateRequest{Name: "ci", Scopes: []string{middleware.ScopeChatWrite}, ExpiresIn: 3600})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, Prefix+key.ID+"_") || key.RateLimit != 60 || key.ExpiresAt.Sub(key.CreatedAt) != time.Hour {
+		t.Errorf("unexpected key %+v, secret %q", key, secret)
+	}
+	if strings.Contains(mr.Dump(), secret) {
+		t.Error("expected only the hash of the key to be stored")
+	}
+
+	claims, ok, err := s.ResolveAPIKey(ctx, secret)
+	if err != nil || !ok {
+		t.Fatalf("ResolveAPIKey() = %v, %v", ok, err)
+	}
+	if claims.UserID != "alice" || claims.TenantID != "acme" || claims.APIKey != key.ID ||
+		!claims.HasScope(middleware.ScopeChatWrite) || claims.HasScope(middleware.ScopeSessionsRead) {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if _, ok, _ := s.ResolveAPIKey(ctx, secret+"x"); ok {
+		t.Error("expected a forged secret to be refused")
+	}
+
+	keys, err := s.List(ctx, "alice")
+	if err != nil || len(keys) != 1 || keys[0].ID != key.ID || keys[0].LastUsedAt == nil {
+		t.Fatalf("List() = %+v, %v", keys, err)
+	}
+	if keys, _ := s.List(ctx, "bob"); len(keys) != 0 {
+		t.Errorf("expected bob to have no keys, got %+v", keys)
+	}
+
+	rotated, newSecret, err := s.Rotate(ctx, "alice", key.ID)
+	if err != nil || rotated.ID != key.ID || rotated.RotatedAt == nil || newSecret == secret {
+		t.Fatalf("Rotate() = %+v, %v", rotated, err)
+	}
+	if _, ok, _ := s.ResolveAPIKey(ctx, secret); ok {
+		t.Error("expected the old secret to stop working after rotation")
+	}
+	if _, ok, _ := s.ResolveAPIKey(ctx, newSecret); !ok {
+		t.Error("expected the new secret to work")
+	}
+
+	if err := s.Revoke(ctx, "bob", key.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another user's revocation to fail, got %v", err)
+	}
+	if err := s.Revoke(ctx, "alice", key.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, ok, _ := s.ResolveAPIKey(ctx, newSecret); ok {
+		t.Error("expected a revoked key to be refused")
+	}
+	if keys, _ := s.List(ctx, "alice"); len(keys) != 0 {
+		t.Errorf("expected no keys after revocation, got %+v", keys)
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestStore(t, mr, 0)
+	ctx := context.Background()
+
+	_, secret, err := s.Create(ctx, &middleware.Claims{UserID: "alice"}, CreateRequest{Name: "short", Scopes: []string{middleware.ScopeChatWrite}, ExpiresIn: 60})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if ttl := mr.TTL(DefaultRedisPrefix + "key:" + secret[len(Prefix):len(Prefix)+16]); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("expected the stored key to expire with it, got TTL %v", ttl)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, ok, _ := s.ResolveAPIKey(ctx, secret); ok {
+		t.Error("expected an expired key to be refused")
+	}
+	if keys, _ := s.List(ctx, "alice"); len(keys) != 0 {
+		t.Errorf("expected expired keys not to be listed, got %+v", keys)
+	}
+}
+
+func TestStore_Create_Validation(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestStore(t, mr, time.Minute)
+	ctx := context.Background()
+	scoped := &middleware.Claims{UserID: "svc", Scopes: []string{middleware.ScopeChatWrite}}
+
+	tests := []struct {
+		name  string
+		owner *middleware.Claims
+		req   CreateRequest
+	}{
+		{"no name", scoped, CreateRequest{Scopes: []string{middleware.ScopeChatWrite}}},
+		{"no scopes", scoped, CreateRequest{Name: "k"}},
+		{"admin scope", &middleware.Claims{UserID: "ops"}, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeAdmin}}},
+		{"scope the owner lacks", scoped, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeSessionsRead}}},
+		{"too long", scoped, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeChatWrite}, ExpiresIn: 2 * 86400}},
+		{"rate limit over the maximum", scoped, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeChatWrite}, RateLimit: 61}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.Create(ctx, tt.owner, tt.req); !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("expected ErrInvalidRequest, got %v", err)
+			}
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := s.Create(ctx, scoped, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeChatWrite}}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if _, _, err := s.Create(ctx, scoped, CreateRequest{Name: "k", Scopes: []string{middleware.ScopeChatWrite}}); !errors.Is(err, ErrTooManyKeys) {
+		t.Errorf("expected ErrTooManyKeys, got %v", err)
+	}
+}
+
+func TestStore_Middleware(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestStore(t, mr, time.Minute)
+	ctx := context.Background()
+
+	_, secret, err := s.Create(ctx, &middleware.Claims{UserID: "alice"}, CreateRequest{Name: "slow", Scopes: []string{middleware.ScopeChatWrite}, RateLimit: 2})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	handler := middleware.JWTAuth("secret", middleware.WithKeyStore(s))(s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+		req.Header.Set(middleware.APIKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected the third request to be throttled, got %v", codes)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	req.Header.Set(middleware.APIKeyHeader, Prefix+"0123456789abcdef_forged")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown key to get 401, got %d", rec.Code)
+	}
+
+	mr.Close()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	req.Header.Set(middleware.APIKeyHeader, Prefix+"fedcba9876543210_other")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the store is down, got %d", rec.Code)
+	}
+}
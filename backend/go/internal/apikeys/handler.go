@@ -0,0 +1,130 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// Issued is a key with its secret, returned once when the key is created or
+// rotated.
+type Issued struct {
+	Key
+	APIKey string `json:"api_key"`
+}
+
+// Handler serves /api/v1/keys, GET to list the caller's keys and POST with
+// a CreateRequest to create one, and /api/v1/keys/{id}, DELETE to revoke
+// it. Keys are managed with the user's own token: API keys and guests are
+// refused.
+func (s *Store) Handler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		keys, err := s.List(r.Context(), claims.UserID)
+		if err != nil {
+			s.unavailable(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+
+	case id == "" && r.Method == http.MethodPost:
+		var req CreateRequest
+		if err := middleware.DecodeJSON(r.Body, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		key, secret, err := s.Create(r.Context(), claims, req)
+		switch {
+		case errors.Is(err, ErrInvalidRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrTooManyKeys):
+			http.Error(w, "Too many API keys; revoke one first", http.StatusConflict)
+			return
+		case err != nil:
+			s.unavailable(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "Created API key", "key_id", key.ID, "scopes", key.Scopes)
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusCreated, Issued{Key: key, APIKey: secret})
+
+	case id != "" && r.Method == http.MethodDelete:
+		err := s.Revoke(r.Context(), claims.UserID, id)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			s.unavailable(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "Revoked API key", "key_id", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RotateHandler serves POST /api/v1/keys/{id}/rotate, replacing the key's
+// secret.
+func (s *Store) RotateHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, secret, err := s.Rotate(r.Context(), claims.UserID, r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.unavailable(w, r, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Rotated API key", "key_id", key.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, Issued{Key: key, APIKey: secret})
+}
+
+// manager returns the claims of the caller if they may manage keys, and
+// answers the request otherwise.
+func (s *Store) manager(w http.ResponseWriter, r *http.Request) (*middleware.Claims, bool) {
+	claims, ok := middleware.GetClaims(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if claims.APIKey != "" || claims.Guest {
+		http.Error(w, "Forbidden: API keys are managed with a user token", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+func (s *Store) unavailable(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "API key store failed", logging.Err(err))
+	http.Error(w, "API key store unavailable", http.StatusServiceUnavailable)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
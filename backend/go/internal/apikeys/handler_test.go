@@ -0,0 +1,80 @@
+package apikeys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func TestHandler(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestStore(t, mr, time.Minute)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/keys", s.Handler)
+	mux.HandleFunc("/api/v1/keys/{id}", s.Handler)
+	mux.HandleFunc("/api/v1/keys/{id}/rotate", s.RotateHandler)
+
+	do := func(method, path, body string, claims *middleware.Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), middleware.GetClaimsContextKey(), claims))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	alice := &middleware.Claims{UserID: "alice"}
+
+	rec := do(http.MethodPost, "/api/v1/keys", `{"name":"ci","scopes":["chat:write"]}`, alice)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("create: status %d, body %s", rec.Code, rec.Body)
+	}
+	var issued Issued
+	if err := json.NewDecoder(rec.Body).Decode(&issued); err != nil || issued.APIKey == "" || issued.ID == "" {
+		t.Fatalf("unexpected created key %+v, %v", issued, err)
+	}
+
+	rec = do(http.MethodGet, "/api/v1/keys", "", alice)
+	if rec.Code != http.StatusOK || bytes.Contains(rec.Body.Bytes(), []byte(issued.APIKey)) || bytes.Contains(rec.Body.Bytes(), []byte(`"hash"`)) {
+		t.Fatalf("list: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = do(http.MethodPost, "/api/v1/keys/"+issued.ID+"/rotate", "", alice)
+	var rotated Issued
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&rotated) != nil || rotated.APIKey == issued.APIKey {
+		t.Fatalf("rotate: status %d, key %+v", rec.Code, rotated)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		claims     *middleware.Claims
+		wantStatus int
+	}{
+		{"invalid scope", http.MethodPost, "/api/v1/keys", `{"name":"x","scopes":["admin:*"]}`, alice, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/api/v1/keys", `{"name":"x","scopes":["chat:write"],"roles":["admin"]}`, alice, http.StatusBadRequest},
+		{"by an API key", http.MethodGet, "/api/v1/keys", "", &middleware.Claims{UserID: "alice", APIKey: issued.ID}, http.StatusForbidden},
+		{"by a guest", http.MethodGet, "/api/v1/keys", "", &middleware.Claims{UserID: "guest:1", Guest: true}, http.StatusForbidden},
+		{"unauthenticated", http.MethodGet, "/api/v1/keys", "", nil, http.StatusUnauthorized},
+		{"another user's key", http.MethodDelete, "/api/v1/keys/" + issued.ID, "", &middleware.Claims{UserID: "bob"}, http.StatusNotFound},
+		{"revoke", http.MethodDelete, "/api/v1/keys/" + issued.ID, "", alice, http.StatusNoContent},
+		{"revoke again", http.MethodDelete, "/api/v1/keys/" + issued.ID, "", alice, http.StatusNotFound},
+		{"wrong method", http.MethodPut, "/api/v1/keys", "", alice, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(tt.method, tt.path, tt.body, tt.claims); rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
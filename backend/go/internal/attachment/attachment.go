@@ -0,0 +1,132 @@
+// Package attachment validates client attachment references against the
+// upload store before they are forwarded to the Python service.
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// MaxPerRequest bounds the number of attachments on a single chat message.
+const MaxPerRequest = 10
+
+var (
+	ErrNotFound  = errors.New("attachment not found")
+	ErrForbidden = errors.New("attachment belongs to another user")
+)
+
+type Kind string
+
+const (
+	KindImage    Kind = "image"
+	KindVideo    Kind = "video"
+	KindAudio    Kind = "audio"
+	KindDocument Kind = "document"
+)
+
+// Reference is what clients send: a pointer to an object previously uploaded
+// to the store, never the bytes themselves.
+type Reference struct {
+	ID       string `json:"id"`
+	Kind     Kind   `json:"kind"`
+	MimeType string `json:"mime"`
+	Size     int64  `json:"size"`
+}
+
+// Object is the upload store's record of an uploaded file.
+type Object struct {
+	ID       string `json:"id"`
+	OwnerID  string `json:"owner_id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+}
+
+// Store looks up uploaded objects. Stat returns ErrNotFound for unknown ids.
+type Store interface {
+	Stat(ctx context.Context, id string) (*Object, error)
+}
+
+// Resolve checks every reference against store and returns the protobuf
+// attachments to forward. References must be owned by userID and agree with
+// the stored mime type and size.
+func Resolve(ctx context.Context, store Store, userID string, refs []Reference) ([]*pb.Attachment, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	if store == nil {
+		return nil, fmt.Errorf("attachments are not enabled")
+	}
+	if len(refs) > MaxPerRequest {
+		return nil, fmt.Errorf("at most %d attachments are allowed", MaxPerRequest)
+	}
+
+	attachments := make([]*pb.Attachment, 0, len(refs))
+	for i, ref := range refs {
+		if err := ref.validate(); err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", i, err)
+		}
+
+		obj, err := store.Stat(ctx, ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", ref.ID, err)
+		}
+		if obj.OwnerID != userID {
+			return nil, fmt.Errorf("attachment %s: %w", ref.ID, ErrForbidden)
+		}
+		if obj.MimeType != ref.MimeType {
+			return nil, fmt.Errorf("attachment %s: mime type %q does not match upload %q", ref.ID, ref.MimeType, obj.MimeType)
+		}
+		if obj.Size != ref.Size {
+			return nil, fmt.Errorf("attachment %s: size %d does not match upload %d", ref.ID, ref.Size, obj.Size)
+		}
+
+		attachments = append(attachments, &pb.Attachment{
+			Id:       obj.ID,
+			Filename: obj.Filename,
+			MimeType: obj.MimeType,
+			Url:      obj.URL,
+		})
+	}
+
+	return attachments, nil
+}
+
+// HasKind reports whether any of refs is of kind. A chat without an explicit
+// message type that carries audio is a voice note.
+func HasKind(refs []Reference, kind Kind) bool {
+	for _, ref := range refs {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Reference) validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if r.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+
+	switch r.Kind {
+	case KindImage, KindVideo, KindAudio:
+		if !strings.HasPrefix(r.MimeType, string(r.Kind)+"/") {
+			return fmt.Errorf("mime type %q is not valid for kind %s", r.MimeType, r.Kind)
+		}
+	case KindDocument:
+		if r.MimeType == "" {
+			return fmt.Errorf("mime is required")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package attachment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memoryStore map[string]*Object
+
+func (m memoryStore) Stat(ctx context.Context, id string) (*Object, error) {
+	obj, ok := m[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return obj, nil
+}
+
+func TestResolve(t *testing.T) {
+	store := memoryStore{
+		"img-1": {ID: "img-1", OwnerID: "user-1", Filename: "cat.png", MimeType: "image/png", Size: 1024, URL: "https://cdn/cat.png"},
+		"doc-1": {ID: "doc-1", OwnerID: "user-2", Filename: "a.pdf", MimeType: "application/pdf", Size: 2048},
+	}
+	valid := Reference{ID: "img-1", Kind: KindImage, MimeType: "image/png", Size: 1024}
+
+	tests := []struct {
+		name    string
+		store   Store
+		refs    []Reference
+		wantLen int
+		wantErr error
+		anyErr  bool
+	}{
+		{"no references", nil, nil, 0, nil, false},
+		{"store not configured", nil, []Reference{valid}, 0, nil, true},
+		{"valid reference", store, []Reference{valid}, 1, nil, false},
+		{"unknown id", store, []Reference{{ID: "nope", Kind: KindImage, MimeType: "image/png", Size: 1}}, 0, ErrNotFound, true},
+		{"other user's upload", store, []Reference{{ID: "doc-1", Kind: KindDocument, MimeType: "application/pdf", Size: 2048}}, 0, ErrForbidden, true},
+		{"mime mismatch", store, []Reference{{ID: "img-1", Kind: KindImage, MimeType: "image/jpeg", Size: 1024}}, 0, nil, true},
+		{"size mismatch", store, []Reference{{ID: "img-1", Kind: KindImage, MimeType: "image/png", Size: 1}}, 0, nil, true},
+		{"kind does not match mime", store, []Reference{{ID: "img-1", Kind: KindVideo, MimeType: "image/png", Size: 1024}}, 0, nil, true},
+		{"unknown kind", store, []Reference{{ID: "img-1", Kind: "sticker", MimeType: "image/png", Size: 1024}}, 0, nil, true},
+		{"missing id", store, []Reference{{Kind: KindImage, MimeType: "image/png", Size: 1024}}, 0, nil, true},
+		{"too many", store, make([]Reference, MaxPerRequest+1), 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), tt.store, "user-1", tt.refs)
+			if (err != nil) != tt.anyErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.anyErr)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("expected %d attachments, got %d", tt.wantLen, len(got))
+			}
+		})
+	}
+}
+
+func TestResolve_MapsStoredObject(t *testing.T) {
+	store := memoryStore{
+		"img-1": {ID: "img-1", OwnerID: "user-1", Filename: "cat.png", MimeType: "image/png", Size: 1024, URL: "https://cdn/cat.png"},
+	}
+
+	got, err := Resolve(context.Background(), store, "user-1", []Reference{{ID: "img-1", Kind: KindImage, MimeType: "image/png", Size: 1024}})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	a := got[0]
+	if a.Id != "img-1" || a.Filename != "cat.png" || a.MimeType != "image/png" || a.Url != "https://cdn/cat.png" {
+		t.Errorf("unexpected attachment %+v", a)
+	}
+	if len(a.Data) != 0 {
+		t.Error("expected no inline data")
+	}
+}
+
+func TestHTTPStore_Stat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/uploads/img-1":
+			json.NewEncoder(w).Encode(Object{ID: "img-1", OwnerID: "user-1", MimeType: "image/png", Size: 10})
+		case "/uploads/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewHTTPStore(srv.URL+"/uploads/", time.Second)
+
+	tests := []struct {
+		name         string
+		id           string
+		wantErr      bool
+		wantNotFound bool
+	}{
+		{"found", "img-1", false, false},
+		{"not found", "missing", true, true},
+		{"server error", "broken", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := store.Stat(context.Background(), tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Stat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("expected ErrNotFound %v, got %v", tt.wantNotFound, err)
+			}
+			if !tt.wantErr && obj.ID != tt.id {
+				t.Errorf("expected id %s, got %s", tt.id, obj.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package attachment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPStore queries the upload service at GET {baseURL}/{id}.
+type HTTPStore struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPStore(baseURL string, timeout time.Duration) *HTTPStore {
+	return &HTTPStore{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *HTTPStore) Stat(ctx context.Context, id string) (*Object, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload store request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("upload store returned status %d", resp.StatusCode)
+	}
+
+	var obj Object
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid upload store response: %w", err)
+	}
+	return &obj, nil
+}
@@ -0,0 +1,154 @@
+// Package audit records security-relevant gateway events, such as WebSocket
+// connections, authentication outcomes, access decisions, admin actions and
+// data exports, to a sink that can be shipped to a SIEM.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+type Type string
+
+const (
+	TypeConnect     Type = "ws.connect"
+	TypeDisconnect  Type = "ws.disconnect"
+	TypeAuthFailure Type = "ws.auth_failure"
+	TypeControl     Type = "ws.control"
+	// TypeAccess records an access control decision on an HTTP route.
+	TypeAccess Type = "http.access"
+	// TypeHTTPAuthSuccess and TypeHTTPAuthFailure record the outcome of
+	// authenticating an HTTP request.
+	TypeHTTPAuthSuccess Type = "http.auth_success"
+	TypeHTTPAuthFailure Type = "http.auth_failure"
+	// TypeLoginFailure records a login rejected for invalid credentials or
+	// refused by the login throttle, and TypeLockout an account or client
+	// IP locked out after repeated failures.
+	TypeLoginFailure Type = "auth.login_failure"
+	TypeLockout      Type = "auth.lockout"
+	// TypeAdmin records a request to an operator endpoint.
+	TypeAdmin Type = "admin.action"
+	// TypeExport records a request reading stored conversation data out of
+	// the gateway.
+	TypeExport Type = "data.export"
+)
+
+// Event is an audit record. Fields that do not apply to its Type are empty.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	UserID    string    `json:"user_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	// ClientIP is the client address resolved behind trusted proxies, the
+	// one rate limits and IP rules apply to. RemoteAddr is the peer address
+	// of the connection; ForwardedFor is the X-Forwarded-For header as
+	// received, kept for investigations.
+	ClientIP     string `json:"client_ip,omitempty"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	// Action is a control command and Target the stream, channel or agent it
+	// names.
+	Action string `json:"action,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Decision is "allow" or "deny" for access decisions.
+	Decision string `json:"decision,omitempty"`
+	// Reason explains an authentication outcome or an access decision.
+	Reason string `json:"reason,omitempty"`
+	// Status is the HTTP status of an admin action or data export.
+	Status int `json:"status,omitempty"`
+	// DurationMillis, BytesIn and BytesOut summarize a closed connection.
+	DurationMillis int64 `json:"duration_ms,omitempty"`
+	BytesIn        int64 `json:"bytes_in,omitempty"`
+	BytesOut       int64 `json:"bytes_out,omitempty"`
+}
+
+// RequestPeer returns the event fields identifying the peer of r.
+func RequestPeer(r *http.Request) Event {
+	return Event{
+		ClientIP:     clientip.String(r),
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		UserAgent:    r.UserAgent(),
+	}
+}
+
+// Sink receives audit events. Record is called from connection goroutines
+// and must not block for long.
+type Sink interface {
+	Record(Event)
+}
+
+// Output is a Sink opened by Open, which must be closed on shutdown to flush
+// buffered events.
+type Output interface {
+	Sink
+	Close() error
+}
+
+// Writer is a Sink writing each event as a line of JSON, the format log
+// shippers forward to a SIEM.
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Open returns the Output named by dest: a Writer to "stdout" or "stderr",
+// an HTTP collector for an http:// or https:// URL, a Kafka REST proxy topic
+// for a kafka+http:// or kafka+https:// URL, or otherwise a Writer appending
+// to the file at dest.
+func Open(dest string) (Output, error) {
+	switch {
+	case dest == "stdout":
+		return NewWriter(os.Stdout), nil
+	case dest == "stderr":
+		return NewWriter(os.Stderr), nil
+	case strings.HasPrefix(dest, "http://"), strings.HasPrefix(dest, "https://"):
+		return NewHTTP(dest), nil
+	case strings.HasPrefix(dest, "kafka+http://"), strings.HasPrefix(dest, "kafka+https://"):
+		return NewKafkaREST(strings.TrimPrefix(dest, "kafka+")), nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Writer{w: f, closer: f}, nil
+}
+
+func (w *Writer) Record(e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode audit event", "type", e.Type, logging.Err(err))
+		return
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(data); err != nil {
+		slog.Error("Failed to write audit event", "type", e.Type, logging.Err(err))
+	}
+}
+
+// Close closes the file opened by Open, if any.
+func (w *Writer) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
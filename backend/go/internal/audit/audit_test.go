@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Record(Event{Time: time.Unix(0, 0).UTC(), Type: TypeConnect, UserID: "u1", SessionID: "s1"})
+	w.Record(Event{Type: TypeDisconnect, UserID: "u1", DurationMillis: 1500, BytesIn: 10, BytesOut: 20})
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Failed to decode line %s: %v", scanner.Bytes(), err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(events))
+	}
+	if events[0]["type"] != "ws.connect" || events[0]["session_id"] != "s1" || events[0]["time"] != "1970-01-01T00:00:00Z" {
+		t.Errorf("unexpected connect event %v", events[0])
+	}
+	if _, ok := events[0]["bytes_in"]; ok {
+		t.Errorf("expected empty fields omitted, got %v", events[0])
+	}
+	if events[1]["duration_ms"] != float64(1500) || events[1]["bytes_out"] != float64(20) {
+		t.Errorf("unexpected disconnect event %v", events[1])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		w, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		w.Record(Event{Type: TypeAuthFailure, Reason: "invalid token"})
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Errorf("expected 2 appended lines, got %d", n)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Error("expected error for unwritable path")
+	}
+}
+
+func TestRequestPeer(t *testing.T) {
+	resolver := clientip.NewResolver(clientip.HeaderRealIP, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	var e Event
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e = RequestPeer(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:443"
+	req.Header.Set("X-Real-IP", "198.51.100.7")
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if e.ClientIP != "198.51.100.7" || e.RemoteAddr != "10.0.0.2:443" || e.ForwardedFor != "203.0.113.5" {
+		t.Errorf("unexpected peer %+v", e)
+	}
+}
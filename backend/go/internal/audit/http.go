@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+const (
+	// postQueueSize bounds the events waiting for a Poster; Record drops
+	// events beyond it rather than stall connections on a slow collector.
+	postQueueSize = 4096
+	// postBatchSize and postInterval bound how many events a request carries
+	// and how long an event waits for one.
+	postBatchSize = 100
+	postInterval  = time.Second
+	postTimeout   = 10 * time.Second
+)
+
+// Poster is a Sink posting batches of events to an HTTP endpoint from a
+// background goroutine. Batches that fail are logged and dropped: the
+// gateway keeps serving when the collector is down.
+type Poster struct {
+	url         string
+	contentType string
+	encode      func([]Event) ([]byte, error)
+	client      *http.Client
+
+	events chan Event
+	done   chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int64
+}
+
+// NewHTTP returns a Poster sending each batch to url as a JSON array of
+// events, the format of generic HTTP log collectors.
+func NewHTTP(url string) *Poster {
+	return newPoster(url, "application/json", func(events []Event) ([]byte, error) {
+		return json.Marshal(events)
+	})
+}
+
+// kafkaRecord is a record of the Kafka REST proxy v2 JSON embedded format.
+type kafkaRecord struct {
+	Value Event `json:"value"`
+}
+
+// NewKafkaREST returns a Poster producing each event as a record to the
+// Kafka REST proxy topic URL, such as http://proxy:8082/topics/audit. The
+// gateway carries no native Kafka client.
+func NewKafkaREST(url string) *Poster {
+	return newPoster(url, "application/vnd.kafka.json.v2+json", func(events []Event) ([]byte, error) {
+		records := make([]kafkaRecord, len(events))
+		for i, e := range events {
+			records[i] = kafkaRecord{Value: e}
+		}
+		return json.Marshal(map[string]any{"records": records})
+	})
+}
+
+func newPoster(url, contentType string, encode func([]Event) ([]byte, error)) *Poster {
+	p := &Poster{
+		url:         url,
+		contentType: contentType,
+		encode:      encode,
+		client:      &http.Client{Timeout: postTimeout},
+		events:      make(chan Event, postQueueSize),
+		done:        make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *Poster) Record(e Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.events <- e:
+	default:
+		p.dropped++
+	}
+}
+
+// Close posts the queued events and stops the Poster. Events recorded after
+// Close are dropped.
+func (p *Poster) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	p.mu.Unlock()
+	<-p.done
+	return nil
+}
+
+func (p *Poster) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(postInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, postBatchSize)
+	flush := func() {
+		p.reportDropped()
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.post(batch); err != nil {
+			slog.Error("Failed to post audit events", "url", p.url, "events", len(batch), logging.Err(err))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-p.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) == postBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (p *Poster) reportDropped() {
+	p.mu.Lock()
+	dropped := p.dropped
+	p.dropped = 0
+	p.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("Dropped audit events behind a slow collector", "url", p.url, "events", dropped)
+	}
+}
+
+func (p *Poster) post(events []Event) error {
+	body, err := p.encode(events)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", p.contentType)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type collector struct {
+	mu           sync.Mutex
+	contentTypes []string
+	bodies       [][]byte
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contentTypes = append(c.contentTypes, r.Header.Get("Content-Type"))
+	c.bodies = append(c.bodies, body)
+}
+
+func TestOpen_HTTP(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	out, err := Open(srv.URL + "/ingest")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	out.Record(Event{Type: TypeHTTPAuthFailure, Reason: "invalid token"})
+	out.Record(Event{Type: TypeAdmin, UserID: "ops"})
+	out.Close()
+	out.Record(Event{Type: TypeAdmin})
+
+	if len(c.bodies) != 1 || c.contentTypes[0] != "application/json" {
+		t.Fatalf("expected one JSON batch, got %d posts of %v", len(c.bodies), c.contentTypes)
+	}
+	var events []Event
+	if err := json.Unmarshal(c.bodies[0], &events); err != nil {
+		t.Fatalf("Failed to decode batch %s: %v", c.bodies[0], err)
+	}
+	if len(events) != 2 || events[1].UserID != "ops" {
+		t.Errorf("unexpected batch %+v", events)
+	}
+}
+
+func TestOpen_KafkaREST(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	out, err := Open("kafka+" + srv.URL + "/topics/audit")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	out.Record(Event{Type: TypeExport, UserID: "u1", Target: "/api/v1/sessions/s1/responses"})
+	out.Close()
+
+	if len(c.bodies) != 1 || c.contentTypes[0] != "application/vnd.kafka.json.v2+json" {
+		t.Fatalf("expected one Kafka REST batch, got %d posts of %v", len(c.bodies), c.contentTypes)
+	}
+	var batch struct {
+		Records []struct {
+			Value Event `json:"value"`
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(c.bodies[0], &batch); err != nil {
+		t.Fatalf("Failed to decode batch %s: %v", c.bodies[0], err)
+	}
+	if len(batch.Records) != 1 || batch.Records[0].Value.Type != TypeExport {
+		t.Errorf("unexpected records %+v", batch.Records)
+	}
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxQueryLimit caps the events one query to Recent returns.
+const maxQueryLimit = 1000
+
+// Multi returns a Sink recording each event to every one of sinks.
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+type multi []Sink
+
+func (m multi) Record(e Event) {
+	for _, s := range m {
+		s.Record(e)
+	}
+}
+
+// Recent is a Sink keeping the latest events in memory for operators to
+// query during an incident without access to the SIEM.
+type Recent struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewRecent returns a Recent retaining the last size events.
+func NewRecent(size int) *Recent {
+	return &Recent{events: make([]Event, size)}
+}
+
+func (r *Recent) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		return
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Query selects retained events. Empty fields match any event.
+type Query struct {
+	Type   Type
+	UserID string
+	Since  time.Time
+	Limit  int
+}
+
+func (q Query) matches(e Event) bool {
+	return (q.Type == "" || e.Type == q.Type) &&
+		(q.UserID == "" || e.UserID == q.UserID) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since))
+}
+
+// Events returns the retained events matching q, newest first.
+func (r *Recent) Events(q Query) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.events)
+	}
+	events := []Event{}
+	for i := 1; i <= n; i++ {
+		e := r.events[(r.next-i+len(r.events))%len(r.events)]
+		if !q.matches(e) {
+			continue
+		}
+		events = append(events, e)
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+	}
+	return events
+}
+
+// Handler serves GET /admin/audit, filtered by the type, user_id and since
+// (RFC 3339) query parameters and capped by limit.
+func (r *Recent) Handler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := req.URL.Query()
+	q := Query{Type: Type(params.Get("type")), UserID: params.Get("user_id"), Limit: 100}
+	if v := params.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid since: expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		q.Since = since
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = min(limit, maxQueryLimit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"events": r.Events(q)})
+}
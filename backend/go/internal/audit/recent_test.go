@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecent(t *testing.T) {
+	r := NewRecent(3)
+	base := time.Unix(1000, 0)
+	for i, typ := range []Type{TypeConnect, TypeAuthFailure, TypeConnect, TypeAdmin} {
+		r.Record(Event{Time: base.Add(time.Duration(i) * time.Second), Type: typ, UserID: "u1"})
+	}
+
+	all := r.Events(Query{})
+	if len(all) != 3 || all[0].Type != TypeAdmin || all[2].Type != TypeAuthFailure {
+		t.Fatalf("expected the last 3 events newest first, got %+v", all)
+	}
+	if got := r.Events(Query{Type: TypeConnect}); len(got) != 1 {
+		t.Errorf("expected 1 retained connect, got %+v", got)
+	}
+	if got := r.Events(Query{Since: base.Add(3 * time.Second)}); len(got) != 1 || got[0].Type != TypeAdmin {
+		t.Errorf("unexpected events since %v: %+v", base.Add(3*time.Second), got)
+	}
+	if got := r.Events(Query{UserID: "u2"}); len(got) != 0 {
+		t.Errorf("expected no events of u2, got %+v", got)
+	}
+	if got := r.Events(Query{Limit: 2}); len(got) != 2 {
+		t.Errorf("expected limit to cap events, got %+v", got)
+	}
+}
+
+func TestRecent_Handler(t *testing.T) {
+	r := NewRecent(10)
+	r.Record(Event{Type: TypeHTTPAuthFailure, Reason: "invalid token"})
+	r.Record(Event{Type: TypeAdmin, UserID: "ops"})
+
+	rec := httptest.NewRecorder()
+	r.Handler(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?type=http.auth_failure", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode events: %v", err)
+	}
+	if len(body.Events) != 1 || body.Events[0].Reason != "invalid token" {
+		t.Errorf("unexpected events %+v", body.Events)
+	}
+
+	for _, query := range []string{"since=yesterday", "limit=0"} {
+		rec := httptest.NewRecorder()
+		r.Handler(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package backplane fans session-scoped WebSocket messages and user
+// notifications across gateway replicas so they reach a session's or user's
+// clients on every instance.
+package backplane
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Message is a message published by another instance, addressed to a
+// session's clients, to every connection of a user when UserID is set, to
+// a channel's subscribers when Channel is set, or to the receiving instance
+// itself when Instance is set.
+type Message struct {
+	SessionID string
+	// StreamID names the chat a session message belongs to, if any.
+	StreamID string
+	// Owner is the user the session of a session message belongs to, if
+	// known.
+	Owner    string
+	UserID   string
+	Channel  string
+	Instance string
+	Data     []byte
+}
+
+// Handler receives a message published by another instance.
+type Handler func(Message)
+
+// Backplane publishes messages to, and receives them from, the other gateway
+// instances. Implementations drop messages an instance published itself, since
+// the Hub has already delivered them locally.
+type Backplane interface {
+	// Publish publishes a message for the connections of sessionID, which
+	// belongs to owner. streamID names the chat it belongs to; either may be
+	// empty.
+	Publish(ctx context.Context, sessionID, streamID, owner string, data []byte) error
+	// PublishUser publishes a notification for every connection of userID.
+	PublishUser(ctx context.Context, userID string, data []byte) error
+	// PublishChannel publishes a message for the subscribers of channel.
+	PublishChannel(ctx context.Context, channel string, data []byte) error
+	// PublishInstance publishes a message for the instance whose Instance is
+	// instance only.
+	PublishInstance(ctx context.Context, instance string, data []byte) error
+	// Instance returns the ID other instances address this one by.
+	Instance() string
+	// Subscribe calls handler for every message from another instance until
+	// ctx is done.
+	Subscribe(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+// envelope is the wire form of a message on the shared channel.
+type envelope struct {
+	Origin    string `json:"origin"`
+	SessionID string `json:"session_id,omitempty"`
+	StreamID  string `json:"stream_id,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Data      []byte `json:"data"`
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
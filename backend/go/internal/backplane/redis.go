@@ -0,0 +1,113 @@
+package backplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/neuronai/backend/go/internal/admin"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultChannel is the Redis channel shared by all gateway instances.
+const DefaultChannel = "neuronai:hub:sessions"
+
+// Redis is a Backplane over Redis pub/sub.
+type Redis struct {
+	client   *redis.Client
+	channel  string
+	instance string
+}
+
+// NewRedis connects to the Redis server at url, e.g. redis://:pass@host:6379/0.
+func NewRedis(url, channel string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	return &Redis{
+		client:   redis.NewClient(opts),
+		channel:  channel,
+		instance: newInstanceID(),
+	}, nil
+}
+
+// Check pings the Redis server.
+func (r *Redis) Check(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *Redis) Publish(ctx context.Context, sessionID, streamID, owner string, data []byte) error {
+	return r.publish(ctx, envelope{Origin: r.instance, SessionID: sessionID, StreamID: streamID, Owner: owner, Data: data})
+}
+
+func (r *Redis) PublishUser(ctx context.Context, userID string, data []byte) error {
+	return r.publish(ctx, envelope{Origin: r.instance, UserID: userID, Data: data})
+}
+
+func (r *Redis) PublishChannel(ctx context.Context, channel string, data []byte) error {
+	return r.publish(ctx, envelope{Origin: r.instance, Channel: channel, Data: data})
+}
+
+func (r *Redis) PublishInstance(ctx context.Context, instance string, data []byte) error {
+	return r.publish(ctx, envelope{Origin: r.instance, Instance: instance, Data: data})
+}
+
+func (r *Redis) Instance() string {
+	return r.instance
+}
+
+func (r *Redis) publish(ctx context.Context, env envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, payload).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, handler Handler) error {
+	sub := r.client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so no message published after
+	// Subscribe starts is missed.
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", r.channel, err)
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				slog.Warn("Dropping malformed backplane message", logging.Err(err))
+				continue
+			}
+			if env.Origin == r.instance || (env.Instance != "" && env.Instance != r.instance) {
+				continue
+			}
+			handler(Message{SessionID: env.SessionID, StreamID: env.StreamID, Owner: env.Owner, UserID: env.UserID, Channel: env.Channel, Instance: env.Instance, Data: env.Data})
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Backend reports the Redis server for runtime introspection, without the
+// credentials carried in the URL.
+func (r *Redis) Backend() admin.Backend {
+	return admin.Backend{Name: "backplane", Kind: "redis", Address: r.client.Options().Addr}
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,127 @@
+package backplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type received struct {
+	sessionID string
+	streamID  string
+	owner     string
+	userID    string
+	channel   string
+	instance  string
+	data      string
+}
+
+func subscribe(t *testing.T, ctx context.Context, mr *miniredis.Miniredis, r *Redis) <-chan received {
+	t.Helper()
+
+	ch := make(chan received, 8)
+	go r.Subscribe(ctx, func(msg Message) {
+		ch <- received{msg.SessionID, msg.StreamID, msg.Owner, msg.UserID, msg.Channel, msg.Instance, string(msg.Data)}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub(DefaultChannel)[DefaultChannel] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription was not established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ch
+}
+
+func TestRedis_FansOutToOtherInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewRedis("redis://"+mr.Addr(), DefaultChannel)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer a.Close()
+	b, err := NewRedis("redis://"+mr.Addr(), DefaultChannel)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	defer b.Close()
+
+	fromA := subscribe(t, ctx, mr, a)
+
+	if err := a.Publish(ctx, "s1", "", "u1", []byte("own")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := b.Publish(ctx, "s1", "c-1", "u1", []byte("remote")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case got := <-fromA:
+		if got.sessionID != "s1" || got.streamID != "c-1" || got.owner != "u1" || got.data != "remote" {
+			t.Errorf("expected remote message for s1, got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected message from other instance")
+	}
+
+	select {
+	case got := <-fromA:
+		t.Errorf("expected own message to be dropped, got %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := b.PublishUser(ctx, "u1", []byte("notice")); err != nil {
+		t.Fatalf("PublishUser() error = %v", err)
+	}
+
+	select {
+	case got := <-fromA:
+		if got.userID != "u1" || got.sessionID != "" || got.data != "notice" {
+			t.Errorf("expected notification for u1, got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected notification from other instance")
+	}
+
+	if err := b.PublishChannel(ctx, "project:1", []byte("feed")); err != nil {
+		t.Fatalf("PublishChannel() error = %v", err)
+	}
+
+	select {
+	case got := <-fromA:
+		if got.channel != "project:1" || got.sessionID != "" || got.data != "feed" {
+			t.Errorf("expected message for project:1, got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected channel message from other instance")
+	}
+
+	// Messages for another instance are dropped.
+	if err := b.PublishInstance(ctx, "elsewhere", []byte("stray")); err != nil {
+		t.Fatalf("PublishInstance() error = %v", err)
+	}
+	if err := b.PublishInstance(ctx, a.Instance(), []byte("direct")); err != nil {
+		t.Fatalf("PublishInstance() error = %v", err)
+	}
+
+	select {
+	case got := <-fromA:
+		if got.instance != a.Instance() || got.data != "direct" {
+			t.Errorf("expected message for this instance, got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected instance message from other instance")
+	}
+}
+
+func TestNewRedis_InvalidURL(t *testing.T) {
+	if _, err := NewRedis("not-a-url", DefaultChannel); err == nil {
+		t.Error("expected error for invalid URL")
+	}
+}
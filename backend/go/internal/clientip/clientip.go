@@ -0,0 +1,118 @@
+// Package clientip resolves the address of the client of a request once, at
+// the edge of the gateway, so rate limits, IP rules, abuse detection, the
+// login throttle and the audit log all agree on who the client is.
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Headers a proxy in front of the gateway may name the client in.
+const (
+	HeaderForwardedFor   = "X-Forwarded-For"
+	HeaderRealIP         = "X-Real-IP"
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+)
+
+// Headers lists the headers a Resolver can trust.
+var Headers = []string{HeaderForwardedFor, HeaderRealIP, HeaderCFConnectingIP}
+
+// Resolver resolves client addresses, believing the header it is given only
+// when the request comes through a trusted proxy.
+type Resolver struct {
+	header  string
+	trusted []netip.Prefix
+}
+
+// NewResolver reads client addresses from header, one of Headers, on
+// requests whose peer is in trustedProxies. Other requests are attributed
+// to their peer: a header set by anyone else can be forged.
+func NewResolver(header string, trustedProxies []netip.Prefix) *Resolver {
+	return &Resolver{header: http.CanonicalHeaderKey(header), trusted: trustedProxies}
+}
+
+// Resolve returns the client address of r. X-Forwarded-For is walked from
+// the nearest hop back, skipping trusted proxies, and the first other
+// address is the client; entries further left were supplied by the client
+// and cannot be trusted. X-Real-IP and CF-Connecting-IP hold the client
+// alone. It returns the zero Addr if the address cannot be parsed.
+func (res *Resolver) Resolve(r *http.Request) netip.Addr {
+	ip := parseAddr(r.RemoteAddr)
+	if !res.isTrusted(ip) {
+		return ip
+	}
+	if res.header != HeaderForwardedFor {
+		if v := strings.TrimSpace(r.Header.Get(res.header)); v != "" {
+			return parseAddr(v)
+		}
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values(HeaderForwardedFor), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = parseAddr(hop)
+		if !res.isTrusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// Middleware resolves the client address of each request for Addr and
+// String. Place it outside every handler that needs the address.
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), addrKey{}, res.Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (res *Resolver) isTrusted(ip netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type addrKey struct{}
+
+// Addr returns the client address of r resolved by Middleware or, on
+// requests it did not see, the peer address. It returns the zero Addr if
+// the address cannot be parsed.
+func Addr(r *http.Request) netip.Addr {
+	if ip, ok := r.Context().Value(addrKey{}).(netip.Addr); ok {
+		return ip
+	}
+	return parseAddr(r.RemoteAddr)
+}
+
+// String returns the client address of r as Addr does, or "" if it cannot
+// be parsed.
+func String(r *http.Request) string {
+	if ip := Addr(r); ip.IsValid() {
+		return ip.String()
+	}
+	return ""
+}
+
+// parseAddr parses an address with or without a port, unmapping IPv4 in
+// IPv6 so it matches IPv4 prefixes.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
@@ -0,0 +1,66 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"nearest untrusted hop", HeaderForwardedFor, "10.0.0.2:443", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.1"}, "198.51.100.7"},
+		{"forwarded from untrusted peer", HeaderForwardedFor, "203.0.113.5:443", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "203.0.113.5"},
+		{"only trusted hops", HeaderForwardedFor, "10.0.0.2:443", map[string]string{"X-Forwarded-For": "10.0.0.1"}, "10.0.0.1"},
+		{"real IP", HeaderRealIP, "10.0.0.2:443", map[string]string{"X-Real-IP": "198.51.100.7", "X-Forwarded-For": "1.1.1.1"}, "198.51.100.7"},
+		{"other header ignored", HeaderRealIP, "10.0.0.2:443", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "10.0.0.2"},
+		{"Cloudflare", "cf-connecting-ip", "10.0.0.2:443", map[string]string{"CF-Connecting-IP": "2001:db8::7"}, "2001:db8::7"},
+		{"Cloudflare from untrusted peer", HeaderCFConnectingIP, "203.0.113.5:443", map[string]string{"CF-Connecting-IP": "198.51.100.7"}, "203.0.113.5"},
+		{"IPv4-mapped peer", HeaderForwardedFor, "[::ffff:203.0.113.5]:443", nil, "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := NewResolver(tt.header, trusted).Resolve(req); got.String() != tt.want {
+				t.Errorf("Resolve() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_Middleware(t *testing.T) {
+	res := NewResolver(HeaderForwardedFor, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	var got string
+	handler := res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = String(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.7" {
+		t.Errorf("expected the resolved address, got %q", got)
+	}
+
+	// Without the middleware, the peer is the client.
+	if got := String(req); got != "10.0.0.2" {
+		t.Errorf("expected the peer address, got %q", got)
+	}
+	req.RemoteAddr = "@"
+	if got := String(req); got != "" {
+		t.Errorf("expected no address, got %q", got)
+	}
+}
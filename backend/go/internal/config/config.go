@@ -1,47 +1,981 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
-	"os"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/secrets"
 )
 
 type Config struct {
-	Port              int
-	PythonServiceAddr string
-	JWTSecret         string
-	Environment       string
-	MaxRequestSize    int64
+	Port           int    `env:"PORT" default:"8080"`
+	JWTSecret      string `env:"JWT_SECRET,secret"`
+	Environment    string
+	MaxRequestSize int64 `env:"MAX_REQUEST_SIZE,bytes" default:"10MB" check:"positive"`
+
+	// AIBackends are the AI services calls are routed to, by the agent
+	// they target and weight. PYTHON_SERVICE_ADDR alone sets a single one,
+	// named python.
+	AIBackends []AIBackend
+
+	// HTTPReadTimeout, HTTPWriteTimeout and HTTPIdleTimeout bound reading
+	// a request, writing its response and keeping an idle connection open;
+	// 0 is no limit. Streamed responses, SSE and gRPC-Web, get
+	// HTTPStreamTimeout instead of HTTPWriteTimeout. ShutdownTimeout is how
+	// long requests and WebSocket chats in flight may finish at shutdown.
+	HTTPReadTimeout   time.Duration `env:"HTTP_READ_TIMEOUT" default:"15s" check:"nonnegative"`
+	HTTPWriteTimeout  time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"15s" check:"nonnegative"`
+	HTTPIdleTimeout   time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"60s" check:"nonnegative"`
+	HTTPStreamTimeout time.Duration `env:"HTTP_STREAM_TIMEOUT" default:"10m" check:"nonnegative"`
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s" check:"positive"`
+
+	// TLSCertFile and TLSKeyFile serve HTTPS instead of plain HTTP. With
+	// TLSClientCAFile, client certificates signed by its CAs are verified
+	// as TLSClientAuth says, and those ClientCertsFile maps authenticate
+	// trusted services without a token.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+	// TLSCert and TLSKey are a PEM certificate chain and key to serve
+	// instead of TLSCertFile and TLSKeyFile, typically resolved from a
+	// secrets manager.
+	TLSCert string `env:"TLS_CERT,secret"`
+	TLSKey  string `env:"TLS_KEY,secret"`
+	// TLSAutocertHosts, instead, are the host names to obtain certificates
+	// for from Let's Encrypt, or the ACME server at
+	// TLSAutocertDirectoryURL, registering TLSAutocertEmail and caching
+	// them in TLSAutocertCacheDir.
+	TLSAutocertHosts        []string `env:"TLS_AUTOCERT_HOSTS"`
+	TLSAutocertEmail        string   `env:"TLS_AUTOCERT_EMAIL"`
+	TLSAutocertCacheDir     string   `env:"TLS_AUTOCERT_CACHE_DIR" default:"/var/lib/neuronai-gateway/autocert"`
+	TLSAutocertDirectoryURL string   `env:"TLS_AUTOCERT_DIRECTORY_URL"`
+	// HTTPRedirectAddr, if set, is the address of a plain HTTP listener
+	// redirecting to HTTPS and answering ACME HTTP-01 challenges.
+	HTTPRedirectAddr string `env:"HTTP_REDIRECT_ADDR"`
+	TLSClientCAFile  string `env:"TLS_CLIENT_CA_FILE"`
+	TLSClientAuth    ClientAuth
+	ClientCertsFile  string `env:"CLIENT_CERTS_FILE"`
+
+	// JWTPreviousSecrets still verify HS256 tokens after JWTSecret is
+	// rotated, until tokens signed with them have expired, or until
+	// JWTPreviousSecretsUntil if set.
+	JWTPreviousSecrets      []string `env:"JWT_PREVIOUS_SECRETS,secret"`
+	JWTPreviousSecretsUntil time.Time
+	// JWTPublicKeys maps key IDs to PEM files of RSA or P-256 EC public
+	// keys verifying RS256 and ES256 tokens, alongside any published at
+	// JWTJWKSURL, refetched every JWTJWKSRefresh.
+	JWTPublicKeys  map[string]string
+	JWTJWKSURL     string        `env:"JWT_JWKS_URL"`
+	JWTJWKSRefresh time.Duration `env:"JWT_JWKS_REFRESH" default:"1h"`
+	// JWTIssuer and JWTAudience, if set, must be the iss and among the aud
+	// of tokens other than the identity provider's; the gateway's own
+	// tokens carry them. JWTLeeway tolerates clock skew on exp and nbf, and
+	// JWTRequireNotBefore refuses tokens without nbf.
+	JWTIssuer           string        `env:"JWT_ISSUER"`
+	JWTAudience         string        `env:"JWT_AUDIENCE"`
+	JWTLeeway           time.Duration `env:"JWT_LEEWAY" default:"0s"`
+	JWTRequireNotBefore bool          `env:"JWT_REQUIRE_NBF" default:"false"`
+
+	// LogLevel and LogFormat configure the structured logger. The format
+	// defaults to JSON in production and text elsewhere.
+	LogLevel  slog.Level
+	LogFormat string `env:"LOG_FORMAT" default:"text"`
+
+	// CORSAllowedOrigins are the origins browsers may call the API from;
+	// none, or "*", allows any.
+	CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS"`
+
+	// ConfigWatchInterval is how often the config file is checked for
+	// changes to reload; 0 only reloads on SIGHUP.
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" default:"5s" check:"nonnegative"`
+
+	// SecretRefs are the secret references sensitive settings were
+	// resolved from, by environment variable. While there are any, the
+	// config is reloaded every SecretsRefreshInterval, unless it is 0, to
+	// pick up rotated secrets.
+	SecretRefs             map[string]string
+	SecretsRefreshInterval time.Duration `env:"SECRETS_REFRESH_INTERVAL" default:"5m" check:"nonnegative"`
+
+	// Redaction masks email addresses, tokens and the values of RedactKeys,
+	// in addition to the built-in sensitive keys, in logs and error
+	// responses. RedactStrict also masks IP addresses and card numbers and
+	// pseudonymizes user identifiers in logs, for regulated deployments.
+	Redaction    bool     `env:"REDACTION" default:"true"`
+	RedactKeys   []string `env:"REDACT_KEYS"`
+	RedactStrict bool     `env:"REDACT_STRICT" default:"false"`
+
+	ModerationWebhookURL   string        `env:"MODERATION_WEBHOOK_URL"`
+	ModerationDenylistFile string        `env:"MODERATION_DENYLIST_FILE"`
+	ModerationTimeout      time.Duration `env:"MODERATION_TIMEOUT" default:"2s" check:"positive"`
+
+	// AbuseDetection is off, shadow, which only logs decisions, or enforce.
+	// Chats are scored against the AbuseUserRate, AbuseIPRate, AbuseRepeats
+	// and AbuseMaxURLs thresholds, and by AbuseWebhookURL if set.
+	AbuseDetection  string        `env:"ABUSE_DETECTION" default:"off"`
+	AbuseWebhookURL string        `env:"ABUSE_WEBHOOK_URL"`
+	AbuseTimeout    time.Duration `env:"ABUSE_TIMEOUT" default:"1s" check:"positive"`
+	AbuseUserRate   int           `env:"ABUSE_USER_RATE" default:"60" check:"nonnegative"`
+	AbuseIPRate     int           `env:"ABUSE_IP_RATE" default:"120" check:"nonnegative"`
+	AbuseRepeats    int           `env:"ABUSE_REPEATS" default:"5" check:"nonnegative"`
+	AbuseMaxURLs    int           `env:"ABUSE_MAX_URLS" default:"20" check:"nonnegative"`
+
+	UploadStoreURL     string        `env:"UPLOAD_STORE_URL"`
+	UploadStoreTimeout time.Duration `env:"UPLOAD_STORE_TIMEOUT" default:"2s" check:"positive"`
+
+	// SessionSerialize queues concurrent sends within a session instead of
+	// forwarding them in parallel.
+	SessionSerialize bool `env:"SESSION_SERIALIZE" default:"false"`
+
+	// ResponseCacheSize enables keeping that many recent responses per session
+	// for regenerate/undo.
+	ResponseCacheSize int           `env:"RESPONSE_CACHE_SIZE" default:"0" check:"nonnegative"`
+	ResponseCacheTTL  time.Duration `env:"RESPONSE_CACHE_TTL" default:"15m"`
+
+	// WSReplayBufferSize enables WebSocket resume, keeping that many recent
+	// messages per session for reconnecting clients.
+	WSReplayBufferSize int           `env:"WS_REPLAY_BUFFER" default:"0" check:"nonnegative"`
+	WSReplayTTL        time.Duration `env:"WS_REPLAY_TTL" default:"2m"`
+
+	// WSPresence sends envelope clients presence and agent activity events
+	// for their session.
+	WSPresence bool `env:"WS_PRESENCE" default:"false"`
+
+	// WSMessageRate and WSMessageBurst throttle the messages of each
+	// WebSocket connection; WSMaxStreams caps its chats in flight. Zero
+	// disables the limit.
+	WSMessageRate  float64 `env:"WS_MESSAGE_RATE" default:"5" check:"nonnegative"`
+	WSMessageBurst int     `env:"WS_MESSAGE_BURST" default:"10" check:"nonnegative"`
+	WSMaxStreams   int     `env:"WS_MAX_STREAMS" default:"4" check:"nonnegative"`
+
+	// WSLagGrace is how long a WebSocket client whose send buffer filled up
+	// may lag, receiving coalesced partial messages, before it is
+	// disconnected. Zero disconnects it at once.
+	WSLagGrace time.Duration `env:"WS_LAG_GRACE" default:"10s"`
+
+	// WSMaxConnectionsPerUser and WSMaxConnections cap the concurrent
+	// WebSocket connections of each user and of this instance. Zero disables
+	// the cap.
+	WSMaxConnectionsPerUser int `env:"WS_MAX_CONNECTIONS_PER_USER" default:"10" check:"nonnegative"`
+	WSMaxConnections        int `env:"WS_MAX_CONNECTIONS" default:"0" check:"nonnegative"`
+
+	// WSHubShards is the number of shards the WebSocket hub splits its
+	// connections across by session.
+	WSHubShards int `env:"WS_HUB_SHARDS" default:"16" check:"positive"`
+
+	// WSStatsInterval is how often v1 and v2 WebSocket clients receive a
+	// stats frame with their round-trip time. Zero disables stats frames.
+	WSStatsInterval time.Duration `env:"WS_STATS_INTERVAL" default:"0" check:"nonnegative"`
+
+	// WSWriteWait, WSPongWait and WSPingPeriod time each WebSocket
+	// connection: a write that takes longer than WSWriteWait, or a connection
+	// without a pong for WSPongWait, is closed. WSPingPeriod must be below
+	// WSPongWait.
+	WSWriteWait  time.Duration `env:"WS_WRITE_WAIT" default:"10s" check:"positive"`
+	WSPongWait   time.Duration `env:"WS_PONG_WAIT" default:"60s" check:"positive"`
+	WSPingPeriod time.Duration
+
+	// WSReadBufferSize and WSWriteBufferSize size each WebSocket
+	// connection's I/O buffers in bytes; WSSendBufferSize is how many
+	// messages may queue for it before backpressure applies.
+	WSReadBufferSize  int `env:"WS_READ_BUFFER_SIZE,bytes" default:"1KB" check:"positive"`
+	WSWriteBufferSize int `env:"WS_WRITE_BUFFER_SIZE,bytes" default:"1KB" check:"positive"`
+	WSSendBufferSize  int `env:"WS_SEND_BUFFER_SIZE" default:"256" check:"positive"`
+	// WSMaxMessageSize is the largest message a WebSocket client may send,
+	// in bytes; MaxRequestSize bounds HTTP request bodies.
+	WSMaxMessageSize int64 `env:"WS_MAX_MESSAGE_SIZE,bytes" default:"512KB" check:"positive"`
+	// WSCompression negotiates permessage-deflate with clients that offer
+	// it, compressing messages of at least WSCompressionMinSize bytes at
+	// flate level WSCompressionLevel.
+	WSCompression        bool `env:"WS_COMPRESSION" default:"false"`
+	WSCompressionLevel   int  `env:"WS_COMPRESSION_LEVEL" default:"1"`
+	WSCompressionMinSize int  `env:"WS_COMPRESSION_MIN_SIZE,bytes" default:"256" check:"nonnegative"`
+
+	// WSLimitStore persists WebSocket message buckets across restarts: a
+	// redis:// URL shared by all replicas, or a snapshot file path.
+	WSLimitStore           string        `env:"WS_LIMIT_STORE,secret"`
+	WSLimitPersistInterval time.Duration `env:"WS_LIMIT_PERSIST_INTERVAL" default:"10s"`
+
+	// UpstreamLoadURL enables admission control fed by the Python service's
+	// load endpoint.
+	UpstreamLoadURL       string        `env:"UPSTREAM_LOAD_URL"`
+	AdmissionPollInterval time.Duration `env:"ADMISSION_POLL_INTERVAL" default:"1s"`
+	AdmissionSoftLimit    float64       `env:"ADMISSION_SOFT_LIMIT" default:"0.8"`
+	AdmissionHardLimit    float64       `env:"ADMISSION_HARD_LIMIT" default:"1.0"`
+	AdmissionMode         string        `env:"ADMISSION_MODE" default:"queue"`
+	AdmissionMaxWait      time.Duration `env:"ADMISSION_MAX_WAIT" default:"5s"`
+
+	// SchedulerCapacity enables priority scheduling of calls to the Python
+	// service: beyond this many in flight, calls queue and are let through
+	// in proportion to their plan's weight in SchedulerWeights, for at most
+	// SchedulerMaxWait.
+	SchedulerCapacity int `env:"SCHEDULER_CAPACITY" default:"0" check:"nonnegative"`
+	SchedulerWeights  map[string]int
+	SchedulerMaxWait  time.Duration `env:"SCHEDULER_MAX_WAIT" default:"10s" check:"positive"`
+
+	// PreauthWebhookURL enables pre-authorization of expensive requests by the
+	// billing service.
+	PreauthWebhookURL string        `env:"PREAUTH_WEBHOOK_URL"`
+	PreauthTimeout    time.Duration `env:"PREAUTH_TIMEOUT" default:"2s" check:"positive"`
+	PreauthMaxHold    time.Duration `env:"PREAUTH_MAX_HOLD" default:"30s" check:"positive"`
+
+	// APIKeysFile lists the hashed API keys server-to-server callers may
+	// authenticate with instead of a JWT.
+	APIKeysFile string `env:"API_KEYS_FILE"`
+	// APIKeysRedisURL enables API keys users manage themselves at
+	// /api/v1/keys. Keys live at most APIKeysMaxTTL, make at most
+	// APIKeysRateLimit requests per minute, and each user may have
+	// APIKeysMaxPerUser of them. Lookups are cached for APIKeysCacheTTL.
+	APIKeysRedisURL   string        `env:"API_KEYS_REDIS_URL,secret"`
+	APIKeysMaxTTL     time.Duration `env:"API_KEYS_MAX_TTL" default:"8760h" check:"positive"`
+	APIKeysRateLimit  int           `env:"API_KEYS_RATE_LIMIT" default:"60" check:"positive"`
+	APIKeysMaxPerUser int           `env:"API_KEYS_MAX_PER_USER" default:"10" check:"positive"`
+	APIKeysCacheTTL   time.Duration `env:"API_KEYS_CACHE_TTL" default:"5s"`
+	// SigningKeysFile lists the shared secrets machine clients may sign
+	// their requests with instead of presenting a token. Signatures are
+	// accepted within SignatureMaxSkew of the gateway's clock.
+	SigningKeysFile  string        `env:"SIGNING_KEYS_FILE"`
+	SignatureMaxSkew time.Duration `env:"SIGNATURE_MAX_SKEW" default:"5m" check:"positive"`
+
+	// AuthUsersFile lists the accounts the gateway issues its own tokens to,
+	// at /api/v1/auth/token and /api/v1/auth/refresh.
+	AuthUsersFile       string        `env:"AUTH_USERS_FILE"`
+	AuthAccessTokenTTL  time.Duration `env:"AUTH_ACCESS_TOKEN_TTL" default:"15m" check:"positive"`
+	AuthRefreshTokenTTL time.Duration `env:"AUTH_REFRESH_TOKEN_TTL" default:"720h"`
+	// SessionCookies also logs AUTH_USERS_FILE accounts in to browsers with
+	// an HttpOnly session cookie, at /api/v1/auth/session. Sessions end
+	// after SessionIdleTimeout without a request or SessionMaxAge after
+	// login.
+	SessionCookies        bool          `env:"SESSION_COOKIES" default:"false"`
+	SessionIdleTimeout    time.Duration `env:"SESSION_IDLE_TIMEOUT" default:"30m" check:"positive"`
+	SessionMaxAge         time.Duration `env:"SESSION_MAX_AGE" default:"12h" check:"positive"`
+	SessionCookieSameSite SameSite
+	SessionCookieSecure   bool `env:"SESSION_COOKIE_SECURE" default:"true"`
+
+	// LoginThrottle slows down repeated failed logins to AUTH_USERS_FILE
+	// accounts. After LoginFreeAttempts failures an account must wait
+	// LoginDelay before its next attempt, doubling per failure up to
+	// LoginMaxDelay. An account failing LoginLockoutThreshold times, or a
+	// client IP failing LoginIPLockoutThreshold times across accounts, is
+	// locked out for LoginLockout. Failures are forgotten after
+	// LoginFailureWindow without another.
+	LoginThrottle           bool          `env:"LOGIN_THROTTLE" default:"true"`
+	LoginFreeAttempts       int           `env:"LOGIN_FREE_ATTEMPTS" default:"3" check:"nonnegative"`
+	LoginDelay              time.Duration `env:"LOGIN_DELAY" default:"1s" check:"nonnegative"`
+	LoginMaxDelay           time.Duration `env:"LOGIN_MAX_DELAY" default:"30s"`
+	LoginLockoutThreshold   int           `env:"LOGIN_LOCKOUT_THRESHOLD" default:"10" check:"nonnegative"`
+	LoginIPLockoutThreshold int           `env:"LOGIN_IP_LOCKOUT_THRESHOLD" default:"100" check:"nonnegative"`
+	LoginLockout            time.Duration `env:"LOGIN_LOCKOUT" default:"15m" check:"positive"`
+	LoginFailureWindow      time.Duration `env:"LOGIN_FAILURE_WINDOW" default:"15m" check:"positive"`
+
+	// GuestAccess issues anonymous callers guest tokens, valid for
+	// GuestTokenTTL, at /api/v1/auth/guest. Guests may only use
+	// GuestRoutes, at GuestRateLimit per client IP, and their usage is
+	// charged to the GuestTenant quota. Logging in with a guest token hands
+	// the guest's sessions to the user.
+	GuestAccess    bool          `env:"GUEST_ACCESS" default:"false"`
+	GuestTokenTTL  time.Duration `env:"GUEST_TOKEN_TTL" default:"1h" check:"positive"`
+	GuestRoutes    []string      `env:"GUEST_ROUTES" default:"/api/v1/chat,/api/v1/chat/stream,/ws"`
+	GuestRateLimit RouteLimit
+	GuestTenant    string `env:"GUEST_TENANT" default:"guest"`
+
+	// OIDCIssuer enables tokens signed by an external identity provider,
+	// validated against its JWKS, alongside the shared-secret tokens.
+	OIDCIssuer      string        `env:"OIDC_ISSUER"`
+	OIDCAudience    string        `env:"OIDC_AUDIENCE"`
+	OIDCJWKSURL     string        `env:"OIDC_JWKS_URL"`
+	OIDCJWKSRefresh time.Duration `env:"OIDC_JWKS_REFRESH" default:"1h"`
+
+	// RevocationRedisURL enables the token revocation list, checked on every
+	// authentication and managed at /admin/revocations. Revocations are kept
+	// for RevocationTTL, and lookups cached for RevocationCacheTTL.
+	RevocationRedisURL string        `env:"REVOCATION_REDIS_URL,secret"`
+	RevocationTTL      time.Duration `env:"REVOCATION_TTL" default:"24h" check:"positive"`
+	RevocationCacheTTL time.Duration `env:"REVOCATION_CACHE_TTL" default:"5s"`
+
+	// UserServiceURL enables claims enrichment: the tenant, plan and scopes
+	// of each token's user are fetched from <UserServiceURL>/<user_id>, and
+	// disabled users refused. Lookups are cached for UserServiceCacheTTL.
+	UserServiceURL      string        `env:"USER_SERVICE_URL"`
+	UserServiceCacheTTL time.Duration `env:"USER_SERVICE_CACHE_TTL" default:"1m"`
+
+	// WSTicketTTL is how long the single-use WebSocket tickets issued at
+	// /api/v1/ws/ticket may be redeemed. Zero disables tickets.
+	WSTicketTTL time.Duration `env:"WS_TICKET_TTL" default:"30s" check:"nonnegative"`
+
+	// AdminToken enables the /admin endpoints for callers presenting it.
+	AdminToken string `env:"ADMIN_TOKEN,secret"`
+	// AdminRole enables the /admin endpoints for users granted it.
+	AdminRole string `env:"ADMIN_ROLE"`
+	// SwarmRole restricts swarm tasks to users granted it.
+	SwarmRole string `env:"SWARM_ROLE"`
+
+	// NotifyToken enables the internal user notification endpoint for
+	// services presenting it.
+	NotifyToken string `env:"NOTIFY_TOKEN,secret"`
+
+	// BootReportPath is where the JSON boot report is written at startup.
+	BootReportPath string `env:"BOOT_REPORT_PATH" default:"/tmp/neuronai-gateway/boot-report.json"`
+
+	// GRPCWeb serves AIService to browser grpc-web clients.
+	GRPCWeb bool `env:"GRPC_WEB" default:"false"`
+	// GRPCInsecure connects to the AI backends in plain text rather than
+	// over TLS verified against GRPCCAFile, or the system roots without
+	// it, unless a backend says otherwise. Only development defaults to it.
+	GRPCInsecure bool   `env:"GRPC_INSECURE" default:"false"`
+	GRPCCAFile   string `env:"GRPC_CA_FILE"`
+	// GRPCPoolSize is the number of connections kept open to each AI
+	// backend. GRPCMaxStreams caps the streams open to the backends, and
+	// UserMaxConcurrentRequests the chats and streams each user has in
+	// flight; zero disables the cap.
+	GRPCPoolSize              int `env:"GRPC_POOL_SIZE" default:"2" check:"positive"`
+	GRPCMaxStreams            int `env:"GRPC_MAX_STREAMS" default:"0" check:"nonnegative"`
+	UserMaxConcurrentRequests int `env:"USER_MAX_CONCURRENT_REQUESTS" default:"0" check:"nonnegative"`
+
+	// BackplaneRedisURL enables fanning session messages across gateway
+	// replicas over Redis pub/sub.
+	BackplaneRedisURL     string `env:"BACKPLANE_REDIS_URL,secret"`
+	BackplaneRedisChannel string `env:"BACKPLANE_REDIS_CHANNEL" default:"neuronai:hub:sessions"`
+
+	// RateLimit limits the API requests of each user, or of each IP for
+	// anonymous requests; RateLimitRoutes overrides it by route pattern.
+	RateLimit       RouteLimit
+	RateLimitRoutes map[string]RouteLimit
+
+	// IPAllow and IPDeny admit and refuse client addresses on every route;
+	// IPRouteAllow and IPRouteDeny add rules for the paths under a prefix.
+	IPAllow      []netip.Prefix
+	IPDeny       []netip.Prefix
+	IPRouteAllow map[string][]netip.Prefix
+	IPRouteDeny  map[string][]netip.Prefix
+	// Client addresses, for rate limits, IP rules, abuse detection, the
+	// login throttle and audit events, are read from ClientIPHeader only on
+	// requests from one of TrustedProxies, and are otherwise the peer's.
+	TrustedProxies []netip.Prefix
+	ClientIPHeader string
+
+	// CSRFProtection requires unsafe requests carrying cookies to echo the
+	// CSRF cookie, set with CSRFSameSite and, if CSRFCookieSecure, Secure.
+	CSRFProtection   bool `env:"CSRF_PROTECTION" default:"false"`
+	CSRFSameSite     SameSite
+	CSRFCookieSecure bool `env:"CSRF_COOKIE_SECURE" default:"true"`
+
+	// TenantQuotas meters the requests and estimated model tokens of each
+	// tenant, named by the tenant_id claim or else the TenantHeader header,
+	// in windows of QuotaWindow. Tenants get QuotaRequests requests and
+	// QuotaTokens tokens a window, 0 meaning unlimited, unless overridden at
+	// /admin/quotas; overrides persist to QuotaLimitsFile if set.
+	TenantQuotas    bool          `env:"TENANT_QUOTAS" default:"false"`
+	TenantHeader    string        `env:"TENANT_HEADER"`
+	QuotaWindow     time.Duration `env:"QUOTA_WINDOW" default:"24h" check:"positive"`
+	QuotaRequests   int64         `env:"QUOTA_REQUESTS" default:"0" check:"nonnegative"`
+	QuotaTokens     int64         `env:"QUOTA_TOKENS" default:"0" check:"nonnegative"`
+	QuotaLimitsFile string        `env:"QUOTA_LIMITS_FILE"`
+
+	// MaintenanceMode starts the gateway in maintenance, refusing new chats
+	// with MaintenanceMessage and a Retry-After of MaintenanceRetryAfter
+	// until an operator ends it at /admin/maintenance. MaintenanceReadOnly
+	// starts it read-only instead, refusing requests changing data too.
+	// While MaintenanceFile exists the gateway is in maintenance too.
+	MaintenanceMode       bool          `env:"MAINTENANCE_MODE" default:"false"`
+	MaintenanceMessage    string        `env:"MAINTENANCE_MESSAGE"`
+	MaintenanceReadOnly   bool          `env:"MAINTENANCE_READ_ONLY" default:"false"`
+	MaintenanceRetryAfter time.Duration `env:"MAINTENANCE_RETRY_AFTER" default:"5m" check:"positive"`
+	MaintenanceFile       string        `env:"MAINTENANCE_FILE"`
+
+	// RemoteConfig, etcd or consul, reads dynamic settings, named by
+	// environment variable, from the keys under RemoteConfigPrefix in that
+	// store at RemoteConfigEndpoints, and watches them so every replica
+	// applies changes within seconds. They take precedence over the
+	// environment and the config file. RemoteConfigToken, a Consul ACL
+	// token or an etcd auth token, authenticates to the store.
+	RemoteConfig          string   `env:"REMOTE_CONFIG"`
+	RemoteConfigEndpoints []string `env:"REMOTE_CONFIG_ENDPOINTS"`
+	RemoteConfigPrefix    string   `env:"REMOTE_CONFIG_PREFIX" default:"neuronai/gateway/"`
+	RemoteConfigToken     string   `env:"REMOTE_CONFIG_TOKEN,secret"`
+
+	// AuditLog enables audit events, written as JSON lines to "stdout",
+	// "stderr" or a file path, posted to an http(s):// collector, or
+	// produced to a kafka+http(s):// Kafka REST proxy topic URL.
+	AuditLog string `env:"AUDIT_LOG"`
+	// AuditRecentSize is how many audit events GET /admin/audit can
+	// return; 0 disables the endpoint.
+	AuditRecentSize int `env:"AUDIT_RECENT_SIZE" default:"1000" check:"nonnegative"`
+}
+
+// RouteLimit allows PerMinute requests a minute in bursts of up to Burst
+// to each client, as identified by Key. A zero PerMinute disables the
+// limit.
+type RouteLimit struct {
+	PerMinute float64
+	Burst     int
+	// Key is LimitKeyUser, LimitKeyIP or LimitKeyAPIKey.
+	Key string
+}
+
+// Clients a RouteLimit keys on: the user ID, or the client IP for anonymous
+// requests; the client IP alone; or the API key, or the user ID or client IP
+// for requests without one.
+const (
+	LimitKeyUser   = "user"
+	LimitKeyIP     = "ip"
+	LimitKeyAPIKey = "apikey"
+)
+
+func (l RouteLimit) String() string {
+	if l.PerMinute <= 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%g/min burst %d by %s", l.PerMinute, l.Burst, l.Key)
+}
+
+// AIBackend is an AI service calls are routed to.
+type AIBackend struct {
+	Name string
+	Addr string
+	// TLS connects to the backend over TLS rather than in plain text. It
+	// defaults to the opposite of GRPC_INSECURE.
+	TLS bool
+	// Agents are the agents the backend serves, by JSON name such as
+	// "code". A backend without agents serves calls for any agent.
+	Agents []string
+	// Weight is the backend's share of the calls it can serve, relative
+	// to the other backends that can.
+	Weight int
+}
+
+// String formats b as AI_BACKENDS spells it.
+func (b AIBackend) String() string {
+	s := fmt.Sprintf("%s=%s;tls=%t;weight=%d", b.Name, b.Addr, b.TLS, b.Weight)
+	if len(b.Agents) > 0 {
+		s += ";agents=" + strings.Join(b.Agents, "|")
+	}
+	return s
+}
+
+// Remote config stores.
+const (
+	RemoteEtcd   = "etcd"
+	RemoteConsul = "consul"
+)
+
+// TLSEnabled reports whether the gateway serves HTTPS, with a certificate
+// from files, from TLSCert or from an ACME server.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSCert != "" || len(c.TLSAutocertHosts) > 0
+}
+
+// RouteRateLimit returns the rate limit of the route registered as pattern.
+func (c *Config) RouteRateLimit(pattern string) RouteLimit {
+	if l, ok := c.RateLimitRoutes[pattern]; ok {
+		return l
+	}
+	return c.RateLimit
+}
+
+// SameSite is a cookie SameSite attribute, reported by name.
+type SameSite http.SameSite
+
+var sameSiteNames = map[SameSite]string{
+	SameSite(http.SameSiteLaxMode):    "lax",
+	SameSite(http.SameSiteStrictMode): "strict",
+	SameSite(http.SameSiteNoneMode):   "none",
+}
+
+func (s SameSite) String() string {
+	return sameSiteNames[s]
+}
+
+// ClientAuth is the client certificate policy of the HTTPS listener,
+// reported by name.
+type ClientAuth tls.ClientAuthType
+
+var clientAuthNames = map[ClientAuth]string{
+	ClientAuth(tls.NoClientCert):               "none",
+	ClientAuth(tls.VerifyClientCertIfGiven):    "optional",
+	ClientAuth(tls.RequireAndVerifyClientCert): "require",
+}
+
+func (a ClientAuth) String() string {
+	return clientAuthNames[a]
 }
 
+// parseClientAuth parses a client certificate policy: none, optional
+// (verified if presented) or require.
+func parseClientAuth(s string) (ClientAuth, error) {
+	for policy, name := range clientAuthNames {
+		if strings.EqualFold(s, name) {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("must be none, optional or require")
+}
+
+// parseSameSite parses a cookie SameSite attribute: lax, strict or none.
+func parseSameSite(s string) (SameSite, error) {
+	for mode, name := range sameSiteNames {
+		if strings.EqualFold(s, name) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("must be lax, strict or none")
+}
+
+// parseClientIPHeader parses the header trusted proxies name the client in,
+// in any case.
+func parseClientIPHeader(s string) (string, error) {
+	for _, name := range clientip.Headers {
+		if strings.EqualFold(s, name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("must be %s", strings.Join(clientip.Headers, ", "))
+}
+
+// parseTime parses an RFC 3339 time such as 2024-07-01T00:00:00Z; empty is
+// the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseRouteLimit parses a requests per minute count, optionally followed by
+// a colon and a burst, which defaults to a minute's requests, and by
+// ";key=" and the client the limit is kept for, user by default.
+func parseRouteLimit(s string) (RouteLimit, error) {
+	s, option, hasOption := strings.Cut(strings.TrimSpace(s), ";")
+	l := RouteLimit{Key: LimitKeyUser}
+	if hasOption {
+		name, key, _ := strings.Cut(option, "=")
+		if strings.TrimSpace(name) != "key" {
+			return RouteLimit{}, fmt.Errorf("unknown option %q", option)
+		}
+		l.Key = strings.ToLower(strings.TrimSpace(key))
+		if !slices.Contains([]string{LimitKeyUser, LimitKeyIP, LimitKeyAPIKey}, l.Key) {
+			return RouteLimit{}, fmt.Errorf("key must be user, ip or apikey")
+		}
+	}
+	perMinute, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	var err error
+	if l.PerMinute, err = strconv.ParseFloat(perMinute, 64); err != nil {
+		return RouteLimit{}, err
+	}
+	if l.PerMinute < 0 {
+		return RouteLimit{}, fmt.Errorf("requests per minute must not be negative")
+	}
+	l.Burst = int(math.Ceil(l.PerMinute))
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil {
+			return RouteLimit{}, err
+		}
+		if l.Burst < 1 {
+			return RouteLimit{}, fmt.Errorf("burst must be positive")
+		}
+	}
+	return l, nil
+}
+
+// parseRouteLimits parses comma-separated pattern=limit pairs, each limit as
+// parseRouteLimit accepts.
+func parseRouteLimits(s string) (map[string]RouteLimit, error) {
+	limits := make(map[string]RouteLimit)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		pattern, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected pattern=limit, got %q", pair)
+		}
+		l, err := parseRouteLimit(limit)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", strings.TrimSpace(pattern), err)
+		}
+		limits[strings.TrimSpace(pattern)] = l
+	}
+	return limits, nil
+}
+
+// parseWeights parses comma-separated plan=weight pairs, for the free, pro
+// and internal plans.
+func parseWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		plan, weight, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected plan=weight, got %q", pair)
+		}
+		plan = strings.TrimSpace(plan)
+		switch plan {
+		case "free", "pro", "internal":
+		default:
+			return nil, fmt.Errorf("unknown plan %q", plan)
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("plan %s: weight must be a positive integer", plan)
+		}
+		weights[plan] = w
+	}
+	return weights, nil
+}
+
+// parseKeyFiles parses comma-separated kid=path pairs.
+func parseKeyFiles(s string) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(kid) == "" || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("expected kid=path, got %q", pair)
+		}
+		files[strings.TrimSpace(kid)] = strings.TrimSpace(path)
+	}
+	return files, nil
+}
+
+// parseCIDRs parses a list of CIDRs or single addresses separated by sep.
+func parseCIDRs(s, sep string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, sep) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// commaCIDRs parses a comma-separated list of CIDRs or single addresses.
+func commaCIDRs(s string) ([]netip.Prefix, error) {
+	return parseCIDRs(s, ",")
+}
+
+// parseRouteCIDRs parses comma-separated prefix=cidrs pairs, the CIDRs
+// separated by "|".
+func parseRouteCIDRs(s string) (map[string][]netip.Prefix, error) {
+	routes := make(map[string][]netip.Prefix)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		prefix, cidrs, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(prefix) == "" {
+			return nil, fmt.Errorf("expected prefix=cidrs, got %q", pair)
+		}
+		parsed, err := parseCIDRs(cidrs, "|")
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", strings.TrimSpace(prefix), err)
+		}
+		routes[strings.TrimSpace(prefix)] = append(routes[strings.TrimSpace(prefix)], parsed...)
+	}
+	return routes, nil
+}
+
+// parseBackends parses comma-separated name=addr backends, each optionally
+// followed by ;-separated options: tls=true or false, weight=N and
+// agents=code|writer. Backends use TLS by default unless tls is false.
+func parseBackends(s string, tls bool) ([]AIBackend, error) {
+	var backends []AIBackend
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		fields := strings.Split(item, ";")
+		name, addr, ok := strings.Cut(fields[0], "=")
+		b := AIBackend{Name: strings.TrimSpace(name), Addr: strings.TrimSpace(addr), TLS: tls, Weight: 1}
+		if !ok || b.Name == "" || b.Addr == "" {
+			return nil, fmt.Errorf("expected name=addr, got %q", fields[0])
+		}
+		if slices.ContainsFunc(backends, func(other AIBackend) bool { return other.Name == b.Name }) {
+			return nil, fmt.Errorf("backend %s is defined twice", b.Name)
+		}
+		for _, option := range fields[1:] {
+			key, value, _ := strings.Cut(option, "=")
+			value = strings.TrimSpace(value)
+			var err error
+			switch strings.TrimSpace(key) {
+			case "tls":
+				b.TLS, err = strconv.ParseBool(value)
+			case "weight":
+				b.Weight, err = strconv.Atoi(value)
+				if err == nil && b.Weight <= 0 {
+					err = fmt.Errorf("weight must be positive")
+				}
+			case "agents":
+				for _, agent := range strings.Split(value, "|") {
+					agent = strings.ToLower(strings.TrimSpace(agent))
+					if _, known := pb.AgentType_value["AGENT_TYPE_"+strings.ToUpper(agent)]; !known || agent == "unspecified" {
+						return nil, fmt.Errorf("backend %s: unknown agent %q", b.Name, agent)
+					}
+					b.Agents = append(b.Agents, agent)
+				}
+			default:
+				err = fmt.Errorf("unknown option %q", option)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("backend %s: %w", b.Name, err)
+			}
+		}
+		backends = append(backends, b)
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no backends")
+	}
+	return backends, nil
+}
+
+// splitList parses a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Load reads the config from the environment and the config file named by
+// CONFIG_FILE, if set; see LoadFile.
 func Load() (*Config, error) {
-	port, err := strconv.Atoi(getEnv("PORT", "8080"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid PORT: %w", err)
+	return LoadFile(Env("CONFIG_FILE"))
+}
+
+// LoadOption configures how LoadFile reads the config.
+type LoadOption func(*source)
+
+// WithOverrides sets settings, by environment variable, over both the
+// environment and the config file, as command-line flags do.
+func WithOverrides(values map[string]string) LoadOption {
+	return func(s *source) {
+		s.overrides = values
 	}
+}
 
-	maxSize, err := strconv.ParseInt(getEnv("MAX_REQUEST_SIZE", "10485760"), 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid MAX_REQUEST_SIZE: %w", err)
+// WithRemote sets settings, by environment variable, read from the remote
+// config store. They take precedence over the environment and the config
+// file, but not over WithOverrides. Only the settings a reload applies may
+// be set remotely; others are errors.
+func WithRemote(values map[string]string) LoadOption {
+	return func(s *source) {
+		s.remote = values
 	}
+}
 
-	jwtSecret := getEnv("JWT_SECRET", "")
-	if jwtSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET is required")
+// WithDefaults replaces the built-in defaults of settings, by environment
+// variable; the environment and the config file still take precedence.
+func WithDefaults(values map[string]string) LoadOption {
+	return func(s *source) {
+		s.defaults = values
 	}
+}
 
-	return &Config{
-		Port:              port,
-		PythonServiceAddr: getEnv("PYTHON_SERVICE_ADDR", "localhost:50051"),
-		JWTSecret:         jwtSecret,
-		Environment:       getEnv("ENVIRONMENT", "development"),
-		MaxRequestSize:    maxSize,
-	}, nil
+// LoadFile reads the config from the environment and, unless path is empty,
+// the YAML or JSON config file at path and the profile of the environment
+// beside it, such as gateway.production.yaml for gateway.yaml. Environment
+// variables take precedence over the profile, the profile over the file,
+// and the file over the defaults of the environment and the built-in ones.
+func LoadFile(path string, opts ...LoadOption) (*Config, error) {
+	src := &source{}
+	if path != "" {
+		var err error
+		if src, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	src.secrets = secrets.FromEnv()
+	for _, opt := range opts {
+		opt(src)
+	}
+	if path != "" {
+		environment := src.get("ENVIRONMENT", defaultEnvironment)
+		if err := src.overlay(profilePath(path, environment)); err != nil {
+			return nil, err
+		}
+	}
+	return load(src)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// load reads the config from src. It checks every setting before it
+// fails, and the error lists all the problems found.
+func load(src *source) (*Config, error) {
+	p := newParser(src)
+	// The environment comes first: it selects the defaults of the rest.
+	environment := p.get("ENVIRONMENT", defaultEnvironment)
+	src.environment = environment
+	checkProfile(p, environment)
+	for _, key := range sortedKeys(src.remote) {
+		if !remoteSettings[key] {
+			p.reject(key, fmt.Errorf("%s cannot be set in the remote config store; only settings a reload applies can", key))
+		}
+	}
+
+	cfg := &Config{Environment: environment}
+	decode(p, cfg)
+
+	p.require(cfg.Port >= 1 && cfg.Port <= 65535, "PORT must be between 1 and 65535", "PORT")
+
+	cfg.LogLevel = parse(p, "LOG_LEVEL", "info", logging.ParseLevel)
+	p.require(cfg.LogFormat == logging.FormatJSON || cfg.LogFormat == logging.FormatText,
+		fmt.Sprintf("invalid LOG_FORMAT: must be %s or %s", logging.FormatJSON, logging.FormatText))
+
+	p.require(cfg.HTTPStreamTimeout == 0 || cfg.HTTPWriteTimeout == 0 || cfg.HTTPStreamTimeout >= cfg.HTTPWriteTimeout,
+		"HTTP_STREAM_TIMEOUT must be at least HTTP_WRITE_TIMEOUT", "HTTP_STREAM_TIMEOUT", "HTTP_WRITE_TIMEOUT")
+
+	p.require(!cfg.RedactStrict || cfg.Redaction, "REDACT_STRICT requires REDACTION")
+
+	p.require(cfg.AbuseDetection == "off" || cfg.AbuseDetection == "shadow" || cfg.AbuseDetection == "enforce",
+		fmt.Sprintf("invalid ABUSE_DETECTION: %q", cfg.AbuseDetection))
+
+	cfg.WSPingPeriod = p.duration("WS_PING_PERIOD", (cfg.WSPongWait * 9 / 10).String())
+	// The default follows WS_PONG_WAIT, so its problems are WS_PONG_WAIT's.
+	p.require(cfg.WSPingPeriod > 0, "WS_PING_PERIOD must be positive", "WS_PING_PERIOD", "WS_PONG_WAIT")
+	p.require(cfg.WSPingPeriod < cfg.WSPongWait, "WS_PING_PERIOD must be below WS_PONG_WAIT", "WS_PING_PERIOD", "WS_PONG_WAIT")
+	p.require(cfg.WSCompressionLevel >= -2 && cfg.WSCompressionLevel <= 9,
+		"WS_COMPRESSION_LEVEL must be between -2 and 9", "WS_COMPRESSION_LEVEL")
+
+	p.require(cfg.AdmissionHardLimit >= cfg.AdmissionSoftLimit, "ADMISSION_HARD_LIMIT must not be below ADMISSION_SOFT_LIMIT",
+		"ADMISSION_HARD_LIMIT", "ADMISSION_SOFT_LIMIT")
+	p.require(cfg.AdmissionMode == "queue" || cfg.AdmissionMode == "downgrade", fmt.Sprintf("invalid ADMISSION_MODE: %q", cfg.AdmissionMode))
+	cfg.SchedulerWeights = parse(p, "SCHEDULER_WEIGHTS", "internal=8,pro=4,free=1", parseWeights)
+
+	p.require(cfg.AuthRefreshTokenTTL > cfg.AuthAccessTokenTTL, "AUTH_REFRESH_TOKEN_TTL must be longer than AUTH_ACCESS_TOKEN_TTL",
+		"AUTH_REFRESH_TOKEN_TTL", "AUTH_ACCESS_TOKEN_TTL")
+
+	p.fileExists("GRPC_CA_FILE", cfg.GRPCCAFile)
+	cfg.AIBackends = []AIBackend{{Name: "python", Addr: p.get("PYTHON_SERVICE_ADDR", "localhost:50051"), TLS: !cfg.GRPCInsecure, Weight: 1}}
+	if p.get("AI_BACKENDS", "") != "" {
+		cfg.AIBackends = parse(p, "AI_BACKENDS", "", func(s string) ([]AIBackend, error) {
+			return parseBackends(s, !cfg.GRPCInsecure)
+		})
+		p.require(p.get("PYTHON_SERVICE_ADDR", "") == "", "set AI_BACKENDS or PYTHON_SERVICE_ADDR, not both", "AI_BACKENDS")
+		p.require(slices.ContainsFunc(cfg.AIBackends, func(b AIBackend) bool { return len(b.Agents) == 0 }),
+			"AI_BACKENDS needs a backend without agents, for calls to any agent", "AI_BACKENDS")
+	}
+	p.require(cfg.GRPCCAFile == "" || slices.ContainsFunc(cfg.AIBackends, func(b AIBackend) bool { return b.TLS }),
+		"GRPC_CA_FILE requires GRPC_INSECURE=false or a backend with tls=true", "GRPC_INSECURE", "AI_BACKENDS")
+	checkResources(p, cfg)
+
+	cfg.RateLimit = parse(p, "RATE_LIMIT_REQUESTS_PER_MINUTE", "0", parseRouteLimit)
+	if p.get("RATE_LIMIT_BURST", "") != "" {
+		cfg.RateLimit.Burst = p.int("RATE_LIMIT_BURST", "")
+		positive(p, "RATE_LIMIT_BURST", cfg.RateLimit.Burst)
+	}
+
+	cfg.RateLimitRoutes = parse(p, "RATE_LIMIT_ROUTES", "", parseRouteLimits)
+	if p.get("RATE_LIMIT_TRUST_PROXY", "") != "" {
+		p.reject("RATE_LIMIT_TRUST_PROXY", fmt.Errorf("RATE_LIMIT_TRUST_PROXY has been replaced by TRUSTED_PROXIES and CLIENT_IP_HEADER"))
+	}
+
+	cfg.IPAllow = parse(p, "IP_ALLOW", "", commaCIDRs)
+	cfg.IPDeny = parse(p, "IP_DENY", "", commaCIDRs)
+	cfg.IPRouteAllow = parse(p, "IP_ROUTE_ALLOW", "", parseRouteCIDRs)
+	cfg.IPRouteDeny = parse(p, "IP_ROUTE_DENY", "", parseRouteCIDRs)
+	cfg.TrustedProxies = parse(p, "TRUSTED_PROXIES", "", commaCIDRs)
+	cfg.ClientIPHeader = parse(p, "CLIENT_IP_HEADER", clientip.HeaderForwardedFor, parseClientIPHeader)
+
+	p.require(!cfg.SessionCookies || cfg.AuthUsersFile != "", "SESSION_COOKIES requires AUTH_USERS_FILE")
+	p.require(cfg.SessionIdleTimeout <= cfg.SessionMaxAge, "SESSION_IDLE_TIMEOUT must not exceed SESSION_MAX_AGE",
+		"SESSION_IDLE_TIMEOUT", "SESSION_MAX_AGE")
+	cfg.SessionCookieSameSite = parse(p, "SESSION_COOKIE_SAMESITE", "lax", parseSameSite)
+
+	p.require(cfg.LoginMaxDelay >= cfg.LoginDelay, "LOGIN_MAX_DELAY must be at least LOGIN_DELAY", "LOGIN_MAX_DELAY", "LOGIN_DELAY")
+
+	cfg.GuestRateLimit = parse(p, "GUEST_RATE_LIMIT", "10", parseRouteLimit)
+	// Guests can mint identities at will, so only their address counts.
+	p.require(!strings.Contains(p.get("GUEST_RATE_LIMIT", ""), ";"), "GUEST_RATE_LIMIT is kept per client IP and takes no key", "GUEST_RATE_LIMIT")
+	cfg.GuestRateLimit.Key = LimitKeyIP
+
+	cfg.CSRFSameSite = parse(p, "CSRF_COOKIE_SAMESITE", "lax", parseSameSite)
+
+	p.require(cfg.RemoteConfig == "" || cfg.RemoteConfig == RemoteEtcd || cfg.RemoteConfig == RemoteConsul,
+		"REMOTE_CONFIG must be etcd or consul", "REMOTE_CONFIG")
+	p.require(cfg.RemoteConfig == "" || len(cfg.RemoteConfigEndpoints) > 0, "REMOTE_CONFIG requires REMOTE_CONFIG_ENDPOINTS", "REMOTE_CONFIG", "REMOTE_CONFIG_ENDPOINTS")
+	for _, endpoint := range cfg.RemoteConfigEndpoints {
+		p.require(strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://"),
+			fmt.Sprintf("REMOTE_CONFIG_ENDPOINTS must be http:// or https:// URLs, got %q", endpoint), "REMOTE_CONFIG_ENDPOINTS")
+	}
+	p.require(cfg.RemoteConfigPrefix != "", "REMOTE_CONFIG_PREFIX must not be empty", "REMOTE_CONFIG_PREFIX")
+
+	p.require(cfg.JWTSecret != "", "JWT_SECRET is required", "JWT_SECRET")
+	if cfg.JWTSecret != "" && environment == "production" {
+		p.require(len(cfg.JWTSecret) >= minSecretLength,
+			fmt.Sprintf("JWT_SECRET must be at least %d characters in production", minSecretLength))
+		p.require(len(cfg.JWTSecret) < minSecretLength || entropy(cfg.JWTSecret) >= minSecretEntropy,
+			"JWT_SECRET is too predictable for production; generate a random one, e.g. with openssl rand -base64 48")
+	}
+
+	cfg.JWTPreviousSecretsUntil = parse(p, "JWT_PREVIOUS_SECRETS_UNTIL", "", parseTime)
+	p.require(cfg.JWTPreviousSecretsUntil.IsZero() || len(cfg.JWTPreviousSecrets) > 0,
+		"JWT_PREVIOUS_SECRETS_UNTIL requires JWT_PREVIOUS_SECRETS", "JWT_PREVIOUS_SECRETS_UNTIL", "JWT_PREVIOUS_SECRETS")
+
+	cfg.JWTPublicKeys = parse(p, "JWT_PUBLIC_KEYS", "", parseKeyFiles)
+
+	p.require((cfg.TLSCertFile == "") == (cfg.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	p.fileExists("TLS_CERT_FILE", cfg.TLSCertFile)
+	p.fileExists("TLS_KEY_FILE", cfg.TLSKeyFile)
+	p.require((cfg.TLSCert == "") == (cfg.TLSKey == ""), "TLS_CERT and TLS_KEY must be set together", "TLS_CERT", "TLS_KEY")
+	p.require(cfg.TLSCert == "" || cfg.TLSCertFile == "", "TLS_CERT and TLS_CERT_FILE are mutually exclusive")
+	if cfg.TLSCert != "" && cfg.TLSKey != "" {
+		if _, err := tls.X509KeyPair([]byte(cfg.TLSCert), []byte(cfg.TLSKey)); err != nil {
+			p.fail("TLS_KEY", err)
+		}
+	}
+	for _, host := range cfg.TLSAutocertHosts {
+		p.require(!strings.ContainsAny(host, ":/"),
+			fmt.Sprintf("invalid TLS_AUTOCERT_HOSTS: %q is not a host name", host))
+	}
+	p.require(len(cfg.TLSAutocertHosts) == 0 || (cfg.TLSCertFile == "" && cfg.TLSCert == ""),
+		"TLS_AUTOCERT_HOSTS and TLS_CERT_FILE or TLS_CERT are mutually exclusive")
+	p.require(cfg.HTTPRedirectAddr == "" || cfg.TLSEnabled(),
+		"HTTP_REDIRECT_ADDR requires TLS_CERT_FILE, TLS_CERT or TLS_AUTOCERT_HOSTS")
+	p.require(cfg.TLSClientCAFile == "" || cfg.TLSEnabled(), "TLS_CLIENT_CA_FILE requires TLS_CERT_FILE, TLS_CERT or TLS_AUTOCERT_HOSTS")
+	p.fileExists("TLS_CLIENT_CA_FILE", cfg.TLSClientCAFile)
+	defaultClientAuth := "none"
+	if cfg.TLSClientCAFile != "" {
+		defaultClientAuth = "optional"
+	}
+	cfg.TLSClientAuth = parse(p, "TLS_CLIENT_AUTH", defaultClientAuth, parseClientAuth)
+	p.require(cfg.TLSClientAuth == ClientAuth(tls.NoClientCert) || cfg.TLSClientCAFile != "",
+		fmt.Sprintf("TLS_CLIENT_AUTH %s requires TLS_CLIENT_CA_FILE", cfg.TLSClientAuth))
+	p.require(cfg.ClientCertsFile == "" || cfg.TLSClientAuth != ClientAuth(tls.NoClientCert),
+		"CLIENT_CERTS_FILE requires client certificates to be verified; set TLS_CLIENT_CA_FILE", "TLS_CLIENT_AUTH")
+
+	p.require(cfg.JWTLeeway >= 0 && cfg.JWTLeeway <= 5*time.Minute, "JWT_LEEWAY must be between 0 and 5m", "JWT_LEEWAY")
+
+	if err := p.err(); err != nil {
+		return nil, err
 	}
-	return defaultValue
+	cfg.SecretRefs = p.refs
+	return cfg, nil
 }
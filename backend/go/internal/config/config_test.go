@@ -0,0 +1,107 @@
+package config
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestParseRouteLimits(t *testing.T) {
+	got, err := parseRouteLimits(" /api/v1/chat=30, /api/v1/chat/stream=0.5:3,/graphql=0,/api/v1/auth/login=10:2; key = IP,")
+	if err != nil {
+		t.Fatalf("parseRouteLimits() error = %v", err)
+	}
+	want := map[string]RouteLimit{
+		"/api/v1/chat":        {PerMinute: 30, Burst: 30, Key: LimitKeyUser},
+		"/api/v1/chat/stream": {PerMinute: 0.5, Burst: 3, Key: LimitKeyUser},
+		"/graphql":            {Key: LimitKeyUser},
+		"/api/v1/auth/login":  {PerMinute: 10, Burst: 2, Key: LimitKeyIP},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRouteLimits() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"/api/v1/chat", "/api/v1/chat=fast", "/api/v1/chat=-1", "/api/v1/chat=10:0", "/api/v1/chat=10;key=tenant", "/api/v1/chat=10;by=ip"} {
+		if _, err := parseRouteLimits(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	c := &Config{RateLimit: RouteLimit{PerMinute: 100, Burst: 100}, RateLimitRoutes: want}
+	if l := c.RouteRateLimit("/api/v1/chat/stream"); l.Burst != 3 {
+		t.Errorf("expected the route's own limit, got %v", l)
+	}
+	if l := c.RouteRateLimit("/api/v1/sessions/{id}/responses"); l.PerMinute != 100 {
+		t.Errorf("expected the default limit, got %v", l)
+	}
+}
+
+func TestParseKeyFiles(t *testing.T) {
+	got, err := parseKeyFiles(" 2024-01=/etc/neuronai/2024-01.pem, 2024-02=/etc/neuronai/2024-02.pem,")
+	if err != nil {
+		t.Fatalf("parseKeyFiles() error = %v", err)
+	}
+	want := map[string]string{"2024-01": "/etc/neuronai/2024-01.pem", "2024-02": "/etc/neuronai/2024-02.pem"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseKeyFiles() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"/etc/neuronai/key.pem", "=/etc/neuronai/key.pem", "2024-01="} {
+		if _, err := parseKeyFiles(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseRouteCIDRs(t *testing.T) {
+	got, err := parseRouteCIDRs(" /admin/=10.8.0.0/16|192.168.1.7, /internal/=::1,")
+	if err != nil {
+		t.Fatalf("parseRouteCIDRs() error = %v", err)
+	}
+	if len(got) != 2 || len(got["/admin/"]) != 2 || got["/admin/"][1].String() != "192.168.1.7/32" || got["/internal/"][0].String() != "::1/128" {
+		t.Errorf("unexpected routes %v", got)
+	}
+
+	for _, bad := range []string{"10.8.0.0/16", "/admin/=10.8.0.0/33", "=10.8.0.0/16"} {
+		if _, err := parseRouteCIDRs(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseSameSite(t *testing.T) {
+	got, err := parseSameSite("Strict")
+	if err != nil || got.String() != "strict" {
+		t.Errorf("parseSameSite(Strict) = %v, %v", got, err)
+	}
+	if _, err := parseSameSite("sometimes"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	got, err := parseClientAuth("Require")
+	if err != nil || got != ClientAuth(tls.RequireAndVerifyClientCert) || got.String() != "require" {
+		t.Errorf("parseClientAuth(Require) = %v, %v", got, err)
+	}
+	if _, err := parseClientAuth("sometimes"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	got, err := parseWeights(" internal=8, pro=4,free=1,")
+	if err != nil {
+		t.Fatalf("parseWeights() error = %v", err)
+	}
+	want := map[string]int{"internal": 8, "pro": 4, "free": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWeights() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"pro", "pro=high", "pro=0", "enterprise=2"} {
+		if _, err := parseWeights(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
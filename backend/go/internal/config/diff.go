@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// redacted replaces secret values so diffs and reports are safe to log.
+const redacted = "[redacted]"
+
+// secretFields are reported as changed without their values.
+var secretFields = map[string]bool{
+	"JWTSecret":          true,
+	"JWTPreviousSecrets": true,
+	"AdminToken":         true,
+	"NotifyToken":        true,
+	"TLSKey":             true,
+	// These may be Redis URLs with credentials.
+	"WSLimitStore":       true,
+	"APIKeysRedisURL":    true,
+	"RevocationRedisURL": true,
+	"BackplaneRedisURL":  true,
+	"RemoteConfigToken":  true,
+}
+
+// Change is one setting that differs between two configs.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Diff returns the settings that differ between old and new, in field order.
+// Secret values are redacted.
+func Diff(old, new *Config) []Change {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	fields := oldValue.Type()
+
+	var changes []Change
+	for i := 0; i < fields.NumField(); i++ {
+		o := fmt.Sprint(oldValue.Field(i).Interface())
+		n := fmt.Sprint(newValue.Field(i).Interface())
+		if o == n {
+			continue
+		}
+
+		name := fields.Field(i).Name
+		if secretFields[name] {
+			o, n = redacted, redacted
+		}
+		changes = append(changes, Change{Field: name, Old: o, New: n})
+	}
+	return changes
+}
+
+// Values returns every setting of c by field name, formatted as in a Change.
+// Secret values are redacted; unset secrets are reported empty.
+func Values(c *Config) map[string]string {
+	value := reflect.ValueOf(c).Elem()
+	fields := value.Type()
+
+	values := make(map[string]string, fields.NumField())
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		v := fmt.Sprint(value.Field(i).Interface())
+		if secretFields[name] && v != "" {
+			v = redacted
+		}
+		values[name] = v
+	}
+	return values
+}
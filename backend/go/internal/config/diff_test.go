@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	base := Config{
+		Port:              8080,
+		JWTSecret:         "one",
+		ModerationTimeout: 2 * time.Second,
+		AdmissionMode:     "queue",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []Change
+	}{
+		{
+			name:   "no changes",
+			modify: func(c *Config) {},
+			want:   nil,
+		},
+		{
+			name: "changed fields in order",
+			modify: func(c *Config) {
+				c.Port = 9090
+				c.AdmissionMode = "downgrade"
+			},
+			want: []Change{
+				{Field: "Port", Old: "8080", New: "9090"},
+				{Field: "AdmissionMode", Old: "queue", New: "downgrade"},
+			},
+		},
+		{
+			name:   "duration",
+			modify: func(c *Config) { c.ModerationTimeout = 500 * time.Millisecond },
+			want:   []Change{{Field: "ModerationTimeout", Old: "2s", New: "500ms"}},
+		},
+		{
+			name:   "secret redacted",
+			modify: func(c *Config) { c.JWTSecret = "two" },
+			want:   []Change{{Field: "JWTSecret", Old: redacted, New: redacted}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := base
+			tt.modify(&next)
+
+			got := Diff(&base, &next)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	values := Values(&Config{Port: 8080, JWTSecret: "secret", NotifyToken: "token", ModerationTimeout: 2 * time.Second})
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"Port", "8080"},
+		{"ModerationTimeout", "2s"},
+		{"JWTSecret", redacted},
+		{"NotifyToken", redacted},
+		{"AdminToken", ""},
+		{"Environment", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, ok := values[tt.field]
+			if !ok || got != tt.want {
+				t.Errorf("expected %q, got %q (present %v)", tt.want, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix namespaces the gateway's environment variables: NEURONAI_PORT
+// takes precedence over PORT, so the gateway's settings need not clash with
+// those of other programs sharing the environment.
+const EnvPrefix = "NEURONAI_"
+
+// Env returns the value of the environment variable key, or of
+// EnvPrefix+key if set.
+func Env(key string) string {
+	if value := os.Getenv(EnvPrefix + key); value != "" {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := Env(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Config fields tagged env are read by decode, from the setting the tag
+// names, as their type says:
+//
+//	Port int `env:"PORT" default:"8080"`
+//
+// default is the built-in default, which profiles and WithDefaults
+// replace. check is positive or nonnegative, for numbers and durations.
+// Options after the name in env are:
+//
+//   - bytes: an integer setting is a byte size such as 10MB
+//   - secret: a string or list setting may be a secret reference
+//
+// Strings, booleans, integers, floats, durations such as 30s and
+// comma-separated string lists are supported. Settings of other types, and
+// checks across settings, are left to load.
+type envTag struct {
+	key    string
+	def    string
+	check  string
+	bytes  bool
+	secret bool
+}
+
+func parseEnvTag(f reflect.StructField) (envTag, bool) {
+	env, ok := f.Tag.Lookup("env")
+	if !ok {
+		return envTag{}, false
+	}
+	name, opts, _ := strings.Cut(env, ",")
+	t := envTag{key: name, def: f.Tag.Get("default"), check: f.Tag.Get("check")}
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "":
+		case "bytes":
+			t.bytes = true
+		case "secret":
+			t.secret = true
+		default:
+			panic(fmt.Sprintf("config: unknown env option %q of %s", opt, f.Name))
+		}
+	}
+	return t, true
+}
+
+// decode sets the fields of cfg tagged env from their settings, recording
+// the problems with them in p.
+func decode(p *parser, cfg *Config) {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := range v.NumField() {
+		f := v.Type().Field(i)
+		if t, ok := parseEnvTag(f); ok {
+			decodeField(p, t, v.Field(i))
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func decodeField(p *parser, t envTag, field reflect.Value) {
+	switch {
+	case field.Type() == durationType:
+		d := p.duration(t.key, t.def)
+		checkValue(p, t, d)
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String && t.secret:
+		field.SetString(p.secret(t.key, t.def))
+	case field.Kind() == reflect.String:
+		field.SetString(p.get(t.key, t.def))
+	case field.Kind() == reflect.Bool:
+		field.SetBool(p.bool(t.key, t.def))
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		var n int64
+		if t.bytes {
+			n = parse(p, t.key, t.def, parseBytes)
+		} else {
+			n = p.int64(t.key, t.def)
+		}
+		if field.OverflowInt(n) {
+			p.fail(t.key, fmt.Errorf("%d is out of range", n))
+			return
+		}
+		checkValue(p, t, n)
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		x := p.float(t.key, t.def)
+		checkValue(p, t, x)
+		field.SetFloat(x)
+	case field.Type() == reflect.TypeOf([]string(nil)) && t.secret:
+		field.Set(reflect.ValueOf(p.secretList(t.key, t.def)))
+	case field.Type() == reflect.TypeOf([]string(nil)):
+		field.Set(reflect.ValueOf(splitList(p.get(t.key, t.def))))
+	default:
+		panic(fmt.Sprintf("config: %s cannot be decoded into %s", t.key, field.Type()))
+	}
+}
+
+// checkValue records a problem with t's setting unless v passes its check.
+func checkValue[T int64 | float64 | time.Duration](p *parser, t envTag, v T) {
+	switch t.check {
+	case "":
+	case "positive":
+		positive(p, t.key, v)
+	case "nonnegative":
+		nonNegative(p, t.key, v)
+	default:
+		panic(fmt.Sprintf("config: unknown check %q of %s", t.check, t.key))
+	}
+}
+
+// byteUnits are the suffixes of byte sizes, in multiples of 1024.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseBytes parses a byte size: a number of bytes, or a number followed by
+// B, KB, MB or GB, in multiples of 1024, such as 10MB or 512KiB.
+func parseBytes(s string) (int64, error) {
+	number, size := strings.TrimSpace(s), int64(1)
+	for _, u := range byteUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, size = strings.TrimSpace(n), u.size
+			break
+		}
+	}
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if n > math.MaxInt64/size || n < math.MinInt64/size {
+			return 0, fmt.Errorf("%q is too large", s)
+		}
+		return n * size, nil
+	}
+	x, err := strconv.ParseFloat(number, 64)
+	if err != nil || size == 1 {
+		return 0, fmt.Errorf("%q is not a byte size such as 10MB", s)
+	}
+	if bytes := x * float64(size); math.Abs(bytes) < math.MaxInt64 {
+		return int64(bytes), nil
+	}
+	return 0, fmt.Errorf("%q is too large", s)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBytes(t *testing.T) {
+	for s, want := range map[string]int64{
+		"524288":  524288,
+		"0":       0,
+		"256B":    256,
+		"1KB":     1024,
+		"512KiB":  512 << 10,
+		"10MB":    10 << 20,
+		"10 MiB":  10 << 20,
+		"1.5GB":   3 << 29,
+		"2G":      2 << 30,
+		" 64K ":   64 << 10,
+		"-1":      -1,
+		"1048576": 1 << 20,
+	} {
+		if got, err := parseBytes(s); err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+
+	for _, bad := range []string{"", "MB", "ten", "1.5", "1.5B", "10TB", "9999999999GB"} {
+		if _, err := parseBytes(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoad_EnvPrefix(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("PORT", "9000")
+	t.Setenv("NEURONAI_PORT", "9100")
+	t.Setenv("NEURONAI_WS_HUB_SHARDS", "4")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Port != 9100 {
+		t.Errorf("expected NEURONAI_PORT to take precedence, got %d", cfg.Port)
+	}
+	if cfg.WSHubShards != 4 {
+		t.Errorf("WSHubShards = %d, want 4", cfg.WSHubShards)
+	}
+
+	t.Setenv("NEURONAI_ABUSE_TIMEOUT", "0s")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "ABUSE_TIMEOUT must be positive") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_TaggedSettings(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.MaxRequestSize != 10<<20 || cfg.WSMaxMessageSize != 512<<10 || cfg.WSReadBufferSize != 1024 {
+		t.Errorf("unexpected byte size defaults %d %d %d", cfg.MaxRequestSize, cfg.WSMaxMessageSize, cfg.WSReadBufferSize)
+	}
+	if cfg.ShutdownTimeout != 30*time.Second || !cfg.Redaction || cfg.AdmissionSoftLimit != 0.8 {
+		t.Errorf("unexpected defaults %v %v %v", cfg.ShutdownTimeout, cfg.Redaction, cfg.AdmissionSoftLimit)
+	}
+	if len(cfg.GuestRoutes) != 3 || cfg.GuestRoutes[2] != "/ws" {
+		t.Errorf("GuestRoutes = %v", cfg.GuestRoutes)
+	}
+
+	t.Setenv("MAX_REQUEST_SIZE", "2MB")
+	t.Setenv("WS_MAX_MESSAGE_SIZE", "1048576")
+	t.Setenv("REDACT_KEYS", "ssn, iban,")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.MaxRequestSize != 2<<20 || cfg.WSMaxMessageSize != 1<<20 {
+		t.Errorf("unexpected byte sizes %d %d", cfg.MaxRequestSize, cfg.WSMaxMessageSize)
+	}
+	if len(cfg.RedactKeys) != 2 || cfg.RedactKeys[1] != "iban" {
+		t.Errorf("RedactKeys = %v", cfg.RedactKeys)
+	}
+
+	t.Setenv("MAX_REQUEST_SIZE", "lots")
+	t.Setenv("WS_READ_BUFFER_SIZE", "0KB")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid MAX_REQUEST_SIZE") ||
+		!strings.Contains(err.Error(), "WS_READ_BUFFER_SIZE must be positive") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoadFile_ByteSizes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	path := writeConfigFile(t, "gateway.yaml", "server:\n  max_request_size: 4MB\nwebsocket:\n  max_message_size: 65536\n")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.MaxRequestSize != 4<<20 || cfg.WSMaxMessageSize != 65536 {
+		t.Errorf("unexpected byte sizes %d %d", cfg.MaxRequestSize, cfg.WSMaxMessageSize)
+	}
+
+	path = writeConfigFile(t, "gateway.yaml", "server:\n  max_request_size: huge\n")
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "max_request_size") {
+		t.Errorf("LoadFile() error = %v", err)
+	}
+}
@@ -0,0 +1,575 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/neuronai/backend/go/internal/secrets"
+)
+
+// valueKind is the type a config file value must have.
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindInt
+	// kindBytes is an integer, or a string parseBytes accepts such as
+	// "10MB".
+	kindBytes
+	kindFloat
+	kindBool
+	// kindDuration is a string time.ParseDuration accepts.
+	kindDuration
+	// kindTime is an RFC 3339 time, which YAML may spell unquoted.
+	kindTime
+	// kindList is a list of strings, or a comma-separated string.
+	kindList
+	// kindPairs is a map, or a string of comma-separated key=value pairs.
+	kindPairs
+	// kindLimit is a number of requests per minute, a string such as
+	// "60:10;key=ip" that adds the burst and the key, or a map with rps or
+	// per_minute and optionally burst and key.
+	kindLimit
+	// kindRouteLimits is a map of route patterns to kindLimit values, or a
+	// string as RATE_LIMIT_ROUTES.
+	kindRouteLimits
+	// kindBackends is a list of backends, maps with a name, an addr and
+	// optionally tls, weight and agents, or a string as AI_BACKENDS.
+	kindBackends
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindInt:
+		return "an integer"
+	case kindBytes:
+		return "a byte size such as 10MB"
+	case kindFloat:
+		return "a number"
+	case kindBool:
+		return "a boolean"
+	case kindDuration:
+		return "a duration such as 30s"
+	case kindTime:
+		return "a time such as 2024-07-01T00:00:00Z"
+	case kindList:
+		return "a list of strings"
+	case kindPairs:
+		return "a map"
+	case kindLimit:
+		return "a rate limit such as 60, \"60:10\" or {rps: 1, burst: 10}"
+	case kindRouteLimits:
+		return "a map of routes to rate limits"
+	case kindBackends:
+		return "a list of backends"
+	}
+	return "a string"
+}
+
+// fileKey is a config file key and the environment variable it sets.
+type fileKey struct {
+	env  string
+	kind valueKind
+}
+
+// fileSections are the keys a config file may set, by section.
+var fileSections = map[string]map[string]fileKey{
+	"server": {
+		"port":                       {"PORT", kindInt},
+		"environment":                {"ENVIRONMENT", kindString},
+		"log_level":                  {"LOG_LEVEL", kindString},
+		"max_request_size":           {"MAX_REQUEST_SIZE", kindBytes},
+		"read_timeout":               {"HTTP_READ_TIMEOUT", kindDuration},
+		"write_timeout":              {"HTTP_WRITE_TIMEOUT", kindDuration},
+		"idle_timeout":               {"HTTP_IDLE_TIMEOUT", kindDuration},
+		"stream_timeout":             {"HTTP_STREAM_TIMEOUT", kindDuration},
+		"shutdown_timeout":           {"SHUTDOWN_TIMEOUT", kindDuration},
+		"tls_cert_file":              {"TLS_CERT_FILE", kindString},
+		"tls_key_file":               {"TLS_KEY_FILE", kindString},
+		"tls_cert":                   {"TLS_CERT", kindString},
+		"tls_key":                    {"TLS_KEY", kindString},
+		"tls_autocert_hosts":         {"TLS_AUTOCERT_HOSTS", kindList},
+		"tls_autocert_email":         {"TLS_AUTOCERT_EMAIL", kindString},
+		"tls_autocert_cache_dir":     {"TLS_AUTOCERT_CACHE_DIR", kindString},
+		"tls_autocert_directory_url": {"TLS_AUTOCERT_DIRECTORY_URL", kindString},
+		"http_redirect_addr":         {"HTTP_REDIRECT_ADDR", kindString},
+		"tls_client_ca_file":         {"TLS_CLIENT_CA_FILE", kindString},
+		"trusted_proxies":            {"TRUSTED_PROXIES", kindList},
+		"client_ip_header":           {"CLIENT_IP_HEADER", kindString},
+		"cors_allowed_origins":       {"CORS_ALLOWED_ORIGINS", kindList},
+		"boot_report_path":           {"BOOT_REPORT_PATH", kindString},
+	},
+	"grpc": {
+		"python_service_addr": {"PYTHON_SERVICE_ADDR", kindString},
+		"backends":            {"AI_BACKENDS", kindBackends},
+		"web":                 {"GRPC_WEB", kindBool},
+		"insecure":            {"GRPC_INSECURE", kindBool},
+		"ca_file":             {"GRPC_CA_FILE", kindString},
+		"pool_size":           {"GRPC_POOL_SIZE", kindInt},
+		"max_streams":         {"GRPC_MAX_STREAMS", kindInt},
+		"user_max_concurrent": {"USER_MAX_CONCURRENT_REQUESTS", kindInt},
+		"scheduler_capacity":  {"SCHEDULER_CAPACITY", kindInt},
+		"scheduler_weights":   {"SCHEDULER_WEIGHTS", kindPairs},
+		"scheduler_max_wait":  {"SCHEDULER_MAX_WAIT", kindDuration},
+	},
+	"websocket": {
+		"replay_buffer":            {"WS_REPLAY_BUFFER", kindInt},
+		"replay_ttl":               {"WS_REPLAY_TTL", kindDuration},
+		"message_rate":             {"WS_MESSAGE_RATE", kindFloat},
+		"message_burst":            {"WS_MESSAGE_BURST", kindInt},
+		"max_streams":              {"WS_MAX_STREAMS", kindInt},
+		"lag_grace":                {"WS_LAG_GRACE", kindDuration},
+		"max_connections_per_user": {"WS_MAX_CONNECTIONS_PER_USER", kindInt},
+		"max_connections":          {"WS_MAX_CONNECTIONS", kindInt},
+		"hub_shards":               {"WS_HUB_SHARDS", kindInt},
+		"stats_interval":           {"WS_STATS_INTERVAL", kindDuration},
+		"write_wait":               {"WS_WRITE_WAIT", kindDuration},
+		"pong_wait":                {"WS_PONG_WAIT", kindDuration},
+		"ping_period":              {"WS_PING_PERIOD", kindDuration},
+		"read_buffer_size":         {"WS_READ_BUFFER_SIZE", kindBytes},
+		"write_buffer_size":        {"WS_WRITE_BUFFER_SIZE", kindBytes},
+		"send_buffer_size":         {"WS_SEND_BUFFER_SIZE", kindInt},
+		"max_message_size":         {"WS_MAX_MESSAGE_SIZE", kindBytes},
+		"compression":              {"WS_COMPRESSION", kindBool},
+		"compression_level":        {"WS_COMPRESSION_LEVEL", kindInt},
+		"compression_min_size":     {"WS_COMPRESSION_MIN_SIZE", kindBytes},
+		"presence":                 {"WS_PRESENCE", kindBool},
+		"ticket_ttl":               {"WS_TICKET_TTL", kindDuration},
+		"limit_store":              {"WS_LIMIT_STORE", kindString},
+		"limit_persist_interval":   {"WS_LIMIT_PERSIST_INTERVAL", kindDuration},
+	},
+	"rate_limit": {
+		"requests_per_minute": {"RATE_LIMIT_REQUESTS_PER_MINUTE", kindLimit},
+		"burst":               {"RATE_LIMIT_BURST", kindInt},
+		"routes":              {"RATE_LIMIT_ROUTES", kindRouteLimits},
+	},
+	"auth": {
+		"jwt_secret":                 {"JWT_SECRET", kindString},
+		"jwt_previous_secrets":       {"JWT_PREVIOUS_SECRETS", kindList},
+		"jwt_previous_secrets_until": {"JWT_PREVIOUS_SECRETS_UNTIL", kindTime},
+		"jwt_public_keys":            {"JWT_PUBLIC_KEYS", kindPairs},
+		"jwt_jwks_url":               {"JWT_JWKS_URL", kindString},
+		"jwt_jwks_refresh":           {"JWT_JWKS_REFRESH", kindDuration},
+		"jwt_issuer":                 {"JWT_ISSUER", kindString},
+		"jwt_audience":               {"JWT_AUDIENCE", kindString},
+		"jwt_leeway":                 {"JWT_LEEWAY", kindDuration},
+		"jwt_require_nbf":            {"JWT_REQUIRE_NBF", kindBool},
+		"access_token_ttl":           {"AUTH_ACCESS_TOKEN_TTL", kindDuration},
+		"refresh_token_ttl":          {"AUTH_REFRESH_TOKEN_TTL", kindDuration},
+		"users_file":                 {"AUTH_USERS_FILE", kindString},
+		"session_cookies":            {"SESSION_COOKIES", kindBool},
+		"guest_access":               {"GUEST_ACCESS", kindBool},
+		"guest_token_ttl":            {"GUEST_TOKEN_TTL", kindDuration},
+		"guest_rate_limit":           {"GUEST_RATE_LIMIT", kindLimit},
+		"oidc_issuer":                {"OIDC_ISSUER", kindString},
+		"oidc_audience":              {"OIDC_AUDIENCE", kindString},
+		"oidc_jwks_url":              {"OIDC_JWKS_URL", kindString},
+		"api_keys_file":              {"API_KEYS_FILE", kindString},
+		"admin_role":                 {"ADMIN_ROLE", kindString},
+	},
+}
+
+// source looks settings up in its overrides, the environment, then the
+// config file, and the profile over it.
+type source struct {
+	// path is the config file's and profile its environment profile's, if
+	// any.
+	path    string
+	profile string
+	// values are the files' settings by environment variable, keys the
+	// file keys that set them, and files the files.
+	values map[string]string
+	keys   map[string]string
+	files  map[string]string
+	// environment selects the profile defaults.
+	environment string
+	// overrides take precedence over all else, then remote, the settings
+	// of the remote config store, and defaults replace the built-in ones,
+	// by environment variable.
+	overrides map[string]string
+	remote    map[string]string
+	defaults  map[string]string
+	// secrets resolves sensitive settings that are secret references.
+	secrets *secrets.Resolver
+}
+
+// get returns the override of key, else its value in the remote config
+// store, else the value of the environment variable key, else that the
+// config files set for it, else the default: the one given by
+// WithDefaults, that of the profile, or defaultValue.
+func (s *source) get(key, defaultValue string) string {
+	if value, ok := s.overrides[key]; ok {
+		return value
+	}
+	if value, ok := s.remote[key]; ok {
+		return value
+	}
+	if value, ok := s.defaults[key]; ok {
+		defaultValue = value
+	} else if value, ok := profileDefaults[s.environment][key]; ok {
+		defaultValue = value
+	}
+	if value, ok := s.values[key]; ok {
+		return getEnv(key, value)
+	}
+	return getEnv(key, defaultValue)
+}
+
+// readFile reads a YAML or JSON config file, by its extension. Sections and
+// keys it does not know, and values of the wrong type, are errors naming
+// the key.
+func readFile(path string) (*source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, want .yaml, .yml or .json", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	s := &source{
+		path:   path,
+		values: make(map[string]string),
+		keys:   make(map[string]string),
+		files:  make(map[string]string),
+	}
+	for _, section := range sortedKeys(doc) {
+		keys, ok := fileSections[section]
+		if !ok {
+			return nil, fmt.Errorf("config file %s: unknown section %q", path, section)
+		}
+		if doc[section] == nil {
+			continue
+		}
+		settings, ok := doc[section].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("config file %s: %s: expected a map of settings", path, section)
+		}
+		for _, name := range sortedKeys(settings) {
+			key := section + "." + name
+			k, ok := keys[name]
+			if !ok {
+				return nil, fmt.Errorf("config file %s: unknown key %q", path, key)
+			}
+			value, err := fileValue(settings[name], k.kind)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+			}
+			s.values[k.env] = value
+			s.keys[k.env] = key
+			s.files[k.env] = path
+		}
+	}
+	return s, nil
+}
+
+// fileValue returns v, a value of kind, as its environment variable would
+// spell it.
+func fileValue(v any, kind valueKind) (string, error) {
+	invalid := fmt.Errorf("expected %s, got %s", kind, describe(v))
+	switch kind {
+	case kindString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case kindInt:
+		switch n := v.(type) {
+		case int:
+			return strconv.Itoa(n), nil
+		case json.Number:
+			if _, err := n.Int64(); err == nil {
+				return n.String(), nil
+			}
+		}
+	case kindBytes:
+		switch n := v.(type) {
+		case string:
+			if _, err := parseBytes(n); err != nil {
+				return "", err
+			}
+			return n, nil
+		case int, json.Number:
+			return fileValue(n, kindInt)
+		}
+	case kindFloat:
+		switch n := v.(type) {
+		case int:
+			return strconv.Itoa(n), nil
+		case float64:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		case json.Number:
+			return n.String(), nil
+		}
+	case kindBool:
+		if b, ok := v.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+	case kindLimit:
+		switch n := v.(type) {
+		case string:
+			return n, nil
+		case int:
+			return strconv.Itoa(n), nil
+		case float64:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		case json.Number:
+			return n.String(), nil
+		case map[string]any:
+			return limitValue(n)
+		}
+	case kindDuration:
+		if s, ok := v.(string); ok {
+			if _, err := time.ParseDuration(s); err != nil {
+				return "", fmt.Errorf("invalid duration %q", s)
+			}
+			return s, nil
+		}
+	case kindTime:
+		switch t := v.(type) {
+		case time.Time:
+			return t.Format(time.RFC3339), nil
+		case string:
+			if _, err := time.Parse(time.RFC3339, t); err != nil {
+				return "", fmt.Errorf("invalid time %q", t)
+			}
+			return t, nil
+		}
+	case kindList:
+		switch l := v.(type) {
+		case string:
+			return l, nil
+		case []any:
+			items := make([]string, len(l))
+			for i, item := range l {
+				s, ok := item.(string)
+				if !ok {
+					return "", fmt.Errorf("item %d: expected a string, got %s", i, describe(item))
+				}
+				items[i] = s
+			}
+			return strings.Join(items, ","), nil
+		}
+	case kindPairs:
+		switch m := v.(type) {
+		case string:
+			return m, nil
+		case map[string]any:
+			pairs := make([]string, 0, len(m))
+			for _, k := range sortedKeys(m) {
+				switch value := m[k].(type) {
+				case string, int, json.Number:
+					pairs = append(pairs, fmt.Sprintf("%s=%v", k, value))
+				default:
+					return "", fmt.Errorf("%s: expected a string or an integer, got %s", k, describe(value))
+				}
+			}
+			return strings.Join(pairs, ","), nil
+		}
+	case kindRouteLimits:
+		switch m := v.(type) {
+		case string:
+			return m, nil
+		case map[string]any:
+			limits := make([]string, 0, len(m))
+			for _, pattern := range sortedKeys(m) {
+				limit, err := fileValue(m[pattern], kindLimit)
+				if err != nil {
+					return "", fmt.Errorf("%s: %w", pattern, err)
+				}
+				limits = append(limits, pattern+"="+limit)
+			}
+			return strings.Join(limits, ","), nil
+		}
+	case kindBackends:
+		switch l := v.(type) {
+		case string:
+			return l, nil
+		case []any:
+			items := make([]string, len(l))
+			for i, item := range l {
+				backend, err := backendValue(item)
+				if err != nil {
+					return "", fmt.Errorf("item %d: %w", i, err)
+				}
+				items[i] = backend
+			}
+			return strings.Join(items, ","), nil
+		}
+	}
+	return "", invalid
+}
+
+// limitValue returns m, a rate limit of a config file, as
+// RATE_LIMIT_ROUTES would spell it.
+func limitValue(m map[string]any) (string, error) {
+	values := make(map[string]string)
+	for _, key := range sortedKeys(m) {
+		var kind valueKind
+		switch key {
+		case "rps", "per_minute":
+			kind = kindFloat
+		case "burst":
+			kind = kindInt
+		case "key":
+			kind = kindString
+		default:
+			return "", fmt.Errorf("unknown key %q", key)
+		}
+		value, err := fileValue(m[key], kind)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = value
+	}
+
+	limit, ok := values["per_minute"]
+	if rps, hasRPS := values["rps"]; hasRPS == ok {
+		return "", fmt.Errorf("expected one of rps and per_minute")
+	} else if hasRPS {
+		n, _ := strconv.ParseFloat(rps, 64)
+		limit = strconv.FormatFloat(n*60, 'g', -1, 64)
+	}
+	if burst, ok := values["burst"]; ok {
+		limit += ":" + burst
+	}
+	if key, ok := values["key"]; ok {
+		limit += ";key=" + key
+	}
+	return limit, nil
+}
+
+// backendValue returns v, a backend of a config file, as AI_BACKENDS
+// would spell it.
+func backendValue(v any) (string, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("expected a map, got %s", describe(v))
+	}
+	name, nameOK := m["name"].(string)
+	addr, addrOK := m["addr"].(string)
+	if !nameOK || !addrOK {
+		return "", fmt.Errorf("expected a name and an addr")
+	}
+	backend := name + "=" + addr
+	for _, key := range sortedKeys(m) {
+		var kind valueKind
+		switch key {
+		case "name", "addr":
+			continue
+		case "tls":
+			kind = kindBool
+		case "weight":
+			kind = kindInt
+		case "agents":
+			kind = kindList
+		default:
+			return "", fmt.Errorf("unknown key %q", key)
+		}
+		value, err := fileValue(m[key], kind)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		backend += ";" + key + "=" + strings.ReplaceAll(value, ",", "|")
+	}
+	return backend, nil
+}
+
+// describe names the type of a decoded value for errors.
+func describe(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case int, float64, json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// explain adds to err, from loading the config, the config file key and
+// file that set the first setting it names, unless the environment overrode
+// it, or that the remote config store set it.
+func (s *source) explain(err error) error {
+	msg := err.Error()
+	first, key, file := len(msg), "", ""
+	for env := range s.remote {
+		if _, ok := s.overrides[env]; ok {
+			continue
+		}
+		if i := indexWord(msg, env); i >= 0 && i < first {
+			first, key, file = i, env, ""
+		}
+	}
+	for env, k := range s.keys {
+		if _, ok := s.overrides[env]; ok || Env(env) != "" || s.remote[env] != "" {
+			continue
+		}
+		if i := indexWord(msg, env); i >= 0 && i < first {
+			first, key, file = i, k, s.files[env]
+		}
+	}
+	switch {
+	case key == "":
+		return err
+	case file == "":
+		return fmt.Errorf("%w (set in the remote config store)", err)
+	}
+	return fmt.Errorf("%w (set by %s in %s)", err, key, file)
+}
+
+// indexWord returns the index of the first occurrence of word in s that is
+// not part of a longer environment variable name, or -1.
+func indexWord(s, word string) int {
+	isName := func(c byte) bool {
+		return c == '_' || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	for offset := 0; ; {
+		i := strings.Index(s[offset:], word)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		end := i + len(word)
+		if (i == 0 || !isName(s[i-1])) && (end == len(s) || !isName(s[end])) {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
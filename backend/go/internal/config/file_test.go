@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile_YAML(t *testing.T) {
+	t.Setenv("WS_MAX_STREAMS", "8")
+	path := writeConfigFile(t, "gateway.yaml", `
+server:
+  port: 9090
+  trusted_proxies: [10.0.0.0/8, 192.168.0.0/16]
+grpc:
+  python_service_addr: ai:50051
+  scheduler_weights: {internal: 6, pro: 3, free: 1}
+websocket:
+  max_streams: 2
+  message_rate: 2.5
+  pong_wait: 90s
+auth:
+  jwt_secret: file-secret
+  jwt_previous_secrets: [old-secret]
+  jwt_previous_secrets_until: 2024-07-01T00:00:00Z
+  guest_access: true
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Port != 9090 || cfg.AIBackends[0].Addr != "ai:50051" || cfg.JWTSecret != "file-secret" || !cfg.GuestAccess {
+		t.Errorf("file settings not applied: port %d, addr %q, guest access %v", cfg.Port, cfg.AIBackends[0].Addr, cfg.GuestAccess)
+	}
+	if len(cfg.TrustedProxies) != 2 {
+		t.Errorf("expected 2 trusted proxies, got %v", cfg.TrustedProxies)
+	}
+	if cfg.SchedulerWeights["internal"] != 6 {
+		t.Errorf("expected internal weight 6, got %v", cfg.SchedulerWeights)
+	}
+	if cfg.WSMessageRate != 2.5 || cfg.WSPongWait != 90*time.Second {
+		t.Errorf("expected message rate 2.5 and pong wait 90s, got %v and %v", cfg.WSMessageRate, cfg.WSPongWait)
+	}
+	if cfg.WSMaxStreams != 8 {
+		t.Errorf("expected WS_MAX_STREAMS to override the file, got %d", cfg.WSMaxStreams)
+	}
+	if want := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC); !cfg.JWTPreviousSecretsUntil.Equal(want) {
+		t.Errorf("expected the rotation to end at %v, got %v", want, cfg.JWTPreviousSecretsUntil)
+	}
+}
+
+func TestLoadFile_JSON(t *testing.T) {
+	path := writeConfigFile(t, "gateway.json", `{"server": {"port": 7070}, "auth": {"jwt_secret": "s"}}`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Port != 7070 {
+		t.Errorf("expected port 7070, got %d", cfg.Port)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"unknown section", "c.yaml", "database: {}", `unknown section "database"`},
+		{"unknown key", "c.yaml", "server: {prot: 80}", `unknown key "server.prot"`},
+		{"wrong type", "c.yaml", "server: {port: eighty}", "server.port: expected an integer, got a string"},
+		{"bad duration", "c.yaml", "websocket: {pong_wait: soon}", `websocket.pong_wait: invalid duration "soon"`},
+		{"bad list item", "c.yaml", "server: {trusted_proxies: [1]}", "server.trusted_proxies: item 0"},
+		{"fractional integer", "c.json", `{"server": {"port": 80.5}}`, "server.port: expected an integer"},
+		{"invalid value", "c.yaml", "auth: {jwt_secret: s}\nwebsocket: {pong_wait: 10s, ping_period: 20s}", "(set by websocket.ping_period in"},
+		{"unsupported format", "c.toml", "", `unsupported format ".toml"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFile() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFile_Precedence(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+server: {port: 9090, log_level: warn}
+grpc: {python_service_addr: ai:50051}
+`)
+	t.Setenv("PYTHON_SERVICE_ADDR", "env:50051")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, err := LoadFile(path,
+		WithOverrides(map[string]string{"PORT": "7070", "LOG_LEVEL": "debug"}),
+		WithDefaults(map[string]string{"JWT_SECRET": "default-secret", "PORT": "1", "PYTHON_SERVICE_ADDR": "default:50051"}))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Port != 7070 || cfg.LogLevel.String() != "DEBUG" {
+		t.Errorf("expected overrides over the environment and file, got port %d, log level %v", cfg.Port, cfg.LogLevel)
+	}
+	if cfg.AIBackends[0].Addr != "env:50051" {
+		t.Errorf("expected the environment over defaults, got %q", cfg.AIBackends[0].Addr)
+	}
+	if cfg.JWTSecret != "default-secret" {
+		t.Errorf("expected the default used, got %q", cfg.JWTSecret)
+	}
+
+	// Problems with overridden settings do not blame the file.
+	_, err = LoadFile(path, WithOverrides(map[string]string{"PORT": "0", "JWT_SECRET": "s"}))
+	if err == nil || strings.Contains(err.Error(), "server.port") {
+		t.Errorf("LoadFile() error = %v, want PORT reported without the file key", err)
+	}
+}
+
+func TestIndexWord(t *testing.T) {
+	msg := "WS_PING_PERIOD must be below WS_PONG_WAIT"
+	if i := indexWord(msg, "WS_PONG_WAIT"); i != 29 {
+		t.Errorf("indexWord() = %d, want 29", i)
+	}
+	if i := indexWord("invalid WS_PORT: x", "PORT"); i != -1 {
+		t.Errorf("indexWord() = %d, want -1 for a longer name", i)
+	}
+}
+
+func TestLoadFile_AIBackends(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+grpc:
+  insecure: true
+  backends:
+    - {name: stable, addr: "ai:50051", weight: 9}
+    - {name: canary, addr: "ai-canary:50051", tls: true, agents: [code, writer]}
+auth:
+  jwt_secret: s
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := []string{"stable=ai:50051;tls=false;weight=9", "canary=ai-canary:50051;tls=true;weight=1;agents=code|writer"}
+	if len(cfg.AIBackends) != 2 || cfg.AIBackends[0].String() != want[0] || cfg.AIBackends[1].String() != want[1] {
+		t.Errorf("AIBackends = %v, want %v", cfg.AIBackends, want)
+	}
+
+	path = writeConfigFile(t, "gateway.yaml", "grpc:\n  backends: [{name: a, addr: x, color: red}]\n")
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), `grpc.backends: item 0: unknown key "color"`) {
+		t.Errorf("LoadFile() error = %v", err)
+	}
+}
+
+func TestLoadFile_RateLimitRoutes(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+rate_limit:
+  requests_per_minute: {per_minute: 100, burst: 20}
+  routes:
+    /api/v1/chat/stream: "30:5"
+    /api/v1/auth/login: {rps: 0.5, burst: 3, key: ip}
+    /api/v1/sessions: {per_minute: 600, key: apikey}
+auth: {jwt_secret: s}
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := map[string]RouteLimit{
+		"/api/v1/chat/stream": {PerMinute: 30, Burst: 5, Key: LimitKeyUser},
+		"/api/v1/auth/login":  {PerMinute: 30, Burst: 3, Key: LimitKeyIP},
+		"/api/v1/sessions":    {PerMinute: 600, Burst: 600, Key: LimitKeyAPIKey},
+	}
+	if !reflect.DeepEqual(cfg.RateLimitRoutes, want) {
+		t.Errorf("RateLimitRoutes = %v, want %v", cfg.RateLimitRoutes, want)
+	}
+	if cfg.RateLimit != (RouteLimit{PerMinute: 100, Burst: 20, Key: LimitKeyUser}) {
+		t.Errorf("RateLimit = %v", cfg.RateLimit)
+	}
+
+	path = writeConfigFile(t, "gateway.yaml", `
+rate_limit:
+  routes:
+    /api/v1/chat: {rps: 1, per_minute: 60}
+auth: {jwt_secret: s}
+`)
+	_, err = LoadFile(path)
+	if err == nil || !strings.Contains(err.Error(), "/api/v1/chat: expected one of rps and per_minute") {
+		t.Errorf("LoadFile() error = %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// defaultEnvironment is the environment, and so the profile, when
+// ENVIRONMENT is not set.
+const defaultEnvironment = "development"
+
+// profileDefaults are the defaults of settings that differ by environment.
+// Conveniences for local development are defaults of its profile only, so
+// other environments do without them unless they ask.
+var profileDefaults = map[string]map[string]string{
+	"development": {
+		"GRPC_INSECURE":        "true",
+		"CORS_ALLOWED_ORIGINS": "*",
+	},
+	"staging": {
+		"LOG_FORMAT": logging.FormatJSON,
+	},
+	"production": {
+		"LOG_FORMAT": logging.FormatJSON,
+	},
+}
+
+// devOnly report whether values of settings are development conveniences,
+// which outside development must not come from the base config file: a
+// value there applies to every environment, which is how they leak into
+// production.
+var devOnly = map[string]func(string) bool{
+	"GRPC_INSECURE": func(v string) bool {
+		insecure, _ := strconv.ParseBool(v)
+		return insecure
+	},
+	"CORS_ALLOWED_ORIGINS": func(v string) bool {
+		return slices.Contains(splitList(v), "*")
+	},
+	"AI_BACKENDS": func(v string) bool {
+		backends, _ := parseBackends(v, true)
+		return slices.ContainsFunc(backends, func(b AIBackend) bool { return !b.TLS })
+	},
+}
+
+// profilePath returns the path of the profile of environment that layers
+// over the config file at path: gateway.production.yaml for
+// gateway.yaml.
+func profilePath(path, environment string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + environment + ext
+}
+
+// overlay layers the config file at path, if it exists, over the file s
+// was read from, setting by setting. It may not set ENVIRONMENT, which
+// selected it.
+func (s *source) overlay(path string) error {
+	profile, err := readFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if key, ok := profile.keys["ENVIRONMENT"]; ok {
+		return fmt.Errorf("config file %s: %s cannot be set in an environment profile", path, key)
+	}
+	s.profile = path
+	for env, value := range profile.values {
+		s.values[env] = value
+		s.keys[env] = profile.keys[env]
+		s.files[env] = path
+	}
+	return nil
+}
+
+// checkProfile records a problem with each development convenience the base
+// config file sets for environment, other than development.
+func checkProfile(p *parser, environment string) {
+	if environment == defaultEnvironment {
+		return
+	}
+	for _, key := range sortedKeys(devOnly) {
+		if !p.src.fromBase(key) || !devOnly[key](p.src.values[key]) {
+			continue
+		}
+		p.reject(key, fmt.Errorf("%s=%s is for development only and would apply to %s; set it in %s instead",
+			key, p.src.values[key], environment, profilePath(p.src.path, defaultEnvironment)))
+	}
+}
+
+// fromBase reports whether the setting key comes from the base config file
+// rather than a profile, the environment or an override.
+func (s *source) fromBase(key string) bool {
+	if _, ok := s.overrides[key]; ok || getEnv(key, "") != "" {
+		return false
+	}
+	file, ok := s.files[key]
+	return ok && file == s.path
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile_Profile(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+server: {port: 9090, log_level: info}
+grpc: {python_service_addr: ai:50051}
+auth: {jwt_secret: s}
+`)
+	dir := filepath.Dir(path)
+	os.WriteFile(filepath.Join(dir, "gateway.staging.yaml"), []byte("server: {log_level: debug}\ngrpc: {insecure: true}"), 0o600)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.LogLevel.String() != "INFO" || !cfg.GRPCInsecure || cfg.LogFormat != "text" {
+		t.Errorf("development: log level %v, insecure %v, format %s", cfg.LogLevel, cfg.GRPCInsecure, cfg.LogFormat)
+	}
+
+	t.Setenv("ENVIRONMENT", "staging")
+	cfg, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Port != 9090 || cfg.AIBackends[0].Addr != "ai:50051" {
+		t.Errorf("expected the base settings kept, got port %d, addr %s", cfg.Port, cfg.AIBackends[0].Addr)
+	}
+	if cfg.LogLevel.String() != "DEBUG" || !cfg.GRPCInsecure || cfg.LogFormat != "json" {
+		t.Errorf("staging: log level %v, insecure %v, format %s", cfg.LogLevel, cfg.GRPCInsecure, cfg.LogFormat)
+	}
+
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("JWT_SECRET", "q8Zt3vN1xKpW7mRb2LcY9sHdF4gJ6aEu0TnVoXiQ5")
+	cfg, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.GRPCInsecure || len(cfg.CORSAllowedOrigins) != 0 {
+		t.Errorf("expected no development conveniences in production, got insecure %v, origins %v", cfg.GRPCInsecure, cfg.CORSAllowedOrigins)
+	}
+}
+
+func TestLoadFile_DevOnlyInBase(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+server: {environment: production, cors_allowed_origins: ["*"]}
+grpc: {insecure: true, backends: [{name: local, addr: "localhost:50051", tls: false}]}
+auth: {jwt_secret: q8Zt3vN1xKpW7mRb2LcY9sHdF4gJ6aEu0TnVoXiQ5}
+`)
+
+	_, err := LoadFile(path)
+	if err == nil {
+		t.Fatal("expected development conveniences in the base file refused in production")
+	}
+	for _, want := range []string{"GRPC_INSECURE=true is for development only", "CORS_ALLOWED_ORIGINS=* is for development only",
+		"AI_BACKENDS=local=localhost:50051;tls=false is for development only", "gateway.development.yaml"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+
+	// Set deliberately, for production alone, they are allowed.
+	os.WriteFile(filepath.Join(filepath.Dir(path), "gateway.production.yaml"),
+		[]byte("grpc: {insecure: true, backends: \"local=localhost:50051;tls=false\"}"), 0o600)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if !cfg.GRPCInsecure {
+		t.Error("expected the production profile's setting applied")
+	}
+}
+
+func TestLoadFile_ProfileSetsEnvironment(t *testing.T) {
+	path := writeConfigFile(t, "gateway.json", `{"auth": {"jwt_secret": "s"}}`)
+	os.WriteFile(filepath.Join(filepath.Dir(path), "gateway.development.json"), []byte(`{"server": {"environment": "production"}}`), 0o600)
+
+	_, err := LoadFile(path)
+	if err == nil || !strings.Contains(err.Error(), "server.environment cannot be set in an environment profile") {
+		t.Errorf("LoadFile() error = %v", err)
+	}
+}
+
+func TestProfilePath(t *testing.T) {
+	if got := profilePath("/etc/neuronai/gateway.yaml", "production"); got != "/etc/neuronai/gateway.production.yaml" {
+		t.Errorf("profilePath() = %q", got)
+	}
+}
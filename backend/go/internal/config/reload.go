@@ -0,0 +1,246 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// reloadableFields are the settings a reload applies to the running
+// gateway. Changes to any other field take a restart.
+var reloadableFields = map[string]bool{
+	"RateLimit":           true,
+	"RateLimitRoutes":     true,
+	"GuestRateLimit":      true,
+	"CORSAllowedOrigins":  true,
+	"LogLevel":            true,
+	"AIBackends":          true,
+	"TLSCert":             true,
+	"TLSKey":              true,
+	"MaintenanceMode":     true,
+	"MaintenanceMessage":  true,
+	"MaintenanceReadOnly": true,
+	"QuotaRequests":       true,
+	"QuotaTokens":         true,
+}
+
+// remoteSettings are the settings, by environment variable, a remote
+// config store may set: those of reloadable fields that every replica
+// should agree on.
+var remoteSettings = map[string]bool{
+	"RATE_LIMIT_REQUESTS_PER_MINUTE": true,
+	"RATE_LIMIT_BURST":               true,
+	"RATE_LIMIT_ROUTES":              true,
+	"GUEST_RATE_LIMIT":               true,
+	"CORS_ALLOWED_ORIGINS":           true,
+	"LOG_LEVEL":                      true,
+	"AI_BACKENDS":                    true,
+	"MAINTENANCE_MODE":               true,
+	"MAINTENANCE_MESSAGE":            true,
+	"MAINTENANCE_READ_ONLY":          true,
+	"QUOTA_REQUESTS":                 true,
+	"QUOTA_TOKENS":                   true,
+}
+
+// ApplyFunc applies the reloadable changes of a reload by trigger, which
+// next holds in full. If it fails, none of the reload is kept.
+type ApplyFunc func(trigger string, next *Config, changes []Change) error
+
+// Reloader reloads the config on SIGHUP, when its file or profile
+// changes, and periodically while settings come from a secrets manager,
+// and applies the changes to reloadable settings. Changes to other
+// settings are left out with a warning.
+type Reloader struct {
+	path     string
+	interval time.Duration
+	apply    ApplyFunc
+	logger   *slog.Logger
+	opts     []LoadOption
+
+	mu sync.Mutex
+	// current is the config in effect, a copy so reloads do not race with
+	// readers of the boot config.
+	current *Config
+	stamp   fileStamp
+	// remote, once ApplyRemote is called, are the settings of the remote
+	// config store, replacing any opts gave.
+	remote map[string]string
+}
+
+// fileStamp tells versions of the config file and its profile apart.
+type fileStamp struct {
+	modTime        time.Time
+	size           int64
+	profileModTime time.Time
+	profileSize    int64
+}
+
+// NewReloader reloads from the config file at path, or the environment
+// alone if path is empty, checking the file for changes every interval
+// unless it is 0. current is the config in use, which reloads compare with
+// but never modify. opts are those current was loaded with.
+func NewReloader(path string, current *Config, interval time.Duration, apply ApplyFunc, logger *slog.Logger, opts ...LoadOption) *Reloader {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	c := *current
+	r := &Reloader{
+		path:     path,
+		interval: interval,
+		apply:    apply,
+		logger:   logger,
+		opts:     opts,
+		current:  &c,
+	}
+	r.stamp, _ = r.statFile()
+	return r
+}
+
+// Run reloads on SIGHUP, file changes and secrets refreshes until ctx is
+// done.
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.path != "" && r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var refresh <-chan time.Time
+	if len(r.current.SecretRefs) > 0 && r.current.SecretsRefreshInterval > 0 {
+		ticker := time.NewTicker(r.current.SecretsRefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.Reload("SIGHUP")
+		case <-tick:
+			if r.fileChanged() {
+				r.Reload("file")
+			}
+		case <-refresh:
+			r.Reload("secrets")
+		}
+	}
+}
+
+// Reload loads the config again and applies the changes to reloadable
+// settings. It returns the changes applied; if loading or applying fails
+// it keeps the current config, logs why and returns the error.
+func (r *Reloader) Reload(trigger string) ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp, _ := r.statFile()
+	opts := r.opts
+	if r.remote != nil {
+		opts = append(opts[:len(opts):len(opts)], WithRemote(r.remote))
+	}
+	next, err := LoadFile(r.path, opts...)
+	if err != nil {
+		r.logger.Error("Config reload failed", "trigger", trigger, logging.Err(err))
+		return nil, err
+	}
+	r.stamp = stamp
+
+	var applied []Change
+	for _, c := range Diff(r.current, next) {
+		if !reloadableFields[c.Field] {
+			r.logger.Warn("Config change needs a restart, ignored", "trigger", trigger, "field", c.Field)
+			continue
+		}
+		applied = append(applied, c)
+	}
+	if len(applied) == 0 {
+		// Secrets refreshes mostly find nothing new; do not log each one.
+		level := slog.LevelInfo
+		if trigger == "secrets" {
+			level = slog.LevelDebug
+		}
+		r.logger.Log(context.Background(), level, "Config reloaded, nothing to apply", "trigger", trigger)
+		return nil, nil
+	}
+
+	updated := *r.current
+	copyReloadable(&updated, next)
+	if err := r.apply(trigger, &updated, applied); err != nil {
+		r.logger.Error("Config reload failed", "trigger", trigger, logging.Err(err))
+		return nil, err
+	}
+	r.current = &updated
+
+	fields := make([]string, len(applied))
+	for i, c := range applied {
+		fields[i] = c.Field
+	}
+	r.logger.Info("Config reloaded", "trigger", trigger, "fields", fields)
+	return applied, nil
+}
+
+// ApplyRemote reloads the config with values, the settings of the remote
+// config store by environment variable, as Reload does. If the reload
+// fails, the settings the store had before stay in effect.
+func (r *Reloader) ApplyRemote(values map[string]string) ([]Change, error) {
+	r.mu.Lock()
+	previous := r.remote
+	r.remote = values
+	r.mu.Unlock()
+
+	applied, err := r.Reload("remote")
+	if err != nil {
+		r.mu.Lock()
+		r.remote = previous
+		r.mu.Unlock()
+	}
+	return applied, err
+}
+
+// fileChanged reports whether the config file differs from the last one
+// loaded.
+func (r *Reloader) fileChanged() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stamp, err := r.statFile()
+	return err == nil && stamp != r.stamp
+}
+
+func (r *Reloader) statFile() (fileStamp, error) {
+	if r.path == "" {
+		return fileStamp{}, nil
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	// A profile may come and go; the environment that names it takes a
+	// restart to change.
+	if info, err := os.Stat(profilePath(r.path, r.current.Environment)); err == nil {
+		stamp.profileModTime, stamp.profileSize = info.ModTime(), info.Size()
+	}
+	return stamp, nil
+}
+
+// copyReloadable copies the reloadable settings of src to dst.
+func copyReloadable(dst, src *Config) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+	for name := range reloadableFields {
+		d.FieldByName(name).Set(s.FieldByName(name))
+	}
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestReloader_Reload(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", `
+server: {port: 8080, log_level: info}
+auth: {jwt_secret: s}
+rate_limit: {requests_per_minute: 60}
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	var got *Config
+	r := NewReloader(path, cfg, 0, func(trigger string, next *Config, changes []Change) error {
+		got = next
+		return nil
+	}, quietLogger())
+
+	if err := os.WriteFile(path, []byte(`
+server: {port: 9090, log_level: debug, cors_allowed_origins: [https://app.example.com]}
+auth: {jwt_secret: s}
+rate_limit: {requests_per_minute: "120:20"}
+`), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	changes, err := r.Reload("SIGHUP")
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, c := range changes {
+		fields[c.Field] = true
+	}
+	if !fields["RateLimit"] || !fields["LogLevel"] || !fields["CORSAllowedOrigins"] {
+		t.Errorf("expected rate limit, log level and CORS changes applied, got %+v", changes)
+	}
+	if fields["Port"] {
+		t.Error("expected the port change rejected")
+	}
+	if got.Port != 8080 || got.RateLimit.PerMinute != 120 || got.RateLimit.Burst != 20 || got.LogLevel != slog.LevelDebug {
+		t.Errorf("unexpected config applied: port %d, rate limit %+v, log level %v", got.Port, got.RateLimit, got.LogLevel)
+	}
+	if cfg.RateLimit.PerMinute != 60 {
+		t.Error("expected the boot config left alone")
+	}
+
+	// Nothing reloadable changed since, so the next reload applies nothing.
+	if changes, err := r.Reload("SIGHUP"); err != nil || len(changes) != 0 {
+		t.Errorf("Reload() = %+v, %v, want no changes", changes, err)
+	}
+}
+
+func TestReloader_ApplyFailure(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", "auth: {jwt_secret: s}\ngrpc: {python_service_addr: a:50051}")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	fail := true
+	r := NewReloader(path, cfg, 0, func(trigger string, next *Config, changes []Change) error {
+		if fail {
+			return errors.New("unreachable")
+		}
+		return nil
+	}, quietLogger())
+
+	os.WriteFile(path, []byte("auth: {jwt_secret: s}\ngrpc: {python_service_addr: b:50051}"), 0o600)
+	if _, err := r.Reload("file"); err == nil {
+		t.Fatal("expected the failed apply reported")
+	}
+
+	// The failed reload was not kept, so the change is applied again.
+	fail = false
+	changes, err := r.Reload("file")
+	if err != nil || len(changes) != 1 || changes[0].Field != "AIBackends" {
+		t.Errorf("Reload() = %+v, %v, want the address change", changes, err)
+	}
+}
+
+func TestReloader_InvalidFile(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", "auth: {jwt_secret: s}")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	r := NewReloader(path, cfg, 0, func(trigger string, next *Config, changes []Change) error {
+		t.Error("apply called for an invalid file")
+		return nil
+	}, quietLogger())
+
+	os.WriteFile(path, []byte("server: {prot: 80}"), 0o600)
+	if _, err := r.Reload("file"); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
+
+func TestReloader_FileChanged(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", "auth: {jwt_secret: s}")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	r := NewReloader(path, cfg, time.Second, func(string, *Config, []Change) error { return nil }, quietLogger())
+
+	if r.fileChanged() {
+		t.Error("expected the loaded file unchanged")
+	}
+	os.WriteFile(path, []byte("auth: {jwt_secret: s}\nserver: {log_level: debug}"), 0o600)
+	if !r.fileChanged() {
+		t.Error("expected the rewritten file changed")
+	}
+	r.Reload("file")
+	if r.fileChanged() {
+		t.Error("expected the reloaded file unchanged")
+	}
+}
+
+func TestReloader_KeepsOverrides(t *testing.T) {
+	path := writeConfigFile(t, "gateway.yaml", "auth: {jwt_secret: s}\nserver: {log_level: info}")
+	opts := []LoadOption{WithOverrides(map[string]string{"LOG_LEVEL": "warn"})}
+	cfg, err := LoadFile(path, opts...)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	r := NewReloader(path, cfg, 0, func(string, *Config, []Change) error { return nil }, quietLogger(), opts...)
+
+	os.WriteFile(path, []byte("auth: {jwt_secret: s}\nserver: {log_level: debug}"), 0o600)
+	changes, err := r.Reload("file")
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected the overridden log level kept, got %+v", changes)
+	}
+}
+
+func TestReloader_ApplyRemote(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("MAINTENANCE_MODE", "false")
+	cfg, err := LoadFile("", WithRemote(map[string]string{"QUOTA_REQUESTS": "100"}))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.QuotaRequests != 100 {
+		t.Fatalf("expected the remote setting applied at boot, got %d", cfg.QuotaRequests)
+	}
+
+	var got *Config
+	r := NewReloader("", cfg, 0, func(trigger string, next *Config, changes []Change) error {
+		got = next
+		return nil
+	}, quietLogger(), WithRemote(map[string]string{"QUOTA_REQUESTS": "100"}))
+
+	// The store takes precedence over the environment.
+	changes, err := r.ApplyRemote(map[string]string{"MAINTENANCE_MODE": "true", "MAINTENANCE_MESSAGE": "Upgrading"})
+	if err != nil {
+		t.Fatalf("ApplyRemote() error = %v", err)
+	}
+	if len(changes) != 3 || !got.MaintenanceMode || got.MaintenanceMessage != "Upgrading" || got.QuotaRequests != 0 {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	// Settings a reload cannot apply are refused, and the store's last
+	// good settings stay in effect.
+	_, err = r.ApplyRemote(map[string]string{"PORT": "9090"})
+	if err == nil || !strings.Contains(err.Error(), "PORT cannot be set in the remote config store") {
+		t.Errorf("ApplyRemote() error = %v", err)
+	}
+	_, err = r.ApplyRemote(map[string]string{"QUOTA_TOKENS": "-1"})
+	if err == nil || !strings.Contains(err.Error(), "(set in the remote config store)") {
+		t.Errorf("ApplyRemote() error = %v", err)
+	}
+	if changes, err := r.Reload("SIGHUP"); err != nil || len(changes) != 0 {
+		t.Errorf("Reload() = %+v, %v, want no changes", changes, err)
+	}
+}
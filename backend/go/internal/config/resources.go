@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// reservedFiles is the number of file descriptors left for what the
+// gateway opens besides WebSocket and backend connections: listeners, HTTP
+// requests, Redis, log and config files.
+const reservedFiles = 256
+
+// maxShardsPerCPU bounds WS_HUB_SHARDS: past a few dozen shards per CPU,
+// more only cost memory.
+const maxShardsPerCPU = 64
+
+// openFileLimit and cpus report the resources of the process; tests replace
+// them.
+var (
+	openFileLimit = fileLimit
+	cpus          = func() int { return runtime.GOMAXPROCS(0) }
+)
+
+// checkResources records a problem with the capacity settings of cfg that
+// the process cannot provide: more connections than it may open files, or
+// more hub shards than its CPUs can use.
+func checkResources(p *parser, cfg *Config) {
+	if limit := openFileLimit(); limit > 0 {
+		files := reservedFiles + cfg.WSMaxConnections + cfg.GRPCPoolSize*len(cfg.AIBackends)
+		p.require(uint64(files) <= limit,
+			fmt.Sprintf("WS_MAX_CONNECTIONS and GRPC_POOL_SIZE need about %d file descriptors, but the limit is %d; lower them or raise ulimit -n", files, limit),
+			"WS_MAX_CONNECTIONS", "GRPC_POOL_SIZE")
+	}
+	p.require(cfg.WSHubShards <= maxShardsPerCPU*cpus(),
+		fmt.Sprintf("WS_HUB_SHARDS must be at most %d with %d CPUs", maxShardsPerCPU*cpus(), cpus()), "WS_HUB_SHARDS")
+}
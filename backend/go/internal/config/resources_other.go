@@ -0,0 +1,8 @@
+//go:build !unix
+
+package config
+
+// fileLimit returns 0: the limit on open files is unknown here.
+func fileLimit() uint64 {
+	return 0
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad_Resources(t *testing.T) {
+	limit, cpuCount := openFileLimit, cpus
+	t.Cleanup(func() { openFileLimit, cpus = limit, cpuCount })
+	openFileLimit = func() uint64 { return 1024 }
+	cpus = func() int { return 2 }
+
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("GRPC_POOL_SIZE", "4")
+	t.Setenv("GRPC_MAX_STREAMS", "100")
+	t.Setenv("USER_MAX_CONCURRENT_REQUESTS", "3")
+	t.Setenv("WS_MAX_CONNECTIONS", "700")
+	t.Setenv("WS_HUB_SHARDS", "128")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GRPCPoolSize != 4 || cfg.GRPCMaxStreams != 100 || cfg.UserMaxConcurrentRequests != 3 {
+		t.Errorf("unexpected limits %d %d %d", cfg.GRPCPoolSize, cfg.GRPCMaxStreams, cfg.UserMaxConcurrentRequests)
+	}
+
+	t.Setenv("WS_MAX_CONNECTIONS", "1000")
+	t.Setenv("WS_HUB_SHARDS", "129")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "need about 1260 file descriptors, but the limit is 1024") ||
+		!strings.Contains(err.Error(), "WS_HUB_SHARDS must be at most 128 with 2 CPUs") {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	t.Setenv("GRPC_POOL_SIZE", "0")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "GRPC_POOL_SIZE must be positive") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package config
+
+import "syscall"
+
+// fileLimit returns the soft limit on the files the process may open, or 0
+// if it is unknown.
+func fileLimit() uint64 {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0
+	}
+	return uint64(rlim.Cur)
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLength and minSecretEntropy bound JWT_SECRET in production: HS256
+// wants a key of at least 256 bits, and a long secret of few distinct
+// characters is no better than a short one.
+const (
+	minSecretLength  = 32
+	minSecretEntropy = 96
+)
+
+// ValidationError lists every problem found loading a config.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	msgs := make([]string, len(e.Problems))
+	for i, err := range e.Problems {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d config problems: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// parser reads settings from a source and collects every problem with
+// them, rather than stopping at the first, so they can be fixed at once.
+type parser struct {
+	src      *source
+	problems []error
+	// failed are the settings found invalid, which further checks of their
+	// values skip.
+	failed map[string]bool
+	// refs are the secret references sensitive settings were resolved from.
+	refs map[string]string
+}
+
+func newParser(src *source) *parser {
+	return &parser{src: src, failed: make(map[string]bool), refs: make(map[string]string)}
+}
+
+func (p *parser) get(key, defaultValue string) string {
+	return p.src.get(key, defaultValue)
+}
+
+// fail records that the value of key is invalid.
+func (p *parser) fail(key string, err error) {
+	p.reject(key, fmt.Errorf("invalid %s: %w", key, err))
+}
+
+// reject records err as the problem with key, unless it already has one.
+func (p *parser) reject(key string, err error) {
+	if p.failed[key] {
+		return
+	}
+	p.failed[key] = true
+	p.problems = append(p.problems, p.src.explain(err))
+}
+
+// require records msg as a problem unless ok, or unless one of keys, the
+// settings it is about, is already invalid.
+func (p *parser) require(ok bool, msg string, keys ...string) {
+	if ok {
+		return
+	}
+	for _, key := range keys {
+		if p.failed[key] {
+			return
+		}
+	}
+	p.problems = append(p.problems, p.src.explain(fmt.Errorf("%s", msg)))
+}
+
+// err returns the problems found, if any.
+func (p *parser) err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p.problems}
+}
+
+func (p *parser) int(key, defaultValue string) int {
+	return parse(p, key, defaultValue, strconv.Atoi)
+}
+
+func (p *parser) int64(key, defaultValue string) int64 {
+	return parse(p, key, defaultValue, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+}
+
+func (p *parser) float(key, defaultValue string) float64 {
+	return parse(p, key, defaultValue, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+}
+
+func (p *parser) bool(key, defaultValue string) bool {
+	return parse(p, key, defaultValue, strconv.ParseBool)
+}
+
+func (p *parser) duration(key, defaultValue string) time.Duration {
+	return parse(p, key, defaultValue, time.ParseDuration)
+}
+
+// secret returns the sensitive setting key, resolving it from a secrets
+// manager if it is a secret reference.
+func (p *parser) secret(key, defaultValue string) string {
+	value := p.get(key, defaultValue)
+	resolved, err := p.resolve(key, value)
+	if err != nil {
+		p.fail(key, err)
+		return ""
+	}
+	return resolved
+}
+
+// secretList returns the sensitive list setting key, resolving each item
+// that is a secret reference.
+func (p *parser) secretList(key, defaultValue string) []string {
+	items := splitList(p.get(key, defaultValue))
+	for i, item := range items {
+		resolved, err := p.resolve(key, item)
+		if err != nil {
+			p.fail(key, err)
+			return nil
+		}
+		items[i] = resolved
+	}
+	return items
+}
+
+func (p *parser) resolve(key, value string) (string, error) {
+	if p.src.secrets == nil || !p.src.secrets.IsRef(value) {
+		return value, nil
+	}
+	if ref, ok := p.refs[key]; ok {
+		p.refs[key] = ref + "," + value
+	} else {
+		p.refs[key] = value
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	return p.src.secrets.Resolve(ctx, value)
+}
+
+// secretsTimeout bounds resolving each secret reference.
+const secretsTimeout = 15 * time.Second
+
+// fileExists records a problem with key unless path, if set, is a readable
+// file.
+func (p *parser) fileExists(key, path string) {
+	if path == "" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		p.fail(key, err)
+	}
+}
+
+// parse returns the setting key parsed by fn, or the zero value if it is
+// invalid.
+func parse[T any](p *parser, key, defaultValue string, fn func(string) (T, error)) T {
+	v, err := fn(p.get(key, defaultValue))
+	if err != nil {
+		p.fail(key, err)
+		var zero T
+		return zero
+	}
+	return v
+}
+
+// positive records a problem with key unless v is positive.
+func positive[T cmp.Ordered](p *parser, key string, v T) {
+	var zero T
+	if v <= zero {
+		p.reject(key, fmt.Errorf("%s must be positive", key))
+	}
+}
+
+// nonNegative records a problem with key if v is negative.
+func nonNegative[T cmp.Ordered](p *parser, key string, v T) {
+	var zero T
+	if v < zero {
+		p.reject(key, fmt.Errorf("%s must not be negative", key))
+	}
+}
+
+// entropy estimates the bits of entropy of s from the frequencies of its
+// characters.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var perChar float64
+	for _, c := range counts {
+		f := float64(c) / float64(n)
+		perChar -= f * math.Log2(f)
+	}
+	return perChar * float64(n)
+}
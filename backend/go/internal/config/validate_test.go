@@ -0,0 +1,439 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/secrets"
+)
+
+func TestLoad_ReportsEveryProblem(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("PORT", "70000")
+	t.Setenv("WS_PONG_WAIT", "soon")
+	t.Setenv("LOGIN_DELAY", "1m")
+	t.Setenv("LOGIN_MAX_DELAY", "10s")
+	t.Setenv("AUTH_ACCESS_TOKEN_TTL", "48h")
+	t.Setenv("AUTH_REFRESH_TOKEN_TTL", "24h")
+
+	_, err := Load()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Load() error = %v, want a ValidationError", err)
+	}
+
+	want := []string{
+		"PORT must be between 1 and 65535",
+		"invalid WS_PONG_WAIT",
+		"LOGIN_MAX_DELAY must be at least LOGIN_DELAY",
+		"AUTH_REFRESH_TOKEN_TTL must be longer than AUTH_ACCESS_TOKEN_TTL",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d: %v", len(want), len(verr.Problems), err)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("expected %q among the problems, got %v", w, err)
+		}
+	}
+	// WS_PING_PERIOD defaults from WS_PONG_WAIT, so it is not reported too.
+	if strings.Contains(err.Error(), "WS_PING_PERIOD") {
+		t.Errorf("expected no WS_PING_PERIOD problem, got %v", err)
+	}
+}
+
+func TestLoad_RangeCheckedOnce(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("WS_PONG_WAIT", "-1s")
+
+	_, err := Load()
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("Load() error = %v, want only WS_PONG_WAIT", err)
+	}
+	if !strings.Contains(err.Error(), "WS_PONG_WAIT must be positive") {
+		t.Errorf("unexpected problem %v", err)
+	}
+}
+
+func TestLoad_TLSFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("TLS_CERT_FILE", missing)
+	t.Setenv("TLS_KEY_FILE", t.TempDir())
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected missing TLS files to be reported")
+	}
+	if !strings.Contains(err.Error(), "invalid TLS_CERT_FILE") || !strings.Contains(err.Error(), "TLS_KEY_FILE") {
+		t.Errorf("expected both TLS files reported, got %v", err)
+	}
+}
+
+func TestLoad_ProductionSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{"short", "correct-horse", "must be at least 32 characters"},
+		{"repetitive", strings.Repeat("ab", 20), "too predictable"},
+		{"random", "q8Zt3vN1xKpW7mRb2LcY9sHdF4gJ6aEu0TnVoXiQ5", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVIRONMENT", "production")
+			t.Setenv("JWT_SECRET", tt.secret)
+
+			_, err := Load()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Load() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("development", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "dev")
+		if _, err := Load(); err != nil {
+			t.Errorf("expected any secret outside production, got %v", err)
+		}
+	})
+}
+
+func TestEntropy(t *testing.T) {
+	if e := entropy(strings.Repeat("a", 64)); e != 0 {
+		t.Errorf("entropy of a repeated character = %v, want 0", e)
+	}
+	if e := entropy("abcd"); e != 8 {
+		t.Errorf("entropy(abcd) = %v, want 8", e)
+	}
+}
+
+type fakeSecrets map[string]map[string]string
+
+func (f fakeSecrets) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	fields, ok := f[path]
+	if !ok {
+		return nil, fmt.Errorf("secret %s not found", path)
+	}
+	return fields, nil
+}
+
+func TestLoad_SecretRefs(t *testing.T) {
+	vault := fakeSecrets{"gateway": {"jwt_secret": "from-vault", "old": "previous", "admin": "adm"}}
+	src := &source{secrets: secrets.NewResolver(secrets.WithProvider(secrets.SchemeVault, vault))}
+	t.Setenv("JWT_SECRET", "vault:gateway#jwt_secret")
+	t.Setenv("JWT_PREVIOUS_SECRETS", "vault:gateway#old,plain")
+	t.Setenv("ADMIN_TOKEN", "vault:gateway#admin")
+	// Settings that are not sensitive are never resolved.
+	t.Setenv("PYTHON_SERVICE_ADDR", "vault:8200")
+
+	cfg, err := load(src)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if cfg.JWTSecret != "from-vault" || cfg.AdminToken != "adm" {
+		t.Errorf("expected secrets resolved, got JWTSecret %q, AdminToken %q", cfg.JWTSecret, cfg.AdminToken)
+	}
+	if !slices.Equal(cfg.JWTPreviousSecrets, []string{"previous", "plain"}) {
+		t.Errorf("JWTPreviousSecrets = %v", cfg.JWTPreviousSecrets)
+	}
+	if cfg.AIBackends[0].Addr != "vault:8200" {
+		t.Errorf("AIBackends[0].Addr = %q", cfg.AIBackends[0].Addr)
+	}
+	if cfg.SecretRefs["JWT_SECRET"] != "vault:gateway#jwt_secret" || len(cfg.SecretRefs) != 3 {
+		t.Errorf("SecretRefs = %v", cfg.SecretRefs)
+	}
+
+	t.Setenv("JWT_SECRET", "vault:gateway#missing")
+	t.Setenv("NOTIFY_TOKEN", "aws-sm:prod/notify")
+	_, err = load(src)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 2 {
+		t.Fatalf("load() error = %v, want JWT_SECRET and NOTIFY_TOKEN", err)
+	}
+	if !strings.Contains(err.Error(), `invalid JWT_SECRET: vault:gateway#missing: no field "missing"`) ||
+		!strings.Contains(err.Error(), "invalid NOTIFY_TOKEN: aws-sm:prod/notify: set AWS_REGION") {
+		t.Errorf("unexpected problems %v", err)
+	}
+}
+
+func TestLoad_TLSFromSecrets(t *testing.T) {
+	cert, key := selfSignedPEM(t)
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("TLS_CERT", cert)
+	t.Setenv("TLS_KEY", key)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.TLSCert != cert || cfg.TLSKey != key {
+		t.Error("expected the PEM certificate and key loaded")
+	}
+
+	t.Setenv("TLS_KEY", "not a key")
+	t.Setenv("TLS_CERT_FILE", filepath.Join(t.TempDir(), "cert.pem"))
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid TLS_KEY") ||
+		!strings.Contains(err.Error(), "TLS_CERT and TLS_CERT_FILE are mutually exclusive") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func selfSignedPEM(t *testing.T) (cert, key string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return cert, key
+}
+
+func TestLoad_HTTPTimeouts(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.HTTPReadTimeout != 15*time.Second || cfg.HTTPWriteTimeout != 15*time.Second || cfg.HTTPIdleTimeout != time.Minute ||
+		cfg.HTTPStreamTimeout != 10*time.Minute || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("unexpected defaults %v %v %v %v %v", cfg.HTTPReadTimeout, cfg.HTTPWriteTimeout, cfg.HTTPIdleTimeout, cfg.HTTPStreamTimeout, cfg.ShutdownTimeout)
+	}
+
+	t.Setenv("HTTP_WRITE_TIMEOUT", "1m")
+	t.Setenv("HTTP_STREAM_TIMEOUT", "30s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "0s")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "HTTP_STREAM_TIMEOUT must be at least HTTP_WRITE_TIMEOUT") ||
+		!strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT must be positive") {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	// Unbounded streams are fine whatever the write timeout.
+	t.Setenv("HTTP_STREAM_TIMEOUT", "0s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "5s")
+	if _, err := Load(); err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_Autocert(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("TLS_AUTOCERT_HOSTS", "api.neuronai.app, chat.neuronai.app")
+	t.Setenv("HTTP_REDIRECT_ADDR", ":80")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.TLSEnabled() || !slices.Equal(cfg.TLSAutocertHosts, []string{"api.neuronai.app", "chat.neuronai.app"}) {
+		t.Errorf("expected TLS from autocert, got hosts %v", cfg.TLSAutocertHosts)
+	}
+
+	t.Setenv("TLS_AUTOCERT_HOSTS", "https://api.neuronai.app")
+	t.Setenv("TLS_CERT_FILE", filepath.Join(t.TempDir(), "cert.pem"))
+	_, err = Load()
+	for _, want := range []string{`"https://api.neuronai.app" is not a host name`, "TLS_AUTOCERT_HOSTS and TLS_CERT_FILE or TLS_CERT are mutually exclusive"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, want %q", err, want)
+		}
+	}
+
+	t.Setenv("TLS_AUTOCERT_HOSTS", "")
+	t.Setenv("TLS_CERT_FILE", "")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "HTTP_REDIRECT_ADDR requires") {
+		t.Errorf("Load() error = %v, want the redirect refused without TLS", err)
+	}
+}
+
+func TestLoad_WSCompression(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.WSCompression || cfg.WSCompressionLevel != 1 || cfg.WSCompressionMinSize != 256 {
+		t.Errorf("unexpected defaults %v %d %d", cfg.WSCompression, cfg.WSCompressionLevel, cfg.WSCompressionMinSize)
+	}
+
+	t.Setenv("WS_COMPRESSION_LEVEL", "10")
+	t.Setenv("WS_COMPRESSION_MIN_SIZE", "-1")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "WS_COMPRESSION_LEVEL must be between -2 and 9") ||
+		!strings.Contains(err.Error(), "WS_COMPRESSION_MIN_SIZE") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_ClientIPHeader(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ClientIPHeader != "X-Forwarded-For" {
+		t.Errorf("expected X-Forwarded-For by default, got %q", cfg.ClientIPHeader)
+	}
+
+	t.Setenv("CLIENT_IP_HEADER", "cf-connecting-ip")
+	if cfg, err = Load(); err != nil || cfg.ClientIPHeader != "CF-Connecting-IP" {
+		t.Errorf("Load() = %q, %v", cfg.ClientIPHeader, err)
+	}
+
+	t.Setenv("CLIENT_IP_HEADER", "Forwarded")
+	t.Setenv("RATE_LIMIT_TRUST_PROXY", "true")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid CLIENT_IP_HEADER: must be X-Forwarded-For, X-Real-IP, CF-Connecting-IP") ||
+		!strings.Contains(err.Error(), "RATE_LIMIT_TRUST_PROXY has been replaced by TRUSTED_PROXIES and CLIENT_IP_HEADER") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_GuestRateLimitKey(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GuestRateLimit.Key != LimitKeyIP {
+		t.Errorf("expected guests limited per client IP, got %v", cfg.GuestRateLimit)
+	}
+
+	t.Setenv("GUEST_RATE_LIMIT", "10;key=user")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "GUEST_RATE_LIMIT is kept per client IP and takes no key") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_RemoteConfig(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("REMOTE_CONFIG", "consul")
+	t.Setenv("REMOTE_CONFIG_ENDPOINTS", "http://consul-1:8500, https://consul-2:8501")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.RemoteConfigEndpoints) != 2 || cfg.RemoteConfigPrefix != "neuronai/gateway/" {
+		t.Errorf("unexpected endpoints %v, prefix %q", cfg.RemoteConfigEndpoints, cfg.RemoteConfigPrefix)
+	}
+
+	t.Setenv("REMOTE_CONFIG", "zookeeper")
+	t.Setenv("REMOTE_CONFIG_ENDPOINTS", "consul-1:8500")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "REMOTE_CONFIG must be etcd or consul") ||
+		!strings.Contains(err.Error(), `REMOTE_CONFIG_ENDPOINTS must be http:// or https:// URLs, got "consul-1:8500"`) {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	t.Setenv("REMOTE_CONFIG", "etcd")
+	t.Setenv("REMOTE_CONFIG_ENDPOINTS", "")
+	if _, err = Load(); err == nil || !strings.Contains(err.Error(), "REMOTE_CONFIG requires REMOTE_CONFIG_ENDPOINTS") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_AIBackends(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("GRPC_INSECURE", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.AIBackends) != 1 || cfg.AIBackends[0].String() != "python=localhost:50051;tls=false;weight=1" {
+		t.Errorf("expected the default backend, got %v", cfg.AIBackends)
+	}
+
+	tests := []struct {
+		backends string
+		wantErr  string
+	}{
+		{"a=x:1,b=y:1;agents=code;weight=2", ""},
+		{"a=x:1;agents=code", "needs a backend without agents"},
+		{"a=x:1,a=y:1", "backend a is defined twice"},
+		{"a", "expected name=addr"},
+		{"a=x:1;weight=0", "backend a: weight must be positive"},
+		{"a=x:1;agents=chef", `unknown agent "chef"`},
+		{"a=x:1;color=red", `unknown option "color=red"`},
+	}
+	for _, tt := range tests {
+		t.Setenv("AI_BACKENDS", tt.backends)
+		_, err := Load()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("AI_BACKENDS=%s: Load() error = %v", tt.backends, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("AI_BACKENDS=%s: Load() error = %v, want %q", tt.backends, err, tt.wantErr)
+		}
+	}
+
+	t.Setenv("AI_BACKENDS", "a=x:1")
+	t.Setenv("PYTHON_SERVICE_ADDR", "y:1")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "set AI_BACKENDS or PYTHON_SERVICE_ADDR, not both") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_PreviousSecretsUntil(t *testing.T) {
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("JWT_PREVIOUS_SECRETS_UNTIL", "2024-07-01T00:00:00Z")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "JWT_PREVIOUS_SECRETS_UNTIL requires JWT_PREVIOUS_SECRETS") {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	t.Setenv("JWT_PREVIOUS_SECRETS", "old")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC); !cfg.JWTPreviousSecretsUntil.Equal(want) {
+		t.Errorf("JWTPreviousSecretsUntil = %v, want %v", cfg.JWTPreviousSecretsUntil, want)
+	}
+
+	t.Setenv("JWT_PREVIOUS_SECRETS_UNTIL", "next week")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "invalid JWT_PREVIOUS_SECRETS_UNTIL") {
+		t.Errorf("Load() error = %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/redact"
+	hub "github.com/neuronai/backend/go/internal/websocket"
+)
+
+// subprotocol is the graphql-transport-ws protocol spoken by graphql-ws and
+// Apollo clients.
+const subprotocol = "graphql-transport-ws"
+
+const (
+	writeWait       = 10 * time.Second
+	initWait        = 10 * time.Second
+	maxMessageSize  = 64 * 1024
+	maxRequestBytes = 1 << 20
+)
+
+type Handler struct {
+	schema   *graphqlgo.Schema
+	upgrader websocket.Upgrader
+	redact   *redact.Redactor
+}
+
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithRedactor masks personal data and credentials in the error messages of
+// results.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(h *Handler) {
+		h.redact = r
+	}
+}
+
+func NewHandler(wsHub *hub.Hub, opts ...Option) *Handler {
+	h := &Handler{
+		schema: graphqlgo.MustParseSchema(schemaString, &resolver{hub: wsHub}),
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{subprotocol},
+			CheckOrigin:  checkOrigin,
+		},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// checkOrigin refuses upgrades from pages served by another host. Browsers
+// cannot set an Authorization header on upgrades, so theirs authenticate
+// with the session cookie, which any site's page would send along. Clients
+// that are not browsers send no Origin header.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// redactErrors masks the error messages of resp.
+func (h *Handler) redactErrors(resp *graphqlgo.Response) {
+	for _, e := range resp.Errors {
+		e.Message = h.redact.String(e.Message)
+	}
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	// Extensions, such as persisted query hashes, are accepted but not
+	// supported.
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
+
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := middleware.DecodeJSON(http.MaxBytesReader(w, r.Body, maxRequestBytes), &req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				middleware.WriteBodyTooLarge(w, maxErr.Limit)
+				return
+			}
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	h.redactErrors(resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// wsMessage is a graphql-transport-ws protocol message.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn serializes writes from concurrently running subscriptions.
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *wsConn) write(msg wsMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *wsConn) close(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeWait))
+	c.conn.Close()
+}
+
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "GraphQL WebSocket upgrade failed", logging.Err(err))
+		return
+	}
+	c := &wsConn{conn: conn}
+
+	if conn.Subprotocol() != subprotocol {
+		c.close(websocket.CloseProtocolError, "unsupported subprotocol")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(initWait))
+
+	var (
+		mu            sync.Mutex
+		subscriptions = make(map[string]context.CancelFunc)
+		acknowledged  bool
+	)
+	defer func() {
+		mu.Lock()
+		for _, stop := range subscriptions {
+			stop()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if !acknowledged {
+				c.close(4408, "Connection initialisation timeout")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			if acknowledged {
+				c.close(4429, "Too many initialisation requests")
+				return
+			}
+			acknowledged = true
+			conn.SetReadDeadline(time.Time{})
+			c.write(wsMessage{Type: "connection_ack"})
+
+		case "ping":
+			c.write(wsMessage{Type: "pong"})
+
+		case "pong":
+
+		case "subscribe":
+			if !acknowledged {
+				c.close(4401, "Unauthorized")
+				return
+			}
+
+			var req request
+			if err := json.Unmarshal(msg.Payload, &req); err != nil || msg.ID == "" {
+				c.close(4400, "Invalid subscribe message")
+				return
+			}
+
+			mu.Lock()
+			if _, exists := subscriptions[msg.ID]; exists {
+				mu.Unlock()
+				c.close(4409, "Subscriber for "+msg.ID+" already exists")
+				return
+			}
+			subCtx, stop := context.WithCancel(ctx)
+			subscriptions[msg.ID] = stop
+			mu.Unlock()
+
+			go func(id string) {
+				h.runSubscription(subCtx, c, id, req)
+				mu.Lock()
+				delete(subscriptions, id)
+				mu.Unlock()
+				stop()
+			}(msg.ID)
+
+		case "complete":
+			mu.Lock()
+			if stop, ok := subscriptions[msg.ID]; ok {
+				stop()
+				delete(subscriptions, msg.ID)
+			}
+			mu.Unlock()
+
+		default:
+			c.close(4400, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// runSubscription executes one operation and forwards its results. Queries
+// and mutations sent over the socket yield a single result.
+func (h *Handler) runSubscription(ctx context.Context, c *wsConn, id string, req request) {
+	results, err := h.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		payload, _ := json.Marshal([]map[string]string{{"message": h.redact.Error(err)}})
+		c.write(wsMessage{ID: id, Type: "error", Payload: payload})
+		return
+	}
+
+	for result := range results {
+		resp, ok := result.(*graphqlgo.Response)
+		if !ok {
+			continue
+		}
+		h.redactErrors(resp)
+		payload, err := json.Marshal(resp)
+		if err != nil {
+			slog.Error("Failed to marshal GraphQL result", logging.Err(err))
+			continue
+		}
+		if err := c.write(wsMessage{ID: id, Type: "next", Payload: payload}); err != nil {
+			return
+		}
+	}
+
+	if ctx.Err() == nil {
+		c.write(wsMessage{ID: id, Type: "complete"})
+	}
+}
@@ -0,0 +1,238 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/middleware"
+	hub "github.com/neuronai/backend/go/internal/websocket"
+	googlegrpc "google.golang.org/grpc"
+)
+
+type mockAIService struct {
+	pb.UnimplementedAIServiceServer
+}
+
+func (m *mockAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	for i, chunk := range []string{"Hello", " world"} {
+		if err := stream.Send(&pb.StreamResponse{
+			SessionId: req.SessionId,
+			Payload: &pb.StreamResponse_Chat{
+				Chat: &pb.ChatResponse{
+					MessageId: "msg-1",
+					SessionId: req.SessionId,
+					Content:   chunk,
+					AgentType: pb.AgentType_AGENT_TYPE_WRITER,
+					Status:    pb.TaskStatus_TASK_STATUS_IN_PROGRESS,
+					IsFinal:   i == 1,
+				},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	_, err = stream.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func setupHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := googlegrpc.NewServer()
+	pb.RegisterAIServiceServer(s, &mockAIService{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	client, err := grpc.NewPythonClient(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	wsHub := hub.NewHub(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	go wsHub.Run(ctx)
+	t.Cleanup(cancel)
+
+	h := NewHandler(wsHub)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &middleware.Claims{UserID: "user-1"}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.GetClaimsContextKey(), claims)))
+	})
+}
+
+func TestHandler_Query(t *testing.T) {
+	handler := setupHandler(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		contains string
+	}{
+		{"agents over POST", http.MethodPost, `{ agents { type name } }`, `{"type":"orchestrator","name":"Orchestrator"}`},
+		{"agents over GET", http.MethodGet, `{ agents { type } }`, `{"type":"video"}`},
+		{"no open sessions", http.MethodPost, `{ sessions { id } }`, `{"data":{"sessions":[]}}`},
+		{"unknown session", http.MethodPost, `{ session(id: "nope") { id } }`, `{"data":{"session":null}}`},
+		{"send message", http.MethodPost, `mutation { sendMessage(input: {sessionId: "s1", content: "hi"}) { content isFinal agent { type } } }`,
+			`{"content":"Hello world","isFinal":true,"agent":{"type":"writer"}}`},
+		{"invalid query", http.MethodPost, `{ nope }`, `"errors"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.method == http.MethodGet {
+				req = httptest.NewRequest(http.MethodGet, "/graphql?query="+strings.ReplaceAll(tt.query, " ", "+"), nil)
+			} else {
+				body, _ := json.Marshal(request{Query: tt.query})
+				req = httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("expected response to contain %s, got %s", tt.contains, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	handler := NewHandler(hub.NewHub(nil))
+
+	body, _ := json.Marshal(request{Query: `{ sessions { id } }`})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), errUnauthorized.Error()) {
+		t.Errorf("expected unauthorized error, got %s", rec.Body.String())
+	}
+}
+
+func TestHandler_Subscription(t *testing.T) {
+	srv := httptest.NewServer(setupHandler(t))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteJSON(wsMessage{Type: "connection_init"}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %+v (%v)", msg, err)
+	}
+
+	payload, _ := json.Marshal(request{Query: `subscription { chat(input: {sessionId: "s1", content: "hi"}) { content isFinal } }`})
+	if err := conn.WriteJSON(wsMessage{ID: "1", Type: "subscribe", Payload: payload}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	var chunks []string
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if msg.Type == "complete" {
+			break
+		}
+		if msg.Type != "next" || msg.ID != "1" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+
+		var result struct {
+			Data struct {
+				Chat struct {
+					Content string `json:"content"`
+				} `json:"chat"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Payload, &result); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		chunks = append(chunks, result.Data.Chat.Content)
+	}
+
+	if strings.Join(chunks, "|") != "Hello| world" {
+		t.Errorf("expected chunks [Hello,  world], got %q", chunks)
+	}
+}
+
+type loginSessions map[string]*middleware.Claims
+
+func (s loginSessions) Resolve(id string) (*middleware.Claims, bool) {
+	claims, ok := s[id]
+	return claims, ok
+}
+
+func TestHandler_SubscriptionChecksOrigin(t *testing.T) {
+	sessions := loginSessions{"cookie-1": {UserID: "user-1"}}
+	auth := middleware.JWTAuth("secret", middleware.WithSessions(sessions))
+	srv := httptest.NewServer(auth(NewHandler(hub.NewHub(nil))))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{"same origin", srv.URL, http.StatusSwitchingProtocols},
+		{"cross origin", "https://evil.example", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Origin", tt.origin)
+			header.Set("Cookie", middleware.SessionCookie+"=cookie-1")
+
+			dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+			conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+			if err == nil {
+				conn.Close()
+			}
+			if resp == nil || resp.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %v (%v)", tt.want, resp, err)
+			}
+		})
+	}
+}
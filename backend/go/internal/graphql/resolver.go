@@ -0,0 +1,215 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/websocket"
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+type resolver struct {
+	hub *websocket.Hub
+}
+
+type chatInput struct {
+	SessionID   graphqlgo.ID
+	Content     string
+	MessageType *string
+}
+
+func userID(ctx context.Context) (string, error) {
+	claims, ok := middleware.GetClaims(ctx)
+	if !ok {
+		return "", errUnauthorized
+	}
+	return claims.UserID, nil
+}
+
+func (r *resolver) Sessions(ctx context.Context) ([]*sessionResolver, error) {
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := r.hub.Sessions(user)
+	resolvers := make([]*sessionResolver, 0, len(sessions))
+	for id, n := range sessions {
+		resolvers = append(resolvers, &sessionResolver{id: id, connections: n})
+	}
+	sort.Slice(resolvers, func(i, j int) bool {
+		return resolvers[i].id < resolvers[j].id
+	})
+	return resolvers, nil
+}
+
+func (r *resolver) Session(ctx context.Context, args struct{ ID graphqlgo.ID }) (*sessionResolver, error) {
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	n, ok := r.hub.Sessions(user)[string(args.ID)]
+	if !ok {
+		return nil, nil
+	}
+	return &sessionResolver{id: string(args.ID), connections: n}, nil
+}
+
+func (r *resolver) Agents() []*agentResolver {
+	agents := make([]*agentResolver, 0, len(pb.AgentType_name))
+	for v := range pb.AgentType_name {
+		if pb.AgentType(v) == pb.AgentType_AGENT_TYPE_UNSPECIFIED {
+			continue
+		}
+		agents = append(agents, &agentResolver{agentType: pb.AgentType(v)})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].agentType < agents[j].agentType
+	})
+	return agents
+}
+
+func (r *resolver) SendMessage(ctx context.Context, args struct{ Input chatInput }) (*messageResolver, error) {
+	chat, err := newChatRequest(ctx, args.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	var last *pb.ChatResponse
+	err = r.hub.Stream(ctx, &websocket.StreamRequest{
+		Chat:      chat,
+		Transport: metrics.TransportGraphQL,
+		OnResponse: func(resp *pb.ChatResponse) {
+			content.WriteString(resp.Content)
+			last = resp
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, errors.New("no response from AI service")
+	}
+
+	return &messageResolver{resp: last, content: content.String()}, nil
+}
+
+func (r *resolver) Chat(ctx context.Context, args struct{ Input chatInput }) (<-chan *messageResolver, error) {
+	chat, err := newChatRequest(ctx, args.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *messageResolver)
+	go func() {
+		defer close(out)
+		err := r.hub.Stream(ctx, &websocket.StreamRequest{
+			Chat:      chat,
+			Transport: metrics.TransportGraphQL,
+			OnResponse: func(resp *pb.ChatResponse) {
+				select {
+				case out <- &messageResolver{resp: resp, content: resp.Content}:
+				case <-ctx.Done():
+				}
+			},
+		})
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "GraphQL chat subscription failed", logging.KeyUserID, chat.UserId, logging.Err(err))
+		}
+	}()
+	return out, nil
+}
+
+func newChatRequest(ctx context.Context, input chatInput) (*pb.ChatRequest, error) {
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if input.Content == "" {
+		return nil, errors.New("content is required")
+	}
+
+	chat := &pb.ChatRequest{
+		SessionId:   string(input.SessionID),
+		UserId:      user,
+		Content:     input.Content,
+		MessageType: pb.MessageType_MESSAGE_TYPE_TEXT,
+	}
+	if input.MessageType != nil {
+		v, ok := pb.MessageType_value["MESSAGE_TYPE_"+strings.ToUpper(*input.MessageType)]
+		if !ok {
+			return nil, errors.New("unknown message type")
+		}
+		chat.MessageType = pb.MessageType(v)
+	}
+	return chat, nil
+}
+
+type sessionResolver struct {
+	id          string
+	connections int
+}
+
+func (s *sessionResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(s.id)
+}
+
+func (s *sessionResolver) Connections() int32 {
+	return int32(s.connections)
+}
+
+type messageResolver struct {
+	resp    *pb.ChatResponse
+	content string
+}
+
+func (m *messageResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(m.resp.MessageId)
+}
+
+func (m *messageResolver) SessionID() graphqlgo.ID {
+	return graphqlgo.ID(m.resp.SessionId)
+}
+
+func (m *messageResolver) Content() string {
+	return m.content
+}
+
+func (m *messageResolver) Agent() *agentResolver {
+	return &agentResolver{agentType: m.resp.AgentType}
+}
+
+func (m *messageResolver) Status() string {
+	return strings.ToLower(strings.TrimPrefix(m.resp.Status.String(), "TASK_STATUS_"))
+}
+
+func (m *messageResolver) IsFinal() bool {
+	return m.resp.IsFinal
+}
+
+type agentResolver struct {
+	agentType pb.AgentType
+}
+
+func (a *agentResolver) Type() string {
+	return strings.ToLower(strings.TrimPrefix(a.agentType.String(), "AGENT_TYPE_"))
+}
+
+func (a *agentResolver) Name() string {
+	name := a.Type()
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
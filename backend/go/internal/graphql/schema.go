@@ -0,0 +1,55 @@
+// Package graphql exposes sessions, messages and agents as a GraphQL graph.
+// Queries and mutations are served over HTTP; subscriptions use the
+// graphql-transport-ws protocol and stream chats through the WebSocket hub.
+package graphql
+
+const schemaString = `
+schema {
+	query: Query
+	mutation: Mutation
+	subscription: Subscription
+}
+
+type Query {
+	# Sessions the caller has open on the WebSocket hub.
+	sessions: [Session!]!
+	session(id: ID!): Session
+	# The agents the AI service can route to.
+	agents: [Agent!]!
+}
+
+type Mutation {
+	# Sends a message and returns the complete reply.
+	sendMessage(input: ChatInput!): Message!
+}
+
+type Subscription {
+	# Sends a message and streams the reply as it is generated.
+	chat(input: ChatInput!): Message!
+}
+
+input ChatInput {
+	sessionId: ID!
+	content: String!
+	messageType: String
+}
+
+type Session {
+	id: ID!
+	connections: Int!
+}
+
+type Message {
+	id: ID!
+	sessionId: ID!
+	content: String!
+	agent: Agent!
+	status: String!
+	isFinal: Boolean!
+}
+
+type Agent {
+	type: String!
+	name: String!
+}
+`
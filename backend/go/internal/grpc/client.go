@@ -2,83 +2,394 @@ package grpc
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 
+	"github.com/neuronai/backend/go/internal/admin"
 	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/scheduler"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// DebugRetried is set in ChatResponse.Debug when the call was retried on a
+// spare connection.
+const DebugRetried = "retried"
+
+// MetadataIdempotencyKey is the gRPC metadata key naming a unary chat across
+// its attempts. A retry reuses the key, so the Python service answers it
+// from the first attempt if that reached it, rather than run the chat twice.
+const MetadataIdempotencyKey = "x-idempotency-key"
+
+// DefaultPoolSize is the number of connections a client keeps open to each
+// backend unless WithPoolSize says otherwise: the primary, and a spare so a
+// unary call that hits a reset connection can be retried on a different
+// transport.
+const DefaultPoolSize = 2
+
 type PythonClient struct {
+	// mu guards conn, spares and gen, which Redial replaces, and routes,
+	// which SetBackends replaces.
+	mu     sync.RWMutex
 	conn   *grpc.ClientConn
 	client pb.AIServiceClient
+	spares []*grpc.ClientConn
+	// gen counts the calls in flight on conn and spares, so that Redial can
+	// close them once their calls are done. It is nil for clients built
+	// around a given connection, whose calls are not counted.
+	gen *generation
+	// routes are the backends a routing client sends calls to, each over a
+	// client of its own. A client without routes uses its own connections.
+	routes []*route
+	next   atomic.Uint32
+	log    *slog.Logger
+	// scheduler, if set, bounds the calls in flight to the service and
+	// orders those waiting by priority.
+	scheduler *scheduler.Scheduler
+	// creds secure the connections to the service.
+	creds credentials.TransportCredentials
+	// poolSize is the number of connections to each backend.
+	poolSize int
+	// limits caps the streams open and the calls in flight of each user.
+	limits limiter
+}
+
+// ClientOption configures a PythonClient.
+type ClientOption func(*PythonClient)
+
+// WithLogger logs retries and connection problems to l instead of the
+// default logger.
+func WithLogger(l *slog.Logger) ClientOption {
+	return func(c *PythonClient) {
+		c.log = l
+	}
+}
+
+// WithTransportCredentials secures the connections to the Python service
+// with creds, such as TLS, instead of leaving them in plain text.
+func WithTransportCredentials(creds credentials.TransportCredentials) ClientOption {
+	return func(c *PythonClient) {
+		c.creds = creds
+	}
+}
+
+// WithScheduler makes chats and streams wait for a slot of s before they
+// are sent, and hold it until they are done.
+func WithScheduler(s *scheduler.Scheduler) ClientOption {
+	return func(c *PythonClient) {
+		c.scheduler = s
+	}
+}
+
+// WithPoolSize keeps n connections open to each backend instead of
+// DefaultPoolSize: the primary and n-1 spares.
+func WithPoolSize(n int) ClientOption {
+	return func(c *PythonClient) {
+		c.poolSize = max(n, 1)
+	}
+}
+
+// WithMaxStreams fails streams started while n are open with
+// ErrStreamLimit. Zero, the default, does not cap them.
+func WithMaxStreams(n int) ClientOption {
+	return func(c *PythonClient) {
+		c.limits.maxStreams = n
+	}
+}
+
+// WithUserLimit fails chats and streams of a user who has n in flight with
+// ErrUserLimit. Zero, the default, does not cap them.
+func WithUserLimit(n int) ClientOption {
+	return func(c *PythonClient) {
+		c.limits.maxPerUser = n
+	}
 }
 
 type StreamClient struct {
-	stream pb.AIService_ProcessStreamClient
+	stream    pb.AIService_ProcessStreamClient
+	sessionID string
+	userID    string
+	// release gives the stream's scheduler slot back, once.
+	release     func()
+	releaseOnce sync.Once
+	// sendMu serializes control messages, which may be sent concurrently.
+	sendMu sync.Mutex
 }
 
-func NewPythonClient(addr string) (*PythonClient, error) {
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewPythonClient(addr string, opts ...ClientOption) (*PythonClient, error) {
+	client := &PythonClient{creds: insecure.NewCredentials(), poolSize: DefaultPoolSize}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	conn, spares, err := client.dial(addr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Python service: %w", err)
+		return nil, err
 	}
+	client.conn = conn
+	client.spares = spares
+	client.gen = &generation{conns: append([]*grpc.ClientConn{conn}, spares...)}
+	client.client = pb.NewAIServiceClient(switchConn{client})
 
-	return &PythonClient{
-		conn:   conn,
-		client: pb.NewAIServiceClient(conn),
-	}, nil
+	return client, nil
+}
+
+// dial opens the primary and spare connections to the Python service at
+// addr. Calls and streams on them are recorded in the gRPC client metrics.
+func (c *PythonClient) dial(addr string) (*grpc.ClientConn, []*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(c.creds),
+		grpc.WithChainUnaryInterceptor(observeUnary),
+		grpc.WithChainStreamInterceptor(observeStream),
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Python service: %w", err)
+	}
+
+	var spares []*grpc.ClientConn
+	for i := 1; i < c.poolSize; i++ {
+		spare, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			closeConns(append(spares, conn))
+			return nil, nil, fmt.Errorf("failed to connect to Python service: %w", err)
+		}
+		spares = append(spares, spare)
+	}
+	return conn, spares, nil
+}
+
+// Redial connects to the Python service at addr and sends later calls
+// there. Calls in flight finish on the old connections, which are closed
+// once they are done.
+func (c *PythonClient) Redial(addr string) error {
+	conn, spares, err := c.dial(addr)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.gen
+	c.conn, c.spares = conn, spares
+	c.gen = &generation{conns: append([]*grpc.ClientConn{conn}, spares...)}
+	c.mu.Unlock()
+
+	if old != nil {
+		old.retire()
+	}
+	return nil
 }
 
 func (c *PythonClient) Close() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.routes != nil {
+		return closeRoutes(c.routes)
+	}
+	var conns []*grpc.ClientConn
 	if c.conn != nil {
-		return c.conn.Close()
+		conns = append(conns, c.conn)
 	}
-	return nil
+	return closeConns(append(conns, c.spares...))
+}
+
+func closeConns(conns []*grpc.ClientConn) error {
+	var firstErr error
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Backend reports the primary connection for runtime introspection.
+func (c *PythonClient) Backend() admin.Backend {
+	b := admin.Backend{Name: "python", Kind: "grpc"}
+	if conn := c.primary(); conn != nil {
+		b.Address = conn.Target()
+		b.State = conn.GetState().String()
+	}
+	return b
+}
+
+// Check waits until the primary connection is ready or ctx is done. A
+// routing client checks the primary connection of every backend.
+func (c *PythonClient) Check(ctx context.Context) error {
+	if routes := c.currentRoutes(); routes != nil {
+		var errs []error
+		for _, r := range routes {
+			if err := r.client.Check(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("backend %s: %w", r.Name, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	conn := c.primary()
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("python service not ready: %s", state)
+		}
+	}
+}
+
+func (c *PythonClient) primary() *grpc.ClientConn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// AIService returns the raw client for the primary connection, for callers
+// such as the grpc-web proxy that forward protobuf messages unchanged. A
+// routing client's sends each call to a backend as routeConn does.
+func (c *PythonClient) AIService() pb.AIServiceClient {
+	return c.client
+}
+
+func (c *PythonClient) logger() *slog.Logger {
+	if c.log == nil {
+		return slog.Default()
+	}
+	return c.log
+}
+
+// spare returns the next spare connection in round-robin order, or nil when
+// the client has none, and the function to call once the call made on it is
+// done.
+func (c *PythonClient) spare() (pb.AIServiceClient, func()) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.spares) == 0 {
+		return nil, nil
+	}
+	i := c.next.Add(1) % uint32(len(c.spares))
+	return pb.NewAIServiceClient(c.spares[i]), c.gen.use()
+}
+
+// isConnectionReset reports whether err means the call failed in transport.
+// The Python service may or may not have received the call, so it is only
+// retried under the same idempotency key.
+func isConnectionReset(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// newIdempotencyKey returns a random key for one unary chat. It fails rather
+// than return a predictable key, which the Python service would take for the
+// key of another chat.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// acquire counts a call of userID against the client's limits, a stream if
+// stream, then waits for a scheduler slot for it if the client has a
+// scheduler.
+func (c *PythonClient) acquire(ctx context.Context, userID string, stream bool) (func(), error) {
+	done, err := c.limits.acquire(userID, stream)
+	if err != nil || c.scheduler == nil {
+		return done, err
+	}
+	release, err := c.scheduler.Acquire(ctx)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return func() {
+		release()
+		done()
+	}, nil
 }
 
 func (c *PythonClient) ProcessChat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	release, err := c.acquire(ctx, req.UserID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process chat: %w", err)
+	}
+	defer release()
+
 	pbReq := &pb.ChatRequest{
-		SessionId: req.SessionID,
-		UserId:    req.UserID,
-		Content:   req.Content,
-		Metadata:  req.Metadata,
-	}
-
-	if req.MessageType != "" {
-		switch req.MessageType {
-		case "text":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_TEXT
-		case "image":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_IMAGE
-		case "video":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_VIDEO
-		case "code":
-			pbReq.MessageType = pb.MessageType_MESSAGE_TYPE_CODE
-		}
+		SessionId:   req.SessionID,
+		UserId:      req.UserID,
+		Content:     req.Content,
+		Attachments: req.Attachments,
+		MessageType: ParseMessageType(req.MessageType),
+		Metadata:    req.Messages.ApplyTo(req.Params.ApplyTo(req.Metadata)),
 	}
+	return c.target(pbReq.Metadata[MetadataAgent]).processChat(ctx, pbReq)
+}
 
-	resp, err := c.client.ProcessChat(ctx, pbReq)
+// processChat sends req over the client's connections, retrying on a spare
+// one if the primary was reset.
+func (c *PythonClient) processChat(ctx context.Context, req *pb.ChatRequest) (*ChatResponse, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to process chat: %w", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataIdempotencyKey, key)
+	resp, err := c.client.ProcessChat(ctx, req)
+	retried := false
+	if err != nil && isConnectionReset(err) {
+		if spare, done := c.spare(); spare != nil {
+			c.logger().WarnContext(ctx, "Retrying chat on a spare connection", logging.KeySessionID, req.SessionId, logging.Err(err))
+			resp, err = spare.ProcessChat(ctx, req)
+			done()
+			retried = true
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to process chat: %w", err)
 	}
 
-	return &ChatResponse{
-		MessageID: resp.MessageId,
-		SessionID: resp.SessionId,
-		Content:   resp.Content,
-		AgentType: resp.AgentType.String(),
-		Status:    resp.Status.String(),
-		IsFinal:   resp.IsFinal,
-	}, nil
+	chatResp := &ChatResponse{
+		MessageID:   resp.MessageId,
+		SessionID:   resp.SessionId,
+		Content:     resp.Content,
+		MessageType: MessageTypeName(resp.MessageType),
+		AgentType:   resp.AgentType.String(),
+		Status:      resp.Status.String(),
+		IsFinal:     resp.IsFinal,
+	}
+	if retried {
+		chatResp.Debug = map[string]string{DebugRetried: "true"}
+	}
+
+	return chatResp, nil
 }
 
+// ProcessStream starts a stream for req, on the backend serving the agent
+// it targets if the client routes. The stream holds its scheduler slot
+// until it is closed, and counts against the client's limits until then.
 func (c *PythonClient) ProcessStream(ctx context.Context, req *pb.ChatRequest) (*StreamClient, error) {
-	stream, err := c.client.ProcessStream(ctx)
+	release, err := c.acquire(ctx, req.UserId, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start stream: %w", err)
 	}
+	stream, err := c.target(req.Metadata[MetadataAgent]).client.ProcessStream(ctx)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to start stream: %w", err)
+	}
 
 	if err := stream.Send(&pb.StreamRequest{
 		SessionId: req.SessionId,
@@ -87,13 +398,25 @@ func (c *PythonClient) ProcessStream(ctx context.Context, req *pb.ChatRequest) (
 			Chat: req,
 		},
 	}); err != nil {
+		release()
 		return nil, fmt.Errorf("failed to send initial request: %w", err)
 	}
 
-	return &StreamClient{stream: stream}, nil
+	return &StreamClient{stream: stream, sessionID: req.SessionId, userID: req.UserId, release: release}, nil
 }
 
 func (s *StreamClient) Recv() (*pb.ChatResponse, error) {
+	resp, err := s.RecvResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.GetChat(), nil
+}
+
+// RecvResponse returns the next raw stream response, including non-chat
+// payloads such as audio data.
+func (s *StreamClient) RecvResponse() (*pb.StreamResponse, error) {
 	resp, err := s.stream.Recv()
 	if err != nil {
 		if err == io.EOF {
@@ -102,10 +425,15 @@ func (s *StreamClient) Recv() (*pb.ChatResponse, error) {
 		return nil, fmt.Errorf("stream receive error: %w", err)
 	}
 
-	return resp.GetChat(), nil
+	return resp, nil
 }
 
+// Close ends the sending side of the stream and gives its scheduler slot
+// back.
 func (s *StreamClient) Close() error {
+	if s.release != nil {
+		s.releaseOnce.Do(s.release)
+	}
 	return s.stream.CloseSend()
 }
 
@@ -115,13 +443,18 @@ type ChatRequest struct {
 	Content     string
 	MessageType string
 	Metadata    map[string]string
+	Attachments []*pb.Attachment
+	Messages    Conversation
+	Params      GenerationParams
 }
 
 type ChatResponse struct {
-	MessageID string
-	SessionID string
-	Content   string
-	AgentType string
-	Status    string
-	IsFinal   bool
+	MessageID   string
+	SessionID   string
+	Content     string
+	MessageType string `json:",omitempty"`
+	AgentType   string
+	Status      string
+	IsFinal     bool
+	Debug       map[string]string `json:",omitempty"`
 }
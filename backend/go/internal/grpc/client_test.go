@@ -4,12 +4,17 @@ import (
 	"context"
 	"io"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	pb "github.com/neuronai/backend/go/internal/grpc/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -339,6 +344,7 @@ func TestMessageTypeConversion(t *testing.T) {
 		{"image message", "image"},
 		{"video message", "video"},
 		{"code message", "code"},
+		{"audio message", "audio"},
 	}
 
 	for _, tt := range tests {
@@ -360,3 +366,160 @@ func TestMessageTypeConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestPythonClient_ProcessChat_RetriesOnSpare(t *testing.T) {
+	deadLis := bufconn.Listen(bufSize)
+	deadLis.Close()
+
+	deadConn, err := grpc.NewClient("passthrough://dead",
+		grpc.WithContextDialer(dialer(deadLis)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create dead client: %v", err)
+	}
+	defer deadConn.Close()
+
+	lis := bufconn.Listen(bufSize)
+	s := setupMockServer(t, lis)
+	defer s.Stop()
+
+	spareConn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(dialer(lis)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial mock server: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		client      *PythonClient
+		wantErr     bool
+		wantRetried bool
+	}{
+		{
+			name: "healthy primary is not retried",
+			client: &PythonClient{
+				conn:   spareConn,
+				client: pb.NewAIServiceClient(spareConn),
+			},
+			wantRetried: false,
+		},
+		{
+			name: "reset primary retries on spare",
+			client: &PythonClient{
+				conn:   deadConn,
+				client: pb.NewAIServiceClient(deadConn),
+				spares: []*grpc.ClientConn{spareConn},
+			},
+			wantRetried: true,
+		},
+		{
+			name: "reset primary without spares fails",
+			client: &PythonClient{
+				conn:   deadConn,
+				client: pb.NewAIServiceClient(deadConn),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := tt.client.ProcessChat(ctx, &ChatRequest{
+				SessionID: "session-123",
+				UserID:    "user-123",
+				Content:   "Hello",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProcessChat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if retried := resp.Debug[DebugRetried] == "true"; retried != tt.wantRetried {
+				t.Errorf("expected retried %v, got %v", tt.wantRetried, retried)
+			}
+		})
+	}
+
+	spareConn.Close()
+}
+
+// flakyAIService fails the first chat with Unavailable after receiving it,
+// as a server going away mid-call does, and records each call's idempotency
+// key.
+type flakyAIService struct {
+	pb.UnimplementedAIServiceServer
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *flakyAIService) ProcessChat(ctx context.Context, req *pb.ChatRequest) (*pb.ChatResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, strings.Join(md.Get(MetadataIdempotencyKey), ","))
+	if len(s.keys) == 1 {
+		return nil, status.Error(codes.Unavailable, "server going away")
+	}
+	return &pb.ChatResponse{SessionId: req.SessionId, IsFinal: true}, nil
+}
+
+func TestPythonClient_ProcessChat_RetryReusesIdempotencyKey(t *testing.T) {
+	lis := bufconn.Listen(bufSize)
+	svc := &flakyAIService{}
+	s := grpc.NewServer()
+	pb.RegisterAIServiceServer(s, svc)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.NewClient("passthrough://bufnet",
+			grpc.WithContextDialer(dialer(lis)),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		if err != nil {
+			t.Fatalf("Failed to dial mock server: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	primary, spare := dial(), dial()
+	client := &PythonClient{conn: primary, client: pb.NewAIServiceClient(primary), spares: []*grpc.ClientConn{spare}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.ProcessChat(ctx, &ChatRequest{SessionID: "session-123", Content: "Hello"}); err != nil {
+		t.Fatalf("ProcessChat() error = %v", err)
+	}
+
+	if len(svc.keys) != 2 || svc.keys[0] == "" || svc.keys[0] != svc.keys[1] {
+		t.Errorf("expected both attempts under one idempotency key, got %q", svc.keys)
+	}
+}
+
+func TestNewPythonClient_PoolSize(t *testing.T) {
+	for _, tt := range []struct {
+		opts   []ClientOption
+		spares int
+	}{
+		{nil, DefaultPoolSize - 1},
+		{[]ClientOption{WithPoolSize(4)}, 3},
+		{[]ClientOption{WithPoolSize(0)}, 0},
+	} {
+		client, err := NewPythonClient("localhost:50051", tt.opts...)
+		if err != nil {
+			t.Fatalf("NewPythonClient() error = %v", err)
+		}
+		if len(client.spares) != tt.spares {
+			t.Errorf("spares = %d, want %d", len(client.spares), tt.spares)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// gRPC metadata keys carrying the client app behind a call, so the Python
+// service can tell client-specific issues apart.
+const (
+	MetadataClientDevice  = "x-client-device"
+	MetadataClientVersion = "x-client-version"
+	MetadataClientLocale  = "x-client-locale"
+)
+
+// maxClientInfoLength caps each client-supplied field, which ends up in logs.
+const maxClientInfoLength = 64
+
+// ClientInfo describes the client app behind a call. Empty fields are
+// unknown.
+type ClientInfo struct {
+	Device  string `json:"device,omitempty"`
+	Version string `json:"version,omitempty"`
+	Locale  string `json:"locale,omitempty"`
+}
+
+// Sanitize trims each field, drops control characters and truncates it to a
+// short length, since the values come from the client.
+func (i ClientInfo) Sanitize() ClientInfo {
+	return ClientInfo{
+		Device:  sanitizeClientField(i.Device),
+		Version: sanitizeClientField(i.Version),
+		Locale:  sanitizeClientField(i.Locale),
+	}
+}
+
+func sanitizeClientField(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if len(s) > maxClientInfoLength {
+		s = strings.ToValidUTF8(s[:maxClientInfoLength], "")
+	}
+	return s
+}
+
+// Merge returns i with its unknown fields taken from other.
+func (i ClientInfo) Merge(other ClientInfo) ClientInfo {
+	if i.Device == "" {
+		i.Device = other.Device
+	}
+	if i.Version == "" {
+		i.Version = other.Version
+	}
+	if i.Locale == "" {
+		i.Locale = other.Locale
+	}
+	return i
+}
+
+// String formats i for logs as device/version/locale, with unknown fields
+// as "-".
+func (i ClientInfo) String() string {
+	field := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	return field(i.Device) + "/" + field(i.Version) + "/" + field(i.Locale)
+}
+
+// NewOutgoingContext returns ctx with i's known fields added to the outgoing
+// gRPC metadata.
+func (i ClientInfo) NewOutgoingContext(ctx context.Context) context.Context {
+	var kv []string
+	for _, f := range [][2]string{
+		{MetadataClientDevice, i.Device},
+		{MetadataClientVersion, i.Version},
+		{MetadataClientLocale, i.Locale},
+	} {
+		if f[1] != "" {
+			kv = append(kv, f[0], f[1])
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
@@ -0,0 +1,36 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestClientInfo(t *testing.T) {
+	info := ClientInfo{
+		Device:  " ios ",
+		Version: "2.3.1\n\x1b[31m",
+		Locale:  strings.Repeat("x", 100),
+	}.Sanitize()
+	if info.Device != "ios" || info.Version != "2.3.1[31m" || len(info.Locale) != maxClientInfoLength {
+		t.Errorf("unexpected sanitized info %+v", info)
+	}
+
+	merged := ClientInfo{Device: "android"}.Merge(ClientInfo{Device: "ios", Locale: "de-DE"})
+	if merged != (ClientInfo{Device: "android", Locale: "de-DE"}) {
+		t.Errorf("unexpected merged info %+v", merged)
+	}
+	if s := merged.String(); s != "android/-/de-DE" {
+		t.Errorf("expected android/-/de-DE, got %q", s)
+	}
+
+	md, _ := metadata.FromOutgoingContext(merged.NewOutgoingContext(context.Background()))
+	if md.Get(MetadataClientDevice)[0] != "android" || md.Get(MetadataClientLocale)[0] != "de-DE" || len(md.Get(MetadataClientVersion)) != 0 {
+		t.Errorf("unexpected outgoing metadata %v", md)
+	}
+	if ctx := (ClientInfo{}).NewOutgoingContext(context.Background()); ctx != context.Background() {
+		t.Error("expected no metadata for unknown clients")
+	}
+}
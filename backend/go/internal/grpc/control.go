@@ -0,0 +1,65 @@
+package grpc
+
+import (
+	"strings"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// Control messages steer a stream in flight. Until StreamRequest has a
+// control payload, one is sent on the stream as a chat with no content whose
+// metadata holds the action under MetadataControl.
+const (
+	MetadataControl = "control.action"
+	// MetadataAgent names the agent a chat, or a switch_agent control
+	// message, targets, by the agent's JSON name such as "code".
+	MetadataAgent = "routing.agent"
+)
+
+// Control actions.
+const (
+	ControlPause       = "pause"
+	ControlResume      = "resume"
+	ControlSwitchAgent = "switch_agent"
+)
+
+const agentTypePrefix = "AGENT_TYPE_"
+
+// ParseAgentType maps a JSON agent name such as "code" to its protobuf value.
+// Unknown agents map to the unspecified agent.
+func ParseAgentType(s string) pb.AgentType {
+	if s == "" {
+		return pb.AgentType_AGENT_TYPE_UNSPECIFIED
+	}
+	return pb.AgentType(pb.AgentType_value[agentTypePrefix+strings.ToUpper(s)])
+}
+
+// AgentTypeName is the JSON name of t, the inverse of ParseAgentType. The
+// unspecified agent has no name.
+func AgentTypeName(t pb.AgentType) string {
+	if t == pb.AgentType_AGENT_TYPE_UNSPECIFIED {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(t.String(), agentTypePrefix))
+}
+
+// SendControl sends a control action on the stream, with extra metadata such
+// as MetadataAgent. It may be called while another goroutine receives.
+func (s *StreamClient) SendControl(action string, metadata map[string]string) error {
+	md := map[string]string{MetadataControl: action}
+	for k, v := range metadata {
+		md[k] = v
+	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.Send(&pb.StreamRequest{
+		SessionId: s.sessionID,
+		UserId:    s.userID,
+		Payload: &pb.StreamRequest_Chat{Chat: &pb.ChatRequest{
+			SessionId: s.sessionID,
+			UserId:    s.userID,
+			Metadata:  md,
+		}},
+	})
+}
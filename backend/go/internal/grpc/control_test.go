@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	"testing"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+func TestParseAgentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    string
+		expected pb.AgentType
+	}{
+		{"code", "code", pb.AgentType_AGENT_TYPE_CODE},
+		{"researcher", "researcher", pb.AgentType_AGENT_TYPE_RESEARCHER},
+		{"upper case", "WRITER", pb.AgentType_AGENT_TYPE_WRITER},
+		{"empty", "", pb.AgentType_AGENT_TYPE_UNSPECIFIED},
+		{"unknown", "poet", pb.AgentType_AGENT_TYPE_UNSPECIFIED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted := ParseAgentType(tt.agent)
+			if converted != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, converted)
+			}
+		})
+	}
+
+	if name := AgentTypeName(pb.AgentType_AGENT_TYPE_CODE); name != "code" {
+		t.Errorf("expected name %q, got %q", "code", name)
+	}
+	if name := AgentTypeName(pb.AgentType_AGENT_TYPE_UNSPECIFIED); name != "" {
+		t.Errorf("expected no name for the unspecified agent, got %q", name)
+	}
+}
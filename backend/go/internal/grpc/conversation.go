@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// MetadataConversation carries the earlier turns of a client-supplied
+// conversation, JSON encoded, until ChatRequest has a dedicated proto field
+// for them. The Python service passes them to the model ahead of the request
+// content. The field is deferred because a repeated message field has to ship
+// in both services, with regenerated stubs, in the same release; metadata
+// keeps either side deployable alone.
+const MetadataConversation = "conversation.messages"
+
+const maxConversationMessages = 200
+
+// Message is one turn of a client-supplied conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Conversation lets stateless clients send the full history with a request
+// instead of relying on server-side session history. The final message must
+// be from the user and becomes the request content.
+type Conversation []Message
+
+func (c Conversation) Validate() error {
+	if len(c) == 0 {
+		return nil
+	}
+	if len(c) > maxConversationMessages {
+		return fmt.Errorf("at most %d messages are allowed", maxConversationMessages)
+	}
+
+	for i, m := range c {
+		switch m.Role {
+		case "system", "user", "assistant", "tool":
+		default:
+			return fmt.Errorf("message %d: unknown role %q", i, m.Role)
+		}
+		if m.Content == "" {
+			return fmt.Errorf("message %d: content is required", i)
+		}
+	}
+
+	if c[len(c)-1].Role != "user" {
+		return fmt.Errorf("the last message must have role user")
+	}
+	return nil
+}
+
+// Prompt returns the content of the final message.
+func (c Conversation) Prompt() string {
+	if len(c) == 0 {
+		return ""
+	}
+	return c[len(c)-1].Content
+}
+
+// Text returns the content of every message, one per paragraph, so the whole
+// conversation can be screened rather than only its prompt.
+func (c Conversation) Text() string {
+	contents := make([]string, len(c))
+	for i, m := range c {
+		contents[i] = m.Content
+	}
+	return strings.Join(contents, "\n\n")
+}
+
+// ScreenText returns the text of req that moderation and abuse detection
+// must see: the conversation history in its metadata, if any, followed by its
+// content.
+func ScreenText(req *pb.ChatRequest) string {
+	var history Conversation
+	if data, ok := req.Metadata[MetadataConversation]; ok {
+		json.Unmarshal([]byte(data), &history)
+	}
+	if len(history) == 0 {
+		return req.Content
+	}
+	return append(history, Message{Role: "user", Content: req.Content}).Text()
+}
+
+// ApplyTo writes the conversation history into metadata, allocating the map
+// if needed, and returns it. The final message is sent as the request content
+// and is not repeated.
+func (c Conversation) ApplyTo(metadata map[string]string) map[string]string {
+	if len(c) < 2 {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	history, _ := json.Marshal(c[:len(c)-1])
+	metadata[MetadataConversation] = string(history)
+	return metadata
+}
@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrStreamLimit is returned for a stream started while the client already
+// has its maximum of streams open to the AI service.
+var ErrStreamLimit = errors.New("too many streams open to the AI service")
+
+// ErrUserLimit is returned for a chat or stream of a user who already has
+// the maximum of calls in flight.
+var ErrUserLimit = errors.New("too many concurrent requests for this user")
+
+// limiter caps the streams a client has open and the calls in flight of
+// each user. A zero cap disables it; the zero value caps nothing.
+type limiter struct {
+	maxStreams int
+	maxPerUser int
+
+	mu      sync.Mutex
+	streams int
+	users   map[string]int
+}
+
+// acquire counts a call of userID, a stream if stream, and returns the
+// function that stops counting it, which must be called once, when the call
+// is done. It fails with ErrUserLimit or ErrStreamLimit instead of waiting.
+func (l *limiter) acquire(userID string, stream bool) (func(), error) {
+	countUser := l.maxPerUser > 0 && userID != ""
+	countStream := l.maxStreams > 0 && stream
+	if !countUser && !countStream {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if countUser && l.users[userID] >= l.maxPerUser {
+		return nil, ErrUserLimit
+	}
+	if countStream && l.streams >= l.maxStreams {
+		return nil, ErrStreamLimit
+	}
+	if countUser {
+		if l.users == nil {
+			l.users = make(map[string]int)
+		}
+		l.users[userID]++
+	}
+	if countStream {
+		l.streams++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if countUser {
+				if l.users[userID]--; l.users[userID] == 0 {
+					delete(l.users, userID)
+				}
+			}
+			if countStream {
+				l.streams--
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{maxStreams: 2, maxPerUser: 2}
+
+	first, err := l.acquire("alice", true)
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if _, err := l.acquire("alice", false); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if _, err := l.acquire("alice", false); !errors.Is(err, ErrUserLimit) {
+		t.Errorf("third call of alice: error = %v, want ErrUserLimit", err)
+	}
+	if _, err := l.acquire("bob", true); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if _, err := l.acquire("carol", true); !errors.Is(err, ErrStreamLimit) {
+		t.Errorf("third stream: error = %v, want ErrStreamLimit", err)
+	}
+	if _, err := l.acquire("carol", false); err != nil {
+		t.Errorf("chats do not count as streams: error = %v", err)
+	}
+
+	first()
+	first()
+	if _, err := l.acquire("alice", true); err != nil {
+		t.Errorf("after release: error = %v", err)
+	}
+	if l.streams != 2 || l.users["alice"] != 2 {
+		t.Errorf("streams = %d, alice = %d, want 2, 2", l.streams, l.users["alice"])
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	var l limiter
+	for range 100 {
+		if _, err := l.acquire("alice", true); err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+	}
+	if l.users != nil || l.streams != 0 {
+		t.Errorf("an unlimited limiter counted calls: %v %d", l.users, l.streams)
+	}
+}
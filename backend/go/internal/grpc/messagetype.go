@@ -0,0 +1,27 @@
+package grpc
+
+import (
+	"strings"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+const messageTypePrefix = "MESSAGE_TYPE_"
+
+// ParseMessageType maps a JSON message_type such as "audio" to its protobuf
+// value. Unknown types map to the unspecified type.
+func ParseMessageType(s string) pb.MessageType {
+	if s == "" {
+		return pb.MessageType_MESSAGE_TYPE_UNSPECIFIED
+	}
+	return pb.MessageType(pb.MessageType_value[messageTypePrefix+strings.ToUpper(s)])
+}
+
+// MessageTypeName is the JSON name of t, the inverse of ParseMessageType. The
+// unspecified type has no name.
+func MessageTypeName(t pb.MessageType) string {
+	if t == pb.MessageType_MESSAGE_TYPE_UNSPECIFIED {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(t.String(), messageTypePrefix))
+}
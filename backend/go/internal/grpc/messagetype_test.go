@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"testing"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+func TestParseMessageType(t *testing.T) {
+	tests := []struct {
+		name     string
+		msgType  string
+		expected pb.MessageType
+	}{
+		{"text", "text", pb.MessageType_MESSAGE_TYPE_TEXT},
+		{"image", "image", pb.MessageType_MESSAGE_TYPE_IMAGE},
+		{"video", "video", pb.MessageType_MESSAGE_TYPE_VIDEO},
+		{"code", "code", pb.MessageType_MESSAGE_TYPE_CODE},
+		{"audio", "audio", pb.MessageType_MESSAGE_TYPE_AUDIO},
+		{"empty", "", pb.MessageType_MESSAGE_TYPE_UNSPECIFIED},
+		{"unknown", "hologram", pb.MessageType_MESSAGE_TYPE_UNSPECIFIED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted := ParseMessageType(tt.msgType)
+			if converted != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, converted)
+			}
+			if tt.expected != pb.MessageType_MESSAGE_TYPE_UNSPECIFIED && MessageTypeName(converted) != tt.msgType {
+				t.Errorf("expected name %q, got %q", tt.msgType, MessageTypeName(converted))
+			}
+		})
+	}
+}
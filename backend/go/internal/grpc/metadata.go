@@ -0,0 +1,30 @@
+package grpc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedMetadataPrefixes are the metadata namespaces the gateway itself
+// writes: validated generation parameters and conversation history, control
+// actions, and the moderation and admission verdicts. Clients may not set
+// them directly, or they would bypass the checks those values go through.
+var reservedMetadataPrefixes = []string{
+	"generation.",
+	"conversation.",
+	"control.",
+	"moderation.",
+	"admission.",
+}
+
+// ValidateMetadata rejects client metadata that sets a reserved key.
+func ValidateMetadata(metadata map[string]string) error {
+	for key := range metadata {
+		for _, prefix := range reservedMetadataPrefixes {
+			if strings.HasPrefix(strings.ToLower(key), prefix) {
+				return fmt.Errorf("metadata key %q is reserved", key)
+			}
+		}
+	}
+	return nil
+}
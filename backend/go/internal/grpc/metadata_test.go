@@ -0,0 +1,29 @@
+package grpc
+
+import "testing"
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		wantErr  bool
+	}{
+		{"nil", nil, false},
+		{"client keys", map[string]string{"source": "mobile", MetadataAgent: "code"}, false},
+		{"generation parameter", map[string]string{MetadataMaxTokens: "10000000"}, true},
+		{"conversation", map[string]string{MetadataConversation: "[]"}, true},
+		{"control action", map[string]string{MetadataControl: ControlPause}, true},
+		{"moderation verdict", map[string]string{"moderation.action": "allow"}, true},
+		{"admission downgrade", map[string]string{"admission.downgrade": "false"}, true},
+		{"case folded", map[string]string{"Generation.Temperature": "9"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMetadata(tt.metadata)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
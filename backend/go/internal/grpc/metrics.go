@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// callCode returns the status code a call or stream ended with: OK for
+// the end of a stream, Canceled or DeadlineExceeded for its context's.
+func callCode(err error) codes.Code {
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return codes.OK
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Code()
+	default:
+		return status.Code(err)
+	}
+}
+
+// observeUnary records each unary call in the gRPC client metrics.
+func observeUnary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	metrics.ObserveGRPCCall(method, callCode(err).String(), time.Since(start))
+	return err
+}
+
+// observeStream records each stream in the gRPC client metrics once it
+// ends: when a receive fails, at its end or otherwise, or its context is
+// done.
+func observeStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		metrics.ObserveGRPCCall(method, callCode(err).String(), time.Since(start))
+		return nil, err
+	}
+
+	var once sync.Once
+	observe := func(err error) {
+		once.Do(func() {
+			metrics.ObserveGRPCCall(method, callCode(err).String(), time.Since(start))
+		})
+	}
+	stop := context.AfterFunc(ctx, func() { observe(ctx.Err()) })
+	return &observedStream{ClientStream: stream, done: func(err error) {
+		stop()
+		observe(err)
+	}}, nil
+}
+
+// observedStream reports the error ending a stream, when a receive fails.
+type observedStream struct {
+	grpc.ClientStream
+	done func(error)
+}
+
+func (s *observedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.done(err)
+	}
+	return err
+}
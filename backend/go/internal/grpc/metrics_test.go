@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{nil, codes.OK},
+		{io.EOF, codes.OK},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{status.Error(codes.Unavailable, "reset"), codes.Unavailable},
+		{errors.New("boom"), codes.Unknown},
+	} {
+		if got := callCode(tt.err); got != tt.want {
+			t.Errorf("callCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPythonClient_Metrics(t *testing.T) {
+	client, err := NewPythonClient(startNamedServer(t, "metrics"))
+	if err != nil {
+		t.Fatalf("NewPythonClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.ProcessChat(context.Background(), &ChatRequest{SessionID: "s1", Content: "hi"}); err != nil {
+		t.Fatalf("ProcessChat() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := client.client.ProcessStream(ctx); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+	cancel()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := rec.Body.String()
+	for _, want := range []string{
+		`neuronai_gateway_grpc_client_calls_total{code="OK",method="/neuronai.AIService/ProcessChat"}`,
+		`neuronai_gateway_grpc_client_call_duration_seconds_count{method="/neuronai.AIService/ProcessChat"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in output:\n%s", want, text)
+		}
+	}
+}
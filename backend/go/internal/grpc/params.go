@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Metadata keys used to forward generation parameters to the Python service,
+// which passes them to the model call, until ChatRequest carries them as
+// dedicated proto fields.
+const (
+	MetadataTemperature = "generation.temperature"
+	MetadataMaxTokens   = "generation.max_tokens"
+	MetadataTopP        = "generation.top_p"
+	MetadataStop        = "generation.stop"
+)
+
+const (
+	maxTemperature   = 2.0
+	maxTokensLimit   = 32768
+	maxStopSequences = 4
+)
+
+// GenerationParams are optional sampling controls supplied by the client.
+// Nil fields leave the model defaults in place.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+func (p *GenerationParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > maxTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %v", maxTemperature)
+	}
+	if p.MaxTokens != nil && (*p.MaxTokens < 1 || *p.MaxTokens > maxTokensLimit) {
+		return fmt.Errorf("max_tokens must be between 1 and %d", maxTokensLimit)
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if len(p.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	for _, s := range p.Stop {
+		if s == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+	return nil
+}
+
+// ApplyTo writes the set parameters into metadata, allocating the map if
+// needed, and returns it.
+func (p *GenerationParams) ApplyTo(metadata map[string]string) map[string]string {
+	if p.Temperature == nil && p.MaxTokens == nil && p.TopP == nil && len(p.Stop) == 0 {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	if p.Temperature != nil {
+		metadata[MetadataTemperature] = strconv.FormatFloat(*p.Temperature, 'f', -1, 64)
+	}
+	if p.MaxTokens != nil {
+		metadata[MetadataMaxTokens] = strconv.Itoa(*p.MaxTokens)
+	}
+	if p.TopP != nil {
+		metadata[MetadataTopP] = strconv.FormatFloat(*p.TopP, 'f', -1, 64)
+	}
+	if len(p.Stop) > 0 {
+		stop, _ := json.Marshal(p.Stop)
+		metadata[MetadataStop] = string(stop)
+	}
+	return metadata
+}
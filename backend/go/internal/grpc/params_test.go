@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"testing"
+)
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func intPtr(v int) *int { return &v }
+
+func TestGenerationParams_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  GenerationParams
+		wantErr bool
+	}{
+		{"empty", GenerationParams{}, false},
+		{"all valid", GenerationParams{
+			Temperature: float64Ptr(0.7),
+			MaxTokens:   intPtr(512),
+			TopP:        float64Ptr(0.9),
+			Stop:        []string{"\n\n", "END"},
+		}, false},
+		{"zero temperature", GenerationParams{Temperature: float64Ptr(0)}, false},
+		{"negative temperature", GenerationParams{Temperature: float64Ptr(-0.1)}, true},
+		{"temperature too high", GenerationParams{Temperature: float64Ptr(2.5)}, true},
+		{"zero max tokens", GenerationParams{MaxTokens: intPtr(0)}, true},
+		{"max tokens too high", GenerationParams{MaxTokens: intPtr(maxTokensLimit + 1)}, true},
+		{"zero top_p", GenerationParams{TopP: float64Ptr(0)}, true},
+		{"top_p above one", GenerationParams{TopP: float64Ptr(1.1)}, true},
+		{"too many stop sequences", GenerationParams{Stop: []string{"a", "b", "c", "d", "e"}}, true},
+		{"empty stop sequence", GenerationParams{Stop: []string{""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerationParams_ApplyTo(t *testing.T) {
+	t.Run("no params leaves metadata untouched", func(t *testing.T) {
+		params := GenerationParams{}
+		if got := params.ApplyTo(nil); got != nil {
+			t.Errorf("expected nil metadata, got %v", got)
+		}
+	})
+
+	t.Run("params are written to metadata", func(t *testing.T) {
+		params := GenerationParams{
+			Temperature: float64Ptr(0.5),
+			MaxTokens:   intPtr(256),
+			TopP:        float64Ptr(1),
+			Stop:        []string{"END"},
+		}
+
+		got := params.ApplyTo(map[string]string{"source": "test"})
+
+		expected := map[string]string{
+			"source":            "test",
+			MetadataTemperature: "0.5",
+			MetadataMaxTokens:   "256",
+			MetadataTopP:        "1",
+			MetadataStop:        `["END"]`,
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("expected %d metadata entries, got %d", len(expected), len(got))
+		}
+		for k, v := range expected {
+			if got[k] != v {
+				t.Errorf("expected %s=%q, got %q", k, v, got[k])
+			}
+		}
+	})
+}
@@ -94,6 +94,7 @@ const (
 	MessageType_MESSAGE_TYPE_CODE        MessageType = 4
 	MessageType_MESSAGE_TYPE_TOOL_CALL   MessageType = 5
 	MessageType_MESSAGE_TYPE_TOOL_RESULT MessageType = 6
+	MessageType_MESSAGE_TYPE_AUDIO       MessageType = 7
 )
 
 // Enum value maps for MessageType.
@@ -106,6 +107,7 @@ var (
 		4: "MESSAGE_TYPE_CODE",
 		5: "MESSAGE_TYPE_TOOL_CALL",
 		6: "MESSAGE_TYPE_TOOL_RESULT",
+		7: "MESSAGE_TYPE_AUDIO",
 	}
 	MessageType_value = map[string]int32{
 		"MESSAGE_TYPE_UNSPECIFIED": 0,
@@ -115,6 +117,7 @@ var (
 		"MESSAGE_TYPE_CODE":        4,
 		"MESSAGE_TYPE_TOOL_CALL":   5,
 		"MESSAGE_TYPE_TOOL_RESULT": 6,
+		"MESSAGE_TYPE_AUDIO":       7,
 	}
 )
 
@@ -1147,7 +1150,7 @@ const file_neuronai_proto_rawDesc = "" +
 	"\x11AGENT_TYPE_WRITER\x10\x03\x12\x13\n" +
 	"\x0fAGENT_TYPE_CODE\x10\x04\x12\x14\n" +
 	"\x10AGENT_TYPE_IMAGE\x10\x05\x12\x14\n" +
-	"\x10AGENT_TYPE_VIDEO\x10\x06*\xc3\x01\n" +
+	"\x10AGENT_TYPE_VIDEO\x10\x06*\xdb\x01\n" +
 	"\vMessageType\x12\x1c\n" +
 	"\x18MESSAGE_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
 	"\x11MESSAGE_TYPE_TEXT\x10\x01\x12\x16\n" +
@@ -1155,7 +1158,8 @@ const file_neuronai_proto_rawDesc = "" +
 	"\x12MESSAGE_TYPE_VIDEO\x10\x03\x12\x15\n" +
 	"\x11MESSAGE_TYPE_CODE\x10\x04\x12\x1a\n" +
 	"\x16MESSAGE_TYPE_TOOL_CALL\x10\x05\x12\x1c\n" +
-	"\x18MESSAGE_TYPE_TOOL_RESULT\x10\x06*\xad\x01\n" +
+	"\x18MESSAGE_TYPE_TOOL_RESULT\x10\x06\x12\x16\n" +
+	"\x12MESSAGE_TYPE_AUDIO\x10\a*\xad\x01\n" +
 	"\n" +
 	"TaskStatus\x12\x1b\n" +
 	"\x17TASK_STATUS_UNSPECIFIED\x10\x00\x12\x17\n" +
@@ -0,0 +1,100 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// generation is a set of connections to the Python service and the calls
+// in flight on them. Once retired by Redial, the last call to finish
+// closes the connections.
+type generation struct {
+	conns    []*grpc.ClientConn
+	inflight atomic.Int64
+	retired  atomic.Bool
+	closed   sync.Once
+}
+
+// use counts a call on the generation and returns the function to call
+// once the call is done. A nil generation counts nothing.
+func (g *generation) use() func() {
+	if g == nil {
+		return func() {}
+	}
+	g.inflight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if g.inflight.Add(-1) == 0 && g.retired.Load() {
+				g.close()
+			}
+		})
+	}
+}
+
+// retire closes the connections once no call is in flight on them.
+func (g *generation) retire() {
+	g.retired.Store(true)
+	if g.inflight.Load() == 0 {
+		g.close()
+	}
+}
+
+func (g *generation) close() {
+	g.closed.Do(func() {
+		closeConns(g.conns)
+	})
+}
+
+// switchConn runs each call on the client's primary connection of the
+// moment, so that the client survives Redial.
+type switchConn struct {
+	c *PythonClient
+}
+
+// current returns the primary connection and the function to call once the
+// call made on it is done.
+func (s switchConn) current() (*grpc.ClientConn, func()) {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+	return s.c.conn, s.c.gen.use()
+}
+
+func (s switchConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	conn, done := s.current()
+	defer done()
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream opens a stream on the current connection, which counts as in
+// use until the stream fails, ends or its context is done.
+func (s switchConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, done := s.current()
+	stream, err := conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, done)
+	return &trackedStream{ClientStream: stream, done: func() {
+		stop()
+		done()
+	}}, nil
+}
+
+// trackedStream reports the end of a stream, when a receive fails.
+type trackedStream struct {
+	grpc.ClientStream
+	done func()
+}
+
+func (s *trackedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.done()
+	}
+	return err
+}
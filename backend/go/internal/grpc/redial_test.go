@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// namedAIService answers chats with its name.
+type namedAIService struct {
+	mockAIService
+	name string
+}
+
+func (m *namedAIService) ProcessChat(ctx context.Context, req *pb.ChatRequest) (*pb.ChatResponse, error) {
+	return &pb.ChatResponse{Content: m.name, IsFinal: true}, nil
+}
+
+func startNamedServer(t *testing.T, name string) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterAIServiceServer(s, &namedAIService{name: name})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestPythonClient_Redial(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewPythonClient(startNamedServer(t, "old"))
+	if err != nil {
+		t.Fatalf("NewPythonClient() error = %v", err)
+	}
+	defer client.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.client.ProcessStream(streamCtx)
+	if err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+	old := client.primary()
+
+	if err := client.Redial(startNamedServer(t, "new")); err != nil {
+		t.Fatalf("Redial() error = %v", err)
+	}
+
+	resp, err := client.ProcessChat(ctx, &ChatRequest{SessionID: "s1", Content: "hi"})
+	if err != nil {
+		t.Fatalf("ProcessChat() error = %v", err)
+	}
+	if resp.Content != "new" {
+		t.Errorf("expected the chat sent to the new address, got %q", resp.Content)
+	}
+
+	// The stream opened before the redial keeps its connection.
+	if err := stream.Send(&pb.StreamRequest{SessionId: "s1", Payload: &pb.StreamRequest_Chat{Chat: &pb.ChatRequest{SessionId: "s1"}}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv() on the old connection error = %v", err)
+	}
+	if old.GetState() == connectivity.Shutdown {
+		t.Fatal("expected the old connection open while the stream is")
+	}
+
+	cancel()
+	stream.Recv()
+	if old.GetState() != connectivity.Shutdown {
+		t.Errorf("expected the old connection closed after the stream, got %v", old.GetState())
+	}
+}
+
+func TestPythonClient_RedialInvalidAddress(t *testing.T) {
+	client, err := NewPythonClient(startNamedServer(t, "old"))
+	if err != nil {
+		t.Fatalf("NewPythonClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Redial("bad address\x00"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+	resp, err := client.ProcessChat(context.Background(), &ChatRequest{SessionID: "s1", Content: "hi"})
+	if err != nil || resp.Content != "old" {
+		t.Errorf("ProcessChat() = %+v, %v, want the old service", resp, err)
+	}
+}
@@ -0,0 +1,226 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/neuronai/backend/go/internal/admin"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Backend is an AI service a routing client sends calls to.
+type Backend struct {
+	Name string
+	Addr string
+	// Creds secure the connections to the backend instead of the client's,
+	// unless nil.
+	Creds credentials.TransportCredentials
+	// Agents are the agents the backend serves, by JSON name such as
+	// "code". A backend without agents serves calls for any agent.
+	Agents []string
+	// Weight is the backend's share of the calls it can serve, relative to
+	// the other backends that can. Weights below 1 count as 1.
+	Weight int
+}
+
+// route is a backend and the client of its own connections.
+type route struct {
+	Backend
+	client *PythonClient
+}
+
+// NewRoutingClient connects to each of backends and sends each call to one
+// of them: a backend serving the agent the call targets, under
+// MetadataAgent, if there is one, or else one serving any agent, picked at
+// random by weight. Options apply to the routing client, so a scheduler
+// bounds the calls to all backends together.
+func NewRoutingClient(backends []Backend, opts ...ClientOption) (*PythonClient, error) {
+	client := &PythonClient{creds: insecure.NewCredentials(), poolSize: DefaultPoolSize}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	routes, err := client.dialRoutes(backends, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.routes = routes
+	client.client = pb.NewAIServiceClient(routeConn{client})
+	return client, nil
+}
+
+// SetBackends routes later calls to backends. A backend at the same
+// address with the same credentials as one routed before keeps its
+// connections; the connections of the others are closed once the calls in
+// flight on them are done.
+func (c *PythonClient) SetBackends(backends []Backend) error {
+	old := c.currentRoutes()
+	if old == nil {
+		return fmt.Errorf("client does not route; use Redial")
+	}
+	routes, err := c.dialRoutes(backends, old)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.routes = routes
+	c.mu.Unlock()
+
+	for _, r := range old {
+		if !slices.ContainsFunc(routes, func(n *route) bool { return n.client == r.client }) {
+			r.client.retire()
+		}
+	}
+	return nil
+}
+
+// dialRoutes connects to backends, reusing the clients of the routes in
+// reuse to the same address with the same credentials.
+func (c *PythonClient) dialRoutes(backends []Backend, reuse []*route) ([]*route, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no AI backends")
+	}
+
+	routes := make([]*route, 0, len(backends))
+	var dialed []*route
+	for _, b := range backends {
+		if b.Creds == nil {
+			b.Creds = c.creds
+		}
+		i := slices.IndexFunc(reuse, func(r *route) bool { return r.Addr == b.Addr && r.Creds == b.Creds })
+		if i >= 0 {
+			routes = append(routes, &route{Backend: b, client: reuse[i].client})
+			continue
+		}
+
+		client, err := NewPythonClient(b.Addr, WithLogger(c.log), WithTransportCredentials(b.Creds), WithPoolSize(c.poolSize))
+		if err != nil {
+			closeRoutes(dialed)
+			return nil, fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		r := &route{Backend: b, client: client}
+		routes = append(routes, r)
+		dialed = append(dialed, r)
+	}
+	return routes, nil
+}
+
+func closeRoutes(routes []*route) error {
+	var firstErr error
+	for _, r := range routes {
+		if err := r.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// retire closes the client's connections once no call is in flight on
+// them.
+func (c *PythonClient) retire() {
+	c.mu.RLock()
+	gen := c.gen
+	c.mu.RUnlock()
+	if gen != nil {
+		gen.retire()
+	}
+}
+
+func (c *PythonClient) currentRoutes() []*route {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.routes
+}
+
+// target returns the client to send a call for agent over: the client of
+// the backend picked for it, if the client routes, or else the client
+// itself.
+func (c *PythonClient) target(agent string) *PythonClient {
+	if r := c.pick(agent); r != nil {
+		return r.client
+	}
+	return c
+}
+
+// pick returns the route of a call for agent, or nil if the client does
+// not route.
+func (c *PythonClient) pick(agent string) *route {
+	candidates := serving(c.currentRoutes(), agent)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, r := range candidates {
+		total += max(r.Weight, 1)
+	}
+	n := rand.IntN(total)
+	for _, r := range candidates {
+		if n -= max(r.Weight, 1); n < 0 {
+			return r
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// serving returns the routes to backends serving agent, or else those
+// serving any agent, or else all of them.
+func serving(routes []*route, agent string) []*route {
+	var specific, general []*route
+	for _, r := range routes {
+		switch {
+		case len(r.Agents) == 0:
+			general = append(general, r)
+		case agent != "" && slices.Contains(r.Agents, agent):
+			specific = append(specific, r)
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	if len(general) > 0 {
+		return general
+	}
+	return routes
+}
+
+// Backends reports the primary connection of each backend for runtime
+// introspection, or the client's own if it does not route.
+func (c *PythonClient) Backends() []admin.Backend {
+	routes := c.currentRoutes()
+	if routes == nil {
+		return []admin.Backend{c.Backend()}
+	}
+	backends := make([]admin.Backend, 0, len(routes))
+	for _, r := range routes {
+		b := r.client.Backend()
+		b.Name = r.Name
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// routeConn sends each call made on a routing client's AIService to a
+// backend: a chat by the agent it targets, anything else to a backend
+// serving any agent.
+type routeConn struct {
+	c *PythonClient
+}
+
+func (r routeConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	var agent string
+	if req, ok := args.(*pb.ChatRequest); ok {
+		agent = req.GetMetadata()[MetadataAgent]
+	}
+	return switchConn{r.c.target(agent)}.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (r routeConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return switchConn{r.c.target("")}.NewStream(ctx, desc, method, opts...)
+}
@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+func TestRoutingClient_RoutesByAgent(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewRoutingClient([]Backend{
+		{Name: "general", Addr: startNamedServer(t, "general")},
+		{Name: "code", Addr: startNamedServer(t, "code"), Agents: []string{"code"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRoutingClient() error = %v", err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		agent string
+		want  string
+	}{
+		{"", "general"},
+		{"code", "code"},
+		{"writer", "general"},
+	}
+	for _, tt := range tests {
+		resp, err := client.ProcessChat(ctx, &ChatRequest{SessionID: "s1", Content: "hi", Metadata: map[string]string{MetadataAgent: tt.agent}})
+		if err != nil {
+			t.Fatalf("ProcessChat(%q) error = %v", tt.agent, err)
+		}
+		if resp.Content != tt.want {
+			t.Errorf("ProcessChat(%q) went to %q, want %q", tt.agent, resp.Content, tt.want)
+		}
+
+		// Raw calls, such as those of the grpc-web proxy, route alike.
+		raw, err := client.AIService().ProcessChat(ctx, &pb.ChatRequest{SessionId: "s1", Metadata: map[string]string{MetadataAgent: tt.agent}})
+		if err != nil || raw.Content != tt.want {
+			t.Errorf("AIService().ProcessChat(%q) = %v, %v, want %q", tt.agent, raw, err, tt.want)
+		}
+	}
+
+	if got := client.Backends(); len(got) != 2 || got[0].Name != "general" || got[1].Name != "code" {
+		t.Errorf("Backends() = %+v", got)
+	}
+}
+
+func TestRoutingClient_Weights(t *testing.T) {
+	client, err := NewRoutingClient([]Backend{
+		{Name: "stable", Addr: startNamedServer(t, "stable"), Weight: 3},
+		{Name: "canary", Addr: startNamedServer(t, "canary"), Weight: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewRoutingClient() error = %v", err)
+	}
+	defer client.Close()
+
+	counts := map[string]int{}
+	for range 4000 {
+		counts[client.pick("").Name]++
+	}
+	// 1000 expected; the bounds are over 10 standard deviations away.
+	if counts["canary"] < 700 || counts["canary"] > 1300 {
+		t.Errorf("expected about a quarter of calls on the canary, got %v", counts)
+	}
+}
+
+func TestRoutingClient_SetBackends(t *testing.T) {
+	ctx := context.Background()
+	stable := startNamedServer(t, "stable")
+	client, err := NewRoutingClient([]Backend{{Name: "stable", Addr: stable}})
+	if err != nil {
+		t.Fatalf("NewRoutingClient() error = %v", err)
+	}
+	defer client.Close()
+	kept := client.currentRoutes()[0].client
+
+	if err := client.SetBackends([]Backend{
+		{Name: "stable", Addr: stable},
+		{Name: "code", Addr: startNamedServer(t, "code"), Agents: []string{"code"}},
+	}); err != nil {
+		t.Fatalf("SetBackends() error = %v", err)
+	}
+	if client.currentRoutes()[0].client != kept {
+		t.Error("expected the unchanged backend to keep its connections")
+	}
+
+	resp, err := client.ProcessChat(ctx, &ChatRequest{SessionID: "s1", Content: "hi", Metadata: map[string]string{MetadataAgent: "code"}})
+	if err != nil || resp.Content != "code" {
+		t.Errorf("ProcessChat() = %+v, %v, want the added backend", resp, err)
+	}
+
+	if err := client.SetBackends(nil); err == nil {
+		t.Error("expected an error without backends")
+	}
+	if err := client.SetBackends([]Backend{{Name: "bad", Addr: "bad address\x00"}}); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+	if got := len(client.currentRoutes()); got != 2 {
+		t.Errorf("expected a failed SetBackends to keep 2 routes, got %d", got)
+	}
+}
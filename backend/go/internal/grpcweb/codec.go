@@ -0,0 +1,123 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	frameData    byte = 0x00
+	frameTrailer byte = 0x80
+
+	frameHeaderLen = 5
+)
+
+// readFrames splits a grpc-web request body into message payloads.
+func readFrames(body []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < frameHeaderLen {
+			return nil, fmt.Errorf("truncated frame header")
+		}
+		flag := body[0]
+		length := binary.BigEndian.Uint32(body[1:frameHeaderLen])
+		body = body[frameHeaderLen:]
+		if uint64(length) > uint64(len(body)) {
+			return nil, fmt.Errorf("truncated frame payload")
+		}
+		if flag&frameTrailer != 0 {
+			return nil, fmt.Errorf("unexpected trailer frame in request")
+		}
+		if flag != frameData {
+			return nil, fmt.Errorf("compressed frames are not supported")
+		}
+		messages = append(messages, body[:length])
+		body = body[length:]
+	}
+	return messages, nil
+}
+
+// decodeText decodes a grpc-web-text body. Clients may send several
+// independently padded base64 chunks back to back.
+func decodeText(body []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(body))
+	var out bytes.Buffer
+	for len(text) > 0 {
+		end := len(text)
+		if i := strings.IndexByte(text, '='); i >= 0 {
+			end = i
+			for end < len(text) && text[end] == '=' {
+				end++
+			}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(text[:end])
+		if err != nil {
+			return nil, err
+		}
+		out.Write(decoded)
+		text = text[end:]
+	}
+	return out.Bytes(), nil
+}
+
+// frameWriter writes grpc-web response frames, base64 encoding each one in
+// text mode.
+type frameWriter struct {
+	w     io.Writer
+	text  bool
+	flush func()
+}
+
+func (f *frameWriter) write(flag byte, payload []byte) error {
+	frame := make([]byte, frameHeaderLen+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:frameHeaderLen], uint32(len(payload)))
+	copy(frame[frameHeaderLen:], payload)
+
+	if f.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+	if _, err := f.w.Write(frame); err != nil {
+		return err
+	}
+	if f.flush != nil {
+		f.flush()
+	}
+	return nil
+}
+
+func (f *frameWriter) writeProto(m proto.Message) error {
+	payload, err := proto.Marshal(m)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return f.write(frameData, payload)
+}
+
+func (f *frameWriter) writeTrailer(code uint32, message string) error {
+	trailer := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", code, encodeGrpcMessage(message))
+	return f.write(frameTrailer, []byte(trailer))
+}
+
+// encodeGrpcMessage percent-encodes a status message as the gRPC spec
+// requires for the grpc-message header.
+func encodeGrpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,315 @@
+// Package grpcweb terminates grpc-web and grpc-web-text requests from browser
+// clients and forwards them to the Python AIService, so browsers can call the
+// service without a separate Envoy proxy.
+//
+// grpc-web has no client streaming, so ProcessStream is half-duplex: every
+// StreamRequest in the request body is sent before responses are relayed.
+package grpcweb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// PathPrefix is the route under which AIService methods are served.
+const PathPrefix = "/neuronai.AIService/"
+
+// SwarmTaskPath is the route of ExecuteSwarmTask, under PathPrefix, which
+// deployments may guard more strictly than chats.
+const SwarmTaskPath = pb.AIService_ExecuteSwarmTask_FullMethodName
+
+const (
+	contentTypeWeb     = "application/grpc-web"
+	contentTypeWebText = "application/grpc-web-text"
+)
+
+type Handler struct {
+	client  pb.AIServiceClient
+	maxBody int64
+	preauth *preauth.Gate
+	// streamTimeout, if set, bounds responses instead of the server's
+	// write timeout.
+	streamTimeout *time.Duration
+}
+
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithPreauth requires expensive chats and swarm tasks to be authorized by
+// the billing service. grpc-web has no side channel for holds, so they are
+// waited out before the call is forwarded.
+func WithPreauth(g *preauth.Gate) Option {
+	return func(h *Handler) {
+		h.preauth = g
+	}
+}
+
+// WithStreamTimeout gives each response timeout to finish, or as long as
+// it lasts if timeout is 0, rather than the server's write timeout: server
+// streaming responses relay a whole chat.
+func WithStreamTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.streamTimeout = &timeout
+	}
+}
+
+// NewHandler returns a handler forwarding to client. Request bodies larger
+// than maxBody bytes are rejected. It must be wrapped in middleware.JWTAuth;
+// the caller's user ID is taken from the token, never from the message.
+func NewHandler(client pb.AIServiceClient, maxBody int64, opts ...Option) *Handler {
+	h := &Handler{client: client, maxBody: maxBody}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	text, ok := parseContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	claims, ok := middleware.GetClaims(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if text {
+		w.Header().Set("Content-Type", contentTypeWebText+"+proto")
+	} else {
+		w.Header().Set("Content-Type", contentTypeWeb+"+proto")
+	}
+	if h.streamTimeout != nil {
+		middleware.StreamDeadline(w, *h.streamTimeout)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	fw := &frameWriter{w: w, text: text}
+	if flusher, ok := w.(http.Flusher); ok {
+		fw.flush = flusher.Flush
+	}
+
+	err := h.serve(ctx, r, fw, claims.UserID, text)
+	st := status.Convert(err)
+	fw.writeTrailer(uint32(st.Code()), st.Message())
+}
+
+func (h *Handler) serve(ctx context.Context, r *http.Request, fw *frameWriter, userID string, text bool) error {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, h.maxBody))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return status.Errorf(codes.ResourceExhausted, "request body exceeds %d bytes", h.maxBody)
+		}
+		return status.Errorf(codes.InvalidArgument, "failed to read request body: %v", err)
+	}
+	if text {
+		if body, err = decodeText(body); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid grpc-web-text body: %v", err)
+		}
+	}
+
+	frames, err := readFrames(body)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request framing: %v", err)
+	}
+
+	switch r.URL.Path {
+	case pb.AIService_ProcessChat_FullMethodName:
+		return h.processChat(ctx, fw, userID, frames)
+	case pb.AIService_ProcessStream_FullMethodName:
+		return h.processStream(ctx, fw, userID, frames)
+	case pb.AIService_ExecuteSwarmTask_FullMethodName:
+		return h.executeSwarmTask(ctx, fw, userID, frames)
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", r.URL.Path)
+	}
+}
+
+func (h *Handler) processChat(ctx context.Context, fw *frameWriter, userID string, frames [][]byte) error {
+	req := &pb.ChatRequest{}
+	if err := unmarshalSingle(frames, req); err != nil {
+		return err
+	}
+	req.UserId = userID
+
+	if err := h.authorize(ctx, preauth.ForChat(userID, req.SessionId, req.MessageType)); err != nil {
+		return err
+	}
+
+	resp, err := h.client.ProcessChat(ctx, req)
+	if err != nil {
+		return err
+	}
+	return fw.writeProto(resp)
+}
+
+func (h *Handler) processStream(ctx context.Context, fw *frameWriter, userID string, frames [][]byte) error {
+	if len(frames) == 0 {
+		return status.Error(codes.InvalidArgument, "expected at least one request message")
+	}
+
+	reqs := make([]*pb.StreamRequest, len(frames))
+	for i, frame := range frames {
+		req := &pb.StreamRequest{}
+		if err := proto.Unmarshal(frame, req); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid request message: %v", err)
+		}
+		req.UserId = userID
+		if chat := req.GetChat(); chat != nil {
+			chat.UserId = userID
+			if err := h.authorize(ctx, preauth.ForChat(userID, chat.SessionId, chat.MessageType)); err != nil {
+				return err
+			}
+		}
+		reqs[i] = req
+	}
+
+	stream, err := h.client.ProcessStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, req := range reqs {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fw.writeProto(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *Handler) executeSwarmTask(ctx context.Context, fw *frameWriter, userID string, frames [][]byte) error {
+	req := &pb.SwarmTask{}
+	if err := unmarshalSingle(frames, req); err != nil {
+		return err
+	}
+
+	if err := h.authorize(ctx, preauth.ForSwarmTask(userID, req)); err != nil {
+		return err
+	}
+
+	stream, err := h.client.ExecuteSwarmTask(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fw.writeProto(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// authorize runs req, if any, through the pre-authorization gate and returns
+// a PermissionDenied status when it is rejected.
+func (h *Handler) authorize(ctx context.Context, req *preauth.Request) error {
+	if h.preauth == nil || req == nil {
+		return nil
+	}
+	d, err := h.preauth.Check(ctx, req, nil)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "pre-authorization unavailable: %v", err)
+	}
+	if d.Action == preauth.ActionReject {
+		return status.Errorf(codes.PermissionDenied, "rejected by pre-authorization: %s", d.Reason)
+	}
+	return nil
+}
+
+func unmarshalSingle(frames [][]byte, m proto.Message) error {
+	if len(frames) != 1 {
+		return status.Errorf(codes.InvalidArgument, "expected exactly one request message, got %d", len(frames))
+	}
+	if err := proto.Unmarshal(frames[0], m); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request message: %v", err)
+	}
+	return nil
+}
+
+// parseContentType reports whether ct is a grpc-web content type and whether
+// it is the base64 text variant. Only the proto codec is supported.
+func parseContentType(ct string) (text bool, ok bool) {
+	ct = strings.TrimSpace(strings.SplitN(ct, ";", 2)[0])
+	switch ct {
+	case contentTypeWeb, contentTypeWeb + "+proto":
+		return false, true
+	case contentTypeWebText, contentTypeWebText + "+proto":
+		return true, true
+	}
+	return false, false
+}
+
+// parseTimeout decodes a grpc-timeout header value such as "1S" or "250m".
+func parseTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
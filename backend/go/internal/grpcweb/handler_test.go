@@ -0,0 +1,373 @@
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type mockAIService struct {
+	pb.UnimplementedAIServiceServer
+}
+
+func (m *mockAIService) ProcessChat(ctx context.Context, req *pb.ChatRequest) (*pb.ChatResponse, error) {
+	return &pb.ChatResponse{
+		MessageId: "test-message-id",
+		SessionId: req.SessionId,
+		Content:   "reply to " + req.UserId,
+		IsFinal:   true,
+	}, nil
+}
+
+func (m *mockAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, content := range []string{"Hello", req.GetChat().GetUserId()} {
+			if err := stream.Send(&pb.StreamResponse{
+				SessionId: req.SessionId,
+				Payload: &pb.StreamResponse_Chat{
+					Chat: &pb.ChatResponse{SessionId: req.SessionId, Content: content},
+				},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newTestHandler(t *testing.T, opts ...Option) *Handler {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterAIServiceServer(s, &mockAIService{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewHandler(pb.NewAIServiceClient(conn), 1024*1024, opts...)
+}
+
+func frame(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+
+	payload, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	out := make([]byte, frameHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(out[1:frameHeaderLen], uint32(len(payload)))
+	copy(out[frameHeaderLen:], payload)
+	return out
+}
+
+func withClaims(r *http.Request, userID string) *http.Request {
+	ctx := context.WithValue(r.Context(), middleware.GetClaimsContextKey(), &middleware.Claims{UserID: userID})
+	return r.WithContext(ctx)
+}
+
+// parseResponse splits a binary grpc-web response into messages and the
+// trailer block.
+func parseResponse(t *testing.T, body []byte) ([][]byte, string) {
+	t.Helper()
+
+	var messages [][]byte
+	var trailer string
+	for len(body) > 0 {
+		if len(body) < frameHeaderLen {
+			t.Fatalf("Truncated response frame")
+		}
+		flag := body[0]
+		length := binary.BigEndian.Uint32(body[1:frameHeaderLen])
+		payload := body[frameHeaderLen : frameHeaderLen+length]
+		body = body[frameHeaderLen+length:]
+		if flag&frameTrailer != 0 {
+			trailer = string(payload)
+			continue
+		}
+		messages = append(messages, payload)
+	}
+	return messages, trailer
+}
+
+func TestHandler_ProcessChat(t *testing.T) {
+	h := newTestHandler(t)
+
+	body := frame(t, &pb.ChatRequest{SessionId: "s1", UserId: "spoofed", Content: "Hi"})
+	req := httptest.NewRequest(http.MethodPost, pb.AIService_ProcessChat_FullMethodName, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req = withClaims(req, "user-1")
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/grpc-web+proto" {
+		t.Errorf("expected grpc-web content type, got %q", ct)
+	}
+
+	messages, trailer := parseResponse(t, rr.Body.Bytes())
+	if !strings.Contains(trailer, "grpc-status: 0") {
+		t.Errorf("expected OK trailer, got %q", trailer)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	var resp pb.ChatResponse
+	if err := proto.Unmarshal(messages[0], &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.Content != "reply to user-1" {
+		t.Errorf("expected user ID from claims, got content %q", resp.Content)
+	}
+}
+
+func TestHandler_ProcessStream_Text(t *testing.T) {
+	h := newTestHandler(t)
+
+	msg := &pb.StreamRequest{
+		SessionId: "s1",
+		Payload:   &pb.StreamRequest_Chat{Chat: &pb.ChatRequest{SessionId: "s1", Content: "Hi"}},
+	}
+	body := base64.StdEncoding.EncodeToString(frame(t, msg))
+	req := httptest.NewRequest(http.MethodPost, pb.AIService_ProcessStream_FullMethodName, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	req.Header.Set("Grpc-Timeout", "5S")
+	req = withClaims(req, "user-1")
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	decoded, err := decodeText(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to decode text response: %v", err)
+	}
+	messages, trailer := parseResponse(t, decoded)
+	if !strings.Contains(trailer, "grpc-status: 0") {
+		t.Errorf("expected OK trailer, got %q", trailer)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+
+	var last pb.StreamResponse
+	if err := proto.Unmarshal(messages[1], &last); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if last.GetChat().GetContent() != "user-1" {
+		t.Errorf("expected user ID from claims, got %q", last.GetChat().GetContent())
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        []byte
+		claims      bool
+		wantStatus  int
+		wantTrailer string
+	}{
+		{
+			name:        "wrong method",
+			method:      http.MethodGet,
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			contentType: "application/grpc-web",
+			claims:      true,
+			wantStatus:  http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "unsupported content type",
+			method:      http.MethodPost,
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			contentType: "application/json",
+			claims:      true,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "missing claims",
+			method:      http.MethodPost,
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			contentType: "application/grpc-web",
+			wantStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:        "unknown method",
+			method:      http.MethodPost,
+			path:        "/neuronai.AIService/Nope",
+			contentType: "application/grpc-web",
+			claims:      true,
+			wantStatus:  http.StatusOK,
+			wantTrailer: "grpc-status: 12",
+		},
+		{
+			name:        "truncated frame",
+			method:      http.MethodPost,
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			contentType: "application/grpc-web",
+			body:        []byte{0, 0, 0, 0, 9, 1},
+			claims:      true,
+			wantStatus:  http.StatusOK,
+			wantTrailer: "grpc-status: 3",
+		},
+		{
+			name:        "no message",
+			method:      http.MethodPost,
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			contentType: "application/grpc-web",
+			claims:      true,
+			wantStatus:  http.StatusOK,
+			wantTrailer: "grpc-status: 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.claims {
+				req = withClaims(req, "user-1")
+			}
+			rr := httptest.NewRecorder()
+
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantTrailer != "" {
+				_, trailer := parseResponse(t, rr.Body.Bytes())
+				if !strings.Contains(trailer, tt.wantTrailer) {
+					t.Errorf("expected trailer containing %q, got %q", tt.wantTrailer, trailer)
+				}
+			}
+		})
+	}
+}
+
+type rejectAll struct{}
+
+func (rejectAll) Authorize(ctx context.Context, req *preauth.Request) (preauth.Decision, error) {
+	return preauth.Decision{Action: preauth.ActionReject, Reason: "insufficient credits"}, nil
+}
+
+func TestHandler_PreauthRejected(t *testing.T) {
+	h := newTestHandler(t, WithPreauth(preauth.NewGate(rejectAll{}, time.Second)))
+
+	tests := []struct {
+		name        string
+		path        string
+		msg         proto.Message
+		wantTrailer string
+	}{
+		{
+			name:        "video chat",
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			msg:         &pb.ChatRequest{SessionId: "s1", MessageType: pb.MessageType_MESSAGE_TYPE_VIDEO},
+			wantTrailer: "grpc-status: 7",
+		},
+		{
+			name:        "large swarm task",
+			path:        pb.AIService_ExecuteSwarmTask_FullMethodName,
+			msg:         &pb.SwarmTask{SessionId: "s1", RequiredAgents: []string{"a", "b", "c"}},
+			wantTrailer: "grpc-status: 7",
+		},
+		{
+			name:        "text chat",
+			path:        pb.AIService_ProcessChat_FullMethodName,
+			msg:         &pb.ChatRequest{SessionId: "s1", MessageType: pb.MessageType_MESSAGE_TYPE_TEXT},
+			wantTrailer: "grpc-status: 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(frame(t, tt.msg)))
+			req.Header.Set("Content-Type", "application/grpc-web+proto")
+			rr := httptest.NewRecorder()
+
+			h.ServeHTTP(rr, withClaims(req, "user-1"))
+
+			_, trailer := parseResponse(t, rr.Body.Bytes())
+			if !strings.Contains(trailer, tt.wantTrailer) {
+				t.Errorf("expected trailer containing %q, got %q", tt.wantTrailer, trailer)
+			}
+		})
+	}
+}
+
+func TestDecodeText_ConcatenatedChunks(t *testing.T) {
+	body := base64.StdEncoding.EncodeToString([]byte("a")) + base64.StdEncoding.EncodeToString([]byte("bcd"))
+
+	got, err := decodeText([]byte(body))
+	if err != nil {
+		t.Fatalf("decodeText() error = %v", err)
+	}
+	if string(got) != "abcd" {
+		t.Errorf("expected %q, got %q", "abcd", got)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"1S", time.Second, true},
+		{"250m", 250 * time.Millisecond, true},
+		{"2H", 2 * time.Hour, true},
+		{"", 0, false},
+		{"5", 0, false},
+		{"10x", 0, false},
+		{"123456789S", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseTimeout(tt.value)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseTimeout(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
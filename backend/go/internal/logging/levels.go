@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Trace turns on debug logging for a user or a session until it expires.
+type Trace struct {
+	UserID    string    `json:"user_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Levels is a log level that can be changed while loggers use it, and that
+// lets through debug records about traced users and sessions whatever the
+// level. Pass it to New as the level.
+type Levels struct {
+	level slog.LevelVar
+
+	mu sync.RWMutex
+	// beforeDebug is the level ToggleDebug returns to; the zero Level is
+	// info.
+	beforeDebug slog.Level
+	traces      []Trace
+	now         func() time.Time
+}
+
+// NewLevels returns Levels at level.
+func NewLevels(level slog.Level) *Levels {
+	l := &Levels{now: time.Now}
+	l.level.Set(level)
+	return l
+}
+
+// Level returns the current level.
+func (l *Levels) Level() slog.Level {
+	return l.level.Level()
+}
+
+// Set changes the level.
+func (l *Levels) Set(level slog.Level) {
+	l.level.Set(level)
+}
+
+// ToggleDebug changes the level to debug, or if it is debug already back
+// to the level it had before, info if none, and returns the new level.
+func (l *Levels) ToggleDebug() slog.Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current := l.level.Level(); current != slog.LevelDebug {
+		l.beforeDebug = current
+		l.level.Set(slog.LevelDebug)
+	} else {
+		l.level.Set(l.beforeDebug)
+	}
+	return l.level.Level()
+}
+
+// AddTrace logs records about the user or session of t at debug level
+// until t expires, replacing any trace of the same user or session.
+func (l *Levels) AddTrace(t Trace) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.traces = slices.DeleteFunc(l.expired(), func(other Trace) bool {
+		return other.UserID == t.UserID && other.SessionID == t.SessionID
+	})
+	l.traces = append(l.traces, t)
+}
+
+// ClearTraces ends every trace.
+func (l *Levels) ClearTraces() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.traces = nil
+}
+
+// Traces returns the traces that have not expired.
+func (l *Levels) Traces() []Trace {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.traces = l.expired()
+	return slices.Clone(l.traces)
+}
+
+// expired drops the traces that have expired from l.traces, with l.mu held.
+func (l *Levels) expired() []Trace {
+	now := l.now()
+	return slices.DeleteFunc(l.traces, func(t Trace) bool { return !now.Before(t.ExpiresAt) })
+}
+
+// enabled reports whether a record at level, with the fields of ctx and
+// bound, is logged.
+func (l *Levels) enabled(ctx context.Context, level slog.Level, bound []slog.Attr) bool {
+	if level >= l.Level() {
+		return true
+	}
+	if level < slog.LevelDebug {
+		return false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.traces) == 0 {
+		return false
+	}
+	var attrs []slog.Attr
+	if ctx != nil {
+		attrs = attrsFrom(ctx)
+	}
+	now := l.now()
+	for _, t := range l.traces {
+		if now.Before(t.ExpiresAt) && (traces(t.UserID, KeyUserID, attrs, bound) || traces(t.SessionID, KeySessionID, attrs, bound)) {
+			return true
+		}
+	}
+	return false
+}
+
+// traces reports whether a trace of value, if any, matches the field key
+// among attrs or bound.
+func traces(value, key string, attrs, bound []slog.Attr) bool {
+	if value == "" {
+		return false
+	}
+	match := func(a slog.Attr) bool { return a.Key == key && a.Value.String() == value }
+	return slices.ContainsFunc(attrs, match) || slices.ContainsFunc(bound, match)
+}
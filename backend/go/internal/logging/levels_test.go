@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevels_Traces(t *testing.T) {
+	var buf bytes.Buffer
+	levels := NewLevels(slog.LevelWarn)
+	now := time.Now()
+	levels.now = func() time.Time { return now }
+	logger, err := New(&buf, FormatText, levels)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	levels.AddTrace(Trace{UserID: "user-1", ExpiresAt: now.Add(time.Minute)})
+	levels.AddTrace(Trace{SessionID: "s1", ExpiresAt: now.Add(time.Minute)})
+
+	logger.DebugContext(With(context.Background(), KeyUserID, "user-1"), "traced user")
+	logger.DebugContext(With(context.Background(), KeyUserID, "user-2"), "other user")
+	Logger(With(context.Background(), KeySessionID, "s1"), logger).Info("traced session")
+	logger.Info("no fields")
+	logger.Warn("at level")
+
+	for _, want := range []string{"traced user", "traced session", "at level"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q logged, got %q", want, buf.String())
+		}
+	}
+	for _, unwanted := range []string{"other user", "no fields"} {
+		if strings.Contains(buf.String(), unwanted) {
+			t.Errorf("expected %q dropped, got %q", unwanted, buf.String())
+		}
+	}
+
+	now = now.Add(time.Minute)
+	buf.Reset()
+	logger.DebugContext(With(context.Background(), KeyUserID, "user-1"), "expired trace")
+	if buf.Len() != 0 || len(levels.Traces()) != 0 {
+		t.Errorf("expected expired traces dropped, got %q and %v", buf.String(), levels.Traces())
+	}
+}
+
+func TestLevels_ToggleDebug(t *testing.T) {
+	levels := NewLevels(slog.LevelWarn)
+	if got := levels.ToggleDebug(); got != slog.LevelDebug {
+		t.Errorf("first toggle = %v, want debug", got)
+	}
+	if got := levels.ToggleDebug(); got != slog.LevelWarn {
+		t.Errorf("second toggle = %v, want warn", got)
+	}
+
+	// Started at debug, it toggles to info.
+	if got := NewLevels(slog.LevelDebug).ToggleDebug(); got != slog.LevelInfo {
+		t.Errorf("toggle from debug = %v, want info", got)
+	}
+}
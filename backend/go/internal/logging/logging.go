@@ -0,0 +1,152 @@
+// Package logging builds the gateway's structured logger and carries
+// request-scoped fields, such as the request, user and session IDs, in
+// contexts so every log line about a request can be correlated.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/neuronai/backend/go/internal/redact"
+)
+
+// Keys of the contextual fields attached by the gateway.
+const (
+	KeyRequestID = "request_id"
+	KeyUserID    = "user_id"
+	KeySessionID = "session_id"
+)
+
+// Formats a logger may write.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Option configures a logger built by New.
+type Option func(*slog.HandlerOptions)
+
+// WithRedactor masks the messages and fields of every record with r, unless
+// it is nil.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(o *slog.HandlerOptions) {
+		if r != nil {
+			o.ReplaceAttr = r.ReplaceAttr
+		}
+	}
+}
+
+// New returns a logger writing records at level and above to w in format.
+// Records logged with a context carry the fields added to it by With. A
+// *slog.LevelVar or *Levels level can be changed while the logger is in
+// use, and *Levels also logs debug records about the users and sessions it
+// traces.
+func New(w io.Writer, format string, level slog.Leveler, options ...Option) (*slog.Logger, error) {
+	levels, _ := level.(*Levels)
+	if levels != nil {
+		// Levels decides; the handler only stops what no trace could want.
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	for _, opt := range options {
+		opt(opts)
+	}
+	var h slog.Handler
+	switch format {
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{Handler: h, levels: levels}), nil
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, err
+	}
+	return level, nil
+}
+
+type attrsKey struct{}
+
+// With returns a context whose log records carry args, key-value pairs or
+// slog.Attrs, in addition to those of ctx.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := attrsFrom(ctx)
+	r := slog.Record{}
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// Logger returns l with the fields of ctx bound to it, for work that
+// outlives ctx, such as a WebSocket connection outliving its upgrade request.
+func Logger(ctx context.Context, l *slog.Logger) *slog.Logger {
+	attrs := attrsFrom(ctx)
+	if len(attrs) == 0 {
+		return l
+	}
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	return l.With(args...)
+}
+
+// Err returns the conventional attribute for err.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	// Clip, so appends by one derived context never show in another.
+	return attrs[:len(attrs):len(attrs)]
+}
+
+// contextHandler adds the fields of the record's context.
+type contextHandler struct {
+	slog.Handler
+	// levels, if set, decides which records are logged, from their level
+	// and their fields: those of their context and those bound, the
+	// attributes the logger was given.
+	levels *Levels
+	bound  []slog.Attr
+}
+
+func (h contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.levels != nil && !h.levels.enabled(ctx, level, h.bound) {
+		return false
+	}
+	return h.Handler.Enabled(ctx, level)
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		r.AddAttrs(attrsFrom(ctx)...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	bound := h.bound
+	if h.levels != nil {
+		bound = append(bound[:len(bound):len(bound)], attrs...)
+	}
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, bound: bound}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, bound: h.bound}
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/redact"
+)
+
+func TestNew_ContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx := With(context.Background(), KeyRequestID, "req-1")
+	child := With(ctx, KeyUserID, "user-1")
+	// A sibling must not see the child's fields.
+	With(ctx, KeyUserID, "user-2")
+
+	logger.InfoContext(child, "Chat failed", Err(errors.New("boom")))
+	logger.DebugContext(child, "dropped below level")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if got["msg"] != "Chat failed" || got[KeyRequestID] != "req-1" || got[KeyUserID] != "user-1" || got["error"] != "boom" {
+		t.Errorf("unexpected record %v", got)
+	}
+}
+
+func TestLogger_BindsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, FormatText, slog.LevelDebug)
+
+	ctx := With(context.Background(), KeySessionID, "s1")
+	Logger(ctx, logger).Debug("Client registered")
+
+	if !bytes.Contains(buf.Bytes(), []byte("session_id=s1")) {
+		t.Errorf("expected bound session_id, got %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := New(nil, "xml", slog.LevelInfo); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestNew_Redaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, FormatJSON, slog.LevelInfo, WithRedactor(redact.New(nil, true)))
+
+	ctx := With(context.Background(), KeyUserID, "alice")
+	logger.InfoContext(ctx, "Refresh token reused", "remote_addr", "10.0.0.1:5000", Err(errors.New("token for a@b.io")))
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if got[KeyUserID] == "alice" || got["remote_addr"] == "10.0.0.1:5000" || got["error"] != "token for [email]" {
+		t.Errorf("expected the record to be redacted, got %v", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Package maintenance holds the gateway's maintenance flag: while it is set,
+// new chats are refused with 503 Service Unavailable and a Retry-After
+// header, and chats already streaming run to completion. A read-only window
+// degrades the gateway further, refusing requests that change data too,
+// while health checks, history and session reads are still served.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// CodeMaintenance is the error code of chats refused during maintenance.
+const CodeMaintenance = "MAINTENANCE"
+
+// CodeReadOnly is the error code of requests changing data refused while
+// the gateway is read-only.
+const CodeReadOnly = "READ_ONLY"
+
+// DefaultMessage is told to clients when maintenance is entered without one,
+// and DefaultReadOnlyMessage when a read-only window is.
+const (
+	DefaultMessage         = "The service is down for maintenance"
+	DefaultReadOnlyMessage = "The service is read-only for now: history can be read, but new chats and changes are paused"
+)
+
+// Sources of a maintenance window.
+const (
+	SourceConfig = "config"
+	SourceAdmin  = "admin"
+	SourceFile   = "file"
+)
+
+// State describes the maintenance flag.
+type State struct {
+	Enabled bool `json:"enabled"`
+	// Message is shown to refused clients.
+	Message string `json:"message,omitempty"`
+	// RetryAfter is how long clients are told to wait, in seconds.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Since is when maintenance began.
+	Since *time.Time `json:"since,omitempty"`
+	// Source is what turned maintenance on: config, admin or file.
+	Source string `json:"source,omitempty"`
+	// ReadOnly also refuses requests that change data.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// Mode is the runtime maintenance flag. The zero value is not in
+// maintenance; use New.
+type Mode struct {
+	retryAfter time.Duration
+
+	mu    sync.RWMutex
+	state State
+	now   func() time.Time
+}
+
+// New returns a Mode that tells clients to retry after retryAfter unless a
+// window sets its own.
+func New(retryAfter time.Duration) *Mode {
+	return &Mode{retryAfter: retryAfter, now: time.Now}
+}
+
+// Enable starts a maintenance window from source, or updates the current
+// one. An empty message or zero retryAfter takes the defaults.
+func (m *Mode) Enable(source, message string, retryAfter time.Duration) {
+	m.enable(source, message, retryAfter, false)
+}
+
+// EnableReadOnly starts a read-only window from source, or turns the current
+// window read-only, as Enable does.
+func (m *Mode) EnableReadOnly(source, message string, retryAfter time.Duration) {
+	m.enable(source, message, retryAfter, true)
+}
+
+func (m *Mode) enable(source, message string, retryAfter time.Duration, readOnly bool) {
+	switch {
+	case message != "":
+	case readOnly:
+		message = DefaultReadOnlyMessage
+	default:
+		message = DefaultMessage
+	}
+	if retryAfter <= 0 {
+		retryAfter = m.retryAfter
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	since := m.state.Since
+	if !m.state.Enabled {
+		now := m.now()
+		since = &now
+	}
+	m.state = State{
+		Enabled:    true,
+		Message:    message,
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+		Since:      since,
+		Source:     source,
+		ReadOnly:   readOnly,
+	}
+}
+
+// Disable ends the maintenance window, if any.
+func (m *Mode) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = State{}
+}
+
+// State returns the current state.
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Enabled reports whether the gateway is in maintenance.
+func (m *Mode) Enabled() bool {
+	return m.State().Enabled
+}
+
+// Err returns an *Error describing the current window, or nil outside
+// maintenance.
+func (m *Mode) Err() error {
+	s := m.State()
+	if !s.Enabled {
+		return nil
+	}
+	return &Error{Message: s.Message, RetryAfter: s.RetryAfter}
+}
+
+// Error refuses a chat during maintenance.
+type Error struct {
+	Message    string
+	RetryAfter int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Middleware refuses requests with 503 Service Unavailable, a Retry-After
+// header and the JSON error body of docs/api.md while in maintenance. Mount
+// it on the routes that start chats; requests already being served are not
+// affected.
+func (m *Mode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := m.State()
+		if !s.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		refuse(w, s, CodeMaintenance)
+	})
+}
+
+// safeMethods only read, and are served in read-only windows.
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// ReadOnlyMiddleware refuses requests other than GET, HEAD and OPTIONS, as
+// Middleware does but with the READ_ONLY code, while the gateway is
+// read-only. Mount it on the routes that change data.
+func (m *Mode) ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := m.State()
+		if !s.ReadOnly || safeMethods[r.Method] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		refuse(w, s, CodeReadOnly)
+	})
+}
+
+// refuse answers 503 Service Unavailable with a Retry-After header and the
+// JSON error body of docs/api.md with code.
+func refuse(w http.ResponseWriter, s State, code string) {
+	w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": s.Message,
+			"details": map[string]string{"retry_after": strconv.Itoa(s.RetryAfter)},
+		},
+	})
+}
+
+type enableRequest struct {
+	Message string `json:"message"`
+	// RetryAfter is in seconds.
+	RetryAfter int  `json:"retry_after"`
+	ReadOnly   bool `json:"read_only"`
+}
+
+// Handler serves /admin/maintenance: GET reports the state, PUT enters
+// maintenance with an optional message and retry_after, read-only if
+// read_only, and DELETE leaves it.
+func (m *Mode) Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req enableRequest
+		if r.ContentLength != 0 {
+			if err := middleware.DecodeJSON(r.Body, &req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.RetryAfter < 0 {
+			http.Error(w, "retry_after must not be negative", http.StatusBadRequest)
+			return
+		}
+		m.enable(SourceAdmin, req.Message, time.Duration(req.RetryAfter)*time.Second, req.ReadOnly)
+	case http.MethodDelete:
+		m.Disable()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.State())
+}
+
+// WatchFile polls path every interval until ctx is done: while the file
+// exists the gateway is in maintenance, with the file's contents, if any, as
+// the message. Removing the file only ends a window the file started, so it
+// does not override an operator's PUT /admin/maintenance.
+func (m *Mode) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkFile(path)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Mode) checkFile(path string) {
+	data, err := os.ReadFile(path)
+	s := m.State()
+	switch {
+	case err == nil:
+		message := strings.TrimSpace(string(data))
+		if !s.Enabled || s.Source == SourceFile && s.Message != orDefault(message) {
+			m.Enable(SourceFile, message, 0)
+		}
+	case s.Enabled && s.Source == SourceFile:
+		m.Disable()
+	}
+}
+
+func orDefault(message string) string {
+	if message == "" {
+		return DefaultMessage
+	}
+	return message
+}
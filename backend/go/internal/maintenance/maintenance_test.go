@@ -0,0 +1,155 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMode_Middleware(t *testing.T) {
+	m := New(5 * time.Minute)
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil))
+		return rec
+	}
+
+	if rec := serve(); rec.Code != http.StatusOK {
+		t.Fatalf("expected requests through outside maintenance, got %d", rec.Code)
+	}
+
+	m.Enable(SourceAdmin, "Upgrading the database", 90*time.Second)
+	rec := serve()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "90" {
+		t.Fatalf("expected 503 with Retry-After 90, got %d %v", rec.Code, rec.Header())
+	}
+	var body struct {
+		Error struct {
+			Code    string            `json:"code"`
+			Message string            `json:"message"`
+			Details map[string]string `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != CodeMaintenance || body.Error.Message != "Upgrading the database" || body.Error.Details["retry_after"] != "90" {
+		t.Errorf("unexpected error body %+v", body.Error)
+	}
+
+	m.Disable()
+	if rec := serve(); rec.Code != http.StatusOK {
+		t.Errorf("expected requests through after maintenance, got %d", rec.Code)
+	}
+}
+
+func TestMode_ReadOnlyMiddleware(t *testing.T) {
+	m := New(time.Minute)
+	handler := m.ReadOnlyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/api/v1/keys", nil))
+		return rec
+	}
+
+	// Maintenance alone only pauses chats.
+	m.Enable(SourceAdmin, "", 0)
+	if rec := serve(http.MethodPost); rec.Code != http.StatusOK {
+		t.Fatalf("expected writes through outside read-only windows, got %d", rec.Code)
+	}
+
+	m.EnableReadOnly(SourceConfig, "", 0)
+	if rec := serve(http.MethodGet); rec.Code != http.StatusOK {
+		t.Errorf("expected reads through, got %d", rec.Code)
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		rec := serve(method)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("%s: expected 503 with Retry-After 60, got %d %v", method, rec.Code, rec.Header())
+		}
+		if !strings.Contains(rec.Body.String(), `"code":"`+CodeReadOnly+`"`) {
+			t.Errorf("%s: unexpected body %s", method, rec.Body)
+		}
+	}
+}
+
+func TestMode_Handler(t *testing.T) {
+	m := New(5 * time.Minute)
+	serve := func(method, body string) State {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		m.Handler(rec, httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", method, rec.Code, rec.Body)
+		}
+		var s State
+		if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if s := serve(http.MethodGet, ""); s.Enabled {
+		t.Errorf("expected maintenance off, got %+v", s)
+	}
+	s := serve(http.MethodPut, "")
+	if !s.Enabled || s.Message != DefaultMessage || s.RetryAfter != 300 || s.Source != SourceAdmin || s.Since == nil {
+		t.Errorf("unexpected state %+v", s)
+	}
+	since := *s.Since
+	s = serve(http.MethodPut, `{"message":"Back soon","retry_after":60}`)
+	if s.Message != "Back soon" || s.RetryAfter != 60 || !s.Since.Equal(since) {
+		t.Errorf("expected the window updated in place, got %+v", s)
+	}
+	s = serve(http.MethodPut, `{"read_only":true}`)
+	if !s.ReadOnly || s.Message != DefaultReadOnlyMessage || !s.Since.Equal(since) {
+		t.Errorf("expected the window turned read-only, got %+v", s)
+	}
+	if s := serve(http.MethodDelete, ""); s.Enabled || s.ReadOnly {
+		t.Errorf("expected maintenance off, got %+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler(rec, httptest.NewRequest(http.MethodPut, "/admin/maintenance", strings.NewReader(`{"retry_after":-1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative retry_after, got %d", rec.Code)
+	}
+}
+
+func TestMode_CheckFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	m := New(time.Minute)
+
+	m.checkFile(path)
+	if m.Enabled() {
+		t.Fatal("expected no maintenance without the file")
+	}
+
+	if err := os.WriteFile(path, []byte("Migrating\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.checkFile(path)
+	if s := m.State(); !s.Enabled || s.Source != SourceFile || s.Message != "Migrating" {
+		t.Fatalf("unexpected state %+v", s)
+	}
+
+	os.Remove(path)
+	m.checkFile(path)
+	if m.Enabled() {
+		t.Fatal("expected removing the file to end its window")
+	}
+
+	// An operator's window outlives the file.
+	m.Enable(SourceAdmin, "", 0)
+	m.checkFile(path)
+	if !m.Enabled() {
+		t.Error("expected the admin window to be kept")
+	}
+}
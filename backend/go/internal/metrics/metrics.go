@@ -0,0 +1,397 @@
+// Package metrics owns the gateway's Prometheus registry and the collectors
+// recorded by the HTTP, gRPC and WebSocket layers, served with the Go
+// runtime and process collectors by Handler.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "neuronai_gateway"
+
+var registry = prometheus.NewRegistry()
+
+var chatDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "chat_duration_seconds",
+	Help:      "Time from request receipt to the final response for chat and streaming chat requests.",
+	Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+}, []string{"transport", "outcome"})
+
+var httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_requests_total",
+	Help:      "HTTP requests served, by route pattern, method and status.",
+}, []string{"route", "method", "status"})
+
+var httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Time to serve HTTP requests, by route pattern and method. Upgraded WebSocket connections are not timed.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "method"})
+
+var grpcCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "grpc_client_calls_total",
+	Help:      "Calls and streams made to the AI backends, by gRPC method and status code.",
+}, []string{"method", "code"})
+
+var grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "grpc_client_call_duration_seconds",
+	Help:      "Duration of calls and streams made to the AI backends, by gRPC method.",
+	Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+}, []string{"method"})
+
+var wsThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "websocket_throttled_total",
+	Help:      "WebSocket client messages and connections rejected by limits.",
+}, []string{"limit"})
+
+var httpThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_throttled_total",
+	Help:      "HTTP requests rejected by rate limits.",
+}, []string{"route"})
+
+var ipDenied = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "ip_denied_total",
+	Help:      "HTTP requests rejected by IP allow and deny rules.",
+}, []string{"rule"})
+
+var loginFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "login_failures_total",
+	Help:      "Logins rejected for invalid credentials.",
+})
+
+var loginThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "login_throttled_total",
+	Help:      "Login attempts refused during a delay or lockout after repeated failures.",
+}, []string{"reason"})
+
+var loginLockouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "login_lockouts_total",
+	Help:      "Accounts and client IPs locked out after repeated failed logins.",
+}, []string{"scope"})
+
+var jwtSecretVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "jwt_secret_verifications_total",
+	Help:      "HS256 tokens accepted, by the shared secret that verified them: primary, or previous_N for the Nth of JWT_PREVIOUS_SECRETS.",
+}, []string{"secret"})
+
+var wsConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "websocket_connections",
+	Help:      "WebSocket clients registered with the hub.",
+})
+
+var wsRegistrations = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "websocket_registrations_total",
+	Help:      "WebSocket clients registered with the hub since startup.",
+})
+
+var wsMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "websocket_messages_total",
+	Help:      "WebSocket frames read from and written to clients.",
+}, []string{"direction"})
+
+var wsHandlers = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "websocket_handlers_in_flight",
+	Help:      "WebSocket chats being handled in the background.",
+})
+
+var wsSendBufferDrops = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "websocket_send_buffer_drops_total",
+	Help:      "WebSocket clients disconnected because their send buffer was full.",
+})
+
+var wsInvalidMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "websocket_invalid_messages_total",
+	Help:      "WebSocket client messages rejected as malformed or unsupported.",
+}, []string{"code"})
+
+var wsRTT = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "websocket_rtt_seconds",
+	Help:      "WebSocket ping to pong round-trip time.",
+	Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+})
+
+var schedulerQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "scheduler_queued",
+	Help:      "Calls to the Python service waiting for a slot, by priority.",
+}, []string{"priority"})
+
+var schedulerWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "scheduler_wait_seconds",
+	Help:      "Time calls to the Python service waited for a slot, by priority and outcome.",
+	Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+}, []string{"priority", "outcome"})
+
+var abuseDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "abuse_decisions_total",
+	Help:      "Abuse detection decisions, by action and whether they were enforced.",
+}, []string{"action", "mode"})
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		chatDuration,
+		httpRequests,
+		httpDuration,
+		grpcCalls,
+		grpcDuration,
+		wsThrottled,
+		httpThrottled,
+		ipDenied,
+		loginFailures,
+		loginThrottled,
+		loginLockouts,
+		jwtSecretVerifications,
+		wsConnections,
+		wsRegistrations,
+		wsMessages,
+		wsHandlers,
+		wsSendBufferDrops,
+		wsInvalidMessages,
+		wsRTT,
+		schedulerQueued,
+		schedulerWait,
+		abuseDecisions,
+	)
+}
+
+// Transports label which entry point served a chat.
+const (
+	TransportREST      = "rest"
+	TransportSSE       = "sse"
+	TransportWebSocket = "websocket"
+	TransportGraphQL   = "graphql"
+)
+
+// ObserveChat records the duration of a chat since start, with the outcome
+// "cancelled" if err is context.Canceled. When traceID is set it is attached
+// as an exemplar so dashboards can link to the trace.
+func ObserveChat(transport string, err error, start time.Time, traceID string) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.Canceled):
+		outcome = "cancelled"
+	case err != nil:
+		outcome = "error"
+	}
+
+	observer := chatDuration.WithLabelValues(transport, outcome)
+	elapsed := time.Since(start).Seconds()
+	if exemplar, ok := observer.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplar.ObserveWithExemplar(elapsed, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	observer.Observe(elapsed)
+}
+
+// WebSocket limits: per-client message and stream limits, and per-user and
+// per-instance connection caps.
+const (
+	LimitMessages        = "messages"
+	LimitStreams         = "streams"
+	LimitUserConnections = "user_connections"
+	LimitConnections     = "connections"
+)
+
+// methods are the HTTP methods labelled as such; others are labelled
+// "other", so clients cannot grow the label set.
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// ObserveHTTPRequest records an HTTP request to route, the pattern it was
+// served by, answered with status after elapsed. An upgraded connection,
+// with status 101, is counted but not timed.
+func ObserveHTTPRequest(route, method string, status int, elapsed time.Duration) {
+	if !methods[method] {
+		method = "other"
+	}
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	if status != http.StatusSwitchingProtocols {
+		httpDuration.WithLabelValues(route, method).Observe(elapsed.Seconds())
+	}
+}
+
+// ObserveGRPCCall records a call or stream of method to an AI backend,
+// which ended with code after elapsed.
+func ObserveGRPCCall(method, code string, elapsed time.Duration) {
+	grpcCalls.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method).Observe(elapsed.Seconds())
+}
+
+// ObserveThrottled counts a WebSocket message or connection rejected by
+// limit.
+func ObserveThrottled(limit string) {
+	wsThrottled.WithLabelValues(limit).Inc()
+}
+
+// ObserveHTTPThrottled counts an HTTP request to route rejected by its rate
+// limit.
+func ObserveHTTPThrottled(route string) {
+	httpThrottled.WithLabelValues(route).Inc()
+}
+
+// ObserveIPDenied counts an HTTP request rejected by the IP rule of a path
+// prefix, or "global".
+func ObserveIPDenied(rule string) {
+	ipDenied.WithLabelValues(rule).Inc()
+}
+
+// ObserveLoginFailure counts a login rejected for invalid credentials.
+func ObserveLoginFailure() {
+	loginFailures.Inc()
+}
+
+// ObserveLoginThrottled counts a login attempt refused for reason, a delay
+// or a lockout.
+func ObserveLoginThrottled(reason string) {
+	loginThrottled.WithLabelValues(reason).Inc()
+}
+
+// ObserveLockout counts a lockout of scope, an account or a client IP.
+func ObserveLockout(scope string) {
+	loginLockouts.WithLabelValues(scope).Inc()
+}
+
+// SecretPrimary labels tokens verified by JWT_SECRET.
+const SecretPrimary = "primary"
+
+// ObserveJWTSecret counts an HS256 token accepted after secret, SecretPrimary
+// or one named by PreviousSecret, verified it.
+func ObserveJWTSecret(secret string) {
+	jwtSecretVerifications.WithLabelValues(secret).Inc()
+}
+
+// PreviousSecret labels tokens verified by the nth, from 1, of
+// JWT_PREVIOUS_SECRETS.
+func PreviousSecret(n int) string {
+	return "previous_" + strconv.Itoa(n)
+}
+
+// Directions of WebSocket frames relative to the gateway.
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// ObserveConnected counts a WebSocket client registering with the hub.
+func ObserveConnected() {
+	wsConnections.Inc()
+	wsRegistrations.Inc()
+}
+
+// ObserveDisconnected counts a WebSocket client leaving the hub.
+func ObserveDisconnected() {
+	wsConnections.Dec()
+}
+
+// ObserveMessages counts n WebSocket frames in direction.
+func ObserveMessages(direction string, n int) {
+	wsMessages.WithLabelValues(direction).Add(float64(n))
+}
+
+// ObserveHandlerStarted and ObserveHandlerFinished bracket a WebSocket chat
+// handled in the background.
+func ObserveHandlerStarted() {
+	wsHandlers.Inc()
+}
+
+func ObserveHandlerFinished() {
+	wsHandlers.Dec()
+}
+
+// ObserveSendBufferDrop counts a WebSocket client disconnected because its
+// send buffer was full.
+func ObserveSendBufferDrop() {
+	wsSendBufferDrops.Inc()
+}
+
+// ObserveInvalidMessage counts a WebSocket client message rejected with the
+// error code code.
+func ObserveInvalidMessage(code string) {
+	wsInvalidMessages.WithLabelValues(code).Inc()
+}
+
+// ObserveRTT records a WebSocket ping to pong round-trip time.
+func ObserveRTT(rtt time.Duration) {
+	wsRTT.Observe(rtt.Seconds())
+}
+
+// TraceID extracts the trace id from a W3C traceparent header
+// ("00-<trace-id>-<span-id>-<flags>"), or returns "" if there is none.
+func TraceID(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	for _, c := range parts[1] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+	return parts[1]
+}
+
+// Handler serves the registry. Exemplars are only emitted in the OpenMetrics
+// format, which Prometheus negotiates when exemplar storage is enabled.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
+
+// SetSchedulerQueued reports n calls of priority waiting for a slot.
+func SetSchedulerQueued(priority string, n int) {
+	schedulerQueued.WithLabelValues(priority).Set(float64(n))
+}
+
+// ObserveSchedulerWait records how long a call of priority waited for a
+// slot, and whether it got one.
+func ObserveSchedulerWait(priority string, wait time.Duration, admitted bool) {
+	outcome := "admitted"
+	if !admitted {
+		outcome = "shed"
+	}
+	schedulerWait.WithLabelValues(priority, outcome).Observe(wait.Seconds())
+}
+
+// ObserveAbuseDecision counts an abuse detection decision of action, made
+// in shadow mode if shadow is set.
+func ObserveAbuseDecision(action string, shadow bool) {
+	mode := "enforce"
+	if shadow {
+		mode = "shadow"
+	}
+	abuseDecisions.WithLabelValues(action, mode).Inc()
+}
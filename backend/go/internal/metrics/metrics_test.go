@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		want        string
+	}{
+		{"missing header", "", ""},
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"all zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"short trace id", "00-4bf92f35-00f067aa0ba902b7-01", ""},
+		{"wrong part count", "00-4bf92f3577b34da6a3ce929d0e0e4736", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+
+			if got := TraceID(req); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestObserveChat_Exemplar(t *testing.T) {
+	traceID := "0af7651916cd43dd8448eb211c80319c"
+	ObserveChat(TransportREST, nil, time.Now().Add(-time.Second), traceID)
+	ObserveChat(TransportSSE, errors.New("boom"), time.Now(), "")
+	ObserveChat(TransportSSE, fmt.Errorf("stream: %w", context.Canceled), time.Now(), "")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+
+	Handler().ServeHTTP(rec, req)
+
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+
+	if !strings.Contains(text, `trace_id="`+traceID+`"`) {
+		t.Errorf("expected exemplar with trace id in output:\n%s", text)
+	}
+	if !strings.Contains(text, `neuronai_gateway_chat_duration_seconds_count{outcome="error",transport="sse"} 1`) {
+		t.Errorf("expected error observation in output:\n%s", text)
+	}
+	if !strings.Contains(text, `neuronai_gateway_chat_duration_seconds_count{outcome="cancelled",transport="sse"} 1`) {
+		t.Errorf("expected cancelled observation in output:\n%s", text)
+	}
+}
+
+func TestObserveWebSocket(t *testing.T) {
+	ObserveConnected()
+	ObserveConnected()
+	ObserveDisconnected()
+	ObserveMessages(DirectionIn, 2)
+	ObserveMessages(DirectionOut, 3)
+	ObserveHandlerStarted()
+	ObserveSendBufferDrop()
+	ObserveInvalidMessage("INVALID_MESSAGE")
+	ObserveRTT(30 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := rec.Body.String()
+
+	for _, want := range []string{
+		"neuronai_gateway_websocket_connections 1",
+		"neuronai_gateway_websocket_registrations_total 2",
+		`neuronai_gateway_websocket_messages_total{direction="in"} 2`,
+		`neuronai_gateway_websocket_messages_total{direction="out"} 3`,
+		"neuronai_gateway_websocket_handlers_in_flight 1",
+		"neuronai_gateway_websocket_send_buffer_drops_total 1",
+		`neuronai_gateway_websocket_invalid_messages_total{code="INVALID_MESSAGE"} 1`,
+		`neuronai_gateway_websocket_rtt_seconds_bucket{le="0.05"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in output:\n%s", want, text)
+		}
+	}
+}
+
+func TestObserveHTTPRequest(t *testing.T) {
+	ObserveHTTPRequest("POST /api/v1/chat", http.MethodPost, http.StatusOK, 20*time.Millisecond)
+	ObserveHTTPRequest("/ws", http.MethodGet, http.StatusSwitchingProtocols, time.Minute)
+	ObserveHTTPRequest("/health", "BREW", http.StatusMethodNotAllowed, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := rec.Body.String()
+
+	for _, want := range []string{
+		`neuronai_gateway_http_requests_total{method="POST",route="POST /api/v1/chat",status="200"} 1`,
+		`neuronai_gateway_http_request_duration_seconds_bucket{method="POST",route="POST /api/v1/chat",le="0.025"} 1`,
+		`neuronai_gateway_http_requests_total{method="GET",route="/ws",status="101"} 1`,
+		`neuronai_gateway_http_requests_total{method="other",route="/health",status="405"} 1`,
+		"go_goroutines",
+		"process_open_fds",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in output:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `neuronai_gateway_http_request_duration_seconds_count{method="GET",route="/ws"}`) {
+		t.Error("expected upgraded connections not to be timed")
+	}
+}
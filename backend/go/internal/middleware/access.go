@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/audit"
+)
+
+// RoleAdmin is the conventional role of operators; see config.AdminRole.
+const RoleAdmin = "admin"
+
+// WithAudit records the authentication outcomes of JWTAuth and the access
+// decisions of RequireRole and RequireScope to sink.
+func WithAudit(sink audit.Sink) AuthOption {
+	return func(c *authConfig) {
+		c.audit = sink
+	}
+}
+
+// HasRole reports whether the caller was granted role. Unlike scopes, roles
+// are only granted explicitly.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// RequireRole rejects callers without role with 403 Forbidden. It must be
+// inside JWTAuth.
+func RequireRole(role string, opts ...AuthOption) func(http.Handler) http.Handler {
+	return requireAccess("role:"+role, func(c *Claims) (bool, string) {
+		if c.HasRole(role) {
+			return true, fmt.Sprintf("has role %q", role)
+		}
+		return false, fmt.Sprintf("missing role %q", role)
+	}, nil, opts)
+}
+
+// requireAccess rejects callers for whom check fails with deny, or plain 403
+// Forbidden if deny is nil, recording each decision on requirement to the
+// audit sink, if any.
+func requireAccess(requirement string, check func(*Claims) (bool, string), deny func(w http.ResponseWriter, reason string), opts []AuthOption) func(http.Handler) http.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaims(r.Context())
+			allowed, reason := false, "unauthenticated"
+			if ok {
+				allowed, reason = check(claims)
+			}
+			cfg.recordAccess(r, claims, requirement, allowed, reason)
+			if !allowed && deny != nil {
+				deny(w, reason)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Audited records each request to next as an event of typ, with the status
+// of its response, to the sink of WithAudit in opts. Operator endpoints are
+// recorded as audit.TypeAdmin and reads of stored conversation data as
+// audit.TypeExport.
+func Audited(typ audit.Type, opts ...AuthOption) func(http.Handler) http.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if cfg.audit == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			e := audit.RequestPeer(r)
+			e.Time = time.Now()
+			e.Type = typ
+			e.Action = r.Method
+			e.Target = r.URL.RequestURI()
+			e.Status = rec.status
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			if claims, ok := GetClaims(r.Context()); ok {
+				e.UserID = claims.UserID
+			} else {
+				// StaticTokenOr admitted the shared operator token.
+				e.Reason = "static token"
+			}
+			cfg.audit.Record(e)
+		})
+	}
+}
+
+func (c *authConfig) recordAuth(r *http.Request, claims *Claims, reason string) {
+	if c.audit == nil {
+		return
+	}
+	e := audit.RequestPeer(r)
+	e.Time = time.Now()
+	e.Type = audit.TypeHTTPAuthFailure
+	if claims != nil {
+		e.Type = audit.TypeHTTPAuthSuccess
+		e.UserID = claims.UserID
+	}
+	e.Target = r.URL.Path
+	e.Reason = reason
+	c.audit.Record(e)
+}
+
+func (c *authConfig) recordAccess(r *http.Request, claims *Claims, requirement string, allowed bool, reason string) {
+	if c.audit == nil {
+		return
+	}
+	e := audit.RequestPeer(r)
+	e.Time = time.Now()
+	e.Type = audit.TypeAccess
+	e.Action = requirement
+	e.Target = r.URL.Path
+	e.Decision = "deny"
+	if allowed {
+		e.Decision = "allow"
+	}
+	e.Reason = reason
+	if claims != nil {
+		e.UserID = claims.UserID
+	}
+	c.audit.Record(e)
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/audit"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *recordingSink) Record(e audit.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func requestWithClaims(r *http.Request, claims *Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims))
+}
+
+func TestRequireRole(t *testing.T) {
+	sink := &recordingSink{}
+	handler := RequireRole(RoleAdmin, WithAudit(sink))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		claims       *Claims
+		wantStatus   int
+		wantDecision string
+	}{
+		{"granted", &Claims{UserID: "ops", Roles: []string{RoleAdmin}}, http.StatusOK, "allow"},
+		{"not granted", &Claims{UserID: "user"}, http.StatusForbidden, "deny"},
+		{"unauthenticated", nil, http.StatusForbidden, "deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink.events = nil
+			req := httptest.NewRequest(http.MethodGet, "/admin/runtime", nil)
+			if tt.claims != nil {
+				req = requestWithClaims(req, tt.claims)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if len(sink.events) != 1 {
+				t.Fatalf("expected 1 audit event, got %d", len(sink.events))
+			}
+			e := sink.events[0]
+			if e.Type != audit.TypeAccess || e.Decision != tt.wantDecision || e.Action != "role:admin" ||
+				e.Target != "/admin/runtime" || e.Reason == "" {
+				t.Errorf("unexpected audit event %+v", e)
+			}
+		})
+	}
+}
+
+func TestRequireScope_Audit(t *testing.T) {
+	sink := &recordingSink{}
+	handler := RequireScope(ScopeChat, WithAudit(sink))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := requestWithClaims(httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil), &Claims{UserID: "svc", Scopes: []string{ScopeSessions}})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+	if len(sink.events) != 1 || sink.events[0].Decision != "deny" || sink.events[0].UserID != "svc" {
+		t.Errorf("unexpected audit events %+v", sink.events)
+	}
+}
+
+func TestStaticTokenOr(t *testing.T) {
+	secret := "test-secret-key"
+	handler := StaticTokenOr("admin-token", func(h http.Handler) http.Handler {
+		return JWTAuth(secret)(RequireRole(RoleAdmin)(h))
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantStatus int
+	}{
+		{"static token", "Bearer admin-token", http.StatusOK},
+		{"token without the role", generateValidToken(t, secret), http.StatusForbidden},
+		{"no token", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestJWTAuth_Audit(t *testing.T) {
+	sink := &recordingSink{}
+	secret := "test-secret-key"
+	handler := JWTAuth(secret, WithAudit(sink))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, auth := range []string{generateValidToken(t, secret), "Bearer invalid", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/chat", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected 3 audit events, got %+v", sink.events)
+	}
+	if e := sink.events[0]; e.Type != audit.TypeHTTPAuthSuccess || e.UserID != "test-user" || e.Target != "/api/v1/chat" {
+		t.Errorf("unexpected success event %+v", e)
+	}
+	if e := sink.events[1]; e.Type != audit.TypeHTTPAuthFailure || e.Reason != "invalid token" {
+		t.Errorf("unexpected failure event %+v", e)
+	}
+	if e := sink.events[2]; e.Type != audit.TypeHTTPAuthFailure || e.Reason != "missing authorization header" {
+		t.Errorf("unexpected failure event %+v", e)
+	}
+}
+
+func TestAudited(t *testing.T) {
+	sink := &recordingSink{}
+	handler := Audited(audit.TypeAdmin, WithAudit(sink))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit?type=ws.connect", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), requestWithClaims(req, &Claims{UserID: "ops"}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/runtime", nil))
+
+	if len(sink.events) != 2 {
+		t.Fatalf("expected 2 audit events, got %+v", sink.events)
+	}
+	if e := sink.events[0]; e.Type != audit.TypeAdmin || e.UserID != "ops" || e.Action != "GET" || e.Target != "/admin/audit?type=ws.connect" || e.Status != http.StatusAccepted {
+		t.Errorf("unexpected admin event %+v", e)
+	}
+	if e := sink.events[1]; e.UserID != "" || e.Reason != "static token" {
+		t.Errorf("expected static token event, got %+v", e)
+	}
+}
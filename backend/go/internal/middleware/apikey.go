@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// APIKeyHeader carries the API key of server-to-server callers, which
+// authenticate with it instead of a JWT.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a key as stored at rest: only its SHA-256 hash is kept.
+type APIKey struct {
+	Name string `json:"name"`
+	// Hash is the hex-encoded SHA-256 of the key; see HashAPIKey.
+	Hash string `json:"hash"`
+	// UserID is the user the key acts as. It defaults to "apikey:" and the
+	// key's name.
+	UserID string   `json:"user_id,omitempty"`
+	Scopes []string `json:"scopes"`
+	Roles  []string `json:"roles,omitempty"`
+	// TenantID is the tenant the key's usage is charged to.
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// APIKeys resolves API keys to the claims of the caller they identify.
+type APIKeys struct {
+	byHash map[string]APIKey
+}
+
+// HashAPIKey returns the hash an API key is stored by.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	a := &APIKeys{byHash: make(map[string]APIKey, len(keys))}
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("API key has no name")
+		}
+		if _, err := hex.DecodeString(k.Hash); err != nil || len(k.Hash) != 2*sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be a hex-encoded SHA-256", k.Name)
+		}
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("API key %q has no scopes", k.Name)
+		}
+		if _, ok := a.byHash[k.Hash]; ok {
+			return nil, fmt.Errorf("API key %q duplicates another key", k.Name)
+		}
+		if k.UserID == "" {
+			k.UserID = "apikey:" + k.Name
+		}
+		a.byHash[k.Hash] = k
+	}
+	return a, nil
+}
+
+// LoadAPIKeys reads a JSON array of keys from path.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %w", err)
+	}
+	return NewAPIKeys(keys)
+}
+
+// Resolve returns the synthetic claims of the caller presenting key.
+func (a *APIKeys) Resolve(key string) (*Claims, bool) {
+	k, ok := a.byHash[HashAPIKey(key)]
+	if !ok {
+		return nil, false
+	}
+	return &Claims{UserID: k.UserID, Scopes: slices.Clone(k.Scopes), Roles: slices.Clone(k.Roles), TenantID: k.TenantID, APIKey: k.Name}, true
+}
+
+// KeyStore resolves the API keys users create for themselves, as opposed to
+// the fixed keys of WithAPIKeys; apikeys.Store implements it. It reports
+// false for keys it does not know, and an error if its store cannot be
+// consulted.
+type KeyStore interface {
+	ResolveAPIKey(ctx context.Context, key string) (*Claims, bool, error)
+}
+
+// WithKeyStore also admits callers presenting a key of store in the
+// X-API-Key header. Keys of WithAPIKeys are tried first.
+func WithKeyStore(store KeyStore) AuthOption {
+	return func(c *authConfig) {
+		c.keyStore = store
+	}
+}
+
+// resolveAPIKey returns the claims of the caller presenting key, from the
+// fixed keys or the key store.
+func (c *authConfig) resolveAPIKey(ctx context.Context, key string) (*Claims, bool, error) {
+	if c.apiKeys != nil {
+		if claims, ok := c.apiKeys.Resolve(key); ok {
+			return claims, true, nil
+		}
+	}
+	if c.keyStore == nil {
+		return nil, false, nil
+	}
+	return c.keyStore.ResolveAPIKey(ctx, key)
+}
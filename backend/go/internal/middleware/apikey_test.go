@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJWTAuth_APIKey(t *testing.T) {
+	secret := "test-secret-key"
+	keys, err := NewAPIKeys([]APIKey{
+		{Name: "billing", Hash: HashAPIKey("sk-billing"), Scopes: []string{ScopeSessions}},
+		{Name: "bot", Hash: HashAPIKey("sk-bot"), UserID: "svc-bot", Scopes: []string{ScopeChat}},
+	})
+	if err != nil {
+		t.Fatalf("NewAPIKeys() error = %v", err)
+	}
+
+	var got *Claims
+	handler := JWTAuth(secret, WithAPIKeys(keys))(RequireScope(ScopeChat)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetClaims(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		authHeader string
+		wantStatus int
+		wantUser   string
+	}{
+		{"scoped key", "sk-bot", "", http.StatusOK, "svc-bot"},
+		{"key without the scope", "sk-billing", "", http.StatusForbidden, ""},
+		{"unknown key", "sk-forged", "", http.StatusUnauthorized, ""},
+		{"bearer token alongside", "", generateValidToken(t, secret), http.StatusOK, "test-user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantUser != "" && (got == nil || got.UserID != tt.wantUser) {
+				t.Errorf("expected claims for %s, got %+v", tt.wantUser, got)
+			}
+		})
+	}
+
+	// Without WithAPIKeys the header is ignored.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(APIKeyHeader, "sk-bot")
+	rec := httptest.NewRecorder()
+	JWTAuth(secret)(handler).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without API keys configured, got %d", rec.Code)
+	}
+}
+
+type fakeKeyStore struct {
+	claims *Claims
+	err    error
+}
+
+func (f fakeKeyStore) ResolveAPIKey(_ context.Context, key string) (*Claims, bool, error) {
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	return f.claims, key == "nk_managed", nil
+}
+
+func TestJWTAuth_KeyStore(t *testing.T) {
+	keys, err := NewAPIKeys([]APIKey{{Name: "bot", Hash: HashAPIKey("sk-bot"), Scopes: []string{ScopeChat}}})
+	if err != nil {
+		t.Fatalf("NewAPIKeys() error = %v", err)
+	}
+	var got *Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetClaims(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		store      fakeKeyStore
+		apiKey     string
+		wantStatus int
+		wantUser   string
+	}{
+		{"managed key", fakeKeyStore{claims: &Claims{UserID: "alice", APIKey: "k1"}}, "nk_managed", http.StatusOK, "alice"},
+		{"fixed key first", fakeKeyStore{err: errors.New("down")}, "sk-bot", http.StatusOK, "apikey:bot"},
+		{"unknown key", fakeKeyStore{}, "nk_other", http.StatusUnauthorized, ""},
+		{"store down", fakeKeyStore{err: errors.New("down")}, "nk_managed", http.StatusServiceUnavailable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			rec := httptest.NewRecorder()
+			JWTAuth("secret", WithAPIKeys(keys), WithKeyStore(tt.store))(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantUser != "" && (got == nil || got.UserID != tt.wantUser) {
+				t.Errorf("expected claims for %s, got %+v", tt.wantUser, got)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keys, err := LoadAPIKeys(write("keys.json", `[{"name":"billing","hash":"`+HashAPIKey("sk-billing")+`","scopes":["sessions"]}]`))
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	claims, ok := keys.Resolve("sk-billing")
+	if !ok || claims.UserID != "apikey:billing" || claims.APIKey != "billing" || claims.HasScope(ScopeChat) {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	for name, data := range map[string]string{
+		"plaintext.json": `[{"name":"billing","hash":"sk-billing","scopes":["sessions"]}]`,
+		"unscoped.json":  `[{"name":"billing","hash":"` + HashAPIKey("sk-billing") + `"}]`,
+		"malformed.json": `{`,
+	} {
+		if _, err := LoadAPIKeys(write(name, data)); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+}
@@ -2,12 +2,18 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/metrics"
 )
 
 type contextKey string
@@ -17,49 +23,257 @@ const claimsContextKey contextKey = "jwt_claims"
 type Claims struct {
 	UserID string `json:"sub"`
 	Email  string `json:"email"`
+	// Scopes limits what the caller may do; see HasScope.
+	Scopes []string `json:"scopes,omitempty"`
+	// Roles grant access to privileged routes; see HasRole.
+	Roles []string `json:"roles,omitempty"`
+	// TenantID is the tenant the caller's usage is charged to; see
+	// TenantResolver.
+	TenantID string `json:"tenant_id,omitempty"`
+	// Plan is the caller's subscription plan, if a ClaimsEnricher or the
+	// token names one.
+	Plan string `json:"plan,omitempty"`
+	// Guest marks the ephemeral identities of anonymous callers; see
+	// DenyGuests.
+	Guest bool `json:"guest,omitempty"`
+	// APIKey names the API key the caller authenticated with, if any.
+	APIKey string `json:"-"`
 	jwt.RegisteredClaims
 }
 
-func JWTAuth(secret string) func(http.Handler) http.Handler {
+// AuthOption configures JWTAuth.
+type AuthOption func(*authConfig)
+
+type authConfig struct {
+	apiKeys     *APIKeys
+	keyStore    KeyStore
+	signingKeys *SigningKeys
+	clientCerts *ClientCerts
+	sessions    SessionResolver
+	oidc        *OIDC
+	keySet      *KeySet
+	audit       audit.Sink
+	revoker     Revoker
+	enricher    ClaimsEnricher
+	validation  TokenValidation
+	// previousSecrets still verify HS256 tokens while JWT_SECRET rotates,
+	// until rotationEnd unless it is zero.
+	previousSecrets []string
+	rotationEnd     time.Time
+}
+
+// WithAPIKeys also admits callers presenting one of keys in the X-API-Key
+// header instead of a bearer token.
+func WithAPIKeys(keys *APIKeys) AuthOption {
+	return func(c *authConfig) {
+		c.apiKeys = keys
+	}
+}
+
+// WithPreviousSecrets also accepts HS256 tokens signed with one of secrets,
+// the retired shared secrets of a rotation window.
+func WithPreviousSecrets(secrets ...string) AuthOption {
+	return func(c *authConfig) {
+		c.previousSecrets = secrets
+	}
+}
+
+// WithRotationEnd closes the rotation window of WithPreviousSecrets at end:
+// from then on only the current secret verifies HS256 tokens.
+func WithRotationEnd(end time.Time) AuthOption {
+	return func(c *authConfig) {
+		c.rotationEnd = end
+	}
+}
+
+func JWTAuth(secret string, opts ...AuthOption) func(http.Handler) http.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(SignatureHeader) != "" && cfg.signingKeys != nil {
+				claims, err := cfg.signingKeys.Verify(r)
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					WriteBodyTooLarge(w, maxErr.Limit)
+					return
+				}
+				if err != nil {
+					cfg.recordAuth(r, nil, "signed request: "+err.Error())
+					http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+					return
+				}
+				cfg.recordAuth(r, claims, "signed request")
+				next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+				return
+			}
+
+			if key := r.Header.Get(APIKeyHeader); key != "" && (cfg.apiKeys != nil || cfg.keyStore != nil) {
+				claims, ok, err := cfg.resolveAPIKey(r.Context(), key)
+				if err != nil {
+					// Unlike revocation checks, failing open here would
+					// admit any key.
+					cfg.recordAuth(r, nil, "API key store: "+err.Error())
+					http.Error(w, "API key store unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				if !ok {
+					cfg.recordAuth(r, nil, "invalid API key")
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				cfg.recordAuth(r, claims, "API key")
+				next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
+				if claims, ok := cfg.certClaims(r); ok {
+					cfg.recordAuth(r, claims, "client certificate")
+					next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+					return
+				}
+				claims, ok, err := cfg.sessionClaims(r)
+				if err != nil {
+					cfg.recordAuth(r, nil, "session cookie: "+err.Error())
+					http.Error(w, "Session expired", http.StatusUnauthorized)
+					return
+				}
+				if ok {
+					cfg.recordAuth(r, claims, "session cookie")
+					next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+					return
+				}
+				cfg.recordAuth(r, nil, "missing authorization header")
 				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
 				return
 			}
 
 			parts := strings.SplitN(authHeader, " ", 2)
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				cfg.recordAuth(r, nil, "invalid authorization header format")
 				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
 				return
 			}
 
-			tokenString := parts[1]
-
-			token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(secret), nil
-			})
-
+			claims, err := ParseToken(secret, parts[1], opts...)
+			if errors.Is(err, ErrTokenRevoked) {
+				cfg.recordAuth(r, nil, "revoked token")
+				http.Error(w, "Token revoked", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, ErrUserDisabled) {
+				cfg.recordAuth(r, nil, "user disabled")
+				http.Error(w, "User disabled", http.StatusUnauthorized)
+				return
+			}
 			if err != nil {
+				cfg.recordAuth(r, nil, "invalid token")
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-				ctx := context.WithValue(r.Context(), claimsContextKey, claims)
-				next.ServeHTTP(w, r.WithContext(ctx))
-			} else {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-				return
-			}
+			cfg.recordAuth(r, claims, "bearer token")
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 		})
 	}
 }
 
+// ParseToken validates a JWT signed with secret, or by the identity provider
+// configured with WithOIDC or a key of WithKeySet, that meets
+// WithTokenValidation and is not revoked (see WithRevocation), and returns
+// its claims, enriched by WithEnricher. It is shared by transports that
+// cannot carry an Authorization header.
+func ParseToken(secret, tokenString string, opts ...AuthOption) (*Claims, error) {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	fromIdP := false
+	// verifiedBy labels the shared secret that verified an HS256 token.
+	verifiedBy := ""
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && secret != "" {
+			var key []byte
+			key, verifiedBy = cfg.sharedSecret(token, secret)
+			return key, nil
+		}
+		if !slices.Contains(publicKeyMethods, token.Method.Alg()) {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		// Tokens naming the identity provider as issuer are its own; any
+		// others are checked against the key set.
+		if issuer, _ := token.Claims.GetIssuer(); cfg.oidc != nil && (cfg.keySet == nil || issuer == cfg.oidc.issuer) {
+			fromIdP = true
+			return cfg.oidc.key(token)
+		}
+		if cfg.keySet != nil {
+			return cfg.keySet.key(token)
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}, cfg.validation.parserOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	if fromIdP {
+		if err := cfg.oidc.validate(claims); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.validation.validate(claims, !fromIdP); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+	if err := cfg.enrich(claims); err != nil {
+		return nil, err
+	}
+	if verifiedBy != "" {
+		metrics.ObserveJWTSecret(verifiedBy)
+	}
+	return claims, nil
+}
+
+// sharedSecret returns the secret that signed the HS256 token, secret or,
+// while the rotation window is open, one of the previous secrets, and its
+// metrics label. Tokens none of them signed get secret, and fail
+// verification.
+func (c *authConfig) sharedSecret(token *jwt.Token, secret string) ([]byte, string) {
+	if len(c.previousSecrets) == 0 || !c.rotationEnd.IsZero() && !time.Now().Before(c.rotationEnd) {
+		return []byte(secret), metrics.SecretPrimary
+	}
+	// The parser decodes the signature before asking for the key; the
+	// signed text is the raw token up to it.
+	signed := token.Raw[:strings.LastIndexByte(token.Raw, '.')]
+	if token.Method.Verify(signed, token.Signature, []byte(secret)) == nil {
+		return []byte(secret), metrics.SecretPrimary
+	}
+	for i, previous := range c.previousSecrets {
+		if token.Method.Verify(signed, token.Signature, []byte(previous)) == nil {
+			return []byte(previous), metrics.PreviousSecret(i + 1)
+		}
+	}
+	return []byte(secret), metrics.SecretPrimary
+}
+
+// withClaims stores the caller's claims in ctx and tags its log records with
+// the caller.
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = logging.With(ctx, logging.KeyUserID, claims.UserID)
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
 func GetClaims(ctx context.Context) (*Claims, bool) {
 	claims, ok := ctx.Value(claimsContextKey).(*Claims)
 	return claims, ok
@@ -70,29 +284,31 @@ func GetClaimsContextKey() interface{} {
 	return claimsContextKey
 }
 
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
+// StaticToken admits requests bearing the given token. It protects operator
+// endpoints used by deployment tooling rather than end users.
+func StaticToken(token string) func(http.Handler) http.Handler {
+	return StaticTokenOr(token, func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
 	})
 }
 
-func RequestLogger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		next.ServeHTTP(w, r)
+// StaticTokenOr admits callers presenting token, like StaticToken, and hands
+// every other request to fallback, such as JWTAuth and RequireRole. An empty
+// token admits no one by itself.
+func StaticTokenOr(token string, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		other := fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+			if token == "" || len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" ||
+				subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) != 1 {
+				other.ServeHTTP(w, r)
+				return
+			}
 
-		duration := time.Since(start)
-		fmt.Printf("[%s] %s %s - %v\n", time.Now().Format("2006-01-02 15:04:05"), r.Method, r.URL.Path, duration)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
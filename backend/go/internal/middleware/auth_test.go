@@ -112,71 +112,6 @@ func TestJWTAuth_ContextClaims(t *testing.T) {
 	}
 }
 
-func TestCORS(t *testing.T) {
-	handler := CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
-
-	tests := []struct {
-		name           string
-		method         string
-		expectedStatus int
-	}{
-		{
-			name:           "GET request",
-			method:         http.MethodGet,
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "POST request",
-			method:         http.MethodPost,
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "OPTIONS request",
-			method:         http.MethodOptions,
-			expectedStatus: http.StatusNoContent,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(tt.method, "/", nil)
-			rec := httptest.NewRecorder()
-
-			handler.ServeHTTP(rec, req)
-
-			if rec.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
-			}
-
-			if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
-				t.Error("expected Access-Control-Allow-Origin header to be *")
-			}
-
-			expectedMethods := "GET, POST, PUT, DELETE, OPTIONS"
-			if rec.Header().Get("Access-Control-Allow-Methods") != expectedMethods {
-				t.Errorf("expected Access-Control-Allow-Methods %s, got %s", expectedMethods, rec.Header().Get("Access-Control-Allow-Methods"))
-			}
-		})
-	}
-}
-
-func TestRequestLogger(t *testing.T) {
-	handler := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
-
-	req := httptest.NewRequest(http.MethodGet, "/test/path", nil)
-	rec := httptest.NewRecorder()
-
-	handler.ServeHTTP(rec, req)
-
-	if rec.Code != http.StatusOK {
-		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
-	}
-}
-
 func TestGetClaims(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -214,6 +149,39 @@ func TestGetClaims(t *testing.T) {
 	}
 }
 
+func TestStaticToken(t *testing.T) {
+	handler := StaticToken("admin-token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		authHeader     string
+		expectedStatus int
+	}{
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic admin-token", http.StatusUnauthorized},
+		{"wrong token", "Bearer other", http.StatusUnauthorized},
+		{"valid token", "Bearer admin-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/runtime", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
 func generateValidToken(t *testing.T, secret string) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		UserID: "test-user",
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CodeRequestTooLarge is the error code of requests refused for their body
+// size.
+const CodeRequestTooLarge = "REQUEST_TOO_LARGE"
+
+// BodyLimit refuses request bodies larger than max bytes with 413 Request
+// Entity Too Large. Bodies that declare their length are refused before
+// next runs; others are cut off at max, failing the handler's read with an
+// *http.MaxBytesError, which handlers report with WriteBodyTooLarge.
+func BodyLimit(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				WriteBodyTooLarge(w, max)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteBodyTooLarge writes the structured 413 error documented in
+// docs/api.md.
+func WriteBodyTooLarge(w http.ResponseWriter, max int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{
+			"code":    CodeRequestTooLarge,
+			"message": fmt.Sprintf("Request body exceeds %d bytes", max),
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// ClientCert maps the verified client certificates of a trusted service,
+// such as a peer in an internal mesh, to a caller. A certificate matches
+// when it has SAN among its URI or DNS subject alternative names, if set,
+// and OU among its subject's organizational units, if set.
+type ClientCert struct {
+	Name string `json:"name"`
+	// SAN is a URI, such as a SPIFFE ID, or a DNS name.
+	SAN string `json:"san,omitempty"`
+	OU  string `json:"ou,omitempty"`
+	// UserID is the user the service acts as. It defaults to "cert:" and
+	// the entry's name.
+	UserID   string   `json:"user_id,omitempty"`
+	Scopes   []string `json:"scopes"`
+	Roles    []string `json:"roles,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+}
+
+// ClientCerts resolves verified client certificates to the claims of the
+// service they identify.
+type ClientCerts struct {
+	certs []ClientCert
+}
+
+func NewClientCerts(certs []ClientCert) (*ClientCerts, error) {
+	certs = slices.Clone(certs)
+	names := make(map[string]bool, len(certs))
+	for i, c := range certs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("client certificate has no name")
+		}
+		if c.SAN == "" && c.OU == "" {
+			return nil, fmt.Errorf("client certificate %q matches neither a SAN nor an OU", c.Name)
+		}
+		if len(c.Scopes) == 0 {
+			return nil, fmt.Errorf("client certificate %q has no scopes", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("client certificate %q is duplicated", c.Name)
+		}
+		names[c.Name] = true
+		if c.UserID == "" {
+			certs[i].UserID = "cert:" + c.Name
+		}
+	}
+	return &ClientCerts{certs: certs}, nil
+}
+
+// LoadClientCerts reads a JSON array of certificate mappings from path.
+func LoadClientCerts(path string) (*ClientCerts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificates: %w", err)
+	}
+	var certs []ClientCert
+	if err := json.Unmarshal(data, &certs); err != nil {
+		return nil, fmt.Errorf("failed to parse client certificates: %w", err)
+	}
+	return NewClientCerts(certs)
+}
+
+// WithClientCerts also admits callers whose verified TLS client certificate
+// one of certs maps, when they present no other credentials. The listener
+// must verify client certificates; unverified ones are ignored.
+func WithClientCerts(certs *ClientCerts) AuthOption {
+	return func(c *authConfig) {
+		c.clientCerts = certs
+	}
+}
+
+// Resolve returns the synthetic claims of the first mapping cert matches.
+func (c *ClientCerts) Resolve(cert *x509.Certificate) (*Claims, bool) {
+	for _, m := range c.certs {
+		if m.SAN != "" && !hasSAN(cert, m.SAN) {
+			continue
+		}
+		if m.OU != "" && !slices.Contains(cert.Subject.OrganizationalUnit, m.OU) {
+			continue
+		}
+		return &Claims{UserID: m.UserID, Scopes: slices.Clone(m.Scopes), Roles: slices.Clone(m.Roles), TenantID: m.TenantID}, true
+	}
+	return nil, false
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, u := range cert.URIs {
+		if u.String() == san {
+			return true
+		}
+	}
+	return slices.Contains(cert.DNSNames, san)
+}
+
+// certClaims returns the claims of the verified client certificate of r, if
+// it has one that is mapped.
+func (c *authConfig) certClaims(r *http.Request) (*Claims, bool) {
+	if c.clientCerts == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+	return c.clientCerts.Resolve(r.TLS.VerifiedChains[0][0])
+}
+
+// CertClaims is the client certificate check of JWTAuth for transports that
+// authenticate outside it.
+func CertClaims(r *http.Request, opts ...AuthOption) (*Claims, bool) {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.certClaims(r)
+}
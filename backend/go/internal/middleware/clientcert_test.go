@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientCerts_Resolve(t *testing.T) {
+	certs, err := NewClientCerts([]ClientCert{
+		{Name: "billing", SAN: "spiffe://mesh/ns/prod/sa/billing", Scopes: []string{ScopeSessions}},
+		{Name: "ops", SAN: "ops.internal", OU: "platform", Scopes: []string{ScopeChat}, Roles: []string{RoleAdmin}},
+		{Name: "any-platform", OU: "platform", UserID: "svc-platform", Scopes: []string{ScopeChat}},
+	})
+	if err != nil {
+		t.Fatalf("NewClientCerts() error = %v", err)
+	}
+	spiffe, _ := url.Parse("spiffe://mesh/ns/prod/sa/billing")
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		wantUser string
+	}{
+		{"uri SAN", &x509.Certificate{URIs: []*url.URL{spiffe}}, "cert:billing"},
+		{"dns SAN and OU", &x509.Certificate{DNSNames: []string{"ops.internal"}, Subject: pkix.Name{OrganizationalUnit: []string{"platform"}}}, "cert:ops"},
+		{"OU only", &x509.Certificate{DNSNames: []string{"other.internal"}, Subject: pkix.Name{OrganizationalUnit: []string{"platform"}}}, "svc-platform"},
+		{"unmapped", &x509.Certificate{DNSNames: []string{"ops.internal"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, ok := certs.Resolve(tt.cert)
+			if ok != (tt.wantUser != "") || ok && claims.UserID != tt.wantUser {
+				t.Errorf("Resolve() = %+v, %v, want user %q", claims, ok, tt.wantUser)
+			}
+		})
+	}
+
+	if _, err := NewClientCerts([]ClientCert{{Name: "loose", Scopes: []string{ScopeChat}}}); err == nil {
+		t.Error("expected an error for a mapping matching every certificate")
+	}
+}
+
+func TestJWTAuth_ClientCert(t *testing.T) {
+	certs, err := NewClientCerts([]ClientCert{{Name: "billing", SAN: "billing.internal", Scopes: []string{ScopeSessions}}})
+	if err != nil {
+		t.Fatalf("NewClientCerts() error = %v", err)
+	}
+	var user string
+	handler := JWTAuth("test-secret-key", WithClientCerts(certs))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetClaims(r.Context())
+		user = claims.UserID
+	}))
+	cert := &x509.Certificate{DNSNames: []string{"billing.internal"}}
+
+	tests := []struct {
+		name       string
+		state      *tls.ConnectionState
+		wantStatus int
+	}{
+		{"verified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}, http.StatusOK},
+		{"unverified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, http.StatusUnauthorized},
+		{"plain HTTP", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions/s1/responses", nil)
+			req.TLS = tt.state
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusOK && user != "cert:billing" {
+				t.Errorf("expected the certificate's user, got %q", user)
+			}
+		})
+	}
+}
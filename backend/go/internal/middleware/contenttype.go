@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ContentTypeJSON is the media type of JSON request bodies.
+const ContentTypeJSON = "application/json"
+
+// CodeUnsupportedMediaType is the error code of requests refused for the
+// type of their body.
+const CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+
+// ErrTrailingData is returned by DecodeJSON for a body holding more than
+// one JSON document.
+var ErrTrailingData = errors.New("request body must hold a single JSON document")
+
+// RequireContentType refuses requests with a body whose Content-Type is not
+// one of types, such as ContentTypeJSON or "multipart/form-data", with 415
+// Unsupported Media Type. Parameters such as charset are ignored. Requests
+// without a body, like GETs and bodiless PUTs, pass.
+func RequireContentType(types ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !slices.Contains(types, mediaType) {
+				w.Header().Set("Accept", strings.Join(types, ", "))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error": map[string]any{
+						"code":    CodeUnsupportedMediaType,
+						"message": "Content-Type must be " + strings.Join(types, " or "),
+						"details": map[string]string{"allowed": strings.Join(types, ",")},
+					},
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DecodeJSON decodes the JSON document in body into v, refusing fields v
+// does not have and anything after the document, so that typos and
+// concatenated payloads fail instead of being silently dropped. Errors from
+// reading body, such as *http.MaxBytesError, are returned as is.
+func DecodeJSON(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return err
+		}
+		return ErrTrailingData
+	}
+	return nil
+}
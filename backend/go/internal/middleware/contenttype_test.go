@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireContentType(t *testing.T) {
+	handler := RequireContentType(ContentTypeJSON)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		contentType string
+		wantStatus  int
+	}{
+		{"json", http.MethodPost, `{}`, "application/json", http.StatusOK},
+		{"json with charset", http.MethodPost, `{}`, "application/json; charset=utf-8", http.StatusOK},
+		{"form", http.MethodPost, `a=b`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"missing", http.MethodPost, `{}`, "", http.StatusUnsupportedMediaType},
+		{"no body", http.MethodPost, ``, "", http.StatusOK},
+		{"get", http.MethodGet, ``, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/chat", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code == http.StatusUnsupportedMediaType {
+				if !strings.Contains(rec.Body.String(), CodeUnsupportedMediaType) || rec.Header().Get("Accept") != ContentTypeJSON {
+					t.Errorf("unexpected response %v %s", rec.Header(), rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type request struct {
+		Name string `json:"name"`
+	}
+
+	var req request
+	if err := DecodeJSON(strings.NewReader(" {\"name\": \"a\"}\n"), &req); err != nil || req.Name != "a" {
+		t.Errorf("DecodeJSON() = %v, %+v", err, req)
+	}
+	if err := DecodeJSON(strings.NewReader(`{"nmae": "a"}`), &req); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+	for _, body := range []string{`{"name": "a"} {"name": "b"}`, `{"name": "a"}garbage`} {
+		if err := DecodeJSON(strings.NewReader(body), &req); !errors.Is(err, ErrTrailingData) {
+			t.Errorf("%s: expected ErrTrailingData, got %v", body, err)
+		}
+	}
+
+	var maxErr *http.MaxBytesError
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(`{"name": "abcdef"}`)), 5)
+	if err := DecodeJSON(body, &req); !errors.As(err, &maxErr) {
+		t.Errorf("expected *http.MaxBytesError, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"sync/atomic"
+)
+
+// CORSPolicy answers cross-origin requests from browsers on the allowed
+// origins. The origins can be changed while requests are served.
+type CORSPolicy struct {
+	origins atomic.Pointer[[]string]
+}
+
+// NewCORS allows origins, each a scheme://host[:port] origin or "*" for
+// any. No origins allows any.
+func NewCORS(origins []string) *CORSPolicy {
+	p := &CORSPolicy{}
+	p.SetOrigins(origins)
+	return p
+}
+
+// SetOrigins replaces the allowed origins.
+func (p *CORSPolicy) SetOrigins(origins []string) {
+	origins = slices.Clone(origins)
+	p.origins.Store(&origins)
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" if it is not allowed.
+func (p *CORSPolicy) allowOrigin(origin string) string {
+	origins := *p.origins.Load()
+	if len(origins) == 0 || slices.Contains(origins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(origins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// Middleware sets the CORS headers and answers preflight requests.
+func (p *CORSPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow := p.allowOrigin(r.Header.Get("Origin"))
+		if allow != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Grpc-Web, X-User-Agent, Grpc-Timeout")
+			w.Header().Set("Access-Control-Expose-Headers", "Grpc-Status, Grpc-Message")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CORS allows cross-origin requests from any origin.
+func CORS(next http.Handler) http.Handler {
+	return NewCORS(nil).Middleware(next)
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	handler := CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{
+			name:           "GET request",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "POST request",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OPTIONS request",
+			method:         http.MethodOptions,
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Error("expected Access-Control-Allow-Origin header to be *")
+			}
+
+			expectedMethods := "GET, POST, PUT, DELETE, OPTIONS"
+			if rec.Header().Get("Access-Control-Allow-Methods") != expectedMethods {
+				t.Errorf("expected Access-Control-Allow-Methods %s, got %s", expectedMethods, rec.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func TestCORSPolicy(t *testing.T) {
+	p := NewCORS([]string{"https://app.example.com"})
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	allowed := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if got := allowed("https://app.example.com"); got != "https://app.example.com" {
+		t.Errorf("expected the allowed origin echoed, got %q", got)
+	}
+	if got := allowed("https://evil.example.com"); got != "" {
+		t.Errorf("expected no CORS headers for another origin, got %q", got)
+	}
+
+	p.SetOrigins([]string{"https://evil.example.com"})
+	if got := allowed("https://app.example.com"); got != "" {
+		t.Errorf("expected the old origin refused after SetOrigins, got %q", got)
+	}
+
+	p.SetOrigins(nil)
+	if got := allowed("https://anything.example.com"); got != "*" {
+		t.Errorf("expected any origin allowed with no origins, got %q", got)
+	}
+}
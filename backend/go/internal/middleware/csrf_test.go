@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	handler := CSRF(http.SameSiteStrictMode, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookie || cookies[0].Value == "" {
+		t.Fatalf("expected a CSRF cookie on a safe request, got %v", cookies)
+	}
+	token := cookies[0]
+	if token.SameSite != http.SameSiteStrictMode || token.HttpOnly {
+		t.Errorf("expected a script-readable SameSite=Strict cookie, got %+v", token)
+	}
+
+	session := &http.Cookie{Name: "session", Value: "s"}
+	tests := []struct {
+		name       string
+		cookies    []*http.Cookie
+		header     string
+		bearer     bool
+		wantStatus int
+	}{
+		{"pure bearer", nil, "", true, http.StatusOK},
+		{"no cookies", nil, "", false, http.StatusOK},
+		{"cookies without a token", []*http.Cookie{session}, "", false, http.StatusForbidden},
+		{"bearer alongside cookies", []*http.Cookie{session, token}, "", true, http.StatusForbidden},
+		{"missing header", []*http.Cookie{token}, "", false, http.StatusForbidden},
+		{"mismatched header", []*http.Cookie{token}, "forged", false, http.StatusForbidden},
+		{"matching header", []*http.Cookie{session, token}, token.Value, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+			for _, c := range tt.cookies {
+				req.AddCookie(c)
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCSRF_SameSiteNoneIsSecure(t *testing.T) {
+	handler := CSRF(http.SameSiteNoneMode, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+		t.Errorf("expected a Secure cookie with SameSite=None, got %v", cookies)
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// StreamDeadline gives the streamed response written to w, such as SSE,
+// timeout to finish instead of the server's write timeout, which suits
+// ordinary responses but would cut long streams off. A zero timeout lets
+// the stream run as long as it lasts. Writers without deadlines, as in
+// tests, are left alone.
+func StreamDeadline(w http.ResponseWriter, timeout time.Duration) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	http.NewResponseController(w).SetWriteDeadline(deadline)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		wantBody string
+	}{
+		{"outlives the write timeout", time.Second, "first\nsecond\n"},
+		{"unbounded", 0, "first\nsecond\n"},
+		{"cut off", 50 * time.Millisecond, "first\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(RequestLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				StreamDeadline(w, tt.timeout)
+				io.WriteString(w, "first\n")
+				w.(http.Flusher).Flush()
+				time.Sleep(150 * time.Millisecond)
+				io.WriteString(w, "second\n")
+			})))
+			srv.Config.WriteTimeout = 50 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	// Without deadlines, as under httptest.ResponseRecorder, it does nothing.
+	StreamDeadline(httptest.NewRecorder(), time.Second)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// enrichmentTimeout bounds a claims enrichment on the authentication path.
+const enrichmentTimeout = time.Second
+
+// ErrUserDisabled is returned by ParseToken for a valid token of a user the
+// ClaimsEnricher reports disabled.
+var ErrUserDisabled = errors.New("user disabled")
+
+// ClaimsEnricher completes the claims of a validated token from a user
+// directory, such as the caller's current tenant, plan and scopes, and
+// returns ErrUserDisabled for users who may no longer sign in.
+// userinfo.Service implements it.
+type ClaimsEnricher interface {
+	Enrich(ctx context.Context, claims *Claims) error
+}
+
+// WithEnricher passes the claims of each validated token through enricher.
+// Guest tokens are not enriched. When enricher fails for another reason,
+// the token's own claims are used and the failure logged, so an outage of
+// the directory does not lock every user out.
+func WithEnricher(enricher ClaimsEnricher) AuthOption {
+	return func(c *authConfig) {
+		c.enricher = enricher
+	}
+}
+
+func (c *authConfig) enrich(claims *Claims) error {
+	if c.enricher == nil || claims.Guest {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), enrichmentTimeout)
+	defer cancel()
+	err := c.enricher.Enrich(ctx, claims)
+	if err != nil && !errors.Is(err, ErrUserDisabled) {
+		slog.Warn("Failed to enrich token claims", "user_id", claims.UserID, logging.Err(err))
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fakeEnricher struct {
+	err   error
+	calls int
+}
+
+func (f *fakeEnricher) Enrich(ctx context.Context, claims *Claims) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	claims.TenantID = "acme"
+	claims.Plan = "pro"
+	return nil
+}
+
+func TestJWTAuth_Enricher(t *testing.T) {
+	secret := "test-secret-key"
+	sign := func(guest bool) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID:           "user-1",
+			TenantID:         "from-token",
+			Guest:            guest,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+	enricher := &fakeEnricher{}
+	var tenant, plan string
+	handler := JWTAuth(secret, WithEnricher(enricher))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetClaims(r.Context())
+		tenant, plan = claims.TenantID, claims.Plan
+	}))
+
+	tests := []struct {
+		name       string
+		guest      bool
+		err        error
+		wantStatus int
+		wantTenant string
+		wantPlan   string
+	}{
+		{"enriched", false, nil, http.StatusOK, "acme", "pro"},
+		{"disabled", false, ErrUserDisabled, http.StatusUnauthorized, "", ""},
+		{"directory unavailable", false, errors.New("down"), http.StatusOK, "from-token", ""},
+		{"guest", true, nil, http.StatusOK, "from-token", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enricher.err, enricher.calls = tt.err, 0
+			tenant, plan = "", ""
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/chat", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(tt.guest))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tenant != tt.wantTenant || plan != tt.wantPlan {
+				t.Errorf("expected tenant %q and plan %q, got %q and %q", tt.wantTenant, tt.wantPlan, tenant, plan)
+			}
+			if tt.guest && enricher.calls != 0 {
+				t.Error("expected guest tokens not to be enriched")
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import "net/http"
+
+// GuestPrefix starts the user ID of every guest, so their usage is easy to
+// tell apart in logs and audit events.
+const GuestPrefix = "guest:"
+
+// DenyGuests rejects guest callers with 403 Forbidden, keeping the routes
+// not opened to anonymous use for signed-in users. It must be inside
+// JWTAuth.
+func DenyGuests(opts ...AuthOption) func(http.Handler) http.Handler {
+	return requireAccess("member", func(c *Claims) (bool, string) {
+		if c.Guest {
+			return false, "guest access not allowed"
+		}
+		return true, "not a guest"
+	}, nil, opts)
+}
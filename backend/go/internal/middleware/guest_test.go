@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDenyGuests(t *testing.T) {
+	handler := DenyGuests()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range []struct {
+		claims *Claims
+		want   int
+	}{
+		{&Claims{UserID: "alice"}, http.StatusOK},
+		{&Claims{UserID: GuestPrefix + "1", Guest: true}, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions/s1/responses", nil)
+		req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, tt.claims))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.claims.UserID, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestRateLimiter_GuestMiddleware(t *testing.T) {
+	l := NewRateLimiter("/api/v1/chat", 1, 1, LimitByIP)
+	handler := l.GuestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string, claims *Claims) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+		req.RemoteAddr = remoteAddr
+		req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, claims))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("192.0.2.1:1234", &Claims{UserID: GuestPrefix + "1", Guest: true}); code != http.StatusOK {
+		t.Fatalf("expected the first guest request through, got %d", code)
+	}
+	// A fresh guest identity from the same IP shares its bucket.
+	if code := request("192.0.2.1:1234", &Claims{UserID: GuestPrefix + "2", Guest: true}); code != http.StatusTooManyRequests {
+		t.Errorf("expected the IP's guest bucket to be shared, got %d", code)
+	}
+	if code := request("192.0.2.1:1234", &Claims{UserID: "alice"}); code != http.StatusOK {
+		t.Errorf("expected users not to be limited, got %d", code)
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+// CodeIPNotAllowed is the error code of requests refused for their client
+// address.
+const CodeIPNotAllowed = "IP_NOT_ALLOWED"
+
+// IPRule admits or refuses clients by address on the paths under
+// PathPrefix, or on every path when it is empty. A client in Deny is
+// refused; otherwise, if Allow is set, only clients in Allow are admitted.
+type IPRule struct {
+	PathPrefix string
+	Allow      []netip.Prefix
+	Deny       []netip.Prefix
+}
+
+func (rule IPRule) admits(ip netip.Addr) bool {
+	for _, p := range rule.Deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(rule.Allow) == 0 {
+		return true
+	}
+	for _, p := range rule.Allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPFilter applies IPRules to the client address of each request.
+type IPFilter struct {
+	rules []IPRule
+}
+
+// NewIPFilter applies every rule matching a request's path to the client
+// address resolved by clientip.Resolver, which must be placed outside it.
+func NewIPFilter(rules []IPRule) *IPFilter {
+	return &IPFilter{rules: rules}
+}
+
+// Middleware refuses clients a matching rule does not admit with 403
+// Forbidden and an application/problem+json body.
+func (f *IPFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientip.Addr(r)
+		for _, rule := range f.rules {
+			if !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+				continue
+			}
+			// Unparseable addresses match no prefix: they pass deny
+			// lists and fail allow lists.
+			if !rule.admits(ip) {
+				scope := rule.PathPrefix
+				if scope == "" {
+					scope = "global"
+				}
+				metrics.ObserveIPDenied(scope)
+				writeIPDenied(w)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeIPDenied writes an RFC 9457 problem with the error code documented in
+// docs/api.md. The client address is not echoed back.
+func writeIPDenied(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":   "about:blank",
+		"title":  "Forbidden",
+		"status": http.StatusForbidden,
+		"detail": "Requests from this address are not allowed",
+		"code":   CodeIPNotAllowed,
+	})
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+)
+
+func prefixes(t *testing.T, cidrs ...string) []netip.Prefix {
+	t.Helper()
+	var ps []netip.Prefix
+	for _, c := range cidrs {
+		ps = append(ps, netip.MustParsePrefix(c))
+	}
+	return ps
+}
+
+func TestIPFilter(t *testing.T) {
+	filter := NewIPFilter([]IPRule{
+		{Deny: prefixes(t, "203.0.113.0/24")},
+		{PathPrefix: "/admin/", Allow: prefixes(t, "10.8.0.0/16")},
+	})
+	resolver := clientip.NewResolver(clientip.HeaderForwardedFor, prefixes(t, "192.168.0.0/24"))
+	handler := resolver.Middleware(filter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		forwarded  string
+		wantStatus int
+	}{
+		{"public route", "/api/v1/chat", "198.51.100.7:4000", "", http.StatusOK},
+		{"globally denied", "/api/v1/chat", "203.0.113.9:4000", "", http.StatusForbidden},
+		{"admin from VPN", "/admin/runtime", "10.8.3.4:4000", "", http.StatusOK},
+		{"admin from elsewhere", "/admin/runtime", "198.51.100.7:4000", "", http.StatusForbidden},
+		{"admin from VPN via proxy", "/admin/runtime", "192.168.0.10:4000", "10.8.3.4", http.StatusOK},
+		{"spoofed hop left of client", "/admin/runtime", "192.168.0.10:4000", "10.8.3.4, 198.51.100.7", http.StatusForbidden},
+		{"forwarded from untrusted peer", "/admin/runtime", "198.51.100.7:4000", "10.8.3.4", http.StatusForbidden},
+		{"IPv4-mapped peer", "/admin/runtime", "[::ffff:10.8.3.4]:4000", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusForbidden {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("expected problem+json, got %q", ct)
+			}
+			var problem map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if problem["status"] != float64(http.StatusForbidden) || problem["code"] != CodeIPNotAllowed {
+				t.Errorf("unexpected problem %v", problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksFetchTimeout bounds each request for a JWKS.
+	jwksFetchTimeout = 5 * time.Second
+	// jwksMinRefresh spaces out refetches for unknown key IDs, so tokens
+	// naming made-up keys cannot hammer the key server.
+	jwksMinRefresh = 30 * time.Second
+)
+
+// jwks caches the public keys published as a JSON Web Key Set, by key ID.
+type jwks struct {
+	// url is found by discover when not configured.
+	url      string
+	discover func() (string, error)
+	refresh  time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+	now     func() time.Time
+}
+
+// newJWKS caches the keys at url, or at the URL discover returns when url is
+// empty. They are refetched every refresh and when a token names a key not
+// held, as after a key rotation.
+func newJWKS(url string, refresh time.Duration, discover func() (string, error)) *jwks {
+	return &jwks{
+		url:      url,
+		discover: discover,
+		refresh:  refresh,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+		now:      time.Now,
+	}
+}
+
+// key returns the public key token names by its kid header.
+func (s *jwks) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	stale := now.Sub(s.fetched) > s.refresh
+	key, ok := s.lookup(kid)
+	if stale || (!ok && now.Sub(s.fetched) > jwksMinRefresh) {
+		if err := s.fetch(); err != nil && !ok {
+			return nil, err
+		}
+		key, ok = s.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup returns the key kid names, or the only key when kid is empty. The
+// caller must hold mu.
+func (s *jwks) lookup(kid string) (any, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// fetch replaces the cached keys with the published set. The caller must
+// hold mu. Failed fetches keep the cached keys and are retried no sooner
+// than jwksMinRefresh.
+func (s *jwks) fetch() error {
+	s.fetched = s.now()
+
+	if s.url == "" {
+		url, err := s.discover()
+		if err != nil {
+			return err
+		}
+		s.url = url
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := s.get(s.url, &set); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Keys of other types may sit alongside; they cannot sign
+			// tokens we accept anyway.
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	s.keys = keys
+	return nil
+}
+
+func (s *jwks) get(url string, v any) error {
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jwk is a JSON Web Key, as published in a JWKS.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of an RSA key.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of an EC key.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
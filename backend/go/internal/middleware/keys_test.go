@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+// writePublicKey writes the public half of idp's key kid as a PEM file.
+func writePublicKey(t *testing.T, idp *testIdP, kid string) string {
+	t.Helper()
+	idp.mu.Lock()
+	signer := idp.keys[kid].(crypto.Signer)
+	idp.mu.Unlock()
+
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return path
+}
+
+func TestKeySet_RotationWindow(t *testing.T) {
+	signer := newTestIdP(t)
+	signer.addRSAKey(t, "2024-01")
+	signer.addECKey(t, "2024-02")
+	signer.addRSAKey(t, "retired")
+
+	keys, err := LoadPublicKeys(map[string]string{
+		"2024-01": writePublicKey(t, signer, "2024-01"),
+		"2024-02": writePublicKey(t, signer, "2024-02"),
+	})
+	if err != nil {
+		t.Fatalf("LoadPublicKeys() error = %v", err)
+	}
+	opt := WithKeySet(NewKeySet(keys, "", time.Hour))
+
+	// Both the old and the new key verify during the rotation window.
+	for _, kid := range []string{"2024-01", "2024-02"} {
+		claims, err := ParseToken("", signer.sign(t, kid, "token-service", ""), opt)
+		if err != nil {
+			t.Fatalf("ParseToken(%s) error = %v", kid, err)
+		}
+		if claims.UserID != "idp-user" {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	}
+	if _, err := ParseToken("", signer.sign(t, "retired", "token-service", ""), opt); err == nil {
+		t.Error("expected token signed with an unconfigured key to be rejected")
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "published")
+	opt := WithKeySet(NewKeySet(nil, idp.URL+"/jwks", time.Hour))
+
+	if _, err := ParseToken("", idp.sign(t, "published", "token-service", ""), opt); err != nil {
+		t.Errorf("ParseToken() error = %v", err)
+	}
+}
+
+func TestKeySet_AlongsideOIDC(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "idp")
+	signer := newTestIdP(t)
+	signer.addRSAKey(t, "service")
+	keys, err := LoadPublicKeys(map[string]string{"service": writePublicKey(t, signer, "service")})
+	if err != nil {
+		t.Fatalf("LoadPublicKeys() error = %v", err)
+	}
+	opts := []AuthOption{WithOIDC(NewOIDC(idp.URL, "", "", time.Hour)), WithKeySet(NewKeySet(keys, "", time.Hour))}
+
+	if _, err := ParseToken("", idp.sign(t, "idp", idp.URL, ""), opts...); err != nil {
+		t.Errorf("ParseToken() identity provider token error = %v", err)
+	}
+	if _, err := ParseToken("", signer.sign(t, "service", "token-service", ""), opts...); err != nil {
+		t.Errorf("ParseToken() key set token error = %v", err)
+	}
+	// A key set token claiming the identity provider is checked against
+	// its JWKS, and fails.
+	if _, err := ParseToken("", signer.sign(t, "service", idp.URL, ""), opts...); err == nil {
+		t.Error("expected token naming the identity provider to need its keys")
+	}
+}
+
+func TestLoadPublicKeys_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.pem")
+	os.WriteFile(path, []byte("not a key"), 0o600)
+
+	for name, files := range map[string]map[string]string{
+		"missing file": {"k": filepath.Join(t.TempDir(), "missing.pem")},
+		"not PEM":      {"k": path},
+	} {
+		if _, err := LoadPublicKeys(files); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseToken_PreviousSecrets(t *testing.T) {
+	old := generateValidToken(t, "old-secret")[len("Bearer "):]
+
+	if _, err := ParseToken("new-secret", old); err == nil {
+		t.Fatal("expected token signed with the old secret to be rejected")
+	}
+	if _, err := ParseToken("new-secret", old, WithPreviousSecrets("older-secret", "old-secret")); err != nil {
+		t.Errorf("ParseToken() during rotation error = %v", err)
+	}
+	current := generateValidToken(t, "new-secret")[len("Bearer "):]
+	if _, err := ParseToken("new-secret", current, WithPreviousSecrets("old-secret")); err != nil {
+		t.Errorf("ParseToken() current secret error = %v", err)
+	}
+
+	// Once the window closes, only the current secret verifies.
+	closed := WithRotationEnd(time.Now().Add(-time.Minute))
+	if _, err := ParseToken("new-secret", old, WithPreviousSecrets("old-secret"), closed); err == nil {
+		t.Error("expected the old secret rejected after the rotation window")
+	}
+	if _, err := ParseToken("new-secret", current, WithPreviousSecrets("old-secret"), closed); err != nil {
+		t.Errorf("ParseToken() after the rotation window error = %v", err)
+	}
+	open := WithRotationEnd(time.Now().Add(time.Hour))
+	if _, err := ParseToken("new-secret", old, WithPreviousSecrets("old-secret"), open); err != nil {
+		t.Errorf("ParseToken() within the rotation window error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`neuronai_gateway_jwt_secret_verifications_total{secret="previous_2"}`,
+		`neuronai_gateway_jwt_secret_verifications_total{secret="previous_1"}`,
+		`neuronai_gateway_jwt_secret_verifications_total{secret="primary"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("expected %q in metrics", want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, logging.FormatJSON, slog.LevelInfo)
+	secret := "test-secret-key"
+
+	handler := RequestLogger(logger)(JWTAuth(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "Handling")
+		w.WriteHeader(http.StatusAccepted)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/test/path", nil)
+	req.Header.Set("Authorization", generateValidToken(t, secret))
+	req.Header.Set(RequestIDHeader, "edge-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if rec.Header().Get(RequestIDHeader) != "edge-42" {
+		t.Errorf("expected the proxy's request ID to be echoed, got %q", rec.Header().Get(RequestIDHeader))
+	}
+
+	dec := json.NewDecoder(&buf)
+	var handling, access map[string]any
+	if err := dec.Decode(&handling); err != nil {
+		t.Fatalf("Failed to decode handler log line: %v", err)
+	}
+	if err := dec.Decode(&access); err != nil {
+		t.Fatalf("Failed to decode request log line: %v", err)
+	}
+	if handling[logging.KeyRequestID] != "edge-42" || handling[logging.KeyUserID] != "test-user" {
+		t.Errorf("expected handler log line to carry request and user, got %v", handling)
+	}
+	if access[logging.KeyRequestID] != "edge-42" || access["status"] != float64(http.StatusAccepted) || access["path"] != "/test/path" {
+		t.Errorf("unexpected request log line %v", access)
+	}
+}
+
+func TestRequestLogger_GeneratesID(t *testing.T) {
+	logger, _ := logging.New(&bytes.Buffer{}, logging.FormatText, slog.LevelInfo)
+	handler := RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get(RequestIDHeader); id == "" || id == "bad id\n" {
+		t.Errorf("expected a generated request ID, got %q", id)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+// Instrumented records each request to next in the HTTP request metrics,
+// labelled with route, the pattern next is mounted at. Upgraded
+// connections are counted with status 101.
+func Instrumented(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			switch {
+			case rec.hijacked:
+				status = http.StatusSwitchingProtocols
+			case status == 0:
+				status = http.StatusOK
+			}
+			metrics.ObserveHTTPRequest(route, r.Method, status, time.Since(start))
+		})
+	}
+}
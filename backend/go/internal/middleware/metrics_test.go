@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+func TestInstrumented(t *testing.T) {
+	handler := Instrumented("GET /instrumented/{id}")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/instrumented/1", nil))
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `neuronai_gateway_http_requests_total{method="GET",route="GET /instrumented/{id}",status="418"}`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected %q in output:\n%s", want, rec.Body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens issued by an external OpenID Connect identity provider are signed
+// with RS256 or ES256 by keys it publishes as a JWKS. They are accepted
+// alongside the gateway's own HS256 tokens, told apart by their algorithm,
+// and those of a KeySet, told apart by their issuer.
+
+// publicKeyMethods are the signing algorithms accepted from the identity
+// provider and verified by a KeySet.
+var publicKeyMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+
+// OIDC validates tokens from an identity provider: their signature against
+// its JWKS, their issuer and, if set, their audience.
+type OIDC struct {
+	issuer   string
+	audience string
+	jwks     *jwks
+}
+
+// NewOIDC validates tokens issued by issuer for audience, which may be empty
+// to accept any. The JWKS at jwksURL, or the one the issuer's discovery
+// document names when jwksURL is empty, is refetched every refresh and when
+// a token names a key it does not hold, as after a key rotation.
+func NewOIDC(issuer, audience, jwksURL string, refresh time.Duration) *OIDC {
+	o := &OIDC{issuer: issuer, audience: audience}
+	o.jwks = newJWKS(jwksURL, refresh, o.discover)
+	return o
+}
+
+// WithOIDC also accepts tokens validated by o.
+func WithOIDC(o *OIDC) AuthOption {
+	return func(c *authConfig) {
+		c.oidc = o
+	}
+}
+
+// Issuer returns the identity provider's issuer URL.
+func (o *OIDC) Issuer() string {
+	return o.issuer
+}
+
+// validate checks the issuer and audience of claims.
+func (o *OIDC) validate(claims *Claims) error {
+	if claims.Issuer != o.issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if o.audience != "" && !slices.Contains(claims.Audience, o.audience) {
+		return fmt.Errorf("token is not for audience %q", o.audience)
+	}
+	return nil
+}
+
+// key returns the public key token names by its kid header.
+func (o *OIDC) key(token *jwt.Token) (any, error) {
+	return o.jwks.key(token)
+}
+
+// discover returns the JWKS URL named by the issuer's OpenID configuration.
+func (o *OIDC) discover() (string, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := o.jwks.get(strings.TrimSuffix(o.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return "", fmt.Errorf("failed to discover JWKS: %w", err)
+	}
+	if discovery.JWKSURI == "" {
+		return "", fmt.Errorf("failed to discover JWKS: no jwks_uri")
+	}
+	return discovery.JWKSURI, nil
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP serves an OpenID configuration and a JWKS of the keys it signs with.
+type testIdP struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	keys       map[string]any
+	jwksServed int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	idp := &testIdP{keys: map[string]any{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksServed++
+		var keys []map[string]string
+		for kid, key := range idp.keys {
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				keys = append(keys, map[string]string{
+					"kty": "RSA", "kid": kid, "use": "sig",
+					"n": b64(key.N), "e": b64(big.NewInt(int64(key.E))),
+				})
+			case *ecdsa.PrivateKey:
+				keys = append(keys, map[string]string{
+					"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": b64(key.X), "y": b64(key.Y),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func (idp *testIdP) addRSAKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	idp.mu.Lock()
+	idp.keys[kid] = key
+	idp.mu.Unlock()
+}
+
+func (idp *testIdP) addECKey(t *testing.T, kid string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	idp.mu.Lock()
+	idp.keys[kid] = key
+	idp.mu.Unlock()
+}
+
+// sign issues a token for idp-user, signed with the key kid.
+func (idp *testIdP) sign(t *testing.T, kid, issuer, audience string) string {
+	idp.mu.Lock()
+	key := idp.keys[kid]
+	idp.mu.Unlock()
+
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, Claims{
+		UserID: "idp-user",
+		Email:  "idp@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return s
+}
+
+func TestParseToken_OIDC(t *testing.T) {
+	secret := "test-secret-key"
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "rsa-1")
+	idp.addECKey(t, "ec-1")
+	oidc := NewOIDC(idp.URL, "gateway", "", time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"RS256", idp.sign(t, "rsa-1", idp.URL, "gateway"), false},
+		{"ES256", idp.sign(t, "ec-1", idp.URL, "gateway"), false},
+		{"wrong issuer", idp.sign(t, "rsa-1", "https://evil.example.com", "gateway"), true},
+		{"wrong audience", idp.sign(t, "rsa-1", idp.URL, "other"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(secret, tt.token, WithOIDC(oidc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (claims.UserID != "idp-user" || claims.Email != "idp@example.com") {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+
+	// Shared-secret tokens are still accepted.
+	bearer := generateValidToken(t, secret)
+	if _, err := ParseToken(secret, bearer[len("Bearer "):], WithOIDC(oidc)); err != nil {
+		t.Errorf("ParseToken() HS256 error = %v", err)
+	}
+
+	// Without WithOIDC, tokens from the identity provider are rejected.
+	if _, err := ParseToken(secret, idp.sign(t, "rsa-1", idp.URL, "gateway")); err == nil {
+		t.Error("expected RS256 token to be rejected without OIDC configured")
+	}
+}
+
+func TestOIDC_KeyRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "old")
+	oidc := NewOIDC(idp.URL, "", idp.URL+"/jwks", time.Hour)
+	now := time.Now()
+	oidc.jwks.now = func() time.Time { return now }
+
+	if _, err := ParseToken("", idp.sign(t, "old", idp.URL, "gateway"), WithOIDC(oidc)); err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+
+	// A token naming a new key is checked against a refetched JWKS, though
+	// no sooner than jwksMinRefresh after the last fetch.
+	idp.addRSAKey(t, "new")
+	rotated := idp.sign(t, "new", idp.URL, "gateway")
+	if _, err := ParseToken("", rotated, WithOIDC(oidc)); err == nil {
+		t.Fatal("expected unknown key to be rejected right after a fetch")
+	}
+	now = now.Add(jwksMinRefresh + time.Second)
+	if _, err := ParseToken("", rotated, WithOIDC(oidc)); err != nil {
+		t.Fatalf("ParseToken() after rotation error = %v", err)
+	}
+
+	idp.mu.Lock()
+	served := idp.jwksServed
+	idp.mu.Unlock()
+	if served != 2 {
+		t.Errorf("expected 2 JWKS fetches, got %d", served)
+	}
+}
+
+func TestJWTAuth_OIDC(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "rsa-1")
+	oidc := NewOIDC(idp.URL, "gateway", "", time.Hour)
+
+	var got *Claims
+	handler := JWTAuth("test-secret-key", WithOIDC(oidc))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetClaims(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+idp.sign(t, "rsa-1", idp.URL, "gateway"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got == nil || got.UserID != "idp-user" {
+		t.Errorf("expected claims for idp-user, got %+v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+// Priority is the class a caller's chats are scheduled in while the Python
+// service is saturated; see Claims.Priority.
+type Priority string
+
+const (
+	PriorityFree     Priority = "free"
+	PriorityPro      Priority = "pro"
+	PriorityInternal Priority = "internal"
+)
+
+// Priorities are the priority classes, highest first.
+var Priorities = []Priority{PriorityInternal, PriorityPro, PriorityFree}
+
+// Priority returns the class of the caller's plan, if it names one, and
+// PriorityFree for guests and every other plan.
+func (c *Claims) Priority() Priority {
+	if c.Guest {
+		return PriorityFree
+	}
+	switch p := Priority(c.Plan); p {
+	case PriorityPro, PriorityInternal:
+		return p
+	}
+	return PriorityFree
+}
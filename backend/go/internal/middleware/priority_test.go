@@ -0,0 +1,21 @@
+package middleware
+
+import "testing"
+
+func TestClaims_Priority(t *testing.T) {
+	tests := []struct {
+		claims Claims
+		want   Priority
+	}{
+		{Claims{Plan: "pro"}, PriorityPro},
+		{Claims{Plan: "internal"}, PriorityInternal},
+		{Claims{Plan: "enterprise"}, PriorityFree},
+		{Claims{}, PriorityFree},
+		{Claims{Plan: "internal", Guest: true}, PriorityFree},
+	}
+	for _, tt := range tests {
+		if got := tt.claims.Priority(); got != tt.want {
+			t.Errorf("Priority() of %+v = %q, want %q", tt.claims, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/clientip"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+)
+
+// LimitKey is what a RateLimiter tells clients apart by.
+type LimitKey string
+
+const (
+	// LimitByUser keys on the authenticated user ID or, for anonymous
+	// requests, the client IP.
+	LimitByUser LimitKey = "user"
+	// LimitByIP keys on the client IP, so users share the limit of their
+	// address.
+	LimitByIP LimitKey = "ip"
+	// LimitByAPIKey keys on the API key the caller authenticated with, and
+	// otherwise as LimitByUser.
+	LimitByAPIKey LimitKey = "apikey"
+)
+
+// RateLimiter limits the requests of each client of a route with a token
+// bucket, keyed as its LimitKey says. Place it inside JWTAuth so it sees the
+// user.
+type RateLimiter struct {
+	route string
+	rate  float64
+	burst int
+	by    LimitKey
+	// idle is how long an unused bucket takes to refill; after that it is
+	// no different from a new one and is dropped.
+	idle time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*limitedClient
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type limitedClient struct {
+	bucket *ratelimit.Bucket
+	used   time.Time
+}
+
+// NewRateLimiter allows each client of route, as told apart by by, rate
+// requests per second, in bursts of up to burst, or any number if rate is
+// not positive. route labels the throttled request metric.
+func NewRateLimiter(route string, rate float64, burst int, by LimitKey) *RateLimiter {
+	return &RateLimiter{
+		route:   route,
+		rate:    rate,
+		burst:   burst,
+		by:      by,
+		idle:    ratelimit.FillTime(rate, burst),
+		buckets: make(map[string]*limitedClient),
+		now:     time.Now,
+	}
+}
+
+// Middleware rejects requests over the client's limit with 429 Too Many
+// Requests and a Retry-After header. Admitted requests carry
+// X-RateLimit-Limit and X-RateLimit-Remaining headers.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.take(w, l.key(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// GuestMiddleware limits guest callers like Middleware and lets everyone
+// else through. Guests can mint identities at will, so they are keyed on the
+// client IP rather than the user ID.
+func (l *RateLimiter) GuestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaims(r.Context())
+		if !ok || !claims.Guest || l.take(w, "guest-ip:"+clientip.String(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// SetLimit changes the limit to rate requests per second in bursts of up to
+// burst, for clients told apart by by, as NewRateLimiter takes them. Clients
+// start over with full buckets.
+func (l *RateLimiter) SetLimit(rate float64, burst int, by LimitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst, l.by = rate, burst, by
+	l.idle = ratelimit.FillTime(rate, burst)
+	l.buckets = make(map[string]*limitedClient)
+}
+
+// take spends a request from the bucket of key, or answers 429 and reports
+// false if it is empty.
+func (l *RateLimiter) take(w http.ResponseWriter, key string) bool {
+	bucket, burst := l.bucket(key)
+	if bucket == nil {
+		return true
+	}
+	remaining, wait, ok := bucket.Take()
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		metrics.ObserveHTTPThrottled(l.route)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// key identifies the client of r.
+func (l *RateLimiter) key(r *http.Request) string {
+	l.mu.Lock()
+	by := l.by
+	l.mu.Unlock()
+	if by == LimitByIP {
+		return "ip:" + clientip.String(r)
+	}
+	claims, ok := GetClaims(r.Context())
+	switch {
+	case ok && by == LimitByAPIKey && claims.APIKey != "":
+		return "apikey:" + claims.APIKey
+	case ok && claims.UserID != "":
+		return "user:" + claims.UserID
+	}
+	return "ip:" + clientip.String(r)
+}
+
+// bucket returns the bucket of key, creating it if needed, and the burst,
+// and drops the buckets left idle. It returns nil if the limit is off.
+func (l *RateLimiter) bucket(key string) (*ratelimit.Bucket, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return nil, 0
+	}
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.idle {
+		for k, c := range l.buckets {
+			if now.Sub(c.used) > l.idle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.buckets[key]
+	if !ok {
+		c = &limitedClient{bucket: ratelimit.NewBucket(l.rate, l.burst)}
+		l.buckets[key] = c
+	}
+	c.used = now
+	return c.bucket, l.burst
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter("/api/v1/chat", 1, 2, LimitByUser)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, &Claims{UserID: userID}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := request("192.0.2.1:1234", "")
+		if rec.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, rec.Code)
+		}
+		if i == 0 && (rec.Header().Get("X-RateLimit-Limit") != "2" || rec.Header().Get("X-RateLimit-Remaining") != "1") {
+			t.Errorf("unexpected rate limit headers %v", rec.Header())
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// Another port of the same IP shares its bucket; users have their own,
+	// wherever they connect from.
+	if rec := request("192.0.2.1:5678", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the IP's bucket to be shared, got %d", rec.Code)
+	}
+	if rec := request("192.0.2.1:1234", "user-1"); rec.Code != http.StatusOK {
+		t.Errorf("expected the user's own bucket, got %d", rec.Code)
+	}
+	if rec := request("192.0.2.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected another IP's own bucket, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiter_Key(t *testing.T) {
+	tests := []struct {
+		by     LimitKey
+		claims *Claims
+		want   string
+	}{
+		{LimitByUser, &Claims{UserID: "u1", APIKey: "billing"}, "user:u1"},
+		{LimitByUser, nil, "ip:192.0.2.1"},
+		{LimitByIP, &Claims{UserID: "u1"}, "ip:192.0.2.1"},
+		{LimitByAPIKey, &Claims{UserID: "u1", APIKey: "billing"}, "apikey:billing"},
+		{LimitByAPIKey, &Claims{UserID: "u1"}, "user:u1"},
+		{LimitByAPIKey, nil, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if tt.claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, tt.claims))
+		}
+		if got := NewRateLimiter("/", 1, 1, tt.by).key(req); got != tt.want {
+			t.Errorf("%s, %+v: key() = %q, want %q", tt.by, tt.claims, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiter_DropsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter("/", 1, 2, LimitByUser)
+	l.now = func() time.Time { return now }
+
+	l.bucket("a")
+	now = now.Add(time.Second)
+	l.bucket("b")
+	now = now.Add(2 * time.Second)
+	l.bucket("b")
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("expected the idle bucket dropped")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("expected the recently used bucket kept")
+	}
+}
+
+func TestRateLimiter_SetLimit(t *testing.T) {
+	l := NewRateLimiter("/", 1, 1, LimitByUser)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	request()
+	if code := request(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second request throttled, got %d", code)
+	}
+
+	l.SetLimit(1, 3, LimitByUser)
+	for i := 0; i < 3; i++ {
+		if code := request(); code != http.StatusOK {
+			t.Fatalf("request %d after raising the limit: expected 200, got %d", i, code)
+		}
+	}
+
+	l.SetLimit(0, 0, LimitByUser)
+	for i := 0; i < 5; i++ {
+		if code := request(); code != http.StatusOK {
+			t.Fatalf("request %d with the limit off: expected 200, got %d", i, code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name string
+		port int
+		host string
+		url  string
+		want string
+	}{
+		{"default port", 443, "api.neuronai.app", "/api/v1/chat?stream=1", "https://api.neuronai.app/api/v1/chat?stream=1"},
+		{"drops the HTTP port", 443, "api.neuronai.app:80", "/health", "https://api.neuronai.app/health"},
+		{"other port", 8443, "api.neuronai.app:8080", "/", "https://api.neuronai.app:8443/"},
+		{"IPv6", 443, "[::1]:80", "/", "https://[::1]/"},
+		{"IPv6 without port", 443, "[::1]", "/", "https://[::1]/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			HTTPSRedirect(tt.port).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusPermanentRedirect)
+			}
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = ""
+	rec := httptest.NewRecorder()
+	HTTPSRedirect(443).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a request without Host refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// revocationTimeout bounds a revocation lookup on the authentication path.
+const revocationTimeout = 500 * time.Millisecond
+
+// ErrTokenRevoked is returned by ParseToken for a valid token on the
+// revocation list.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Revoker reports whether the token jti, or every token of userID issued at
+// issuedAt, was revoked. revocation.List implements it.
+type Revoker interface {
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+// WithRevocation rejects tokens on revoker's list. When the list cannot be
+// consulted, tokens are admitted and the failure logged, so an outage of
+// its store does not lock every user out.
+func WithRevocation(revoker Revoker) AuthOption {
+	return func(c *authConfig) {
+		c.revoker = revoker
+	}
+}
+
+func (c *authConfig) checkRevoked(claims *Claims) error {
+	if c.revoker == nil {
+		return nil
+	}
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), revocationTimeout)
+	defer cancel()
+	revoked, err := c.revoker.IsRevoked(ctx, claims.ID, claims.UserID, issuedAt)
+	if err != nil {
+		slog.Warn("Failed to check token revocation", "user_id", claims.UserID, logging.Err(err))
+		return nil
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fakeRevoker struct {
+	jtis map[string]bool
+	err  error
+}
+
+func (f *fakeRevoker) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	return f.jtis[jti], f.err
+}
+
+func TestJWTAuth_Revocation(t *testing.T) {
+	secret := "test-secret-key"
+	sign := func(jti string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID:           "user-1",
+			RegisteredClaims: jwt.RegisteredClaims{ID: jti, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+	revoker := &fakeRevoker{jtis: map[string]bool{"stolen": true}}
+	handler := JWTAuth(secret, WithRevocation(revoker))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		jti        string
+		err        error
+		wantStatus int
+	}{
+		{"not revoked", "fresh", nil, http.StatusOK},
+		{"revoked", "stolen", nil, http.StatusUnauthorized},
+		{"list unavailable", "stolen", errors.New("down"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoker.err = tt.err
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/chat", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(tt.jti))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+
+	if _, err := ParseToken(secret, sign("stolen"), WithRevocation(&fakeRevoker{jtis: map[string]bool{"stolen": true}})); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked, got %v", err)
+	}
+}
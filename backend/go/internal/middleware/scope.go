@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scopes are named resource:action and limit what tokens, API keys and
+// other credentials may do, so that integrations can be granted no more
+// than they need. Users authenticated by JWT without a scopes claim have
+// every scope.
+const (
+	ScopeChatWrite    = "chat:write"
+	ScopeSessionsRead = "sessions:read"
+	ScopeSwarmExecute = "swarm:execute"
+	ScopeAdminRead    = "admin:read"
+	ScopeAdminWrite   = "admin:write"
+	// ScopeAdmin grants every admin scope.
+	ScopeAdmin = "admin:*"
+)
+
+// Scopes of earlier releases. A scope without an action grants every
+// action on the resource, so they keep working as chat:* and sessions:*.
+const (
+	ScopeChat     = "chat"
+	ScopeSessions = "sessions"
+)
+
+// CodeInsufficientScope is the error code of requests refused for a scope
+// the caller lacks.
+const CodeInsufficientScope = "INSUFFICIENT_SCOPE"
+
+// GrantsScope reports whether granted includes scope, directly, as a
+// resource:* wildcard, or as its bare resource.
+func GrantsScope(granted []string, scope string) bool {
+	resource, _, _ := strings.Cut(scope, ":")
+	return slices.ContainsFunc(granted, func(g string) bool {
+		return g == scope || g == resource || g == resource+":*"
+	})
+}
+
+// HasScope reports whether the caller may use scope. Callers without scopes,
+// users authenticated by JWT, may use every scope.
+func (c *Claims) HasScope(scope string) bool {
+	return len(c.Scopes) == 0 || GrantsScope(c.Scopes, scope)
+}
+
+// RequireScope rejects callers without scope with 403 Forbidden, naming the
+// missing scope; see WriteInsufficientScope. It must be inside JWTAuth.
+func RequireScope(scope string, opts ...AuthOption) func(http.Handler) http.Handler {
+	return requireAccess("scope:"+scope, func(c *Claims) (bool, string) {
+		switch {
+		case len(c.Scopes) == 0:
+			return true, "unscoped token"
+		case c.HasScope(scope):
+			return true, fmt.Sprintf("has scope %q", scope)
+		}
+		return false, fmt.Sprintf("missing scope %q", scope)
+	}, func(w http.ResponseWriter, _ string) {
+		WriteInsufficientScope(w, scope)
+	}, opts)
+}
+
+// RequireMethodScope is RequireScope with read for GET, HEAD and OPTIONS
+// requests and write for any other method, for routes that both report and
+// change state.
+func RequireMethodScope(read, write string, opts ...AuthOption) func(http.Handler) http.Handler {
+	requireRead, requireWrite := RequireScope(read, opts...), RequireScope(write, opts...)
+	return func(next http.Handler) http.Handler {
+		reads, writes := requireRead(next), requireWrite(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				reads.ServeHTTP(w, r)
+			default:
+				writes.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// WriteInsufficientScope answers 403 Forbidden for a caller missing scope,
+// with a WWW-Authenticate challenge as RFC 6750 describes.
+func WriteInsufficientScope(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    CodeInsufficientScope,
+			"message": "Missing scope " + scope,
+			"details": map[string]string{"scope": scope},
+		},
+	})
+}
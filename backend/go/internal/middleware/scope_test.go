@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGrantsScope(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{[]string{ScopeChatWrite}, ScopeChatWrite, true},
+		{[]string{ScopeChatWrite}, ScopeSessionsRead, false},
+		{[]string{ScopeChat}, ScopeChatWrite, true},
+		{[]string{ScopeSessions}, ScopeSessionsRead, true},
+		{[]string{ScopeAdmin}, ScopeAdminWrite, true},
+		{[]string{ScopeAdminRead}, ScopeAdminWrite, false},
+		{[]string{"chat:*"}, ScopeSwarmExecute, false},
+		{[]string{ScopeChatWrite}, ScopeChat, false},
+		{nil, ScopeChatWrite, false},
+	}
+	for _, tt := range tests {
+		if got := GrantsScope(tt.granted, tt.scope); got != tt.want {
+			t.Errorf("GrantsScope(%v, %q) = %v, want %v", tt.granted, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(ScopeSwarmExecute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantStatus int
+	}{
+		{"unscoped", nil, http.StatusOK},
+		{"granted", []string{ScopeChatWrite, ScopeSwarmExecute}, http.StatusOK},
+		{"missing", []string{ScopeChatWrite}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requestWithClaims(httptest.NewRequest(http.MethodPost, "/", nil), &Claims{UserID: "svc", Scopes: tt.scopes})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusForbidden {
+				return
+			}
+			var body struct {
+				Error struct {
+					Code    string            `json:"code"`
+					Details map[string]string `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode error: %v", err)
+			}
+			if body.Error.Code != CodeInsufficientScope || body.Error.Details["scope"] != ScopeSwarmExecute {
+				t.Errorf("unexpected error %+v", body.Error)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer error="insufficient_scope", scope="swarm:execute"` {
+				t.Errorf("unexpected WWW-Authenticate %q", got)
+			}
+		})
+	}
+}
+
+func TestRequireMethodScope(t *testing.T) {
+	handler := RequireMethodScope(ScopeAdminRead, ScopeAdminWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method     string
+		scopes     []string
+		wantStatus int
+	}{
+		{http.MethodGet, []string{ScopeAdminRead}, http.StatusOK},
+		{http.MethodPut, []string{ScopeAdminRead}, http.StatusForbidden},
+		{http.MethodPut, []string{ScopeAdmin}, http.StatusOK},
+		{http.MethodGet, []string{ScopeChatWrite}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := requestWithClaims(httptest.NewRequest(tt.method, "/admin/maintenance", nil), &Claims{UserID: "ops", Scopes: tt.scopes})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s with %v: expected status %d, got %d", tt.method, tt.scopes, tt.wantStatus, rec.Code)
+		}
+	}
+}
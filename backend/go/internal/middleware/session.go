@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+)
+
+// SessionCookie carries the session of a browser logged in with a password,
+// which authenticates with it instead of a bearer token.
+const SessionCookie = "neuronai_session"
+
+// errSessionEnded is the reason a session cookie is refused once its
+// session has ended, by logout, idle timeout or age.
+var errSessionEnded = errors.New("session ended")
+
+// SessionResolver returns the claims of the user of a live browser session.
+// tokens.LoginSessions implements it.
+type SessionResolver interface {
+	Resolve(id string) (*Claims, bool)
+}
+
+// WithSessions also admits browsers presenting a session cookie that
+// sessions resolves. A bearer token or API key, when present, takes
+// precedence over the cookie.
+func WithSessions(sessions SessionResolver) AuthOption {
+	return func(c *authConfig) {
+		c.sessions = sessions
+	}
+}
+
+// sessionClaims returns the claims of the session cookie of r, whether it
+// carried one, and an error if the session has ended or its user's tokens
+// were revoked.
+func (c *authConfig) sessionClaims(r *http.Request) (*Claims, bool, error) {
+	if c.sessions == nil {
+		return nil, false, nil
+	}
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, false, nil
+	}
+	claims, ok := c.sessions.Resolve(cookie.Value)
+	if !ok {
+		return nil, true, errSessionEnded
+	}
+	if err := c.checkRevoked(claims); err != nil {
+		return nil, true, err
+	}
+	return claims, true, nil
+}
+
+// SessionClaims is the session cookie check of JWTAuth for transports that
+// authenticate outside it: it returns the claims of the session cookie of r,
+// whether r carried one, and an error if its session has ended.
+func SessionClaims(r *http.Request, opts ...AuthOption) (*Claims, bool, error) {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.sessionClaims(r)
+}
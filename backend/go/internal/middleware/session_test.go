@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeSessions map[string]*Claims
+
+func (f fakeSessions) Resolve(id string) (*Claims, bool) {
+	c, ok := f[id]
+	return c, ok
+}
+
+func TestJWTAuth_SessionCookie(t *testing.T) {
+	secret := "test-secret-key"
+	sessions := fakeSessions{"live": {UserID: "browser-user"}}
+
+	var got *Claims
+	handler := JWTAuth(secret, WithSessions(sessions))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetClaims(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		cookie     string
+		authHeader string
+		wantStatus int
+		wantUser   string
+	}{
+		{"live session", "live", "", http.StatusOK, "browser-user"},
+		{"ended session", "ended", "", http.StatusUnauthorized, ""},
+		{"no credentials", "", "", http.StatusUnauthorized, ""},
+		{"bearer takes precedence", "live", generateValidToken(t, secret), http.StatusOK, "test-user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.cookie})
+			}
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantUser != "" && (got == nil || got.UserID != tt.wantUser) {
+				t.Errorf("expected claims for %s, got %+v", tt.wantUser, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "0123456789abcdef0123456789abcdef"
+
+func TestJWTAuth_SignedRequest(t *testing.T) {
+	keys, err := NewSigningKeys([]SigningKey{
+		{ID: "webhook", Secret: testSigningSecret, Scopes: []string{ScopeChat}, TenantID: "acme"},
+	}, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("NewSigningKeys() error = %v", err)
+	}
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	var got *Claims
+	var gotBody string
+	handler := JWTAuth("test-secret-key", WithSigningKeys(keys))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetClaims(r.Context())
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+
+	const body = `{"content":"hello"}`
+	newRequest := func(nonce string, at time.Time, tamper func(*http.Request)) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chat?x=1", strings.NewReader(body))
+		SignRequest(req, []byte(body), "webhook", testSigningSecret, nonce, at)
+		if tamper != nil {
+			tamper(req)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{"valid", newRequest("n-1", now, nil), http.StatusOK},
+		{"replayed nonce", newRequest("n-1", now, nil), http.StatusUnauthorized},
+		{"within skew", newRequest("n-2", now.Add(-4*time.Minute), nil), http.StatusOK},
+		{"stale", newRequest("n-3", now.Add(-6*time.Minute), nil), http.StatusUnauthorized},
+		{"unknown key", newRequest("n-4", now, func(r *http.Request) { r.Header.Set(SignatureKeyHeader, "other") }), http.StatusUnauthorized},
+		{"missing nonce", newRequest("n-5", now, func(r *http.Request) { r.Header.Del(SignatureNonceHeader) }), http.StatusUnauthorized},
+		{"tampered body", newRequest("n-6", now, func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"content":"bye"}`))
+		}), http.StatusUnauthorized},
+		{"tampered path", newRequest("n-7", now, func(r *http.Request) { r.URL.RawQuery = "x=2" }), http.StatusUnauthorized},
+		{"wrong secret", newRequest("n-8", now, func(r *http.Request) {
+			SignRequest(r, []byte(body), "webhook", strings.Repeat("x", 32), "n-8", now)
+		}), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotBody = nil, ""
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got == nil || got.UserID != "signed:webhook" || got.TenantID != "acme" {
+				t.Errorf("unexpected claims %+v", got)
+			}
+			if gotBody != body {
+				t.Errorf("expected the handler to read the body, got %q", gotBody)
+			}
+		})
+	}
+}
+
+func TestSigningKeys_NonceExpiry(t *testing.T) {
+	keys, err := NewSigningKeys([]SigningKey{
+		{ID: "webhook", Secret: testSigningSecret, Scopes: []string{ScopeChat}},
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	if !keys.useNonce("n", now) {
+		t.Fatal("expected a new nonce to be accepted")
+	}
+	if keys.useNonce("n", now) {
+		t.Fatal("expected a seen nonce to be refused")
+	}
+	now = now.Add(2 * time.Minute)
+	keys.useNonce("other", now)
+	if _, ok := keys.nonces["n"]; ok {
+		t.Error("expected expired nonces to be swept")
+	}
+}
+
+func TestNewSigningKeys_Invalid(t *testing.T) {
+	for name, k := range map[string]SigningKey{
+		"no id":        {Secret: testSigningSecret, Scopes: []string{ScopeChat}},
+		"short secret": {ID: "a", Secret: "short", Scopes: []string{ScopeChat}},
+		"no scopes":    {ID: "a", Secret: testSigningSecret},
+	} {
+		if _, err := NewSigningKeys([]SigningKey{k}, time.Minute); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
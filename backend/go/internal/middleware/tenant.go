@@ -0,0 +1,19 @@
+package middleware
+
+import "net/http"
+
+// TenantResolver returns a function identifying the tenant of a request: the
+// tenant_id claim of the caller, or else the value of header unless it is
+// empty. It must be used inside JWTAuth. Any caller may set header, so only
+// name one when a trusted proxy in front of the gateway sets it.
+func TenantResolver(header string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if claims, ok := GetClaims(r.Context()); ok && claims.TenantID != "" {
+			return claims.TenantID
+		}
+		if header == "" {
+			return ""
+		}
+		return r.Header.Get(header)
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantResolver(t *testing.T) {
+	resolve := TenantResolver("X-Tenant-ID")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant-ID", "from-header")
+	if got := resolve(r); got != "from-header" {
+		t.Errorf("expected the header tenant without a claim, got %q", got)
+	}
+
+	r = r.WithContext(withClaims(r.Context(), &Claims{UserID: "user-1", TenantID: "from-claim"}))
+	if got := resolve(r); got != "from-claim" {
+		t.Errorf("expected the claim to take precedence, got %q", got)
+	}
+
+	if got := TenantResolver("")(httptest.NewRequest(http.MethodGet, "/", nil)); got != "" {
+		t.Errorf("expected no tenant, got %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenValidation is what the gateway requires of the registered claims of
+// tokens, beyond a valid signature and expiry, so that tokens minted for
+// other services cannot be replayed against it. Issuer and Audience apply to
+// tokens signed with the gateway's secrets or key set; identity provider
+// tokens are checked against the provider's issuer and audience instead.
+type TokenValidation struct {
+	// Issuer, if set, must be the token's iss claim.
+	Issuer string
+	// Audience, if set, must be among the token's aud claim.
+	Audience string
+	// Leeway tolerates clock skew between the gateway and token issuers
+	// when checking exp and nbf.
+	Leeway time.Duration
+	// RequireNotBefore refuses tokens without an nbf claim. Tokens with one
+	// are always refused before it.
+	RequireNotBefore bool
+}
+
+// WithTokenValidation checks the registered claims of tokens against v.
+func WithTokenValidation(v TokenValidation) AuthOption {
+	return func(c *authConfig) {
+		c.validation = v
+	}
+}
+
+// parserOptions are the options of the JWT parser enforcing v.
+func (v TokenValidation) parserOptions() []jwt.ParserOption {
+	if v.Leeway <= 0 {
+		return nil
+	}
+	return []jwt.ParserOption{jwt.WithLeeway(v.Leeway)}
+}
+
+// validate checks claims against v. Issuer and audience are only checked
+// when checkIssuer is set.
+func (v TokenValidation) validate(claims *Claims, checkIssuer bool) error {
+	if v.RequireNotBefore && claims.NotBefore == nil {
+		return fmt.Errorf("token has no nbf claim")
+	}
+	if !checkIssuer {
+		return nil
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience != "" && !slices.Contains(claims.Audience, v.Audience) {
+		return fmt.Errorf("token is not for audience %q", v.Audience)
+	}
+	return nil
+}
+
+// Stamp sets the registered claims v requires on claims, for tokens the
+// gateway issues itself: the issuer, the audience, and a not-before time of
+// when they were issued.
+func (v TokenValidation) Stamp(claims *Claims) {
+	if v.Issuer != "" {
+		claims.Issuer = v.Issuer
+	}
+	if v.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{v.Audience}
+	}
+	if v.RequireNotBefore && claims.NotBefore == nil {
+		claims.NotBefore = claims.IssuedAt
+		if claims.NotBefore == nil {
+			claims.NotBefore = jwt.NewNumericDate(time.Now())
+		}
+	}
+}
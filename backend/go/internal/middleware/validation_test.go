@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseToken_Validation(t *testing.T) {
+	secret := "test-secret-key"
+	v := TokenValidation{Issuer: "https://gateway.example.com", Audience: "neuronai", Leeway: 30 * time.Second, RequireNotBefore: true}
+	now := time.Now()
+
+	sign := func(mutate func(*Claims)) string {
+		claims := Claims{
+			UserID: "test-user",
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		}
+		v.Stamp(&claims)
+		mutate(&claims)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*Claims)
+		wantErr bool
+	}{
+		{"stamped", func(*Claims) {}, false},
+		{"other audience among several", func(c *Claims) { c.Audience = jwt.ClaimStrings{"billing", "neuronai"} }, false},
+		{"wrong issuer", func(c *Claims) { c.Issuer = "https://billing.example.com" }, true},
+		{"no issuer", func(c *Claims) { c.Issuer = "" }, true},
+		{"wrong audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"billing"} }, true},
+		{"no nbf", func(c *Claims) { c.NotBefore = nil }, true},
+		{"nbf within leeway", func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) }, false},
+		{"nbf beyond leeway", func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, true},
+		{"expired within leeway", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }, false},
+		{"expired beyond leeway", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseToken(secret, sign(tt.mutate), WithTokenValidation(v))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Identity provider tokens are held to the provider's issuer and
+	// audience instead.
+	idp := newTestIdP(t)
+	idp.addRSAKey(t, "rsa-1")
+	oidc := NewOIDC(idp.URL, "gateway", "", time.Hour)
+	if _, err := ParseToken(secret, idp.sign(t, "rsa-1", idp.URL, "gateway"), WithOIDC(oidc), WithTokenValidation(TokenValidation{Issuer: v.Issuer, Audience: v.Audience})); err != nil {
+		t.Errorf("ParseToken() OIDC error = %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+type Rule struct {
+	Category string `json:"category"`
+	Pattern  string `json:"pattern"`
+	// Action defaults to reject.
+	Action Action `json:"action,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// Denylist matches content against regular expressions.
+type Denylist struct {
+	rules []compiledRule
+}
+
+func NewDenylist(rules []Rule) (*Denylist, error) {
+	d := &Denylist{}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for category %q: %w", r.Category, err)
+		}
+		if r.Action == "" {
+			r.Action = ActionReject
+		}
+		if r.Action != ActionReject && r.Action != ActionFlag {
+			return nil, fmt.Errorf("invalid action %q for category %q", r.Action, r.Category)
+		}
+		d.rules = append(d.rules, compiledRule{Rule: r, re: re})
+	}
+	return d, nil
+}
+
+// LoadDenylist reads a JSON array of rules from path.
+func LoadDenylist(path string) (*Denylist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read denylist: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid denylist: %w", err)
+	}
+
+	return NewDenylist(rules)
+}
+
+func (d *Denylist) Check(ctx context.Context, req *Request) (Verdict, error) {
+	result := Verdict{Action: ActionAllow}
+	for _, r := range d.rules {
+		if !r.re.MatchString(req.Content) {
+			continue
+		}
+		if r.Action == ActionReject {
+			return Verdict{Action: ActionReject, Category: r.Category, Reason: "matched denylist"}, nil
+		}
+		if result.Action == ActionAllow {
+			result = Verdict{Action: ActionFlag, Category: r.Category, Reason: "matched denylist"}
+		}
+	}
+	return result, nil
+}
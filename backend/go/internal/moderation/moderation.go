@@ -0,0 +1,84 @@
+// Package moderation screens chat content before it is forwarded to the Python
+// service.
+package moderation
+
+import (
+	"context"
+	"fmt"
+)
+
+// Metadata keys added to requests that pass moderation.
+const (
+	MetadataAction   = "moderation.action"
+	MetadataCategory = "moderation.category"
+)
+
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionFlag   Action = "flag"
+	ActionReject Action = "reject"
+)
+
+type Request struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Content   string `json:"content"`
+}
+
+type Verdict struct {
+	Action   Action `json:"action"`
+	Category string `json:"category,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Moderator decides whether a request may be forwarded.
+type Moderator interface {
+	Check(ctx context.Context, req *Request) (Verdict, error)
+}
+
+// Rejected reports whether the request must not be forwarded.
+func (v Verdict) Rejected() bool {
+	return v.Action == ActionReject
+}
+
+// Annotate records the verdict in metadata, allocating the map if needed, and
+// returns it.
+func (v Verdict) Annotate(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	action := v.Action
+	if action == "" {
+		action = ActionAllow
+	}
+	metadata[MetadataAction] = string(action)
+	if v.Category != "" {
+		metadata[MetadataCategory] = v.Category
+	}
+	return metadata
+}
+
+// Chain runs moderators in order. The first rejection wins; otherwise the
+// first flag is returned.
+type Chain []Moderator
+
+func (c Chain) Check(ctx context.Context, req *Request) (Verdict, error) {
+	result := Verdict{Action: ActionAllow}
+	for _, m := range c {
+		v, err := m.Check(ctx, req)
+		if err != nil {
+			return Verdict{}, fmt.Errorf("moderation check failed: %w", err)
+		}
+		switch v.Action {
+		case ActionReject:
+			return v, nil
+		case ActionFlag:
+			if result.Action == ActionAllow {
+				result = v
+			}
+		}
+	}
+	return result, nil
+}
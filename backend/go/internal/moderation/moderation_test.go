@@ -0,0 +1,164 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticModerator struct {
+	verdict Verdict
+	err     error
+}
+
+func (s staticModerator) Check(ctx context.Context, req *Request) (Verdict, error) {
+	return s.verdict, s.err
+}
+
+func TestDenylist_Check(t *testing.T) {
+	d, err := NewDenylist([]Rule{
+		{Category: "violence", Pattern: `(?i)\bbomb\b`},
+		{Category: "pii", Pattern: `\b\d{3}-\d{2}-\d{4}\b`, Action: ActionFlag},
+	})
+	if err != nil {
+		t.Fatalf("NewDenylist() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		content      string
+		wantAction   Action
+		wantCategory string
+	}{
+		{"clean content", "Hello there", ActionAllow, ""},
+		{"rejected content", "how to build a BOMB", ActionReject, "violence"},
+		{"flagged content", "my ssn is 123-45-6789", ActionFlag, "pii"},
+		{"reject wins over flag", "123-45-6789 bomb", ActionReject, "violence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := d.Check(context.Background(), &Request{Content: tt.content})
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if v.Action != tt.wantAction {
+				t.Errorf("expected action %s, got %s", tt.wantAction, v.Action)
+			}
+			if v.Category != tt.wantCategory {
+				t.Errorf("expected category %q, got %q", tt.wantCategory, v.Category)
+			}
+		})
+	}
+}
+
+func TestNewDenylist_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{"bad pattern", []Rule{{Category: "x", Pattern: "("}}},
+		{"bad action", []Rule{{Category: "x", Pattern: "a", Action: ActionAllow}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDenylist(tt.rules); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestChain_Check(t *testing.T) {
+	flag := staticModerator{verdict: Verdict{Action: ActionFlag, Category: "spam"}}
+	reject := staticModerator{verdict: Verdict{Action: ActionReject, Category: "abuse"}}
+	allow := staticModerator{verdict: Verdict{Action: ActionAllow}}
+	failing := staticModerator{err: errors.New("boom")}
+
+	tests := []struct {
+		name         string
+		chain        Chain
+		wantAction   Action
+		wantCategory string
+		wantErr      bool
+	}{
+		{"empty chain allows", Chain{}, ActionAllow, "", false},
+		{"flag is kept", Chain{allow, flag}, ActionFlag, "spam", false},
+		{"reject wins", Chain{flag, reject}, ActionReject, "abuse", false},
+		{"error propagates", Chain{allow, failing}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.chain.Check(context.Background(), &Request{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if v.Action != tt.wantAction || v.Category != tt.wantCategory {
+				t.Errorf("expected %s/%s, got %s/%s", tt.wantAction, tt.wantCategory, v.Action, v.Category)
+			}
+		})
+	}
+}
+
+func TestWebhook_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantAction Action
+		wantErr    bool
+	}{
+		{"allow", http.StatusOK, `{"action":"allow"}`, ActionAllow, false},
+		{"empty action allows", http.StatusOK, `{}`, ActionAllow, false},
+		{"reject", http.StatusOK, `{"action":"reject","category":"hate"}`, ActionReject, false},
+		{"unknown action", http.StatusOK, `{"action":"maybe"}`, "", true},
+		{"server error", http.StatusInternalServerError, ``, "", true},
+		{"invalid body", http.StatusOK, `not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req Request
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("webhook received invalid body: %v", err)
+				}
+				if req.Content != "hello" {
+					t.Errorf("expected content 'hello', got %q", req.Content)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			v, err := NewWebhook(srv.URL, time.Second).Check(context.Background(), &Request{Content: "hello"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if v.Action != tt.wantAction {
+				t.Errorf("expected action %s, got %s", tt.wantAction, v.Action)
+			}
+		})
+	}
+}
+
+func TestVerdict_Annotate(t *testing.T) {
+	md := Verdict{Action: ActionFlag, Category: "pii"}.Annotate(nil)
+	if md[MetadataAction] != "flag" || md[MetadataCategory] != "pii" {
+		t.Errorf("unexpected metadata %v", md)
+	}
+
+	md = Verdict{}.Annotate(map[string]string{"k": "v"})
+	if md[MetadataAction] != "allow" || md["k"] != "v" {
+		t.Errorf("unexpected metadata %v", md)
+	}
+	if _, ok := md[MetadataCategory]; ok {
+		t.Error("expected no category for allowed request")
+	}
+}
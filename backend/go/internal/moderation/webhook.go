@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook delegates moderation to an external service. The request is POSTed
+// as JSON and the response body must be a Verdict.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *Webhook) Check(ctx context.Context, req *Request) (Verdict, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("moderation webhook returned status %d", resp.StatusCode)
+	}
+
+	var v Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return Verdict{}, fmt.Errorf("invalid moderation webhook response: %w", err)
+	}
+
+	switch v.Action {
+	case "":
+		v.Action = ActionAllow
+	case ActionAllow, ActionFlag, ActionReject:
+	default:
+		return Verdict{}, fmt.Errorf("invalid moderation action %q", v.Action)
+	}
+
+	return v, nil
+}
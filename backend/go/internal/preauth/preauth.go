@@ -0,0 +1,123 @@
+// Package preauth asks a billing service to authorize expensive requests,
+// such as video generation and large swarm tasks, before they reach the
+// Python service.
+package preauth
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+type Action string
+
+const (
+	ActionApprove Action = "approve"
+	// ActionHold defers the request; the gateway asks again after RetryAfter.
+	ActionHold   Action = "hold"
+	ActionReject Action = "reject"
+)
+
+type Kind string
+
+const (
+	KindVideoGeneration Kind = "video_generation"
+	KindSwarmTask       Kind = "swarm_task"
+)
+
+// largeSwarmAgents is the number of required agents from which a swarm task
+// needs authorization.
+const largeSwarmAgents = 3
+
+// defaultRetryAfter is used when a hold does not say when to ask again.
+const defaultRetryAfter = time.Second
+
+// Request describes the work to authorize. Units is the kind-specific size,
+// e.g. the number of agents in a swarm task.
+type Request struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Kind      Kind   `json:"kind"`
+	Units     int    `json:"units"`
+}
+
+// Decision is the billing service's answer. RetryAfter is in seconds and only
+// meaningful for holds.
+type Decision struct {
+	Action     Action `json:"action"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// Authorizer is the billing service interface.
+type Authorizer interface {
+	Authorize(ctx context.Context, req *Request) (Decision, error)
+}
+
+// ForChat returns the authorization request for a chat, or nil when the chat
+// does not need one.
+func ForChat(userID, sessionID string, messageType pb.MessageType) *Request {
+	if messageType != pb.MessageType_MESSAGE_TYPE_VIDEO {
+		return nil
+	}
+	return &Request{UserID: userID, SessionID: sessionID, Kind: KindVideoGeneration, Units: 1}
+}
+
+// ForSwarmTask returns the authorization request for a swarm task, or nil
+// when the task is small enough not to need one.
+func ForSwarmTask(userID string, task *pb.SwarmTask) *Request {
+	agents := len(task.GetRequiredAgents())
+	if agents < largeSwarmAgents {
+		return nil
+	}
+	return &Request{UserID: userID, SessionID: task.GetSessionId(), Kind: KindSwarmTask, Units: agents}
+}
+
+// Gate runs requests through an Authorizer, waiting out holds.
+type Gate struct {
+	authorizer Authorizer
+	maxHold    time.Duration
+}
+
+// NewGate returns a Gate that rejects requests still held after maxHold.
+func NewGate(a Authorizer, maxHold time.Duration) *Gate {
+	return &Gate{authorizer: a, maxHold: maxHold}
+}
+
+// Check authorizes req, asking again while the authorizer holds it. Every
+// decision is passed to onDecision, if set, so it can be streamed to the
+// client. The returned decision is either an approval or a rejection.
+func (g *Gate) Check(ctx context.Context, req *Request, onDecision func(Decision)) (Decision, error) {
+	deadline := time.Now().Add(g.maxHold)
+	for {
+		d, err := g.authorizer.Authorize(ctx, req)
+		if err != nil {
+			return Decision{}, err
+		}
+
+		if d.Action == ActionHold && !time.Now().Before(deadline) {
+			d = Decision{Action: ActionReject, Reason: "authorization hold expired"}
+		}
+		if onDecision != nil {
+			onDecision(d)
+		}
+		if d.Action != ActionHold {
+			return d, nil
+		}
+
+		wait := defaultRetryAfter
+		if d.RetryAfter > 0 {
+			wait = time.Duration(d.RetryAfter) * time.Second
+		}
+		if remaining := time.Until(deadline); wait > remaining {
+			wait = remaining
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return Decision{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package preauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// scripted returns its decisions in order, repeating the last one.
+type scripted struct {
+	decisions []Decision
+	err       error
+	calls     int
+}
+
+func (s *scripted) Authorize(ctx context.Context, req *Request) (Decision, error) {
+	if s.err != nil {
+		return Decision{}, s.err
+	}
+	d := s.decisions[min(s.calls, len(s.decisions)-1)]
+	s.calls++
+	return d, nil
+}
+
+func TestForChat(t *testing.T) {
+	if r := ForChat("u1", "s1", pb.MessageType_MESSAGE_TYPE_TEXT); r != nil {
+		t.Errorf("expected no authorization for text, got %+v", r)
+	}
+	r := ForChat("u1", "s1", pb.MessageType_MESSAGE_TYPE_VIDEO)
+	if r == nil || r.Kind != KindVideoGeneration || r.UserID != "u1" {
+		t.Errorf("expected video generation request, got %+v", r)
+	}
+}
+
+func TestForSwarmTask(t *testing.T) {
+	small := &pb.SwarmTask{SessionId: "s1", RequiredAgents: []string{"a", "b"}}
+	if r := ForSwarmTask("u1", small); r != nil {
+		t.Errorf("expected no authorization for small swarm, got %+v", r)
+	}
+
+	large := &pb.SwarmTask{SessionId: "s1", RequiredAgents: []string{"a", "b", "c"}}
+	r := ForSwarmTask("u1", large)
+	if r == nil || r.Kind != KindSwarmTask || r.Units != 3 || r.SessionID != "s1" {
+		t.Errorf("expected swarm task request, got %+v", r)
+	}
+}
+
+func TestGate_Check(t *testing.T) {
+	hold := Decision{Action: ActionHold, RetryAfter: 0}
+
+	tests := []struct {
+		name       string
+		authorizer *scripted
+		maxHold    time.Duration
+		wantAction Action
+		wantSeen   int
+		wantErr    bool
+	}{
+		{"approve", &scripted{decisions: []Decision{{Action: ActionApprove}}}, time.Second, ActionApprove, 1, false},
+		{"reject", &scripted{decisions: []Decision{{Action: ActionReject, Reason: "over budget"}}}, time.Second, ActionReject, 1, false},
+		{"hold then approve", &scripted{decisions: []Decision{hold, {Action: ActionApprove}}}, 5 * time.Second, ActionApprove, 2, false},
+		{"hold expires", &scripted{decisions: []Decision{hold}}, 0, ActionReject, 1, false},
+		{"authorizer error", &scripted{err: errors.New("down")}, time.Second, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []Decision
+			d, err := NewGate(tt.authorizer, tt.maxHold).Check(context.Background(), &Request{}, func(d Decision) {
+				seen = append(seen, d)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d.Action != tt.wantAction {
+				t.Errorf("expected action %q, got %q", tt.wantAction, d.Action)
+			}
+			if len(seen) != tt.wantSeen {
+				t.Errorf("expected %d decisions streamed, got %d", tt.wantSeen, len(seen))
+			}
+		})
+	}
+}
+
+func TestWebhook_Authorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantAction Action
+		wantErr    bool
+	}{
+		{"approve", http.StatusOK, `{"action":"approve"}`, ActionApprove, false},
+		{"hold", http.StatusOK, `{"action":"hold","retry_after":2}`, ActionHold, false},
+		{"reject", http.StatusOK, `{"action":"reject","reason":"over budget"}`, ActionReject, false},
+		{"missing action", http.StatusOK, `{}`, "", true},
+		{"server error", http.StatusInternalServerError, ``, "", true},
+		{"invalid body", http.StatusOK, `not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req Request
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("webhook received invalid body: %v", err)
+				}
+				if req.Kind != KindVideoGeneration {
+					t.Errorf("expected kind %s, got %q", KindVideoGeneration, req.Kind)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			d, err := NewWebhook(srv.URL, time.Second).Authorize(context.Background(), &Request{Kind: KindVideoGeneration})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d.Action != tt.wantAction {
+				t.Errorf("expected action %s, got %s", tt.wantAction, d.Action)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package preauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook delegates authorization to the billing service. The request is
+// POSTed as JSON and the response body must be a Decision.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *Webhook) Authorize(ctx context.Context, req *Request) (Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("pre-authorization request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("pre-authorization service returned status %d", resp.StatusCode)
+	}
+
+	var d Decision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return Decision{}, fmt.Errorf("invalid pre-authorization response: %w", err)
+	}
+
+	switch d.Action {
+	case ActionApprove, ActionHold, ActionReject:
+	default:
+		return Decision{}, fmt.Errorf("invalid pre-authorization action %q", d.Action)
+	}
+
+	return d, nil
+}
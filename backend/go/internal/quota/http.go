@@ -0,0 +1,139 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// CodeQuotaExceeded is the error code of requests refused because the
+// tenant's quota is used up.
+const CodeQuotaExceeded = "QUOTA_EXCEEDED"
+
+type contextKey struct{}
+
+type meter struct {
+	m      *Manager
+	tenant string
+}
+
+// NewContext returns a context charging the tokens of its chats to tenant.
+func NewContext(ctx context.Context, m *Manager, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, meter{m: m, tenant: tenant})
+}
+
+// Metered reports whether ctx already charges a tenant, so the request
+// itself has been counted.
+func Metered(ctx context.Context) bool {
+	_, ok := ctx.Value(contextKey{}).(meter)
+	return ok
+}
+
+// AddTokens charges n tokens to the tenant of ctx, if any.
+func AddTokens(ctx context.Context, n int64) {
+	if mt, ok := ctx.Value(contextKey{}).(meter); ok {
+		mt.m.AddTokens(mt.tenant, n)
+	}
+}
+
+// Middleware charges each request to the tenant tenantOf returns; requests
+// without a tenant are not metered. It sets X-Quota-Limit,
+// X-Quota-Remaining and X-Quota-Reset, and the X-Quota-Tokens-Limit and
+// X-Quota-Tokens-Remaining headers when tokens are limited. Requests over
+// the quota are refused with 429 Too Many Requests and a Retry-After header.
+// Place it inside JWTAuth so tenantOf sees the caller's claims.
+func (m *Manager) Middleware(tenantOf func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := tenantOf(r)
+			if tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			s, ok := m.Take(tenant)
+			setHeaders(w.Header(), s)
+			if !ok {
+				wait := time.Until(s.Reset)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, CodeQuotaExceeded, "Quota exceeded for tenant")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), m, tenant)))
+		})
+	}
+}
+
+func setHeaders(h http.Header, s Status) {
+	if s.Limits.Requests > 0 {
+		h.Set("X-Quota-Limit", strconv.FormatInt(s.Limits.Requests, 10))
+		h.Set("X-Quota-Remaining", strconv.FormatInt(s.RemainingRequests(), 10))
+	}
+	if s.Limits.Tokens > 0 {
+		h.Set("X-Quota-Tokens-Limit", strconv.FormatInt(s.Limits.Tokens, 10))
+		h.Set("X-Quota-Tokens-Remaining", strconv.FormatInt(s.RemainingTokens(), 10))
+	}
+	h.Set("X-Quota-Reset", strconv.FormatInt(s.Reset.Unix(), 10))
+}
+
+// Handler serves /admin/quotas, the status of every known tenant, and
+// /admin/quotas/{tenant}: GET for the tenant's status, PUT with a Limits
+// body to override its limits and DELETE to return it to the defaults.
+func (m *Manager) Handler(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	if tenant == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, map[string]any{"tenants": m.Statuses()})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var l Limits
+		if err := middleware.DecodeJSON(r.Body, &l); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if l.Requests < 0 || l.Tokens < 0 {
+			http.Error(w, "Limits must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := m.SetLimits(tenant, l); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if err := m.ResetLimits(tenant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, m.Status(tenant))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the JSON error body of docs/api.md.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
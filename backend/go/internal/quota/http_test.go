@@ -0,0 +1,120 @@
+package quota
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func tenantHeader(r *http.Request) string {
+	return r.Header.Get("X-Tenant")
+}
+
+func TestMiddleware(t *testing.T) {
+	m, _ := newTestManager(Limits{Requests: 1, Tokens: 50})
+	h := m.Middleware(tenantHeader)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Metered(r.Context()) {
+			t.Error("expected the request context to be metered")
+		}
+		AddTokens(r.Context(), 10)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"X-Quota-Limit":            "1",
+		"X-Quota-Remaining":        "0",
+		"X-Quota-Tokens-Limit":     "50",
+		"X-Quota-Tokens-Remaining": "50",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("expected %s %q, got %q", header, want, got)
+		}
+	}
+	if rec.Header().Get("X-Quota-Reset") == "" {
+		t.Error("expected an X-Quota-Reset header")
+	}
+	if s := m.Status("acme"); s.Tokens != 10 {
+		t.Errorf("expected 10 tokens charged, got %d", s.Tokens)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+	var body struct {
+		Error struct{ Code string } `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != CodeQuotaExceeded {
+		t.Errorf("expected a %s error, got %+v (%v)", CodeQuotaExceeded, body, err)
+	}
+}
+
+func TestMiddleware_NoTenant(t *testing.T) {
+	m, _ := newTestManager(Limits{Requests: 1})
+	h := m.Middleware(tenantHeader)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Limit") != "" {
+			t.Fatalf("expected requests without a tenant to pass unmetered, got %d", rec.Code)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m, _ := newTestManager(Limits{Requests: 10})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/quotas", m.Handler)
+	mux.HandleFunc("/admin/quotas/{tenant}", m.Handler)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/quotas/acme", strings.NewReader(`{"requests":3,"tokens":500}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var s Status
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tenant != "acme" || s.Limits != (Limits{Requests: 3, Tokens: 500}) {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/quotas/acme", strings.NewReader(`{"requests":-1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for negative limits, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/quotas", nil))
+	var list struct{ Tenants []Status }
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tenants) != 1 || list.Tenants[0].Tenant != "acme" {
+		t.Errorf("expected acme to be listed, got %+v", list.Tenants)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/quotas/acme", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Limits != (Limits{Requests: 10}) {
+		t.Errorf("expected the defaults after DELETE, got %+v", s.Limits)
+	}
+}
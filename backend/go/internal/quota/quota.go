@@ -0,0 +1,276 @@
+// Package quota meters the requests and model tokens each tenant consumes in
+// fixed windows and refuses work once a tenant's limits are used up.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits caps what a tenant may consume in each window. Zero means
+// unlimited.
+type Limits struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// Status is a tenant's consumption in the current window, which ends at
+// Reset.
+type Status struct {
+	Tenant   string    `json:"tenant"`
+	Limits   Limits    `json:"limits"`
+	Requests int64     `json:"requests"`
+	Tokens   int64     `json:"tokens"`
+	Reset    time.Time `json:"reset"`
+}
+
+// Exceeded reports whether the tenant has used up either limit.
+func (s Status) Exceeded() bool {
+	return (s.Limits.Requests > 0 && s.Requests >= s.Limits.Requests) ||
+		(s.Limits.Tokens > 0 && s.Tokens >= s.Limits.Tokens)
+}
+
+// RemainingRequests returns the requests left in the window, or -1 when
+// requests are unlimited.
+func (s Status) RemainingRequests() int64 {
+	return remaining(s.Limits.Requests, s.Requests)
+}
+
+// RemainingTokens returns the tokens left in the window, or -1 when tokens
+// are unlimited.
+func (s Status) RemainingTokens() int64 {
+	return remaining(s.Limits.Tokens, s.Tokens)
+}
+
+func remaining(limit, used int64) int64 {
+	if limit <= 0 {
+		return -1
+	}
+	return max(limit-used, 0)
+}
+
+type usage struct {
+	start    time.Time
+	requests int64
+	tokens   int64
+}
+
+// Manager tracks the consumption of every tenant on this instance. Limits
+// default to those it was created with and can be overridden per tenant at
+// runtime.
+type Manager struct {
+	window   time.Duration
+	defaults Limits
+	// path, if set, persists the overrides across restarts.
+	path string
+	now  func() time.Time
+
+	mu        sync.Mutex
+	overrides map[string]Limits
+	usage     map[string]*usage
+}
+
+// NewManager meters tenants in windows of window, aligned to multiples of
+// it since the Unix epoch, so 24h windows reset at midnight UTC.
+func NewManager(window time.Duration, defaults Limits) *Manager {
+	return &Manager{
+		window:    window,
+		defaults:  defaults,
+		now:       time.Now,
+		overrides: make(map[string]Limits),
+		usage:     make(map[string]*usage),
+	}
+}
+
+// Load is NewManager with the per-tenant overrides stored at path, if not
+// empty, a JSON object of Limits by tenant, which is rewritten whenever they
+// change. A missing file holds no overrides.
+func Load(path string, window time.Duration, defaults Limits) (*Manager, error) {
+	m := NewManager(window, defaults)
+	if path == "" {
+		return m, nil
+	}
+	m.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota limits: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.overrides); err != nil {
+		return nil, fmt.Errorf("invalid quota limits %s: %w", path, err)
+	}
+	if m.overrides == nil {
+		m.overrides = make(map[string]Limits)
+	}
+	return m, nil
+}
+
+// Take charges a request to tenant unless its limits are used up, and
+// returns its status either way.
+func (m *Manager) Take(tenant string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.current(tenant)
+	s := m.status(tenant, u)
+	if s.Exceeded() {
+		return s, false
+	}
+	u.requests++
+	s.Requests++
+	return s, true
+}
+
+// AddTokens charges n model tokens to tenant. A chat in progress is not cut
+// off when it crosses the limit; the tenant's next request is refused.
+func (m *Manager) AddTokens(tenant string, n int64) {
+	if n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current(tenant).tokens += n
+}
+
+// Status returns tenant's consumption in the current window.
+func (m *Manager) Status(tenant string) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status(tenant, m.current(tenant))
+}
+
+// Statuses returns the status of every tenant with an override or
+// consumption in the current window, by tenant.
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := m.windowStart()
+	tenants := make(map[string]bool)
+	for tenant := range m.overrides {
+		tenants[tenant] = true
+	}
+	for tenant, u := range m.usage {
+		if u.start.Equal(start) {
+			tenants[tenant] = true
+		}
+	}
+	statuses := make([]Status, 0, len(tenants))
+	for tenant := range tenants {
+		statuses = append(statuses, m.status(tenant, m.current(tenant)))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Tenant < statuses[j].Tenant })
+	return statuses
+}
+
+// SetLimits overrides the limits of tenant.
+func (m *Manager) SetLimits(tenant string, l Limits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides[tenant] = l
+	slog.Info("Quota limits set", "tenant", tenant, "requests", l.Requests, "tokens", l.Tokens)
+	return m.save()
+}
+
+// SetDefaults changes the limits of tenants without an override.
+func (m *Manager) SetDefaults(l Limits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaults = l
+}
+
+// ResetLimits returns tenant to the default limits.
+func (m *Manager) ResetLimits(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.overrides, tenant)
+	slog.Info("Quota limits reset to defaults", "tenant", tenant)
+	return m.save()
+}
+
+func (m *Manager) windowStart() time.Time {
+	return m.now().Truncate(m.window)
+}
+
+// current returns tenant's usage in the current window, starting a new one
+// if it has passed. The caller must hold mu.
+func (m *Manager) current(tenant string) *usage {
+	start := m.windowStart()
+	u, ok := m.usage[tenant]
+	if !ok || !u.start.Equal(start) {
+		if !ok {
+			m.sweep(start)
+		}
+		u = &usage{start: start}
+		m.usage[tenant] = u
+	}
+	return u
+}
+
+// sweep drops the usage of past windows. The caller must hold mu.
+func (m *Manager) sweep(start time.Time) {
+	for tenant, u := range m.usage {
+		if !u.start.Equal(start) {
+			delete(m.usage, tenant)
+		}
+	}
+}
+
+// status reports u for tenant. The caller must hold mu.
+func (m *Manager) status(tenant string, u *usage) Status {
+	limits, ok := m.overrides[tenant]
+	if !ok {
+		limits = m.defaults
+	}
+	return Status{
+		Tenant:   tenant,
+		Limits:   limits,
+		Requests: u.requests,
+		Tokens:   u.tokens,
+		Reset:    u.start.Add(m.window).UTC(),
+	}
+}
+
+// save writes the overrides to path, if set, replacing the file atomically.
+// The caller must hold mu.
+func (m *Manager) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ".quota-*")
+	if err != nil {
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		return fmt.Errorf("failed to save quota limits: %w", err)
+	}
+	return nil
+}
+
+// EstimateTokens approximates the model tokens of text at four characters
+// a token; the Python service does not report usage.
+func EstimateTokens(text string) int64 {
+	return int64(utf8.RuneCountInString(text)+3) / 4
+}
@@ -0,0 +1,111 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestManager(defaults Limits) (*Manager, *time.Time) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	m := NewManager(24*time.Hour, defaults)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestManager_Take(t *testing.T) {
+	m, now := newTestManager(Limits{Requests: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, ok := m.Take("acme"); !ok {
+			t.Fatalf("request %d refused within the limit", i+1)
+		}
+	}
+	s, ok := m.Take("acme")
+	if ok {
+		t.Fatal("expected the third request to be refused")
+	}
+	if s.RemainingRequests() != 0 {
+		t.Errorf("expected no requests remaining, got %d", s.RemainingRequests())
+	}
+	if want := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC); !s.Reset.Equal(want) {
+		t.Errorf("expected the quota to reset at %v, got %v", want, s.Reset)
+	}
+	if _, ok := m.Take("globex"); !ok {
+		t.Error("expected other tenants to be unaffected")
+	}
+
+	*now = now.Add(14 * time.Hour)
+	if s, ok := m.Take("acme"); !ok || s.Requests != 1 {
+		t.Errorf("expected a fresh window after the reset, got %+v, %v", s, ok)
+	}
+}
+
+func TestManager_Tokens(t *testing.T) {
+	m, _ := newTestManager(Limits{Tokens: 100})
+
+	if _, ok := m.Take("acme"); !ok {
+		t.Fatal("first request refused")
+	}
+	m.AddTokens("acme", 60)
+	if s := m.Status("acme"); s.RemainingTokens() != 40 {
+		t.Errorf("expected 40 tokens remaining, got %d", s.RemainingTokens())
+	}
+	if s := m.Status("acme"); s.RemainingRequests() != -1 {
+		t.Errorf("expected unlimited requests, got %d remaining", s.RemainingRequests())
+	}
+	m.AddTokens("acme", 60)
+	if _, ok := m.Take("acme"); ok {
+		t.Error("expected requests to be refused once the tokens are used up")
+	}
+}
+
+func TestManager_SetLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	m, err := Load(path, time.Hour, Limits{Requests: 1})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if err := m.SetLimits("acme", Limits{Requests: 5, Tokens: 1000}); err != nil {
+		t.Fatalf("SetLimits() error = %v", err)
+	}
+	if s := m.Status("acme"); s.Limits != (Limits{Requests: 5, Tokens: 1000}) {
+		t.Errorf("expected the override, got %+v", s.Limits)
+	}
+
+	reloaded, err := Load(path, time.Hour, Limits{Requests: 1})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s := reloaded.Status("acme"); s.Limits.Requests != 5 {
+		t.Errorf("expected the override to persist, got %+v", s.Limits)
+	}
+
+	if err := reloaded.ResetLimits("acme"); err != nil {
+		t.Fatalf("ResetLimits() error = %v", err)
+	}
+	if s := reloaded.Status("acme"); s.Limits != (Limits{Requests: 1}) {
+		t.Errorf("expected the defaults after a reset, got %+v", s.Limits)
+	}
+
+	reloaded.SetLimits("globex", Limits{Requests: 9})
+	reloaded.SetDefaults(Limits{Requests: 2, Tokens: 50})
+	if s := reloaded.Status("acme"); s.Limits != (Limits{Requests: 2, Tokens: 50}) {
+		t.Errorf("expected the new defaults, got %+v", s.Limits)
+	}
+	if s := reloaded.Status("globex"); s.Limits.Requests != 9 {
+		t.Errorf("expected the override kept, got %+v", s.Limits)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want int64
+	}{{"", 0}, {"hi", 1}, {"hello world!", 3}, {"héllo", 2}} {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package ratelimit provides the token buckets used to throttle clients.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket holding up to burst tokens and refilled at rate
+// tokens per second. It starts full.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	b := &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+	b.last = b.now()
+	return b
+}
+
+// State is a snapshot of a bucket's tokens, for persisting it across
+// restarts.
+type State struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// FillTime is how long an empty bucket with rate and burst takes to refill.
+// Saved states older than that carry no information.
+func FillTime(rate float64, burst int) time.Duration {
+	return time.Duration(float64(burst) / rate * float64(time.Second))
+}
+
+// State returns the bucket's current tokens.
+func (b *Bucket) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return State{Tokens: b.tokens, Updated: b.last}
+}
+
+// Restore replaces the bucket's tokens with s, refilled for the time since
+// s was taken.
+func (b *Bucket) Restore(s State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(s.Tokens, b.burst)
+	if s.Updated.Before(b.now()) {
+		b.last = s.Updated
+	}
+	b.refill()
+}
+
+// refill adds the tokens earned since the last update. The caller must hold
+// mu.
+func (b *Bucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow takes a token if one is available and reports whether it did.
+func (b *Bucket) Allow() bool {
+	_, _, ok := b.Take()
+	return ok
+}
+
+// Take takes a token if one is available and returns the whole tokens left.
+// Otherwise it returns how long until a token is available.
+func (b *Bucket) Take() (remaining int, wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		return 0, time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return int(b.tokens), 0, true
+}
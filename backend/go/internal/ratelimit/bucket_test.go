@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_Allow(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(2, 3)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    []bool
+	}{
+		{"burst", 0, []bool{true, true, true, false}},
+		{"partial refill", 250 * time.Millisecond, []bool{false}},
+		{"one token refilled", 250 * time.Millisecond, []bool{true, false}},
+		{"refill capped at burst", time.Minute, []bool{true, true, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			for i, want := range tt.want {
+				if got := b.Allow(); got != want {
+					t.Fatalf("call %d: expected %v, got %v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBucket_Take(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(2, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	if remaining, _, ok := b.Take(); !ok || remaining != 1 {
+		t.Errorf("expected a token with 1 left, got %d, %v", remaining, ok)
+	}
+	b.Take()
+	now = now.Add(100 * time.Millisecond)
+	if _, wait, ok := b.Take(); ok || wait != 400*time.Millisecond {
+		t.Errorf("expected to wait 400ms, got %v, %v", wait, ok)
+	}
+}
+
+func TestBucket_Restore(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		state State
+		want  int
+	}{
+		{"empty just now", State{Tokens: 0, Updated: now}, 0},
+		{"empty refilled since", State{Tokens: 0, Updated: now.Add(-time.Second)}, 2},
+		{"capped at burst", State{Tokens: 10, Updated: now}, 3},
+		{"future timestamp", State{Tokens: 1, Updated: now.Add(time.Hour)}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucket(2, 3)
+			b.now = func() time.Time { return now }
+			b.last = now
+			b.Restore(tt.state)
+
+			got := 0
+			for b.Allow() {
+				got++
+			}
+			if got != tt.want {
+				t.Errorf("expected %d tokens, got %d", tt.want, got)
+			}
+		})
+	}
+}
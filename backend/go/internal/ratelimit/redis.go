@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/admin"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix prefixes the keys of bucket states in Redis.
+const DefaultRedisPrefix = "neuronai:ratelimit:"
+
+// RedisStore is a Store shared by all gateway instances. Each state is its
+// own key and expires after ttl.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore connects to the Redis server at url, e.g.
+// redis://:pass@host:6379/0.
+func NewRedisStore(url, prefix string, ttl time.Duration) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	return &RedisStore{
+		client: redis.NewClient(opts),
+		prefix: prefix,
+		ttl:    ttl,
+	}, nil
+}
+
+func (r *RedisStore) Load(ctx context.Context, key string) (State, bool, error) {
+	data, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, false, fmt.Errorf("invalid rate limit state for %s: %w", key, err)
+	}
+	return state, true, nil
+}
+
+func (r *RedisStore) Save(ctx context.Context, states map[string]State) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	for key, state := range states {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, r.prefix+key, data, r.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Check pings the Redis server.
+func (r *RedisStore) Check(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Backend reports the Redis server for runtime introspection, without the
+// credentials carried in the URL.
+func (r *RedisStore) Backend() admin.Backend {
+	return admin.Backend{Name: "ratelimit_store", Kind: "redis", Address: r.client.Options().Addr}
+}
+
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store persists bucket states by key so limits survive gateway restarts.
+type Store interface {
+	// Load returns the state saved for key, if any.
+	Load(ctx context.Context, key string) (State, bool, error)
+	// Save records states, replacing earlier states for the same keys.
+	Save(ctx context.Context, states map[string]State) error
+}
+
+// FileStore is a Store kept in memory and snapshotted to a JSON file on each
+// Save. It suits a single gateway instance; replicas should share a
+// RedisStore instead.
+type FileStore struct {
+	path   string
+	ttl    time.Duration
+	mu     sync.Mutex
+	states map[string]State
+	now    func() time.Time
+}
+
+// NewFileStore loads the snapshot at path, if it exists. States older than
+// ttl are dropped.
+func NewFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		ttl:    ttl,
+		states: make(map[string]State),
+		now:    time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return nil, fmt.Errorf("invalid rate limit snapshot %s: %w", path, err)
+	}
+	s.expire()
+	return s, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, key string) (State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if ok && s.now().Sub(state.Updated) > s.ttl {
+		return State{}, false, nil
+	}
+	return state, ok, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, states map[string]State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, state := range states {
+		s.states[key] = state
+	}
+	s.expire()
+
+	data, err := json.Marshal(s.states)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, data)
+}
+
+// expire drops the states older than ttl. The caller must hold mu.
+func (s *FileStore) expire() {
+	cutoff := s.now().Add(-s.ttl)
+	for key, state := range s.states {
+		if state.Updated.Before(cutoff) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// writeFile replaces path with data atomically, so a crash mid-write leaves
+// the previous snapshot intact.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ratelimit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "limits", "snapshot.json")
+	now := time.Now().Truncate(time.Second)
+
+	s, err := NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if err := s.Save(ctx, map[string]State{
+		"fresh": {Tokens: 1, Updated: now},
+		"stale": {Tokens: 0, Updated: now.Add(-2 * time.Minute)},
+	}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reloaded, err := NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		wantOK bool
+	}{
+		{"fresh", true},
+		{"stale", false},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			state, ok, err := reloaded.Load(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("expected found %v, got %v", tt.wantOK, ok)
+			}
+			if ok && (state.Tokens != 1 || !state.Updated.Equal(now)) {
+				t.Errorf("unexpected state %+v", state)
+			}
+		})
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Now().Truncate(time.Second)
+
+	s, err := NewRedisStore("redis://"+mr.Addr(), DefaultRedisPrefix, time.Minute)
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Save(ctx, map[string]State{"u1": {Tokens: 2, Updated: now}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if ttl := mr.TTL(DefaultRedisPrefix + "u1"); ttl != time.Minute {
+		t.Errorf("expected TTL 1m, got %v", ttl)
+	}
+
+	state, ok, err := s.Load(ctx, "u1")
+	if err != nil || !ok || state.Tokens != 2 || !state.Updated.Equal(now) {
+		t.Errorf("unexpected Load() = %+v, %v, %v", state, ok, err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, ok, err := s.Load(ctx, "u1"); ok || err != nil {
+		t.Errorf("expected expired state, got found %v, error %v", ok, err)
+	}
+}
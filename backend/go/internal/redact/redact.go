@@ -0,0 +1,162 @@
+// Package redact masks personal data and credentials, such as email
+// addresses and tokens, before they reach the logs or error responses.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Masked replaces the values of sensitive keys.
+const Masked = "[REDACTED]"
+
+// Rule masks the matches of Pattern in free text with Replacement, which may
+// refer to submatches like regexp.Regexp.ReplaceAllString.
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Apply returns s with the matches of r masked.
+func (r Rule) Apply(s string) string {
+	return r.Pattern.ReplaceAllString(s, r.Replacement)
+}
+
+// DefaultRules mask credentials and email addresses.
+var DefaultRules = []Rule{
+	{"bearer", regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 [token]"},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), "[jwt]"},
+	{"url_credential", regexp.MustCompile(`(?i)([?&](?:token|ticket|access_token|api_key|key)=)[^&\s"]+`), "${1}[token]"},
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[email]"},
+}
+
+// StrictRules additionally mask IP addresses and card-like numbers, for
+// regulated deployments.
+var StrictRules = []Rule{
+	{"ipv4", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[ip]"},
+	{"card", regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[number]"},
+}
+
+// DefaultKeys are the attribute and metadata keys whose values are always
+// masked.
+var DefaultKeys = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "ticket",
+	"authorization", "cookie", "api_key",
+}
+
+// identifierKeys are the keys whose values strict mode pseudonymizes, so
+// that log lines about one user can still be correlated without naming them.
+var identifierKeys = []string{"user_id", "username", "email", "remote_addr", "client_ip"}
+
+// Redactor masks free text by its rules and the values of sensitive keys. A
+// nil Redactor masks nothing.
+type Redactor struct {
+	rules       []Rule
+	keys        map[string]bool
+	identifiers map[string]bool
+}
+
+// New returns a Redactor applying DefaultRules and masking the values of
+// DefaultKeys and keys, compared case-insensitively. In strict mode it also
+// applies StrictRules and replaces user IDs, usernames, email addresses and
+// client addresses logged under their usual keys with pseudonyms.
+func New(keys []string, strict bool) *Redactor {
+	r := &Redactor{
+		rules: DefaultRules,
+		keys:  make(map[string]bool, len(DefaultKeys)+len(keys)),
+	}
+	for _, k := range DefaultKeys {
+		r.keys[k] = true
+	}
+	for _, k := range keys {
+		r.keys[strings.ToLower(k)] = true
+	}
+	if strict {
+		r.rules = append(append([]Rule(nil), DefaultRules...), StrictRules...)
+		r.identifiers = make(map[string]bool, len(identifierKeys))
+		for _, k := range identifierKeys {
+			r.identifiers[k] = true
+		}
+	}
+	return r
+}
+
+// String returns s with the matches of every rule masked.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = rule.Apply(s)
+	}
+	return s
+}
+
+// Error returns the message of err, masked.
+func (r *Redactor) Error(err error) string {
+	return r.String(err.Error())
+}
+
+// Value returns the value logged or reported under key, masked.
+func (r *Redactor) Value(key, value string) string {
+	if r == nil {
+		return value
+	}
+	key = strings.ToLower(key)
+	switch {
+	case r.keys[key]:
+		return Masked
+	case r.identifiers[key] && value != "":
+		return pseudonym(value)
+	}
+	return r.String(value)
+}
+
+// Map returns a copy of m with its values masked, such as a chat's
+// metadata.
+func (r *Redactor) Map(m map[string]string) map[string]string {
+	if r == nil || m == nil {
+		return m
+	}
+	masked := make(map[string]string, len(m))
+	for k, v := range m {
+		masked[k] = r.Value(k, v)
+	}
+	return masked
+}
+
+// ReplaceAttr masks log attributes, for slog.HandlerOptions. Strings and
+// errors are masked by key and by rule, and string maps entry by entry.
+// The record's time and level, and numbers, are left alone.
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if r == nil || len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+		return a
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.Value(a.Key, a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, r.Value(a.Key, v.Error()))
+		case map[string]string:
+			return slog.Any(a.Key, r.Map(v))
+		case fmt.Stringer:
+			return slog.String(a.Key, r.Value(a.Key, v.String()))
+		}
+	}
+	return a
+}
+
+// pseudonym stands for value consistently without revealing it at a
+// glance. It is an unkeyed hash, so values from a small space, like IP
+// addresses, can be recovered by hashing candidates.
+func pseudonym(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "anon:" + hex.EncodeToString(sum[:6])
+}
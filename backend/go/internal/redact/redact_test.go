@@ -0,0 +1,82 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		in   string
+		want string
+	}{
+		{DefaultRules[0], "header Authorization: Bearer abc.def-123", "header Authorization: Bearer [token]"},
+		{DefaultRules[1], "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJhIn0.c2ln expired", "token [jwt] expired"},
+		{DefaultRules[2], "GET /ws?session_id=s1&token=abc&v=1", "GET /ws?session_id=s1&token=[token]&v=1"},
+		{DefaultRules[3], "no user alice.b+x@example.co.uk here", "no user [email] here"},
+		{StrictRules[0], "dial 10.0.0.12:50051 failed", "dial [ip]:50051 failed"},
+		{StrictRules[1], "card 4111 1111 1111 1111 declined", "card [number] declined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule.Name, func(t *testing.T) {
+			if got := tt.rule.Apply(tt.in); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := New([]string{"Patient_ID"}, false)
+	if got := r.Value("patient_id", "p-42"); got != Masked {
+		t.Errorf("expected a configured key to be masked, got %q", got)
+	}
+	if got := r.Value("password", "hunter2"); got != Masked {
+		t.Errorf("expected a default key to be masked, got %q", got)
+	}
+	if got := r.Value("user_id", "bob@example.com"); got != "[email]" {
+		t.Errorf("expected rules to apply to other keys, got %q", got)
+	}
+	if got := r.Value("client_ip", "10.0.0.1"); got != "10.0.0.1" {
+		t.Errorf("expected addresses to be kept outside strict mode, got %q", got)
+	}
+	if got := r.Map(map[string]string{"patient_id": "p-42", "lang": "en"}); got["patient_id"] != Masked || got["lang"] != "en" {
+		t.Errorf("Map() = %v", got)
+	}
+
+	strict := New(nil, true)
+	a, b := strict.Value("user_id", "alice"), strict.Value("user_id", "alice")
+	if !strings.HasPrefix(a, "anon:") || a != b || strings.Contains(a, "alice") {
+		t.Errorf("expected a stable pseudonym, got %q and %q", a, b)
+	}
+	if got := strict.Error(errors.New("upstream 10.1.2.3 refused")); got != "upstream [ip] refused" {
+		t.Errorf("Error() = %q", got)
+	}
+
+	var nilRedactor *Redactor
+	if got := nilRedactor.Error(errors.New("a@b.io")); got != "a@b.io" {
+		t.Errorf("expected a nil Redactor to mask nothing, got %q", got)
+	}
+}
+
+func TestRedactor_ReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: New(nil, false).ReplaceAttr}))
+	logger.Info("Login for carol@example.com failed",
+		"token", "abc", "error", errors.New("Bearer xyz rejected"), "count", 3,
+		slog.Group("req", "authorization", "Basic Zm9v"))
+
+	out := buf.String()
+	for _, leak := range []string{"carol@example.com", "abc", "xyz", "Zm9v"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("expected %q to be masked in %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, "level=INFO") || !strings.Contains(out, "count=3") {
+		t.Errorf("expected the level and numbers to be kept in %s", out)
+	}
+}
@@ -0,0 +1,104 @@
+package remoteconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// consulWait is how long a Consul blocking query waits for a change.
+const consulWait = "5m"
+
+// consul reads the KV store of Consul, watching it with blocking queries.
+type consul struct {
+	*cluster
+	prefix string
+
+	mu    sync.Mutex
+	index uint64
+}
+
+type consulPair struct {
+	Key string
+	// Value is the base64 of the value, decoded by encoding/json; folders
+	// have none.
+	Value []byte
+}
+
+func (s *consul) Load(ctx context.Context) (map[string]string, error) {
+	pairs, index, err := s.get(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+
+	values := make(map[string]string)
+	for _, p := range pairs {
+		if name, ok := setting(p.Key, s.prefix); ok && p.Value != nil {
+			values[name] = string(p.Value)
+		}
+	}
+	return values, nil
+}
+
+func (s *consul) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	index := s.index
+	s.mu.Unlock()
+	for {
+		// A blocking query answers when the index moves past index, or
+		// when the wait is over with the same index.
+		_, next, err := s.get(ctx, index)
+		if err != nil {
+			return err
+		}
+		if next != index {
+			return nil
+		}
+	}
+}
+
+// get reads the keys under the prefix, blocking until the index moves past
+// index unless it is 0, and returns them with the index.
+func (s *consul) get(ctx context.Context, index uint64) ([]consulPair, uint64, error) {
+	resp, err := s.do(ctx, func(base string) (*http.Request, error) {
+		query := url.Values{"recurse": {"true"}}
+		if index > 0 {
+			query.Set("index", strconv.FormatUint(index, 10))
+			query.Set("wait", consulWait)
+		}
+		req, err := http.NewRequest(http.MethodGet, base+"/v1/kv/"+s.prefix+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if s.token != "" {
+			req.Header.Set("X-Consul-Token", s.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// No key under the prefix.
+		return nil, next, nil
+	default:
+		return nil, 0, fmt.Errorf("consul answered %s", resp.Status)
+	}
+	var pairs []consulPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("invalid consul response: %w", err)
+	}
+	return pairs, next, nil
+}
@@ -0,0 +1,157 @@
+package remoteconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// etcd reads etcd through the JSON gateway of its v3 API, watching the
+// prefix from the revision last loaded.
+type etcd struct {
+	*cluster
+	prefix string
+
+	mu       sync.Mutex
+	revision int64
+}
+
+// etcdKV is a key and its value in the etcd API, bytes it spells in base64
+// as encoding/json does. Revisions are 64-bit integers it spells as
+// strings.
+type etcdKV struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdRange struct {
+	Header etcdHeader `json:"header"`
+	KVs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatch struct {
+	Result struct {
+		Created         bool              `json:"created"`
+		Canceled        bool              `json:"canceled"`
+		CompactRevision int64             `json:"compact_revision,string"`
+		Events          []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *etcd) Load(ctx context.Context) (map[string]string, error) {
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]any{
+		"key":       []byte(s.prefix),
+		"range_end": prefixEnd(s.prefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var r etcdRange
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid etcd response: %w", err)
+	}
+	s.mu.Lock()
+	s.revision = r.Header.Revision
+	s.mu.Unlock()
+
+	values := make(map[string]string)
+	for _, kv := range r.KVs {
+		if name, ok := setting(string(kv.Key), s.prefix); ok {
+			values[name] = string(kv.Value)
+		}
+	}
+	return values, nil
+}
+
+func (s *etcd) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	revision := s.revision
+	s.mu.Unlock()
+
+	// The watch is a stream of responses, open until ctx ends it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.post(ctx, "/v3/watch", map[string]any{
+		"create_request": map[string]any{
+			"key":            []byte(s.prefix),
+			"range_end":      prefixEnd(s.prefix),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var w etcdWatch
+		if err := dec.Decode(&w); err != nil {
+			return fmt.Errorf("etcd watch ended: %w", err)
+		}
+		switch {
+		case w.Error != nil:
+			return errors.New("etcd watch failed: " + w.Error.Message)
+		case w.Result.Canceled || w.Result.CompactRevision > 0:
+			// The revision was compacted away; loading again catches up.
+			return nil
+		case len(w.Result.Events) > 0:
+			return nil
+		}
+	}
+}
+
+// post sends body as JSON to path and returns the response, failing unless
+// it is 200 OK.
+func (s *etcd) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, func(base string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, base+path, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.token != "" {
+			req.Header.Set("Authorization", s.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("etcd answered %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// prefixEnd returns the end of the range of keys starting with prefix: the
+// prefix with its last byte below 0xff incremented.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every byte is 0xff: the range runs to the end of the keys.
+	return []byte{0}
+}
@@ -0,0 +1,138 @@
+// Package remoteconfig reads the gateway's dynamic settings from the keys
+// under a prefix in etcd or Consul and watches them, so every replica
+// applies the same settings within seconds of a change. Keys are named
+// after the settings' environment variables, such as
+// neuronai/gateway/MAINTENANCE_MODE.
+package remoteconfig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// Bounds of the wait between attempts while the store is unreachable.
+const (
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// Store is a key-value store holding settings under a prefix.
+type Store interface {
+	// Load returns the settings under the prefix, by key with the prefix
+	// removed. Keys further down, with a slash after the prefix, are left
+	// out.
+	Load(ctx context.Context) (map[string]string, error)
+	// Wait returns once the settings may have changed since the last Load,
+	// or with an error, such as ctx's.
+	Wait(ctx context.Context) error
+}
+
+// New returns the Store of provider, etcd or consul, reading prefix at the
+// first of endpoints that answers, with token, if not empty, to
+// authenticate.
+func New(provider string, endpoints []string, prefix, token string) (Store, error) {
+	c := &cluster{endpoints: endpoints, token: token, client: &http.Client{}}
+	switch provider {
+	case "etcd":
+		return &etcd{cluster: c, prefix: prefix}, nil
+	case "consul":
+		return &consul{cluster: c, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("unknown remote config store %q", provider)
+}
+
+// Watch calls apply with the settings of store whenever they differ from
+// current, until ctx is done. Call it after a Load. While the store is
+// unreachable the settings stay as they were.
+func Watch(ctx context.Context, store Store, current map[string]string, apply func(map[string]string), logger *slog.Logger) {
+	retry := minRetry
+	for {
+		err := store.Wait(ctx)
+		var next map[string]string
+		if err == nil {
+			next, err = store.Load(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warn("Remote config unavailable, retrying", "retry_in", retry, logging.Err(err))
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+			retry = min(2*retry, maxRetry)
+			continue
+		}
+		retry = minRetry
+		if !maps.Equal(next, current) {
+			current = next
+			apply(next)
+		}
+	}
+}
+
+// cluster sends requests to the endpoints of a store, moving on to the
+// next when one fails.
+type cluster struct {
+	endpoints []string
+	token     string
+	client    *http.Client
+
+	mu      sync.Mutex
+	current int
+}
+
+// do sends the request built by build for an endpoint's base URL to each
+// endpoint in turn, from the last that answered, until one answers. The
+// caller closes the response body.
+func (c *cluster) do(ctx context.Context, build func(base string) (*http.Request, error)) (*http.Response, error) {
+	c.mu.Lock()
+	first := c.current
+	c.mu.Unlock()
+
+	var err error
+	for i := range c.endpoints {
+		n := (first + i) % len(c.endpoints)
+		var req *http.Request
+		if req, err = build(strings.TrimSuffix(c.endpoints[n], "/")); err != nil {
+			return nil, err
+		}
+		var resp *http.Response
+		if resp, err = c.client.Do(req.WithContext(ctx)); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			err = fmt.Errorf("%s answered %s", c.endpoints[n], resp.Status)
+			continue
+		}
+		c.mu.Lock()
+		c.current = n
+		c.mu.Unlock()
+		return resp, nil
+	}
+	return nil, err
+}
+
+// setting returns the name of the setting at key under prefix, or false
+// for keys further down.
+func setting(key, prefix string) (string, bool) {
+	name, ok := strings.CutPrefix(key, prefix)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,219 @@
+package remoteconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul serves the keys of a Consul KV store, answering blocking
+// queries when they change.
+type fakeConsul struct {
+	mu      sync.Mutex
+	index   uint64
+	keys    map[string]string
+	changed chan struct{}
+	token   string
+}
+
+func newFakeConsul(keys map[string]string) *fakeConsul {
+	return &fakeConsul{index: 1, keys: keys, changed: make(chan struct{})}
+}
+
+func (c *fakeConsul) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[key] = value
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.token = r.Header.Get("X-Consul-Token")
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+	if want, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); want > 0 && want == index {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	var pairs []consulPair
+	for k, v := range c.keys {
+		pairs = append(pairs, consulPair{Key: k, Value: []byte(v)})
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// watch runs Watch on store and returns the settings it applies.
+func watch(t *testing.T, store Store, current map[string]string) <-chan map[string]string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	applied := make(chan map[string]string, 1)
+	go Watch(ctx, store, current, func(values map[string]string) { applied <- values }, quietLogger())
+	return applied
+}
+
+func TestConsul(t *testing.T) {
+	fake := newFakeConsul(map[string]string{
+		"neuronai/gateway/MAINTENANCE_MODE": "false",
+		"neuronai/gateway/tenants/acme":     "ignored",
+		"neuronai/other/LOG_LEVEL":          "ignored",
+	})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// The first endpoint is down; the store moves on to the next.
+	store, err := New("consul", []string{"http://127.0.0.1:1", srv.URL}, "neuronai/gateway/", "acl-token")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	values, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := map[string]string{"MAINTENANCE_MODE": "false"}; !maps.Equal(values, want) {
+		t.Errorf("Load() = %v, want %v", values, want)
+	}
+	if fake.token != "acl-token" {
+		t.Errorf("expected the ACL token sent, got %q", fake.token)
+	}
+
+	applied := watch(t, store, values)
+	fake.set("neuronai/gateway/MAINTENANCE_MODE", "true")
+	select {
+	case got := <-applied:
+		if got["MAINTENANCE_MODE"] != "true" {
+			t.Errorf("applied %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the change applied")
+	}
+}
+
+// fakeEtcd serves the range and watch calls of the etcd JSON gateway.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	revision int64
+	keys     map[string]string
+	changed  chan struct{}
+}
+
+func (e *fakeEtcd) set(key, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[key] = value
+	e.revision++
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key    []byte `json:"key"`
+		Create struct {
+			Key           []byte `json:"key"`
+			StartRevision int64  `json:"start_revision,string"`
+		} `json:"create_request"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		var kvs []map[string]string
+		for k, v := range e.keys {
+			if len(k) >= len(req.Key) && k[:len(req.Key)] == string(req.Key) {
+				kvs = append(kvs, map[string]string{
+					"key":   base64.StdEncoding.EncodeToString([]byte(k)),
+					"value": base64.StdEncoding.EncodeToString([]byte(v)),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"header": map[string]string{"revision": fmt.Sprint(e.revision)}, "kvs": kvs})
+	case "/v3/watch":
+		e.mu.Lock()
+		changed, revision := e.changed, e.revision
+		e.mu.Unlock()
+		fmt.Fprintln(w, `{"result":{"created":true}}`)
+		w.(http.Flusher).Flush()
+		if req.Create.StartRevision > revision {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		fmt.Fprintln(w, `{"result":{"events":[{"type":"PUT"}]}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	fake := &fakeEtcd{revision: 7, keys: map[string]string{"gw/QUOTA_REQUESTS": "100"}, changed: make(chan struct{})}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := New("etcd", []string{srv.URL}, "gw/", "")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	values, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := map[string]string{"QUOTA_REQUESTS": "100"}; !maps.Equal(values, want) {
+		t.Errorf("Load() = %v, want %v", values, want)
+	}
+
+	applied := watch(t, store, values)
+	fake.set("gw/QUOTA_REQUESTS", "250")
+	select {
+	case got := <-applied:
+		if got["QUOTA_REQUESTS"] != "250" {
+			t.Errorf("applied %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the change applied")
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	if got := string(prefixEnd("gw/")); got != "gw0" {
+		t.Errorf("prefixEnd() = %q", got)
+	}
+	if got := prefixEnd("a\xff"); string(got) != "b" {
+		t.Errorf("prefixEnd() = %q", got)
+	}
+}
+
+func TestNew_UnknownProvider(t *testing.T) {
+	if _, err := New("zookeeper", []string{"http://zk:2181"}, "gw/", ""); err == nil {
+		t.Error("expected an unknown store refused")
+	}
+}
@@ -0,0 +1,58 @@
+package revocation
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// Request revokes either one token, by its jti and optionally its expiry,
+// or every token issued so far to a user.
+type Request struct {
+	JTI       string    `json:"jti,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+}
+
+// Handler serves POST /admin/revocations.
+func (l *List) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := middleware.DecodeJSON(r.Body, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.JTI == "") == (req.UserID == "") {
+		http.Error(w, "Exactly one of jti and user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]any{}
+	var err error
+	if req.JTI != "" {
+		err = l.RevokeToken(r.Context(), req.JTI, req.ExpiresAt)
+		resp["jti"] = req.JTI
+	} else {
+		var cutoff time.Time
+		cutoff, err = l.RevokeUser(r.Context(), req.UserID)
+		resp["user_id"] = req.UserID
+		resp["issued_before"] = cutoff.Add(time.Second).UTC()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke token", logging.Err(err))
+		http.Error(w, "Revocation list unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Revoked tokens", "jti", req.JTI, "revoked_user_id", req.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
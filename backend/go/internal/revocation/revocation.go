@@ -0,0 +1,207 @@
+// Package revocation keeps a denylist of JWTs in Redis, shared by every
+// gateway instance, so compromised tokens can be invalidated before they
+// expire.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/admin"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix prefixes the keys of revocations in Redis.
+const DefaultRedisPrefix = "neuronai:revoked:"
+
+// maxCacheEntries bounds the lookups List caches; beyond it expired entries
+// are swept, and if that is not enough the cache is reset.
+const maxCacheEntries = 10000
+
+// List is a denylist of token IDs (jti) and of per-user cutoffs revoking
+// every token a user was issued up to a point in time. Lookups are cached
+// for cacheTTL, so a revocation made on another instance takes effect here
+// within cacheTTL; one made through this List takes effect at once.
+type List struct {
+	client   *redis.Client
+	prefix   string
+	ttl      time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// cached is a Redis value, empty if the key was absent, and when it must be
+// looked up again.
+type cached struct {
+	value   string
+	expires time.Time
+}
+
+// NewList connects to the Redis server at url, e.g.
+// redis://:pass@host:6379/0. User cutoffs, and token revocations without an
+// expiry, are kept for ttl, which must exceed the lifetime of any accepted
+// token.
+func NewList(url, prefix string, ttl, cacheTTL time.Duration) (*List, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	return &List{
+		client:   redis.NewClient(opts),
+		prefix:   prefix,
+		ttl:      ttl,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cached),
+	}, nil
+}
+
+func jtiKey(jti string) string     { return "jti:" + jti }
+func userKey(userID string) string { return "user:" + userID }
+
+// IsRevoked reports whether the token jti, or every token of userID issued
+// at or before issuedAt, was revoked. A zero issuedAt, from a token without
+// an iat claim, is revoked by any cutoff of its user.
+func (l *List) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	var keys []string
+	if jti != "" {
+		keys = append(keys, jtiKey(jti))
+	}
+	if userID != "" {
+		keys = append(keys, userKey(userID))
+	}
+	values, err := l.lookup(ctx, keys)
+	if err != nil {
+		return false, err
+	}
+
+	if jti != "" && values[jtiKey(jti)] != "" {
+		return true, nil
+	}
+	if cutoff := values[userKey(userID)]; userID != "" && cutoff != "" {
+		unix, err := strconv.ParseInt(cutoff, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid revocation cutoff for %s: %w", userID, err)
+		}
+		return issuedAt.Unix() <= unix, nil
+	}
+	return false, nil
+}
+
+// lookup returns the values of keys, from the cache or with one round trip
+// to Redis for those not cached.
+func (l *List) lookup(ctx context.Context, keys []string) (map[string]string, error) {
+	now := l.now()
+	values := make(map[string]string, len(keys))
+	var missing []string
+
+	l.mu.Lock()
+	for _, key := range keys {
+		if c, ok := l.cache[key]; ok && now.Before(c.expires) {
+			values[key] = c.value
+			continue
+		}
+		missing = append(missing, key)
+	}
+	l.mu.Unlock()
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	prefixed := make([]string, len(missing))
+	for i, key := range missing {
+		prefixed[i] = l.prefix + key
+	}
+	found, err := l.client.MGet(ctx, prefixed...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, key := range missing {
+		value, _ := found[i].(string)
+		values[key] = value
+		l.store(key, value, now)
+	}
+	return values, nil
+}
+
+// store caches value for key. The caller must hold mu.
+func (l *List) store(key, value string, now time.Time) {
+	if l.cacheTTL <= 0 {
+		return
+	}
+	if len(l.cache) >= maxCacheEntries {
+		for k, c := range l.cache {
+			if !now.Before(c.expires) {
+				delete(l.cache, k)
+			}
+		}
+		if len(l.cache) >= maxCacheEntries {
+			l.cache = make(map[string]cached)
+		}
+	}
+	l.cache[key] = cached{value: value, expires: now.Add(l.cacheTTL)}
+}
+
+// RevokeToken revokes the token jti until expiresAt, when it would have
+// expired anyway. A zero expiresAt keeps the revocation for the List's ttl.
+func (l *List) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("missing token ID")
+	}
+	now := l.now()
+	ttl := l.ttl
+	if !expiresAt.IsZero() {
+		ttl = expiresAt.Sub(now)
+		if ttl <= 0 {
+			return nil
+		}
+	}
+	return l.set(ctx, jtiKey(jti), "1", ttl, now)
+}
+
+// RevokeUser revokes every token issued to userID up to now and returns the
+// cutoff. Tokens issued in the same second are revoked too.
+func (l *List) RevokeUser(ctx context.Context, userID string) (time.Time, error) {
+	if userID == "" {
+		return time.Time{}, errors.New("missing user ID")
+	}
+	now := l.now()
+	cutoff := now.Truncate(time.Second)
+	return cutoff, l.set(ctx, userKey(userID), strconv.FormatInt(cutoff.Unix(), 10), l.ttl, now)
+}
+
+func (l *List) set(ctx context.Context, key, value string, ttl time.Duration, now time.Time) error {
+	if err := l.client.Set(ctx, l.prefix+key, value, ttl).Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.store(key, value, now)
+	l.mu.Unlock()
+	return nil
+}
+
+// Check pings the Redis server.
+func (l *List) Check(ctx context.Context) error {
+	return l.client.Ping(ctx).Err()
+}
+
+// Backend reports the Redis server for runtime introspection, without the
+// credentials carried in the URL.
+func (l *List) Backend() admin.Backend {
+	return admin.Backend{Name: "revocation_list", Kind: "redis", Address: l.client.Options().Addr}
+}
+
+func (l *List) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,165 @@
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestList(t *testing.T, mr *miniredis.Miniredis, cacheTTL time.Duration) *List {
+	t.Helper()
+	l, err := NewList("redis://"+mr.Addr(), DefaultRedisPrefix, time.Hour, cacheTTL)
+	if err != nil {
+		t.Fatalf("NewList() error = %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestList_RevokeToken(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := newTestList(t, mr, time.Minute)
+	ctx := context.Background()
+
+	if err := l.RevokeToken(ctx, "jti-1", time.Now().Add(10*time.Minute)); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if ttl := mr.TTL(DefaultRedisPrefix + "jti:jti-1"); ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Errorf("expected the revocation to expire with the token, got TTL %v", ttl)
+	}
+
+	for _, tt := range []struct {
+		jti  string
+		want bool
+	}{{"jti-1", true}, {"jti-2", false}, {"", false}} {
+		revoked, err := l.IsRevoked(ctx, tt.jti, "user-1", time.Now())
+		if err != nil {
+			t.Fatalf("IsRevoked() error = %v", err)
+		}
+		if revoked != tt.want {
+			t.Errorf("IsRevoked(%q) = %v, want %v", tt.jti, revoked, tt.want)
+		}
+	}
+
+	if err := l.RevokeToken(ctx, "jti-3", time.Now().Add(-time.Minute)); err != nil || mr.Exists(DefaultRedisPrefix+"jti:jti-3") {
+		t.Errorf("expected expired token not to be stored, err = %v", err)
+	}
+}
+
+func TestList_RevokeUser(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := newTestList(t, mr, time.Minute)
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	if _, err := l.RevokeUser(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeUser() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		userID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before", "user-1", now.Add(-time.Hour), true},
+		{"issued same second", "user-1", now, true},
+		{"issued after", "user-1", now.Add(time.Second), false},
+		{"no iat", "user-1", time.Time{}, true},
+		{"other user", "user-2", now.Add(-time.Hour), false},
+	} {
+		revoked, err := l.IsRevoked(ctx, "", tt.userID, tt.issuedAt)
+		if err != nil {
+			t.Fatalf("%s: IsRevoked() error = %v", tt.name, err)
+		}
+		if revoked != tt.want {
+			t.Errorf("%s: IsRevoked() = %v, want %v", tt.name, revoked, tt.want)
+		}
+	}
+}
+
+func TestList_CachesLookups(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newTestList(t, mr, time.Minute)
+	b := newTestList(t, mr, time.Minute)
+	ctx := context.Background()
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	if revoked, _ := a.IsRevoked(ctx, "jti-1", "", now); revoked {
+		t.Fatal("expected jti-1 not revoked yet")
+	}
+	if err := b.RevokeToken(ctx, "jti-1", time.Time{}); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+
+	if revoked, _ := a.IsRevoked(ctx, "jti-1", "", now); revoked {
+		t.Error("expected the cached lookup until the cache expires")
+	}
+	if revoked, _ := b.IsRevoked(ctx, "jti-1", "", now); !revoked {
+		t.Error("expected the revoking instance to see its revocation at once")
+	}
+	now = now.Add(time.Minute)
+	if revoked, _ := a.IsRevoked(ctx, "jti-1", "", now); !revoked {
+		t.Error("expected the revocation after the cache expired")
+	}
+
+	mr.SetError("down")
+	now = now.Add(time.Minute)
+	if _, err := a.IsRevoked(ctx, "jti-1", "", now); err == nil {
+		t.Error("expected an error while Redis is down")
+	}
+}
+
+func TestList_Handler(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := newTestList(t, mr, time.Minute)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"token", `{"jti":"jti-1"}`, http.StatusOK},
+		{"user", `{"user_id":"user-1"}`, http.StatusOK},
+		{"both", `{"jti":"jti-1","user_id":"user-1"}`, http.StatusBadRequest},
+		{"neither", `{}`, http.StatusBadRequest},
+		{"malformed", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			l.Handler(rec, httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewBufferString(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	if !mr.Exists(DefaultRedisPrefix+"jti:jti-1") || !mr.Exists(DefaultRedisPrefix+"user:user-1") {
+		t.Error("expected both revocations stored")
+	}
+
+	rec := httptest.NewRecorder()
+	l.Handler(rec, httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewBufferString(`{"user_id":"user-2"}`)))
+	var body struct {
+		IssuedBefore time.Time `json:"issued_before"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.IssuedBefore.IsZero() {
+		t.Errorf("expected issued_before in response, got %v", err)
+	}
+
+	mr.SetError("down")
+	rec = httptest.NewRecorder()
+	l.Handler(rec, httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewBufferString(`{"jti":"jti-2"}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while Redis is down, got %d", rec.Code)
+	}
+}
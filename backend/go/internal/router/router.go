@@ -0,0 +1,168 @@
+// Package router mounts the gateway's routes on an http.ServeMux in groups
+// that share a path prefix and a middleware chain. Patterns use ServeMux
+// syntax, so a route may be restricted to a method ("POST /chat") and name
+// path parameters ("/sessions/{id}"), which handlers read with
+// r.PathValue. Each middleware carries a name, and every mounted route is
+// reported with the names of the middleware wrapping it, for the route
+// inventory.
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware is a named handler decorator. The zero Middleware does nothing,
+// so optional middleware can be built conditionally and passed along
+// regardless. A Middleware with a Name but no Wrap is only reported: it
+// names a layer applied by the middleware before it, such as the fallback
+// chain of middleware.StaticTokenOr.
+type Middleware struct {
+	Name string
+	Wrap func(http.Handler) http.Handler
+}
+
+// Named returns the middleware wrap, reported as name.
+func Named(name string, wrap func(http.Handler) http.Handler) Middleware {
+	return Middleware{Name: name, Wrap: wrap}
+}
+
+// Chain is a sequence of middleware, outermost first.
+type Chain []Middleware
+
+// Then wraps h in the chain's middleware.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].Wrap != nil {
+			h = c[i].Wrap(h)
+		}
+	}
+	return h
+}
+
+// Names returns the names of the chain's middleware, outermost first.
+func (c Chain) Names() []string {
+	names := []string{}
+	for _, m := range c {
+		if m.Name != "" {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// Option configures a Router.
+type Option func(*Router)
+
+// OnRoute calls fn with the pattern of each route mounted and the names of
+// its middleware, outermost first.
+func OnRoute(fn func(pattern string, middleware ...string)) Option {
+	return func(r *Router) {
+		r.onRoute = fn
+	}
+}
+
+// PerRoute wraps each route mounted in fn's middleware for its pattern,
+// outside the rest of its chain, as for metrics labelled by route.
+func PerRoute(fn func(pattern string) Middleware) Option {
+	return func(r *Router) {
+		r.perRoute = fn
+	}
+}
+
+// Router serves the routes mounted on it and its groups. Routes mounted on
+// the Router itself have no prefix or middleware but their own.
+type Router struct {
+	root     *Group
+	mux      *http.ServeMux
+	onRoute  func(pattern string, middleware ...string)
+	perRoute func(pattern string) Middleware
+}
+
+func New(opts ...Option) *Router {
+	r := &Router{mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.root = &Group{router: r}
+	return r
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// Group returns a group of routes under prefix wrapped in mw.
+func (r *Router) Group(prefix string, mw ...Middleware) *Group {
+	return r.root.Group(prefix, mw...)
+}
+
+// Handle mounts h at pattern, wrapped in mw.
+func (r *Router) Handle(pattern string, h http.Handler, mw ...Middleware) {
+	r.root.Handle(pattern, h, mw...)
+}
+
+// HandleFunc is Handle for a handler function.
+func (r *Router) HandleFunc(pattern string, h http.HandlerFunc, mw ...Middleware) {
+	r.root.Handle(pattern, h, mw...)
+}
+
+// Method mounts h at path for requests with method only.
+func (r *Router) Method(method, path string, h http.Handler, mw ...Middleware) {
+	r.root.Method(method, path, h, mw...)
+}
+
+// Group is a set of routes under a common path prefix, wrapped in a common
+// middleware chain.
+type Group struct {
+	router *Router
+	prefix string
+	chain  Chain
+}
+
+// Group returns a subgroup whose routes are under prefix within g and
+// wrapped in g's middleware, then mw.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		router: g.router,
+		prefix: g.prefix + prefix,
+		chain:  append(append(Chain(nil), g.chain...), mw...),
+	}
+}
+
+// Use appends mw to the middleware of the routes mounted on g from now on.
+func (g *Group) Use(mw ...Middleware) {
+	g.chain = append(g.chain, mw...)
+}
+
+// Handle mounts h at pattern within g, wrapped in g's middleware, then mw.
+// A method in pattern is kept in front of the prefixed path.
+func (g *Group) Handle(pattern string, h http.Handler, mw ...Middleware) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if ok {
+		pattern = method + " " + g.prefix + strings.TrimLeft(path, " ")
+	} else {
+		pattern = g.prefix + pattern
+	}
+
+	var chain Chain
+	if g.router.perRoute != nil {
+		chain = append(chain, g.router.perRoute(pattern))
+	}
+	chain = append(append(chain, g.chain...), mw...)
+	g.router.mux.Handle(pattern, chain.Then(h))
+	if g.router.onRoute != nil {
+		g.router.onRoute(pattern, chain.Names()...)
+	}
+}
+
+// HandleFunc is Handle for a handler function.
+func (g *Group) HandleFunc(pattern string, h http.HandlerFunc, mw ...Middleware) {
+	g.Handle(pattern, h, mw...)
+}
+
+// Method mounts h at path within g for requests with method only; others
+// get 405 Method Not Allowed. GET also serves HEAD.
+func (g *Group) Method(method, path string, h http.Handler, mw ...Middleware) {
+	g.Handle(method+" "+path, h, mw...)
+}
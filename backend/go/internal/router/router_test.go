@@ -0,0 +1,117 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tag is middleware appending name to the X-Trace response header, so tests
+// can see the order it ran in.
+func tag(name string) Middleware {
+	return Named(name, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+func TestRouter_Groups(t *testing.T) {
+	routes := map[string][]string{}
+	r := New(OnRoute(func(pattern string, middleware ...string) {
+		routes[pattern] = middleware
+	}))
+
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	api := r.Group("/api", tag("auth"))
+	api.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {}, tag("limit"), Middleware{})
+	admin := api.Group("/admin", tag("role"))
+	api.Use(tag("late"))
+	admin.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	})
+	api.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {})
+
+	want := map[string][]string{
+		"/health":               {},
+		"/api/chat":             {"auth", "limit"},
+		"/api/admin/users/{id}": {"auth", "role"},
+		"/api/other":            {"auth", "late"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("routes = %v, want %v", routes, want)
+	}
+
+	for path, trace := range map[string]string{
+		"/api/chat":           "auth,limit",
+		"/api/admin/users/42": "auth,role",
+		"/api/other":          "auth,late",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := strings.Join(rec.Header().Values("X-Trace"), ","); got != trace {
+			t.Errorf("%s: middleware ran as %q, want %q", path, got, trace)
+		}
+		if path == "/api/admin/users/42" && rec.Body.String() != "42" {
+			t.Errorf("expected path parameter 42, got %q", rec.Body)
+		}
+	}
+}
+
+func TestRouter_Method(t *testing.T) {
+	var routes []string
+	r := New(OnRoute(func(pattern string, middleware ...string) {
+		routes = append(routes, pattern)
+	}))
+	r.Group("/api").Method(http.MethodPost, "/chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if !reflect.DeepEqual(routes, []string{"POST /api/chat"}) {
+		t.Errorf("routes = %v", routes)
+	}
+	for method, want := range map[string]int{
+		http.MethodPost: http.StatusOK,
+		http.MethodGet:  http.StatusMethodNotAllowed,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/api/chat", nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", method, want, rec.Code)
+		}
+	}
+}
+
+func TestChain_Names(t *testing.T) {
+	c := Chain{tag("outer"), {}, {Name: "inner"}}
+	if got := c.Names(); !reflect.DeepEqual(got, []string{"outer", "inner"}) {
+		t.Errorf("Names() = %v", got)
+	}
+	// Name-only middleware is reported but not applied.
+	rec := httptest.NewRecorder()
+	c.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Values("X-Trace"); !reflect.DeepEqual(got, []string{"outer"}) {
+		t.Errorf("applied %v", got)
+	}
+}
+
+func TestRouter_PerRoute(t *testing.T) {
+	var routes []string
+	r := New(OnRoute(func(pattern string, middleware ...string) {
+		routes = append(routes, pattern+" "+strings.Join(middleware, ","))
+	}), PerRoute(func(pattern string) Middleware {
+		return tag(pattern)
+	}))
+	api := r.Group("/api", tag("auth"))
+	api.Method(http.MethodPost, "/chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if want := []string{"POST /api/chat POST /api/chat,auth"}; !reflect.DeepEqual(routes, want) {
+		t.Errorf("routes = %v, want %v", routes, want)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chat", nil))
+	if got := strings.Join(rec.Header().Values("X-Trace"), ","); got != "POST /api/chat,auth" {
+		t.Errorf("middleware ran as %q", got)
+	}
+}
@@ -0,0 +1,223 @@
+// Package scheduler shares the Python service's capacity between priority
+// classes, so that premium traffic is not starved by free and batch traffic
+// while the service is saturated. Calls beyond the capacity queue by
+// priority and are let through by weighted fair queuing: each class gets
+// slots in proportion to its weight, and none is starved outright.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// ErrSaturated is returned by Acquire for a call that waited MaxWait without
+// a slot.
+var ErrSaturated = errors.New("AI service is saturated")
+
+// DefaultWeights favour internal over pro over free traffic.
+var DefaultWeights = map[middleware.Priority]int{
+	middleware.PriorityInternal: 8,
+	middleware.PriorityPro:      4,
+	middleware.PriorityFree:     1,
+}
+
+type Options struct {
+	// Capacity is how many calls may be in flight to the Python service at
+	// once.
+	Capacity int
+	// Weights are the relative shares of the priorities while calls queue.
+	// A priority without a weight gets 1.
+	Weights map[middleware.Priority]int
+	// MaxWait bounds how long a call queues for a slot.
+	MaxWait time.Duration
+}
+
+// Scheduler hands out the slots of the Python service's capacity.
+type Scheduler struct {
+	opts Options
+
+	mu      sync.Mutex
+	running int
+	waiting int
+	queues  map[middleware.Priority][]*waiter
+	// start is the virtual start time of the call at the head of each
+	// priority's queue, finish the virtual time its last call was served up
+	// to, and vtime the start of the call served last; see next.
+	start  map[middleware.Priority]float64
+	finish map[middleware.Priority]float64
+	vtime  float64
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func New(opts Options) *Scheduler {
+	return &Scheduler{
+		opts:   opts,
+		queues: make(map[middleware.Priority][]*waiter),
+		start:  make(map[middleware.Priority]float64),
+		finish: make(map[middleware.Priority]float64),
+	}
+}
+
+type contextKey struct{}
+
+// WithPriority returns a context whose calls are scheduled as priority.
+func WithPriority(ctx context.Context, priority middleware.Priority) context.Context {
+	return context.WithValue(ctx, contextKey{}, priority)
+}
+
+// PriorityOf returns the priority of calls made with ctx: that of
+// WithPriority, else that of the caller's claims, else free.
+func PriorityOf(ctx context.Context) middleware.Priority {
+	p, ok := ctx.Value(contextKey{}).(middleware.Priority)
+	if !ok {
+		if claims, found := middleware.GetClaims(ctx); found {
+			p = claims.Priority()
+		}
+	}
+	for _, known := range middleware.Priorities {
+		if p == known {
+			return p
+		}
+	}
+	return middleware.PriorityFree
+}
+
+// Acquire waits for a slot for a call of ctx's priority and returns the
+// function that gives it back, which must be called once the call is done.
+// It fails with ErrSaturated after MaxWait, or with ctx's error.
+func (s *Scheduler) Acquire(ctx context.Context) (func(), error) {
+	p := PriorityOf(ctx)
+
+	s.mu.Lock()
+	if s.running < s.opts.Capacity && s.waiting == 0 {
+		s.running++
+		s.mu.Unlock()
+		metrics.ObserveSchedulerWait(string(p), 0, true)
+		return s.releaser(), nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	if len(s.queues[p]) == 0 {
+		s.start[p] = max(s.finish[p], s.vtime)
+	}
+	s.queues[p] = append(s.queues[p], w)
+	s.waiting++
+	metrics.SetSchedulerQueued(string(p), len(s.queues[p]))
+	s.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(s.opts.MaxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		metrics.ObserveSchedulerWait(string(p), time.Since(start), true)
+		return s.releaser(), nil
+	case <-timer.C:
+		err = ErrSaturated
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	if w.granted {
+		// The slot came as we gave up; pass it on.
+		s.running--
+		s.dispatch()
+	} else {
+		s.remove(p, w)
+	}
+	s.mu.Unlock()
+	metrics.ObserveSchedulerWait(string(p), time.Since(start), false)
+	return nil, err
+}
+
+// Stats reports the calls in flight and queued by priority, for the
+// runtime report.
+func (s *Scheduler) Stats() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := map[string]int64{"capacity": int64(s.opts.Capacity), "running": int64(s.running)}
+	for _, p := range middleware.Priorities {
+		stats["queued_"+string(p)] = int64(len(s.queues[p]))
+	}
+	return stats
+}
+
+// releaser returns the function giving a slot back, once.
+func (s *Scheduler) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.dispatch()
+		})
+	}
+}
+
+// dispatch hands free slots to queued calls. The caller must hold mu.
+func (s *Scheduler) dispatch() {
+	for s.running < s.opts.Capacity && s.waiting > 0 {
+		p := s.next()
+		w := s.queues[p][0]
+		s.queues[p] = s.queues[p][1:]
+		s.waiting--
+		s.running++
+		w.granted = true
+		close(w.ready)
+		metrics.SetSchedulerQueued(string(p), len(s.queues[p]))
+	}
+}
+
+// next returns the priority to serve next, by start-time fair queuing: each
+// call is tagged with a virtual start time, that at which its priority's
+// previous call finished, each call taking 1/weight, and the earliest start
+// goes first. A call reaching the head of an empty queue starts no earlier
+// than the current virtual time, so that a priority that was idle does not
+// claim the slots it did not use. Ties go to the higher priority. The caller
+// must hold mu and ensure a call is queued.
+func (s *Scheduler) next() middleware.Priority {
+	var best middleware.Priority
+	bestStart := math.Inf(1)
+	for _, p := range middleware.Priorities {
+		if len(s.queues[p]) > 0 && s.start[p] < bestStart {
+			best, bestStart = p, s.start[p]
+		}
+	}
+	s.vtime = bestStart
+	s.finish[best] = bestStart + 1/float64(s.weight(best))
+	s.start[best] = s.finish[best]
+	return best
+}
+
+func (s *Scheduler) weight(p middleware.Priority) int {
+	if w := s.opts.Weights[p]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// remove drops w from the queue of p. The caller must hold mu.
+func (s *Scheduler) remove(p middleware.Priority, w *waiter) {
+	for i, queued := range s.queues[p] {
+		if queued == w {
+			s.queues[p] = append(s.queues[p][:i], s.queues[p][i+1:]...)
+			s.waiting--
+			metrics.SetSchedulerQueued(string(p), len(s.queues[p]))
+			return
+		}
+	}
+}
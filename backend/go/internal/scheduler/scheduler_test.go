@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func TestAcquireFastPath(t *testing.T) {
+	s := New(Options{Capacity: 2, MaxWait: time.Second})
+
+	release1, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	release2, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got := s.Stats()["running"]; got != 2 {
+		t.Errorf("running = %d, want 2", got)
+	}
+
+	release1()
+	release1()
+	release2()
+	if got := s.Stats()["running"]; got != 0 {
+		t.Errorf("running after release = %d, want 0", got)
+	}
+}
+
+func TestAcquireWeightedOrder(t *testing.T) {
+	s := New(Options{
+		Capacity: 1,
+		Weights:  map[middleware.Priority]int{middleware.PriorityPro: 3, middleware.PriorityFree: 1},
+		MaxWait:  5 * time.Second,
+	})
+	hold, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []middleware.Priority
+	var wg sync.WaitGroup
+	queue := func(p middleware.Priority, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := s.Acquire(WithPriority(context.Background(), p))
+				if err != nil {
+					t.Errorf("Acquire(%s) error = %v", p, err)
+					return
+				}
+				mu.Lock()
+				order = append(order, p)
+				mu.Unlock()
+				release()
+			}()
+		}
+	}
+	queue(middleware.PriorityFree, 4)
+	queue(middleware.PriorityPro, 4)
+	waitQueued(t, s, 8)
+
+	hold()
+	wg.Wait()
+
+	// Pro has three times free's weight, so three of the first four slots
+	// go to pro, and free is not starved while pro queues.
+	var pro int
+	for _, p := range order[:4] {
+		if p == middleware.PriorityPro {
+			pro++
+		}
+	}
+	if pro != 3 {
+		t.Errorf("pro got %d of the first 4 slots, want 3 (order %v)", pro, order)
+	}
+}
+
+func TestAcquireSaturated(t *testing.T) {
+	s := New(Options{Capacity: 1, MaxWait: 20 * time.Millisecond})
+	hold, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer hold()
+
+	if _, err := s.Acquire(context.Background()); !errors.Is(err, ErrSaturated) {
+		t.Errorf("Acquire() error = %v, want ErrSaturated", err)
+	}
+	if got := s.Stats()["queued_free"]; got != 0 {
+		t.Errorf("queued_free = %d, want 0", got)
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s := New(Options{Capacity: 1, MaxWait: time.Minute})
+	hold, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx)
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire() error = %v, want context.Canceled", err)
+	}
+
+	hold()
+	if got := s.Stats()["running"]; got != 0 {
+		t.Errorf("running = %d, want 0", got)
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	ctx := context.WithValue(context.Background(), middleware.GetClaimsContextKey(), &middleware.Claims{Plan: "pro"})
+	if got := PriorityOf(ctx); got != middleware.PriorityPro {
+		t.Errorf("PriorityOf(pro claims) = %s, want pro", got)
+	}
+	if got := PriorityOf(WithPriority(ctx, middleware.PriorityInternal)); got != middleware.PriorityInternal {
+		t.Errorf("PriorityOf(WithPriority(internal)) = %s, want internal", got)
+	}
+	if got := PriorityOf(WithPriority(ctx, "platinum")); got != middleware.PriorityFree {
+		t.Errorf("PriorityOf(unknown) = %s, want free", got)
+	}
+	if got := PriorityOf(context.Background()); got != middleware.PriorityFree {
+		t.Errorf("PriorityOf(anonymous) = %s, want free", got)
+	}
+}
+
+// waitQueued waits until n calls are queued in s.
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		waiting := s.waiting
+		s.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued calls", n)
+}
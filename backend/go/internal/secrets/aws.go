@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials sign requests to AWS.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. Paths are
+// secret names or ARNs. A secret string that is a JSON object has its keys
+// as fields; any other is the single field "".
+type AWSSecretsManager struct {
+	region   string
+	creds    Credentials
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// AWSOption configures an AWS Secrets Manager provider.
+type AWSOption func(*AWSSecretsManager)
+
+// WithEndpoint sends requests to endpoint, such as a VPC endpoint or a local
+// emulator, instead of the region's public endpoint, unless it is empty.
+func WithEndpoint(endpoint string) AWSOption {
+	return func(a *AWSSecretsManager) {
+		if endpoint != "" {
+			a.endpoint = strings.TrimRight(endpoint, "/")
+		}
+	}
+}
+
+// NewAWSSecretsManager reads secrets in region, signing requests with
+// creds.
+func NewAWSSecretsManager(region string, creds Credentials, opts ...AWSOption) *AWSSecretsManager {
+	a := &AWSSecretsManager{
+		region:   region,
+		creds:    creds,
+		endpoint: "https://secretsmanager." + region + ".amazonaws.com",
+		client:   &http.Client{Timeout: requestTimeout},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Fetch reads the current version of the secret named path.
+func (a *AWSSecretsManager) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, a.creds, a.region, "secretsmanager", a.now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		if e.Type != "" {
+			return nil, fmt.Errorf("secrets manager returned status %d: %s: %s", resp.StatusCode, e.Type, e.Message)
+		}
+		return nil, fmt.Errorf("secrets manager returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("secret is binary; only string secrets are supported")
+	}
+
+	var object map[string]any
+	if json.Unmarshal([]byte(*out.SecretString), &object) == nil && object != nil {
+		return stringFields(object)
+	}
+	return map[string]string{"": *out.SecretString}, nil
+}
+
+// signV4 signs req, whose body is body, for service in region with AWS
+// Signature Version 4.
+func signV4(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,199 @@
+// Package secrets resolves references to secrets kept in a secrets manager,
+// such as HashiCorp Vault or AWS Secrets Manager, so that sensitive settings
+// need not be handed to the gateway in plain text.
+//
+// A reference names the provider, the secret and, optionally, one of its
+// fields:
+//
+//	vault:secret/data/gateway#jwt_secret
+//	aws-sm:prod/gateway#jwt_secret
+//	aws-sm:prod/tls-key
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of the providers FromEnv configures.
+const (
+	SchemeVault = "vault"
+	SchemeAWS   = "aws-sm"
+)
+
+// Provider fetches secrets from a secrets manager.
+type Provider interface {
+	// Fetch returns the fields of the secret at path. A secret that is a
+	// plain string rather than a set of fields has the single field "".
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Ref is a parsed secret reference.
+type Ref struct {
+	Scheme string
+	Path   string
+	Field  string
+}
+
+func (r Ref) String() string {
+	if r.Field == "" {
+		return r.Scheme + ":" + r.Path
+	}
+	return r.Scheme + ":" + r.Path + "#" + r.Field
+}
+
+// Resolver resolves secret references with the provider of their scheme.
+// Each secret is fetched once, however many of its fields are resolved, so
+// a resolver should not outlive the loading of a config.
+type Resolver struct {
+	providers map[string]Provider
+
+	mu    sync.Mutex
+	cache map[string]map[string]string
+}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithProvider resolves references of scheme with p.
+func WithProvider(scheme string, p Provider) Option {
+	return func(r *Resolver) {
+		r.providers[scheme] = p
+	}
+}
+
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{
+		providers: make(map[string]Provider),
+		cache:     make(map[string]map[string]string),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// FromEnv returns a resolver with the providers the environment configures:
+// Vault if VAULT_ADDR is set, authenticating with VAULT_TOKEN and, for Vault
+// Enterprise, VAULT_NAMESPACE; and AWS Secrets Manager if AWS_REGION is set,
+// with the credentials in AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+func FromEnv() *Resolver {
+	var opts []Option
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		opts = append(opts, WithProvider(SchemeVault, NewVault(addr, os.Getenv("VAULT_TOKEN"),
+			WithNamespace(os.Getenv("VAULT_NAMESPACE")))))
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		creds := Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		opts = append(opts, WithProvider(SchemeAWS, NewAWSSecretsManager(region, creds,
+			WithEndpoint(os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")))))
+	}
+	return NewResolver(opts...)
+}
+
+// IsRef reports whether s is a secret reference, that is whether it starts
+// with the scheme of a provider FromEnv knows or r has.
+func (r *Resolver) IsRef(s string) bool {
+	scheme, _, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	if scheme == SchemeVault || scheme == SchemeAWS {
+		return true
+	}
+	_, known := r.providers[scheme]
+	return known
+}
+
+// Parse parses the secret reference s.
+func Parse(s string) (Ref, error) {
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok || scheme == "" {
+		return Ref{}, fmt.Errorf("invalid secret reference %q: want scheme:path[#field]", s)
+	}
+	path, field, _ := strings.Cut(rest, "#")
+	if path == "" {
+		return Ref{}, fmt.Errorf("invalid secret reference %q: no path", s)
+	}
+	return Ref{Scheme: scheme, Path: path, Field: field}, nil
+}
+
+// Resolve returns the value of the secret reference s. Without a field, the
+// secret must be a plain string or have a single field.
+func (r *Resolver) Resolve(ctx context.Context, s string) (string, error) {
+	ref, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	fields, err := r.fetch(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+
+	if ref.Field != "" {
+		value, ok := fields[ref.Field]
+		if !ok {
+			return "", fmt.Errorf("%s: no field %q", ref, ref.Field)
+		}
+		return value, nil
+	}
+	if len(fields) != 1 {
+		return "", fmt.Errorf("%s: secret has fields %s; name one with #field", ref, strings.Join(fieldNames(fields), ", "))
+	}
+	for _, value := range fields {
+		return value, nil
+	}
+	return "", nil
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref Ref) (map[string]string, error) {
+	p, ok := r.providers[ref.Scheme]
+	switch {
+	case ok:
+	case ref.Scheme == SchemeVault:
+		return nil, fmt.Errorf("set VAULT_ADDR to resolve vault references")
+	case ref.Scheme == SchemeAWS:
+		return nil, fmt.Errorf("set AWS_REGION to resolve aws-sm references")
+	default:
+		return nil, fmt.Errorf("no %s provider configured", ref.Scheme)
+	}
+
+	key := ref.Scheme + ":" + ref.Path
+	r.mu.Lock()
+	fields, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return fields, nil
+	}
+
+	fields, err := p.Fetch(ctx, ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cache[key] = fields
+	r.mu.Unlock()
+	return fields, nil
+}
+
+func fieldNames(fields map[string]string) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestTimeout bounds each request to a secrets manager.
+const requestTimeout = 10 * time.Second
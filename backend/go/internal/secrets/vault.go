@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from HashiCorp Vault over its HTTP API. Paths are API
+// paths below /v1/, so a KV version 2 secret "gateway" in the "secret" mount
+// is secret/data/gateway.
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// VaultOption configures a Vault provider.
+type VaultOption func(*Vault)
+
+// WithNamespace reads secrets in namespace, on Vault Enterprise.
+func WithNamespace(namespace string) VaultOption {
+	return func(v *Vault) {
+		v.namespace = namespace
+	}
+}
+
+// NewVault reads secrets from the Vault server at addr with token.
+func NewVault(addr, token string, opts ...VaultOption) *Vault {
+	v := &Vault{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Fetch reads the secret at path, from a KV engine of either version.
+func (v *Vault) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+		if len(body.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(body.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	data := body.Data
+	// KV version 2 nests the secret under data, beside its metadata.
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return stringFields(data)
+}
+
+// stringFields returns the fields of a secret decoded from JSON. Values
+// that are not strings are kept as JSON.
+func stringFields(data map[string]any) (map[string]string, error) {
+	fields := make(map[string]string, len(data))
+	for name, value := range data {
+		if s, ok := value.(string); ok {
+			fields[name] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		fields[name] = string(encoded)
+	}
+	return fields, nil
+}
@@ -0,0 +1,64 @@
+package selftest
+
+import (
+	"context"
+	"io"
+	"net"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/grpc"
+)
+
+// mockAIService answers every request with a single final echo, standing in
+// for the Python service when only the gateway is under test.
+type mockAIService struct {
+	pb.UnimplementedAIServiceServer
+}
+
+func (m *mockAIService) reply(req *pb.ChatRequest) *pb.ChatResponse {
+	return &pb.ChatResponse{
+		MessageId: "selftest-message",
+		SessionId: req.GetSessionId(),
+		Content:   "pong: " + req.GetContent(),
+		AgentType: pb.AgentType_AGENT_TYPE_ORCHESTRATOR,
+		Status:    pb.TaskStatus_TASK_STATUS_COMPLETED,
+		IsFinal:   true,
+	}
+}
+
+func (m *mockAIService) ProcessChat(ctx context.Context, req *pb.ChatRequest) (*pb.ChatResponse, error) {
+	return m.reply(req), nil
+}
+
+func (m *mockAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.StreamResponse{
+			SessionId: req.SessionId,
+			Payload:   &pb.StreamResponse_Chat{Chat: m.reply(req.GetChat())},
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// StartMockUpstream serves a mock AIService on a loopback port and returns its
+// address and a function that stops it.
+func StartMockUpstream() (string, func(), error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := grpc.NewServer()
+	pb.RegisterAIServiceServer(s, &mockAIService{})
+	go s.Serve(lis)
+
+	return lis.Addr().String(), s.Stop, nil
+}
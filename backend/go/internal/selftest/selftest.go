@@ -0,0 +1,227 @@
+// Package selftest drives a fully wired gateway through a scripted chat over
+// every client transport, so a deploy can be gated on the result.
+package selftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+const (
+	userID    = "selftest"
+	sessionID = "selftest-session"
+	prompt    = "ping"
+
+	checkTimeout = 30 * time.Second
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context, baseURL, token string) error
+}
+
+var checks = []check{
+	{"health", checkHealth},
+	{"rest_chat", checkRESTChat},
+	{"sse_chat", checkSSEChat},
+	{"websocket_chat", checkWebSocketChat},
+}
+
+// Run serves handler on a loopback listener and runs every check against it,
+// authenticating with a short-lived token signed by jwtSecret that meets
+// validation. It returns the per-check results and an error if any check
+// failed.
+func Run(ctx context.Context, handler http.Handler, jwtSecret string, validation middleware.TokenValidation) ([]Result, error) {
+	token, err := signToken(jwtSecret, validation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign self-test token: %w", err)
+	}
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	results := make([]Result, 0, len(checks))
+	failed := 0
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		start := time.Now()
+		err := c.run(checkCtx, srv.URL, token)
+		cancel()
+
+		results = append(results, Result{Name: c.name, Duration: time.Since(start), Err: err})
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return results, nil
+}
+
+func signToken(secret string, validation middleware.TokenValidation) (string, error) {
+	now := time.Now()
+	claims := middleware.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+	validation.Stamp(&claims)
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+func checkHealth(ctx context.Context, baseURL, _ string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func chatRequest(ctx context.Context, url, token string) (*http.Request, error) {
+	body, _ := json.Marshal(map[string]string{
+		"session_id": sessionID,
+		"content":    prompt,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
+func checkRESTChat(ctx context.Context, baseURL, token string) error {
+	req, err := chatRequest(ctx, baseURL+"/api/v1/chat", token)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var chat struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if chat.Content == "" {
+		return fmt.Errorf("empty response content")
+	}
+	return nil
+}
+
+func checkSSEChat(ctx context.Context, baseURL, token string) error {
+	req, err := chatRequest(ctx, baseURL+"/api/v1/chat/stream", token)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var chunk struct {
+			IsFinal bool `json:"is_final"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("invalid event: %w", err)
+		}
+		if chunk.IsFinal {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream ended without a final chunk")
+}
+
+func checkWebSocketChat(ctx context.Context, baseURL, token string) error {
+	url := "ws" + strings.TrimPrefix(baseURL, "http") + "/ws?session_id=" + sessionID
+	dialer := websocket.Dialer{Subprotocols: []string{"bearer", token}}
+
+	conn, _, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+
+	if err := conn.WriteJSON(map[string]interface{}{"content": prompt, "message_type": 1}); err != nil {
+		return err
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("no final response: %w", err)
+		}
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var msg struct {
+				IsFinal bool `json:"is_final"`
+			}
+			if err := json.Unmarshal(line, &msg); err != nil {
+				return fmt.Errorf("invalid message: %w", err)
+			}
+			if msg.IsFinal {
+				return nil
+			}
+		}
+	}
+}
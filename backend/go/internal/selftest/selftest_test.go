@@ -0,0 +1,71 @@
+package selftest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/neuronai/backend/go/internal/api"
+	"github.com/neuronai/backend/go/internal/config"
+	"github.com/neuronai/backend/go/internal/grpc"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/websocket"
+)
+
+const testSecret = "test-secret"
+
+func TestRun_MockUpstream(t *testing.T) {
+	addr, stop, err := StartMockUpstream()
+	if err != nil {
+		t.Fatalf("Failed to start mock upstream: %v", err)
+	}
+	defer stop()
+
+	client, err := grpc.NewPythonClient(addr)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := websocket.NewHub(client, websocket.WithJWTSecret(testSecret))
+	go hub.Run(ctx)
+	handler := api.NewHandler(client, hub, &config.Config{JWTSecret: testSecret})
+	auth := middleware.JWTAuth(testSecret)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handler.HealthCheck)
+	mux.Handle("/api/v1/chat", auth(http.HandlerFunc(handler.Chat)))
+	mux.Handle("/api/v1/chat/stream", auth(http.HandlerFunc(handler.StreamChat)))
+	mux.HandleFunc("/ws", hub.HandleWebSocket)
+
+	results, err := Run(ctx, mux, testSecret, middleware.TokenValidation{})
+	if err != nil {
+		for _, r := range results {
+			t.Logf("%s: %v", r.Name, r.Err)
+		}
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(results) != len(checks) {
+		t.Errorf("expected %d results, got %d", len(checks), len(results))
+	}
+}
+
+func TestRun_ReportsFailures(t *testing.T) {
+	broken := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+
+	results, err := Run(context.Background(), broken, testSecret, middleware.TokenValidation{})
+	if err == nil {
+		t.Fatal("expected Run() to fail")
+	}
+
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("expected check %s to fail", r.Name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package session holds gateway-side per-session state shared by the REST
+// handlers and the WebSocket hub.
+package session
+
+import (
+	"context"
+	"sync"
+)
+
+// Locker serializes work within a session so that messages sent concurrently
+// from several devices reach the Python service one at a time.
+type Locker struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionLock
+}
+
+type sessionLock struct {
+	// slot holds a token while the session is owned.
+	slot chan struct{}
+	// refs counts the owner plus every waiter.
+	refs int
+}
+
+func NewLocker() *Locker {
+	return &Locker{
+		sessions: make(map[string]*sessionLock),
+	}
+}
+
+// Acquire blocks until the caller owns sessionID or ctx is done. If another
+// sender already owns the session, queued is called before waiting with the
+// number of senders ahead of the caller. The returned release func must be
+// called exactly once.
+func (l *Locker) Acquire(ctx context.Context, sessionID string, queued func(ahead int)) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.sessions[sessionID]
+	if !ok {
+		lock = &sessionLock{slot: make(chan struct{}, 1)}
+		l.sessions[sessionID] = lock
+	}
+	lock.refs++
+	ahead := lock.refs - 1
+	l.mu.Unlock()
+
+	if ahead > 0 && queued != nil {
+		queued(ahead)
+	}
+
+	select {
+	case lock.slot <- struct{}{}:
+	case <-ctx.Done():
+		l.done(sessionID, lock)
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.slot
+			l.done(sessionID, lock)
+		})
+	}, nil
+}
+
+func (l *Locker) done(sessionID string, lock *sessionLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.sessions, sessionID)
+	}
+}
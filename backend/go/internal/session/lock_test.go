@@ -0,0 +1,128 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocker_SerializesSession(t *testing.T) {
+	l := NewLocker()
+
+	release, err := l.Acquire(context.Background(), "s1", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	var queuedAhead int
+	acquired := make(chan struct{})
+	go func() {
+		release2, err := l.Acquire(context.Background(), "s1", func(ahead int) {
+			queuedAhead = ahead
+		})
+		if err != nil {
+			t.Errorf("Acquire() error = %v", err)
+			return
+		}
+		close(acquired)
+		release2()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second sender acquired the session while it was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second sender never acquired the session")
+	}
+
+	if queuedAhead != 1 {
+		t.Errorf("expected 1 sender ahead, got %d", queuedAhead)
+	}
+}
+
+func TestLocker_IndependentSessions(t *testing.T) {
+	l := NewLocker()
+
+	release1, err := l.Acquire(context.Background(), "s1", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer release1()
+
+	queued := false
+	release2, err := l.Acquire(context.Background(), "s2", func(int) { queued = true })
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	release2()
+
+	if queued {
+		t.Error("expected no queueing across sessions")
+	}
+}
+
+func TestLocker_ContextCancelled(t *testing.T) {
+	l := NewLocker()
+
+	release, err := l.Acquire(context.Background(), "s1", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Acquire(ctx, "s1", nil); err == nil {
+		t.Fatal("expected error when context is cancelled")
+	}
+
+	release()
+
+	l.mu.Lock()
+	remaining := len(l.sessions)
+	l.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("expected session state to be cleaned up, got %d entries", remaining)
+	}
+}
+
+func TestLocker_ConcurrentSenders(t *testing.T) {
+	l := NewLocker()
+
+	var mu sync.Mutex
+	active := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background(), "s1", nil)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			active++
+			if active > 1 {
+				t.Error("more than one sender owns the session")
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a completed generation kept for regenerate/undo.
+type Response struct {
+	MessageID string    `json:"message_id"`
+	Content   string    `json:"content"`
+	AgentType string    `json:"agent_type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResponseCache keeps the last few responses per session for a short time so
+// clients can undo a regenerate or compare alternatives without another call
+// to the Python service. A session expires ttl after its last response.
+type ResponseCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	sessions map[string]*cachedSession
+	now      func() time.Time
+}
+
+type cachedSession struct {
+	userID    string
+	responses []Response
+	expires   time.Time
+}
+
+// NewResponseCache keeps up to size responses per session for ttl.
+func NewResponseCache(size int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		size:     size,
+		ttl:      ttl,
+		sessions: make(map[string]*cachedSession),
+		now:      time.Now,
+	}
+}
+
+// Add records resp for sessionID, evicting the oldest response beyond the
+// size limit. A session belongs to the user who first added to it.
+func (c *ResponseCache) Add(sessionID, userID string, resp Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	s, ok := c.sessions[sessionID]
+	if !ok || now.After(s.expires) {
+		s = &cachedSession{userID: userID}
+		c.sessions[sessionID] = s
+	}
+	if s.userID != userID {
+		return
+	}
+
+	if resp.CreatedAt.IsZero() {
+		resp.CreatedAt = now
+	}
+	s.responses = append(s.responses, resp)
+	if len(s.responses) > c.size {
+		s.responses = append([]Response(nil), s.responses[len(s.responses)-c.size:]...)
+	}
+	s.expires = now.Add(c.ttl)
+}
+
+// List returns the cached responses for sessionID, oldest first, if the
+// session belongs to userID and has not expired.
+func (c *ResponseCache) List(sessionID, userID string) []Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.sessions[sessionID]
+	if !ok || s.userID != userID || c.now().After(s.expires) {
+		return nil
+	}
+	return append([]Response(nil), s.responses...)
+}
+
+// Transfer hands the live sessions of user from to user to, as when a guest
+// logs in, and returns how many it moved.
+func (c *ResponseCache) Transfer(from, to string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	n := 0
+	for _, s := range c.sessions {
+		if s.userID == from && !now.After(s.expires) {
+			s.userID = to
+			n++
+		}
+	}
+	return n
+}
+
+// Run evicts expired sessions every ttl until ctx is done.
+func (c *ResponseCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *ResponseCache) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, s := range c.sessions {
+		if now.After(s.expires) {
+			delete(c.sessions, id)
+		}
+	}
+}
+
+// Builder assembles a streamed response from its chunks.
+type Builder struct {
+	content strings.Builder
+}
+
+// Append adds a chunk's content and returns the assembled response once the
+// chunk is final.
+func (b *Builder) Append(messageID, content, agentType string, final bool) (Response, bool) {
+	b.content.WriteString(content)
+	if !final {
+		return Response{}, false
+	}
+	return Response{MessageID: messageID, Content: b.content.String(), AgentType: agentType}, true
+}
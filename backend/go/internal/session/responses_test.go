@@ -0,0 +1,104 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c := NewResponseCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("s1", "u1", Response{MessageID: "m1"})
+	c.Add("s1", "u1", Response{MessageID: "m2"})
+	c.Add("s1", "u1", Response{MessageID: "m3"})
+	c.Add("s1", "u2", Response{MessageID: "intruder"})
+
+	tests := []struct {
+		name    string
+		session string
+		user    string
+		advance time.Duration
+		want    []string
+	}{
+		{"keeps newest", "s1", "u1", 0, []string{"m2", "m3"}},
+		{"other user", "s1", "u2", 0, nil},
+		{"unknown session", "s2", "u1", 0, nil},
+		{"expired", "s1", "u1", 2 * time.Minute, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := now
+			now = now.Add(tt.advance)
+			defer func() { now = saved }()
+
+			got := c.List(tt.session, tt.user)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d responses, got %d", len(tt.want), len(got))
+			}
+			for i, id := range tt.want {
+				if got[i].MessageID != id {
+					t.Errorf("response %d: expected %s, got %s", i, id, got[i].MessageID)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCache_SweepAndReuse(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c := NewResponseCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("s1", "u1", Response{MessageID: "m1"})
+	now = now.Add(2 * time.Minute)
+
+	// An expired session can be claimed afresh.
+	c.Add("s1", "u2", Response{MessageID: "m2"})
+	if got := c.List("s1", "u2"); len(got) != 1 || got[0].MessageID != "m2" {
+		t.Errorf("expected fresh session for u2, got %+v", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.sweep()
+	if len(c.sessions) != 0 {
+		t.Errorf("expected expired sessions to be swept, got %d", len(c.sessions))
+	}
+}
+
+func TestResponseCache_Transfer(t *testing.T) {
+	c := NewResponseCache(2, time.Minute)
+	c.Add("s1", "guest:1", Response{MessageID: "m1"})
+	c.Add("s2", "guest:1", Response{MessageID: "m2"})
+	c.Add("s3", "guest:2", Response{MessageID: "m3"})
+
+	if n := c.Transfer("guest:1", "alice"); n != 2 {
+		t.Errorf("expected 2 sessions moved, got %d", n)
+	}
+	if got := c.List("s1", "alice"); len(got) != 1 || got[0].MessageID != "m1" {
+		t.Errorf("expected alice to own s1, got %+v", got)
+	}
+	if got := c.List("s1", "guest:1"); got != nil {
+		t.Errorf("expected the guest to lose s1, got %+v", got)
+	}
+	if got := c.List("s3", "guest:2"); len(got) != 1 {
+		t.Errorf("expected other guests' sessions untouched, got %+v", got)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+	if _, ok := b.Append("m1", "Hello, ", "orchestrator", false); ok {
+		t.Error("expected no response before the final chunk")
+	}
+
+	resp, ok := b.Append("m2", "world", "orchestrator", true)
+	if !ok {
+		t.Fatal("expected response on the final chunk")
+	}
+	if resp.Content != "Hello, world" || resp.MessageID != "m2" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
@@ -0,0 +1,186 @@
+// Package throttle slows down credential guessing at the login endpoints.
+// Failed logins are counted per account and per client IP: after a few
+// failures an account must wait progressively longer between attempts, and
+// an account or IP that keeps failing is locked out for a while. Counting
+// per IP catches credential stuffing, which tries each account only once.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Scopes of a failure count.
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Reasons an attempt is refused.
+const (
+	ReasonDelay   = "delay"
+	ReasonLockout = "lockout"
+)
+
+// Policy sets how a scope reacts to failed logins.
+type Policy struct {
+	// FreeAttempts failures are allowed without delay. After that each
+	// failure makes the next attempt wait Delay, doubling per failure up
+	// to MaxDelay. Zero Delay disables delays.
+	FreeAttempts int
+	Delay        time.Duration
+	MaxDelay     time.Duration
+	// LockoutThreshold failures lock the scope out for Lockout. Zero
+	// disables lockouts.
+	LockoutThreshold int
+	Lockout          time.Duration
+	// Window is how long failures are remembered after the last one, unless
+	// a lockout or delay outlasts it.
+	Window time.Duration
+}
+
+// Throttle counts failed logins. Failures are forgotten after the Window of
+// their policy without another failure, and an account's on a successful
+// login to it.
+type Throttle struct {
+	account Policy
+	ip      Policy
+	forget  time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+	// until is when the next attempt is allowed, and locked whether that
+	// is the end of a lockout rather than a delay.
+	until  time.Time
+	locked bool
+}
+
+// New returns a Throttle applying account to each username and ip to each
+// client IP.
+func New(account, ip Policy) *Throttle {
+	return &Throttle{
+		account: account,
+		ip:      ip,
+		forget:  max(account.Window, ip.Window),
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Check reports how long a login to account from ip must wait and why, or
+// 0 if it may go ahead. Refused attempts do not count as failures.
+func (t *Throttle) Check(account, ip string) (time.Duration, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	reason := ""
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		e, ok := t.entries[key]
+		if !ok || !now.Before(e.until) {
+			continue
+		}
+		if d := e.until.Sub(now); d > wait {
+			wait = d
+		}
+		if e.locked {
+			reason = ReasonLockout
+		} else if reason == "" {
+			reason = ReasonDelay
+		}
+	}
+	return wait, reason
+}
+
+// Fail records a failed login to account from ip and returns the scopes it
+// locked out.
+func (t *Throttle) Fail(account, ip string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+	var locked []string
+	if t.fail(accountKey(account), t.account, now) {
+		locked = append(locked, ScopeAccount)
+	}
+	if t.fail(ipKey(ip), t.ip, now) {
+		locked = append(locked, ScopeIP)
+	}
+	return locked
+}
+
+// Succeed forgets the failures of account. Those of the client IP are kept,
+// since a stuffing run may hit a valid account now and then.
+func (t *Throttle) Succeed(account string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, accountKey(account))
+}
+
+// fail counts a failure of key under p and reports whether it started a
+// lockout.
+func (t *Throttle) fail(key string, p Policy, now time.Time) bool {
+	e, ok := t.entries[key]
+	if !ok || now.Sub(e.last) >= p.Window && !now.Before(e.until) {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+
+	if p.LockoutThreshold > 0 && e.failures >= p.LockoutThreshold {
+		if e.locked && now.Before(e.until) {
+			return false
+		}
+		e.until = now.Add(p.Lockout)
+		e.locked = true
+		return true
+	}
+	if p.Delay > 0 && e.failures > p.FreeAttempts {
+		e.until = now.Add(p.delay(e.failures - p.FreeAttempts))
+	}
+	return false
+}
+
+// delay returns the wait after the nth failure past the free attempts.
+func (p Policy) delay(n int) time.Duration {
+	d := p.Delay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// sweep drops the entries every policy would have forgotten, at most once
+// per the longest window.
+func (t *Throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.forget {
+		return
+	}
+	for k, e := range t.entries {
+		if now.Sub(e.last) >= t.forget && !now.Before(e.until) {
+			delete(t.entries, k)
+		}
+	}
+	t.lastSweep = now
+}
+
+func accountKey(account string) string {
+	return "account:" + account
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
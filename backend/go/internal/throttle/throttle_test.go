@@ -0,0 +1,93 @@
+package throttle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestThrottle(account, ip Policy) (*Throttle, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	t := New(account, ip)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestThrottle_Delay(t *testing.T) {
+	th, now := newTestThrottle(Policy{FreeAttempts: 2, Delay: time.Second, MaxDelay: 4 * time.Second, Window: time.Hour}, Policy{})
+
+	for i := 0; i < 2; i++ {
+		th.Fail("alice", "10.0.0.1")
+		if wait, _ := th.Check("alice", "10.0.0.1"); wait != 0 {
+			t.Fatalf("failure %d: expected no delay within the free attempts, got %v", i+1, wait)
+		}
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		th.Fail("alice", "10.0.0.1")
+		wait, reason := th.Check("alice", "10.0.0.2")
+		if wait != want || reason != ReasonDelay {
+			t.Fatalf("expected a %v delay, got %v (%s)", want, wait, reason)
+		}
+		*now = now.Add(wait)
+		if wait, _ := th.Check("alice", "10.0.0.1"); wait != 0 {
+			t.Fatalf("expected the delay to pass, got %v", wait)
+		}
+	}
+
+	th.Succeed("alice")
+	th.Fail("alice", "10.0.0.1")
+	if wait, _ := th.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Errorf("expected a successful login to reset the count, got %v", wait)
+	}
+}
+
+func TestThrottle_Lockout(t *testing.T) {
+	th, now := newTestThrottle(
+		Policy{LockoutThreshold: 3, Lockout: time.Minute, Window: time.Minute},
+		Policy{LockoutThreshold: 5, Lockout: 10 * time.Minute, Window: time.Minute},
+	)
+
+	for i := 0; i < 2; i++ {
+		if locked := th.Fail("alice", "10.0.0.1"); locked != nil {
+			t.Fatalf("failure %d: unexpected lockout %v", i+1, locked)
+		}
+	}
+	if locked := th.Fail("alice", "10.0.0.1"); !reflect.DeepEqual(locked, []string{ScopeAccount}) {
+		t.Fatalf("expected the account locked out, got %v", locked)
+	}
+	if wait, reason := th.Check("alice", "10.0.0.9"); wait != time.Minute || reason != ReasonLockout {
+		t.Errorf("expected alice locked out from any IP, got %v (%s)", wait, reason)
+	}
+	if wait, _ := th.Check("bob", "10.0.0.1"); wait != 0 {
+		t.Errorf("expected other accounts unaffected, got %v", wait)
+	}
+
+	// Stuffing: one attempt per account from the same IP.
+	th.Fail("bob", "10.0.0.1")
+	if locked := th.Fail("carol", "10.0.0.1"); !reflect.DeepEqual(locked, []string{ScopeIP}) {
+		t.Fatalf("expected the IP locked out, got %v", locked)
+	}
+	if wait, reason := th.Check("dave", "10.0.0.1"); wait != 10*time.Minute || reason != ReasonLockout {
+		t.Errorf("expected the IP locked out for any account, got %v (%s)", wait, reason)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	if wait, _ := th.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Errorf("expected lockouts to end, got %v", wait)
+	}
+	if locked := th.Fail("alice", "10.0.0.1"); locked != nil {
+		t.Errorf("expected the count to start over after the lockout, got %v", locked)
+	}
+}
+
+func TestThrottle_Sweep(t *testing.T) {
+	th, now := newTestThrottle(Policy{FreeAttempts: 1, Delay: time.Second, MaxDelay: time.Minute, Window: time.Minute}, Policy{})
+	th.Fail("alice", "10.0.0.1")
+
+	*now = now.Add(time.Minute)
+	th.Fail("bob", "10.0.0.2")
+	if _, ok := th.entries[accountKey("alice")]; ok {
+		t.Error("expected idle entries to be dropped")
+	}
+}
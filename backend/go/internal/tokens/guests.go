@@ -0,0 +1,83 @@
+package tokens
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// GuestToken is the response to a guest sign-in.
+type GuestToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	GuestID     string `json:"guest_id"`
+}
+
+// Guests issues ephemeral identities to anonymous callers: access tokens for
+// a random "guest:" user, limited to the chat:write scope and marked as guests.
+// There is no refresh token; a guest whose token expires starts over as a
+// new guest, or logs in.
+type Guests struct {
+	signer
+	ttl    time.Duration
+	tenant string
+	now    func() time.Time
+}
+
+// NewGuests signs guest tokens with secret for ttl, charging their usage to
+// tenant.
+func NewGuests(secret string, ttl time.Duration, tenant string, opts ...Option) *Guests {
+	return &Guests{
+		signer: newSigner(secret, opts),
+		ttl:    ttl,
+		tenant: tenant,
+		now:    time.Now,
+	}
+}
+
+// Issue signs a token for a new guest.
+func (g *Guests) Issue() (GuestToken, error) {
+	id, err := randomToken()
+	if err != nil {
+		return GuestToken{}, err
+	}
+	jti, err := randomToken()
+	if err != nil {
+		return GuestToken{}, err
+	}
+
+	now := g.now()
+	claims := middleware.Claims{
+		UserID:   middleware.GuestPrefix + id[:16],
+		Scopes:   []string{middleware.ScopeChatWrite},
+		TenantID: g.tenant,
+		Guest:    true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(g.ttl)),
+		},
+	}
+	access, err := g.sign(claims)
+	if err != nil {
+		return GuestToken{}, err
+	}
+	return GuestToken{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(g.ttl / time.Second),
+		GuestID:     claims.UserID,
+	}, nil
+}
+
+// Verify returns the user ID of the guest token was issued to, if it is a
+// live guest token.
+func (g *Guests) Verify(token string) (string, bool) {
+	claims, err := middleware.ParseToken(string(g.secret), token)
+	if err != nil || !claims.Guest {
+		return "", false
+	}
+	return claims.UserID, true
+}
@@ -0,0 +1,44 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func TestGuests(t *testing.T) {
+	guests := NewGuests(testSecret, time.Hour, "guest")
+
+	token, err := guests.Issue()
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !strings.HasPrefix(token.GuestID, middleware.GuestPrefix) || token.ExpiresIn != 3600 {
+		t.Errorf("unexpected guest token %+v", token)
+	}
+
+	claims, err := middleware.ParseToken(testSecret, token.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	if !claims.Guest || claims.UserID != token.GuestID || claims.TenantID != "guest" ||
+		!claims.HasScope(middleware.ScopeChatWrite) || claims.HasScope(middleware.ScopeSessionsRead) {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if id, ok := guests.Verify(token.AccessToken); !ok || id != token.GuestID {
+		t.Errorf("Verify() = %q, %v", id, ok)
+	}
+	pair, err := newTestIssuer(t).Login("alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guests.Verify(pair.AccessToken); ok {
+		t.Error("expected a user's token not to verify as a guest")
+	}
+	if next, _ := guests.Issue(); next.GuestID == token.GuestID {
+		t.Error("expected each guest to get a new identity")
+	}
+}
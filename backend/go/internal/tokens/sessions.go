@@ -0,0 +1,116 @@
+package tokens
+
+import (
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// loginSession is the record of a browser login.
+type loginSession struct {
+	claims   middleware.Claims
+	created  time.Time
+	lastSeen time.Time
+}
+
+// LoginSessions keeps the server-side sessions behind browser session
+// cookies. A session ends on logout, after idleTimeout without a request, or
+// maxAge after login, whichever comes first. Like refresh tokens, sessions
+// are kept in memory: they do not survive a restart and are only valid on
+// the instance that created them.
+type LoginSessions struct {
+	users       *Users
+	idleTimeout time.Duration
+	maxAge      time.Duration
+
+	mu sync.Mutex
+	// sessions is keyed by the SHA-256 of the session ID, so a memory dump
+	// does not leak usable cookies.
+	sessions  map[string]*loginSession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLoginSessions(users *Users, idleTimeout, maxAge time.Duration) *LoginSessions {
+	return &LoginSessions{
+		users:       users,
+		idleTimeout: idleTimeout,
+		maxAge:      maxAge,
+		sessions:    make(map[string]*loginSession),
+		now:         time.Now,
+	}
+}
+
+// MaxAge is how long a session lasts at most, for the cookie's Max-Age.
+func (s *LoginSessions) MaxAge() time.Duration {
+	return s.maxAge
+}
+
+// Login starts a session for the user with username and password and
+// returns its ID, the value of the session cookie.
+func (s *LoginSessions) Login(username, password string) (string, *middleware.Claims, error) {
+	user, ok := s.users.Authenticate(username, password)
+	if !ok {
+		return "", nil, ErrInvalidCredentials
+	}
+	id, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	session := &loginSession{claims: user.claims(now), created: now, lastSeen: now}
+	s.sessions[hashToken(id)] = session
+	claims := session.claims
+	return id, &claims, nil
+}
+
+// Resolve returns the claims of the live session id and marks it used.
+// Its claims carry the login time as issued-at, so revoking the user's
+// tokens also ends their sessions.
+func (s *LoginSessions) Resolve(id string) (*middleware.Claims, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashToken(id)
+	session, ok := s.sessions[hash]
+	if !ok {
+		return nil, false
+	}
+	now := s.now()
+	if s.expired(session, now) {
+		delete(s.sessions, hash)
+		return nil, false
+	}
+	session.lastSeen = now
+	claims := session.claims
+	return &claims, true
+}
+
+// Logout ends the session id, if any.
+func (s *LoginSessions) Logout(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, hashToken(id))
+}
+
+func (s *LoginSessions) expired(session *loginSession, now time.Time) bool {
+	return now.Sub(session.lastSeen) >= s.idleTimeout || now.Sub(session.created) >= s.maxAge
+}
+
+// sweep forgets ended sessions. The caller must hold mu.
+func (s *LoginSessions) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for hash, session := range s.sessions {
+		if s.expired(session, now) {
+			delete(s.sessions, hash)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestSessions(t *testing.T) (*LoginSessions, *time.Time) {
+	issuer := newTestIssuer(t)
+	s := NewLoginSessions(issuer.users, 30*time.Minute, 2*time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestLoginSessions(t *testing.T) {
+	s, _ := newTestSessions(t)
+
+	if _, _, err := s.Login("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v", err)
+	}
+
+	id, claims, err := s.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if claims.UserID != "user-alice" || claims.IssuedAt == nil {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if got, ok := s.Resolve(id); !ok || got.UserID != "user-alice" {
+		t.Fatalf("Resolve() = %+v, %v", got, ok)
+	}
+	if _, ok := s.Resolve("forged"); ok {
+		t.Error("expected an unknown session to be refused")
+	}
+
+	s.Logout(id)
+	if _, ok := s.Resolve(id); ok {
+		t.Error("expected the session to end on logout")
+	}
+}
+
+func TestLoginSessions_Expiry(t *testing.T) {
+	s, now := newTestSessions(t)
+
+	id, _, err := s.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Activity keeps the session alive past the idle timeout...
+	for i := 0; i < 3; i++ {
+		*now = now.Add(20 * time.Minute)
+		if _, ok := s.Resolve(id); !ok {
+			t.Fatalf("expected the active session to live after %d requests", i+1)
+		}
+	}
+	// ...but not past its maximum age.
+	for i := 0; i < 4; i++ {
+		*now = now.Add(20 * time.Minute)
+		s.Resolve(id)
+	}
+	if _, ok := s.Resolve(id); ok {
+		t.Error("expected the session to end at its maximum age")
+	}
+
+	id, _, err = s.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(31 * time.Minute)
+	if _, ok := s.Resolve(id); ok {
+		t.Error("expected the idle session to end")
+	}
+}
@@ -0,0 +1,125 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// ErrInvalidTicket is returned for malformed, expired and already redeemed
+// WebSocket tickets, and for tickets presented for another session.
+var ErrInvalidTicket = errors.New("invalid WebSocket ticket")
+
+// ticketClaims are the signed contents of a WebSocket ticket: the claims of
+// the token it was exchanged for, and the session it opens.
+type ticketClaims struct {
+	Claims    middleware.Claims `json:"claims"`
+	SessionID string            `json:"session_id"`
+	jwt.RegisteredClaims
+}
+
+// Tickets exchanges access tokens for single-use WebSocket tickets, for
+// browser clients, which cannot set headers on the upgrade request and
+// would otherwise put a long-lived token in the URL, where it ends up in
+// proxy logs and browser history. A ticket opens one connection to one
+// session within ttl, and the connection keeps the claims and expiry of the
+// token it was exchanged for.
+//
+// Tickets are signed with a key derived from the JWT secret, so they are
+// accepted by any instance sharing it but never as access tokens. Which
+// tickets were redeemed is kept in memory, so a ticket could be redeemed
+// once on each instance within its ttl.
+type Tickets struct {
+	key []byte
+	ttl time.Duration
+
+	mu sync.Mutex
+	// redeemed maps the IDs of redeemed tickets to when they expire.
+	redeemed  map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewTickets(secret string, ttl time.Duration) *Tickets {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("neuronai websocket ticket"))
+	return &Tickets{
+		key:      mac.Sum(nil),
+		ttl:      ttl,
+		redeemed: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// TTL is how long a ticket may be redeemed after it is issued.
+func (t *Tickets) TTL() time.Duration {
+	return t.ttl
+}
+
+// Issue signs a ticket opening sessionID with claims. It expires after the
+// ticket TTL, or with claims if they expire sooner.
+func (t *Tickets) Issue(claims *middleware.Claims, sessionID string) (string, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := t.now()
+	exp := now.Add(t.ttl)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(exp) {
+		exp = claims.ExpiresAt.Time
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, ticketClaims{
+		Claims:    *claims,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}).SignedString(t.key)
+}
+
+// Redeem returns the claims of ticket if it is live, opens sessionID and was
+// not redeemed before.
+func (t *Tickets) Redeem(ticket, sessionID string) (*middleware.Claims, error) {
+	var tc ticketClaims
+	_, err := jwt.ParseWithClaims(ticket, &tc, func(*jwt.Token) (interface{}, error) {
+		return t.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(t.now))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTicket, err)
+	}
+	if tc.ID == "" || tc.SessionID != sessionID {
+		return nil, fmt.Errorf("%w: issued for another session", ErrInvalidTicket)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.sweep(now)
+	if _, ok := t.redeemed[tc.ID]; ok {
+		return nil, fmt.Errorf("%w: already redeemed", ErrInvalidTicket)
+	}
+	t.redeemed[tc.ID] = tc.ExpiresAt.Time
+	return &tc.Claims, nil
+}
+
+// sweep forgets redeemed tickets that have expired, at most once per
+// sweepInterval. t.mu must be held.
+func (t *Tickets) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < sweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for id, exp := range t.redeemed {
+		if !now.Before(exp) {
+			delete(t.redeemed, id)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func TestTickets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tickets := NewTickets(testSecret, 30*time.Second)
+	tickets.now = func() time.Time { return now }
+
+	claims := &middleware.Claims{
+		UserID:   "alice",
+		Scopes:   []string{middleware.ScopeChat},
+		TenantID: "acme",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+	ticket, err := tickets.Issue(claims, "s1")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if _, err := middleware.ParseToken(testSecret, ticket); err == nil {
+		t.Error("expected a ticket not to be accepted as an access token")
+	}
+	if _, err := tickets.Redeem(ticket, "s2"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected a ticket for another session to be refused, got %v", err)
+	}
+
+	got, err := tickets.Redeem(ticket, "s1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if got.UserID != "alice" || got.TenantID != "acme" || !got.HasScope(middleware.ScopeChat) ||
+		!got.ExpiresAt.Time.Equal(claims.ExpiresAt.Time) {
+		t.Errorf("expected the token's claims, got %+v", got)
+	}
+	if _, err := tickets.Redeem(ticket, "s1"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected a ticket to be redeemed once, got %v", err)
+	}
+
+	ticket, _ = tickets.Issue(claims, "s1")
+	now = now.Add(30 * time.Second)
+	if _, err := tickets.Redeem(ticket, "s1"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected an expired ticket to be refused, got %v", err)
+	}
+
+	// A ticket does not outlive the token it was exchanged for.
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Second))
+	ticket, _ = tickets.Issue(claims, "s1")
+	now = now.Add(time.Second)
+	if _, err := tickets.Redeem(ticket, "s1"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected a ticket to expire with its token, got %v", err)
+	}
+}
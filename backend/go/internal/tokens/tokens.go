@@ -0,0 +1,228 @@
+// Package tokens issues the gateway's own short-lived access tokens and the
+// rotating refresh tokens that renew them, for deployments without an
+// external identity provider.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown username or a wrong
+	// password.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidRefreshToken is returned for unknown, expired and revoked
+	// refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token is presented
+	// after it was rotated. Its copy may have been stolen, so every token
+	// descended from the same login is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// sweepInterval spaces out removal of expired refresh tokens.
+const sweepInterval = time.Minute
+
+// Pair is the response to a login or refresh.
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	// UpgradedFrom is the guest whose data was handed to the user, if the
+	// login upgraded a guest.
+	UpgradedFrom string `json:"upgraded_from,omitempty"`
+	// UserID is the subject of AccessToken.
+	UserID string `json:"-"`
+}
+
+// refreshToken is the record of an issued refresh token. Tokens rotated from
+// one login share a family.
+type refreshToken struct {
+	family   string
+	username string
+	expires  time.Time
+	// used is set once the token has been exchanged. It is kept until it
+	// expires to detect reuse.
+	used bool
+}
+
+// Issuer signs access tokens with the gateway's JWT secret, so they are
+// accepted wherever its shared-secret tokens are, and keeps refresh tokens in
+// memory: they do not survive a restart and are only valid on the instance
+// that issued them.
+type Issuer struct {
+	signer
+	users      *Users
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu sync.Mutex
+	// refresh is keyed by the SHA-256 of the token, so a memory dump does
+	// not leak usable tokens.
+	refresh   map[string]*refreshToken
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewIssuer(secret string, users *Users, accessTTL, refreshTTL time.Duration, opts ...Option) *Issuer {
+	return &Issuer{
+		signer:     newSigner(secret, opts),
+		users:      users,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		refresh:    make(map[string]*refreshToken),
+		now:        time.Now,
+	}
+}
+
+// Login issues tokens to the user with username and password.
+func (i *Issuer) Login(username, password string) (Pair, error) {
+	user, ok := i.users.Authenticate(username, password)
+	if !ok {
+		return Pair{}, ErrInvalidCredentials
+	}
+	family, err := randomToken()
+	if err != nil {
+		return Pair{}, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.issue(user, family)
+}
+
+// Refresh exchanges refreshToken for new tokens, retiring it.
+func (i *Issuer) Refresh(token string) (Pair, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	rt, ok := i.refresh[hashToken(token)]
+	if !ok || !i.now().Before(rt.expires) {
+		return Pair{}, ErrInvalidRefreshToken
+	}
+	if rt.used {
+		i.revoke(rt.family)
+		return Pair{}, ErrRefreshTokenReused
+	}
+	rt.used = true
+
+	user, ok := i.users.lookup(rt.username)
+	if !ok {
+		i.revoke(rt.family)
+		return Pair{}, ErrInvalidRefreshToken
+	}
+	return i.issue(user, rt.family)
+}
+
+// issue signs an access token for user and records a new refresh token in
+// family. The caller must hold mu.
+func (i *Issuer) issue(user User, family string) (Pair, error) {
+	now := i.now()
+	i.sweep(now)
+
+	// The ID lets operators revoke this token alone.
+	jti, err := randomToken()
+	if err != nil {
+		return Pair{}, err
+	}
+	claims := user.claims(now)
+	claims.ID = jti
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(i.accessTTL))
+	access, err := i.sign(claims)
+	if err != nil {
+		return Pair{}, err
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return Pair{}, err
+	}
+	i.refresh[hashToken(refresh)] = &refreshToken{
+		family:   family,
+		username: user.Username,
+		expires:  now.Add(i.refreshTTL),
+	}
+
+	return Pair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.accessTTL / time.Second),
+		RefreshToken: refresh,
+		UserID:       claims.UserID,
+	}, nil
+}
+
+// revoke forgets every refresh token in family. The caller must hold mu.
+func (i *Issuer) revoke(family string) {
+	for hash, rt := range i.refresh {
+		if rt.family == family {
+			delete(i.refresh, hash)
+		}
+	}
+}
+
+// sweep forgets expired refresh tokens. The caller must hold mu.
+func (i *Issuer) sweep(now time.Time) {
+	if now.Sub(i.lastSweep) < sweepInterval {
+		return
+	}
+	i.lastSweep = now
+	for hash, rt := range i.refresh {
+		if !now.Before(rt.expires) {
+			delete(i.refresh, hash)
+		}
+	}
+}
+
+// Option configures an Issuer or Guests.
+type Option func(*signer)
+
+// WithValidation issues access tokens that meet v, naming its issuer and
+// audience, so that the gateway accepts its own tokens.
+func WithValidation(v middleware.TokenValidation) Option {
+	return func(s *signer) {
+		s.validation = v
+	}
+}
+
+// signer signs the gateway's access tokens with its JWT secret.
+type signer struct {
+	secret     []byte
+	validation middleware.TokenValidation
+}
+
+func newSigner(secret string, opts []Option) signer {
+	s := signer{secret: []byte(secret)}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+func (s *signer) sign(claims middleware.Claims) (string, error) {
+	s.validation.Stamp(&claims)
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,166 @@
+package tokens
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+const testSecret = "test-secret-key"
+
+func newTestIssuer(t *testing.T, opts ...Option) *Issuer {
+	users, err := NewUsers([]User{{
+		Username:     "alice",
+		PasswordHash: HashPasswordWith("hunter2", []byte("0123456789abcdef"), 1000),
+		UserID:       "user-alice",
+		Email:        "alice@example.com",
+	}})
+	if err != nil {
+		t.Fatalf("NewUsers() error = %v", err)
+	}
+	return NewIssuer(testSecret, users, 15*time.Minute, time.Hour, opts...)
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors for PBKDF2-HMAC-SHA256 with a 32-byte key.
+	tests := []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(pbkdf2("password", []byte("salt"), tt.iterations)); got != tt.want {
+			t.Errorf("pbkdf2(%d) = %s, want %s", tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestIssuer_Login(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	if _, err := issuer.Login("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v", err)
+	}
+	if _, err := issuer.Login("mallory", "hunter2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with unknown user error = %v", err)
+	}
+
+	pair, err := issuer.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != 900 || pair.RefreshToken == "" {
+		t.Errorf("unexpected pair %+v", pair)
+	}
+
+	claims, err := middleware.ParseToken(testSecret, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	if claims.UserID != "user-alice" || claims.Email != "alice@example.com" || claims.ID == "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestIssuer_RefreshRotates(t *testing.T) {
+	issuer := newTestIssuer(t)
+	first, err := issuer.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	second, err := issuer.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("expected a new refresh token")
+	}
+	if _, err := middleware.ParseToken(testSecret, second.AccessToken); err != nil {
+		t.Errorf("ParseToken() error = %v", err)
+	}
+
+	// Presenting the rotated token again revokes the whole family, including
+	// the token it was exchanged for.
+	if _, err := issuer.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh() with reused token error = %v", err)
+	}
+	if _, err := issuer.Refresh(second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() after reuse error = %v", err)
+	}
+
+	// Other logins are unaffected.
+	other, err := issuer.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, err := issuer.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("Refresh() of another login error = %v", err)
+	}
+}
+
+func TestIssuer_RefreshExpires(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+
+	pair, err := issuer.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := issuer.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() of expired token error = %v", err)
+	}
+	if _, err := issuer.Refresh("made-up"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() of unknown token error = %v", err)
+	}
+}
+
+func TestNewUsers_Validation(t *testing.T) {
+	hash := HashPasswordWith("pw", []byte("salt"), 10)
+	tests := []struct {
+		name  string
+		users []User
+	}{
+		{"missing username", []User{{PasswordHash: hash}}},
+		{"plaintext password", []User{{Username: "bob", PasswordHash: "pw"}}},
+		{"duplicate", []User{{Username: "bob", PasswordHash: hash}, {Username: "bob", PasswordHash: hash}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewUsers(tt.users); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestIssuer_Validation(t *testing.T) {
+	v := middleware.TokenValidation{Issuer: "https://gateway.example.com", Audience: "neuronai", RequireNotBefore: true}
+	pair, err := newTestIssuer(t, WithValidation(v)).Login("alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := middleware.ParseToken(testSecret, pair.AccessToken, middleware.WithTokenValidation(v)); err != nil {
+		t.Errorf("expected issued tokens to meet the validation, got %v", err)
+	}
+
+	guest, err := NewGuests(testSecret, time.Hour, "guest", WithValidation(v)).Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := middleware.ParseToken(testSecret, guest.AccessToken, middleware.WithTokenValidation(v)); err != nil {
+		t.Errorf("expected guest tokens to meet the validation, got %v", err)
+	}
+
+	pair, _ = newTestIssuer(t).Login("alice", "hunter2")
+	if _, err := middleware.ParseToken(testSecret, pair.AccessToken, middleware.WithTokenValidation(v)); err == nil {
+		t.Error("expected a token without issuer and audience to be refused")
+	}
+}
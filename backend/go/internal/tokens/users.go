@@ -0,0 +1,171 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// Passwords are stored as "pbkdf2-sha256$<iterations>$<salt>$<key>", with
+// salt and key base64-encoded.
+const (
+	hashScheme = "pbkdf2-sha256"
+	// DefaultIterations is the PBKDF2 work factor HashPassword uses.
+	DefaultIterations = 600000
+	saltSize          = 16
+)
+
+// User is an account as stored at rest: only a hash of its password is kept.
+type User struct {
+	Username string `json:"username"`
+	// PasswordHash is the output of HashPassword.
+	PasswordHash string `json:"password_hash"`
+	// UserID is the subject of the user's tokens. It defaults to the
+	// username.
+	UserID string `json:"user_id,omitempty"`
+	Email  string `json:"email,omitempty"`
+	// Scopes limit the user's tokens; none grants every scope.
+	Scopes []string `json:"scopes,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// claims returns the claims of user's credentials issued at now.
+func (u User) claims(now time.Time) middleware.Claims {
+	return middleware.Claims{
+		UserID: u.UserID,
+		Email:  u.Email,
+		Scopes: slices.Clone(u.Scopes),
+		Roles:  slices.Clone(u.Roles),
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+	}
+}
+
+// Users authenticates accounts by username and password.
+type Users struct {
+	byName map[string]User
+}
+
+func NewUsers(users []User) (*Users, error) {
+	u := &Users{byName: make(map[string]User, len(users))}
+	for _, user := range users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("user has no username")
+		}
+		if _, _, _, err := parseHash(user.PasswordHash); err != nil {
+			return nil, fmt.Errorf("user %q: %w", user.Username, err)
+		}
+		if _, ok := u.byName[user.Username]; ok {
+			return nil, fmt.Errorf("user %q is listed twice", user.Username)
+		}
+		if user.UserID == "" {
+			user.UserID = user.Username
+		}
+		u.byName[user.Username] = user
+	}
+	return u, nil
+}
+
+// LoadUsers reads a JSON array of users from path.
+func LoadUsers(path string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %w", err)
+	}
+	return NewUsers(users)
+}
+
+// Authenticate returns the user with username if password is theirs.
+func (u *Users) Authenticate(username, password string) (User, bool) {
+	user, ok := u.byName[username]
+	if !ok {
+		// Spend the same time as for a wrong password, so usernames cannot
+		// be probed by timing.
+		HashPasswordWith(password, make([]byte, saltSize), DefaultIterations)
+		return User{}, false
+	}
+	iterations, salt, key, _ := parseHash(user.PasswordHash)
+	if subtle.ConstantTimeCompare(pbkdf2(password, salt, iterations), key) != 1 {
+		return User{}, false
+	}
+	return user, true
+}
+
+// lookup returns the user with username, as when refreshing their tokens.
+func (u *Users) lookup(username string) (User, bool) {
+	user, ok := u.byName[username]
+	return user, ok
+}
+
+// HashPassword returns the hash password is stored by, with a random salt.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return HashPasswordWith(password, salt, DefaultIterations), nil
+}
+
+// HashPasswordWith returns the hash of password with salt and iterations.
+func HashPasswordWith(password string, salt []byte, iterations int) string {
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(pbkdf2(password, salt, iterations)),
+	}, "$")
+}
+
+func parseHash(hash string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, fmt.Errorf("password hash must be %s; see HashPassword", hashScheme)
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, fmt.Errorf("invalid password hash iterations %q", parts[1])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return 0, nil, nil, fmt.Errorf("invalid password hash salt: %w", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(key) != sha256.Size {
+		return 0, nil, nil, fmt.Errorf("invalid password hash key")
+	}
+	return iterations, salt, key, nil
+}
+
+// pbkdf2 derives a single-block PBKDF2-HMAC-SHA256 key, as in RFC 8018.
+func pbkdf2(password string, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, []byte(password))
+	prf.Write(salt)
+	prf.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,164 @@
+// Package userinfo looks callers up in the user service, which owns their
+// tenant, plan and scopes and whether they may sign in, so that changes made
+// there apply to tokens already issued.
+package userinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+// maxCacheEntries bounds the users Service caches; beyond it expired
+// entries are swept, and if that is not enough the cache is reset.
+const maxCacheEntries = 10000
+
+// User is the user service's record of a user. Empty fields leave the
+// token's claims as they are.
+type User struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	Plan     string `json:"plan,omitempty"`
+	// Scopes are those the user is granted now; see Service.Enrich.
+	Scopes   []string `json:"scopes,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// Service fetches users from GET <url>/<user_id>, which answers a User, or
+// 404 for users it does not manage. Answers are cached for cacheTTL, so a
+// change in the user service takes effect within cacheTTL.
+type Service struct {
+	url      string
+	client   *http.Client
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// cached is a lookup, with found false for a user the service does not
+// manage, and when it must be made again.
+type cached struct {
+	user    User
+	found   bool
+	expires time.Time
+}
+
+func New(url string, cacheTTL time.Duration) *Service {
+	return &Service{
+		url:      strings.TrimSuffix(url, "/"),
+		client:   &http.Client{},
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cached),
+	}
+}
+
+// Lookup returns the user with userID, or false if the service does not
+// manage them.
+func (s *Service) Lookup(ctx context.Context, userID string) (User, bool, error) {
+	s.mu.Lock()
+	c, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && s.now().Before(c.expires) {
+		return c.user, c.found, nil
+	}
+
+	user, found, err := s.fetch(ctx, userID)
+	if err != nil {
+		return User{}, false, err
+	}
+	s.store(userID, cached{user: user, found: found, expires: s.now().Add(s.cacheTTL)})
+	return user, found, nil
+}
+
+// Enrich implements middleware.ClaimsEnricher. Disabled users are refused
+// with middleware.ErrUserDisabled. The user's tenant and plan replace the
+// token's. A token without scopes gets the user's; one with scopes keeps
+// those the user is still granted, and is refused if none are left. Users
+// the service does not manage keep their token's claims.
+func (s *Service) Enrich(ctx context.Context, claims *middleware.Claims) error {
+	user, found, err := s.Lookup(ctx, claims.UserID)
+	if err != nil || !found {
+		return err
+	}
+	if user.Disabled {
+		return middleware.ErrUserDisabled
+	}
+
+	if user.TenantID != "" {
+		claims.TenantID = user.TenantID
+	}
+	if user.Plan != "" {
+		claims.Plan = user.Plan
+	}
+	if len(user.Scopes) == 0 {
+		return nil
+	}
+	if len(claims.Scopes) == 0 {
+		claims.Scopes = slices.Clone(user.Scopes)
+		return nil
+	}
+	claims.Scopes = slices.DeleteFunc(claims.Scopes, func(scope string) bool {
+		return !middleware.GrantsScope(user.Scopes, scope)
+	})
+	if len(claims.Scopes) == 0 {
+		// Unscoped claims may use every scope.
+		return fmt.Errorf("%w: no scope of the token is granted", middleware.ErrUserDisabled)
+	}
+	return nil
+}
+
+func (s *Service) fetch(ctx context.Context, userID string) (User, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return User{}, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return User{}, false, fmt.Errorf("user service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return User{}, false, nil
+	default:
+		return User{}, false, fmt.Errorf("user service returned status %d", resp.StatusCode)
+	}
+
+	var user User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return User{}, false, fmt.Errorf("invalid user service response: %w", err)
+	}
+	return user, true, nil
+}
+
+func (s *Service) store(userID string, c cached) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cache) >= maxCacheEntries {
+		now := s.now()
+		for k, v := range s.cache {
+			if !now.Before(v.expires) {
+				delete(s.cache, k)
+			}
+		}
+		if len(s.cache) >= maxCacheEntries {
+			s.cache = make(map[string]cached)
+		}
+	}
+	s.cache[userID] = c
+}
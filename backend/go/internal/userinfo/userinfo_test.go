@@ -0,0 +1,100 @@
+package userinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+func TestService_Enrich(t *testing.T) {
+	users := map[string]User{
+		"alice":  {TenantID: "acme", Plan: "pro", Scopes: []string{"chat", "sessions"}},
+		"bob":    {Disabled: true},
+		"carol":  {Scopes: []string{"sessions"}},
+		"broken": {},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[len("/users/"):]
+		if id == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		user, ok := users[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}))
+	defer srv.Close()
+	s := New(srv.URL+"/users/", time.Minute)
+
+	tests := []struct {
+		name    string
+		claims  middleware.Claims
+		want    middleware.Claims
+		wantErr error
+	}{
+		{"unscoped token", middleware.Claims{UserID: "alice"},
+			middleware.Claims{UserID: "alice", TenantID: "acme", Plan: "pro", Scopes: []string{"chat", "sessions"}}, nil},
+		{"scoped token", middleware.Claims{UserID: "alice", Scopes: []string{"chat", "admin"}},
+			middleware.Claims{UserID: "alice", TenantID: "acme", Plan: "pro", Scopes: []string{"chat"}}, nil},
+		{"narrower scope of a granted resource", middleware.Claims{UserID: "alice", Scopes: []string{"chat:write", "swarm:execute"}},
+			middleware.Claims{UserID: "alice", TenantID: "acme", Plan: "pro", Scopes: []string{"chat:write"}}, nil},
+		{"disabled", middleware.Claims{UserID: "bob"}, middleware.Claims{UserID: "bob"}, middleware.ErrUserDisabled},
+		{"no scope left", middleware.Claims{UserID: "carol", Scopes: []string{"chat"}}, middleware.Claims{UserID: "carol"}, middleware.ErrUserDisabled},
+		{"unmanaged", middleware.Claims{UserID: "dave", TenantID: "t1"}, middleware.Claims{UserID: "dave", TenantID: "t1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			err := s.Enrich(context.Background(), &claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enrich() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(claims, tt.want) {
+				t.Errorf("claims = %+v, want %+v", claims, tt.want)
+			}
+		})
+	}
+
+	claims := middleware.Claims{UserID: "broken"}
+	if err := s.Enrich(context.Background(), &claims); err == nil || errors.Is(err, middleware.ErrUserDisabled) {
+		t.Errorf("expected a user service error, got %v", err)
+	}
+}
+
+func TestService_Cache(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(User{Plan: "pro"})
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	s := New(srv.URL, time.Minute)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.Lookup(context.Background(), "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected lookups to be cached, got %d requests", requests)
+	}
+
+	now = now.Add(time.Minute)
+	s.Lookup(context.Background(), "alice")
+	if requests != 2 {
+		t.Errorf("expected the cache to expire, got %d requests", requests)
+	}
+}
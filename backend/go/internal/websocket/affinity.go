@@ -0,0 +1,214 @@
+package websocket
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// Behind a round-robin load balancer a reconnecting client rarely lands on
+// the instance it was connected to, and sequence numbers are assigned by each
+// instance's replay buffer, so its resume position means nothing elsewhere.
+// When the hub has a backplane and a replay buffer, envelope clients are sent
+// an affinity token naming their instance as they connect, and reconnect with
+// it alongside resume. Another instance asks the owning one over the
+// backplane how many session messages the client missed and replays as many
+// from its own buffer, which holds the same messages: every instance receives
+// the session's messages through the backplane.
+
+// affinityWait bounds how long a reconnect waits for the owning instance to
+// answer. It may be gone, which is often why the client reconnected.
+const affinityWait = time.Second
+
+// unknownSeq is a resume position ahead of every replay buffer, so the resume
+// reports lost messages when the owning instance could not translate it.
+const unknownSeq = math.MaxUint64
+
+// affinityEvent hands a client its affinity token.
+type affinityEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+}
+
+// Instance messages exchanged over the backplane to translate a resume
+// position: a missedQuery asks the owning instance how many messages of
+// SessionID followed Seq, answered by a missedReply to ReplyTo.
+const (
+	opMissedQuery = "missed_query"
+	opMissedReply = "missed_reply"
+)
+
+type instanceMessage struct {
+	Op        string `json:"op"`
+	ID        string `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+	Seq       uint64 `json:"seq,omitempty"`
+	ReplyTo   string `json:"reply_to,omitempty"`
+	Missed    uint64 `json:"missed,omitempty"`
+	Known     bool   `json:"known,omitempty"`
+}
+
+// affinityQueries tracks the missed queries awaiting a reply.
+type affinityQueries struct {
+	mu      sync.Mutex
+	next    uint64
+	pending map[string]chan instanceMessage
+}
+
+func (q *affinityQueries) add() (string, chan instanceMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = make(map[string]chan instanceMessage)
+	}
+	q.next++
+	id := strconv.FormatUint(q.next, 10)
+	ch := make(chan instanceMessage, 1)
+	q.pending[id] = ch
+	return id, ch
+}
+
+func (q *affinityQueries) remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, id)
+}
+
+// resolve hands reply to its query, if still waiting.
+func (q *affinityQueries) resolve(reply instanceMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if ch, ok := q.pending[reply.ID]; ok {
+		ch <- reply
+		delete(q.pending, reply.ID)
+	}
+}
+
+// affinityEnabled reports whether clients are given affinity tokens.
+func (h *Hub) affinityEnabled() bool {
+	return h.backplane != nil && h.replaySize > 0
+}
+
+// signAffinity returns the affinity token binding userID's connection to
+// sessionID on this instance: the instance ID and a MAC over it, keyed by the
+// JWT secret.
+func (h *Hub) signAffinity(userID, sessionID string) string {
+	instance := h.backplane.Instance()
+	return instance + "." + base64.RawURLEncoding.EncodeToString(h.affinityMAC(instance, userID, sessionID))
+}
+
+// parseAffinity returns the instance named by token, if it was issued by a
+// hub sharing the JWT secret for the same user and session.
+func (h *Hub) parseAffinity(token, userID, sessionID string) (string, bool) {
+	instance, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, h.affinityMAC(instance, userID, sessionID)) {
+		return "", false
+	}
+	return instance, true
+}
+
+func (h *Hub) affinityMAC(instance, userID, sessionID string) []byte {
+	mac := hmac.New(sha256.New, []byte(h.jwtSecret))
+	mac.Write([]byte("affinity\x00" + instance + "\x00" + userID + "\x00" + sessionID))
+	return mac.Sum(nil)
+}
+
+// resumeSeq translates lastSeq, a resume position on the instance named by
+// the affinity token, to this instance's replay buffer. A missing or invalid
+// token, or one naming this instance, leaves lastSeq as it is.
+func (h *Hub) resumeSeq(ctx context.Context, token, userID, sessionID string, lastSeq uint64) uint64 {
+	if token == "" || !h.affinityEnabled() {
+		return lastSeq
+	}
+	owner, ok := h.parseAffinity(token, userID, sessionID)
+	if !ok || owner == h.backplane.Instance() {
+		return lastSeq
+	}
+
+	missed, ok := h.queryMissed(ctx, owner, sessionID, lastSeq)
+	if !ok {
+		return unknownSeq
+	}
+	s := h.shardFor(sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq, ok := s.replay.translate(sessionID, missed)
+	if !ok {
+		return unknownSeq
+	}
+	return seq
+}
+
+// queryMissed asks owner how many messages of sessionID followed seq. ok is
+// false if it did not know or did not answer within affinityWait.
+func (h *Hub) queryMissed(ctx context.Context, owner, sessionID string, seq uint64) (missed uint64, ok bool) {
+	id, replies := h.affinity.add()
+	defer h.affinity.remove(id)
+
+	data, _ := json.Marshal(instanceMessage{
+		Op:        opMissedQuery,
+		ID:        id,
+		SessionID: sessionID,
+		Seq:       seq,
+		ReplyTo:   h.backplane.Instance(),
+	})
+	if err := h.backplane.PublishInstance(ctx, owner, data); err != nil {
+		h.log.WarnContext(ctx, "Backplane publish failed", "instance", owner, logging.Err(err))
+		return 0, false
+	}
+
+	timer := time.NewTimer(affinityWait)
+	defer timer.Stop()
+	select {
+	case reply := <-replies:
+		return reply.Missed, reply.Known
+	case <-timer.C:
+		return 0, false
+	case <-ctx.Done():
+		return 0, false
+	}
+}
+
+// handleInstanceMessage answers a missed query from another instance or
+// resolves one of ours.
+func (h *Hub) handleInstanceMessage(data []byte) {
+	var msg instanceMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		h.log.Warn("Dropping malformed backplane instance message", logging.Err(err))
+		return
+	}
+
+	switch msg.Op {
+	case opMissedReply:
+		h.affinity.resolve(msg)
+	case opMissedQuery:
+		reply := instanceMessage{Op: opMissedReply, ID: msg.ID}
+		if h.replaySize > 0 {
+			s := h.shardFor(msg.SessionID)
+			s.mu.Lock()
+			reply.Missed, reply.Known = s.replay.missed(msg.SessionID, msg.Seq)
+			s.mu.Unlock()
+		}
+		data, _ := json.Marshal(reply)
+		// Publish off the subscription, which must keep draining.
+		go func() {
+			if err := h.backplane.PublishInstance(context.Background(), msg.ReplyTo, data); err != nil {
+				h.log.Warn("Backplane publish failed", "instance", msg.ReplyTo, logging.Err(err))
+			}
+		}()
+	}
+}
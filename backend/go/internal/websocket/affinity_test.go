@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_AffinityResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	planes := newMemoryBackplanes(2)
+	hubs := make([]*Hub, 2)
+	for i := range hubs {
+		hubs[i] = NewHub(nil, WithJWTSecret(testSecret), WithBackplane(planes[i]), WithReplayBuffer(16, time.Minute))
+		go hubs[i].Run(ctx)
+		waitForBackplane(t, planes[i])
+	}
+	h1, h2 := hubs[0], hubs[1]
+	srv1, srv2 := newHubServer(t, h1), newHubServer(t, h2)
+
+	// Offset the second instance's sequence numbers with messages only it
+	// has seen.
+	h2.sendToLocalSession("s1", "", &sessionMessage{json: []byte(`"x"`)})
+	h2.sendToLocalSession("s1", "", &sessionMessage{json: []byte(`"y"`)})
+
+	token := signToken(t, testSecret, "user-1")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv1, "session_id=s1&v=1&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	var ev affinityEvent
+	if err := json.Unmarshal(readEnvelopes(t, conn, 1)[0].Payload, &ev); err != nil || ev.Event != "affinity" || ev.Token == "" {
+		t.Fatalf("expected affinity event, got %+v (%v)", ev, err)
+	}
+	waitForSession(t, h1, "user-1", "s1")
+
+	for _, msg := range []string{`"a"`, `"b"`, `"c"`} {
+		h1.SendToSession("s1", []byte(msg))
+	}
+	if envs := readEnvelopes(t, conn, 3); envs[0].Seq != 1 || envs[2].Seq != 3 {
+		t.Fatalf("unexpected messages %+v", envs)
+	}
+	conn.Close()
+
+	// The client saw only "a" before the connection dropped, and reconnects
+	// to the other instance.
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL(srv2, "session_id=s1&v=1&resume=1&affinity="+ev.Token+"&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	envs := readEnvelopes(t, conn, 4)
+	for i, want := range []string{`"b"`, `"c"`} {
+		if env := envs[i+1]; env.Seq != uint64(i+4) || string(env.Payload) != want {
+			t.Errorf("unexpected replayed frame %d: %+v", i, env)
+		}
+	}
+	var resumed resumedEvent
+	json.Unmarshal(envs[3].Payload, &resumed)
+	if resumed.Event != "resumed" || resumed.Seq != 5 || resumed.Replayed != 2 || !resumed.Complete {
+		t.Errorf("unexpected resumed event %+v", resumed)
+	}
+
+	// A position the owning instance does not know is reported lost.
+	other := h1.signAffinity("user-1", "s2")
+	if seq := h2.resumeSeq(ctx, other, "user-1", "s2", 7); seq != unknownSeq {
+		t.Errorf("expected unknown position, got %d", seq)
+	}
+}
+
+func TestHub_ParseAffinity(t *testing.T) {
+	h := NewHub(nil, WithJWTSecret(testSecret), WithBackplane(newMemoryBackplanes(1)[0]), WithReplayBuffer(16, time.Minute))
+	token := h.signAffinity("user-1", "s1")
+
+	if instance, ok := h.parseAffinity(token, "user-1", "s1"); !ok || instance != "instance-0" {
+		t.Errorf("expected token for instance-0, got %q, %v", instance, ok)
+	}
+	for _, tt := range []struct{ token, userID, sessionID string }{
+		{token, "user-2", "s1"},
+		{token, "user-1", "s2"},
+		{"instance-1" + token[len("instance-0"):], "user-1", "s1"},
+		{"instance-0", "user-1", "s1"},
+		{"instance-0.!!", "user-1", "s1"},
+	} {
+		if _, ok := h.parseAffinity(tt.token, tt.userID, tt.sessionID); ok {
+			t.Errorf("expected %q rejected for %s in %s", tt.token, tt.userID, tt.sessionID)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/audit"
+)
+
+// WithAudit records connections opening and closing, authentication failures
+// and control commands to sink.
+func WithAudit(sink audit.Sink) Option {
+	return func(h *Hub) {
+		h.audit = sink
+	}
+}
+
+// recordAudit stamps e as a typ event and hands it to the audit sink, if any.
+func (h *Hub) recordAudit(typ audit.Type, e audit.Event) {
+	if h.audit == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Type = typ
+	h.audit.Record(e)
+}
+
+// recordAuthFailure records a connection from r rejected for reason.
+func (h *Hub) recordAuthFailure(r *http.Request, sessionID, reason string) {
+	e := audit.RequestPeer(r)
+	e.SessionID = sessionID
+	e.Reason = reason
+	h.recordAudit(audit.TypeAuthFailure, e)
+}
+
+// auditEvent returns an audit event identifying c.
+func (c *Client) auditEvent() audit.Event {
+	e := c.peer
+	e.UserID = c.userID
+	e.SessionID = c.sessionID
+	return e
+}
+
+// recordControl records a control command other than ping, which clients
+// send to keep their connection alive.
+func (c *Client) recordControl(ctrl controlMessage) {
+	if ctrl.Action == "ping" {
+		return
+	}
+	e := c.auditEvent()
+	e.Action = ctrl.Action
+	switch {
+	case ctrl.StreamID != "":
+		e.Target = ctrl.StreamID
+	case ctrl.Channel != "":
+		e.Target = ctrl.Channel
+	case ctrl.Agent != "":
+		e.Target = ctrl.Agent
+	}
+	c.hub.recordAudit(audit.TypeControl, e)
+}
+
+// recordDisconnect records the connection closing, with its duration and the
+// bytes it carried.
+func (c *Client) recordDisconnect() {
+	e := c.auditEvent()
+	e.DurationMillis = time.Since(c.connectedAt).Milliseconds()
+	e.BytesIn = c.bytesIn.Load()
+	e.BytesOut = c.bytesOut.Load()
+	c.hub.recordAudit(audit.TypeDisconnect, e)
+}
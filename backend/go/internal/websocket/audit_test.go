@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/audit"
+)
+
+// recordingSink collects audit events.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *recordingSink) Record(e audit.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// waitFor polls until an event of type typ was recorded and returns it.
+func (s *recordingSink) waitFor(t *testing.T, typ audit.Type) audit.Event {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		for _, e := range s.events {
+			if e.Type == typ {
+				s.mu.Unlock()
+				return e
+			}
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected a %s audit event", typ)
+	return audit.Event{}
+}
+
+func TestHub_Audit(t *testing.T) {
+	sink := &recordingSink{}
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithAudit(sink))
+
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token=forged"), nil); err == nil {
+		t.Fatal("expected dial with a forged token to fail")
+	}
+	failure := sink.waitFor(t, audit.TypeAuthFailure)
+	if failure.SessionID != "s1" || failure.Reason == "" || failure.RemoteAddr == "" {
+		t.Errorf("unexpected auth failure event %+v", failure)
+	}
+
+	header := http.Header{"User-Agent": {"neuronai-ios/2.3"}, "X-Forwarded-For": {"203.0.113.7"}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), header)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	waitForSession(t, h, "user-1", "s1")
+
+	connect := sink.waitFor(t, audit.TypeConnect)
+	if connect.UserID != "user-1" || connect.UserAgent != "neuronai-ios/2.3" || connect.ForwardedFor != "203.0.113.7" {
+		t.Errorf("unexpected connect event %+v", connect)
+	}
+
+	for _, frame := range []string{
+		`{"v":1,"type":"control","id":"1","payload":{"action":"ping"}}`,
+		`{"v":1,"type":"control","id":"2","payload":{"action":"cancel","stream_id":"c-9"}}`,
+	} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatalf("Failed to write frame: %v", err)
+		}
+	}
+	readEnvelopes(t, conn, 2)
+	control := sink.waitFor(t, audit.TypeControl)
+	if control.Action != "cancel" || control.Target != "c-9" || control.UserID != "user-1" {
+		t.Errorf("unexpected control event %+v", control)
+	}
+
+	conn.Close()
+	disconnect := sink.waitFor(t, audit.TypeDisconnect)
+	if disconnect.UserID != "user-1" || disconnect.BytesIn == 0 || disconnect.BytesOut == 0 {
+		t.Errorf("unexpected disconnect event %+v", disconnect)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	for _, e := range sink.events {
+		if e.Type == audit.TypeControl && e.Action == "ping" {
+			t.Error("expected pings not to be audited")
+		}
+		if e.Time.IsZero() {
+			t.Errorf("expected event %+v timestamped", e)
+		}
+	}
+}
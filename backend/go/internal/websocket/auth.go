@@ -0,0 +1,289 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/grpc"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+const (
+	// authWait bounds how long a connection may stay open without
+	// authenticating when no token was presented on the upgrade request.
+	authWait = 10 * time.Second
+	// maxAuthFrameSize bounds the auth frame, read before the client is
+	// authenticated. It holds only a token and a client description.
+	maxAuthFrameSize = 16 * 1024
+
+	// authSubprotocol is offered by browser clients together with the token
+	// as a second Sec-WebSocket-Protocol value, since they cannot set an
+	// Authorization header on the upgrade request.
+	authSubprotocol = "bearer"
+
+	closeUnauthorized = 4401
+)
+
+// authFrame is the first frame a client sends when it did not present a
+// token on the upgrade request.
+type authFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+	// Client optionally describes the client app, for clients that cannot
+	// set the X-Client-* headers.
+	Client *grpc.ClientInfo `json:"client,omitempty"`
+}
+
+// authenticatedEvent acknowledges a successful auth frame.
+type authenticatedEvent struct {
+	Event     string `json:"event"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// requestToken returns the token presented on the upgrade request, from the
+// Sec-WebSocket-Protocol header or the token query parameter, and whether it
+// came from the subprotocol header.
+func requestToken(r *http.Request) (string, bool) {
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == authSubprotocol {
+			return protocols[i+1], true
+		}
+	}
+	return r.URL.Query().Get("token"), false
+}
+
+// sameOrigin reports whether the upgrade request r comes from a page served
+// by the gateway's own host. Requests without an Origin header are not from
+// browsers and carry no ambient cookies worth trusting.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// TicketRedeemer redeems the single-use tickets browser clients exchange
+// their token for to open a connection without putting it in the URL.
+type TicketRedeemer interface {
+	Redeem(ticket, sessionID string) (*middleware.Claims, error)
+}
+
+// redeemTicket returns the claims of a ticket opening sessionID.
+func (h *Hub) redeemTicket(ticket, sessionID string) (*middleware.Claims, error) {
+	if h.tickets == nil {
+		return nil, fmt.Errorf("tickets are not enabled")
+	}
+	claims, err := h.tickets.Redeem(ticket, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Guest && !h.guests {
+		return nil, fmt.Errorf("guest access is not allowed")
+	}
+	return claims, nil
+}
+
+func (h *Hub) parseToken(token string) (*middleware.Claims, error) {
+	claims, err := middleware.ParseToken(h.jwtSecret, token, h.authOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	if claims.Guest && !h.guests {
+		return nil, fmt.Errorf("guest access is not allowed")
+	}
+	return claims, nil
+}
+
+// authenticateFrame reads the auth frame from a connection that presented no
+// token on upgrade and acknowledges it. It also returns the client
+// description the frame carried, if any.
+func (h *Hub) authenticateFrame(conn *websocket.Conn, sessionID string) (*middleware.Claims, grpc.ClientInfo, error) {
+	conn.SetReadDeadline(time.Now().Add(authWait))
+	conn.SetReadLimit(maxAuthFrameSize)
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, grpc.ClientInfo{}, fmt.Errorf("no auth frame: %w", err)
+	}
+
+	var frame authFrame
+	if err := json.Unmarshal(data, &frame); err != nil || frame.Type != "auth" {
+		return nil, grpc.ClientInfo{}, fmt.Errorf("expected auth frame")
+	}
+
+	claims, err := h.parseToken(frame.Token)
+	if err != nil {
+		return nil, grpc.ClientInfo{}, err
+	}
+	var info grpc.ClientInfo
+	if frame.Client != nil {
+		info = frame.Client.Sanitize()
+	}
+
+	// Marshal rather than WriteJSON, which would end the frame with a
+	// newline that clients splitting coalesced frames read as an empty
+	// message.
+	data, _ = json.Marshal(authenticatedEvent{
+		Event:     "authenticated",
+		UserID:    claims.UserID,
+		SessionID: sessionID,
+	})
+	conn.SetWriteDeadline(time.Now().Add(h.writeWait))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return nil, grpc.ClientInfo{}, err
+	}
+	return claims, info, nil
+}
+
+// rejectConn closes an upgraded connection that failed to authenticate.
+func (h *Hub) rejectConn(conn *websocket.Conn, reason string) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeUnauthorized, reason),
+		time.Now().Add(h.writeWait))
+	conn.Close()
+}
+
+// Envelope clients keep a connection open past their token's expiry by
+// sending a refresh_auth control action with a new token for the same user.
+// The write pump warns them with an auth_expiring control event
+// authWarning before the token expires, and closes the connection with
+// closeUnauthorized if it expires anyway. Legacy clients cannot send control
+// actions, so their connections outlive their tokens as before.
+
+// defaultAuthWarning is how long before a connection's token expires the
+// client is asked to refresh it.
+const defaultAuthWarning = time.Minute
+
+// ErrCodeUnauthorized rejects a refresh_auth whose token is invalid or for
+// another user.
+const ErrCodeUnauthorized = "UNAUTHORIZED"
+
+// authExpiringEvent asks a client to refresh its token before ExpiresAt.
+type authExpiringEvent struct {
+	Event     string    `json:"event"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expiry returns when the client's token expires, or the zero time if it does
+// not or the client cannot refresh it.
+func (c *Client) expiry() time.Time {
+	claims := c.claims.Load()
+	if claims == nil || claims.ExpiresAt == nil || c.protocol == protocolLegacy {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
+
+// tenant returns the tenant the client's chats are charged to, from its
+// token's tenant_id claim.
+func (c *Client) tenant() string {
+	if claims := c.claims.Load(); claims != nil {
+		return claims.TenantID
+	}
+	return ""
+}
+
+// priority is the scheduling priority of the connection's chats.
+func (c *Client) priority() middleware.Priority {
+	if claims := c.claims.Load(); claims != nil {
+		return claims.Priority()
+	}
+	return middleware.PriorityFree
+}
+
+// refreshAuth handles a refresh_auth control action, replacing the
+// connection's claims with those of token.
+func (c *Client) refreshAuth(id, token string) {
+	if token == "" {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("token is required"))
+		return
+	}
+	claims, err := c.hub.parseToken(token)
+	if err == nil && claims.UserID != c.userID {
+		err = fmt.Errorf("token is for another user")
+	}
+	if err != nil {
+		e := c.auditEvent()
+		e.Reason = "refresh_auth: " + err.Error()
+		c.hub.recordAudit(audit.TypeAuthFailure, e)
+		c.sendError(id, ErrCodeUnauthorized, err)
+		return
+	}
+
+	c.claims.Store(claims)
+	select {
+	case c.reauth <- struct{}{}:
+	default:
+	}
+	payload, _ := json.Marshal(controlMessage{Action: "auth_refreshed"})
+	c.push(c.frame(TypeControl, id, payload))
+}
+
+// expiryTimer fires when the write pump must next act on the client's token
+// expiry: first to warn the client, then to close the connection.
+type expiryTimer struct {
+	timer *time.Timer
+	C     <-chan time.Time
+	// warned is the expiry the client was last warned about.
+	warned time.Time
+}
+
+// reset arms t for the client's current expiry, if any.
+func (t *expiryTimer) reset(c *Client) {
+	t.stop()
+	exp := c.expiry()
+	if exp.IsZero() {
+		return
+	}
+	at := exp
+	if !t.warned.Equal(exp) {
+		at = exp.Add(-c.hub.authWarning)
+	}
+	t.timer = time.NewTimer(time.Until(at))
+	t.C = t.timer.C
+}
+
+func (t *expiryTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer, t.C = nil, nil
+	}
+}
+
+// checkExpiry warns the client that its token is about to expire, or closes
+// the connection if it has. It must only be called by the write pump, and an
+// error ends it.
+func (c *Client) checkExpiry(t *expiryTimer) error {
+	exp := c.expiry()
+	now := time.Now()
+	switch {
+	case exp.IsZero() || now.Before(exp.Add(-c.hub.authWarning)):
+		// The token was refreshed since t was armed.
+	case !now.Before(exp):
+		c.conn.SetWriteDeadline(now.Add(c.hub.writeWait))
+		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeUnauthorized, "token expired"))
+		return fmt.Errorf("token expired")
+	default:
+		t.warned = exp
+		data, _ := json.Marshal(authExpiringEvent{Event: "auth_expiring", SessionID: c.sessionID, ExpiresAt: exp})
+		c.conn.SetWriteDeadline(now.Add(c.hub.writeWait))
+		if err := c.write(c.frame(TypeControl, "", data)); err != nil {
+			return err
+		}
+	}
+	t.reset(c)
+	return nil
+}
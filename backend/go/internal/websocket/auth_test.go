@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/middleware"
+)
+
+const testSecret = "test-secret"
+
+func signToken(t *testing.T, secret, userID string) string {
+	t.Helper()
+	return signTokenFor(t, secret, userID, time.Hour)
+}
+
+// signTokenFor signs a token for userID that expires after ttl.
+func signTokenFor(t *testing.T, secret, userID string, ttl time.Duration) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func startHub(t *testing.T, opts ...Option) (*Hub, *httptest.Server) {
+	t.Helper()
+
+	h := NewHub(nil, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.Run(ctx)
+	t.Cleanup(cancel)
+
+	return h, newHubServer(t, h)
+}
+
+func newHubServer(t *testing.T, h *Hub) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func wsURL(srv *httptest.Server, query string) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "?" + query
+}
+
+// waitForSession polls until userID has a connection in sessionID.
+func waitForSession(t *testing.T, h *Hub, userID, sessionID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if h.Sessions(userID)[sessionID] > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected user %s to be registered in session %s", userID, sessionID)
+}
+
+func TestHandleWebSocket_UpgradeAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		protocols  []string
+		wantStatus int
+		// wantPending means the upgrade succeeds but the connection is not
+		// registered until it sends an auth frame.
+		wantPending bool
+	}{
+		{
+			name:  "query token",
+			query: "session_id=s1&token=" + "VALID",
+		},
+		{
+			name:      "subprotocol token",
+			query:     "session_id=s1",
+			protocols: []string{"bearer", "VALID"},
+		},
+		{
+			name:       "invalid token",
+			query:      "session_id=s1&token=garbage",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong secret",
+			query:      "session_id=s1&token=OTHER",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unsupported protocol version",
+			query:      "session_id=s1&v=7&token=VALID",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing session",
+			query:      "token=VALID",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "user_id in query is ignored",
+			query:       "session_id=s1&user_id=user-1",
+			wantPending: true,
+		},
+	}
+
+	valid := signToken(t, testSecret, "user-1")
+	other := signToken(t, "other-secret", "user-1")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, srv := startHub(t, WithJWTSecret(testSecret))
+
+			query := strings.NewReplacer("VALID", valid, "OTHER", other).Replace(tt.query)
+			protocols := make([]string, len(tt.protocols))
+			for i, p := range tt.protocols {
+				protocols[i] = strings.NewReplacer("VALID", valid).Replace(p)
+			}
+			dialer := websocket.Dialer{Subprotocols: protocols}
+
+			conn, resp, err := dialer.Dial(wsURL(srv, query), nil)
+			if tt.wantStatus != 0 {
+				if err == nil {
+					conn.Close()
+					t.Fatal("expected dial to fail")
+				}
+				if resp == nil || resp.StatusCode != tt.wantStatus {
+					t.Errorf("expected status %d, got %v", tt.wantStatus, resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			if tt.wantPending {
+				time.Sleep(50 * time.Millisecond)
+				if n := len(h.Sessions("user-1")); n != 0 {
+					t.Errorf("expected no sessions before auth frame, got %d", n)
+				}
+				return
+			}
+
+			if len(tt.protocols) > 0 && conn.Subprotocol() != authSubprotocol {
+				t.Errorf("expected subprotocol %q, got %q", authSubprotocol, conn.Subprotocol())
+			}
+			waitForSession(t, h, "user-1", "s1")
+		})
+	}
+}
+
+func TestHandleWebSocket_AuthFrame(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret))
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(authFrame{Type: "auth", Token: signToken(t, testSecret, "user-1")}); err != nil {
+		t.Fatalf("Failed to write auth frame: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read ack: %v", err)
+	}
+
+	var ack authenticatedEvent
+	if err := json.Unmarshal(data, &ack); err != nil {
+		t.Fatalf("Failed to unmarshal ack: %v", err)
+	}
+	if ack.Event != "authenticated" || ack.UserID != "user-1" || ack.SessionID != "s1" {
+		t.Errorf("unexpected ack %+v", ack)
+	}
+	waitForSession(t, h, "user-1", "s1")
+}
+
+func TestHandleWebSocket_AuthFrameRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+	}{
+		{"bad token", `{"type":"auth","token":"garbage"}`},
+		{"not an auth frame", `{"content":"Hello","message_type":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := startHub(t, WithJWTSecret(testSecret))
+
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1"), nil)
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+				t.Fatalf("Failed to write frame: %v", err)
+			}
+
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, _, err = conn.ReadMessage()
+			if !websocket.IsCloseError(err, closeUnauthorized) {
+				t.Errorf("expected close code %d, got %v", closeUnauthorized, err)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocket_NoSecret(t *testing.T) {
+	_, srv := startHub(t)
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token=anything"), nil)
+	if err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %v", http.StatusServiceUnavailable, resp)
+	}
+}
+
+func TestHub_RefreshAuth(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret))
+	// Warn as soon as a client connects.
+	h.authWarning = time.Hour
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signTokenFor(t, testSecret, "user-1", 2*time.Second)), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	expiring := func(env Envelope) authExpiringEvent {
+		t.Helper()
+		var event authExpiringEvent
+		json.Unmarshal(env.Payload, &event)
+		if env.Type != TypeControl || event.Event != "auth_expiring" || event.ExpiresAt.IsZero() {
+			t.Fatalf("expected auth_expiring event, got %+v", env)
+		}
+		return event
+	}
+	first := expiring(readEnvelope(t, conn))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{"another user", signToken(t, testSecret, "user-2"), ErrCodeUnauthorized},
+		{"bad token", "garbage", ErrCodeUnauthorized},
+		{"missing token", "", ErrCodeInvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(controlMessage{Action: "refresh_auth", Token: tt.token})
+			conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: "r-1", Payload: payload})
+
+			env := readEnvelope(t, conn)
+			var got errorPayload
+			json.Unmarshal(env.Payload, &got)
+			if env.Type != TypeError || env.ID != "r-1" || got.Code != tt.wantCode {
+				t.Errorf("expected %s error, got %+v with payload %s", tt.wantCode, env, env.Payload)
+			}
+		})
+	}
+
+	payload, _ := json.Marshal(controlMessage{Action: "refresh_auth", Token: signTokenFor(t, testSecret, "user-1", 30*time.Minute)})
+	conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: "r-2", Payload: payload})
+	// The reply comes with a warning for the new token, which is also within
+	// the warning window, in either order.
+	envs := readEnvelopes(t, conn, 2)
+	if envs[0].ID == "" {
+		envs[0], envs[1] = envs[1], envs[0]
+	}
+	var reply controlMessage
+	json.Unmarshal(envs[0].Payload, &reply)
+	if envs[0].Type != TypeControl || envs[0].ID != "r-2" || reply.Action != "auth_refreshed" {
+		t.Fatalf("expected auth_refreshed reply, got %+v with payload %s", envs[0], envs[0].Payload)
+	}
+	if second := expiring(envs[1]); !second.ExpiresAt.After(first.ExpiresAt) {
+		t.Errorf("expected a warning for the new token, got %v after %v", second.ExpiresAt, first.ExpiresAt)
+	}
+
+	// The connection outlives the first token.
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("expected no frames after the refresh, got %s", data)
+	} else if websocket.IsCloseError(err, closeUnauthorized) {
+		t.Errorf("expected the connection kept open after the refresh, got %v", err)
+	}
+}
+
+func TestHub_AuthExpiry(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret))
+	h.authWarning = time.Hour
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signTokenFor(t, testSecret, "user-1", 2*time.Second)), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if env := readEnvelope(t, conn); env.Type != TypeControl || !strings.Contains(string(env.Payload), "auth_expiring") {
+		t.Fatalf("expected auth_expiring event, got %+v", env)
+	}
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, closeUnauthorized) {
+		t.Errorf("expected close code %d once the token expired, got %v", closeUnauthorized, err)
+	}
+}
+
+type fakeSessions map[string]*middleware.Claims
+
+func (f fakeSessions) Resolve(id string) (*middleware.Claims, bool) {
+	c, ok := f[id]
+	return c, ok
+}
+
+func TestHandleWebSocket_SessionCookie(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithSessions(fakeSessions{"live": {UserID: "browser-user"}}))
+	origin := srv.URL
+
+	dial := func(cookie, origin string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		header.Set("Cookie", middleware.SessionCookie+"="+cookie)
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		return websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1"), header)
+	}
+
+	conn, _, err := dial("live", origin)
+	if err != nil {
+		t.Fatalf("expected a same-origin session cookie to authenticate: %v", err)
+	}
+	conn.Close()
+	waitForSession(t, h, "browser-user", "s1")
+
+	if _, resp, err := dial("ended", origin); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an ended session, got %v", resp)
+	}
+
+	// Cross-origin upgrades ignore the cookie and must authenticate with an
+	// auth frame instead.
+	conn, _, err = dial("live", "https://evil.example")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	conn.WriteJSON(map[string]string{"type": "auth", "token": "forged"})
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, closeUnauthorized) {
+		t.Errorf("expected the cross-origin connection to be refused, got %v", err)
+	}
+}
+
+func TestHandleWebSocket_Guests(t *testing.T) {
+	const secret = "test-secret-key"
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
+		UserID: middleware.GuestPrefix + "1",
+		Guest:  true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	_, srv := startHub(t, WithJWTSecret(secret))
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+token), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected guests to be refused by default, got %v, %v", resp, err)
+	}
+
+	h, srv := startHub(t, WithJWTSecret(secret), WithGuests(1, 2))
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	waitForSession(t, h, middleware.GuestPrefix+"1", "s1")
+}
+
+// fakeTickets redeems each of its tickets once.
+type fakeTickets map[string]*middleware.Claims
+
+func (f fakeTickets) Redeem(ticket, sessionID string) (*middleware.Claims, error) {
+	c, ok := f[ticket]
+	if !ok || sessionID != "s1" {
+		return nil, fmt.Errorf("invalid ticket")
+	}
+	delete(f, ticket)
+	return c, nil
+}
+
+func TestHandleWebSocket_Ticket(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithTickets(fakeTickets{"t1": {UserID: "browser-user"}}))
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&ticket=t1"), nil)
+	if err != nil {
+		t.Fatalf("expected a ticket to authenticate: %v", err)
+	}
+	conn.Close()
+	waitForSession(t, h, "browser-user", "s1")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&ticket=t1"), nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a redeemed ticket, got %v", resp)
+	}
+	// A ticket takes precedence over a token.
+	token := signToken(t, testSecret, "user-1")
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&ticket=bogus&token="+token), nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an invalid ticket, got %v", resp)
+	}
+}
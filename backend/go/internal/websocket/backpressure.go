@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"google.golang.org/protobuf/proto"
+)
+
+// With WithLagGrace, a client whose send buffer fills up is not dropped at
+// once. Once its buffer is three quarters full, partial chat messages are
+// held back and their content is merged into the next chunk of the same
+// message, so finals always arrive complete. Other frames that do not fit
+// wait in an overflow queue up to the buffer's size. The client is told when
+// it starts and stops lagging, and is disconnected only if it is still
+// lagging after the grace period when a frame does not fit.
+
+// backlog is a client's backpressure state, guarded by its own mutex so the
+// write pump can flush it without the shard lock. The hub takes mu while
+// holding the shard lock, never the other way round.
+type backlog struct {
+	mu sync.Mutex
+	// since is when the client started lagging, zero when it is not.
+	since time.Time
+	// overflow holds frames, in order, behind a full send buffer.
+	overflow []outbound
+	// pending maps message IDs to the content of held back partials.
+	pending map[string]string
+	// coalesced counts the partials held back during this lag.
+	coalesced int
+	// closed is set once the send channel is closed.
+	closed bool
+}
+
+// laggingEvent tells a client it started or stopped lagging. Coalesced is the
+// number of partial messages merged into later ones while it lagged.
+type laggingEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Lagging   bool   `json:"lagging"`
+	Coalesced int    `json:"coalesced,omitempty"`
+}
+
+// WithLagGrace keeps clients whose send buffer fills up connected for grace,
+// coalescing partial messages while they catch up. Without it, such clients
+// are disconnected at once.
+func WithLagGrace(grace time.Duration) Option {
+	return func(h *Hub) {
+		h.lagGrace = grace
+	}
+}
+
+// softLimit is the buffered frame count above which partials are held back.
+func (c *Client) softLimit() int {
+	return cap(c.send) - cap(c.send)/4
+}
+
+// enqueue queues f for c and reports whether c should stay connected. The
+// caller must hold the lock of c's shard.
+func (h *Hub) enqueue(c *Client, f outbound) bool {
+	if h.lagGrace <= 0 {
+		select {
+		case c.send <- f:
+			return true
+		default:
+			return false
+		}
+	}
+
+	b := &c.backlog
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.overflow) == 0 {
+		select {
+		case c.send <- f:
+			return true
+		default:
+		}
+	}
+	b.lag(c)
+	if time.Since(b.since) > h.lagGrace || len(b.overflow) > cap(c.send) {
+		return false
+	}
+	b.overflow = append(b.overflow, f)
+	return true
+}
+
+// push queues f for c from outside the shard lock, as the goroutines
+// answering c's own messages and running its chats do. It never blocks and
+// reports whether f was queued: frames for a client that has been removed are
+// dropped, as is f when the buffer is full and c may not lag. The send
+// channel is only closed under mu, so push cannot send on a closed channel.
+func (c *Client) push(f outbound) bool {
+	b := &c.backlog
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false
+	}
+	if len(b.overflow) == 0 {
+		select {
+		case c.send <- f:
+			return true
+		default:
+		}
+	}
+	if c.hub.lagGrace <= 0 || len(b.overflow) > cap(c.send) {
+		return false
+	}
+	b.lag(c)
+	b.overflow = append(b.overflow, f)
+	return true
+}
+
+// dropClient disconnects a client of s that cannot keep up. The caller must
+// hold mu.
+func (s *shard) dropClient(c *Client) {
+	metrics.ObserveSendBufferDrop()
+	s.remove(c)
+}
+
+// coalesce returns the session message to send to c, or false if m is a
+// partial held back because c is lagging. Held back content is prepended to
+// the next chunk of the same message. The caller must hold the lock of c's
+// shard.
+func (h *Hub) coalesce(c *Client, m *sessionMessage) (*sessionMessage, bool) {
+	if h.lagGrace <= 0 {
+		return m, true
+	}
+	resp := m.chat()
+	if resp == nil {
+		return m, true
+	}
+
+	b := &c.backlog
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !resp.IsFinal && (!b.since.IsZero() || len(c.send) >= c.softLimit()) {
+		if b.pending == nil {
+			b.pending = make(map[string]string)
+		}
+		b.pending[resp.MessageId] += resp.Content
+		b.coalesced++
+		b.lag(c)
+		return nil, false
+	}
+
+	prefix, ok := b.pending[resp.MessageId]
+	if !ok {
+		return m, true
+	}
+	delete(b.pending, resp.MessageId)
+	merged := proto.Clone(resp).(*pb.ChatResponse)
+	merged.Content = prefix + resp.Content
+	return &sessionMessage{resp: merged, streamID: m.streamID}, true
+}
+
+// flushBacklog moves overflow frames into the send buffer as room frees up
+// and ends the lag once the buffer is below half full. It is called by the
+// write pump after each write.
+func (c *Client) flushBacklog() {
+	b := &c.backlog
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.since.IsZero() {
+		return
+	}
+	for len(b.overflow) > 0 {
+		select {
+		case c.send <- b.overflow[0]:
+			b.overflow = b.overflow[1:]
+		default:
+			return
+		}
+	}
+	if len(c.send) >= cap(c.send)/2 {
+		return
+	}
+
+	data, _ := json.Marshal(laggingEvent{Event: "lagging", SessionID: c.sessionID, Coalesced: b.coalesced})
+	b.since = time.Time{}
+	b.coalesced = 0
+	b.queue(c, c.frame(TypeControl, "", data))
+}
+
+// close marks the send channel closed and drops the overflow. The caller must
+// hold the lock of c's shard.
+func (b *backlog) close(c *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.overflow = nil
+	close(c.send)
+}
+
+// lag starts a lag, telling the client, unless one is under way. The caller
+// must hold mu.
+func (b *backlog) lag(c *Client) {
+	if !b.since.IsZero() {
+		return
+	}
+	b.since = time.Now()
+	data, _ := json.Marshal(laggingEvent{Event: "lagging", SessionID: c.sessionID, Lagging: true})
+	b.queue(c, c.frame(TypeControl, "", data))
+}
+
+// queue sends f, or appends it to the overflow if the buffer is full or
+// frames are already waiting. The caller must hold mu.
+func (b *backlog) queue(c *Client, f outbound) {
+	if len(b.overflow) == 0 {
+		select {
+		case c.send <- f:
+			return
+		default:
+		}
+	}
+	b.overflow = append(b.overflow, f)
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+func chunk(t *testing.T, content string, final bool) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(&pb.ChatResponse{MessageId: "m1", SessionId: "s1", Content: content, IsFinal: final})
+	if err != nil {
+		t.Fatalf("Failed to marshal chunk: %v", err)
+	}
+	return data
+}
+
+// drain reads c's buffered frames, flushing its backlog as the write pump
+// would, until nothing is left.
+func drain(c *Client) []string {
+	var frames []string
+	for {
+		select {
+		case f := <-c.send:
+			frames = append(frames, string(f.data))
+		default:
+			c.flushBacklog()
+			if len(c.send) == 0 {
+				return frames
+			}
+		}
+	}
+}
+
+func TestHub_CoalescesForLaggingClient(t *testing.T) {
+	h := NewHub(nil, WithLagGrace(time.Minute))
+	slow := newTestClient(h, "u1", "s1", 4)
+
+	for _, content := range []string{"a", "b", "c", "d", "e"} {
+		h.SendToSession("s1", chunk(t, content, false))
+	}
+	if n := h.SendToSession("s1", chunk(t, "f", true)); n != 1 {
+		t.Errorf("expected the final to be queued, got %d deliveries", n)
+	}
+	if h.Sessions("u1")["s1"] != 1 {
+		t.Fatal("expected lagging client to stay connected")
+	}
+
+	frames := drain(slow)
+	if len(frames) != 6 {
+		t.Fatalf("expected 6 frames, got %d: %q", len(frames), frames)
+	}
+
+	var started, stopped laggingEvent
+	json.Unmarshal([]byte(frames[3]), &started)
+	json.Unmarshal([]byte(frames[5]), &stopped)
+	if !started.Lagging || stopped.Lagging || stopped.Coalesced != 2 {
+		t.Errorf("expected lagging start and stop after 2 coalesced, got %+v and %+v", started, stopped)
+	}
+
+	var final pb.ChatResponse
+	json.Unmarshal([]byte(frames[4]), &final)
+	if final.Content != "def" || !final.IsFinal {
+		t.Errorf("expected coalesced final %q, got %+v", "def", &final)
+	}
+}
+
+func TestHub_DropsClientAfterLagGrace(t *testing.T) {
+	h := NewHub(nil, WithLagGrace(time.Minute))
+	slow := newTestClient(h, "u1", "s1", 1)
+
+	h.SendToSession("s1", []byte("1"))
+	h.SendToSession("s1", []byte("2"))
+	if h.Sessions("u1")["s1"] != 1 {
+		t.Fatal("expected client to stay connected within the grace period")
+	}
+
+	slow.backlog.mu.Lock()
+	slow.backlog.since = time.Now().Add(-2 * time.Minute)
+	slow.backlog.mu.Unlock()
+
+	if n := h.SendToSession("s1", []byte("3")); n != 0 {
+		t.Errorf("expected no deliveries, got %d", n)
+	}
+	if h.Sessions("u1")["s1"] != 0 {
+		t.Error("expected client to be dropped after the grace period")
+	}
+}
+
+func TestClient_PushAfterDrop(t *testing.T) {
+	h := NewHub(nil)
+	c := newTestClient(h, "u1", "s1", 1)
+
+	if !c.push(outbound{data: []byte("1")}) {
+		t.Fatal("expected the first frame to be queued")
+	}
+	if c.push(outbound{data: []byte("2")}) {
+		t.Error("expected a frame behind a full buffer to be dropped")
+	}
+
+	removeTestClient(c)
+	if c.push(outbound{data: []byte("3")}) {
+		t.Error("expected a frame for a removed client to be dropped")
+	}
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// In protocol v2, chats travel as binary frames holding a protobuf
+// StreamRequest with a chat payload, and session chat messages and audio
+// replies as binary frames holding a StreamResponse. Everything else (acks,
+// errors, control) stays a v1 JSON envelope in a text frame, and clients may
+// still send v1 text envelopes.
+
+// binaryIDKey is the chat metadata key holding a binary chat's client message
+// ID, the counterpart of Envelope.ID. It is removed before forwarding.
+const binaryIDKey = "envelope_id"
+
+// outbound is a frame queued for a client.
+type outbound struct {
+	data   []byte
+	binary bool
+}
+
+// sessionMessage is a chat message for a session's connections. Its JSON
+// and protobuf encodings are computed on first use, so a session with only
+// binary clients never marshals JSON, and vice versa. Messages from the
+// backplane arrive as JSON only. streamID names the chat the message
+// belongs to, if any.
+type sessionMessage struct {
+	resp     *pb.ChatResponse
+	streamID string
+	json     []byte
+	proto    []byte
+}
+
+func (m *sessionMessage) JSON() []byte {
+	if m.json == nil {
+		m.json = marshalResponse(m.resp)
+	}
+	return m.json
+}
+
+// chat returns the message's ChatResponse, or nil if its JSON is not one.
+func (m *sessionMessage) chat() *pb.ChatResponse {
+	if m.resp == nil {
+		resp := &pb.ChatResponse{}
+		if unmarshalResponse(m.json, resp) != nil {
+			return nil
+		}
+		m.resp = resp
+	}
+	return m.resp
+}
+
+func (m *sessionMessage) Proto() []byte {
+	if m.proto == nil {
+		resp := m.resp
+		if resp == nil {
+			resp = &pb.ChatResponse{}
+			unmarshalResponse(m.json, resp)
+		}
+		m.proto, _ = proto.Marshal(&pb.StreamResponse{
+			SessionId: resp.SessionId,
+			Payload:   &pb.StreamResponse_Chat{Chat: resp},
+		})
+	}
+	return m.proto
+}
+
+// frameSession encodes a session chat message with sequence number seq for
+// c's protocol version. StreamResponse has no stream ID field, so binary
+// frames are not tagged with the message's stream.
+func (c *Client) frameSession(seq uint64, m *sessionMessage) outbound {
+	if c.protocol == protocolBinary {
+		return outbound{data: m.Proto(), binary: true}
+	}
+	return c.frameSeq(TypeChat, m.streamID, seq, m.JSON())
+}
+
+// frameAudio encodes an audio reply to the sender's chat id for c's protocol
+// version. Binary clients receive it as a StreamResponse with an audio payload.
+func (c *Client) frameAudio(id, sessionID string, audio []byte) outbound {
+	if c.protocol == protocolBinary {
+		data, _ := proto.Marshal(&pb.StreamResponse{
+			SessionId: sessionID,
+			Payload:   &pb.StreamResponse_AudioData{AudioData: audio},
+		})
+		return outbound{data: data, binary: true}
+	}
+	data, _ := json.Marshal(audioEvent{Event: "audio", SessionID: sessionID, Data: audio})
+	return c.frameStream(TypeControl, id, data)
+}
+
+// handleBinaryFrame handles a protobuf chat from a protocol v2 client.
+// Attachments must be uploaded and referenced, which the protobuf
+// ChatRequest cannot express, so binary chats may not carry any.
+func (c *Client) handleBinaryFrame(data []byte) {
+	if err := c.allowMessage(); err != nil {
+		c.sendError("", errorCode(err), err)
+		return
+	}
+
+	var req pb.StreamRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		c.rejectMessage("", ErrCodeInvalidMessage, fmt.Errorf("invalid binary frame: %w", err))
+		return
+	}
+
+	chat := req.GetChat()
+	if chat == nil {
+		c.rejectMessage("", ErrCodeInvalidMessage, fmt.Errorf("binary frames must carry a chat payload"))
+		return
+	}
+
+	id := chat.Metadata[binaryIDKey]
+	delete(chat.Metadata, binaryIDKey)
+	if len(chat.Attachments) > 0 {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("binary chats cannot carry attachments"))
+		return
+	}
+
+	chat.UserId = c.userID
+	chat.SessionId = c.sessionID
+	c.startStream(chat, nil, id)
+}
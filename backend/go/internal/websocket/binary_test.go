@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSessionMessage_ProtoFromJSON(t *testing.T) {
+	m := &sessionMessage{json: []byte(`{"message_id":"m1","session_id":"s1","content":"Hi","is_final":true}`)}
+
+	var resp pb.StreamResponse
+	if err := proto.Unmarshal(m.Proto(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal proto: %v", err)
+	}
+	chat := resp.GetChat()
+	if resp.SessionId != "s1" || chat == nil || chat.MessageId != "m1" || chat.Content != "Hi" || !chat.IsFinal {
+		t.Errorf("unexpected response %+v", &resp)
+	}
+}
+
+func TestHub_BinaryProtocol(t *testing.T) {
+	h := NewHub(startMockUpstream(t), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	token := signToken(t, testSecret, "user-1")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=2&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	data, _ := proto.Marshal(&pb.StreamRequest{Payload: &pb.StreamRequest_Chat{Chat: &pb.ChatRequest{
+		Content:  "Hello",
+		Metadata: map[string]string{binaryIDKey: "c-1"},
+	}}})
+	conn.WriteMessage(websocket.BinaryMessage, data)
+
+	if env := readEnvelope(t, conn); env.Type != TypeAck || env.ID != "c-1" {
+		t.Errorf("expected ack for c-1, got %+v", env)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	kind, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	var resp pb.StreamResponse
+	if kind != websocket.BinaryMessage || proto.Unmarshal(data, &resp) != nil {
+		t.Fatalf("expected binary StreamResponse, got %s", data)
+	}
+	if chat := resp.GetChat(); chat == nil || chat.Content != "Hi there" || !chat.IsFinal {
+		t.Errorf("unexpected chat response %+v", &resp)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.StreamRequest
+		id   string
+	}{
+		{"not a chat", &pb.StreamRequest{Payload: &pb.StreamRequest_AudioData{AudioData: []byte{1}}}, ""},
+		{"attachments", &pb.StreamRequest{Payload: &pb.StreamRequest_Chat{Chat: &pb.ChatRequest{
+			Content:     "Look",
+			Metadata:    map[string]string{binaryIDKey: "c-2"},
+			Attachments: []*pb.Attachment{{Filename: "a.png"}},
+		}}}, "c-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := proto.Marshal(tt.req)
+			conn.WriteMessage(websocket.BinaryMessage, data)
+
+			env := readEnvelope(t, conn)
+			var payload errorPayload
+			json.Unmarshal(env.Payload, &payload)
+			if env.Type != TypeError || env.ID != tt.id || payload.Code != ErrCodeInvalidMessage {
+				t.Errorf("expected %s error for %q, got %+v", ErrCodeInvalidMessage, tt.id, env)
+			}
+		})
+	}
+}
+
+func TestClient_FrameAudio(t *testing.T) {
+	audio := []byte{0x52, 0x49, 0x46, 0x46}
+
+	binary := (&Client{protocol: protocolBinary, sessionID: "s1"}).frameAudio("c-1", "s1", audio)
+	var resp pb.StreamResponse
+	if !binary.binary || proto.Unmarshal(binary.data, &resp) != nil {
+		t.Fatalf("expected binary StreamResponse, got %q", binary.data)
+	}
+	if resp.SessionId != "s1" || string(resp.GetAudioData()) != string(audio) {
+		t.Errorf("unexpected audio response %+v", &resp)
+	}
+
+	text := (&Client{protocol: protocolEnvelope, sessionID: "s1"}).frameAudio("c-1", "s1", audio)
+	var env Envelope
+	if text.binary || json.Unmarshal(text.data, &env) != nil {
+		t.Fatalf("expected text envelope, got %q", text.data)
+	}
+	var event audioEvent
+	json.Unmarshal(env.Payload, &event)
+	if env.Type != TypeControl || env.ID != "c-1" || event.Event != "audio" || string(event.Data) != string(audio) {
+		t.Errorf("unexpected audio envelope %+v", env)
+	}
+}
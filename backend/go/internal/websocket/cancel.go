@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Envelope clients stop a chat in flight with a cancel control action naming
+// the chat's envelope ID. Cancelling the chat's context cancels the upstream
+// gRPC stream; the client gets a cancelled reply instead of an error, and
+// whatever the agent produced so far stays in the session. Every chat's
+// context derives from its client's, so closing the connection cancels all
+// of the client's chats the same way.
+
+// ErrCodeUnknownStream rejects a cancel for a chat that is not in flight on
+// the connection, e.g. one that already finished.
+const ErrCodeUnknownStream = "UNKNOWN_STREAM"
+
+// streamCancels tracks a client's chats in flight, with their cancel
+// functions, by envelope ID, which is also their stream ID.
+type streamCancels struct {
+	mu sync.Mutex
+	m  map[string]*streamCancel
+}
+
+type streamCancel struct {
+	cancel  context.CancelFunc
+	control *StreamControl
+}
+
+// track returns a context for the chat id, derived from parent, that cancel
+// cancels, the chat's StreamControl, and a function to call once the chat is
+// done. It reports false if a chat with the same ID is already in flight,
+// since their frames could not be told apart. Chats without an ID cannot be
+// cancelled or controlled.
+func (s *streamCancels) track(parent context.Context, id string) (context.Context, *StreamControl, func(), bool) {
+	ctx, cancel := context.WithCancel(parent)
+	control := &StreamControl{}
+	if id == "" {
+		return ctx, control, cancel, true
+	}
+
+	sc := &streamCancel{cancel: cancel, control: control}
+	s.mu.Lock()
+	if _, ok := s.m[id]; ok {
+		s.mu.Unlock()
+		cancel()
+		return nil, nil, nil, false
+	}
+	if s.m == nil {
+		s.m = make(map[string]*streamCancel)
+	}
+	s.m[id] = sc
+	s.mu.Unlock()
+
+	return ctx, control, func() {
+		s.mu.Lock()
+		// A cancelled chat's ID may have been reused while it wound down.
+		if s.m[id] == sc {
+			delete(s.m, id)
+		}
+		s.mu.Unlock()
+		cancel()
+	}, true
+}
+
+// control returns the StreamControl of the chat id, or nil if it is not in
+// flight.
+func (s *streamCancels) control(id string) *StreamControl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc, ok := s.m[id]; ok {
+		return sc.control
+	}
+	return nil
+}
+
+// controls returns the StreamControls of the chats in flight.
+func (s *streamCancels) controls() []*StreamControl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	controls := make([]*StreamControl, 0, len(s.m))
+	for _, sc := range s.m {
+		controls = append(controls, sc.control)
+	}
+	return controls
+}
+
+// cancel cancels the chat id and reports whether it was in flight.
+func (s *streamCancels) cancel(id string) bool {
+	s.mu.Lock()
+	sc, ok := s.m[id]
+	delete(s.m, id)
+	s.mu.Unlock()
+
+	if ok {
+		sc.cancel()
+	}
+	return ok
+}
+
+// cancelStream handles a cancel control action for the chat streamID.
+func (c *Client) cancelStream(id, streamID string) {
+	if streamID == "" {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("stream_id is required"))
+		return
+	}
+	if !c.cancels.cancel(streamID) {
+		c.sendError(id, ErrCodeUnknownStream, fmt.Errorf("no chat %q in flight", streamID))
+		return
+	}
+
+	payload, _ := json.Marshal(controlMessage{Action: "cancelled", StreamID: streamID})
+	c.push(c.frameEnvelope(Envelope{Type: TypeControl, ID: id, StreamID: streamID, Payload: payload}))
+}
@@ -0,0 +1,220 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// hangingAIService sends one partial response per chat and then waits for the
+// chat to be cancelled.
+type hangingAIService struct {
+	pb.UnimplementedAIServiceServer
+	cancelled chan struct{}
+}
+
+func (s *hangingAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&pb.StreamResponse{
+		SessionId: req.SessionId,
+		Payload: &pb.StreamResponse_Chat{Chat: &pb.ChatResponse{
+			MessageId: "msg-1",
+			SessionId: req.SessionId,
+			Content:   "Thinking",
+		}},
+	}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	close(s.cancelled)
+	return stream.Context().Err()
+}
+
+func TestClient_CancelStream(t *testing.T) {
+	upstream := &hangingAIService{cancelled: make(chan struct{})}
+	h := NewHub(startUpstream(t, upstream), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeChat, ID: "c-1", Payload: json.RawMessage(`{"content":"Write an essay"}`)}); err != nil {
+		t.Fatalf("Failed to write chat: %v", err)
+	}
+	// Wait for the ack and the partial response.
+	if envs := readEnvelopes(t, conn, 2); envs[0].Type != TypeAck || envs[1].Type != TypeChat {
+		t.Fatalf("expected ack and chat, got %+v", envs)
+	}
+
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: "x-1", Payload: json.RawMessage(`{"action":"cancel","stream_id":"c-1"}`)}); err != nil {
+		t.Fatalf("Failed to write cancel: %v", err)
+	}
+	env := readEnvelope(t, conn)
+	var reply controlMessage
+	if err := json.Unmarshal(env.Payload, &reply); err != nil {
+		t.Fatalf("Failed to unmarshal reply: %v", err)
+	}
+	if env.Type != TypeControl || env.ID != "x-1" || reply.Action != "cancelled" || reply.StreamID != "c-1" {
+		t.Errorf("unexpected reply %+v with payload %s", env, env.Payload)
+	}
+
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected upstream stream to be cancelled")
+	}
+
+	// The chat is no longer in flight, and no error follows the reply.
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: "x-2", Payload: json.RawMessage(`{"action":"cancel","stream_id":"c-1"}`)}); err != nil {
+		t.Fatalf("Failed to write cancel: %v", err)
+	}
+	env = readEnvelope(t, conn)
+	var payload errorPayload
+	json.Unmarshal(env.Payload, &payload)
+	if env.Type != TypeError || env.ID != "x-2" || payload.Code != ErrCodeUnknownStream {
+		t.Errorf("expected %s error for x-2, got %+v with payload %s", ErrCodeUnknownStream, env, env.Payload)
+	}
+}
+
+func TestClient_DisconnectCancelsStreams(t *testing.T) {
+	upstream := &hangingAIService{cancelled: make(chan struct{})}
+	h := NewHub(startUpstream(t, upstream), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeChat, ID: "c-1", Payload: json.RawMessage(`{"content":"Write an essay"}`)}); err != nil {
+		t.Fatalf("Failed to write chat: %v", err)
+	}
+	if envs := readEnvelopes(t, conn, 2); envs[0].Type != TypeAck || envs[1].Type != TypeChat {
+		t.Fatalf("expected ack and chat, got %+v", envs)
+	}
+	conn.Close()
+
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected upstream stream to be cancelled on disconnect")
+	}
+}
+
+// echoAIService answers each chat with a partial and, once released, a final
+// response, both echoing the chat's content.
+type echoAIService struct {
+	pb.UnimplementedAIServiceServer
+	release chan struct{}
+}
+
+func (s *echoAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	chat := req.GetChat()
+	send := func(final bool) error {
+		return stream.Send(&pb.StreamResponse{
+			SessionId: req.SessionId,
+			Payload: &pb.StreamResponse_Chat{Chat: &pb.ChatResponse{
+				MessageId: "msg-" + chat.Content,
+				SessionId: req.SessionId,
+				Content:   chat.Content,
+				IsFinal:   final,
+			}},
+		})
+	}
+	if err := send(false); err != nil {
+		return err
+	}
+	select {
+	case <-s.release:
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+	return send(true)
+}
+
+func TestClient_ConcurrentStreams(t *testing.T) {
+	upstream := &echoAIService{release: make(chan struct{})}
+	h := NewHub(startUpstream(t, upstream), WithJWTSecret(testSecret), WithClientLimits(0, 0, 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, id := range []string{"one", "two"} {
+		if err := conn.WriteJSON(Envelope{V: 1, Type: TypeChat, ID: id, Payload: json.RawMessage(`{"content":"` + id + `"}`)}); err != nil {
+			t.Fatalf("Failed to write chat: %v", err)
+		}
+	}
+
+	// checkStream checks that a chat frame belongs to the stream it answers.
+	checkStream := func(env Envelope, final bool) {
+		t.Helper()
+		var resp pb.ChatResponse
+		if err := json.Unmarshal(env.Payload, &resp); err != nil {
+			t.Fatalf("Failed to unmarshal chat payload: %v", err)
+		}
+		if env.StreamID == "" || env.StreamID != resp.Content || resp.IsFinal != final {
+			t.Errorf("chat frame %+v tagged with the wrong stream", env)
+		}
+	}
+
+	acks := map[string]bool{}
+	for _, env := range readEnvelopes(t, conn, 4) {
+		switch env.Type {
+		case TypeAck:
+			if env.StreamID != env.ID {
+				t.Errorf("expected ack tagged with stream %q, got %+v", env.ID, env)
+			}
+			acks[env.StreamID] = true
+		case TypeChat:
+			checkStream(env, false)
+		default:
+			t.Fatalf("unexpected frame %+v", env)
+		}
+	}
+	if !acks["one"] || !acks["two"] {
+		t.Errorf("expected both chats acked, got %v", acks)
+	}
+
+	// A chat reusing the ID of one in flight is rejected.
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeChat, ID: "one", Payload: json.RawMessage(`{"content":"again"}`)}); err != nil {
+		t.Fatalf("Failed to write chat: %v", err)
+	}
+	env := readEnvelope(t, conn)
+	var payload errorPayload
+	json.Unmarshal(env.Payload, &payload)
+	if env.Type != TypeError || env.ID != "one" || payload.Code != ErrCodeInvalidMessage {
+		t.Errorf("expected %s error for the duplicate, got %+v with payload %s", ErrCodeInvalidMessage, env, env.Payload)
+	}
+
+	close(upstream.release)
+	for _, env := range readEnvelopes(t, conn, 2) {
+		checkStream(env, true)
+	}
+}
@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+)
+
+// Channels are named groups of connections, independent of sessions, that
+// envelope clients join with subscribe and unsubscribe control actions, e.g.
+// a project's activity feed at "project:42". Each channel prefix registered
+// with WithChannel has its own authorization callback; channels matching no
+// prefix cannot be joined.
+
+const (
+	// maxChannelsPerClient bounds the subscriptions of one connection.
+	maxChannelsPerClient = 32
+	// channelAuthTimeout bounds a channel authorization callback.
+	channelAuthTimeout = 5 * time.Second
+)
+
+// ErrCodeChannelForbidden rejects a subscription to an unknown channel or one
+// the user may not join.
+const ErrCodeChannelForbidden = "CHANNEL_FORBIDDEN"
+
+// ChannelAuthorizer decides whether userID may subscribe to channel. A nil
+// error allows it.
+type ChannelAuthorizer func(ctx context.Context, userID, channel string) error
+
+type channelRule struct {
+	prefix    string
+	authorize ChannelAuthorizer
+}
+
+// channelEvent is the payload of a channel envelope.
+type channelEvent struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+var errNoChannel = errors.New("no such channel")
+
+// WithChannel lets clients subscribe to channels whose names start with
+// prefix, if authorize allows it. The longest matching prefix wins.
+func WithChannel(prefix string, authorize ChannelAuthorizer) Option {
+	return func(h *Hub) {
+		h.channelRules = append(h.channelRules, channelRule{prefix: prefix, authorize: authorize})
+	}
+}
+
+// authorizeChannel runs the callback of the longest prefix matching channel.
+func (h *Hub) authorizeChannel(userID, channel string) error {
+	var rule *channelRule
+	for i, r := range h.channelRules {
+		if strings.HasPrefix(channel, r.prefix) && (rule == nil || len(r.prefix) > len(rule.prefix)) {
+			rule = &h.channelRules[i]
+		}
+	}
+	if rule == nil {
+		return errNoChannel
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), channelAuthTimeout)
+	defer cancel()
+	return rule.authorize(ctx, userID, channel)
+}
+
+// subscribe adds c to channel after authorizing it.
+func (c *Client) subscribe(id, channel string) {
+	if channel == "" {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("channel is required"))
+		return
+	}
+	if err := c.hub.authorizeChannel(c.userID, channel); err != nil {
+		c.sendError(id, ErrCodeChannelForbidden, fmt.Errorf("cannot subscribe to %q: %w", channel, err))
+		return
+	}
+
+	s := c.shard()
+	s.mu.Lock()
+	if _, ok := s.clients[c]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	if !c.channels[channel] && len(c.channels) >= maxChannelsPerClient {
+		s.mu.Unlock()
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("at most %d channel subscriptions", maxChannelsPerClient))
+		return
+	}
+	if c.channels == nil {
+		c.channels = make(map[string]bool)
+	}
+	c.channels[channel] = true
+	addToIndex(s.channelClients, channel, c)
+	s.mu.Unlock()
+
+	payload, _ := json.Marshal(controlMessage{Action: "subscribed", Channel: channel})
+	c.push(c.frame(TypeControl, id, payload))
+}
+
+// unsubscribe removes c from channel. It succeeds even if c was not
+// subscribed.
+func (c *Client) unsubscribe(id, channel string) {
+	s := c.shard()
+	s.mu.Lock()
+	if c.channels[channel] {
+		delete(c.channels, channel)
+		removeFromIndex(s.channelClients, channel, c)
+	}
+	s.mu.Unlock()
+
+	payload, _ := json.Marshal(controlMessage{Action: "unsubscribed", Channel: channel})
+	c.push(c.frame(TypeControl, id, payload))
+}
+
+// leaveChannels removes c from all its channels. The caller must hold mu.
+func (s *shard) leaveChannels(c *Client) {
+	for channel := range c.channels {
+		removeFromIndex(s.channelClients, channel, c)
+	}
+	c.channels = nil
+}
+
+// Publish queues data, a JSON value, for every subscriber of channel,
+// publishing it to the backplane when one is configured, and returns how many
+// local connections received it.
+func (h *Hub) Publish(channel string, data []byte) int {
+	delivered := h.publishLocal(channel, data)
+
+	if h.backplane != nil {
+		if err := h.backplane.PublishChannel(context.Background(), channel, data); err != nil {
+			h.log.Warn("Backplane publish failed", "channel", channel, logging.Err(err))
+		}
+	}
+	return delivered
+}
+
+func (h *Hub) publishLocal(channel string, data []byte) int {
+	payload, err := json.Marshal(channelEvent{Channel: channel, Data: data})
+	if err != nil {
+		h.log.Warn("Dropping invalid channel message", "channel", channel, logging.Err(err))
+		return 0
+	}
+
+	delivered := 0
+	h.lockShards(func(s *shard) {
+		delivered += s.deliver(s.channelClients[channel], func(c *Client) outbound {
+			return c.frame(TypeChannel, "", payload)
+		})
+	})
+	return delivered
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestHub_AuthorizeChannel(t *testing.T) {
+	h := NewHub(nil,
+		WithChannel("project:", func(ctx context.Context, userID, channel string) error {
+			if userID != "u1" {
+				return errors.New("not a member")
+			}
+			return nil
+		}),
+		WithChannel("project:public:", func(ctx context.Context, userID, channel string) error {
+			return nil
+		}),
+	)
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		wantErr bool
+	}{
+		{"member", "u1", "project:1", false},
+		{"non-member", "u2", "project:1", true},
+		{"longest prefix wins", "u2", "project:public:1", false},
+		{"no rule", "u1", "team:1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.authorizeChannel(tt.user, tt.channel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHub_ChannelSubscriptions(t *testing.T) {
+	h := NewHub(nil, WithChannel("project:", func(ctx context.Context, userID, channel string) error {
+		if channel != "project:1" {
+			return errors.New("not a member")
+		}
+		return nil
+	}))
+	c := newTestClient(h, "u1", "s1", 8)
+	c.protocol = protocolEnvelope
+
+	control := func(action, channel string) Envelope {
+		t.Helper()
+		c.handleControl("c-1", controlMessage{Action: action, Channel: channel})
+		var env Envelope
+		json.Unmarshal((<-c.send).data, &env)
+		return env
+	}
+
+	if env := control("subscribe", "project:2"); env.Type != TypeError {
+		t.Errorf("expected forbidden subscription to fail, got %+v", env)
+	}
+	if env := control("subscribe", "project:1"); env.Type != TypeControl || env.ID != "c-1" {
+		t.Errorf("expected subscription to be confirmed, got %+v", env)
+	}
+
+	if n := h.Publish("project:1", []byte(`{"event":"task_created"}`)); n != 1 {
+		t.Fatalf("expected 1 delivery, got %d", n)
+	}
+	var env Envelope
+	var event channelEvent
+	json.Unmarshal((<-c.send).data, &env)
+	json.Unmarshal(env.Payload, &event)
+	if env.Type != TypeChannel || event.Channel != "project:1" || string(event.Data) != `{"event":"task_created"}` {
+		t.Errorf("unexpected channel message %+v", env)
+	}
+
+	control("unsubscribe", "project:1")
+	if n := h.Publish("project:1", []byte(`{}`)); n != 0 {
+		t.Errorf("expected no deliveries after unsubscribe, got %d", n)
+	}
+
+	control("subscribe", "project:1")
+	removeTestClient(c)
+	if _, ok := c.shard().channelClients["project:1"]; ok {
+		t.Error("expected removed client to leave its channels")
+	}
+}
@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/neuronai/backend/go/internal/grpc"
+)
+
+// Clients describe themselves with the X-Client-Device, X-Client-Version and
+// X-Client-Locale headers on the upgrade request, or, when they cannot set
+// headers, a client object in their auth frame. The locale defaults to the
+// first Accept-Language tag. The description is logged with the client's
+// failures, forwarded to the Python service as gRPC metadata and listed by
+// /admin/connections, to track down client-specific issues.
+
+// requestClientInfo returns the client description from the upgrade
+// request's headers.
+func requestClientInfo(r *http.Request) grpc.ClientInfo {
+	info := grpc.ClientInfo{
+		Device:  r.Header.Get("X-Client-Device"),
+		Version: r.Header.Get("X-Client-Version"),
+		Locale:  r.Header.Get("X-Client-Locale"),
+	}
+	if info.Locale == "" {
+		info.Locale = acceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	return info.Sanitize()
+}
+
+// acceptLanguage returns the first language tag of an Accept-Language header,
+// or "" for none or the wildcard.
+func acceptLanguage(header string) string {
+	tag, _, _ := strings.Cut(header, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
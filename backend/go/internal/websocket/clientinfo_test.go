@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataAIService records the incoming metadata of each stream and answers
+// with a final response.
+type metadataAIService struct {
+	pb.UnimplementedAIServiceServer
+	received chan metadata.MD
+}
+
+func (s *metadataAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.received <- md
+	return stream.Send(&pb.StreamResponse{
+		SessionId: req.SessionId,
+		Payload: &pb.StreamResponse_Chat{Chat: &pb.ChatResponse{
+			MessageId: "msg-1",
+			SessionId: req.SessionId,
+			IsFinal:   true,
+		}},
+	})
+}
+
+func TestHandleWebSocket_ClientInfo(t *testing.T) {
+	upstream := &metadataAIService{received: make(chan metadata.MD, 1)}
+	h := NewHub(startUpstream(t, upstream), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+	srv := newHubServer(t, h)
+
+	header := http.Header{
+		"X-Client-Device":  {"ios"},
+		"X-Client-Version": {"2.3.1"},
+		"Accept-Language":  {"de-DE,de;q=0.9,en;q=0.8"},
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+signToken(t, testSecret, "user-1")), header)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	conns := h.Connections()
+	if len(conns) != 1 || conns[0].Device != "ios" || conns[0].ClientVersion != "2.3.1" || conns[0].Locale != "de-DE" {
+		t.Fatalf("unexpected connections %+v", conns)
+	}
+
+	if err := conn.WriteJSON(map[string]string{"content": "Hi"}); err != nil {
+		t.Fatalf("Failed to write chat: %v", err)
+	}
+	md := <-upstream.received
+	if got := md.Get(grpc.MetadataClientDevice); len(got) != 1 || got[0] != "ios" {
+		t.Errorf("expected device metadata ios, got %v", got)
+	}
+	if got := md.Get(grpc.MetadataClientLocale); len(got) != 1 || got[0] != "de-DE" {
+		t.Errorf("expected locale metadata de-DE, got %v", got)
+	}
+}
+
+func TestHandleWebSocket_ClientInfoAuthFrame(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret))
+
+	header := http.Header{"X-Client-Locale": {"fr-FR"}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1"), header)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	frame := authFrame{
+		Type:   "auth",
+		Token:  signToken(t, testSecret, "user-1"),
+		Client: &grpc.ClientInfo{Device: "web", Version: "1.0\n", Locale: "en-US"},
+	}
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatalf("Failed to write auth frame: %v", err)
+	}
+	waitForSession(t, h, "user-1", "s1")
+
+	// The headers take precedence over the auth frame.
+	conns := h.Connections()
+	if len(conns) != 1 || conns[0].Device != "web" || conns[0].ClientVersion != "1.0" || conns[0].Locale != "fr-FR" {
+		t.Fatalf("unexpected connections %+v", conns)
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                 "",
+		"*":                "",
+		"en-GB":            "en-GB",
+		" pt-BR;q=0.9, en": "pt-BR",
+		"da, en-gb;q=0.8":  "da",
+	}
+	for header, want := range tests {
+		if got := acceptLanguage(header); got != want {
+			t.Errorf("acceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
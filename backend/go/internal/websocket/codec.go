@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Chat requests and responses are protobuf messages, so they are encoded with
+// protojson rather than encoding/json, whose view of the generated structs
+// does not follow the protobuf JSON mapping: requests may use camelCase field
+// names and enum names, and response timestamps are RFC 3339 strings.
+// Responses keep the proto field names and numeric enums clients rely on.
+
+var (
+	marshalJSON = protojson.MarshalOptions{UseProtoNames: true, UseEnumNumbers: true}
+	// unmarshalJSON skips unknown fields, such as the gateway's own fields
+	// sent alongside a ChatRequest.
+	unmarshalJSON = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// bufferPool holds the scratch buffers envelopes are encoded into.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// marshalResponse encodes a ChatResponse for text-frame clients.
+func marshalResponse(resp *pb.ChatResponse) []byte {
+	data, _ := marshalJSON.Marshal(resp)
+	return data
+}
+
+// unmarshalResponse decodes a ChatResponse encoded by marshalResponse, or by
+// encoding/json, as older instances publish to the backplane.
+func unmarshalResponse(data []byte, resp *pb.ChatResponse) error {
+	if err := unmarshalJSON.Unmarshal(data, resp); err == nil {
+		return nil
+	}
+	resp.Reset()
+	return json.Unmarshal(data, resp)
+}
+
+// encodeEnvelope encodes env as json.Marshal would, without reflection and
+// without re-validating the payload, which the hub encoded itself.
+func encodeEnvelope(env Envelope) []byte {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	buf.WriteString(`{"v":`)
+	buf.WriteString(strconv.Itoa(env.V))
+	buf.WriteString(`,"type":`)
+	writeJSONString(buf, env.Type)
+	if env.ID != "" {
+		buf.WriteString(`,"id":`)
+		writeJSONString(buf, env.ID)
+	}
+	if env.StreamID != "" {
+		buf.WriteString(`,"stream_id":`)
+		writeJSONString(buf, env.StreamID)
+	}
+	if env.SessionID != "" {
+		buf.WriteString(`,"session_id":`)
+		writeJSONString(buf, env.SessionID)
+	}
+	if env.Seq != 0 {
+		buf.WriteString(`,"seq":`)
+		buf.WriteString(strconv.FormatUint(env.Seq, 10))
+	}
+	if len(env.Payload) > 0 {
+		buf.WriteString(`,"payload":`)
+		buf.Write(env.Payload)
+	}
+	buf.WriteByte('}')
+	return bytes.Clone(buf.Bytes())
+}
+
+// writeJSONString writes s as a JSON string, replacing invalid UTF-8 as
+// encoding/json does.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case b < 0x20:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xf])
+			default:
+				buf.WriteByte(b)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(`�`)
+		} else {
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
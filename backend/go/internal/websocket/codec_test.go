@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEncodeEnvelope(t *testing.T) {
+	tests := []Envelope{
+		{V: 1, Type: TypeAck, ID: "c-1", SessionID: "s1"},
+		{V: 1, Type: TypeChat, StreamID: "c-1", SessionID: "s1", Seq: 42, Payload: json.RawMessage(`{"content":"Hi"}`)},
+		{V: 1, Type: TypeError, ID: "quote\"back\\slash\nnewline\x01", SessionID: "bad\xffutf8 ünïcode"},
+		{V: 1, Type: TypeControl},
+	}
+
+	for _, env := range tests {
+		want, err := json.Marshal(env)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		got := encodeEnvelope(env)
+
+		var wantValue, gotValue any
+		json.Unmarshal(want, &wantValue)
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatalf("encodeEnvelope() produced invalid JSON %s: %v", got, err)
+		}
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("encodeEnvelope() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestClient_ParseChatProtoJSON(t *testing.T) {
+	c := &Client{userID: "u1", sessionID: "s1"}
+
+	tests := []struct {
+		name string
+		data string
+		want pb.MessageType
+	}{
+		{"proto names", `{"content":"Hi","message_type":4}`, pb.MessageType_MESSAGE_TYPE_CODE},
+		{"json names and enum names", `{"content":"Hi","messageType":"MESSAGE_TYPE_CODE"}`, pb.MessageType_MESSAGE_TYPE_CODE},
+		{"gateway fields", `{"content":"Hi","temperature":0.5,"attachments":[{"id":"a1","kind":"image","mime":"image/png","size":10}]}`, pb.MessageType_MESSAGE_TYPE_UNSPECIFIED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, refs, err := c.parseChat([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseChat() error = %v", err)
+			}
+			if req.Content != "Hi" || req.MessageType != tt.want || req.UserId != "u1" || req.SessionId != "s1" {
+				t.Errorf("unexpected request %v", req)
+			}
+			if len(req.Attachments) != 0 {
+				t.Errorf("expected attachment references kept out of the request, got %v", req.Attachments)
+			}
+			if strings.Contains(tt.data, "attachments") && len(refs) != 1 {
+				t.Errorf("expected 1 attachment reference, got %v", refs)
+			}
+		})
+	}
+
+	if _, _, err := c.parseChat([]byte(`{"content":5}`)); err == nil {
+		t.Error("expected error for mistyped content")
+	}
+}
+
+func TestSessionMessage_JSON(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &sessionMessage{resp: &pb.ChatResponse{
+		MessageId: "m1",
+		Content:   "Hi",
+		AgentType: pb.AgentType_AGENT_TYPE_ORCHESTRATOR,
+		Timestamp: timestamppb.New(ts),
+		IsFinal:   true,
+	}}
+
+	var got map[string]any
+	if err := json.Unmarshal(m.JSON(), &got); err != nil {
+		t.Fatalf("Failed to unmarshal %s: %v", m.JSON(), err)
+	}
+	if got["message_id"] != "m1" || got["agent_type"] != float64(pb.AgentType_AGENT_TYPE_ORCHESTRATOR) || got["is_final"] != true || got["timestamp"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected encoding %s", m.JSON())
+	}
+
+	// Backplane messages from older instances are encoding/json encoded.
+	legacy, _ := json.Marshal(m.resp)
+	resp := (&sessionMessage{json: legacy}).chat()
+	if resp == nil || resp.MessageId != "m1" || !resp.Timestamp.AsTime().Equal(ts) {
+		t.Errorf("expected legacy encoding decoded, got %v", resp)
+	}
+}
+
+func BenchmarkClient_ParseChat(b *testing.B) {
+	c := &Client{userID: "u1", sessionID: "s1"}
+	data := []byte(`{"content":"Summarize this thread","message_type":1,"temperature":0.7,"metadata":{"source":"web"}}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := c.parseChat(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSessionMessage_Frame encodes a response once and frames it for
+// each envelope client in the session.
+func BenchmarkSessionMessage_Frame(b *testing.B) {
+	resp := &pb.ChatResponse{
+		MessageId: "m1",
+		SessionId: "s1",
+		Content:   strings.Repeat("token ", 8),
+		AgentType: pb.AgentType_AGENT_TYPE_ORCHESTRATOR,
+		Timestamp: timestamppb.Now(),
+	}
+
+	for _, clients := range []int{1, 10} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			c := &Client{sessionID: "s1", protocol: protocolEnvelope}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := &sessionMessage{resp: resp}
+				for j := 0; j < clients; j++ {
+					c.frameSession(uint64(i+1), m)
+				}
+			}
+		})
+	}
+}
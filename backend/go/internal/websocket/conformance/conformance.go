@@ -0,0 +1,279 @@
+// Package conformance replays golden WebSocket transcripts so that client SDKs
+// can be validated against the gateway wire protocol without a running Python
+// backend.
+package conformance
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed transcripts/*.json
+var transcriptFS embed.FS
+
+const stepTimeout = 5 * time.Second
+
+type Direction string
+
+const (
+	FromClient Direction = "client"
+	FromServer Direction = "server"
+)
+
+// Step is one WebSocket text frame in a transcript. The gateway coalesces
+// queued messages into a single frame separated by '\n', so a step may carry
+// more than one JSON message.
+type Step struct {
+	Direction Direction         `json:"direction"`
+	Messages  []json.RawMessage `json:"messages"`
+	// Ignore lists top-level fields that differ between runs (ids, timestamps)
+	// and are therefore not compared.
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+type Transcript struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Query       map[string]string `json:"query"`
+	Steps       []Step            `json:"steps"`
+}
+
+// Load returns the embedded transcript with the given name.
+func Load(name string) (*Transcript, error) {
+	data, err := transcriptFS.ReadFile(path.Join("transcripts", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("transcript %q not found: %w", name, err)
+	}
+
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid transcript %q: %w", name, err)
+	}
+	if t.Name == "" {
+		t.Name = name
+	}
+
+	return &t, nil
+}
+
+// All returns every embedded transcript sorted by name.
+func All() ([]*Transcript, error) {
+	entries, err := transcriptFS.ReadDir("transcripts")
+	if err != nil {
+		return nil, err
+	}
+
+	transcripts := make([]*Transcript, 0, len(entries))
+	for _, entry := range entries {
+		t, err := Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		transcripts = append(transcripts, t)
+	}
+
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].Name < transcripts[j].Name
+	})
+
+	return transcripts, nil
+}
+
+// Server plays the gateway side of a transcript. Point a client SDK at it and
+// call Wait to learn whether the client behaved as the transcript expects.
+type Server struct {
+	transcript *Transcript
+	upgrader   websocket.Upgrader
+	done       chan struct{}
+	once       sync.Once
+	err        error
+}
+
+func NewServer(t *Transcript) *Server {
+	return &Server{
+		transcript: t,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		done: make(chan struct{}),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for key, want := range s.transcript.Query {
+		if got := r.URL.Query().Get(key); got != want {
+			s.finish(fmt.Errorf("query parameter %q: expected %q, got %q", key, want, got))
+			http.Error(w, "Unexpected query parameters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.finish(fmt.Errorf("upgrade failed: %w", err))
+		return
+	}
+	defer conn.Close()
+
+	err = run(conn, s.transcript, FromServer, true)
+	closeCode := websocket.CloseNormalClosure
+	closeText := ""
+	if err != nil {
+		closeCode = websocket.CloseProtocolError
+		closeText = err.Error()
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeCode, closeText),
+		time.Now().Add(time.Second))
+
+	s.finish(err)
+}
+
+// Wait blocks until the transcript has been played to completion or the
+// timeout elapses, and returns the first deviation observed.
+func (s *Server) Wait(timeout time.Duration) error {
+	select {
+	case <-s.done:
+		return s.err
+	case <-time.After(timeout):
+		return fmt.Errorf("transcript %q did not complete within %v", s.transcript.Name, timeout)
+	}
+}
+
+func (s *Server) finish(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+// Play drives the client side of a transcript over conn. It is the reference
+// client used to check the transcripts themselves.
+func Play(conn *websocket.Conn, t *Transcript) error {
+	return run(conn, t, FromClient, true)
+}
+
+// PlayMessages is Play without frame boundaries: the server's messages must
+// arrive in the transcript's order, but may be coalesced into frames
+// differently. The gateway coalesces whatever is queued when it writes, so
+// its frame boundaries depend on timing; the Hub is checked with this.
+func PlayMessages(conn *websocket.Conn, t *Transcript) error {
+	return run(conn, t, FromClient, false)
+}
+
+// run plays every step authored by side and verifies every step authored by
+// the peer, frame by frame if framed is set.
+func run(conn *websocket.Conn, t *Transcript, side Direction, framed bool) error {
+	r := &reader{conn: conn, framed: framed}
+	for i, step := range t.Steps {
+		if step.Direction == side {
+			if err := writeStep(conn, step); err != nil {
+				return fmt.Errorf("%s step %d: %w", t.Name, i, err)
+			}
+			continue
+		}
+
+		if err := r.readStep(step); err != nil {
+			return fmt.Errorf("%s step %d: %w", t.Name, i, err)
+		}
+	}
+	return nil
+}
+
+func writeStep(conn *websocket.Conn, step Step) error {
+	frame := make([][]byte, len(step.Messages))
+	for i, msg := range step.Messages {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, msg); err != nil {
+			return fmt.Errorf("invalid message %d: %w", i, err)
+		}
+		frame[i] = compact.Bytes()
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(stepTimeout))
+	return conn.WriteMessage(websocket.TextMessage, bytes.Join(frame, []byte{'\n'}))
+}
+
+// reader reads the peer's messages. Unless framed, messages left over from
+// one frame are matched against the next step.
+type reader struct {
+	conn    *websocket.Conn
+	framed  bool
+	pending [][]byte
+}
+
+func (r *reader) readFrame(step Step) ([][]byte, error) {
+	r.conn.SetReadDeadline(time.Now().Add(stepTimeout))
+	_, data, err := r.conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("expected frame from %s: %w", step.Direction, err)
+	}
+	return bytes.Split(data, []byte{'\n'}), nil
+}
+
+func (r *reader) readStep(step Step) error {
+	if r.framed {
+		got, err := r.readFrame(step)
+		if err != nil {
+			return err
+		}
+		if len(got) != len(step.Messages) {
+			return fmt.Errorf("expected %d messages in frame, got %d", len(step.Messages), len(got))
+		}
+		r.pending = got
+	}
+
+	for i := range step.Messages {
+		for len(r.pending) == 0 {
+			got, err := r.readFrame(step)
+			if err != nil {
+				return err
+			}
+			r.pending = got
+		}
+		if err := compare(step.Messages[i], r.pending[0], step.Ignore); err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		r.pending = r.pending[1:]
+	}
+	return nil
+}
+
+// compare reports whether two JSON documents are semantically equal once the
+// ignored top-level fields have been dropped from both.
+func compare(want, got []byte, ignore []string) error {
+	var wantValue, gotValue interface{}
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		return fmt.Errorf("invalid expected message: %w", err)
+	}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		return fmt.Errorf("invalid message %s: %w", got, err)
+	}
+
+	for _, field := range ignore {
+		if m, ok := wantValue.(map[string]interface{}); ok {
+			delete(m, field)
+		}
+		if m, ok := gotValue.(map[string]interface{}); ok {
+			delete(m, field)
+		}
+	}
+
+	if !reflect.DeepEqual(wantValue, gotValue) {
+		return fmt.Errorf("expected %s, got %s", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package conformance
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialServer(t *testing.T, srv *httptest.Server, query map[string]string) *websocket.Conn {
+	t.Helper()
+
+	values := url.Values{}
+	for k, v := range query {
+		values.Set(k, v)
+	}
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "?" + values.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial conformance server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestTranscripts_ReferenceClient(t *testing.T) {
+	transcripts, err := All()
+	if err != nil {
+		t.Fatalf("Failed to load transcripts: %v", err)
+	}
+	if len(transcripts) == 0 {
+		t.Fatal("Expected at least one transcript")
+	}
+
+	for _, tr := range transcripts {
+		t.Run(tr.Name, func(t *testing.T) {
+			server := NewServer(tr)
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			conn := dialServer(t, srv, tr.Query)
+
+			if err := Play(conn, tr); err != nil {
+				t.Errorf("Play() error = %v", err)
+			}
+			if err := server.Wait(5 * time.Second); err != nil {
+				t.Errorf("Server reported deviation: %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_DetectsDeviation(t *testing.T) {
+	tr, err := Load("chat_single")
+	if err != nil {
+		t.Fatalf("Failed to load transcript: %v", err)
+	}
+
+	server := NewServer(tr)
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	conn := dialServer(t, srv, tr.Query)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"content":"Goodbye","message_type":1}`)); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	if err := server.Wait(5 * time.Second); err == nil {
+		t.Error("Expected deviation to be reported")
+	}
+}
+
+func TestServer_RejectsUnexpectedQuery(t *testing.T) {
+	tr, err := Load("chat_single")
+	if err != nil {
+		t.Fatalf("Failed to load transcript: %v", err)
+	}
+
+	server := NewServer(tr)
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "?token=someone-else"
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		t.Error("Expected dial to fail")
+	}
+
+	if err := server.Wait(5 * time.Second); err == nil {
+		t.Error("Expected deviation to be reported")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		got     string
+		ignore  []string
+		wantErr bool
+	}{
+		{"identical", `{"a":1,"b":"x"}`, `{"a":1,"b":"x"}`, nil, false},
+		{"key order and whitespace", `{"a": 1, "b": "x"}`, `{"b":"x","a":1}`, nil, false},
+		{"different value", `{"a":1}`, `{"a":2}`, nil, true},
+		{"extra field", `{"a":1}`, `{"a":1,"b":2}`, nil, true},
+		{"ignored field", `{"a":1,"id":"x"}`, `{"a":1,"id":"y"}`, []string{"id"}, false},
+		{"invalid json", `{"a":1}`, `not json`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compare(json.RawMessage(tt.want), []byte(tt.got), tt.ignore)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/websocket"
+	googlegrpc "google.golang.org/grpc"
+)
+
+const hubSecret = "conformance-secret"
+
+// transcriptToken is the placeholder token the transcripts authenticate with.
+const transcriptToken = "test-token"
+
+// stubAIService answers the prompts the transcripts send with the responses
+// they expect.
+type stubAIService struct {
+	pb.UnimplementedAIServiceServer
+}
+
+var stubReplies = map[string][]*pb.ChatResponse{
+	"Hello": {
+		{Content: "Hi there", AgentType: pb.AgentType(1), Status: pb.TaskStatus(3), IsFinal: true},
+	},
+	"Tell me a story": {
+		{Content: "Once", AgentType: pb.AgentType(3), Status: pb.TaskStatus(2)},
+		{Content: " upon", AgentType: pb.AgentType(3), Status: pb.TaskStatus(2)},
+		{Content: " a time.", AgentType: pb.AgentType(3), Status: pb.TaskStatus(3), IsFinal: true},
+	},
+}
+
+func (s *stubAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, reply := range stubReplies[req.GetChat().GetContent()] {
+			resp := &pb.ChatResponse{
+				MessageId: "msg-1",
+				SessionId: req.SessionId,
+				Content:   reply.Content,
+				AgentType: reply.AgentType,
+				Status:    reply.Status,
+				IsFinal:   reply.IsFinal,
+			}
+			if err := stream.Send(&pb.StreamResponse{
+				SessionId: req.SessionId,
+				Payload:   &pb.StreamResponse_Chat{Chat: resp},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func startStubAIService(t *testing.T) *grpc.PythonClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := googlegrpc.NewServer()
+	pb.RegisterAIServiceServer(s, &stubAIService{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	client, err := grpc.NewPythonClient(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func signHubToken(t *testing.T, userID string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(hubSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+// withToken returns tr with its placeholder token replaced by token, in the
+// query and in the messages the client sends.
+func withToken(tr *Transcript, token string) *Transcript {
+	out := *tr
+	out.Query = make(map[string]string, len(tr.Query))
+	for k, v := range tr.Query {
+		if v == transcriptToken {
+			v = token
+		}
+		out.Query[k] = v
+	}
+
+	quoted, _ := json.Marshal(transcriptToken)
+	replacement, _ := json.Marshal(token)
+	out.Steps = make([]Step, len(tr.Steps))
+	for i, step := range tr.Steps {
+		if step.Direction == FromClient {
+			messages := make([]json.RawMessage, len(step.Messages))
+			for j, msg := range step.Messages {
+				messages[j] = bytes.ReplaceAll(msg, quoted, replacement)
+			}
+			step.Messages = messages
+		}
+		out.Steps[i] = step
+	}
+	return &out
+}
+
+// TestTranscripts_Hub plays every transcript against the gateway's Hub, so
+// the golden frames cannot drift from what it actually sends.
+func TestTranscripts_Hub(t *testing.T) {
+	transcripts, err := All()
+	if err != nil {
+		t.Fatalf("Failed to load transcripts: %v", err)
+	}
+
+	for _, tr := range transcripts {
+		t.Run(tr.Name, func(t *testing.T) {
+			opts := []websocket.Option{websocket.WithJWTSecret(hubSecret)}
+			if _, ok := tr.Query["resume"]; ok {
+				// Resume needs a replay buffer, as with WS_REPLAY_BUFFER set.
+				opts = append(opts, websocket.WithReplayBuffer(16, time.Minute))
+			}
+			h := websocket.NewHub(startStubAIService(t), opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go h.Run(ctx)
+
+			srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+			defer srv.Close()
+
+			tr := withToken(tr, signHubToken(t, "user-1"))
+			conn := dialServer(t, srv, tr.Query)
+			if err := PlayMessages(conn, tr); err != nil {
+				t.Errorf("PlayMessages() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+// errTooManyConnections rejects a connection over the per-user or per-instance
+// cap.
+var errTooManyConnections = errors.New("too many connections")
+
+// overCapacityMessage closes connections admitted past a connection cap by a
+// concurrent upgrade.
+var overCapacityMessage = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many connections")
+
+// WithConnectionLimits caps the concurrent connections of each user at
+// perUser and of the instance at total. Zero leaves that cap off.
+func WithConnectionLimits(perUser, total int) Option {
+	return func(h *Hub) {
+		h.maxUserConns = perUser
+		h.maxConns = total
+	}
+}
+
+// checkConnectionLimits reports whether one more connection for userID would
+// exceed a cap. An empty userID checks only the instance cap, for connections
+// that authenticate after upgrading. The caller must hold connsMu.
+func (h *Hub) checkConnectionLimits(userID string) error {
+	if h.maxConns > 0 && h.conns >= h.maxConns {
+		metrics.ObserveThrottled(metrics.LimitConnections)
+		return errTooManyConnections
+	}
+	if userID != "" && h.maxUserConns > 0 && h.userConns[userID] >= h.maxUserConns {
+		metrics.ObserveThrottled(metrics.LimitUserConnections)
+		return errTooManyConnections
+	}
+	return nil
+}
+
+// rejectOverCapacity answers an upgrade request over a connection cap.
+func (h *Hub) rejectOverCapacity(w http.ResponseWriter, userID string) bool {
+	h.connsMu.Lock()
+	err := h.checkConnectionLimits(userID)
+	h.connsMu.Unlock()
+	if err == nil {
+		return false
+	}
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "Too many connections", http.StatusTooManyRequests)
+	return true
+}
+
+// reserveConnection counts a connection for userID unless it would exceed a
+// cap. Connections are counted across shards, so two shards cannot both take
+// the last slot.
+func (h *Hub) reserveConnection(userID string) error {
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+
+	if err := h.checkConnectionLimits(userID); err != nil {
+		return err
+	}
+	h.conns++
+	h.userConns[userID]++
+	return nil
+}
+
+// releaseConnection uncounts a connection of userID.
+func (h *Hub) releaseConnection(userID string) {
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+
+	h.conns--
+	if h.userConns[userID]--; h.userConns[userID] <= 0 {
+		delete(h.userConns, userID)
+	}
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHandleWebSocket_ConnectionLimits(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithConnectionLimits(1, 2))
+	alice := signToken(t, testSecret, "alice")
+	bob := signToken(t, testSecret, "bob")
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+alice), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer first.Close()
+	waitForSession(t, h, "alice", "s1")
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s2&token="+alice), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected second connection of a user refused with 429, got %v", err)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	second, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s3&token="+bob), nil)
+	if err != nil {
+		t.Fatalf("expected another user to connect, got %v", err)
+	}
+	defer second.Close()
+	waitForSession(t, h, "bob", "s3")
+
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s4&token="+signToken(t, testSecret, "carol")), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected connection over the instance cap refused with 429, got %v", err)
+	}
+}
+
+func TestHandleWebSocket_ConnectionLimitAfterAuthFrame(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithConnectionLimits(1, 0))
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer first.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s2"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(authFrame{Type: "auth", Token: signToken(t, testSecret, "user-1")}); err != nil {
+		t.Fatalf("Failed to write auth frame: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var closeErr *websocket.CloseError
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater {
+		t.Errorf("expected connection closed with %d, got %v", websocket.CloseTryAgainLater, err)
+	}
+}
@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// Envelope clients steer their chats in flight with control actions: pause
+// holds back a chat's responses until resume, and switch_agent hands the
+// connection's later chats to another agent. Each action is also relayed to
+// the Python service on the chats' bidi gRPC streams, so the agent can pause
+// generation or hand off mid-turn. While a chat is paused the hub stops
+// receiving from its stream, and gRPC flow control holds back the agent once
+// the stream's window fills.
+
+// StreamControl pauses and resumes a chat and relays control actions to its
+// upstream stream once the chat has been sent. A nil StreamControl never
+// pauses.
+type StreamControl struct {
+	mu sync.Mutex
+	// resumed is closed when a pause ends; nil when not paused.
+	resumed  chan struct{}
+	upstream *grpc.StreamClient
+}
+
+// Pause holds back the chat's responses until Resume.
+func (s *StreamControl) Pause() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed != nil {
+		return nil
+	}
+	s.resumed = make(chan struct{})
+	return s.relay(grpc.ControlPause, nil)
+}
+
+// Resume delivers the chat's responses again.
+func (s *StreamControl) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed == nil {
+		return nil
+	}
+	close(s.resumed)
+	s.resumed = nil
+	return s.relay(grpc.ControlResume, nil)
+}
+
+// Relay sends a control action to the chat's upstream stream, if the chat has
+// been sent.
+func (s *StreamControl) Relay(action string, metadata map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.relay(action, metadata)
+}
+
+// relay is Relay with mu held.
+func (s *StreamControl) relay(action string, metadata map[string]string) error {
+	if s.upstream == nil {
+		return nil
+	}
+	return s.upstream.SendControl(action, metadata)
+}
+
+// attach binds the chat's upstream stream, telling it if the chat was paused
+// before it was sent.
+func (s *StreamControl) attach(upstream *grpc.StreamClient) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upstream = upstream
+	if s.resumed != nil {
+		return s.relay(grpc.ControlPause, nil)
+	}
+	return nil
+}
+
+// wait blocks while the chat is paused, or until ctx is done.
+func (s *StreamControl) wait(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	resumed := s.resumed
+	s.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// controlStream handles a pause or resume control action for the chat
+// streamID.
+func (c *Client) controlStream(id, action, streamID string) {
+	if streamID == "" {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("stream_id is required"))
+		return
+	}
+	control := c.cancels.control(streamID)
+	if control == nil {
+		c.sendError(id, ErrCodeUnknownStream, fmt.Errorf("no chat %q in flight", streamID))
+		return
+	}
+
+	var err error
+	reply := "paused"
+	if action == grpc.ControlPause {
+		err = control.Pause()
+	} else {
+		err = control.Resume()
+		reply = "resumed"
+	}
+	if err != nil {
+		c.sendError(id, ErrCodeAgentError, fmt.Errorf("failed to %s chat: %w", action, err))
+		return
+	}
+
+	payload, _ := json.Marshal(controlMessage{Action: reply, StreamID: streamID})
+	c.push(c.frameEnvelope(Envelope{Type: TypeControl, ID: id, StreamID: streamID, Payload: payload}))
+}
+
+// switchAgent handles a switch_agent control action: the connection's later
+// chats target agent, and its chats in flight are told to hand off.
+func (c *Client) switchAgent(id, agent string) {
+	t := grpc.ParseAgentType(agent)
+	if t == pb.AgentType_AGENT_TYPE_UNSPECIFIED {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("unknown agent %q", agent))
+		return
+	}
+	c.agent.Store(int32(t))
+
+	name := grpc.AgentTypeName(t)
+	for _, control := range c.cancels.controls() {
+		if err := control.Relay(grpc.ControlSwitchAgent, map[string]string{grpc.MetadataAgent: name}); err != nil {
+			c.sendError(id, ErrCodeAgentError, fmt.Errorf("failed to switch agent: %w", err))
+			return
+		}
+	}
+
+	payload, _ := json.Marshal(controlMessage{Action: "agent_switched", Agent: name})
+	c.push(c.frame(TypeControl, id, payload))
+}
+
+// applyAgent targets req at the agent the client switched to, if any.
+func (c *Client) applyAgent(req *pb.ChatRequest) {
+	t := pb.AgentType(c.agent.Load())
+	if t == pb.AgentType_AGENT_TYPE_UNSPECIFIED {
+		return
+	}
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]string)
+	}
+	req.Metadata[grpc.MetadataAgent] = grpc.AgentTypeName(t)
+}
@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+)
+
+// controlAIService records every chat and control message it receives. It
+// answers a chat with a partial response, and a pause with the rest of the
+// chat, which the hub must hold back until resume.
+type controlAIService struct {
+	pb.UnimplementedAIServiceServer
+	received chan *pb.ChatRequest
+}
+
+func (s *controlAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	send := func(content string, final bool) error {
+		return stream.Send(&pb.StreamResponse{
+			SessionId: "s1",
+			Payload: &pb.StreamResponse_Chat{Chat: &pb.ChatResponse{
+				MessageId: "msg-1",
+				SessionId: "s1",
+				Content:   content,
+				IsFinal:   final,
+			}},
+		})
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		chat := req.GetChat()
+		s.received <- chat
+
+		switch chat.Metadata[grpc.MetadataControl] {
+		case "":
+			if err := send("one", false); err != nil {
+				return err
+			}
+		case grpc.ControlPause:
+			if err := send("two", false); err != nil {
+				return err
+			}
+			if err := send("three", true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestClient_StreamControl(t *testing.T) {
+	upstream := &controlAIService{received: make(chan *pb.ChatRequest, 8)}
+	h := NewHub(startUpstream(t, upstream), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	control := func(id string, ctrl controlMessage) (Envelope, controlMessage) {
+		t.Helper()
+		payload, _ := json.Marshal(ctrl)
+		if err := conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: id, Payload: payload}); err != nil {
+			t.Fatalf("Failed to write control: %v", err)
+		}
+		env := readEnvelope(t, conn)
+		var reply controlMessage
+		json.Unmarshal(env.Payload, &reply)
+		return env, reply
+	}
+	upstreamGot := func() *pb.ChatRequest {
+		t.Helper()
+		select {
+		case chat := <-upstream.received:
+			return chat
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a message upstream")
+			return nil
+		}
+	}
+	content := func(env Envelope) string {
+		var resp pb.ChatResponse
+		json.Unmarshal(env.Payload, &resp)
+		return resp.Content
+	}
+
+	if env, reply := control("x-1", controlMessage{Action: "switch_agent", Agent: "poet"}); env.Type != TypeError {
+		t.Errorf("expected error for an unknown agent, got %+v with %+v", env, reply)
+	}
+	if _, reply := control("x-2", controlMessage{Action: "switch_agent", Agent: "code"}); reply.Action != "agent_switched" || reply.Agent != "code" {
+		t.Errorf("expected agent_switched reply, got %+v", reply)
+	}
+
+	if err := conn.WriteJSON(Envelope{V: 1, Type: TypeChat, ID: "c-1", Payload: json.RawMessage(`{"content":"Write a parser"}`)}); err != nil {
+		t.Fatalf("Failed to write chat: %v", err)
+	}
+	if chat := upstreamGot(); chat.Content != "Write a parser" || chat.Metadata[grpc.MetadataAgent] != "code" {
+		t.Errorf("expected chat targeted at the code agent, got %v", chat)
+	}
+	if envs := readEnvelopes(t, conn, 2); envs[0].Type != TypeAck || content(envs[1]) != "one" {
+		t.Fatalf("expected ack and first chunk, got %+v", envs)
+	}
+
+	env, reply := control("x-3", controlMessage{Action: "pause", StreamID: "c-1"})
+	if env.StreamID != "c-1" || reply.Action != "paused" {
+		t.Fatalf("expected paused reply, got %+v", env)
+	}
+	if chat := upstreamGot(); chat.Metadata[grpc.MetadataControl] != grpc.ControlPause {
+		t.Errorf("expected pause relayed upstream, got %v", chat)
+	}
+
+	// The rest of the chat is held back while paused: a ping sent after the
+	// upstream answered the pause is answered first.
+	time.Sleep(100 * time.Millisecond)
+	if _, reply := control("x-4", controlMessage{Action: "ping"}); reply.Action != "pong" {
+		t.Fatalf("expected pong before the held back chunks, got %+v", reply)
+	}
+
+	if payload, _ := json.Marshal(controlMessage{Action: "resume", StreamID: "c-1"}); conn.WriteJSON(Envelope{V: 1, Type: TypeControl, ID: "x-5", Payload: payload}) != nil {
+		t.Fatal("Failed to write resume")
+	}
+	var chunks []string
+	resumed := false
+	for _, env := range readEnvelopes(t, conn, 3) {
+		switch env.Type {
+		case TypeChat:
+			chunks = append(chunks, content(env))
+		case TypeControl:
+			var reply controlMessage
+			json.Unmarshal(env.Payload, &reply)
+			resumed = env.ID == "x-5" && reply.Action == "resumed"
+		}
+	}
+	if !resumed || len(chunks) != 2 || chunks[0] != "two" || chunks[1] != "three" {
+		t.Errorf("expected resumed reply and the held back chunks, got resumed=%v chunks=%v", resumed, chunks)
+	}
+	if chat := upstreamGot(); chat.Metadata[grpc.MetadataControl] != grpc.ControlResume {
+		t.Errorf("expected resume relayed upstream, got %v", chat)
+	}
+
+	// The chat has finished.
+	env, _ = control("x-6", controlMessage{Action: "pause", StreamID: "c-1"})
+	var payload errorPayload
+	json.Unmarshal(env.Payload, &payload)
+	if env.Type != TypeError || payload.Code != ErrCodeUnknownStream {
+		t.Errorf("expected %s error, got %+v with payload %s", ErrCodeUnknownStream, env, env.Payload)
+	}
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrDraining is returned by Stream once the hub has started draining.
+var ErrDraining = errors.New("gateway is shutting down")
+
+// drainPollInterval is how often Drain checks for finished streams.
+const drainPollInterval = 50 * time.Millisecond
+
+// drainCloseMessage tells clients to reconnect, to another instance if they
+// are behind a load balancer.
+var drainCloseMessage = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting, reconnect")
+
+// Drain shuts the hub down gracefully: new connections and chats are
+// refused, idle connections are closed with a reconnect hint, and connections
+// with chats in flight are closed as soon as their streams finish. When ctx
+// is done first, the remaining connections are closed regardless and ctx's
+// error is returned.
+func (h *Hub) Drain(ctx context.Context) error {
+	h.draining.Store(true)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if h.closeIdle(false) == 0 && h.inflight.Load() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			h.closeIdle(true)
+			return ctx.Err()
+		}
+	}
+}
+
+// closeIdle closes the connections without chats in flight, or all of them
+// if force is set, and returns how many remain open.
+func (h *Hub) closeIdle(force bool) int {
+	remaining := 0
+	h.lockShards(func(s *shard) {
+		for c := range s.clients {
+			if force || c.streams.Load() == 0 {
+				c.closeMessage = drainCloseMessage
+				s.remove(c)
+			}
+		}
+		remaining += len(s.clients)
+	})
+	return remaining
+}
+
+// isDraining reports whether Drain has been called.
+func (h *Hub) isDraining() bool {
+	return h.draining.Load()
+}
@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/maintenance"
+)
+
+func TestHub_Drain(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret))
+	token := signToken(t, testSecret, "user-1")
+
+	idle, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer idle.Close()
+	busy, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s2&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer busy.Close()
+	waitForSession(t, h, "user-1", "s1")
+	waitForSession(t, h, "user-1", "s2")
+
+	// Pretend s2 has a chat in flight.
+	s := h.shardFor("s2")
+	s.mu.Lock()
+	for c := range s.sessionClients["s2"] {
+		c.streams.Add(1)
+	}
+	s.mu.Unlock()
+	h.inflight.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- h.Drain(ctx) }()
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = idle.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart {
+		t.Fatalf("expected idle connection closed with %d, got %v", websocket.CloseServiceRestart, err)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s3&token="+token), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected new connection refused with 503 while draining, got %v", err)
+	}
+	if err := h.Stream(ctx, &StreamRequest{}); !errors.Is(err, ErrDraining) {
+		t.Errorf("expected ErrDraining for new chat, got %v", err)
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("expected drain to wait for the busy connection, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s = h.shardFor("s2")
+	s.mu.Lock()
+	for c := range s.sessionClients["s2"] {
+		c.streams.Add(-1)
+	}
+	s.mu.Unlock()
+	h.inflight.Add(-1)
+
+	if err := <-drained; err != nil {
+		t.Errorf("expected drain to complete, got %v", err)
+	}
+	busy.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := busy.ReadMessage(); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart {
+		t.Errorf("expected busy connection closed with %d, got %v", websocket.CloseServiceRestart, err)
+	}
+}
+
+func TestHub_DrainTimeout(t *testing.T) {
+	h := NewHub(nil)
+	c := newTestClient(h, "u1", "s1", 1)
+	c.streams.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := h.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if _, ok := <-c.send; ok {
+		t.Error("expected the busy client to be closed after the timeout")
+	}
+}
+
+func TestHub_Maintenance(t *testing.T) {
+	m := maintenance.New(time.Minute)
+	h := NewHub(nil, WithMaintenance(m))
+
+	m.Enable(maintenance.SourceAdmin, "Back soon", 0)
+	err := h.Stream(context.Background(), &StreamRequest{})
+	if code := errorCode(err); code != ErrCodeMaintenance {
+		t.Fatalf("expected %s for a new chat, got %s (%v)", ErrCodeMaintenance, code, err)
+	}
+	if d := errorDetails(err); d["retry_after"] != "60" {
+		t.Errorf("unexpected details %v", d)
+	}
+}
@@ -0,0 +1,254 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/neuronai/backend/go/internal/grpc"
+	"github.com/neuronai/backend/go/internal/maintenance"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/scheduler"
+)
+
+// Wire protocol versions. Version 0 is the original bare-JSON protocol:
+// clients send chat messages and receive ChatResponse and event objects.
+// Version 1 wraps every frame in an Envelope. Version 2 is version 1 with
+// chats and session chat messages carried as binary protobuf frames (see
+// binary.go). A connection selects its version with the v query parameter.
+const (
+	protocolLegacy   = 0
+	protocolEnvelope = 1
+	protocolBinary   = 2
+)
+
+// Envelope message types.
+const (
+	TypeChat    = "chat"
+	TypeControl = "control"
+	TypeError   = "error"
+	TypeAck     = "ack"
+	// TypePresence and TypeActivity are server-only; see presence.go.
+	TypePresence = "presence"
+	TypeActivity = "activity"
+	// TypeNotification carries a notification pushed to all of a user's
+	// connections by another service.
+	TypeNotification = "notification"
+	// TypeChannel carries a message published to a subscribed channel; see
+	// channel.go.
+	TypeChannel = "channel"
+)
+
+// Envelope is a protocol v1 frame in either direction. Client chat and
+// control messages must carry an ID; the hub acks a chat by that ID once it
+// has been sent to the Python service, and echoes it on errors. A chat's ID
+// is also its stream ID: every hub frame produced by the chat, including the
+// session chat messages it streams, carries it as StreamID, so a client with
+// several chats in flight can attribute interleaved responses. Session chat
+// messages from the hub carry a Seq when the replay buffer is enabled.
+type Envelope struct {
+	V         int             `json:"v"`
+	Type      string          `json:"type"`
+	ID        string          `json:"id,omitempty"`
+	StreamID  string          `json:"stream_id,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// controlMessage is the payload of a client control envelope.
+type controlMessage struct {
+	Action string `json:"action"`
+	// Channel names the channel of subscribe and unsubscribe actions and
+	// their replies.
+	Channel string `json:"channel,omitempty"`
+	// StreamID names the chat, by envelope ID, of cancel actions and their
+	// replies.
+	StreamID string `json:"stream_id,omitempty"`
+	// Token is the new token of refresh_auth actions.
+	Token string `json:"token,omitempty"`
+	// Agent names the agent of switch_agent actions and their replies.
+	Agent string `json:"agent,omitempty"`
+}
+
+// errorPayload is the payload of an error envelope.
+type errorPayload struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// errorEvent is the error frame sent to legacy clients.
+type errorEvent struct {
+	Event string `json:"event"`
+	ID    string `json:"id,omitempty"`
+	errorPayload
+}
+
+// Error codes carried in error envelopes.
+const (
+	ErrCodeInvalidMessage     = "INVALID_MESSAGE"
+	ErrCodeUnsupportedControl = "UNSUPPORTED_CONTROL"
+	ErrCodeContentRejected    = "CONTENT_REJECTED"
+	ErrCodePreauthRejected    = "PREAUTH_REJECTED"
+	ErrCodeRequestBlocked     = "REQUEST_BLOCKED"
+	ErrCodeOverloaded         = "OVERLOADED"
+	ErrCodeRateLimited        = "RATE_LIMITED"
+	ErrCodeQuotaExceeded      = "QUOTA_EXCEEDED"
+	ErrCodeDraining           = "DRAINING"
+	ErrCodeMaintenance        = maintenance.CodeMaintenance
+	ErrCodeAgentError         = "AGENT_ERROR"
+)
+
+// parseEnvelope decodes a client v1 frame and checks the fields every
+// message needs.
+func parseEnvelope(data []byte, sessionID string) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if env.V != protocolEnvelope {
+		return &env, fmt.Errorf("unsupported envelope version %d", env.V)
+	}
+	if env.ID == "" {
+		return &env, fmt.Errorf("envelope id is required")
+	}
+	if env.SessionID != "" && env.SessionID != sessionID {
+		return &env, fmt.Errorf("session_id does not match the connection")
+	}
+	return &env, nil
+}
+
+// limitUserRequests is the limit of RATE_LIMITED errors for chats refused
+// because their user has the maximum in flight.
+const limitUserRequests = "user_requests"
+
+// errorCode maps a hub pipeline error to its error envelope code.
+func errorCode(err error) string {
+	var rejected *RejectedError
+	var preauthRejected *PreauthRejectedError
+	var blocked *BlockedError
+	var rateLimited *RateLimitedError
+	var quotaExceeded *QuotaExceededError
+	var underMaintenance *maintenance.Error
+	switch {
+	case errors.As(err, &rejected):
+		return ErrCodeContentRejected
+	case errors.As(err, &preauthRejected):
+		return ErrCodePreauthRejected
+	case errors.As(err, &blocked):
+		return ErrCodeRequestBlocked
+	case errors.As(err, &rateLimited), errors.Is(err, grpc.ErrUserLimit):
+		return ErrCodeRateLimited
+	case errors.As(err, &quotaExceeded):
+		return ErrCodeQuotaExceeded
+	case errors.Is(err, ErrOverloaded), errors.Is(err, scheduler.ErrSaturated), errors.Is(err, grpc.ErrStreamLimit):
+		return ErrCodeOverloaded
+	case errors.Is(err, ErrDraining):
+		return ErrCodeDraining
+	case errors.As(err, &underMaintenance):
+		return ErrCodeMaintenance
+	default:
+		return ErrCodeAgentError
+	}
+}
+
+// errorDetails returns the structured details of a hub pipeline error, if
+// any.
+func errorDetails(err error) map[string]string {
+	var rejected *RejectedError
+	var preauthRejected *PreauthRejectedError
+	var rateLimited *RateLimitedError
+	var quotaExceeded *QuotaExceededError
+	var underMaintenance *maintenance.Error
+	switch {
+	case errors.As(err, &rejected):
+		return map[string]string{"category": rejected.Category}
+	case errors.As(err, &preauthRejected):
+		return map[string]string{"reason": preauthRejected.Reason}
+	case errors.As(err, &rateLimited):
+		return map[string]string{"limit": rateLimited.Limit}
+	case errors.Is(err, grpc.ErrUserLimit):
+		return map[string]string{"limit": limitUserRequests}
+	case errors.As(err, &quotaExceeded):
+		return map[string]string{
+			"tenant": quotaExceeded.Tenant,
+			"reset":  strconv.FormatInt(quotaExceeded.Reset.Unix(), 10),
+		}
+	case errors.As(err, &underMaintenance):
+		return map[string]string{"retry_after": strconv.Itoa(underMaintenance.RetryAfter)}
+	default:
+		return nil
+	}
+}
+
+// frame encodes payload for c's protocol version. Legacy clients receive the
+// payload unchanged.
+func (c *Client) frame(typ, id string, payload []byte) outbound {
+	return c.frameEnvelope(Envelope{Type: typ, ID: id, Payload: payload})
+}
+
+// frameStream is frame for a reply to the chat streamID, which is also the
+// chat's envelope ID.
+func (c *Client) frameStream(typ, streamID string, payload []byte) outbound {
+	return c.frameEnvelope(Envelope{Type: typ, ID: streamID, StreamID: streamID, Payload: payload})
+}
+
+// frameSeq is frame for a session message of the chat streamID, if any, with
+// a replay sequence number.
+func (c *Client) frameSeq(typ, streamID string, seq uint64, payload []byte) outbound {
+	return c.frameEnvelope(Envelope{Type: typ, StreamID: streamID, Seq: seq, Payload: payload})
+}
+
+// frameEnvelope encodes env, stamped with the protocol version and c's
+// session, for c's protocol version.
+func (c *Client) frameEnvelope(env Envelope) outbound {
+	if c.protocol == protocolLegacy {
+		return outbound{data: env.Payload}
+	}
+	env.V = protocolEnvelope
+	env.SessionID = c.sessionID
+	return outbound{data: encodeEnvelope(env)}
+}
+
+// sendError reports a failed client message. Legacy clients have no
+// envelope, so they receive an error event carrying the message ID instead.
+func (c *Client) sendError(id, code string, err error) {
+	c.sendErrorFrame(Envelope{ID: id}, code, err)
+}
+
+// sendStreamError reports that the chat streamID failed.
+func (c *Client) sendStreamError(streamID, code string, err error) {
+	c.sendErrorFrame(Envelope{ID: streamID, StreamID: streamID}, code, err)
+}
+
+func (c *Client) sendErrorFrame(env Envelope, code string, err error) {
+	payload := errorPayload{Code: code, Message: c.hub.redact.Error(err), Details: errorDetails(err)}
+	if c.protocol == protocolLegacy {
+		data, _ := json.Marshal(errorEvent{Event: "error", ID: env.ID, errorPayload: payload})
+		c.push(outbound{data: data})
+		return
+	}
+	env.Type = TypeError
+	env.Payload, _ = json.Marshal(payload)
+	c.push(c.frameEnvelope(env))
+}
+
+// rejectMessage reports a client message that could not be understood and
+// counts it against the client.
+func (c *Client) rejectMessage(id, code string, err error) {
+	c.invalid.Add(1)
+	metrics.ObserveInvalidMessage(code)
+	c.sendError(id, code, err)
+}
+
+// messageID returns the "id" of a legacy JSON message, if it has one, even
+// when the rest of the message is invalid.
+func messageID(data []byte) string {
+	var msg struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(data, &msg)
+	return msg.ID
+}
@@ -0,0 +1,224 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	googlegrpc "google.golang.org/grpc"
+)
+
+type mockAIService struct {
+	pb.UnimplementedAIServiceServer
+}
+
+func (m *mockAIService) ProcessStream(stream pb.AIService_ProcessStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.StreamResponse{
+			SessionId: req.SessionId,
+			Payload: &pb.StreamResponse_Chat{Chat: &pb.ChatResponse{
+				MessageId: "msg-1",
+				SessionId: req.SessionId,
+				Content:   "Hi there",
+				IsFinal:   true,
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func startMockUpstream(t *testing.T) *grpc.PythonClient {
+	t.Helper()
+	return startUpstream(t, &mockAIService{})
+}
+
+// startUpstream serves svc as the Python AI service.
+func startUpstream(t *testing.T, svc pb.AIServiceServer) *grpc.PythonClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := googlegrpc.NewServer()
+	pb.RegisterAIServiceServer(s, svc)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	client, err := grpc.NewPythonClient(lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func readEnvelope(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("Failed to unmarshal envelope %s: %v", data, err)
+	}
+	return env
+}
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantID  string
+		wantErr bool
+	}{
+		{"valid", `{"v":1,"type":"chat","id":"c-1","payload":{}}`, "c-1", false},
+		{"matching session", `{"v":1,"type":"chat","id":"c-1","session_id":"s1"}`, "c-1", false},
+		{"other session", `{"v":1,"type":"chat","id":"c-1","session_id":"s2"}`, "c-1", true},
+		{"missing id", `{"v":1,"type":"chat"}`, "", true},
+		{"wrong version", `{"v":2,"type":"chat","id":"c-1"}`, "c-1", true},
+		{"not json", `nope`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := parseEnvelope([]byte(tt.data), "s1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEnvelope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if env != nil && env.ID != tt.wantID {
+				t.Errorf("expected id %q, got %q", tt.wantID, env.ID)
+			}
+		})
+	}
+}
+
+func TestClient_Frame(t *testing.T) {
+	payload := []byte(`{"content":"Hi"}`)
+
+	legacy := &Client{sessionID: "s1", protocol: protocolLegacy}
+	if got := legacy.frame(TypeChat, "", payload); string(got.data) != string(payload) {
+		t.Errorf("expected legacy payload unchanged, got %s", got.data)
+	}
+
+	enveloped := &Client{sessionID: "s1", protocol: protocolEnvelope}
+	var env Envelope
+	if err := json.Unmarshal(enveloped.frame(TypeChat, "m1", payload).data, &env); err != nil {
+		t.Fatalf("Failed to unmarshal envelope: %v", err)
+	}
+	if env.V != 1 || env.Type != TypeChat || env.ID != "m1" || env.SessionID != "s1" || string(env.Payload) != string(payload) {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+}
+
+func TestClient_RejectsInvalidMessages(t *testing.T) {
+	legacy := &Client{hub: &Hub{}, sessionID: "s1", protocol: protocolLegacy, send: make(chan outbound, 1)}
+	legacy.handleLegacyFrame([]byte(`{"id":"m-1","content":5}`))
+
+	var event errorEvent
+	if err := json.Unmarshal((<-legacy.send).data, &event); err != nil {
+		t.Fatalf("Failed to unmarshal error event: %v", err)
+	}
+	if event.Event != "error" || event.ID != "m-1" || event.Code != ErrCodeInvalidMessage || event.Message == "" {
+		t.Errorf("unexpected error event %+v", event)
+	}
+
+	enveloped := &Client{hub: &Hub{}, sessionID: "s1", protocol: protocolEnvelope, send: make(chan outbound, 2)}
+	enveloped.handleEnvelope([]byte(`{`))
+	enveloped.handleEnvelope([]byte(`{"v":1,"type":"control","id":"c-1","payload":{"action":"dance"}}`))
+
+	var env Envelope
+	json.Unmarshal((<-enveloped.send).data, &env)
+	if env.Type != TypeError || env.ID != "" {
+		t.Errorf("expected error without id for unparseable frame, got %+v", env)
+	}
+	json.Unmarshal((<-enveloped.send).data, &env)
+	if env.Type != TypeError || env.ID != "c-1" {
+		t.Errorf("expected error for c-1, got %+v", env)
+	}
+
+	if legacy.invalid.Load() != 1 || enveloped.invalid.Load() != 2 {
+		t.Errorf("expected 1 and 2 invalid messages, got %d and %d", legacy.invalid.Load(), enveloped.invalid.Load())
+	}
+}
+
+func TestHub_EnvelopeProtocol(t *testing.T) {
+	h := NewHub(startMockUpstream(t), WithJWTSecret(testSecret))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	srv := newHubServer(t, h)
+	token := signToken(t, testSecret, "user-1")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+token), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"chat","id":"c-1","payload":{"content":"Hello"}}`))
+
+	if env := readEnvelope(t, conn); env.Type != TypeAck || env.ID != "c-1" {
+		t.Errorf("expected ack for c-1, got %+v", env)
+	}
+	env := readEnvelope(t, conn)
+	var resp pb.ChatResponse
+	if err := json.Unmarshal(env.Payload, &resp); err != nil {
+		t.Fatalf("Failed to unmarshal chat payload: %v", err)
+	}
+	if env.Type != TypeChat || resp.Content != "Hi there" || !resp.IsFinal {
+		t.Errorf("expected final chat envelope, got %+v", env)
+	}
+
+	tests := []struct {
+		name     string
+		frame    string
+		wantType string
+		wantID   string
+		wantCode string
+	}{
+		{"ping", `{"v":1,"type":"control","id":"c-2","payload":{"action":"ping"}}`, TypeControl, "c-2", ""},
+		{"unknown action", `{"v":1,"type":"control","id":"c-3","payload":{"action":"dance"}}`, TypeError, "c-3", ErrCodeUnsupportedControl},
+		{"unknown type", `{"v":1,"type":"bogus","id":"c-4"}`, TypeError, "c-4", ErrCodeInvalidMessage},
+		{"missing id", `{"v":1,"type":"chat","payload":{"content":"Hi"}}`, TypeError, "", ErrCodeInvalidMessage},
+		{"invalid chat", `{"v":1,"type":"chat","id":"c-5","payload":{"temperature":9}}`, TypeError, "c-5", ErrCodeInvalidMessage},
+		{"reserved metadata", `{"v":1,"type":"chat","id":"c-6","payload":{"content":"Hi","metadata":{"conversation.messages":"[]"}}}`, TypeError, "c-6", ErrCodeInvalidMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.WriteMessage(websocket.TextMessage, []byte(tt.frame))
+
+			env := readEnvelope(t, conn)
+			if env.Type != tt.wantType || env.ID != tt.wantID {
+				t.Fatalf("expected %s for %q, got %+v", tt.wantType, tt.wantID, env)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var payload errorPayload
+			json.Unmarshal(env.Payload, &payload)
+			if payload.Code != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, payload.Code)
+			}
+		})
+	}
+}
@@ -3,217 +3,1287 @@ package websocket
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/abuse"
+	"github.com/neuronai/backend/go/internal/admission"
+	"github.com/neuronai/backend/go/internal/attachment"
+	"github.com/neuronai/backend/go/internal/audit"
+	"github.com/neuronai/backend/go/internal/backplane"
+	"github.com/neuronai/backend/go/internal/clientip"
 	"github.com/neuronai/backend/go/internal/grpc"
 	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/maintenance"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/middleware"
+	"github.com/neuronai/backend/go/internal/moderation"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"github.com/neuronai/backend/go/internal/quota"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+	"github.com/neuronai/backend/go/internal/redact"
+	"github.com/neuronai/backend/go/internal/scheduler"
+	"github.com/neuronai/backend/go/internal/session"
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512 * 1024
+	replaySweepInterval = 30 * time.Second
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type Client struct {
 	hub       *Hub
 	conn      *websocket.Conn
-	send      chan []byte
+	send      chan outbound
 	userID    string
 	sessionID string
+	// traceID comes from the upgrade request's traceparent header and links
+	// this connection's streams to the client trace.
+	traceID string
+	// clientInfo describes the client app, from the upgrade request's
+	// headers or the auth frame.
+	clientInfo grpc.ClientInfo
+	// protocol is the wire protocol version the client selected.
+	protocol int
+	// resume is set when the client reconnected presenting lastSeq, the
+	// sequence number of the last session message it received.
+	resume  bool
+	lastSeq uint64
+	// limiter throttles the client's messages; nil when unlimited.
+	limiter *ratelimit.Bucket
+	// streams counts the client's chats in flight.
+	streams atomic.Int32
+	// cancels holds the cancel functions of the client's chats in flight.
+	cancels streamCancels
+	// agent is the pb.AgentType the client switched its later chats to,
+	// unspecified until it does.
+	agent atomic.Int32
+	// ctx is the parent of the client's chats and is cancelled by cancel
+	// when the connection closes, stopping them.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// invalid counts the client's messages rejected as malformed.
+	invalid atomic.Int64
+	// claims are the connection's token claims, replaced by refresh_auth.
+	// reauth wakes the write pump to rearm its expiry timer after a refresh.
+	claims atomic.Pointer[middleware.Claims]
+	reauth chan struct{}
+	// connectedAt is when the connection was upgraded.
+	connectedAt time.Time
+	// ip is the client's address, for abuse detection.
+	ip string
+	// peer identifies the client in audit events; bytesIn and bytesOut count
+	// the message bytes the connection carried.
+	peer     audit.Event
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	// rtt is the last ping round-trip time in nanoseconds, zero until the
+	// first pong.
+	rtt atomic.Int64
+	// log carries the request ID of the upgrade, the user, session and
+	// client app.
+	log *slog.Logger
+	// closeMessage, if set before send is closed, is the close frame sent to
+	// the client instead of an empty one.
+	closeMessage []byte
+	// channels are the client's channel subscriptions, guarded by the hub's
+	// mu.
+	channels map[string]bool
+	// backlog holds the client's backpressure state when the hub has a lag
+	// grace period.
+	backlog backlog
+}
+
+// chatMessage is the JSON frame a client sends: a ChatRequest with optional
+// generation parameters and conversation history alongside it. Attachments
+// are references resolved against the upload store, replacing the raw
+// protobuf field. The ChatRequest is decoded with protojson, the rest with
+// encoding/json.
+type chatMessage struct {
+	*pb.ChatRequest `json:"-"`
+	grpc.GenerationParams
+	Attachments []attachment.Reference `json:"attachments,omitempty"`
+	Messages    grpc.Conversation      `json:"messages,omitempty"`
+}
+
+// validate checks the message and, when the client sent a conversation,
+// derives the request content from its final message. Messages without a
+// message type that carry audio are voice notes.
+func (m *chatMessage) validate() error {
+	if err := grpc.ValidateMetadata(m.Metadata); err != nil {
+		return err
+	}
+	if err := m.GenerationParams.Validate(); err != nil {
+		return err
+	}
+	if err := m.Messages.Validate(); err != nil {
+		return err
+	}
+	if len(m.Messages) > 0 {
+		if m.Content != "" {
+			return fmt.Errorf("content and messages are mutually exclusive")
+		}
+		m.Content = m.Messages.Prompt()
+	}
+	if m.MessageType == pb.MessageType_MESSAGE_TYPE_UNSPECIFIED && attachment.HasKind(m.Attachments, attachment.KindAudio) {
+		m.MessageType = pb.MessageType_MESSAGE_TYPE_AUDIO
+	}
+	return nil
+}
+
+// preauthEvent streams a pre-authorization decision for the sender's chat.
+type preauthEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	preauth.Decision
+}
+
+// resumedEvent ends the replay to a resuming client. Seq is the session's
+// latest sequence number; Complete is false when messages were lost and the
+// client should refetch the session's state.
+type resumedEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Seq       uint64 `json:"seq"`
+	Replayed  int    `json:"replayed"`
+	Complete  bool   `json:"complete"`
+}
+
+// queuedEvent tells a sender its message is waiting behind another send in the
+// same session.
+type queuedEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Ahead     int    `json:"ahead"`
+}
+
+// audioEvent carries an audio reply, such as synthesized speech, to a
+// text-frame client. Data is base64 encoded in JSON.
+type audioEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	Data      []byte `json:"data"`
 }
 
 type Hub struct {
-	clients      map[*Client]bool
-	broadcast    chan []byte
-	register     chan *Client
-	unregister   chan *Client
+	// shards hold the clients, split by session; see shard.go.
+	shards       []*shard
+	shardCount   int
+	channelRules []channelRule
 	pythonClient *grpc.PythonClient
-	mu           sync.RWMutex
+	moderator    moderation.Moderator
+	abuse        *abuse.Guard
+	attachments  attachment.Store
+	sessions     *session.Locker
+	admission    *admission.Controller
+	jwtSecret    string
+	authOpts     []middleware.AuthOption
+	tickets      TicketRedeemer
+	redact       *redact.Redactor
+	backplane    backplane.Backplane
+	responses    *session.ResponseCache
+	preauth      *preauth.Gate
+	quotas       *quota.Manager
+	maintenance  *maintenance.Mode
+	replaySize   int
+	replayTTL    time.Duration
+	presence     bool
+	shareSession SessionAuthorizer
+	lagGrace     time.Duration
+	messageRate  float64
+	messageBurst int
+	// guests admits guest tokens, whose connections are throttled to
+	// guestRate messages per second in bursts of guestBurst.
+	guests        bool
+	guestRate     float64
+	guestBurst    int
+	maxStreams    int
+	maxUserConns  int
+	maxConns      int
+	statsInterval time.Duration
+	limitStore    ratelimit.Store
+	limitInterval time.Duration
+	// writeWait, pongWait, pingPeriod, sendBufferSize and maxMessageSize
+	// tune each connection, along with upgrader's buffer sizes; see
+	// tuning.go.
+	writeWait      time.Duration
+	pongWait       time.Duration
+	pingPeriod     time.Duration
+	sendBufferSize int
+	maxMessageSize int64
+	upgrader       websocket.Upgrader
+	// compressionLevel and compressionMinSize apply to connections that
+	// negotiated compression, if upgrader offers it.
+	compressionLevel   int
+	compressionMinSize int
+	// authWarning is how long before its token expires a client is warned.
+	authWarning time.Duration
+	// departed holds the buckets of users who disconnected since the last
+	// SaveLimits, guarded by departedMu.
+	departed   map[string]ratelimit.State
+	departedMu sync.Mutex
+	// conns and userConns count the registered connections, in total and by
+	// user, guarded by connsMu. It is taken with a shard lock held, never the
+	// other way round.
+	conns     int
+	userConns map[string]int
+	connsMu   sync.Mutex
+	// audit, if set, receives audit events; see audit.go.
+	audit audit.Sink
+	log   *slog.Logger
+	// affinity tracks the resume translations awaiting another instance;
+	// see affinity.go.
+	affinity affinityQueries
+	// draining is set by Drain; inflight counts chats running through Stream.
+	draining atomic.Bool
+	inflight atomic.Int64
+}
+
+// Option configures optional Hub dependencies.
+type Option func(*Hub)
+
+// WithAbuseGuard blocks chats g judges abusive.
+func WithAbuseGuard(g *abuse.Guard) Option {
+	return func(h *Hub) {
+		h.abuse = g
+	}
+}
+
+// WithModerator screens chat content before it is forwarded.
+func WithModerator(m moderation.Moderator) Option {
+	return func(h *Hub) {
+		h.moderator = m
+	}
+}
+
+// WithAttachmentStore enables attachment references, validated against store.
+func WithAttachmentStore(store attachment.Store) Option {
+	return func(h *Hub) {
+		h.attachments = store
+	}
+}
+
+// WithSessionLocker serializes chat messages within a session.
+func WithSessionLocker(l *session.Locker) Option {
+	return func(h *Hub) {
+		h.sessions = l
+	}
+}
+
+// WithAdmission gates chat messages on upstream load.
+func WithAdmission(c *admission.Controller) Option {
+	return func(h *Hub) {
+		h.admission = c
+	}
+}
+
+// WithResponseCache keeps recent responses per session for regenerate/undo.
+func WithResponseCache(c *session.ResponseCache) Option {
+	return func(h *Hub) {
+		h.responses = c
+	}
+}
+
+// WithPreauth requires expensive chats to be authorized by the billing
+// service.
+func WithPreauth(g *preauth.Gate) Option {
+	return func(h *Hub) {
+		h.preauth = g
+	}
+}
+
+// WithQuotas charges the chats of connections with a tenant_id claim to
+// their tenant and refuses them once its quota is used up.
+func WithQuotas(m *quota.Manager) Option {
+	return func(h *Hub) {
+		h.quotas = m
+	}
+}
+
+// WithMaintenance refuses new chats while m is in maintenance. Connections
+// stay open and chats already streaming run to completion.
+func WithMaintenance(m *maintenance.Mode) Option {
+	return func(h *Hub) {
+		h.maintenance = m
+	}
+}
+
+// WithReplayBuffer numbers session messages and keeps the last size of each
+// session for ttl after its last message, so reconnecting clients can resume.
+func WithReplayBuffer(size int, ttl time.Duration) Option {
+	return func(h *Hub) {
+		h.replaySize = size
+		h.replayTTL = ttl
+	}
+}
+
+// WithPresence sends envelope clients presence and agent activity events for
+// their session.
+func WithPresence() Option {
+	return func(h *Hub) {
+		h.presence = true
+	}
+}
+
+// WithClientLimits throttles each connection to rate messages per second with
+// bursts of up to burst, and to maxStreams chats in flight. A zero rate or
+// maxStreams leaves that limit off.
+func WithClientLimits(rate float64, burst, maxStreams int) Option {
+	return func(h *Hub) {
+		h.messageRate = rate
+		h.messageBurst = burst
+		h.maxStreams = maxStreams
+	}
+}
+
+// WithGuests admits guests, throttling each of their connections to rate
+// messages per second with bursts of up to burst instead of the limit of
+// WithClientLimits. A zero rate leaves guests under that limit. Without it,
+// guest tokens are refused.
+func WithGuests(rate float64, burst int) Option {
+	return func(h *Hub) {
+		h.guests = true
+		h.guestRate = rate
+		h.guestBurst = burst
+	}
+}
+
+// WithJWTSecret sets the secret used to authenticate connections. A Hub
+// without one rejects every connection.
+func WithJWTSecret(secret string) Option {
+	return func(h *Hub) {
+		h.jwtSecret = secret
+	}
+}
+
+// WithLogger logs to l instead of the default logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(h *Hub) {
+		h.log = l
+	}
+}
+
+// WithOIDC also authenticates connections with tokens validated by o.
+func WithOIDC(o *middleware.OIDC) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithOIDC(o))
+	}
+}
+
+// WithKeySet also authenticates connections with RS256 and ES256 tokens
+// verified by ks.
+func WithKeySet(ks *middleware.KeySet) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithKeySet(ks))
+	}
+}
+
+// WithPreviousSecrets also authenticates connections with HS256 tokens
+// signed with one of the retired secrets.
+func WithPreviousSecrets(secrets ...string) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithPreviousSecrets(secrets...))
+	}
+}
+
+// WithRotationEnd stops authenticating connections with the retired
+// secrets of WithPreviousSecrets at end.
+func WithRotationEnd(end time.Time) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithRotationEnd(end))
+	}
 }
 
-func NewHub(pythonClient *grpc.PythonClient) *Hub {
-	return &Hub{
-		clients:      make(map[*Client]bool),
-		broadcast:    make(chan []byte),
-		register:     make(chan *Client),
-		unregister:   make(chan *Client),
-		pythonClient: pythonClient,
+// WithRevocation rejects tokens on revoker's list when connections
+// authenticate or refresh their token.
+func WithRevocation(revoker middleware.Revoker) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithRevocation(revoker))
 	}
 }
 
+// WithEnricher passes the claims of validated tokens through enricher,
+// refusing disabled users.
+func WithEnricher(enricher middleware.ClaimsEnricher) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithEnricher(enricher))
+	}
+}
+
+// WithClientCerts also authenticates upgrade requests without a token by
+// the verified TLS client certificate certs maps.
+func WithClientCerts(certs *middleware.ClientCerts) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithClientCerts(certs))
+	}
+}
+
+// WithRedactor masks personal data and credentials in the error messages
+// sent to clients.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(h *Hub) {
+		h.redact = r
+	}
+}
+
+// WithTokenValidation checks the registered claims of the tokens connections
+// authenticate with against v.
+func WithTokenValidation(v middleware.TokenValidation) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithTokenValidation(v))
+	}
+}
+
+// WithTickets also authenticates upgrade requests by a single-use ticket in
+// the ticket query parameter, which tickets redeems.
+func WithTickets(tickets TicketRedeemer) Option {
+	return func(h *Hub) {
+		h.tickets = tickets
+	}
+}
+
+// WithSessions also authenticates same-origin upgrade requests by a browser
+// session cookie sessions resolves. Cross-origin upgrades must present a
+// token, since any site can make a browser open a WebSocket with its
+// cookies.
+func WithSessions(sessions middleware.SessionResolver) Option {
+	return func(h *Hub) {
+		h.authOpts = append(h.authOpts, middleware.WithSessions(sessions))
+	}
+}
+
+// WithBackplane fans session messages out to the other gateway instances
+// sharing bp and delivers theirs to local clients.
+func WithBackplane(bp backplane.Backplane) Option {
+	return func(h *Hub) {
+		h.backplane = bp
+	}
+}
+
+func NewHub(pythonClient *grpc.PythonClient, opts ...Option) *Hub {
+	h := &Hub{
+		shardCount:     defaultShards,
+		writeWait:      defaultWriteWait,
+		pongWait:       defaultPongWait,
+		pingPeriod:     defaultPingPeriod,
+		sendBufferSize: defaultSendBufferSize,
+		maxMessageSize: defaultMaxMessageSize,
+		upgrader:       newUpgrader(),
+		authWarning:    defaultAuthWarning,
+		userConns:      make(map[string]int),
+		pythonClient:   pythonClient,
+		log:            slog.Default(),
+
+		compressionLevel:   defaultCompressionLevel,
+		compressionMinSize: defaultCompressionMinSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.shards = make([]*shard, max(h.shardCount, 1))
+	for i := range h.shards {
+		h.shards[i] = newShard(h)
+	}
+	return h
+}
+
 func (h *Hub) Run(ctx context.Context) {
+	if h.backplane != nil {
+		go h.subscribeBackplane(ctx)
+	}
+	if h.limitStore != nil {
+		go h.persistLimits(ctx)
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range h.shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			s.run(ctx)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// add indexes c, whose connection has been counted. The caller must hold mu.
+func (s *shard) add(c *Client) {
+	s.clients[c] = true
+	metrics.ObserveConnected()
+	addToIndex(s.sessionClients, c.sessionID, c)
+	addToIndex(s.userClients, c.userID, c)
+	s.claim(c)
+	if c.resume {
+		s.replayTo(c)
+	}
+	s.announcePresence(c, PresenceJoin)
+}
+
+// replayTo queues the session messages c missed, as far as they are retained
+// and fit in its send buffer, followed by a resumed event. Holding mu while
+// c is added guarantees no message is missed or repeated between the replay
+// and live delivery. The caller must hold mu.
+func (s *shard) replayTo(c *Client) {
+	var entries []replayEntry
+	var last uint64
+	complete := false
+	if s.replay != nil {
+		entries, last, complete = s.replay.since(c.sessionID, c.lastSeq)
+	}
+
+	room := cap(c.send) - len(c.send) - 1
+	if room < 0 {
+		return
+	}
+	if len(entries) > room {
+		entries = entries[len(entries)-room:]
+		complete = false
+	}
+	for _, e := range entries {
+		c.push(c.frameSeq(TypeChat, e.streamID, e.seq, e.data))
+	}
+
+	data, _ := json.Marshal(resumedEvent{
+		Event:     "resumed",
+		SessionID: c.sessionID,
+		Seq:       last,
+		Replayed:  len(entries),
+		Complete:  complete,
+	})
+	c.push(c.frame(TypeControl, "", data))
+}
+
+// remove drops c from every index, closes its send channel and, unless the
+// hub is draining, announces its departure. The caller must hold mu.
+func (s *shard) remove(c *Client) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	delete(s.clients, c)
+	metrics.ObserveDisconnected()
+	s.hub.releaseConnection(c.userID)
+	removeFromIndex(s.sessionClients, c.sessionID, c)
+	removeFromIndex(s.userClients, c.userID, c)
+	s.release(c.sessionID)
+	s.leaveChannels(c)
+	s.hub.recordDeparture(c)
+	c.backlog.close(c)
+	if !s.hub.draining.Load() {
+		s.announcePresence(c, PresenceLeave)
+	}
+}
+
+func addToIndex(index map[string]map[*Client]bool, key string, c *Client) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[*Client]bool)
+		index[key] = set
+	}
+	set[c] = true
+}
+
+func removeFromIndex(index map[string]map[*Client]bool, key string, c *Client) {
+	set := index[key]
+	delete(set, c)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// deliver queues the frame built by frame for each client in set, dropping
+// clients that cannot keep up. It returns how many received it. The clients
+// must belong to s and the caller must hold mu.
+func (s *shard) deliver(set map[*Client]bool, frame func(*Client) outbound) int {
+	delivered := 0
+	for client := range set {
+		if s.hub.enqueue(client, frame(client)) {
+			delivered++
+		} else {
+			s.dropClient(client)
+		}
+	}
+	return delivered
+}
+
+// SendToSession queues a chat message for every connection in sessionID, publishing
+// it to the backplane when one is configured, and returns how many local
+// connections received it.
+func (h *Hub) SendToSession(sessionID string, message []byte) int {
+	return h.sendSessionMessage(sessionID, "", &sessionMessage{json: message})
+}
+
+// sendSessionMessage sends m to sessionID on every instance. userID is the
+// user it was produced for, if any, and names the session's owner to other
+// instances when this one no longer has it.
+func (h *Hub) sendSessionMessage(sessionID, userID string, m *sessionMessage) int {
+	delivered, owner := h.sendToLocalSession(sessionID, "", m)
+
+	if h.backplane != nil {
+		if owner == "" {
+			owner = userID
+		}
+		if err := h.backplane.Publish(context.Background(), sessionID, m.streamID, owner, m.JSON()); err != nil {
+			h.log.Warn("Backplane publish failed", logging.KeySessionID, sessionID, logging.Err(err))
+		}
+	}
+	return delivered
+}
+
+// sendToLocalSession queues m for the connections in sessionID on this
+// instance and returns how many received it, and the session's owner here.
+// A message from another instance carries the owner of the session there,
+// and only reaches the clients that may join that owner's session.
+func (h *Hub) sendToLocalSession(sessionID, owner string, m *sessionMessage) (int, string) {
+	s := h.shardFor(sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seq uint64
+	if s.replay != nil && s.adopt(sessionID, owner) {
+		seq = s.replay.append(sessionID, m.streamID, m.JSON())
+	}
+	delivered := 0
+	for client := range s.sessionClients[sessionID] {
+		if owner != "" && !s.mayJoin(sessionID, client.userID, owner) {
+			continue
+		}
+		msg, ok := h.coalesce(client, m)
+		switch {
+		case !ok:
+			delivered++
+		case h.enqueue(client, client.frameSession(seq, msg)):
+			delivered++
+		default:
+			s.dropClient(client)
+		}
+	}
+	return delivered, s.owners[sessionID]
+}
+
+// subscribeBackplane delivers messages from other instances until ctx is
+// done, resubscribing after errors.
+func (h *Hub) subscribeBackplane(ctx context.Context) {
 	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mu.Unlock()
-
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+		err := h.backplane.Subscribe(ctx, func(msg backplane.Message) {
+			switch {
+			case msg.UserID != "":
+				h.notifyLocalUser(msg.UserID, msg.Data)
+				return
+			case msg.Channel != "":
+				h.publishLocal(msg.Channel, msg.Data)
+				return
+			case msg.Instance != "":
+				h.handleInstanceMessage(msg.Data)
+				return
 			}
-			h.mu.RUnlock()
+			h.sendToLocalSession(msg.SessionID, msg.Owner, &sessionMessage{json: msg.Data, streamID: msg.StreamID})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		h.log.Error("Backplane subscription ended", logging.Err(err))
 
+		select {
+		case <-time.After(time.Second):
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// SendToUser queues a control message for every connection of userID across
+// sessions and returns how many received it.
+func (h *Hub) SendToUser(userID string, message []byte) int {
+	delivered := 0
+	h.lockShards(func(s *shard) {
+		delivered += s.deliver(s.userClients[userID], func(c *Client) outbound {
+			return c.frame(TypeControl, "", message)
+		})
+	})
+	return delivered
+}
+
+// NotifyUser queues a notification for every connection of userID across
+// sessions, publishing it to the backplane when one is configured so the
+// user's connections on other instances receive it too. It returns how many
+// local connections received it.
+func (h *Hub) NotifyUser(userID string, payload []byte) int {
+	delivered := h.notifyLocalUser(userID, payload)
+
+	if h.backplane != nil {
+		if err := h.backplane.PublishUser(context.Background(), userID, payload); err != nil {
+			h.log.Warn("Backplane publish failed", logging.KeyUserID, userID, logging.Err(err))
+		}
+	}
+	return delivered
+}
+
+func (h *Hub) notifyLocalUser(userID string, payload []byte) int {
+	delivered := 0
+	h.lockShards(func(s *shard) {
+		delivered += s.deliver(s.userClients[userID], func(c *Client) outbound {
+			return c.frame(TypeNotification, "", payload)
+		})
+	})
+	return delivered
+}
+
+// Sessions returns the number of open connections per session for userID.
+func (h *Hub) Sessions(userID string) map[string]int {
+	sessions := make(map[string]int)
+	h.rlockShards(func(s *shard) {
+		for client := range s.userClients[userID] {
+			sessions[client.sessionID]++
+		}
+	})
+	return sessions
+}
+
+// Stats reports the hub's open connections, the sessions and users they
+// belong to, and the chats in flight through Stream.
+func (h *Hub) Stats() map[string]int64 {
+	var sessions int64
+	h.rlockShards(func(s *shard) {
+		sessions += int64(len(s.sessionClients))
+	})
+
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+	return map[string]int64{
+		"connections":       int64(h.conns),
+		"sessions":          sessions,
+		"users":             int64(len(h.userConns)),
+		"streams_in_flight": h.inflight.Load(),
+	}
+}
+
+// HandleWebSocket upgrades an authenticated connection. The user comes from
+// a ticket query parameter, or the JWT, presented as a
+// Sec-WebSocket-Protocol value after "bearer", as the token query parameter,
+// or in an auth frame sent first after upgrade. The
+// wire protocol comes from a negotiated subprotocol or the v query parameter.
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
 	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		http.Error(w, "Missing session_id", http.StatusBadRequest)
+		return
+	}
+
+	subprotocol, protocol, err := negotiateSubprotocol(r)
+	if err != nil {
+		conn, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			h.log.WarnContext(r.Context(), "WebSocket upgrade failed", logging.Err(err))
+			return
+		}
+		h.rejectSubprotocol(conn)
+		return
+	}
+	if v := r.URL.Query().Get("v"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < protocolLegacy || n > protocolBinary {
+			http.Error(w, "Unsupported protocol version", http.StatusBadRequest)
+			return
+		}
+		if subprotocol != "" && n != protocol {
+			http.Error(w, "Protocol version conflicts with subprotocol", http.StatusBadRequest)
+			return
+		}
+		protocol = n
+	}
+
+	var lastSeq uint64
+	resume := r.URL.Query().Has("resume")
+	if resume {
+		if protocol != protocolEnvelope {
+			http.Error(w, "Resume requires protocol version 1", http.StatusBadRequest)
+			return
+		}
+		n, err := strconv.ParseUint(r.URL.Query().Get("resume"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid resume sequence", http.StatusBadRequest)
+			return
+		}
+		lastSeq = n
+	}
 
-	if userID == "" || sessionID == "" {
-		http.Error(w, "Missing user_id or session_id", http.StatusBadRequest)
+	if h.jwtSecret == "" {
+		http.Error(w, "WebSocket authentication is not configured", http.StatusServiceUnavailable)
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if h.isDraining() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	var claims *middleware.Claims
+	token, fromProtocol := requestToken(r)
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		c, err := h.redeemTicket(ticket, sessionID)
+		if err != nil {
+			h.recordAuthFailure(r, sessionID, "ticket: "+err.Error())
+			http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+			return
+		}
+		claims = c
+	} else if token != "" {
+		c, err := h.parseToken(token)
+		if err != nil {
+			h.recordAuthFailure(r, sessionID, err.Error())
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		claims = c
+	} else if c, ok := middleware.CertClaims(r, h.authOpts...); ok {
+		claims = c
+	} else if sameOrigin(r) {
+		c, ok, err := middleware.SessionClaims(r, h.authOpts...)
+		if err != nil {
+			h.recordAuthFailure(r, sessionID, "session cookie: "+err.Error())
+			http.Error(w, "Session expired", http.StatusUnauthorized)
+			return
+		}
+		if ok {
+			claims = c
+		}
+	}
+
+	userID := ""
+	if claims != nil {
+		userID = claims.UserID
+		if err := h.checkSessionOwner(sessionID, userID); err != nil {
+			h.recordAuthFailure(r, sessionID, err.Error())
+			http.Error(w, "Session belongs to another user", http.StatusForbidden)
+			return
+		}
+	}
+	if h.rejectOverCapacity(w, userID) {
+		return
+	}
+
+	var header http.Header
+	switch {
+	case subprotocol != "":
+		header = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+	case fromProtocol:
+		header = http.Header{"Sec-WebSocket-Protocol": {authSubprotocol}}
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, header)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		h.log.WarnContext(r.Context(), "WebSocket upgrade failed", logging.Err(err))
 		return
 	}
+	if h.upgrader.EnableCompression {
+		conn.SetCompressionLevel(h.compressionLevel)
+	}
 
+	clientInfo := requestClientInfo(r)
+	if claims == nil {
+		var frameInfo grpc.ClientInfo
+		claims, frameInfo, err = h.authenticateFrame(conn, sessionID)
+		if err != nil {
+			h.recordAuthFailure(r, sessionID, err.Error())
+			h.rejectConn(conn, "authentication failed")
+			return
+		}
+		clientInfo = clientInfo.Merge(frameInfo)
+		if err := h.checkSessionOwner(sessionID, claims.UserID); err != nil {
+			h.recordAuthFailure(r, sessionID, err.Error())
+			conn.WriteControl(websocket.CloseMessage, sessionForbiddenMessage, time.Now().Add(h.writeWait))
+			conn.Close()
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	client := &Client{
-		hub:       h,
-		conn:      conn,
-		send:      make(chan []byte, 256),
-		userID:    userID,
-		sessionID: sessionID,
+		hub:         h,
+		conn:        conn,
+		send:        make(chan outbound, h.sendBufferSize),
+		userID:      claims.UserID,
+		sessionID:   sessionID,
+		traceID:     metrics.TraceID(r),
+		clientInfo:  clientInfo,
+		protocol:    protocol,
+		resume:      resume,
+		lastSeq:     lastSeq,
+		connectedAt: time.Now(),
+		peer:        audit.RequestPeer(r),
+		log: logging.Logger(r.Context(), h.log).With(
+			logging.KeyUserID, claims.UserID,
+			logging.KeySessionID, sessionID,
+			"client", clientInfo.String()),
+		ctx:    ctx,
+		cancel: cancel,
+		reauth: make(chan struct{}, 1),
+		ip:     clientip.String(r),
+	}
+	client.claims.Store(claims)
+	switch {
+	case claims.Guest && h.guestRate > 0:
+		client.limiter = ratelimit.NewBucket(h.guestRate, h.guestBurst)
+	case h.messageRate > 0:
+		client.limiter = ratelimit.NewBucket(h.messageRate, h.messageBurst)
+	}
+	h.restoreLimiter(r.Context(), client)
+	if resume {
+		client.lastSeq = h.resumeSeq(r.Context(), r.URL.Query().Get("affinity"), claims.UserID, sessionID, lastSeq)
+	}
+	if h.affinityEnabled() && protocol == protocolEnvelope {
+		data, _ := json.Marshal(affinityEvent{
+			Event:     "affinity",
+			SessionID: sessionID,
+			Token:     h.signAffinity(claims.UserID, sessionID),
+		})
+		client.push(client.frame(TypeControl, "", data))
 	}
 
-	client.hub.register <- client
+	client.shard().register <- client
+	h.recordAudit(audit.TypeConnect, client.auditEvent())
 
 	go client.writePump()
 	go client.readPump()
 }
 
+// logger returns the client's logger, falling back to the default logger for
+// clients not created by HandleWebSocket.
+func (c *Client) logger() *slog.Logger {
+	if c.log == nil {
+		return slog.Default()
+	}
+	return c.log
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		// Stop the client's chats; nobody is left to read their responses.
+		c.cancel()
+		c.shard().unregister <- c
 		c.conn.Close()
+		c.recordDisconnect()
+		if n := c.invalid.Load(); n > 0 {
+			c.logger().Warn("WebSocket client sent invalid messages", "count", n)
+		}
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetReadLimit(c.hub.maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	c.conn.SetPongHandler(func(appData string) error {
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+		c.observePong(appData)
 		return nil
 	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		messageType, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				c.logger().Warn("WebSocket read failed", logging.Err(err))
 			}
 			break
 		}
+		metrics.ObserveMessages(metrics.DirectionIn, 1)
+		c.bytesIn.Add(int64(len(message)))
 
-		var req pb.ChatRequest
-		if err := json.Unmarshal(message, &req); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			continue
+		switch {
+		case c.protocol == protocolLegacy:
+			c.handleLegacyFrame(message)
+		case c.protocol == protocolBinary && messageType == websocket.BinaryMessage:
+			c.handleBinaryFrame(message)
+		default:
+			c.handleEnvelope(message)
 		}
+	}
+}
 
-		req.UserId = c.userID
-		req.SessionId = c.sessionID
+// handleLegacyFrame handles a bare chat message from a protocol v0 client.
+func (c *Client) handleLegacyFrame(data []byte) {
+	if err := c.allowMessage(); err != nil {
+		c.sendError("", errorCode(err), err)
+		return
+	}
 
-		go c.handleMessage(&req)
+	req, refs, err := c.parseChat(data)
+	if err != nil {
+		c.rejectMessage(messageID(data), ErrCodeInvalidMessage, err)
+		return
 	}
+	c.startStream(req, refs, "")
 }
 
-func (c *Client) handleMessage(req *pb.ChatRequest) {
-	stream, err := c.hub.pythonClient.ProcessStream(context.Background(), req)
+// handleEnvelope dispatches a protocol v1 frame by type.
+func (c *Client) handleEnvelope(data []byte) {
+	env, err := parseEnvelope(data, c.sessionID)
 	if err != nil {
-		log.Printf("Failed to process stream: %v", err)
+		id := ""
+		if env != nil {
+			id = env.ID
+		}
+		c.rejectMessage(id, ErrCodeInvalidMessage, err)
 		return
 	}
-	defer stream.Close()
 
-	for {
-		resp, err := stream.Recv()
+	if err := c.allowMessage(); err != nil {
+		c.sendError(env.ID, errorCode(err), err)
+		return
+	}
+
+	switch env.Type {
+	case TypeChat:
+		req, refs, err := c.parseChat(env.Payload)
 		if err != nil {
+			c.rejectMessage(env.ID, ErrCodeInvalidMessage, err)
 			return
 		}
+		c.startStream(req, refs, env.ID)
 
-		data, err := json.Marshal(resp)
-		if err != nil {
-			log.Printf("Failed to marshal response: %v", err)
-			continue
+	case TypeControl:
+		var ctrl controlMessage
+		if err := json.Unmarshal(env.Payload, &ctrl); err != nil {
+			c.rejectMessage(env.ID, ErrCodeInvalidMessage, fmt.Errorf("invalid control payload: %w", err))
+			return
 		}
+		c.handleControl(env.ID, ctrl)
 
-		c.send <- data
+	default:
+		c.rejectMessage(env.ID, ErrCodeInvalidMessage, fmt.Errorf("unsupported message type %q", env.Type))
+	}
+}
+
+// handleControl answers a control message.
+func (c *Client) handleControl(id string, ctrl controlMessage) {
+	switch ctrl.Action {
+	case "ping":
+		payload, _ := json.Marshal(controlMessage{Action: "pong"})
+		c.push(c.frame(TypeControl, id, payload))
+	case "subscribe":
+		c.subscribe(id, ctrl.Channel)
+	case "unsubscribe":
+		c.unsubscribe(id, ctrl.Channel)
+	case "cancel":
+		c.cancelStream(id, ctrl.StreamID)
+	case "refresh_auth":
+		c.refreshAuth(id, ctrl.Token)
+	case grpc.ControlPause, grpc.ControlResume:
+		c.controlStream(id, ctrl.Action, ctrl.StreamID)
+	case grpc.ControlSwitchAgent:
+		c.switchAgent(id, ctrl.Agent)
+	default:
+		c.rejectMessage(id, ErrCodeUnsupportedControl, fmt.Errorf("unsupported control action %q", ctrl.Action))
+		return
+	}
+	c.recordControl(ctrl)
+}
+
+// parseChat decodes and validates a chat message and binds it to the
+// connection's user and session.
+func (c *Client) parseChat(data []byte) (*pb.ChatRequest, []attachment.Reference, error) {
+	msg := chatMessage{ChatRequest: &pb.ChatRequest{}}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	if err := unmarshalJSON.Unmarshal(data, msg.ChatRequest); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	msg.ChatRequest.Attachments = nil
+
+	if err := msg.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	req := msg.ChatRequest
+	req.UserId = c.userID
+	req.SessionId = c.sessionID
+	req.Metadata = msg.Messages.ApplyTo(msg.ApplyTo(req.Metadata))
+	return req, msg.Attachments, nil
+}
+
+// allowMessage applies the client's message rate limit.
+func (c *Client) allowMessage() error {
+	if c.limiter == nil || c.limiter.Allow() {
+		return nil
+	}
+	metrics.ObserveThrottled(metrics.LimitMessages)
+	return &RateLimitedError{Limit: metrics.LimitMessages}
+}
+
+// startStream runs the chat in the background as the stream id unless the
+// client already has its maximum number of chats in flight, or a chat with
+// the same ID.
+func (c *Client) startStream(req *pb.ChatRequest, refs []attachment.Reference, id string) {
+	ctx, control, done, ok := c.cancels.track(c.ctx, id)
+	if !ok {
+		c.rejectMessage(id, ErrCodeInvalidMessage, fmt.Errorf("chat %q is already in flight", id))
+		return
+	}
+
+	n := c.streams.Add(1)
+	if max := c.hub.maxStreams; max > 0 && int(n) > max {
+		c.streams.Add(-1)
+		done()
+		metrics.ObserveThrottled(metrics.LimitStreams)
+		err := &RateLimitedError{Limit: metrics.LimitStreams}
+		c.sendError(id, errorCode(err), err)
+		return
+	}
+	c.applyAgent(req)
+	metrics.ObserveHandlerStarted()
+	go func() {
+		defer metrics.ObserveHandlerFinished()
+		defer c.streams.Add(-1)
+		defer done()
+		c.handleMessage(ctx, req, refs, id, control)
+	}()
+}
+
+// handleMessage streams a chat. id is the client's envelope ID, used as the
+// stream ID of the ack, the responses and any error, and is empty for legacy
+// clients. The chat stops when ctx is cancelled, by a cancel action or the
+// connection closing.
+func (c *Client) handleMessage(ctx context.Context, req *pb.ChatRequest, refs []attachment.Reference, id string, control *StreamControl) {
+	ctx = scheduler.WithPriority(ctx, c.priority())
+	err := c.hub.Stream(ctx, &StreamRequest{
+		Chat:        req,
+		Attachments: refs,
+		Control:     control,
+		TraceID:     c.traceID,
+		Client:      c.clientInfo,
+		Tenant:      c.tenant(),
+		Transport:   metrics.TransportWebSocket,
+		IP:          c.ip,
+		OnQueued: func(ahead int) {
+			data, _ := json.Marshal(queuedEvent{Event: "queued", SessionID: req.SessionId, Ahead: ahead})
+			c.push(c.frameStream(TypeControl, id, data))
+		},
+		OnPreauth: func(d preauth.Decision) {
+			data, _ := json.Marshal(preauthEvent{Event: "preauth", SessionID: req.SessionId, Decision: d})
+			c.push(c.frameStream(TypeControl, id, data))
+		},
+		OnSent: func() {
+			if c.protocol != protocolLegacy {
+				c.push(c.frameStream(TypeAck, id, nil))
+			}
+		},
+		OnResponse: func(resp *pb.ChatResponse) {
+			c.hub.sendSessionMessage(req.SessionId, c.userID, &sessionMessage{resp: resp, streamID: id})
+		},
+		OnAudio: func(audio []byte) {
+			c.push(c.frameAudio(id, req.SessionId, audio))
+		},
+	})
+	if err != nil && ctx.Err() != nil {
+		c.logger().Info("Chat cancelled", "stream_id", id)
+		return
+	}
+	if err != nil {
+		c.logger().Error("Chat failed", "stream_id", id, logging.Err(err))
+		c.sendStreamError(id, errorCode(err), err)
 	}
 }
 
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
 	}()
 
+	var stats <-chan time.Time
+	if c.hub.statsInterval > 0 && c.protocol != protocolLegacy {
+		t := time.NewTicker(c.hub.statsInterval)
+		defer t.Stop()
+		stats = t.C
+	}
+
+	var expiry expiryTimer
+	expiry.reset(c)
+	defer expiry.stop()
+
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				msg := c.closeMessage
+				if msg == nil {
+					msg = []byte{}
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, msg)
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if err := c.write(message); err != nil {
 				return
 			}
-			w.Write(message)
+			c.flushBacklog()
 
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+		case <-ticker.C:
+			if err := c.ping(); err != nil {
+				return
 			}
 
-			if err := w.Close(); err != nil {
+		case <-stats:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.write(c.statsFrame()); err != nil {
 				return
 			}
 
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		case <-expiry.C:
+			if err := c.checkExpiry(&expiry); err != nil {
 				return
 			}
+
+		case <-c.reauth:
+			expiry.reset(c)
 		}
 	}
 }
+
+// write sends message, coalescing the text frames queued behind it into the
+// same WebSocket message. Binary frames are always sent on their own.
+func (c *Client) write(message outbound) error {
+	metrics.ObserveMessages(metrics.DirectionOut, 1)
+	c.bytesOut.Add(int64(len(message.data)))
+	// Only has an effect if compression was negotiated.
+	c.conn.EnableWriteCompression(len(message.data) >= c.hub.compressionMinSize)
+	if message.binary {
+		return c.conn.WriteMessage(websocket.BinaryMessage, message.data)
+	}
+
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	w.Write(message.data)
+
+	var next *outbound
+	n := len(c.send)
+	for i := 0; i < n; i++ {
+		queued := <-c.send
+		if queued.binary {
+			next = &queued
+			break
+		}
+		w.Write([]byte{'\n'})
+		w.Write(queued.data)
+		metrics.ObserveMessages(metrics.DirectionOut, 1)
+		c.bytesOut.Add(int64(len(queued.data)) + 1)
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if next != nil {
+		return c.write(*next)
+	}
+	return nil
+}
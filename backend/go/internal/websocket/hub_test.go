@@ -0,0 +1,325 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/backplane"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+)
+
+func newTestClient(h *Hub, userID, sessionID string, buffer int) *Client {
+	c := &Client{hub: h, send: make(chan outbound, buffer), userID: userID, sessionID: sessionID, ctx: context.Background()}
+	s := c.shard()
+	s.mu.Lock()
+	s.admit(c)
+	s.mu.Unlock()
+	return c
+}
+
+// removeTestClient unregisters c as its read pump would.
+func removeTestClient(c *Client) {
+	s := c.shard()
+	s.mu.Lock()
+	s.remove(c)
+	s.mu.Unlock()
+}
+
+func received(c *Client) int {
+	n := 0
+	for {
+		select {
+		case _, ok := <-c.send:
+			if !ok {
+				return n
+			}
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+// shareAll lets every user join every session, for tests that put several
+// users in one session.
+func shareAll(userID, sessionID, owner string) bool { return true }
+
+func TestHub_Routing(t *testing.T) {
+	h := NewHub(nil, WithSessionSharing(shareAll))
+	a := newTestClient(h, "u1", "s1", 4)
+	b := newTestClient(h, "u2", "s1", 4)
+	c := newTestClient(h, "u1", "s2", 4)
+
+	tests := []struct {
+		name string
+		send func() int
+		want [3]int
+	}{
+		{"session", func() int { return h.SendToSession("s1", []byte("x")) }, [3]int{1, 1, 0}},
+		{"user", func() int { return h.SendToUser("u1", []byte("x")) }, [3]int{1, 0, 1}},
+		{"unknown session", func() int { return h.SendToSession("nope", []byte("x")) }, [3]int{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := tt.send()
+			got := [3]int{received(a), received(b), received(c)}
+			if got != tt.want {
+				t.Errorf("expected deliveries %v, got %v", tt.want, got)
+			}
+			if want := tt.want[0] + tt.want[1] + tt.want[2]; n != want {
+				t.Errorf("expected %d delivered, got %d", want, n)
+			}
+		})
+	}
+}
+
+func TestHub_RemoveClientUpdatesIndexes(t *testing.T) {
+	h := NewHub(nil)
+	a := newTestClient(h, "u1", "s1", 1)
+	newTestClient(h, "u1", "s2", 1)
+
+	removeTestClient(a)
+	removeTestClient(a)
+
+	if n := h.SendToSession("s1", []byte("x")); n != 0 {
+		t.Errorf("expected no deliveries to removed session, got %d", n)
+	}
+	if _, ok := h.shardFor("s1").sessionClients["s1"]; ok {
+		t.Error("expected empty session index entry to be dropped")
+	}
+
+	sessions := h.Sessions("u1")
+	if len(sessions) != 1 || sessions["s2"] != 1 {
+		t.Errorf("expected only s2 for u1, got %v", sessions)
+	}
+}
+
+func TestHub_DropsSlowClient(t *testing.T) {
+	h := NewHub(nil, WithSessionSharing(shareAll))
+	slow := newTestClient(h, "u1", "s1", 1)
+	fast := newTestClient(h, "u2", "s1", 4)
+
+	h.SendToSession("s1", []byte("1"))
+	if n := h.SendToSession("s1", []byte("2")); n != 1 {
+		t.Errorf("expected 1 delivery, got %d", n)
+	}
+
+	if received(slow) != 1 {
+		t.Error("expected slow client to keep its buffered message")
+	}
+	if _, ok := <-slow.send; ok {
+		t.Error("expected slow client's send channel to be closed")
+	}
+	if received(fast) != 2 {
+		t.Error("expected fast client to receive both messages")
+	}
+	if h.Sessions("u1")["s1"] != 0 {
+		t.Error("expected slow client to be unregistered")
+	}
+}
+
+// memoryBackplane connects hubs in one process, standing in for Redis.
+type memoryBackplane struct {
+	mu       sync.Mutex
+	handler  backplane.Handler
+	peers    *[]*memoryBackplane
+	instance string
+}
+
+func newMemoryBackplanes(n int) []*memoryBackplane {
+	peers := make([]*memoryBackplane, n)
+	for i := range peers {
+		peers[i] = &memoryBackplane{peers: &peers, instance: fmt.Sprintf("instance-%d", i)}
+	}
+	return peers
+}
+
+// waitForBackplane polls until m has a subscriber.
+func waitForBackplane(t *testing.T, m *memoryBackplane) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.Lock()
+		ready := m.handler != nil
+		m.mu.Unlock()
+		if ready {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("backplane subscription was not established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (m *memoryBackplane) Publish(ctx context.Context, sessionID, streamID, owner string, data []byte) error {
+	m.publish(backplane.Message{SessionID: sessionID, StreamID: streamID, Owner: owner, Data: data})
+	return nil
+}
+
+func (m *memoryBackplane) PublishUser(ctx context.Context, userID string, data []byte) error {
+	m.publish(backplane.Message{UserID: userID, Data: data})
+	return nil
+}
+
+func (m *memoryBackplane) PublishChannel(ctx context.Context, channel string, data []byte) error {
+	m.publish(backplane.Message{Channel: channel, Data: data})
+	return nil
+}
+
+func (m *memoryBackplane) PublishInstance(ctx context.Context, instance string, data []byte) error {
+	m.publish(backplane.Message{Instance: instance, Data: data})
+	return nil
+}
+
+func (m *memoryBackplane) Instance() string { return m.instance }
+
+func (m *memoryBackplane) publish(msg backplane.Message) {
+	for _, peer := range *m.peers {
+		if peer == m || (msg.Instance != "" && msg.Instance != peer.instance) {
+			continue
+		}
+		peer.mu.Lock()
+		handler := peer.handler
+		peer.mu.Unlock()
+		if handler != nil {
+			handler(msg)
+		}
+	}
+}
+
+func (m *memoryBackplane) Subscribe(ctx context.Context, handler backplane.Handler) error {
+	m.mu.Lock()
+	m.handler = handler
+	m.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+func (m *memoryBackplane) Close() error { return nil }
+
+func TestHub_BackplaneFanOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	planes := newMemoryBackplanes(2)
+	h1 := NewHub(nil, WithBackplane(planes[0]))
+	h2 := NewHub(nil, WithBackplane(planes[1]))
+	go h1.Run(ctx)
+	go h2.Run(ctx)
+
+	local := newTestClient(h1, "u1", "s1", 4)
+	remote := newTestClient(h2, "u1", "s1", 4)
+	other := newTestClient(h2, "u2", "s2", 4)
+	waitForBackplane(t, planes[1])
+
+	if n := h1.SendToSession("s1", []byte("x")); n != 1 {
+		t.Errorf("expected 1 local delivery, got %d", n)
+	}
+
+	if received(local) != 1 {
+		t.Error("expected local client to receive the message")
+	}
+	if received(remote) != 1 {
+		t.Error("expected client on the other instance to receive the message")
+	}
+	if received(other) != 0 {
+		t.Error("expected client in another session not to receive the message")
+	}
+
+	if n := h1.NotifyUser("u1", []byte(`{"type":"task_finished"}`)); n != 1 {
+		t.Errorf("expected 1 local notification, got %d", n)
+	}
+	if received(local) != 1 || received(remote) != 1 {
+		t.Error("expected the user's clients on both instances to be notified")
+	}
+	if received(other) != 0 {
+		t.Error("expected another user's client not to be notified")
+	}
+}
+
+func TestClient_Limits(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		streams   int32
+		frames    []string
+		wantCodes []string
+		wantLimit string
+	}{
+		{
+			name:      "message rate",
+			opts:      []Option{WithClientLimits(1, 2, 0)},
+			frames:    []string{`{"v":1,"type":"control","id":"1","payload":{"action":"ping"}}`, `{"v":1,"type":"control","id":"2","payload":{"action":"ping"}}`, `{"v":1,"type":"control","id":"3","payload":{"action":"ping"}}`},
+			wantCodes: []string{"", "", ErrCodeRateLimited},
+			wantLimit: "messages",
+		},
+		{
+			name:      "concurrent streams",
+			opts:      []Option{WithClientLimits(0, 0, 2)},
+			streams:   2,
+			frames:    []string{`{"v":1,"type":"chat","id":"1","payload":{"content":"Hi"}}`},
+			wantCodes: []string{ErrCodeRateLimited},
+			wantLimit: "streams",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(nil, tt.opts...)
+			c := &Client{hub: h, send: make(chan outbound, 8), userID: "u1", sessionID: "s1", protocol: protocolEnvelope, ctx: context.Background()}
+			if h.messageRate > 0 {
+				c.limiter = ratelimit.NewBucket(h.messageRate, h.messageBurst)
+			}
+			c.streams.Store(tt.streams)
+
+			for i, frame := range tt.frames {
+				c.handleEnvelope([]byte(frame))
+
+				var env Envelope
+				if err := json.Unmarshal((<-c.send).data, &env); err != nil {
+					t.Fatalf("Failed to decode frame: %v", err)
+				}
+				if tt.wantCodes[i] == "" {
+					if env.Type == TypeError {
+						t.Fatalf("frame %d: unexpected error %s", i, env.Payload)
+					}
+					continue
+				}
+
+				var payload errorPayload
+				if err := json.Unmarshal(env.Payload, &payload); err != nil {
+					t.Fatalf("Failed to decode error payload: %v", err)
+				}
+				if env.Type != TypeError || payload.Code != tt.wantCodes[i] || payload.Details["limit"] != tt.wantLimit {
+					t.Errorf("frame %d: unexpected error frame %s", i, env.Payload)
+				}
+			}
+			if got := c.streams.Load(); got != tt.streams {
+				t.Errorf("expected %d streams in flight, got %d", tt.streams, got)
+			}
+		})
+	}
+}
+
+func TestHub_Stats(t *testing.T) {
+	h := NewHub(nil, WithSessionSharing(shareAll))
+	newTestClient(h, "u1", "s1", 1)
+	newTestClient(h, "u1", "s2", 1)
+	newTestClient(h, "u2", "s2", 1)
+	h.inflight.Add(1)
+
+	want := map[string]int64{"connections": 3, "sessions": 2, "users": 2, "streams_in_flight": 1}
+	got := h.Stats()
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("expected %s %d, got %d", k, v, got[k])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/neuronai/backend/go/internal/metrics"
+)
+
+// Each ping carries the time it was sent, so the pong the client echoes it in
+// gives the connection's round-trip time without tracking pings in flight.
+
+// statsEvent reports a connection's health to the client: the last measured
+// round-trip time, zero until the first pong, and the frames waiting in its
+// send buffer.
+type statsEvent struct {
+	Event     string  `json:"event"`
+	SessionID string  `json:"session_id"`
+	RTTMillis float64 `json:"rtt_ms,omitempty"`
+	Queued    int     `json:"queued"`
+}
+
+// ConnectionInfo describes an open connection for operators.
+type ConnectionInfo struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Protocol  string `json:"protocol"`
+	// Device, ClientVersion and Locale describe the client app, empty when
+	// it did not say.
+	Device        string    `json:"device,omitempty"`
+	ClientVersion string    `json:"client_version,omitempty"`
+	Locale        string    `json:"locale,omitempty"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	// RTTMillis is the last ping round-trip time, zero until the first pong.
+	RTTMillis float64 `json:"rtt_ms,omitempty"`
+	Streams   int32   `json:"streams_in_flight"`
+	Queued    int     `json:"queued"`
+}
+
+// WithStats sends envelope and binary clients a stats frame every interval.
+func WithStats(interval time.Duration) Option {
+	return func(h *Hub) {
+		h.statsInterval = interval
+	}
+}
+
+// ping sends a ping stamped with the current time. It must only be called by
+// the write pump.
+func (c *Client) ping() error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return c.conn.WriteMessage(websocket.PingMessage, []byte(stamp))
+}
+
+// observePong records the round-trip time of the ping whose stamp appData
+// echoes. Pongs without a stamp, e.g. unsolicited ones, are ignored.
+func (c *Client) observePong(appData string) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+	c.rtt.Store(int64(rtt))
+	metrics.ObserveRTT(rtt)
+}
+
+// rttMillis returns the last round-trip time in milliseconds.
+func (c *Client) rttMillis() float64 {
+	return float64(c.rtt.Load()) / float64(time.Millisecond)
+}
+
+// statsFrame encodes c's stats frame.
+func (c *Client) statsFrame() outbound {
+	data, _ := json.Marshal(statsEvent{
+		Event:     "stats",
+		SessionID: c.sessionID,
+		RTTMillis: c.rttMillis(),
+		Queued:    len(c.send),
+	})
+	return c.frame(TypeControl, "", data)
+}
+
+// protocolName names a wire protocol version in the connection listing.
+func protocolName(protocol int) string {
+	switch protocol {
+	case protocolEnvelope:
+		return "envelope"
+	case protocolBinary:
+		return "binary"
+	default:
+		return "legacy"
+	}
+}
+
+// Connections lists the open connections, oldest first.
+func (h *Hub) Connections() []ConnectionInfo {
+	conns := []ConnectionInfo{}
+	h.rlockShards(func(s *shard) {
+		for c := range s.clients {
+			conns = append(conns, ConnectionInfo{
+				UserID:        c.userID,
+				SessionID:     c.sessionID,
+				Protocol:      protocolName(c.protocol),
+				Device:        c.clientInfo.Device,
+				ClientVersion: c.clientInfo.Version,
+				Locale:        c.clientInfo.Locale,
+				ConnectedAt:   c.connectedAt,
+				RTTMillis:     c.rttMillis(),
+				Streams:       c.streams.Load(),
+				Queued:        len(c.send),
+			})
+		}
+	})
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ConnectedAt.Before(conns[j].ConnectedAt)
+	})
+	return conns
+}
+
+// ConnectionsHandler serves GET /admin/connections.
+func (h *Hub) ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"connections": h.Connections()})
+}
@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_StatsAndConnections(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithStats(20*time.Millisecond))
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	// Pretend the client answered a ping sent 30ms ago.
+	h.rlockShards(func(s *shard) {
+		for c := range s.clients {
+			c.observePong(strconv.FormatInt(time.Now().Add(-30*time.Millisecond).UnixNano(), 10))
+			c.observePong("unsolicited")
+		}
+	})
+
+	env := readEnvelopes(t, conn, 1)[0]
+	if env.Type != TypeControl {
+		t.Fatalf("expected control envelope, got %q", env.Type)
+	}
+	var stats statsEvent
+	if err := json.Unmarshal(env.Payload, &stats); err != nil {
+		t.Fatalf("Failed to unmarshal stats: %v", err)
+	}
+	if stats.Event != "stats" || stats.SessionID != "s1" || stats.RTTMillis < 30 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ConnectionsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/connections", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Connections []ConnectionInfo `json:"connections"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(body.Connections) != 1 {
+		t.Fatalf("expected 1 connection, got %+v", body.Connections)
+	}
+	got := body.Connections[0]
+	if got.UserID != "user-1" || got.SessionID != "s1" || got.Protocol != "envelope" || got.RTTMillis < 30 || got.ConnectedAt.IsZero() {
+		t.Errorf("unexpected connection %+v", got)
+	}
+}
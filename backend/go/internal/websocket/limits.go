@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/logging"
+	"github.com/neuronai/backend/go/internal/ratelimit"
+)
+
+// limitRestoreTimeout bounds the store lookup made for each new connection.
+const limitRestoreTimeout = time.Second
+
+// WithLimitStore persists each user's message bucket to store every interval
+// and when they disconnect, and restores it when they connect, so restarts
+// do not hand every client a fresh burst.
+func WithLimitStore(store ratelimit.Store, interval time.Duration) Option {
+	return func(h *Hub) {
+		h.limitStore = store
+		h.limitInterval = interval
+		h.departed = make(map[string]ratelimit.State)
+	}
+}
+
+// restoreLimiter restores c's message bucket from the store. Lookup failures
+// leave the bucket full rather than refusing the connection.
+func (h *Hub) restoreLimiter(ctx context.Context, c *Client) {
+	if h.limitStore == nil || c.limiter == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, limitRestoreTimeout)
+	defer cancel()
+
+	state, ok, err := h.limitStore.Load(ctx, c.userID)
+	if err != nil {
+		c.logger().Warn("Failed to restore rate limit", logging.Err(err))
+		return
+	}
+	if ok {
+		c.limiter.Restore(state)
+	}
+}
+
+// persistLimits saves the buckets every limitInterval until ctx is done.
+func (h *Hub) persistLimits(ctx context.Context) {
+	ticker := time.NewTicker(h.limitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.SaveLimits(ctx); err != nil {
+				h.log.Error("Failed to persist rate limits", logging.Err(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SaveLimits writes the message buckets of connected users and of users who
+// disconnected since the last save to the limit store. Full buckets are
+// skipped, as restoring them changes nothing. A user with several
+// connections is saved with the emptiest bucket.
+func (h *Hub) SaveLimits(ctx context.Context) error {
+	if h.limitStore == nil {
+		return nil
+	}
+
+	h.departedMu.Lock()
+	states := h.departed
+	h.departed = make(map[string]ratelimit.State)
+	h.departedMu.Unlock()
+
+	h.rlockShards(func(s *shard) {
+		for c := range s.clients {
+			if c.limiter != nil {
+				keepLowest(states, c.userID, c.limiter.State())
+			}
+		}
+	})
+
+	for userID, state := range states {
+		if state.Tokens >= float64(h.messageBurst) {
+			delete(states, userID)
+		}
+	}
+	return h.limitStore.Save(ctx, states)
+}
+
+// recordDeparture keeps c's bucket for the next save.
+func (h *Hub) recordDeparture(c *Client) {
+	if h.limitStore == nil || c.limiter == nil {
+		return
+	}
+	h.departedMu.Lock()
+	defer h.departedMu.Unlock()
+	keepLowest(h.departed, c.userID, c.limiter.State())
+}
+
+func keepLowest(states map[string]ratelimit.State, key string, state ratelimit.State) {
+	if prev, ok := states[key]; !ok || state.Tokens < prev.Tokens {
+		states[key] = state
+	}
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/ratelimit"
+)
+
+type memoryLimitStore struct {
+	states map[string]ratelimit.State
+}
+
+func (m *memoryLimitStore) Load(ctx context.Context, key string) (ratelimit.State, bool, error) {
+	state, ok := m.states[key]
+	return state, ok, nil
+}
+
+func (m *memoryLimitStore) Save(ctx context.Context, states map[string]ratelimit.State) error {
+	for key, state := range states {
+		m.states[key] = state
+	}
+	return nil
+}
+
+func TestHub_SaveLimits(t *testing.T) {
+	store := &memoryLimitStore{states: make(map[string]ratelimit.State)}
+	h := NewHub(nil, WithClientLimits(0.001, 2, 0), WithLimitStore(store, time.Hour))
+
+	limited := func(userID string) *Client {
+		c := newTestClient(h, userID, userID+"-session", 1)
+		c.limiter = ratelimit.NewBucket(h.messageRate, h.messageBurst)
+		return c
+	}
+
+	idle := limited("idle")
+	busy := limited("busy")
+	departed := limited("departed")
+	busy.limiter.Allow()
+	departed.limiter.Allow()
+	departed.limiter.Allow()
+
+	removeTestClient(departed)
+
+	if err := h.SaveLimits(context.Background()); err != nil {
+		t.Fatalf("SaveLimits() error = %v", err)
+	}
+	if _, ok := store.states[idle.userID]; ok {
+		t.Error("expected full bucket to be skipped")
+	}
+
+	tests := []struct {
+		userID string
+		want   int
+	}{
+		{"busy", 1},
+		{"departed", 0},
+		{"idle", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userID, func(t *testing.T) {
+			c := &Client{userID: tt.userID, limiter: ratelimit.NewBucket(h.messageRate, h.messageBurst)}
+			h.restoreLimiter(context.Background(), c)
+
+			got := 0
+			for c.limiter.Allow() {
+				got++
+			}
+			if got != tt.want {
+				t.Errorf("expected %d messages allowed after restore, got %d", tt.want, got)
+			}
+		})
+	}
+}
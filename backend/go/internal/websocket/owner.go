@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// Session IDs are chosen by clients, so a session belongs to the user who
+// first connects to it. Connections and resumes by other users are refused,
+// or they would receive the session's live output and replay buffer. A
+// session is released once it has no connections and nothing left to
+// replay. Ownership is recorded per instance, so with a backplane a session
+// may be claimed by different users on different instances. Session messages
+// carry their owner across the backplane, and reach only the clients that may
+// join that owner's session; an instance replaying them for resumes claims
+// the session for their owner. Deployments where users collaborate in shared
+// sessions decide who may join another user's session with
+// WithSessionSharing.
+
+// errSessionForbidden rejects a connection to another user's session.
+var errSessionForbidden = errors.New("session belongs to another user")
+
+// closeSessionForbidden closes connections to another user's session that
+// were admitted past the check in HandleWebSocket by a concurrent upgrade.
+const closeSessionForbidden = 4403
+
+var sessionForbiddenMessage = websocket.FormatCloseMessage(closeSessionForbidden, errSessionForbidden.Error())
+
+// SessionAuthorizer reports whether userID may join sessionID, which belongs
+// to owner. It is called with a shard lock held and must not block.
+type SessionAuthorizer func(userID, sessionID, owner string) bool
+
+// WithSessionSharing lets users join the sessions of others that authorize
+// allows. Without it, only a session's owner may connect to it.
+func WithSessionSharing(authorize SessionAuthorizer) Option {
+	return func(h *Hub) {
+		h.shareSession = authorize
+	}
+}
+
+// checkOwner reports whether userID may join sessionID. The caller must hold
+// mu, for reading at least.
+func (s *shard) checkOwner(sessionID, userID string) error {
+	owner, ok := s.owners[sessionID]
+	if !ok || s.mayJoin(sessionID, userID, owner) {
+		return nil
+	}
+	return errSessionForbidden
+}
+
+// mayJoin reports whether userID may join sessionID, which belongs to owner.
+func (s *shard) mayJoin(sessionID, userID, owner string) bool {
+	return userID == owner || s.hub.shareSession != nil && s.hub.shareSession(userID, sessionID, owner)
+}
+
+// claim records c's user as the owner of its session, unless one is already
+// recorded. The caller must hold mu.
+func (s *shard) claim(c *Client) {
+	if _, ok := s.owners[c.sessionID]; !ok {
+		s.owners[c.sessionID] = c.userID
+	}
+}
+
+// adopt reports whether a message of sessionID from another instance, where
+// it belongs to owner, may join the session's replay log here, claiming the
+// session for owner if it has none. Local messages, with no owner, always
+// may. The caller must hold mu.
+func (s *shard) adopt(sessionID, owner string) bool {
+	if owner == "" {
+		return true
+	}
+	local, ok := s.owners[sessionID]
+	if !ok {
+		s.owners[sessionID] = owner
+		return true
+	}
+	return s.mayJoin(sessionID, local, owner)
+}
+
+// release forgets the owner of sessionID once it has no connections and
+// nothing to replay. The caller must hold mu.
+func (s *shard) release(sessionID string) {
+	if len(s.sessionClients[sessionID]) > 0 {
+		return
+	}
+	if s.replay != nil && s.replay.has(sessionID) {
+		return
+	}
+	delete(s.owners, sessionID)
+}
+
+// checkSessionOwner reports whether userID may join sessionID.
+func (h *Hub) checkSessionOwner(sessionID, userID string) error {
+	s := h.shardFor(sessionID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkOwner(sessionID, userID)
+}
+
+// TransferSessions hands the sessions owned by user from to user to, as when
+// a guest logs in and reconnects to its sessions, and returns how many it
+// moved.
+func (h *Hub) TransferSessions(from, to string) int {
+	n := 0
+	h.lockShards(func(s *shard) {
+		for id, owner := range s.owners {
+			if owner == from {
+				s.owners[id] = to
+				n++
+			}
+		}
+	})
+	return n
+}
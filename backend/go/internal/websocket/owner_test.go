@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_RefusesOtherUsersSession(t *testing.T) {
+	h := NewHub(nil, WithJWTSecret(testSecret), WithReplayBuffer(4, time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+	srv := newHubServer(t, h)
+
+	owner, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer owner.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	for _, query := range []string{"session_id=s1&v=1", "session_id=s1&v=1&resume=0"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, query+"&token="+signToken(t, testSecret, "user-2")), nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: expected another user to be refused with 403, got %v", query, resp)
+		}
+	}
+
+	again, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&resume=0&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("expected the owner to connect again, got %v", err)
+	}
+	again.Close()
+}
+
+func TestShard_AdmitChecksOwner(t *testing.T) {
+	h := NewHub(nil)
+	owner := newTestClient(h, "u1", "s1", 4)
+
+	other := newTestClient(h, "u2", "s1", 4)
+	if _, ok := <-other.send; ok {
+		t.Error("expected another user's connection to be closed")
+	}
+	if string(other.closeMessage) != string(sessionForbiddenMessage) {
+		t.Errorf("expected the session forbidden close message, got %q", other.closeMessage)
+	}
+
+	removeTestClient(owner)
+	if c := newTestClient(h, "u2", "s1", 4); h.Sessions("u2")["s1"] != 1 {
+		t.Errorf("expected a released session to be claimed by another user, closed %q", c.closeMessage)
+	}
+}
+
+func TestShard_ReplayKeepsOwner(t *testing.T) {
+	h := NewHub(nil, WithReplayBuffer(4, time.Minute))
+	owner := newTestClient(h, "u1", "s1", 4)
+	h.SendToSession("s1", []byte(`"a"`))
+	removeTestClient(owner)
+
+	newTestClient(h, "u2", "s1", 4)
+	if h.Sessions("u2")["s1"] != 0 {
+		t.Error("expected a session with messages to replay to stay with its owner")
+	}
+}
+
+func TestHub_BackplaneKeepsSessionOwner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	planes := newMemoryBackplanes(4)
+	h1 := NewHub(nil, WithBackplane(planes[0]))
+	h2 := NewHub(nil, WithBackplane(planes[1]))
+	h3 := NewHub(nil, WithBackplane(planes[2]), WithReplayBuffer(4, time.Minute))
+	for i, h := range []*Hub{h1, h2, h3} {
+		go h.Run(ctx)
+		waitForBackplane(t, planes[i])
+	}
+
+	owner := newTestClient(h1, "u1", "s1", 4)
+	other := newTestClient(h2, "u2", "s1", 4)
+	if h2.Sessions("u2")["s1"] != 1 {
+		t.Fatal("expected the other instance to admit a user it has no owner for")
+	}
+
+	h1.SendToSession("s1", []byte(`"a"`))
+	if received(owner) != 1 {
+		t.Error("expected the owner to receive its message")
+	}
+	if received(other) != 0 {
+		t.Error("expected another user on another instance not to receive the owner's message")
+	}
+	h2.SendToSession("s1", []byte(`"b"`))
+	if received(owner) != 0 {
+		t.Error("expected the owner not to receive another user's message")
+	}
+
+	// The instance replaying the owner's messages claims the session for it.
+	newTestClient(h3, "u2", "s1", 4)
+	if h3.Sessions("u2")["s1"] != 0 {
+		t.Error("expected another user to be refused the session replayed for its owner")
+	}
+
+	shared := NewHub(nil, WithBackplane(planes[3]), WithSessionSharing(shareAll))
+	go shared.Run(ctx)
+	waitForBackplane(t, planes[3])
+	guest := newTestClient(shared, "u2", "s1", 4)
+	h1.SendToSession("s1", []byte(`"c"`))
+	if received(guest) != 1 {
+		t.Error("expected a user the owner shares with to receive its message")
+	}
+}
+
+func TestHub_TransferSessions(t *testing.T) {
+	h := NewHub(nil)
+	newTestClient(h, "guest-1", "s1", 4)
+
+	if n := h.TransferSessions("guest-1", "u1"); n != 1 {
+		t.Errorf("expected 1 session transferred, got %d", n)
+	}
+	newTestClient(h, "u1", "s1", 4)
+	if h.Sessions("u1")["s1"] != 1 {
+		t.Error("expected the user to join the guest's session")
+	}
+}
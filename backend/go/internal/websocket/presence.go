@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// With WithPresence, presence and activity events tell a session's envelope
+// clients who else is connected and what the agent is doing. Legacy clients
+// never receive them. They are tracked per gateway instance and are not
+// replayed on resume.
+
+// Presence events.
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+// Agent activity states, derived from the chat's upstream stream.
+const (
+	// ActivityWorking means a chat was forwarded and no response has arrived.
+	ActivityWorking = "working"
+	// ActivityTyping means responses are streaming.
+	ActivityTyping = "typing"
+	// ActivityIdle means the chat finished or failed.
+	ActivityIdle = "idle"
+)
+
+// presenceEvent announces a user joining or leaving a session. Users lists
+// everyone connected to the session afterwards.
+type presenceEvent struct {
+	Event     string   `json:"event"`
+	SessionID string   `json:"session_id"`
+	UserID    string   `json:"user_id"`
+	Users     []string `json:"users"`
+}
+
+// activityEvent reports a change in the agent's activity on a user's chat.
+type activityEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	State     string `json:"state"`
+	AgentType string `json:"agent_type,omitempty"`
+}
+
+// announcePresence tells c's session that c's user joined or left, if c is
+// the user's first or last connection there. The caller must hold mu.
+func (s *shard) announcePresence(c *Client, event string) {
+	if !s.hub.presence {
+		return
+	}
+	for other := range s.sessionClients[c.sessionID] {
+		if other != c && other.userID == c.userID {
+			return
+		}
+	}
+
+	data, _ := json.Marshal(presenceEvent{
+		Event:     event,
+		SessionID: c.sessionID,
+		UserID:    c.userID,
+		Users:     s.sessionUsers(c.sessionID),
+	})
+	s.deliver(s.presenceClients(c.sessionID), func(client *Client) outbound {
+		return client.frame(TypePresence, "", data)
+	})
+}
+
+// sessionUsers returns the users connected to sessionID, sorted. The caller
+// must hold mu.
+func (s *shard) sessionUsers(sessionID string) []string {
+	seen := make(map[string]bool)
+	users := []string{}
+	for c := range s.sessionClients[sessionID] {
+		if !seen[c.userID] {
+			seen[c.userID] = true
+			users = append(users, c.userID)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// presenceClients returns the connections in sessionID that receive presence
+// and activity events. The caller must hold mu.
+func (s *shard) presenceClients(sessionID string) map[*Client]bool {
+	set := make(map[*Client]bool)
+	for c := range s.sessionClients[sessionID] {
+		if c.protocol != protocolLegacy {
+			set[c] = true
+		}
+	}
+	return set
+}
+
+// sendActivity tells the local connections in sessionID about the agent's
+// activity on userID's chat.
+func (h *Hub) sendActivity(sessionID, userID, state, agentType string) {
+	if !h.presence {
+		return
+	}
+	data, _ := json.Marshal(activityEvent{
+		Event:     "activity",
+		SessionID: sessionID,
+		UserID:    userID,
+		State:     state,
+		AgentType: agentType,
+	})
+
+	s := h.shardFor(sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliver(s.presenceClients(sessionID), func(c *Client) outbound {
+		return c.frame(TypeActivity, "", data)
+	})
+}
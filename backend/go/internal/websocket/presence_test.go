@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readEnvelopes reads n envelopes, splitting coalesced text frames.
+func readEnvelopes(t *testing.T, conn *websocket.Conn, n int) []Envelope {
+	t.Helper()
+
+	var envs []Envelope
+	for len(envs) < n {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame after %d envelopes: %v", len(envs), err)
+		}
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var env Envelope
+			if err := json.Unmarshal(line, &env); err != nil {
+				t.Fatalf("Failed to unmarshal envelope %s: %v", line, err)
+			}
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
+func TestHub_Presence(t *testing.T) {
+	h := NewHub(startMockUpstream(t), WithJWTSecret(testSecret), WithPresence(), WithSessionSharing(shareAll))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+	srv := newHubServer(t, h)
+
+	dial := func(userID string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&v=1&token="+signToken(t, testSecret, userID)), nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		waitForSession(t, h, userID, "s1")
+		return conn
+	}
+
+	alice := dial("user-1")
+	defer alice.Close()
+	bob := dial("user-2")
+
+	var joined presenceEvent
+	envs := readEnvelopes(t, alice, 2)
+	json.Unmarshal(envs[1].Payload, &joined)
+	if envs[1].Type != TypePresence || joined.Event != PresenceJoin || joined.UserID != "user-2" || len(joined.Users) != 2 {
+		t.Errorf("expected user-2 join with two users, got %+v", envs[1])
+	}
+
+	bob.WriteJSON(Envelope{V: protocolEnvelope, Type: TypeChat, ID: "c-1", Payload: []byte(`{"content":"Hello"}`)})
+
+	var states []string
+	for _, env := range readEnvelopes(t, alice, 4) {
+		if env.Type != TypeActivity {
+			continue
+		}
+		var activity activityEvent
+		json.Unmarshal(env.Payload, &activity)
+		if activity.UserID != "user-2" {
+			t.Errorf("expected activity on user-2's chat, got %+v", activity)
+		}
+		states = append(states, activity.State)
+	}
+	want := []string{ActivityWorking, ActivityTyping, ActivityIdle}
+	if len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+		t.Errorf("expected activity %v, got %v", want, states)
+	}
+
+	bob.Close()
+	var left presenceEvent
+	env := readEnvelope(t, alice)
+	json.Unmarshal(env.Payload, &left)
+	if env.Type != TypePresence || left.Event != PresenceLeave || left.UserID != "user-2" || len(left.Users) != 1 {
+		t.Errorf("expected user-2 leave with one user, got %+v", env)
+	}
+}
@@ -0,0 +1,129 @@
+package websocket
+
+import "time"
+
+// replayEntry is a session message with its sequence number and stream ID.
+type replayEntry struct {
+	seq      uint64
+	streamID string
+	data     []byte
+}
+
+// sessionLog is the ring of a session's most recent messages.
+type sessionLog struct {
+	entries []replayEntry
+	// start indexes the oldest entry once the ring is full.
+	start   int
+	last    uint64
+	updated time.Time
+}
+
+// replayBuffer numbers each session's outbound chat messages and keeps the
+// last size of them, so a client reconnecting after a network blip can be
+// sent what it missed. A session's log is dropped once it has had no
+// messages and no connections for ttl. Each shard has its own, guarded by
+// the shard's mu.
+type replayBuffer struct {
+	size     int
+	ttl      time.Duration
+	sessions map[string]*sessionLog
+	now      func() time.Time
+}
+
+func newReplayBuffer(size int, ttl time.Duration) *replayBuffer {
+	return &replayBuffer{
+		size:     size,
+		ttl:      ttl,
+		sessions: make(map[string]*sessionLog),
+		now:      time.Now,
+	}
+}
+
+// append records data, a message of the chat streamID, as the next message of
+// sessionID and returns its sequence number. Sequence numbers start at 1.
+func (b *replayBuffer) append(sessionID, streamID string, data []byte) uint64 {
+	l, ok := b.sessions[sessionID]
+	if !ok {
+		l = &sessionLog{}
+		b.sessions[sessionID] = l
+	}
+
+	l.last++
+	l.updated = b.now()
+	e := replayEntry{seq: l.last, streamID: streamID, data: data}
+	if len(l.entries) < b.size {
+		l.entries = append(l.entries, e)
+	} else {
+		l.entries[l.start] = e
+		l.start = (l.start + 1) % b.size
+	}
+	return l.last
+}
+
+// since returns the messages of sessionID after seq, oldest first, and the
+// latest sequence number. complete is false when some of the missed messages
+// are no longer retained, or seq is ahead of this buffer, e.g. because the
+// client was last connected to another gateway instance.
+func (b *replayBuffer) since(sessionID string, seq uint64) (entries []replayEntry, last uint64, complete bool) {
+	l, ok := b.sessions[sessionID]
+	if !ok {
+		return nil, 0, seq == 0
+	}
+	if seq > l.last {
+		return nil, l.last, false
+	}
+
+	n := len(l.entries)
+	complete = seq == l.last || l.entries[l.start].seq <= seq+1
+	for i := 0; i < n; i++ {
+		e := l.entries[(l.start+i)%n]
+		if e.seq > seq {
+			entries = append(entries, e)
+		}
+	}
+	return entries, l.last, complete
+}
+
+// sweep drops the logs of sessions idle for longer than ttl unless keep
+// reports that they are still in use.
+func (b *replayBuffer) sweep(keep func(sessionID string) bool) {
+	cutoff := b.now().Add(-b.ttl)
+	for id, l := range b.sessions {
+		if l.updated.Before(cutoff) && !keep(id) {
+			delete(b.sessions, id)
+		}
+	}
+}
+
+// has reports whether a log of sessionID is retained.
+func (b *replayBuffer) has(sessionID string) bool {
+	_, ok := b.sessions[sessionID]
+	return ok
+}
+
+// missed returns how many messages of sessionID followed seq, retained or
+// not. ok is false when seq is ahead of this buffer.
+func (b *replayBuffer) missed(sessionID string, seq uint64) (n uint64, ok bool) {
+	l, ok := b.sessions[sessionID]
+	if !ok {
+		return 0, seq == 0
+	}
+	if seq > l.last {
+		return 0, false
+	}
+	return l.last - seq, true
+}
+
+// translate returns the sequence number in this buffer after which the last
+// missed messages of sessionID follow, for a client that missed them on
+// another instance. ok is false when this buffer has fewer messages.
+func (b *replayBuffer) translate(sessionID string, missed uint64) (seq uint64, ok bool) {
+	l, ok := b.sessions[sessionID]
+	if !ok {
+		return 0, missed == 0
+	}
+	if missed > l.last {
+		return 0, false
+	}
+	return l.last - missed, true
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReplayBuffer_Since(t *testing.T) {
+	b := newReplayBuffer(3, time.Minute)
+	for _, msg := range []string{"1", "2", "3", "4", "5"} {
+		b.append("s1", "", []byte(msg))
+	}
+
+	tests := []struct {
+		name         string
+		sessionID    string
+		seq          uint64
+		wantSeqs     []uint64
+		wantComplete bool
+	}{
+		{"up to date", "s1", 5, nil, true},
+		{"gap retained", "s1", 3, []uint64{4, 5}, true},
+		{"oldest retained boundary", "s1", 2, []uint64{3, 4, 5}, true},
+		{"gap evicted", "s1", 1, []uint64{3, 4, 5}, false},
+		{"ahead of buffer", "s1", 9, nil, false},
+		{"unknown session from start", "s2", 0, nil, true},
+		{"unknown session", "s2", 4, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, _, complete := b.since(tt.sessionID, tt.seq)
+
+			var seqs []uint64
+			for _, e := range entries {
+				seqs = append(seqs, e.seq)
+			}
+			if len(seqs) != len(tt.wantSeqs) {
+				t.Fatalf("expected seqs %v, got %v", tt.wantSeqs, seqs)
+			}
+			for i := range seqs {
+				if seqs[i] != tt.wantSeqs[i] {
+					t.Fatalf("expected seqs %v, got %v", tt.wantSeqs, seqs)
+				}
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("expected complete %v, got %v", tt.wantComplete, complete)
+			}
+		})
+	}
+}
+
+func TestReplayBuffer_Sweep(t *testing.T) {
+	now := time.Now()
+	b := newReplayBuffer(2, time.Minute)
+	b.now = func() time.Time { return now }
+	b.append("idle", "", []byte("x"))
+	b.append("connected", "", []byte("x"))
+
+	now = now.Add(2 * time.Minute)
+	b.append("recent", "", []byte("x"))
+	b.sweep(func(sessionID string) bool { return sessionID == "connected" })
+
+	for id, want := range map[string]bool{"idle": false, "connected": true, "recent": true} {
+		if _, ok := b.sessions[id]; ok != want {
+			t.Errorf("expected session %s retained=%v", id, want)
+		}
+	}
+}
+
+func TestHub_Resume(t *testing.T) {
+	h := NewHub(nil, WithReplayBuffer(4, time.Minute))
+	live := newTestClient(h, "u1", "s1", 8)
+	for _, msg := range []string{`"a"`, `"b"`, `"c"`} {
+		h.SendToSession("s1", []byte(msg))
+	}
+	received(live)
+
+	resumed := &Client{hub: h, send: make(chan outbound, 8), userID: "u1", sessionID: "s1", protocol: protocolEnvelope, resume: true, lastSeq: 1}
+	s := resumed.shard()
+	s.mu.Lock()
+	s.admit(resumed)
+	s.mu.Unlock()
+	h.SendToSession("s1", []byte(`"d"`))
+
+	var frames []Envelope
+	for len(resumed.send) > 0 {
+		var env Envelope
+		if err := json.Unmarshal((<-resumed.send).data, &env); err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		frames = append(frames, env)
+	}
+
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(frames))
+	}
+	for i, want := range []string{`"b"`, `"c"`} {
+		if frames[i].Type != TypeChat || frames[i].Seq != uint64(i+2) || string(frames[i].Payload) != want {
+			t.Errorf("unexpected replayed frame %d: %+v", i, frames[i])
+		}
+	}
+
+	var ev resumedEvent
+	if err := json.Unmarshal(frames[2].Payload, &ev); err != nil {
+		t.Fatalf("Failed to decode resumed event: %v", err)
+	}
+	if ev.Event != "resumed" || ev.Seq != 3 || ev.Replayed != 2 || !ev.Complete {
+		t.Errorf("unexpected resumed event %+v", ev)
+	}
+	if frames[3].Seq != 4 || string(frames[3].Payload) != `"d"` {
+		t.Errorf("expected live message with seq 4 after replay, got %+v", frames[3])
+	}
+}
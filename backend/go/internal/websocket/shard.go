@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// The hub splits its clients across shards by a hash of their session ID.
+// Each shard has its own lock, indexes, replay buffer and register loop, so
+// connections to different sessions do not contend. A session lives entirely
+// in one shard; deliveries to a user or a channel, which span sessions, visit
+// the shards one at a time and never hold two shard locks at once.
+
+const (
+	defaultShards = 16
+	// shardQueueSize buffers each shard's register and unregister queues so
+	// upgrades and disconnects do not wait for its loop.
+	shardQueueSize = 256
+)
+
+type shard struct {
+	hub     *Hub
+	mu      sync.RWMutex
+	clients map[*Client]bool
+	// sessionClients, userClients and channelClients index clients for
+	// routed delivery and are kept in step with clients under mu.
+	sessionClients map[string]map[*Client]bool
+	userClients    map[string]map[*Client]bool
+	channelClients map[string]map[*Client]bool
+	// owners maps the shard's sessions to the users they belong to. It is
+	// guarded by mu.
+	owners map[string]string
+	// replay keeps the recent messages of the shard's sessions when the hub
+	// has a replay buffer. It is guarded by mu.
+	replay     *replayBuffer
+	register   chan *Client
+	unregister chan *Client
+}
+
+// WithShards splits the hub's clients across n shards. Values below 1 mean a
+// single shard.
+func WithShards(n int) Option {
+	return func(h *Hub) {
+		h.shardCount = n
+	}
+}
+
+func newShard(h *Hub) *shard {
+	s := &shard{
+		hub:            h,
+		clients:        make(map[*Client]bool),
+		sessionClients: make(map[string]map[*Client]bool),
+		userClients:    make(map[string]map[*Client]bool),
+		channelClients: make(map[string]map[*Client]bool),
+		owners:         make(map[string]string),
+		register:       make(chan *Client, shardQueueSize),
+		unregister:     make(chan *Client, shardQueueSize),
+	}
+	if h.replaySize > 0 {
+		s.replay = newReplayBuffer(h.replaySize, h.replayTTL)
+	}
+	return s
+}
+
+// shardFor returns the shard holding sessionID's clients.
+func (h *Hub) shardFor(sessionID string) *shard {
+	if len(h.shards) == 1 {
+		return h.shards[0]
+	}
+	f := fnv.New32a()
+	f.Write([]byte(sessionID))
+	return h.shards[f.Sum32()%uint32(len(h.shards))]
+}
+
+// shard returns the shard holding c.
+func (c *Client) shard() *shard {
+	return c.hub.shardFor(c.sessionID)
+}
+
+// lockShards calls fn for each shard in turn with its lock held.
+func (h *Hub) lockShards(fn func(s *shard)) {
+	for _, s := range h.shards {
+		s.mu.Lock()
+		fn(s)
+		s.mu.Unlock()
+	}
+}
+
+// rlockShards calls fn for each shard in turn with its read lock held.
+func (h *Hub) rlockShards(fn func(s *shard)) {
+	for _, s := range h.shards {
+		s.mu.RLock()
+		fn(s)
+		s.mu.RUnlock()
+	}
+}
+
+// run registers and unregisters the shard's clients, and sweeps its replay
+// buffer, until ctx is done.
+func (s *shard) run(ctx context.Context) {
+	var sweep <-chan time.Time
+	if s.replay != nil {
+		ticker := time.NewTicker(replaySweepInterval)
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
+	for {
+		select {
+		case client := <-s.register:
+			s.mu.Lock()
+			s.admit(client)
+			s.mu.Unlock()
+
+		case client := <-s.unregister:
+			s.mu.Lock()
+			s.remove(client)
+			s.mu.Unlock()
+
+		case <-sweep:
+			s.mu.Lock()
+			s.replay.sweep(func(sessionID string) bool {
+				return len(s.sessionClients[sessionID]) > 0
+			})
+			for sessionID := range s.owners {
+				s.release(sessionID)
+			}
+			s.mu.Unlock()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// admit adds c unless the hub is draining, c's session belongs to another
+// user or c would exceed a connection cap, in which case c is closed. The
+// caller must hold mu.
+func (s *shard) admit(c *Client) {
+	switch {
+	case s.hub.draining.Load():
+		c.closeMessage = drainCloseMessage
+		c.backlog.close(c)
+	case s.checkOwner(c.sessionID, c.userID) != nil:
+		c.closeMessage = sessionForbiddenMessage
+		c.backlog.close(c)
+	case s.hub.reserveConnection(c.userID) != nil:
+		// A concurrent upgrade took the last slot since the check in
+		// HandleWebSocket.
+		c.closeMessage = overCapacityMessage
+		c.backlog.close(c)
+	default:
+		s.add(c)
+	}
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHub_ShardsBySession(t *testing.T) {
+	h := NewHub(nil, WithShards(8), WithSessionSharing(shareAll))
+	if len(h.shards) != 8 {
+		t.Fatalf("expected 8 shards, got %d", len(h.shards))
+	}
+
+	a := newTestClient(h, "u1", "s1", 4)
+	b := newTestClient(h, "u2", "s1", 4)
+	if a.shard() != b.shard() {
+		t.Error("expected clients of one session in the same shard")
+	}
+
+	used := make(map[*shard]bool)
+	for i := 0; i < 64; i++ {
+		c := newTestClient(h, "u1", fmt.Sprintf("session-%d", i), 4)
+		used[c.shard()] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("expected sessions spread across shards, used %d", len(used))
+	}
+
+	// Users and stats span shards.
+	if n := h.SendToUser("u1", []byte("x")); n != 65 {
+		t.Errorf("expected 65 deliveries to u1, got %d", n)
+	}
+	if stats := h.Stats(); stats["connections"] != 66 || stats["sessions"] != 65 || stats["users"] != 2 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+
+	if h := NewHub(nil, WithShards(0)); len(h.shards) != 1 {
+		t.Errorf("expected a single shard for WithShards(0), got %d", len(h.shards))
+	}
+}
+
+// BenchmarkHub_SessionTraffic sends session messages while connections
+// register and unregister, with 50k connections spread over 5k sessions.
+// Compare the shard counts on several cores, e.g. with -cpu 1,8.
+func BenchmarkHub_SessionTraffic(b *testing.B) {
+	const (
+		connections = 50000
+		perSession  = 10
+	)
+
+	for _, shards := range []int{1, defaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			h := NewHub(nil, WithShards(shards), WithSessionSharing(shareAll))
+			sessionIDs := make([]string, connections/perSession)
+			sessions := make([][]*Client, len(sessionIDs))
+			for i := range sessions {
+				sessionIDs[i] = fmt.Sprintf("s%d", i)
+				for j := 0; j < perSession; j++ {
+					sessions[i] = append(sessions[i], newTestClient(h, fmt.Sprintf("u%d", j), sessionIDs[i], 64))
+				}
+			}
+			if n := h.Stats()["connections"]; n != connections {
+				b.Fatalf("expected %d connections registered, got %d", connections, n)
+			}
+			message := []byte(`{"content":"x"}`)
+
+			var next atomic.Int64
+			var refused atomic.Bool
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(next.Add(1)) * 7919
+				for pb.Next() {
+					i = (i + 1) % len(sessions)
+
+					churn := newTestClient(h, "churn", sessionIDs[i], 64)
+					if h.SendToSession(sessionIDs[i], message) <= perSession {
+						refused.Store(true)
+					}
+					removeTestClient(churn)
+					for _, c := range sessions[i] {
+						received(c)
+					}
+				}
+			})
+			if refused.Load() {
+				b.Error("expected every churn connection registered")
+			}
+		})
+	}
+}
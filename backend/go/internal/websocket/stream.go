@@ -0,0 +1,266 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/neuronai/backend/go/internal/abuse"
+	"github.com/neuronai/backend/go/internal/admission"
+	"github.com/neuronai/backend/go/internal/attachment"
+	"github.com/neuronai/backend/go/internal/grpc"
+	pb "github.com/neuronai/backend/go/internal/grpc/pb"
+	"github.com/neuronai/backend/go/internal/metrics"
+	"github.com/neuronai/backend/go/internal/moderation"
+	"github.com/neuronai/backend/go/internal/preauth"
+	"github.com/neuronai/backend/go/internal/quota"
+	"github.com/neuronai/backend/go/internal/session"
+)
+
+// ErrOverloaded is returned by Stream when admission control sheds the chat.
+var ErrOverloaded = errors.New("AI service is at capacity")
+
+// RejectedError is returned by Stream when moderation rejects the chat.
+type RejectedError struct {
+	Category string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by content moderation: %s", e.Category)
+}
+
+// PreauthRejectedError is returned by Stream when the billing service rejects
+// the chat.
+type PreauthRejectedError struct {
+	Reason string
+}
+
+func (e *PreauthRejectedError) Error() string {
+	return fmt.Sprintf("rejected by pre-authorization: %s", e.Reason)
+}
+
+// RateLimitedError is reported to a client whose message exceeded one of its
+// per-client limits.
+type RateLimitedError struct {
+	Limit string
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded: %s", e.Limit)
+}
+
+// QuotaExceededError is returned by Stream when the tenant of the chat has
+// used up its quota, which resets at Reset.
+type QuotaExceededError struct {
+	Tenant string
+	Reset  time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for tenant %s", e.Tenant)
+}
+
+// BlockedError is returned by Stream when abuse detection blocks the chat.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("blocked by abuse detection: %s", e.Reason)
+}
+
+// StreamRequest is a chat to run through the hub's pipeline on behalf of any
+// transport that rides on the hub.
+type StreamRequest struct {
+	Chat        *pb.ChatRequest
+	Attachments []attachment.Reference
+	TraceID     string
+	// Client describes the client app to the Python service.
+	Client grpc.ClientInfo
+	// Tenant, if set, is charged for the chat unless ctx already charges a
+	// tenant, as HTTP requests metered by quota.Middleware do.
+	Tenant string
+	// Transport labels the chat in metrics.
+	Transport string
+	// IP is the client's address, for abuse detection.
+	IP string
+	// OnQueued is called when the chat waits behind another in its session.
+	OnQueued func(ahead int)
+	// OnPreauth, if set, receives every pre-authorization decision for an
+	// expensive chat, including holds.
+	OnPreauth func(preauth.Decision)
+	// OnSent, if set, is called once the chat has been sent to the Python
+	// service.
+	OnSent func()
+	// OnResponse receives each response from the Python service in order.
+	OnResponse func(*pb.ChatResponse)
+	// OnAudio, if set, receives audio replies such as synthesized speech,
+	// interleaved with the responses. Audio is dropped otherwise.
+	OnAudio func([]byte)
+	// Control, if set, pauses the chat's delivery and relays control actions
+	// to its upstream stream.
+	Control *StreamControl
+}
+
+// Stream refuses the chat during maintenance, charges it to its tenant's
+// quota, screens it for abuse, moderates it, resolves its attachments, pre-authorizes it if
+// expensive, applies admission control and session serialization, then
+// forwards it to the Python service and delivers every response up to the final one. The session's connections
+// are told when the agent starts working, starts typing and goes idle.
+func (h *Hub) Stream(ctx context.Context, req *StreamRequest) error {
+	h.inflight.Add(1)
+	defer h.inflight.Add(-1)
+	if h.isDraining() {
+		return ErrDraining
+	}
+	if h.maintenance != nil {
+		if err := h.maintenance.Err(); err != nil {
+			return err
+		}
+	}
+
+	chat := req.Chat
+
+	if h.quotas != nil && req.Tenant != "" && !quota.Metered(ctx) {
+		s, ok := h.quotas.Take(req.Tenant)
+		if !ok {
+			return &QuotaExceededError{Tenant: req.Tenant, Reset: s.Reset}
+		}
+		ctx = quota.NewContext(ctx, h.quotas, req.Tenant)
+	}
+	quota.AddTokens(ctx, quota.EstimateTokens(chat.Content))
+
+	if h.abuse != nil {
+		d := h.abuse.Check(ctx, &abuse.Request{
+			IP:        req.IP,
+			UserID:    chat.UserId,
+			TenantID:  req.Tenant,
+			SessionID: chat.SessionId,
+			Transport: req.Transport,
+			Content:   grpc.ScreenText(chat),
+		})
+		if d.Blocked() {
+			return &BlockedError{Reason: d.Reason}
+		}
+	}
+
+	if h.moderator != nil {
+		verdict, err := h.moderator.Check(ctx, &moderation.Request{
+			UserID:    chat.UserId,
+			SessionID: chat.SessionId,
+			Content:   grpc.ScreenText(chat),
+		})
+		if err != nil {
+			return err
+		}
+		if verdict.Rejected() {
+			return &RejectedError{Category: verdict.Category}
+		}
+		chat.Metadata = verdict.Annotate(chat.Metadata)
+	}
+
+	attachments, err := attachment.Resolve(ctx, h.attachments, chat.UserId, req.Attachments)
+	if err != nil {
+		return err
+	}
+	chat.Attachments = attachments
+
+	if h.preauth != nil {
+		if r := preauth.ForChat(chat.UserId, chat.SessionId, chat.MessageType); r != nil {
+			d, err := h.preauth.Check(ctx, r, req.OnPreauth)
+			if err != nil {
+				return err
+			}
+			if d.Action == preauth.ActionReject {
+				return &PreauthRejectedError{Reason: d.Reason}
+			}
+		}
+	}
+
+	if h.admission != nil {
+		switch h.admission.Admit(ctx) {
+		case admission.Shed:
+			return ErrOverloaded
+		case admission.Downgrade:
+			if chat.Metadata == nil {
+				chat.Metadata = make(map[string]string)
+			}
+			chat.Metadata[admission.MetadataDowngrade] = "true"
+		}
+	}
+
+	if h.sessions != nil {
+		release, err := h.sessions.Acquire(ctx, chat.SessionId, req.OnQueued)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	stream, err := h.pythonClient.ProcessStream(req.Client.NewOutgoingContext(ctx), chat)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		metrics.ObserveChat(req.Transport, err, start, req.TraceID)
+		return err
+	}
+	defer stream.Close()
+	if err := req.Control.attach(stream); err != nil {
+		metrics.ObserveChat(req.Transport, err, start, req.TraceID)
+		return err
+	}
+
+	if req.OnSent != nil {
+		req.OnSent()
+	}
+	h.sendActivity(chat.SessionId, chat.UserId, ActivityWorking, "")
+	defer h.sendActivity(chat.SessionId, chat.UserId, ActivityIdle, "")
+	typing := false
+
+	var built session.Builder
+	for {
+		msg, err := stream.RecvResponse()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			} else if ctx.Err() != nil {
+				// Report the cancellation rather than the gRPC status.
+				err = ctx.Err()
+			}
+			metrics.ObserveChat(req.Transport, err, start, req.TraceID)
+			return err
+		}
+		if err := req.Control.wait(ctx); err != nil {
+			metrics.ObserveChat(req.Transport, err, start, req.TraceID)
+			return err
+		}
+
+		resp := msg.GetChat()
+		if resp == nil {
+			if audio := msg.GetAudioData(); audio != nil && req.OnAudio != nil {
+				req.OnAudio(audio)
+			}
+			continue
+		}
+
+		if !typing {
+			typing = true
+			h.sendActivity(chat.SessionId, chat.UserId, ActivityTyping, resp.AgentType.String())
+		}
+		req.OnResponse(resp)
+		quota.AddTokens(ctx, quota.EstimateTokens(resp.Content))
+
+		if r, ok := built.Append(resp.MessageId, resp.Content, resp.AgentType.String(), resp.IsFinal); ok && h.responses != nil {
+			h.responses.Add(chat.SessionId, chat.UserId, r)
+		}
+
+		if resp.IsFinal {
+			metrics.ObserveChat(req.Transport, nil, start, req.TraceID)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients may select the wire protocol by offering a versioned
+// Sec-WebSocket-Protocol value instead of the v query parameter. New wire
+// formats get a new name, so deployed clients keep the format they were built
+// against.
+const (
+	subprotocolPrefix = "neuronai."
+
+	// closeUnsupportedProtocol closes connections that offered only
+	// subprotocols this server does not speak.
+	closeUnsupportedProtocol = 4426
+)
+
+// subprotocols maps each supported subprotocol to its wire protocol version,
+// in order of preference.
+var subprotocols = []struct {
+	name     string
+	protocol int
+}{
+	{"neuronai.v1.proto", protocolBinary},
+	{"neuronai.v1.json", protocolEnvelope},
+}
+
+var errUnsupportedSubprotocol = errors.New("unsupported subprotocol")
+
+// supportedSubprotocols lists the subprotocols advertised to clients.
+func supportedSubprotocols() string {
+	names := make([]string, len(subprotocols))
+	for i, s := range subprotocols {
+		names[i] = s.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// negotiateSubprotocol selects the most preferred supported subprotocol the
+// client offered. It returns an empty name if the client offered none of ours,
+// and errUnsupportedSubprotocol if it offered only ones we do not support.
+// The bearer token value is never taken for a subprotocol.
+func negotiateSubprotocol(r *http.Request) (string, int, error) {
+	offered := make(map[string]bool)
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i < len(protocols); i++ {
+		if protocols[i] == authSubprotocol {
+			i++
+			continue
+		}
+		if strings.HasPrefix(protocols[i], subprotocolPrefix) {
+			offered[protocols[i]] = true
+		}
+	}
+	if len(offered) == 0 {
+		return "", protocolLegacy, nil
+	}
+
+	for _, s := range subprotocols {
+		if offered[s.name] {
+			return s.name, s.protocol, nil
+		}
+	}
+	return "", protocolLegacy, errUnsupportedSubprotocol
+}
+
+// rejectSubprotocol closes an upgraded connection whose offered subprotocols
+// are all unsupported, advertising the ones that are.
+func (h *Hub) rejectSubprotocol(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeUnsupportedProtocol, "supported subprotocols: "+supportedSubprotocols()),
+		time.Now().Add(h.writeWait))
+	conn.Close()
+}
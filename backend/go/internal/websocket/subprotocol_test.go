@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiateSubprotocol(t *testing.T) {
+	tests := []struct {
+		name         string
+		offered      string
+		wantName     string
+		wantProtocol int
+		wantErr      bool
+	}{
+		{"none", "", "", protocolLegacy, false},
+		{"json", "neuronai.v1.json", "neuronai.v1.json", protocolEnvelope, false},
+		{"proto", "neuronai.v1.proto", "neuronai.v1.proto", protocolBinary, false},
+		{"prefers proto", "neuronai.v1.json, neuronai.v1.proto", "neuronai.v1.proto", protocolBinary, false},
+		{"skips unknown", "neuronai.v9.json, neuronai.v1.json", "neuronai.v1.json", protocolEnvelope, false},
+		{"with bearer", "bearer, token, neuronai.v1.json", "neuronai.v1.json", protocolEnvelope, false},
+		{"bearer only", "bearer, neuronai.v1.json", "", protocolLegacy, false},
+		{"foreign", "graphql-ws", "", protocolLegacy, false},
+		{"unknown", "neuronai.v9.json", "", protocolLegacy, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.offered != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.offered)
+			}
+
+			name, protocol, err := negotiateSubprotocol(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if name != tt.wantName || protocol != tt.wantProtocol {
+				t.Errorf("expected %q (v%d), got %q (v%d)", tt.wantName, tt.wantProtocol, name, protocol)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocket_Subprotocol(t *testing.T) {
+	_, srv := startHub(t, WithJWTSecret(testSecret))
+	token := signToken(t, testSecret, "user-1")
+
+	dialer := websocket.Dialer{Subprotocols: []string{"neuronai.v1.json", "bearer", token}}
+	conn, _, err := dialer.Dial(wsURL(srv, "session_id=s1"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != "neuronai.v1.json" {
+		t.Errorf("expected subprotocol neuronai.v1.json, got %q", conn.Subprotocol())
+	}
+	conn.WriteJSON(Envelope{V: protocolEnvelope, Type: TypeControl, ID: "p-1", Payload: []byte(`{"action":"ping"}`)})
+	if env := readEnvelope(t, conn); env.Type != TypeControl || env.ID != "p-1" {
+		t.Errorf("expected pong envelope, got %+v", env)
+	}
+
+	_, resp, err := dialer.Dial(wsURL(srv, "session_id=s1&v=2"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected conflicting version to be rejected, got %v", resp)
+	}
+}
+
+func TestHandleWebSocket_UnsupportedSubprotocol(t *testing.T) {
+	_, srv := startHub(t, WithJWTSecret(testSecret))
+
+	dialer := websocket.Dialer{Subprotocols: []string{"neuronai.v9.json"}}
+	conn, _, err := dialer.Dial(wsURL(srv, "session_id=s1"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, closeUnsupportedProtocol) {
+		t.Errorf("expected close code %d, got %v", closeUnsupportedProtocol, err)
+	}
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for the connection timing and buffer parameters. Operators on
+// high-latency networks, such as mobile clients, may lengthen the timeouts
+// with WithTimeouts and resize the buffers with WithBufferSizes.
+const (
+	defaultWriteWait       = 10 * time.Second
+	defaultPongWait        = 60 * time.Second
+	defaultPingPeriod      = (defaultPongWait * 9) / 10
+	defaultReadBufferSize  = 1024
+	defaultWriteBufferSize = 1024
+	defaultSendBufferSize  = 256
+	defaultMaxMessageSize  = 512 * 1024
+)
+
+// Defaults for WithCompression: the fastest level, and no compression for
+// messages too short to gain from it, such as single streamed tokens.
+const (
+	defaultCompressionLevel   = 1
+	defaultCompressionMinSize = 256
+)
+
+// WithTimeouts sets how long a write may take, how long a connection may go
+// without a pong before it is closed, and how often it is pinged. pingPeriod
+// must be below pongWait, or a healthy connection times out between pings;
+// the caller validates it. Zero values keep the defaults.
+func WithTimeouts(writeWait, pongWait, pingPeriod time.Duration) Option {
+	return func(h *Hub) {
+		if writeWait > 0 {
+			h.writeWait = writeWait
+		}
+		if pongWait > 0 {
+			h.pongWait = pongWait
+		}
+		if pingPeriod > 0 {
+			h.pingPeriod = pingPeriod
+		}
+	}
+}
+
+// WithBufferSizes sets the I/O buffer sizes of each connection, in bytes, and
+// the capacity of its send queue, in messages. Zero values keep the defaults.
+func WithBufferSizes(read, write, send int) Option {
+	return func(h *Hub) {
+		if read > 0 {
+			h.upgrader.ReadBufferSize = read
+		}
+		if write > 0 {
+			h.upgrader.WriteBufferSize = write
+		}
+		if send > 0 {
+			h.sendBufferSize = send
+		}
+	}
+}
+
+// WithMaxMessageSize sets the largest message a client may send, in bytes.
+// Connections sending a larger one are closed with status 1009 (message too
+// big). Zero keeps the default.
+func WithMaxMessageSize(n int64) Option {
+	return func(h *Hub) {
+		if n > 0 {
+			h.maxMessageSize = n
+		}
+	}
+}
+
+// WithCompression negotiates permessage-deflate with clients that offer it
+// and compresses messages of at least minSize bytes at level, from -2
+// (Huffman only) to 9 (best compression). It trades CPU for bandwidth,
+// which pays off on slow links and large responses.
+func WithCompression(level, minSize int) Option {
+	return func(h *Hub) {
+		h.upgrader.EnableCompression = true
+		h.compressionLevel = level
+		h.compressionMinSize = minSize
+	}
+}
+
+// newUpgrader returns an upgrader with the default buffer sizes that accepts
+// any origin.
+func newUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  defaultReadBufferSize,
+		WriteBufferSize: defaultWriteBufferSize,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+}
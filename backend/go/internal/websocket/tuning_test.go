@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_Timeouts(t *testing.T) {
+	h, srv := startHub(t,
+		WithJWTSecret(testSecret),
+		WithTimeouts(time.Second, 200*time.Millisecond, 50*time.Millisecond),
+		WithBufferSizes(0, 0, 8),
+	)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	h.rlockShards(func(s *shard) {
+		for c := range s.clients {
+			if cap(c.send) != 8 {
+				t.Errorf("expected send buffer of 8, got %d", cap(c.send))
+			}
+		}
+	})
+	if h.upgrader.ReadBufferSize != defaultReadBufferSize || h.writeWait != time.Second {
+		t.Errorf("expected unset values to keep the defaults")
+	}
+
+	// The client reads, so pongs are sent for the pings, which arrive well
+	// within the pong wait.
+	pings := make(chan struct{}, 16)
+	conn.SetPingHandler(func(appData string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for i := 0; i < 6; i++ {
+		select {
+		case <-pings:
+		case <-deadline:
+			t.Fatalf("expected pings every 50ms, got %d in 2s", i)
+		}
+	}
+	if stats := h.Stats(); stats["connections"] != 1 {
+		t.Errorf("expected the connection kept open past the pong wait, got %v", stats)
+	}
+}
+
+func TestHub_MaxMessageSize(t *testing.T) {
+	h, srv := startHub(t, WithJWTSecret(testSecret), WithMaxMessageSize(64))
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "session_id=s1&token="+signToken(t, testSecret, "user-1")), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	waitForSession(t, h, "user-1", "s1")
+
+	if err := conn.WriteMessage(websocket.TextMessage, make([]byte, 65)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Fatalf("expected close 1009, got %v", err)
+		}
+		return
+	}
+}
+
+func TestHub_Compression(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{"off by default", nil, false},
+		{"negotiated", []Option{WithCompression(defaultCompressionLevel, 16)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, srv := startHub(t, append([]Option{WithJWTSecret(testSecret)}, tt.opts...)...)
+
+			dialer := *websocket.DefaultDialer
+			dialer.EnableCompression = true
+			conn, resp, err := dialer.Dial(wsURL(srv, "session_id=s1&token="+signToken(t, testSecret, "user-1")), nil)
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			defer conn.Close()
+			waitForSession(t, h, "user-1", "s1")
+
+			negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+			if negotiated != tt.want {
+				t.Errorf("permessage-deflate negotiated = %v, want %v", negotiated, tt.want)
+			}
+
+			// Messages above and below the threshold both arrive intact.
+			for _, size := range []int{8, 4096} {
+				message := []byte(`{"type":"notice","data":"` + strings.Repeat("a", size) + `"}`)
+				h.SendToSession("s1", message)
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, got, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatalf("Failed to read: %v", err)
+				}
+				if string(got) != string(message) {
+					t.Errorf("received %d bytes, want the %d sent", len(got), len(message))
+				}
+			}
+		})
+	}
+}
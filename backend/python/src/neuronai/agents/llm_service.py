@@ -55,8 +55,14 @@ class LLMService:
             self.base_url = self.settings.ollama_base_url
             self.logger.info("Initialized Ollama client")
 
-    def _build_messages(self, prompt: str, system_prompt: str | None) -> list[dict[str, str]]:
+    def _build_messages(
+        self,
+        prompt: str,
+        system_prompt: str | None,
+        history: list[dict[str, str]] | None = None,
+    ) -> list[dict[str, str]]:
         messages = [{"role": "system", "content": system_prompt}] if system_prompt else []
+        messages.extend(history or [])
         messages.append({"role": "user", "content": prompt})
         return messages
 
@@ -66,15 +72,22 @@ class LLMService:
         model: str | None,
         max_tokens: int | None,
         temperature: float | None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
         stream: bool = False,
     ) -> dict[str, Any]:
-        return {
+        payload: dict[str, Any] = {
             "model": model or self.settings.default_model,
             "messages": messages,
             "max_tokens": max_tokens if max_tokens is not None else self.settings.max_tokens,
             "temperature": temperature if temperature is not None else self.settings.temperature,
             "stream": stream,
         }
+        if top_p is not None:
+            payload["top_p"] = top_p
+        if stop:
+            payload["stop"] = stop
+        return payload
 
     def _get_headers(self) -> dict[str, str]:
         headers = {"Content-Type": "application/json"}
@@ -92,6 +105,9 @@ class LLMService:
         model: str | None = None,
         max_tokens: int | None = None,
         temperature: float | None = None,
+        history: list[dict[str, str]] | None = None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> dict[str, Any]:
         if self.provider != LLMProvider.OLLAMA and not self.api_key:
             self.logger.error("LLM client not initialized")
@@ -100,16 +116,16 @@ class LLMService:
             )
 
         try:
-            messages = self._build_messages(prompt, system_prompt)
+            messages = self._build_messages(prompt, system_prompt, history)
             model_name = model or self.settings.default_model
 
             if self.provider == LLMProvider.OLLAMA:
                 return await self._generate_ollama_response(
-                    messages, model_name, max_tokens, temperature
+                    messages, model_name, max_tokens, temperature, top_p, stop
                 )
             else:
                 return await self._generate_openai_compatible_response(
-                    messages, model_name, max_tokens, temperature
+                    messages, model_name, max_tokens, temperature, top_p, stop
                 )
 
         except Exception as e:
@@ -122,8 +138,10 @@ class LLMService:
         model: str,
         max_tokens: int | None,
         temperature: float | None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> dict[str, Any]:
-        payload = self._build_payload(messages, model, max_tokens, temperature)
+        payload = self._build_payload(messages, model, max_tokens, temperature, top_p, stop)
 
         self.logger.info("Generating LLM response", model=model, provider=self.provider.value)
 
@@ -156,12 +174,18 @@ class LLMService:
         model: str,
         max_tokens: int | None,
         temperature: float | None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> dict[str, Any]:
         options: dict[str, Any] = {
             "temperature": temperature if temperature is not None else self.settings.temperature,
         }
         if max_tokens is not None:
             options["num_predict"] = max_tokens
+        if top_p is not None:
+            options["top_p"] = top_p
+        if stop:
+            options["stop"] = stop
 
         payload = {
             "model": model,
@@ -200,6 +224,9 @@ class LLMService:
         model: str | None = None,
         max_tokens: int | None = None,
         temperature: float | None = None,
+        history: list[dict[str, str]] | None = None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> AsyncIterator[dict[str, Any]]:
         if self.provider != LLMProvider.OLLAMA and not self.api_key:
             self.logger.error("LLM client not initialized")
@@ -211,17 +238,17 @@ class LLMService:
             return
 
         try:
-            messages = self._build_messages(prompt, system_prompt)
+            messages = self._build_messages(prompt, system_prompt, history)
             model_name = model or self.settings.default_model
 
             if self.provider == LLMProvider.OLLAMA:
                 async for chunk in self._generate_ollama_stream(
-                    messages, model_name, max_tokens, temperature
+                    messages, model_name, max_tokens, temperature, top_p, stop
                 ):
                     yield chunk
             else:
                 async for chunk in self._generate_openai_compatible_stream(
-                    messages, model_name, max_tokens, temperature
+                    messages, model_name, max_tokens, temperature, top_p, stop
                 ):
                     yield chunk
 
@@ -239,8 +266,12 @@ class LLMService:
         model: str,
         max_tokens: int | None,
         temperature: float | None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> AsyncIterator[dict[str, Any]]:
-        payload = self._build_payload(messages, model, max_tokens, temperature, stream=True)
+        payload = self._build_payload(
+            messages, model, max_tokens, temperature, top_p, stop, stream=True
+        )
 
         self.logger.info(
             "Generating streaming LLM response", model=model, provider=self.provider.value
@@ -316,12 +347,18 @@ class LLMService:
         model: str,
         max_tokens: int | None,
         temperature: float | None,
+        top_p: float | None = None,
+        stop: list[str] | None = None,
     ) -> AsyncIterator[dict[str, Any]]:
         options: dict[str, Any] = {
             "temperature": temperature if temperature is not None else self.settings.temperature,
         }
         if max_tokens is not None:
             options["num_predict"] = max_tokens
+        if top_p is not None:
+            options["top_p"] = top_p
+        if stop:
+            options["stop"] = stop
 
         payload = {
             "model": model,
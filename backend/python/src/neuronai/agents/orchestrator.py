@@ -63,8 +63,15 @@ class SwarmOrchestrator:
         user_id: str,
         content: str,
         message_type: int = 1,  # TEXT
+        history: list[dict[str, str]] | None = None,
+        generation: dict[str, Any] | None = None,
     ) -> dict[str, Any]:
-        """Process a single message and return result."""
+        """Process a single message and return result.
+
+        history holds the earlier turns of a conversation sent by a stateless
+        client, oldest first; content is its final user turn. generation holds
+        sampling parameters for the model, named as LLMService takes them.
+        """
         self.logger.info(
             "Processing message",
             session_id=session_id,
@@ -77,6 +84,8 @@ class SwarmOrchestrator:
         result = await self.llm_service.generate_response(
             prompt=PromptTemplates.build_chat_prompt(content),
             system_prompt=system_prompt,
+            history=history,
+            **(generation or {}),
         )
 
         return {
@@ -91,8 +100,10 @@ class SwarmOrchestrator:
         user_id: str,
         content: str,
         message_type: int = 1,  # TEXT
+        history: list[dict[str, str]] | None = None,
+        generation: dict[str, Any] | None = None,
     ) -> AsyncIterator[dict[str, Any]]:
-        """Process a message and stream response."""
+        """Process a message and stream response, as process_message does."""
         self.logger.info(
             "Processing stream",
             session_id=session_id,
@@ -105,6 +116,8 @@ class SwarmOrchestrator:
         async for chunk in self.llm_service.generate_stream(
             prompt=PromptTemplates.build_chat_prompt(content),
             system_prompt=system_prompt,
+            history=history,
+            **(generation or {}),
         ):
             yield {
                 "content": chunk.get("content", ""),
@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0eneuronai.proto\x12\x08neuronai\x1a\x1fgoogle/protobuf/timestamp.proto\"\x83\x02\n\x0b\x43hatRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12\x0f\n\x07user_id\x18\x02 \x01(\t\x12\x0f\n\x07\x63ontent\x18\x03 \x01(\t\x12+\n\x0cmessage_type\x18\x04 \x01(\x0e\x32\x15.neuronai.MessageType\x12)\n\x0b\x61ttachments\x18\x05 \x03(\x0b\x32\x14.neuronai.Attachment\x12\x35\n\x08metadata\x18\x06 \x03(\x0b\x32#.neuronai.ChatRequest.MetadataEntry\x1a/\n\rMetadataEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xac\x02\n\x0c\x43hatResponse\x12\x12\n\nmessage_id\x18\x01 \x01(\t\x12\x12\n\nsession_id\x18\x02 \x01(\t\x12\x0f\n\x07\x63ontent\x18\x03 \x01(\t\x12+\n\x0cmessage_type\x18\x04 \x01(\x0e\x32\x15.neuronai.MessageType\x12\'\n\nagent_type\x18\x05 \x01(\x0e\x32\x13.neuronai.AgentType\x12$\n\x06status\x18\x06 \x01(\x0e\x32\x14.neuronai.TaskStatus\x12-\n\ttimestamp\x18\x07 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x10\n\x08is_final\x18\x08 \x01(\x08\x12&\n\ntool_calls\x18\t \x03(\x0b\x32\x12.neuronai.ToolCall\"X\n\nAttachment\x12\n\n\x02id\x18\x01 \x01(\t\x12\x10\n\x08\x66ilename\x18\x02 \x01(\t\x12\x11\n\tmime_type\x18\x03 \x01(\t\x12\x0c\n\x04\x64\x61ta\x18\x04 \x01(\x0c\x12\x0b\n\x03url\x18\x05 \x01(\t\"G\n\x08ToolCall\x12\n\n\x02id\x18\x01 \x01(\t\x12\x0c\n\x04name\x18\x02 \x01(\t\x12\x11\n\targuments\x18\x03 \x01(\t\x12\x0e\n\x06result\x18\x04 \x01(\t\"\xc7\x02\n\tSwarmTask\x12\x0f\n\x07task_id\x18\x01 \x01(\t\x12\x12\n\nsession_id\x18\x02 \x01(\t\x12\x13\n\x0b\x64\x65scription\x18\x03 \x01(\t\x12\x17\n\x0frequired_agents\x18\x04 \x03(\t\x12\x31\n\x07\x63ontext\x18\x05 \x03(\x0b\x32 .neuronai.SwarmTask.ContextEntry\x12$\n\x06status\x18\x06 \x01(\x0e\x32\x14.neuronai.TaskStatus\x12.\n\ncreated_at\x18\x07 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12.\n\nupdated_at\x18\x08 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x1a.\n\x0c\x43ontextEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xe8\x01\n\nSwarmState\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12$\n\x06\x61gents\x18\x02 \x03(\x0b\x32\x14.neuronai.AgentState\x12)\n\x0c\x63urrent_task\x18\x03 \x01(\x0b\x32\x13.neuronai.SwarmTask\x12?\n\x0eshared_context\x18\x04 \x03(\x0b\x32\'.neuronai.SwarmState.SharedContextEntry\x1a\x34\n\x12SharedContextEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xce\x01\n\nAgentState\x12\x10\n\x08\x61gent_id\x18\x01 \x01(\t\x12\'\n\nagent_type\x18\x02 \x01(\x0e\x32\x13.neuronai.AgentType\x12\x0e\n\x06status\x18\x03 \x01(\t\x12\x14\n\x0c\x63urrent_task\x18\x04 \x01(\t\x12\x30\n\x06memory\x18\x05 \x03(\x0b\x32 .neuronai.AgentState.MemoryEntry\x1a-\n\x0bMemoryEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"|\n\rStreamRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12\x0f\n\x07user_id\x18\x02 \x01(\t\x12%\n\x04\x63hat\x18\x03 \x01(\x0b\x32\x15.neuronai.ChatRequestH\x00\x12\x14\n\naudio_data\x18\x04 \x01(\x0cH\x00\x42\t\n\x07payload\"\xb1\x01\n\x0eStreamResponse\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12&\n\x04\x63hat\x18\x02 \x01(\x0b\x32\x16.neuronai.ChatResponseH\x00\x12\x14\n\naudio_data\x18\x03 \x01(\x0cH\x00\x12,\n\x0cswarm_update\x18\x04 \x01(\x0b\x32\x14.neuronai.SwarmStateH\x00\x12\x14\n\x0cis_heartbeat\x18\x05 \x01(\x08\x42\t\n\x07payload\"*\n\x14GetSwarmStateRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t*\xb7\x01\n\tAgentType\x12\x1a\n\x16\x41GENT_TYPE_UNSPECIFIED\x10\x00\x12\x1b\n\x17\x41GENT_TYPE_ORCHESTRATOR\x10\x01\x12\x19\n\x15\x41GENT_TYPE_RESEARCHER\x10\x02\x12\x15\n\x11\x41GENT_TYPE_WRITER\x10\x03\x12\x13\n\x0f\x41GENT_TYPE_CODE\x10\x04\x12\x14\n\x10\x41GENT_TYPE_IMAGE\x10\x05\x12\x14\n\x10\x41GENT_TYPE_VIDEO\x10\x06*\xc3\x01\n\x0bMessageType\x12\x1c\n\x18MESSAGE_TYPE_UNSPECIFIED\x10\x00\x12\x15\n\x11MESSAGE_TYPE_TEXT\x10\x01\x12\x16\n\x12MESSAGE_TYPE_IMAGE\x10\x02\x12\x16\n\x12MESSAGE_TYPE_VIDEO\x10\x03\x12\x15\n\x11MESSAGE_TYPE_CODE\x10\x04\x12\x1a\n\x16MESSAGE_TYPE_TOOL_CALL\x10\x05\x12\x1c\n\x18MESSAGE_TYPE_TOOL_RESULT\x10\x06*\xad\x01\n\nTaskStatus\x12\x1b\n\x17TASK_STATUS_UNSPECIFIED\x10\x00\x12\x17\n\x13TASK_STATUS_PENDING\x10\x01\x12\x1b\n\x17TASK_STATUS_IN_PROGRESS\x10\x02\x12\x19\n\x15TASK_STATUS_COMPLETED\x10\x03\x12\x16\n\x12TASK_STATUS_FAILED\x10\x04\x12\x19\n\x15TASK_STATUS_CANCELLED\x10\x05\x32\xd2\x01\n\tAIService\x12<\n\x0bProcessChat\x12\x15.neuronai.ChatRequest\x1a\x16.neuronai.ChatResponse\x12\x46\n\rProcessStream\x12\x17.neuronai.StreamRequest\x1a\x18.neuronai.StreamResponse(\x01\x30\x01\x12?\n\x10\x45xecuteSwarmTask\x12\x13.neuronai.SwarmTask\x1a\x14.neuronai.SwarmState0\x01\x32\xd7\x01\n\x11SwarmOrchestrator\x12;\n\rRegisterAgent\x12\x14.neuronai.AgentState\x1a\x14.neuronai.AgentState\x12>\n\x10UpdateSwarmState\x12\x14.neuronai.SwarmState\x1a\x14.neuronai.SwarmState\x12\x45\n\rGetSwarmState\x12\x1e.neuronai.GetSwarmStateRequest\x1a\x14.neuronai.SwarmStateB1Z/github.com/neuronai/backend/go/internal/grpc/pbb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0eneuronai.proto\x12\x08neuronai\x1a\x1fgoogle/protobuf/timestamp.proto\"\x83\x02\n\x0b\x43hatRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12\x0f\n\x07user_id\x18\x02 \x01(\t\x12\x0f\n\x07\x63ontent\x18\x03 \x01(\t\x12+\n\x0cmessage_type\x18\x04 \x01(\x0e\x32\x15.neuronai.MessageType\x12)\n\x0b\x61ttachments\x18\x05 \x03(\x0b\x32\x14.neuronai.Attachment\x12\x35\n\x08metadata\x18\x06 \x03(\x0b\x32#.neuronai.ChatRequest.MetadataEntry\x1a/\n\rMetadataEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xac\x02\n\x0c\x43hatResponse\x12\x12\n\nmessage_id\x18\x01 \x01(\t\x12\x12\n\nsession_id\x18\x02 \x01(\t\x12\x0f\n\x07\x63ontent\x18\x03 \x01(\t\x12+\n\x0cmessage_type\x18\x04 \x01(\x0e\x32\x15.neuronai.MessageType\x12\'\n\nagent_type\x18\x05 \x01(\x0e\x32\x13.neuronai.AgentType\x12$\n\x06status\x18\x06 \x01(\x0e\x32\x14.neuronai.TaskStatus\x12-\n\ttimestamp\x18\x07 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x10\n\x08is_final\x18\x08 \x01(\x08\x12&\n\ntool_calls\x18\t \x03(\x0b\x32\x12.neuronai.ToolCall\"X\n\nAttachment\x12\n\n\x02id\x18\x01 \x01(\t\x12\x10\n\x08\x66ilename\x18\x02 \x01(\t\x12\x11\n\tmime_type\x18\x03 \x01(\t\x12\x0c\n\x04\x64\x61ta\x18\x04 \x01(\x0c\x12\x0b\n\x03url\x18\x05 \x01(\t\"G\n\x08ToolCall\x12\n\n\x02id\x18\x01 \x01(\t\x12\x0c\n\x04name\x18\x02 \x01(\t\x12\x11\n\targuments\x18\x03 \x01(\t\x12\x0e\n\x06result\x18\x04 \x01(\t\"\xc7\x02\n\tSwarmTask\x12\x0f\n\x07task_id\x18\x01 \x01(\t\x12\x12\n\nsession_id\x18\x02 \x01(\t\x12\x13\n\x0b\x64\x65scription\x18\x03 \x01(\t\x12\x17\n\x0frequired_agents\x18\x04 \x03(\t\x12\x31\n\x07\x63ontext\x18\x05 \x03(\x0b\x32 .neuronai.SwarmTask.ContextEntry\x12$\n\x06status\x18\x06 \x01(\x0e\x32\x14.neuronai.TaskStatus\x12.\n\ncreated_at\x18\x07 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12.\n\nupdated_at\x18\x08 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x1a.\n\x0c\x43ontextEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xe8\x01\n\nSwarmState\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12$\n\x06\x61gents\x18\x02 \x03(\x0b\x32\x14.neuronai.AgentState\x12)\n\x0c\x63urrent_task\x18\x03 \x01(\x0b\x32\x13.neuronai.SwarmTask\x12?\n\x0eshared_context\x18\x04 \x03(\x0b\x32\'.neuronai.SwarmState.SharedContextEntry\x1a\x34\n\x12SharedContextEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xce\x01\n\nAgentState\x12\x10\n\x08\x61gent_id\x18\x01 \x01(\t\x12\'\n\nagent_type\x18\x02 \x01(\x0e\x32\x13.neuronai.AgentType\x12\x0e\n\x06status\x18\x03 \x01(\t\x12\x14\n\x0c\x63urrent_task\x18\x04 \x01(\t\x12\x30\n\x06memory\x18\x05 \x03(\x0b\x32 .neuronai.AgentState.MemoryEntry\x1a-\n\x0bMemoryEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"|\n\rStreamRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12\x0f\n\x07user_id\x18\x02 \x01(\t\x12%\n\x04\x63hat\x18\x03 \x01(\x0b\x32\x15.neuronai.ChatRequestH\x00\x12\x14\n\naudio_data\x18\x04 \x01(\x0cH\x00\x42\t\n\x07payload\"\xb1\x01\n\x0eStreamResponse\x12\x12\n\nsession_id\x18\x01 \x01(\t\x12&\n\x04\x63hat\x18\x02 \x01(\x0b\x32\x16.neuronai.ChatResponseH\x00\x12\x14\n\naudio_data\x18\x03 \x01(\x0cH\x00\x12,\n\x0cswarm_update\x18\x04 \x01(\x0b\x32\x14.neuronai.SwarmStateH\x00\x12\x14\n\x0cis_heartbeat\x18\x05 \x01(\x08\x42\t\n\x07payload\"*\n\x14GetSwarmStateRequest\x12\x12\n\nsession_id\x18\x01 \x01(\t*\xb7\x01\n\tAgentType\x12\x1a\n\x16\x41GENT_TYPE_UNSPECIFIED\x10\x00\x12\x1b\n\x17\x41GENT_TYPE_ORCHESTRATOR\x10\x01\x12\x19\n\x15\x41GENT_TYPE_RESEARCHER\x10\x02\x12\x15\n\x11\x41GENT_TYPE_WRITER\x10\x03\x12\x13\n\x0f\x41GENT_TYPE_CODE\x10\x04\x12\x14\n\x10\x41GENT_TYPE_IMAGE\x10\x05\x12\x14\n\x10\x41GENT_TYPE_VIDEO\x10\x06*\xdb\x01\n\x0bMessageType\x12\x1c\n\x18MESSAGE_TYPE_UNSPECIFIED\x10\x00\x12\x15\n\x11MESSAGE_TYPE_TEXT\x10\x01\x12\x16\n\x12MESSAGE_TYPE_IMAGE\x10\x02\x12\x16\n\x12MESSAGE_TYPE_VIDEO\x10\x03\x12\x15\n\x11MESSAGE_TYPE_CODE\x10\x04\x12\x1a\n\x16MESSAGE_TYPE_TOOL_CALL\x10\x05\x12\x1c\n\x18MESSAGE_TYPE_TOOL_RESULT\x10\x06\x12\x16\n\x12MESSAGE_TYPE_AUDIO\x10\x07*\xad\x01\n\nTaskStatus\x12\x1b\n\x17TASK_STATUS_UNSPECIFIED\x10\x00\x12\x17\n\x13TASK_STATUS_PENDING\x10\x01\x12\x1b\n\x17TASK_STATUS_IN_PROGRESS\x10\x02\x12\x19\n\x15TASK_STATUS_COMPLETED\x10\x03\x12\x16\n\x12TASK_STATUS_FAILED\x10\x04\x12\x19\n\x15TASK_STATUS_CANCELLED\x10\x05\x32\xd2\x01\n\tAIService\x12<\n\x0bProcessChat\x12\x15.neuronai.ChatRequest\x1a\x16.neuronai.ChatResponse\x12\x46\n\rProcessStream\x12\x17.neuronai.StreamRequest\x1a\x18.neuronai.StreamResponse(\x01\x30\x01\x12?\n\x10\x45xecuteSwarmTask\x12\x13.neuronai.SwarmTask\x1a\x14.neuronai.SwarmState0\x01\x32\xd7\x01\n\x11SwarmOrchestrator\x12;\n\rRegisterAgent\x12\x14.neuronai.AgentState\x1a\x14.neuronai.AgentState\x12>\n\x10UpdateSwarmState\x12\x14.neuronai.SwarmState\x1a\x14.neuronai.SwarmState\x12\x45\n\rGetSwarmState\x12\x1e.neuronai.GetSwarmStateRequest\x1a\x14.neuronai.SwarmStateB1Z/github.com/neuronai/backend/go/internal/grpc/pbb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -43,9 +43,9 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['_AGENTTYPE']._serialized_start=1914
   _globals['_AGENTTYPE']._serialized_end=2097
   _globals['_MESSAGETYPE']._serialized_start=2100
-  _globals['_MESSAGETYPE']._serialized_end=2295
-  _globals['_TASKSTATUS']._serialized_start=2298
-  _globals['_TASKSTATUS']._serialized_end=2471
+  _globals['_MESSAGETYPE']._serialized_end=2319
+  _globals['_TASKSTATUS']._serialized_start=2322
+  _globals['_TASKSTATUS']._serialized_end=2495
   _globals['_CHATREQUEST']._serialized_start=62
   _globals['_CHATREQUEST']._serialized_end=321
   _globals['_CHATREQUEST_METADATAENTRY']._serialized_start=274
@@ -74,8 +74,8 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['_STREAMRESPONSE']._serialized_end=1867
   _globals['_GETSWARMSTATEREQUEST']._serialized_start=1869
   _globals['_GETSWARMSTATEREQUEST']._serialized_end=1911
-  _globals['_AISERVICE']._serialized_start=2474
-  _globals['_AISERVICE']._serialized_end=2684
-  _globals['_SWARMORCHESTRATOR']._serialized_start=2687
-  _globals['_SWARMORCHESTRATOR']._serialized_end=2902
+  _globals['_AISERVICE']._serialized_start=2498
+  _globals['_AISERVICE']._serialized_end=2708
+  _globals['_SWARMORCHESTRATOR']._serialized_start=2711
+  _globals['_SWARMORCHESTRATOR']._serialized_end=2926
 # @@protoc_insertion_point(module_scope)
@@ -1,9 +1,12 @@
 """NeuronAI gRPC server implementation."""
 
 import asyncio
+import json
+import time
 import uuid
 from collections.abc import AsyncIterator
 from concurrent import futures
+from typing import Any
 
 import grpc
 import structlog
@@ -16,6 +19,71 @@ from neuronai.grpc import neuronai_pb2, neuronai_pb2_grpc
 
 logger = structlog.get_logger()
 
+# The gateway names each unary chat with this metadata key and reuses it when
+# it retries the chat on another connection.
+IDEMPOTENCY_KEY = "x-idempotency-key"
+# How long a chat's result is kept to answer retries of it.
+IDEMPOTENCY_TTL_SECONDS = 300.0
+# The gateway forwards the earlier turns of a stateless client's conversation,
+# JSON encoded, under this metadata key. The request content is its last turn.
+CONVERSATION_KEY = "conversation.messages"
+# The gateway forwards a client's sampling parameters under these metadata
+# keys: numbers as decimal strings, stop sequences as a JSON array.
+TEMPERATURE_KEY = "generation.temperature"
+MAX_TOKENS_KEY = "generation.max_tokens"
+TOP_P_KEY = "generation.top_p"
+STOP_KEY = "generation.stop"
+
+
+def conversation_history(request: neuronai_pb2.ChatRequest) -> list[dict[str, str]]:
+    """Return the earlier turns of the conversation request continues."""
+    data = request.metadata.get(CONVERSATION_KEY)
+    if not data:
+        return []
+    try:
+        messages = json.loads(data)
+    except json.JSONDecodeError:
+        logger.warning("Ignoring malformed conversation history", session_id=request.session_id)
+        return []
+    if not isinstance(messages, list):
+        return []
+    return [
+        {"role": m["role"], "content": m["content"]}
+        for m in messages
+        if isinstance(m, dict)
+        and isinstance(m.get("role"), str)
+        and isinstance(m.get("content"), str)
+    ]
+
+
+def generation_params(request: neuronai_pb2.ChatRequest) -> dict[str, Any]:
+    """Return the sampling parameters request carries, as LLMService takes them.
+
+    The gateway validates them; a value that still fails to parse is dropped
+    so the model default applies.
+    """
+    params: dict[str, Any] = {}
+    for key, name, parse in (
+        (TEMPERATURE_KEY, "temperature", float),
+        (MAX_TOKENS_KEY, "max_tokens", int),
+        (TOP_P_KEY, "top_p", float),
+        (STOP_KEY, "stop", json.loads),
+    ):
+        value = request.metadata.get(key)
+        if not value:
+            continue
+        try:
+            params[name] = parse(value)
+        except ValueError:
+            logger.warning("Ignoring malformed generation parameter", key=key)
+    stop = params.get("stop")
+    if stop is not None and not (
+        isinstance(stop, list) and all(isinstance(s, str) for s in stop)
+    ):
+        logger.warning("Ignoring malformed generation parameter", key=STOP_KEY)
+        del params["stop"]
+    return params
+
 
 class AIServiceServicer(neuronai_pb2_grpc.AIServiceServicer):
     """gRPC service implementation for AI processing."""
@@ -23,13 +91,59 @@ class AIServiceServicer(neuronai_pb2_grpc.AIServiceServicer):
     def __init__(self) -> None:
         self.orchestrator = SwarmOrchestrator()
         self.logger = logger.bind(service="AIService")
+        # Chats by user, session and idempotency key, with when they started.
+        self._chats: dict[
+            tuple[str, str, str], tuple[float, asyncio.Future[neuronai_pb2.ChatResponse]]
+        ] = {}
 
     async def ProcessChat(
         self,
         request: neuronai_pb2.ChatRequest,
         context: grpc.ServicerContext,
     ) -> neuronai_pb2.ChatResponse:
-        """Process a single chat message."""
+        """Process a single chat message.
+
+        A retry carrying the idempotency key of a chat already received is
+        answered from that chat instead of running it twice. Keys are scoped
+        to the user and session, so a repeated key never answers one user's
+        chat with another's response. The chat keeps running if the attempt
+        that started it is cancelled, so the retry can still collect its
+        result.
+        """
+        idempotency_key = dict(context.invocation_metadata() or ()).get(IDEMPOTENCY_KEY)
+        if not idempotency_key:
+            return await self._process_chat(request, context)
+        key = (request.user_id, request.session_id, idempotency_key)
+
+        self._evict_chats()
+        if key in self._chats:
+            self.logger.info(
+                "Answering retried chat from its first attempt",
+                session_id=request.session_id,
+                user_id=request.user_id,
+            )
+            response = await asyncio.shield(self._chats[key][1])
+            if response.status == neuronai_pb2.TASK_STATUS_FAILED:
+                context.set_code(grpc.StatusCode.INTERNAL)
+                context.set_details(response.content)
+            return response
+
+        chat = asyncio.ensure_future(self._process_chat(request, context))
+        self._chats[key] = (time.monotonic(), chat)
+        return await asyncio.shield(chat)
+
+    def _evict_chats(self) -> None:
+        """Forget finished chats older than the idempotency TTL."""
+        cutoff = time.monotonic() - IDEMPOTENCY_TTL_SECONDS
+        for key, (started, chat) in list(self._chats.items()):
+            if started < cutoff and chat.done():
+                del self._chats[key]
+
+    async def _process_chat(
+        self,
+        request: neuronai_pb2.ChatRequest,
+        context: grpc.ServicerContext,
+    ) -> neuronai_pb2.ChatResponse:
         self.logger.info(
             "Processing chat request",
             session_id=request.session_id,
@@ -43,6 +157,8 @@ class AIServiceServicer(neuronai_pb2_grpc.AIServiceServicer):
                 user_id=request.user_id,
                 content=request.content,
                 message_type=request.message_type,
+                history=conversation_history(request),
+                generation=generation_params(request),
             )
 
             return neuronai_pb2.ChatResponse(
@@ -91,6 +207,8 @@ class AIServiceServicer(neuronai_pb2_grpc.AIServiceServicer):
                         user_id=chat_req.user_id,
                         content=chat_req.content,
                         message_type=chat_req.message_type,
+                        history=conversation_history(chat_req),
+                        generation=generation_params(chat_req),
                     ):
                         yield neuronai_pb2.StreamResponse(
                             session_id=request.session_id,
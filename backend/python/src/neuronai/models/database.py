@@ -34,7 +34,7 @@ class Message(BaseModel):
     session_id: str
     user_id: str
     content: str
-    message_type: str = "text"  # text, image, video, code
+    message_type: str = "text"  # text, image, video, code, audio
     agent_type: str = "orchestrator"
     attachments: list[dict[str, Any]] = Field(default_factory=list)
     metadata: dict[str, Any] = Field(default_factory=dict)
@@ -0,0 +1,65 @@
+"""Tests for the LLM service."""
+
+from unittest.mock import MagicMock, patch
+
+import pytest
+
+from neuronai.agents.llm_service import LLMProvider, LLMService
+
+
+class TestLLMService:
+    """Test cases for LLMService class."""
+
+    def test_build_messages_with_history(self):
+        """Test that conversation history sits between the system prompt and the prompt."""
+        service = LLMService()
+        history = [
+            {"role": "user", "content": "Hi"},
+            {"role": "assistant", "content": "Hello"},
+        ]
+
+        messages = service._build_messages("How are you?", "Be brief.", history)
+
+        assert messages == [
+            {"role": "system", "content": "Be brief."},
+            {"role": "user", "content": "Hi"},
+            {"role": "assistant", "content": "Hello"},
+            {"role": "user", "content": "How are you?"},
+        ]
+
+    @pytest.mark.asyncio
+    async def test_generate_response_sends_generation_params(self):
+        """Test that sampling parameters are sent to an OpenAI-compatible API."""
+        service = LLMService()
+        service.provider = LLMProvider.OPENAI
+        service.api_key = "test-key"
+        response = MagicMock()
+        response.json.return_value = {"choices": [{"message": {"content": "Hi"}}]}
+
+        with patch("neuronai.agents.llm_service.requests.post", return_value=response) as post:
+            result = await service.generate_response(
+                "Hello", temperature=0.2, max_tokens=64, top_p=0.9, stop=["END"]
+            )
+
+        assert result["content"] == "Hi"
+        payload = post.call_args.kwargs["json"]
+        assert payload["temperature"] == 0.2
+        assert payload["max_tokens"] == 64
+        assert payload["top_p"] == 0.9
+        assert payload["stop"] == ["END"]
+
+    @pytest.mark.asyncio
+    async def test_generate_response_sends_ollama_options(self):
+        """Test that sampling parameters are sent to Ollama as options."""
+        service = LLMService()
+        service.provider = LLMProvider.OLLAMA
+        response = MagicMock()
+        response.json.return_value = {"message": {"content": "Hi"}}
+
+        with patch("neuronai.agents.llm_service.requests.post", return_value=response) as post:
+            await service.generate_response(
+                "Hello", temperature=0.2, max_tokens=64, top_p=0.9, stop=["END"]
+            )
+
+        options = post.call_args.kwargs["json"]["options"]
+        assert options == {"temperature": 0.2, "num_predict": 64, "top_p": 0.9, "stop": ["END"]}
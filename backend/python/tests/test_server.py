@@ -131,6 +131,156 @@ class TestAIServiceServicer:
         context.set_code.assert_called()
         context.set_details.assert_called()
 
+    @pytest.mark.asyncio
+    async def test_process_chat_retry_is_idempotent(self, servicer, mock_chat_request):
+        """Test that a retry under the same idempotency key runs the chat once."""
+        from neuronai.grpc.server import IDEMPOTENCY_KEY
+
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+        context.invocation_metadata.return_value = ((IDEMPOTENCY_KEY, "key-1"),)
+
+        with patch.object(
+            servicer.orchestrator,
+            "process_message",
+            AsyncMock(return_value={"content": "Hi there"}),
+        ) as process_message:
+            first = await servicer.ProcessChat(mock_chat_request, context)
+            retry = await servicer.ProcessChat(mock_chat_request, context)
+
+        process_message.assert_awaited_once()
+        assert retry.message_id == first.message_id
+        assert retry.content == "Hi there"
+
+    @pytest.mark.asyncio
+    async def test_process_chat_idempotency_key_is_scoped_to_user(
+        self, servicer, mock_chat_request
+    ):
+        """Test that another user's chat under the same key is not deduped."""
+        from neuronai.grpc import neuronai_pb2
+        from neuronai.grpc.server import IDEMPOTENCY_KEY
+
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+        context.invocation_metadata.return_value = ((IDEMPOTENCY_KEY, "key-1"),)
+        other = neuronai_pb2.ChatRequest(
+            session_id="session-123",
+            user_id="user-789",
+            content="Hello, world!",
+            message_type=1,
+        )
+
+        with patch.object(
+            servicer.orchestrator,
+            "process_message",
+            AsyncMock(side_effect=[{"content": "Hi there"}, {"content": "Hello"}]),
+        ) as process_message:
+            first = await servicer.ProcessChat(mock_chat_request, context)
+            second = await servicer.ProcessChat(other, context)
+
+        assert process_message.await_count == 2
+        assert second.message_id != first.message_id
+        assert second.content == "Hello"
+
+    @pytest.mark.asyncio
+    async def test_process_chat_forwards_conversation_history(self, servicer, mock_llm_service):
+        """Test that the conversation history in metadata reaches the model."""
+        import json
+
+        from neuronai.grpc import neuronai_pb2
+        from neuronai.grpc.server import CONVERSATION_KEY
+
+        history = [
+            {"role": "system", "content": "Answer in French."},
+            {"role": "user", "content": "Hi"},
+            {"role": "assistant", "content": "Bonjour"},
+        ]
+        request = neuronai_pb2.ChatRequest(
+            session_id="session-123",
+            user_id="user-456",
+            content="How are you?",
+            message_type=1,
+            metadata={CONVERSATION_KEY: json.dumps(history)},
+        )
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+
+        await servicer.ProcessChat(request, context)
+
+        generate_response = mock_llm_service.return_value.generate_response
+        assert generate_response.await_args.kwargs["history"] == history
+
+    @pytest.mark.asyncio
+    async def test_process_chat_ignores_malformed_history(self, servicer, mock_llm_service):
+        """Test that malformed conversation history is dropped."""
+        from neuronai.grpc import neuronai_pb2
+        from neuronai.grpc.server import CONVERSATION_KEY
+
+        request = neuronai_pb2.ChatRequest(
+            session_id="session-123",
+            user_id="user-456",
+            content="How are you?",
+            message_type=1,
+            metadata={CONVERSATION_KEY: "not json"},
+        )
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+
+        response = await servicer.ProcessChat(request, context)
+
+        assert response.is_final is True
+        generate_response = mock_llm_service.return_value.generate_response
+        assert generate_response.await_args.kwargs["history"] == []
+
+    @pytest.mark.asyncio
+    async def test_process_chat_forwards_generation_params(self, servicer, mock_llm_service):
+        """Test that the sampling parameters in metadata reach the model."""
+        from neuronai.grpc import neuronai_pb2
+        from neuronai.grpc.server import MAX_TOKENS_KEY, STOP_KEY, TEMPERATURE_KEY, TOP_P_KEY
+
+        request = neuronai_pb2.ChatRequest(
+            session_id="session-123",
+            user_id="user-456",
+            content="Hello, world!",
+            message_type=1,
+            metadata={
+                TEMPERATURE_KEY: "0.2",
+                MAX_TOKENS_KEY: "64",
+                TOP_P_KEY: "0.9",
+                STOP_KEY: '["END"]',
+                "key": "value",
+            },
+        )
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+
+        await servicer.ProcessChat(request, context)
+
+        kwargs = mock_llm_service.return_value.generate_response.await_args.kwargs
+        assert kwargs["temperature"] == 0.2
+        assert kwargs["max_tokens"] == 64
+        assert kwargs["top_p"] == 0.9
+        assert kwargs["stop"] == ["END"]
+
+    @pytest.mark.asyncio
+    async def test_process_chat_drops_malformed_generation_params(
+        self, servicer, mock_llm_service
+    ):
+        """Test that unparseable sampling parameters leave the model defaults."""
+        from neuronai.grpc import neuronai_pb2
+        from neuronai.grpc.server import MAX_TOKENS_KEY, STOP_KEY, TEMPERATURE_KEY
+
+        request = neuronai_pb2.ChatRequest(
+            session_id="session-123",
+            user_id="user-456",
+            content="Hello, world!",
+            message_type=1,
+            metadata={TEMPERATURE_KEY: "warm", MAX_TOKENS_KEY: "64", STOP_KEY: '"END"'},
+        )
+        context = MagicMock(spec=grpc.aio.ServicerContext)
+
+        await servicer.ProcessChat(request, context)
+
+        kwargs = mock_llm_service.return_value.generate_response.await_args.kwargs
+        assert "temperature" not in kwargs
+        assert "stop" not in kwargs
+        assert kwargs["max_tokens"] == 64
+
     @pytest.mark.asyncio
     async def test_process_stream_basic(self, servicer, mock_stream_request):
         """Test basic stream processing."""
@@ -63,7 +63,12 @@ class ChatProvider extends ChangeNotifier {
     notifyListeners();
 
     // Connect WebSocket for this session
-    await _wsService.connect(userId: 'current_user', sessionId: session.id);
+    if (_authToken == null) {
+      _error = 'Not signed in';
+      notifyListeners();
+      return;
+    }
+    await _wsService.connect(token: _authToken!, sessionId: session.id);
   }
 
   Future<void> sendMessage(
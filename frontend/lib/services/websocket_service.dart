@@ -17,13 +17,16 @@ class WebSocketService {
   Stream<bool> get connectionStream => _connectionController.stream;
   bool get isConnected => _isConnected;
 
+  /// Opens the WebSocket for [sessionId] and authenticates it with the
+  /// access [token] in an auth frame, so the token never appears in the URL.
   Future<void> connect({
-    required String userId,
+    required String token,
     required String sessionId,
     String baseUrl = 'ws://localhost:8080',
   }) async {
     try {
-      final wsUrl = '$baseUrl/ws?user_id=$userId&session_id=$sessionId';
+      final wsUrl =
+          '$baseUrl/ws?session_id=${Uri.encodeQueryComponent(sessionId)}';
 
       if (kIsWeb) {
         _channel = WebSocketChannel.connect(Uri.parse(wsUrl));
@@ -35,6 +38,9 @@ class WebSocketService {
         (message) {
           try {
             final data = jsonDecode(message) as Map<String, dynamic>;
+            if (data['event'] == 'authenticated') {
+              return;
+            }
             _messageController.add(data);
           } catch (e) {
             if (kDebugMode) {
@@ -56,6 +62,8 @@ class WebSocketService {
         },
       );
 
+      _channel!.sink.add(jsonEncode({'type': 'auth', 'token': token}));
+
       _isConnected = true;
       _connectionController.add(true);
 